@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/runner"
+	"github.com/joho/godotenv"
+)
+
+// platformPlaceholder matches template namespaces that need the platform at execution time
+var platformPlaceholder = regexp.MustCompile(`\{\{\s*\$(state|secret)\.`)
+
+// Compile exports a workflow as a bundle for the runner package, and optionally generates a
+// standalone Go program embedding it, so that a finished flow can run inside another service
+// without the platform. Experimental: only stateless executors are supported.
+func main() {
+	workflowID := flag.Uint("workflow", 0, "ID of the workflow to export")
+	outDir := flag.String("out", ".", "directory to write the bundle (and program) to")
+	outputFormat := flag.String("format", "go", "go for a standalone program, bundle for the bundle only")
+	flag.Parse()
+
+	if *workflowID == 0 {
+		log.Fatal("-workflow is required")
+	}
+	if *outputFormat != "go" && *outputFormat != "bundle" {
+		log.Fatal("-format must be go or bundle")
+	}
+
+	// Load environment variables
+	godotenv.Load()
+
+	// Initialize database connection
+	database.Initialize(os.Getenv("DATABASE_URL"))
+
+	bundle, err := export(*workflowID)
+	if err != nil {
+		log.Fatalf("Cannot export workflow %d: %v", *workflowID, err)
+	}
+
+	if err := os.MkdirAll(*outDir, 0o755); err != nil {
+		log.Fatal(err)
+	}
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(*outDir, "bundle.json"), data, 0o644); err != nil {
+		log.Fatal(err)
+	}
+
+	if *outputFormat == "bundle" {
+		fmt.Printf("Wrote %s, run it with: go run github.com/altipard/flowcraft/cmd/run -bundle %s\n",
+			filepath.Join(*outDir, "bundle.json"), filepath.Join(*outDir, "bundle.json"))
+		return
+	}
+
+	program, err := generateProgram(bundle)
+	if err != nil {
+		log.Fatalf("Failed to generate program: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(*outDir, "main.go"), program, 0o644); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote %s and bundle.json. Build the program with:\n", filepath.Join(*outDir, "main.go"))
+	fmt.Printf("  cd %s && go mod init <module> && go get github.com/altipard/flowcraft && go build\n", *outDir)
+}
+
+// export loads the workflow and converts it into a bundle, failing for anything the runner
+// cannot execute without the platform
+func export(workflowID uint) (*runner.Bundle, error) {
+	var workflow models.Workflow
+	if err := database.DB.Preload("Nodes").Preload("Connections").Preload("Groups").First(&workflow, workflowID).Error; err != nil {
+		return nil, err
+	}
+
+	bundle := &runner.Bundle{
+		Version:     runner.BundleVersion,
+		WorkflowID:  workflow.ID,
+		Name:        workflow.Name,
+		Nodes:       []runner.Node{},
+		Connections: []runner.Connection{},
+	}
+
+	disabledGroups := map[uint]bool{}
+	for _, group := range workflow.Groups {
+		disabledGroups[group.ID] = group.Disabled
+	}
+
+	var problems []string
+	for _, node := range workflow.Nodes {
+		// Sticky notes only document the workflow on the canvas
+		if node.IsAnnotation() {
+			continue
+		}
+
+		var nodeType models.NodeType
+		if err := database.DB.Where("key = ?", node.NodeType).First(&nodeType).Error; err != nil {
+			problems = append(problems, fmt.Sprintf("node %d (%s): unknown node type %s", node.ID, node.Name, node.NodeType))
+			continue
+		}
+		if !runner.Supports(nodeType.ExecutorClass) {
+			problems = append(problems, fmt.Sprintf("node %d (%s): executor class %s is not supported", node.ID, node.Name, nodeType.ExecutorClass))
+		}
+		if node.CompensationNodeID != nil {
+			problems = append(problems, fmt.Sprintf("node %d (%s): compensation is not supported", node.ID, node.Name))
+		}
+		if node.Disabled {
+			problems = append(problems, fmt.Sprintf("node %d (%s): disabled nodes are not supported", node.ID, node.Name))
+		}
+		if node.GroupID != nil && disabledGroups[*node.GroupID] {
+			problems = append(problems, fmt.Sprintf("node %d (%s): disabled groups are not supported", node.ID, node.Name))
+		}
+		if platformPlaceholder.MatchString(node.Config) {
+			problems = append(problems, fmt.Sprintf("node %d (%s): $state and $secret placeholders are not supported", node.ID, node.Name))
+		}
+
+		config := map[string]interface{}{}
+		if node.Config != "" {
+			if err := json.Unmarshal([]byte(node.Config), &config); err != nil {
+				problems = append(problems, fmt.Sprintf("node %d (%s): invalid config: %v", node.ID, node.Name, err))
+			}
+		}
+		bundle.Nodes = append(bundle.Nodes, runner.Node{
+			ID:            node.ID,
+			Name:          node.Name,
+			NodeType:      node.NodeType,
+			ExecutorClass: nodeType.ExecutorClass,
+			Config:        config,
+		})
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("\n  %s", strings.Join(problems, "\n  "))
+	}
+
+	for _, conn := range workflow.Connections {
+		bundle.Connections = append(bundle.Connections, runner.Connection{
+			SourceNodeID: conn.SourceNodeID,
+			TargetNodeID: conn.TargetNodeID,
+			SourceHandle: conn.SourceHandle,
+			TargetHandle: conn.TargetHandle,
+		})
+	}
+	return bundle, bundle.Validate()
+}
+
+// programTemplate is the standalone program embedding the bundle
+var programTemplate = template.Must(template.New("program").Parse(`// Code generated by flowcraft compile from workflow {{.WorkflowID}} ({{printf "%q" .Name}}). DO NOT EDIT.
+
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+
+	"github.com/altipard/flowcraft/runner"
+)
+
+//go:embed bundle.json
+var bundleData []byte
+
+// main runs the workflow with the JSON object read from stdin as input and writes the outputs
+// of its nodes to stdout
+func main() {
+	bundle, err := runner.Load(bundleData)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	input := map[string]interface{}{}
+	if err := json.NewDecoder(os.Stdin).Decode(&input); err != nil && err != io.EOF {
+		log.Fatalf("failed to parse input: %v", err)
+	}
+
+	result, err := runner.Run(context.Background(), bundle, input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+}
+`))
+
+// generateProgram renders and formats the program for the bundle
+func generateProgram(bundle *runner.Bundle) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := programTemplate.Execute(&buf, bundle); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/blob"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/dispatch"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/queue"
+	"github.com/joho/godotenv"
+)
+
+// loadgenNodeType is the node type of the generated workflows. Its nodes run the built-in
+// transform executor, so that the measurements cover the engine rather than external services.
+const loadgenNodeType = "loadgen.step"
+
+// options configure a load test run
+type options struct {
+	Workflows    int
+	Width        int
+	Depth        int
+	Executions   int
+	Concurrency  int
+	Rate         float64
+	PayloadSize  int
+	Timeout      time.Duration
+	PollInterval time.Duration
+	Organization uint
+	Keep         bool
+	Output       string
+	Baseline     string
+	Tolerance    float64
+}
+
+// Loadgen generates synthetic workflows, drives executions of them through the queue and the
+// workers, and reports throughput and latency percentiles. Compared against a baseline report
+// it fails on regressions, e.g. in a release pipeline.
+func main() {
+	opts := options{}
+	flag.IntVar(&opts.Workflows, "workflows", 1, "number of synthetic workflows to generate")
+	flag.IntVar(&opts.Width, "width", 4, "number of parallel branches of each workflow")
+	flag.IntVar(&opts.Depth, "depth", 5, "number of nodes of each branch")
+	flag.IntVar(&opts.Executions, "executions", 500, "total number of executions to start")
+	flag.IntVar(&opts.Concurrency, "concurrency", 8, "number of concurrent dispatchers")
+	flag.Float64Var(&opts.Rate, "rate", 0, "executions started per second (0 for as fast as possible)")
+	flag.IntVar(&opts.PayloadSize, "payload-size", 256, "size of the input of each execution in bytes")
+	flag.DurationVar(&opts.Timeout, "timeout", 10*time.Minute, "how long to wait for the executions to finish")
+	flag.DurationVar(&opts.PollInterval, "poll-interval", 250*time.Millisecond, "how often to check for finished executions")
+	flag.UintVar(&opts.Organization, "organization", 0, "organization owning the generated workflows")
+	flag.BoolVar(&opts.Keep, "keep", false, "keep the generated workflows after the run")
+	flag.StringVar(&opts.Output, "out", "", "write the report as JSON to this file")
+	flag.StringVar(&opts.Baseline, "baseline", "", "compare the report with this JSON report and fail on regressions")
+	flag.Float64Var(&opts.Tolerance, "tolerance", 0.1, "allowed regression against the baseline (0.1 = 10%)")
+	flag.Parse()
+
+	if opts.Workflows < 1 || opts.Width < 1 || opts.Depth < 1 || opts.Executions < 1 || opts.Concurrency < 1 {
+		log.Fatal("workflows, width, depth, executions and concurrency must be at least 1")
+	}
+
+	// Load environment variables
+	godotenv.Load()
+
+	// Initialize database connection
+	database.Initialize(os.Getenv("DATABASE_URL"))
+
+	// Store for payloads offloaded from large task messages
+	blobStore, err := blob.NewStore(blob.ConfigFromEnv())
+	if err != nil {
+		log.Fatal(err)
+	}
+	blob.Configure(blobStore)
+
+	// Initialize queue client
+	queue.Configure(queue.ConfigFromEnv())
+	queueClient, err := queue.NewQueueClient(queue.RedisConfigFromEnv())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ensureNodeType(); err != nil {
+		log.Fatalf("failed to create node type: %v", err)
+	}
+
+	// Generate the workflows
+	workflows := make([]models.Workflow, 0, opts.Workflows)
+	for i := 0; i < opts.Workflows; i++ {
+		workflow, err := generateWorkflow(opts, i)
+		if err != nil {
+			log.Fatalf("failed to generate workflow: %v", err)
+		}
+		workflows = append(workflows, *workflow)
+	}
+	if !opts.Keep {
+		defer cleanup(workflows)
+	}
+	log.Printf("generated %d workflows with %d nodes each", len(workflows), nodeCount(opts))
+
+	// Start the executions and wait for them to finish
+	dispatcher := dispatch.NewDispatcher(queueClient)
+	start := time.Now()
+	executionIDs, dispatchErrors := run(dispatcher, workflows, opts)
+	dispatched := time.Since(start)
+	log.Printf("started %d executions in %s (%d failed to start)", len(executionIDs), dispatched.Round(time.Millisecond), dispatchErrors)
+
+	results := await(executionIDs, opts)
+	report := newReport(opts, results, dispatchErrors, dispatched, time.Since(start))
+	report.Print(os.Stdout)
+
+	if opts.Output != "" {
+		if err := report.Save(opts.Output); err != nil {
+			log.Fatalf("failed to write report: %v", err)
+		}
+	}
+
+	// Compare with the baseline
+	if opts.Baseline != "" {
+		baseline, err := loadReport(opts.Baseline)
+		if err != nil {
+			log.Fatalf("failed to read baseline: %v", err)
+		}
+		if regressions := report.Compare(baseline, opts.Tolerance); len(regressions) > 0 {
+			if !opts.Keep {
+				cleanup(workflows)
+			}
+			log.Fatalf("performance regressed against %s:\n  %s", opts.Baseline, strings.Join(regressions, "\n  "))
+		}
+		log.Printf("no regressions against %s", opts.Baseline)
+	}
+}
+
+// ensureNodeType creates the node type of the generated workflows if it does not exist
+func ensureNodeType() error {
+	nodeType := models.NodeType{
+		Key:           loadgenNodeType,
+		Name:          "Load Test Step",
+		Description:   "Step of the synthetic workflows generated by loadgen",
+		Category:      "Testing",
+		ConfigSchema:  "{}",
+		InputSchema:   "{}",
+		OutputSchema:  "{}",
+		ExecutorClass: "transform",
+	}
+	return database.DB.Where("key = ?", loadgenNodeType).FirstOrCreate(&nodeType).Error
+}
+
+// nodeCount returns the number of nodes of a generated workflow
+func nodeCount(opts options) int {
+	return 1 + opts.Width*opts.Depth
+}
+
+// generateWorkflow creates a workflow with a start node fanning out to width branches of depth
+// nodes each
+func generateWorkflow(opts options, index int) (*models.Workflow, error) {
+	workflow := models.Workflow{
+		Name:           fmt.Sprintf("loadgen %s #%d (%dx%d)", time.Now().Format("2006-01-02 15:04:05"), index+1, opts.Width, opts.Depth),
+		Description:    "Synthetic workflow generated by loadgen",
+		OrganizationID: opts.Organization,
+		IsActive:       true,
+		CaptureMode:    models.CaptureFull,
+	}
+	if err := database.DB.Create(&workflow).Error; err != nil {
+		return nil, err
+	}
+
+	start, err := createNode(workflow.ID, "start", 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	for branch := 0; branch < opts.Width; branch++ {
+		previous := start
+		for step := 0; step < opts.Depth; step++ {
+			node, err := createNode(workflow.ID, fmt.Sprintf("branch %d step %d", branch+1, step+1), step+1, branch)
+			if err != nil {
+				return nil, err
+			}
+			connection := models.Connection{
+				WorkflowID:   workflow.ID,
+				SourceNodeID: previous.ID,
+				TargetNodeID: node.ID,
+				SourceHandle: "output",
+				TargetHandle: "input",
+			}
+			if err := database.DB.Create(&connection).Error; err != nil {
+				return nil, err
+			}
+			previous = node
+		}
+	}
+
+	return &workflow, nil
+}
+
+// createNode creates a node of the load test node type
+func createNode(workflowID uint, name string, column, row int) (*models.Node, error) {
+	node := models.Node{
+		WorkflowID: workflowID,
+		NodeType:   loadgenNodeType,
+		Name:       name,
+		PositionX:  float64(column) * 250,
+		PositionY:  float64(row) * 150,
+		Config:     fmt.Sprintf(`{"mapping": {"step": %q}}`, name),
+	}
+	if err := database.DB.Create(&node).Error; err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// run starts the executions round-robin across the workflows and returns the IDs of the started
+// executions and the number of executions that could not be started
+func run(dispatcher *dispatch.Dispatcher, workflows []models.Workflow, opts options) ([]uint, int) {
+	input := map[string]interface{}{
+		"payload": strings.Repeat("x", opts.PayloadSize),
+	}
+
+	// Pace the dispatchers if a rate is configured
+	var ticker *time.Ticker
+	if opts.Rate > 0 {
+		ticker = time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+		defer ticker.Stop()
+	}
+
+	jobs := make(chan int)
+	go func() {
+		for i := 0; i < opts.Executions; i++ {
+			if ticker != nil {
+				<-ticker.C
+			}
+			jobs <- i
+		}
+		close(jobs)
+	}()
+
+	var (
+		mu     sync.Mutex
+		ids    = make([]uint, 0, opts.Executions)
+		failed int
+		wg     sync.WaitGroup
+	)
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				execution, err := dispatcher.Dispatch(workflows[i%len(workflows)], input)
+
+				mu.Lock()
+				if err != nil {
+					failed++
+					if failed <= 10 {
+						log.Printf("failed to start execution: %v", err)
+					}
+				} else {
+					ids = append(ids, execution.ID)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	return ids, failed
+}
+
+// executionResult is the outcome of a single execution
+type executionResult struct {
+	ID          uint
+	Status      string
+	StartedAt   time.Time
+	CompletedAt *time.Time
+}
+
+// await polls the executions until all of them finished or the timeout expired. Executions still
+// running then are returned with their current status.
+func await(ids []uint, opts options) []executionResult {
+	pending := make(map[uint]bool, len(ids))
+	for _, id := range ids {
+		pending[id] = true
+	}
+	results := make([]executionResult, 0, len(ids))
+
+	deadline := time.Now().Add(opts.Timeout)
+	lastLog := time.Now()
+	for len(pending) > 0 {
+		open := make([]uint, 0, len(pending))
+		for id := range pending {
+			open = append(open, id)
+		}
+
+		// Query in chunks to stay below the parameter limit of the database
+		for start := 0; start < len(open); start += 1000 {
+			end := start + 1000
+			if end > len(open) {
+				end = len(open)
+			}
+
+			var finished []executionResult
+			err := database.DB.Model(&models.WorkflowExecution{}).
+				Select("id, status, started_at, completed_at").
+				Where("id IN ? AND status IN ?", open[start:end], []string{"completed", "failed"}).
+				Scan(&finished).Error
+			if err != nil {
+				log.Printf("failed to poll executions: %v", err)
+				continue
+			}
+			for _, result := range finished {
+				delete(pending, result.ID)
+				results = append(results, result)
+			}
+		}
+
+		if len(pending) == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			log.Printf("timed out waiting for %d executions", len(pending))
+			for id := range pending {
+				results = append(results, executionResult{ID: id, Status: "timeout"})
+			}
+			break
+		}
+		if time.Since(lastLog) >= 5*time.Second {
+			log.Printf("%d of %d executions finished", len(results), len(ids))
+			lastLog = time.Now()
+		}
+		time.Sleep(opts.PollInterval)
+	}
+
+	return results
+}
+
+// cleanup deletes the generated workflows together with their nodes and connections
+func cleanup(workflows []models.Workflow) {
+	for _, workflow := range workflows {
+		database.DB.Where("workflow_id = ?", workflow.ID).Delete(&models.Connection{})
+		database.DB.Where("workflow_id = ?", workflow.ID).Delete(&models.Node{})
+		if err := database.DB.Delete(&models.Workflow{}, workflow.ID).Error; err != nil {
+			log.Printf("failed to delete workflow %d: %v", workflow.ID, err)
+		}
+	}
+}
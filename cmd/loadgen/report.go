@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+)
+
+// Report summarizes a load test run. Durations are in milliseconds.
+type Report struct {
+	Workflows     int     `json:"workflows"`
+	Width         int     `json:"width"`
+	Depth         int     `json:"depth"`
+	Nodes         int     `json:"nodes_per_workflow"`
+	Executions    int     `json:"executions"`
+	Completed     int     `json:"completed"`
+	Failed        int     `json:"failed"`
+	TimedOut      int     `json:"timed_out"`
+	NotStarted    int     `json:"not_started"`
+	DispatchMs    float64 `json:"dispatch_ms"`
+	DurationMs    float64 `json:"duration_ms"`
+	Throughput    float64 `json:"executions_per_second"`
+	NodeRate      float64 `json:"nodes_per_second"`
+	LatencyP50Ms  float64 `json:"latency_p50_ms"`
+	LatencyP90Ms  float64 `json:"latency_p90_ms"`
+	LatencyP95Ms  float64 `json:"latency_p95_ms"`
+	LatencyP99Ms  float64 `json:"latency_p99_ms"`
+	LatencyMaxMs  float64 `json:"latency_max_ms"`
+	LatencyMeanMs float64 `json:"latency_mean_ms"`
+}
+
+// newReport computes the report of a run from the outcomes of its executions. The latency of an
+// execution is the time from its start until it finished, including the time spent in the queue.
+func newReport(opts options, results []executionResult, notStarted int, dispatched, total time.Duration) *Report {
+	report := &Report{
+		Workflows:  opts.Workflows,
+		Width:      opts.Width,
+		Depth:      opts.Depth,
+		Nodes:      nodeCount(opts),
+		Executions: opts.Executions,
+		NotStarted: notStarted,
+		DispatchMs: milliseconds(dispatched),
+		DurationMs: milliseconds(total),
+	}
+
+	var latencies []float64
+	var sum float64
+	for _, result := range results {
+		switch result.Status {
+		case "completed":
+			report.Completed++
+		case "failed":
+			report.Failed++
+		default:
+			report.TimedOut++
+			continue
+		}
+		if result.CompletedAt != nil {
+			latency := milliseconds(result.CompletedAt.Sub(result.StartedAt))
+			latencies = append(latencies, latency)
+			sum += latency
+		}
+	}
+
+	if total > 0 {
+		report.Throughput = float64(report.Completed) / total.Seconds()
+		report.NodeRate = float64(report.Completed*report.Nodes) / total.Seconds()
+	}
+	if len(latencies) > 0 {
+		sort.Float64s(latencies)
+		report.LatencyP50Ms = percentile(latencies, 50)
+		report.LatencyP90Ms = percentile(latencies, 90)
+		report.LatencyP95Ms = percentile(latencies, 95)
+		report.LatencyP99Ms = percentile(latencies, 99)
+		report.LatencyMaxMs = latencies[len(latencies)-1]
+		report.LatencyMeanMs = sum / float64(len(latencies))
+	}
+
+	return report
+}
+
+// Print writes the report in a human readable form
+func (r *Report) Print(w io.Writer) {
+	fmt.Fprintf(w, "workflows:    %d (%d branches x %d steps, %d nodes each)\n", r.Workflows, r.Width, r.Depth, r.Nodes)
+	fmt.Fprintf(w, "executions:   %d completed, %d failed, %d timed out, %d not started\n", r.Completed, r.Failed, r.TimedOut, r.NotStarted)
+	fmt.Fprintf(w, "duration:     %.0f ms (dispatch %.0f ms)\n", r.DurationMs, r.DispatchMs)
+	fmt.Fprintf(w, "throughput:   %.2f executions/s, %.2f nodes/s\n", r.Throughput, r.NodeRate)
+	fmt.Fprintf(w, "latency (ms): p50 %.1f  p90 %.1f  p95 %.1f  p99 %.1f  max %.1f  mean %.1f\n",
+		r.LatencyP50Ms, r.LatencyP90Ms, r.LatencyP95Ms, r.LatencyP99Ms, r.LatencyMaxMs, r.LatencyMeanMs)
+}
+
+// Save writes the report as JSON, e.g. to serve as the baseline of later runs
+func (r *Report) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// loadReport reads a report written by Save
+func loadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// Compare returns the regressions of the report against a baseline beyond the tolerance, i.e.
+// lower throughput, higher latency percentiles or executions that failed or did not finish
+func (r *Report) Compare(baseline *Report, tolerance float64) []string {
+	var regressions []string
+
+	if baseline.Width != r.Width || baseline.Depth != r.Depth {
+		regressions = append(regressions, fmt.Sprintf("baseline was measured with %dx%d workflows, not %dx%d",
+			baseline.Width, baseline.Depth, r.Width, r.Depth))
+		return regressions
+	}
+
+	if baseline.Throughput > 0 && r.Throughput < baseline.Throughput*(1-tolerance) {
+		regressions = append(regressions, fmt.Sprintf("throughput %.2f executions/s is below the baseline of %.2f", r.Throughput, baseline.Throughput))
+	}
+
+	latencies := []struct {
+		name              string
+		current, baseline float64
+	}{
+		{"p50", r.LatencyP50Ms, baseline.LatencyP50Ms},
+		{"p95", r.LatencyP95Ms, baseline.LatencyP95Ms},
+		{"p99", r.LatencyP99Ms, baseline.LatencyP99Ms},
+	}
+	for _, latency := range latencies {
+		if latency.baseline > 0 && latency.current > latency.baseline*(1+tolerance) {
+			regressions = append(regressions, fmt.Sprintf("%s latency %.1f ms is above the baseline of %.1f ms", latency.name, latency.current, latency.baseline))
+		}
+	}
+
+	if failures := r.Failed + r.TimedOut + r.NotStarted; failures > baseline.Failed+baseline.TimedOut+baseline.NotStarted {
+		regressions = append(regressions, fmt.Sprintf("%d executions failed or did not finish", failures))
+	}
+
+	return regressions
+}
+
+// percentile returns the p-th percentile of sorted values using the nearest-rank method
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	if rank >= len(sorted) {
+		rank = len(sorted) - 1
+	}
+	return sorted[rank]
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
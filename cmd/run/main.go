@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/altipard/flowcraft/runner"
+)
+
+// Run executes a workflow bundle written by the compile command without the platform. The
+// input is a JSON object read from the -input file or stdin; the outputs of the nodes are
+// written to stdout.
+func main() {
+	bundlePath := flag.String("bundle", "bundle.json", "bundle written by the compile command")
+	inputPath := flag.String("input", "", "JSON file with the input of the workflow (default: stdin)")
+	flag.Parse()
+
+	data, err := os.ReadFile(*bundlePath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	bundle, err := runner.Load(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var source io.Reader = os.Stdin
+	if *inputPath != "" {
+		file, err := os.Open(*inputPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		source = file
+	}
+	input := map[string]interface{}{}
+	if err := json.NewDecoder(source).Decode(&input); err != nil && err != io.EOF {
+		log.Fatalf("Failed to parse input: %v", err)
+	}
+
+	result, err := runner.Run(context.Background(), bundle, input)
+	if err != nil {
+		log.Fatal(err)
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(result)
+}
@@ -1,13 +1,31 @@
 package main
 
 import (
+	"context"
 	"net/http"
 	"os"
 
 	_ "github.com/altipard/flowcraft/docs" // Import Swagger documentation files
+	"github.com/altipard/flowcraft/internal/archive"
+	"github.com/altipard/flowcraft/internal/artifacts"
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/blob"
+	"github.com/altipard/flowcraft/internal/cache"
+	"github.com/altipard/flowcraft/internal/credentials"
 	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/engine"
+	"github.com/altipard/flowcraft/internal/events"
+	"github.com/altipard/flowcraft/internal/graphcache"
 	"github.com/altipard/flowcraft/internal/handlers"
+	"github.com/altipard/flowcraft/internal/i18n"
+	"github.com/altipard/flowcraft/internal/maintenance"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/profiling"
 	"github.com/altipard/flowcraft/internal/queue"
+	"github.com/altipard/flowcraft/internal/rollout"
+	"github.com/altipard/flowcraft/internal/secrets"
+	"github.com/altipard/flowcraft/internal/slack"
+	"github.com/altipard/flowcraft/internal/webhook"
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
@@ -26,14 +44,86 @@ func main() {
 	// Initialize database connection
 	database.Initialize(os.Getenv("DATABASE_URL"))
 
+	// Partition execution data by month if enabled
+	partitionConfig := database.PartitionConfigFromEnv()
+	if err := database.PartitionExecutions(partitionConfig); err != nil {
+		panic(err)
+	}
+
+	// Serve read-heavy endpoints from replicas
+	if err := database.ConfigureReplicas(database.ReplicasFromEnv()); err != nil {
+		panic(err)
+	}
+
+	// Restrict the executor classes available on this installation
+	engine.ConfigureAllowedExecutors(os.Getenv("ALLOWED_EXECUTOR_CLASSES"))
+
+	// Configure authentication
+	auth.Configure(auth.ConfigFromEnv())
+	var oidcProvider *auth.OIDCProvider
+	if oidcConfig := auth.OIDCConfigFromEnv(); oidcConfig != nil {
+		oidcProvider = auth.NewOIDCProvider(*oidcConfig)
+	}
+	passwordProviders, err := auth.PasswordProvidersFromEnv()
+	if err != nil {
+		panic(err)
+	}
+
+	// Key the secrets of credentials are encrypted with
+	credentials.Configure(credentials.KeyFromEnv())
+	credentials.ConfigureOAuth2(credentials.OAuth2RedirectURLFromEnv())
+
+	// External secrets manager credentials and templates may resolve secrets from
+	if err := secrets.Configure(secrets.ConfigFromEnv()); err != nil {
+		panic(err)
+	}
+
+	// Store for binary payloads passed between nodes
+	blobStore, err := blob.NewStore(blob.ConfigFromEnv())
+	if err != nil {
+		panic(err)
+	}
+	blob.Configure(blobStore)
+
+	// Limits of webhook triggers and their recorded deliveries
+	webhook.Configure(webhook.ConfigFromEnv())
+
+	// Retention of the artifacts recorded for workers without database access
+	artifacts.Configure(artifacts.ConfigFromEnv())
+
+	// Compress large task messages and offload oversized ones to the blob store
+	queue.Configure(queue.ConfigFromEnv())
+
 	// Initialize queue client
-	queueClient, err := queue.NewQueueClient(os.Getenv("REDIS_URL"))
+	queueClient, err := queue.NewQueueClient(queue.RedisConfigFromEnv())
 	if err != nil {
 		panic(err)
 	}
 
+	// Announce events emitted via the API to the workers
+	events.Configure(queueClient)
+
+	// Hold back new executions while maintenance mode is enabled
+	maintenance.Configure(queueClient)
+	slack.Configure(queueClient)
+
+	// Require a change note when publishing workflow versions
+	rollout.ConfigureChangeNotes(rollout.ChangeNoteRequiredFromEnv())
+
+	// Cache for slow API responses, e.g. the stats overview
+	cache.Configure(cache.NewRedisStore(queueClient.RedisClient()))
+
+	// Archive of old executions, loaded from when they are accessed
+	archive.Configure(archive.ConfigFromEnv())
+
+	// Cache node types and workflow graphs, evicting them when another process changes them
+	graphcache.Configure(graphcache.ConfigFromEnv(), queueClient)
+	go graphcache.Listen(context.Background())
+
 	// Create Echo instance
 	e := echo.New()
+	// Localize error messages for the Accept-Language of the request
+	e.JSONSerializer = i18n.JSONSerializer{}
 
 	// Middleware
 	e.Use(middleware.Logger())
@@ -45,31 +135,132 @@ func main() {
 	e.GET("/swagger/*", echoSwagger.WrapHandler)
 
 	// Handlers
+	authHandler := handlers.NewAuthHandler(oidcProvider, passwordProviders)
+	userHandler := handlers.NewUserHandler()
 	workflowHandler := handlers.NewWorkflowHandler()
 	nodeHandler := handlers.NewNodeHandler()
+	nodeTypeHandler := handlers.NewNodeTypeHandler()
 	connectionHandler := handlers.NewConnectionHandler()
 	executionHandler := handlers.NewExecutionHandler(queueClient)
+	statsHandler := handlers.NewStatsHandler(queueClient)
+	approvalHandler := handlers.NewApprovalHandler(queueClient)
+	taskHandler := handlers.NewTaskHandler(queueClient)
+	sinkHandler := handlers.NewSinkHandler()
+	shareHandler := handlers.NewShareHandler()
+	badgeHandler := handlers.NewBadgeHandler()
+	nodeGroupHandler := handlers.NewNodeGroupHandler()
+	commentHandler := handlers.NewCommentHandler()
+	triageHandler := handlers.NewTriageHandler()
+	artifactHandler := handlers.NewArtifactHandler()
+	eventHandler := handlers.NewEventHandler()
+	schemaHandler := handlers.NewSchemaHandler()
+	stateHandler := handlers.NewStateHandler()
+	organizationHandler := handlers.NewOrganizationHandler()
+	credentialHandler := handlers.NewCredentialHandler()
+	blobHandler := handlers.NewBlobHandler()
+	triggerHandler := handlers.NewTriggerHandler(queueClient)
+	scheduleHandler := handlers.NewScheduleHandler()
+	queueHandler := handlers.NewQueueHandler(queueClient)
+	maintenanceHandler := handlers.NewMaintenanceHandler()
+	versionHandler := handlers.NewVersionHandler()
+	alertHandler := handlers.NewAlertHandler()
+	workerAPIHandler := handlers.NewWorkerAPIHandler()
 
 	// API routes
-	api := e.Group("/api")
+	api := e.Group("/api", auth.Middleware)
 	{
+		// Auth routes
+		authRoutes := api.Group("/auth")
+		authRoutes.GET("/providers", authHandler.Providers)
+		authRoutes.POST("/login", authHandler.Login)
+		authRoutes.GET("/oidc/login", authHandler.OIDCLogin)
+		authRoutes.GET("/oidc/callback", authHandler.OIDCCallback)
+		authRoutes.GET("/oauth2/callback", credentialHandler.OAuth2Callback)
+		authRoutes.POST("/refresh", authHandler.Refresh)
+		authRoutes.GET("/me", authHandler.Me, auth.RequireUser)
+		authRoutes.GET("/sessions", authHandler.Sessions, auth.RequireUser)
+		authRoutes.POST("/logout", authHandler.Logout, auth.RequireUser)
+		authRoutes.POST("/logout-all", authHandler.LogoutAll, auth.RequireUser)
+
+		// Internal routes for workers and other services
+		internal := api.Group("/internal", auth.RequireServiceToken)
+		internal.POST("/introspect", authHandler.Introspect)
+
+		// Worker API for workers without database access
+		internal.GET("/executions/:id", workerAPIHandler.GetExecution)
+		internal.PUT("/executions/:id", workerAPIHandler.UpdateExecution)
+		internal.POST("/executions/:id/complete", workerAPIHandler.CompleteExecution)
+		internal.GET("/executions/:id/cancel-requested", workerAPIHandler.GetCancelRequested)
+		internal.GET("/executions/:id/node-executions", workerAPIHandler.GetNodeExecutions)
+		internal.POST("/executions/:id/node-executions", workerAPIHandler.CreateNodeExecution)
+		internal.PUT("/executions/:id/node-executions/:node_execution_id", workerAPIHandler.UpdateNodeExecution)
+		internal.POST("/executions/:id/node-executions/:node_execution_id/profile", workerAPIHandler.CreateNodeProfile)
+		internal.POST("/executions/:id/node-executions/:node_execution_id/artifacts", workerAPIHandler.CreateArtifact)
+		internal.GET("/node-types/:key", workerAPIHandler.GetNodeType)
+
+		// User routes
+		users := api.Group("/users", auth.RequireRole(models.RoleAdmin))
+		users.GET("", userHandler.GetAll)
+		users.POST("", userHandler.Create)
+		users.PUT("/:id", userHandler.Update)
+		users.DELETE("/:id", userHandler.Delete)
+		users.DELETE("/:id/sessions", userHandler.RevokeSessions)
+
 		// Workflow routes
 		workflows := api.Group("/workflows")
 		workflows.GET("", workflowHandler.GetAll)
 		workflows.GET("/:id", workflowHandler.GetByID)
 		workflows.POST("", workflowHandler.Create)
+		workflows.POST("/import", workflowHandler.Import)
 		workflows.PUT("/:id", workflowHandler.Update)
 		workflows.DELETE("/:id", workflowHandler.Delete)
 		workflows.POST("/:id/execute", executionHandler.ExecuteWorkflow) // <-- Important: Execution route
+		workflows.POST("/:id/execute-batch", executionHandler.ExecuteBatch)
+		workflows.POST("/:id/execute-stream", executionHandler.ExecuteStream)
+		workflows.POST("/:id/profile", executionHandler.ProfileWorkflow, auth.RequireRole(models.RoleAdmin))
+		workflows.GET("/:id/sinks", sinkHandler.GetByWorkflowID)
+		workflows.POST("/:id/sinks", sinkHandler.Create)
+		workflows.GET("/:id/groups", nodeGroupHandler.GetByWorkflowID)
+		workflows.GET("/:id/comments", commentHandler.GetByWorkflowID)
+		workflows.POST("/:id/comments", commentHandler.Create)
+		workflows.POST("/:id/groups", nodeGroupHandler.Create)
+		workflows.GET("/:id/triggers", triggerHandler.GetByWorkflowID)
+		workflows.POST("/:id/triggers", triggerHandler.Create)
+		workflows.POST("/:id/schedule", scheduleHandler.Schedule)
+		workflows.GET("/:id/scheduled-runs", scheduleHandler.GetByWorkflowID)
+		workflows.GET("/:id/dependencies", workflowHandler.GetDependencies)
+		workflows.GET("/:id/bpmn", workflowHandler.ExportBPMN)
+		workflows.GET("/:id/observed-schemas", workflowHandler.GetObservedSchemas)
+		workflows.GET("/:id/sla-breaches", workflowHandler.GetSLABreaches)
+		workflows.GET("/:id/status-badge", badgeHandler.GetBadge)
+		workflows.POST("/:id/status-badge", badgeHandler.CreateBadge, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+		workflows.DELETE("/:id/status-badge", badgeHandler.DeleteBadge, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+		workflows.POST("/:id/layout", workflowHandler.Layout)
+		workflows.POST("/:id/nodes/:nodeId/evaluate", workflowHandler.EvaluateExpression)
+		workflows.GET("/:id/versions", versionHandler.GetVersions)
+		workflows.POST("/:id/versions", versionHandler.Publish, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+		workflows.PUT("/:id/rollout", versionHandler.SetRollout, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+		workflows.GET("/:id/rollout/stats", versionHandler.GetRolloutStats)
 
 		// Node routes
 		nodes := api.Group("/nodes")
 		nodes.GET("", nodeHandler.GetAll)
 		nodes.GET("/:id", nodeHandler.GetByID)
+		nodes.GET("/:id/observed-schema", nodeHandler.GetObservedSchema)
 		nodes.POST("", nodeHandler.Create)
 		nodes.PUT("/:id", nodeHandler.Update)
 		nodes.DELETE("/:id", nodeHandler.Delete)
 
+		// Node type routes, declarative node types are managed by admins
+		nodeTypes := api.Group("/node-types")
+		nodeTypes.GET("", nodeTypeHandler.GetAll)
+		nodeTypes.GET("/:id", nodeTypeHandler.GetByID)
+		nodeTypes.POST("", nodeTypeHandler.Create, auth.RequireRole(models.RoleAdmin))
+		nodeTypes.POST("/import", nodeTypeHandler.ImportOpenAPI, auth.RequireRole(models.RoleAdmin))
+		nodeTypes.PUT("/:id", nodeTypeHandler.Update, auth.RequireRole(models.RoleAdmin))
+		nodeTypes.PUT("/:id/cost-model", nodeTypeHandler.SetCostModel, auth.RequireRole(models.RoleAdmin))
+		nodeTypes.DELETE("/:id", nodeTypeHandler.Delete, auth.RequireRole(models.RoleAdmin))
+
 		// Connection routes
 		connections := api.Group("/connections")
 		connections.GET("", connectionHandler.GetAll)
@@ -80,9 +271,192 @@ func main() {
 
 		// Execution routes
 		executions := api.Group("/executions")
+		executions.GET("", executionHandler.GetAll)
+		executions.GET("/:id", executionHandler.GetByID)
 		executions.GET("/:id/status", executionHandler.GetStatus)
+		executions.POST("/:id/restart", executionHandler.Restart)
+		executions.POST("/:id/cancel", executionHandler.Cancel)
+		executions.GET("/:id/chains", executionHandler.GetChains)
+		executions.GET("/:id/profile", executionHandler.GetProfile)
+		executions.GET("/:id/lineage", executionHandler.GetLineage)
+		executions.PUT("/:id/triage", triageHandler.Triage)
+		executions.GET("/:id/notes", triageHandler.GetNotes)
+		executions.POST("/:id/notes", triageHandler.CreateNote)
+		executions.PUT("/:id/notes/:note_id", triageHandler.UpdateNote)
+		executions.DELETE("/:id/notes/:note_id", triageHandler.DeleteNote)
+		executions.GET("/:id/artifacts", artifactHandler.GetAll)
+		executions.GET("/:id/artifacts/:artifact_id", artifactHandler.Download)
+		executions.GET("/:id/deliveries", sinkHandler.GetDeliveries)
+		executions.GET("/:id/shares", shareHandler.GetAll)
+		executions.POST("/:id/shares", shareHandler.Create, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+		executions.DELETE("/:id/shares/:share_id", shareHandler.Revoke, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+
+		// Queue management for admins
+		queues := api.Group("/admin/queues", auth.RequireRole(models.RoleAdmin))
+		queues.GET("/:name", queueHandler.Get)
+		queues.GET("/:name/tasks", queueHandler.Peek)
+		queues.DELETE("/:name/tasks/:task_id", queueHandler.DeleteTask)
+		queues.POST("/:name/tasks/:task_id/requeue", queueHandler.RequeueTask)
+		queues.POST("/:name/pause", queueHandler.Pause)
+		queues.POST("/:name/resume", queueHandler.Resume)
+		queues.POST("/:name/drain", queueHandler.Drain)
+		api.GET("/admin/leaders", queueHandler.Leaders, auth.RequireRole(models.RoleAdmin))
+
+		// Exports of execution records to data warehouses for admins
+		warehouseExports := api.Group("/admin/warehouse-exports", auth.RequireRole(models.RoleAdmin))
+		warehouseExports.GET("", sinkHandler.GetWarehouseExports)
+		warehouseExports.POST("", sinkHandler.CreateWarehouseExport)
+		warehouseExports.PUT("/:id", sinkHandler.UpdateWarehouseExport)
+		warehouseExports.DELETE("/:id", sinkHandler.DeleteWarehouseExport)
+		warehouseExports.POST("/:id/run", sinkHandler.RunWarehouseExport)
+
+		// Alert rules, managed by admins and editors
+		alertRules := api.Group("/alert-rules")
+		alertRules.GET("", alertHandler.GetRules)
+		alertRules.GET("/:id", alertHandler.GetRule)
+		alertRules.POST("", alertHandler.CreateRule, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+		alertRules.PUT("/:id", alertHandler.UpdateRule, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+		alertRules.DELETE("/:id", alertHandler.DeleteRule, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+		alertRules.POST("/:id/silence", alertHandler.Silence, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+		alertRules.DELETE("/:id/silence", alertHandler.Unsilence, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+		api.GET("/alerts", alertHandler.GetAlerts)
+
+		// Maintenance mode for admins
+		api.GET("/admin/maintenance", maintenanceHandler.Get, auth.RequireRole(models.RoleAdmin))
+		api.PUT("/admin/maintenance", maintenanceHandler.Set, auth.RequireRole(models.RoleAdmin))
+
+		// Runtime profiles of the server, only if enabled
+		if profiling.ConfigFromEnv().Enabled {
+			profiling.Register(api.Group("/debug/pprof", auth.RequireRole(models.RoleAdmin)))
+		}
+
+		// Comment routes
+		comments := api.Group("/comments")
+		comments.PUT("/:id", commentHandler.Update)
+		comments.DELETE("/:id", commentHandler.Delete)
+
+		// Node group routes
+		groups := api.Group("/groups")
+		groups.PUT("/:id", nodeGroupHandler.Update)
+		groups.DELETE("/:id", nodeGroupHandler.Delete)
+
+		// Output sink routes
+		sinks := api.Group("/sinks")
+		sinks.PUT("/:id", sinkHandler.Update)
+		sinks.DELETE("/:id", sinkHandler.Delete)
+		api.POST("/deliveries/:id/retry", sinkHandler.RetryDelivery)
+
+		// Trigger routes
+		triggers := api.Group("/triggers")
+		triggers.GET("/:id", triggerHandler.GetByID)
+		triggers.PUT("/:id", triggerHandler.Update)
+		triggers.DELETE("/:id", triggerHandler.Delete)
+		triggers.GET("/:id/deliveries", triggerHandler.GetDeliveries)
+		api.GET("/webhook-deliveries/:id", triggerHandler.GetDelivery)
+		api.POST("/webhook-deliveries/:id/replay", triggerHandler.ReplayDelivery, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+
+		// Scheduled run routes
+		api.GET("/scheduled-runs/:id", scheduleHandler.GetByID)
+		api.POST("/scheduled-runs/:id/cancel", scheduleHandler.Cancel)
+		api.GET("/calendar.ics", scheduleHandler.GetCalendar)
+		api.POST("/calendar/token", scheduleHandler.CreateCalendarToken, auth.RequireUser)
+		api.DELETE("/calendar/token", scheduleHandler.RevokeCalendarToken, auth.RequireUser)
+
+		// Batch routes
+		api.GET("/batches/:id", executionHandler.GetBatchStatus)
+
+		// Event routes
+		api.GET("/events", eventHandler.GetAll)
+		api.POST("/events", eventHandler.Emit)
+
+		// Payload schema registry, versions are registered by admins and editors
+		schemaRoutes := api.Group("/schemas")
+		schemaRoutes.GET("", schemaHandler.GetAll)
+		schemaRoutes.POST("", schemaHandler.Register, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+		schemaRoutes.GET("/:name/versions", schemaHandler.GetVersions)
+		schemaRoutes.GET("/:name/versions/:version", schemaHandler.GetVersion)
+		schemaRoutes.GET("/:name/usage", schemaHandler.GetUsage)
+
+		// State store routes
+		stateStore := api.Group("/state")
+		stateStore.GET("/:scope/:key", stateHandler.Get)
+		stateStore.PUT("/:scope/:key", stateHandler.Set)
+		stateStore.POST("/:scope/:key/incr", stateHandler.Incr)
+		stateStore.DELETE("/:scope/:key", stateHandler.Delete)
+
+		// Approval routes
+		approvals := api.Group("/approvals")
+		approvals.GET("", approvalHandler.GetAll)
+		approvals.GET("/:id", approvalHandler.GetByID)
+		approvals.POST("/:id/decide", approvalHandler.Decide, auth.RequireUser)
+
+		// Human task inbox routes
+		tasks := api.Group("/tasks", auth.RequireUser)
+		tasks.GET("", taskHandler.Inbox)
+		tasks.GET("/:id", taskHandler.GetByID)
+		tasks.POST("/:id/claim", taskHandler.Claim)
+		tasks.POST("/:id/unclaim", taskHandler.Unclaim)
+		tasks.POST("/:id/complete", taskHandler.Complete)
+
+		// Credential routes
+		credentialRoutes := api.Group("/credentials")
+		credentialRoutes.GET("", credentialHandler.GetAll)
+		credentialRoutes.GET("/:id", credentialHandler.GetByID)
+		credentialRoutes.POST("", credentialHandler.Create, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+		credentialRoutes.PUT("/:id", credentialHandler.Update, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+		credentialRoutes.DELETE("/:id", credentialHandler.Delete, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+		credentialRoutes.GET("/:id/usages", credentialHandler.GetUsages)
+		credentialRoutes.POST("/:id/test", credentialHandler.Test)
+		credentialRoutes.GET("/:id/oauth2/authorize", credentialHandler.OAuth2Authorize, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+		credentialRoutes.POST("/:id/rotate", credentialHandler.Rotate, auth.RequireRole(models.RoleAdmin, models.RoleEditor))
+
+		// Binary payload routes
+		api.POST("/blobs", blobHandler.Upload)
+		api.GET("/blobs/:id", blobHandler.Download)
+
+		// Organization routes
+		organizations := api.Group("/organizations")
+		organizations.GET("", organizationHandler.GetAll)
+		organizations.GET("/:id", organizationHandler.GetByID)
+		organizations.POST("", organizationHandler.Create, auth.RequireRole(models.RoleAdmin))
+		organizations.PUT("/:id", organizationHandler.Update, auth.RequireRole(models.RoleAdmin))
+		organizations.DELETE("/:id", organizationHandler.Delete, auth.RequireRole(models.RoleAdmin))
+		organizations.GET("/:id/usage", organizationHandler.GetUsage)
+		organizations.GET("/:id/holidays", organizationHandler.GetHolidays)
+		organizations.PUT("/:id/holidays", organizationHandler.SetHolidays, auth.RequireRole(models.RoleAdmin))
+
+		// Stats routes
+		stats := api.Group("/stats")
+		stats.GET("/nodes", statsHandler.NodeUsage)
+		stats.GET("/overview", statsHandler.Overview)
+		stats.GET("/workers", statsHandler.Workers)
+		stats.GET("/queue-wait", statsHandler.QueueWait)
+		stats.GET("/anomalies", statsHandler.Anomalies)
+		stats.GET("/failures", statsHandler.Failures)
+		stats.GET("/costs", statsHandler.Costs)
+		stats.GET("/capacity-plan", statsHandler.CapacityPlan)
 	}
 
+	// Webhook triggers are called by external systems and authenticated by their unguessable path
+	e.Any("/webhooks/:path", triggerHandler.ReceiveWebhook)
+
+	// Forms of form triggers are filled in by anyone with their link, like webhooks by their unguessable path
+	e.GET("/forms/:path", triggerHandler.GetForm)
+	e.POST("/forms/:path", triggerHandler.SubmitForm)
+
+	// Slack requests are authenticated by their signature with the signing secret of the Slack app
+	e.POST("/slack/:path", triggerHandler.ReceiveSlack)
+
+	// Share links of executions are opened without an account and authenticated by their signature
+	e.GET("/shared/executions/:token", shareHandler.GetShared)
+
+	// Status badges of workflows are embedded in wikis and READMEs and authenticated by their token
+	e.GET("/status/:token", badgeHandler.GetStatus)
+	e.GET("/status/:token/badge.svg", badgeHandler.GetBadgeSVG)
+
+	// Calendar apps fetch the feed of scheduled runs with the token of the user's feed link
+	e.GET("/calendar/:token", scheduleHandler.GetCalendarFeed)
+
 	e.GET("/", func(c echo.Context) error {
 		return c.String(http.StatusOK, "FlowCraft API Server is running!")
 	})
@@ -1,18 +1,48 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/altipard/flowcraft/internal/alerting"
+	"github.com/altipard/flowcraft/internal/anomaly"
+	"github.com/altipard/flowcraft/internal/archive"
+	"github.com/altipard/flowcraft/internal/artifacts"
+	"github.com/altipard/flowcraft/internal/blob"
+	"github.com/altipard/flowcraft/internal/breaker"
+	"github.com/altipard/flowcraft/internal/brokers"
+	"github.com/altipard/flowcraft/internal/cache"
+	"github.com/altipard/flowcraft/internal/chain"
+	"github.com/altipard/flowcraft/internal/credentials"
 	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/dispatch"
 	"github.com/altipard/flowcraft/internal/engine"
+	"github.com/altipard/flowcraft/internal/events"
+	"github.com/altipard/flowcraft/internal/graphcache"
+	"github.com/altipard/flowcraft/internal/inference"
+	"github.com/altipard/flowcraft/internal/lineage"
+	"github.com/altipard/flowcraft/internal/maintenance"
+	"github.com/altipard/flowcraft/internal/notify"
+	"github.com/altipard/flowcraft/internal/profiling"
 	"github.com/altipard/flowcraft/internal/queue"
+	"github.com/altipard/flowcraft/internal/quota"
+	"github.com/altipard/flowcraft/internal/schedule"
+	"github.com/altipard/flowcraft/internal/secrets"
+	"github.com/altipard/flowcraft/internal/sink"
+	"github.com/altipard/flowcraft/internal/sla"
+	"github.com/altipard/flowcraft/internal/slack"
+	"github.com/altipard/flowcraft/internal/state"
+	"github.com/altipard/flowcraft/internal/webhook"
+	"github.com/altipard/flowcraft/internal/workerapi"
 	"github.com/joho/godotenv"
 )
 
@@ -21,12 +51,24 @@ type WorkflowExecutionPayload struct {
 	ExecutionID uint `json:"execution_id"`
 }
 
+// ResumeExecutionPayload is the payload for tasks resuming a waiting node
+type ResumeExecutionPayload struct {
+	ExecutionID uint            `json:"execution_id"`
+	NodeID      uint            `json:"node_id"`
+	Handle      string          `json:"handle"`
+	Output      json.RawMessage `json:"output"`
+}
+
 func main() {
 	// Parse command line flags
 	numWorkers := flag.Int("workers", 1, "Number of parallel worker goroutines")
 	queueName := flag.String("queue", "workflow_tasks", "Name of the Redis queue to process")
 	pollInterval := flag.Duration("poll-interval", 5*time.Second, "How often to poll the queue if empty")
 	executionTimeout := flag.Duration("execution-timeout", 30*time.Minute, "Maximum execution time for a workflow")
+	lockTTL := flag.Duration("lock-ttl", 30*time.Second, "Expiry of the execution lock if a worker stops renewing it")
+	eventTimeoutInterval := flag.Duration("event-timeout-interval", 30*time.Second, "How often to check for waitForEvent nodes whose timeout passed")
+	leaderTTL := flag.Duration("leader-ttl", 15*time.Second, "Time after which another worker takes over the singleton background jobs of a crashed one")
+	pprofAddr := flag.String("pprof-addr", "", "Address to serve the pprof endpoints on, e.g. localhost:6060 (disabled if empty)")
 	flag.Parse()
 
 	log.Printf("Starting worker with configuration: workers=%d, queue=%s, poll-interval=%s, execution-timeout=%s\n", 
@@ -35,15 +77,126 @@ func main() {
 	// Load environment variables
 	godotenv.Load()
 
-	// Initialize database connection
-	database.Initialize(os.Getenv("DATABASE_URL"))
+	// Serve the runtime profiles of the worker if enabled
+	if *pprofAddr != "" {
+		go func() {
+			log.Printf("Serving pprof endpoints on %s\n", *pprofAddr)
+			if err := http.ListenAndServe(*pprofAddr, profiling.Handler()); err != nil {
+				log.Printf("Failed to serve pprof endpoints: %v\n", err)
+			}
+		}()
+	}
+
+	// Workers without database access load executions and report results through the worker API
+	// of the server, which validates and stores them
+	workerAPIConfig := workerapi.ConfigFromEnv()
+	partitionConfig := database.PartitionConfigFromEnv()
+	if workerAPIConfig.Enabled() {
+		client, err := workerapi.NewClient(workerAPIConfig)
+		if err != nil {
+			log.Fatalf("Failed to configure worker API: %v", err)
+		}
+		engine.ConfigureStore(client)
+		log.Printf("Using the worker API of %s instead of the database\n", workerAPIConfig.URL)
+	} else {
+		// Initialize database connection and wait for the server to migrate the schema, instead of
+		// migrating it concurrently or failing on missing tables
+		startupTimeout := database.StartupTimeoutFromEnv()
+		if err := database.Connect(os.Getenv("DATABASE_URL"), startupTimeout); err != nil {
+			log.Fatalf("Failed to connect to database: %v", err)
+		}
+		if err := database.WaitForSchema(startupTimeout); err != nil {
+			log.Fatalf("Database schema not ready: %v", err)
+		}
+
+		// Partition execution data by month if enabled
+		if err := database.PartitionExecutions(partitionConfig); err != nil {
+			log.Fatalf("Failed to partition execution data: %v", err)
+		}
+	}
+
+	// Restrict the executor classes available on this installation
+	engine.ConfigureAllowedExecutors(os.Getenv("ALLOWED_EXECUTOR_CLASSES"))
+
+	// Inject faults into node executions on test installations
+	engine.ConfigureChaos(engine.ChaosConfigFromEnv())
+
+	// Retry nodes failing with transient errors, e.g. network errors and rate limits
+	engine.ConfigureRetries(engine.RetryConfigFromEnv())
+
+	// Record where the output fields of nodes came from, which needs the database
+	lineage.Configure(lineage.EnabledFromEnv() && !workerAPIConfig.Enabled())
+
+	// Hooks of plugins around the executors of all nodes
+	if err := engine.LoadMiddlewarePlugins(engine.MiddlewarePluginsFromEnv()); err != nil {
+		log.Fatalf("Failed to load executor middleware: %v", err)
+	}
+
+	// Executor plugins of the plugins directory, reloaded when they change
+	engine.ConfigurePlugins(engine.PluginConfigFromEnv())
 
 	// Initialize queue client
-	queueClient, err := queue.NewQueueClient(os.Getenv("REDIS_URL"))
+	queueClient, err := queue.NewQueueClient(queue.RedisConfigFromEnv())
 	if err != nil {
 		log.Fatalf("Failed to connect to Redis: %v", err)
 	}
 
+	// Key the secrets of credentials used by executors are encrypted with
+	credentials.Configure(credentials.KeyFromEnv())
+
+	// External secrets manager credentials and templates may resolve secrets from
+	if err := secrets.Configure(secrets.ConfigFromEnv()); err != nil {
+		log.Fatalf("Failed to configure secrets manager: %v", err)
+	}
+
+	// Store for binary payloads passed between nodes
+	blobStore, err := blob.NewStore(blob.ConfigFromEnv())
+	if err != nil {
+		log.Fatalf("Failed to configure blob store: %v", err)
+	}
+	blob.Configure(blobStore)
+
+	// Compress large task messages and offload oversized ones to the blob store
+	queue.Configure(queue.ConfigFromEnv())
+
+	// Truncate large node inputs and outputs and offload them to the blob store
+	engine.ConfigurePayloads(engine.PayloadConfigFromEnv())
+
+	// Retention of the artifacts kept by nodes
+	artifacts.Configure(artifacts.ConfigFromEnv())
+
+	// Configure notification sinks used by executors
+	notify.Configure(notify.FromEnv())
+
+	// Fail requests to unhealthy downstream services fast
+	breaker.Configure(breaker.ConfigFromEnv())
+
+	// Cache used by HTTP request and cache nodes, sharing the connections of the queue
+	cache.Configure(cache.NewRedisStore(queueClient.RedisClient()))
+
+	// Announce events and resume the executions waiting for them through Redis
+	events.Configure(queueClient)
+	backgroundCtx, stopBackground := context.WithCancel(context.Background())
+
+	// Stop taking tasks while maintenance mode is enabled
+	maintenance.Configure(queueClient)
+	slack.Configure(queueClient)
+
+	// Cache node types and workflow graphs, evicting them when the API changes them
+	graphcache.Configure(graphcache.ConfigFromEnv(), queueClient)
+	go graphcache.Listen(backgroundCtx)
+
+	// Start the workflows chained to completed executions
+	chain.Configure(queueClient)
+
+	// The jobs of the installation run on the workers with database access
+	if !workerAPIConfig.Enabled() {
+		runDatabaseJobs(backgroundCtx, queueClient, partitionConfig, *eventTimeoutInterval, *leaderTTL)
+	}
+
+	// Load new and updated executor plugins without restarting the worker
+	go engine.WatchPlugins(backgroundCtx)
+
 	// Initialize workflow engine
 	workflowEngine := engine.NewEngine()
 
@@ -51,6 +204,12 @@ func main() {
 	stopCh := make(chan os.Signal, 1)
 	signal.Notify(stopCh, os.Interrupt, syscall.SIGTERM)
 
+	// Report when the workers are busy for the worker utilization in the stats
+	tracker := queueClient.NewWorkerTracker(*numWorkers)
+	tracker.ReportPlugins(engine.PluginStatuses)
+	tracker.ReportPanics(engine.PanicCounts)
+	go tracker.Run(backgroundCtx, 10*time.Second)
+
 	// Use a WaitGroup to manage worker goroutines
 	var wg sync.WaitGroup
 	
@@ -62,12 +221,29 @@ func main() {
 			log.Printf("Worker %d started", workerID)
 			
 			// Create a context with timeout for each workflow execution
+			idle := false
 			for {
 				select {
 				case <-stopCh:
 					log.Printf("Worker %d received shutdown signal", workerID)
 					return
 				default:
+					tracker.Idle(workerID)
+
+					// Finish the current task and idle during maintenance
+					if maintenance.Enabled() {
+						if !idle {
+							log.Printf("Worker %d: Maintenance mode enabled, not taking new tasks", workerID)
+							idle = true
+						}
+						time.Sleep(*pollInterval)
+						continue
+					}
+					if idle {
+						log.Printf("Worker %d: Maintenance mode ended, taking tasks again", workerID)
+						idle = false
+					}
+
 					// Dequeue task from the queue
 					task, err := queueClient.DequeueTask(*queueName, *pollInterval)
 					if err != nil {
@@ -81,6 +257,7 @@ func main() {
 					}
 
 					log.Printf("Worker %d: Processing task: %s", workerID, task.TaskType)
+					tracker.Busy(workerID, task.TaskType)
 
 					// Check task type and process accordingly
 					switch task.TaskType {
@@ -91,10 +268,28 @@ func main() {
 							continue
 						}
 
+						// Only one worker may process an execution at a time, duplicates are dropped. If the
+						// lock can't be checked, e.g. while Redis is unavailable, the task is retried.
+						lock, err := queueClient.AcquireLock(queue.ExecutionLockKey(payload.ExecutionID), *lockTTL)
+						if errors.Is(err, queue.ErrLockHeld) {
+							log.Printf("Worker %d: Skipping workflow %d: %v", workerID, payload.ExecutionID, err)
+							continue
+						} else if err != nil {
+							log.Printf("Worker %d: Error acquiring lock for workflow %d, retrying: %v", workerID, payload.ExecutionID, err)
+							time.Sleep(time.Second)
+							if err := queueClient.RequeueTask(*queueName, task); err != nil {
+								log.Printf("Worker %d: Error requeuing task: %v", workerID, err)
+							}
+							continue
+						}
+						lock.KeepAlive()
+
 						// Execute workflow with timeout
 						executionDone := make(chan struct{})
 						go func() {
 							defer close(executionDone)
+							// The lock is held until the execution really ends, even after a timeout
+							defer lock.Release()
 							if err := workflowEngine.ExecuteWorkflow(payload.ExecutionID); err != nil {
 								log.Printf("Worker %d: Error executing workflow %d: %v", workerID, payload.ExecutionID, err)
 							}
@@ -109,6 +304,44 @@ func main() {
 							// TODO: Update workflow execution status to failed due to timeout
 						}
 
+					case "resume_execution":
+						var payload ResumeExecutionPayload
+						if err := json.Unmarshal(task.Payload, &payload); err != nil {
+							log.Printf("Worker %d: Error unmarshalling payload: %v", workerID, err)
+							continue
+						}
+
+						var output interface{}
+						if len(payload.Output) > 0 {
+							if err := json.Unmarshal(payload.Output, &output); err != nil {
+								log.Printf("Worker %d: Error unmarshalling resume output: %v", workerID, err)
+								continue
+							}
+						}
+
+						// Resume once the worker currently processing the execution is done. If the lock
+						// can't be checked, e.g. while Redis is unavailable, the task is retried as well.
+						lock, err := queueClient.AcquireLock(queue.ExecutionLockKey(payload.ExecutionID), *lockTTL)
+						if err != nil {
+							if !errors.Is(err, queue.ErrLockHeld) {
+								log.Printf("Worker %d: Error acquiring lock for workflow %d, retrying: %v", workerID, payload.ExecutionID, err)
+							}
+							time.Sleep(time.Second)
+							if err := queueClient.RequeueTask(*queueName, task); err != nil {
+								log.Printf("Worker %d: Error requeuing task: %v", workerID, err)
+							}
+							continue
+						}
+						lock.KeepAlive()
+
+						err = workflowEngine.ResumeNode(payload.ExecutionID, payload.NodeID, payload.Handle, output)
+						lock.Release()
+						if err != nil {
+							log.Printf("Worker %d: Error resuming workflow %d at node %d: %v", workerID, payload.ExecutionID, payload.NodeID, err)
+						} else {
+							log.Printf("Worker %d: Workflow %d resumed at node %d", workerID, payload.ExecutionID, payload.NodeID)
+						}
+
 					default:
 						log.Printf("Worker %d: Unknown task type: %s", workerID, task.TaskType)
 					}
@@ -120,6 +353,7 @@ func main() {
 	// Wait for shutdown signal
 	<-stopCh
 	log.Println("Shutting down workers gracefully...")
+	stopBackground()
 	
 	// Use a separate channel to signal forced shutdown after timeout
 	forceShutdown := make(chan struct{})
@@ -136,3 +370,66 @@ func main() {
 		log.Println("Forcing shutdown after timeout")
 	}
 }
+
+// runDatabaseJobs starts the background jobs working on the database. Except for the event
+// listener, each job runs in only one worker at a time, the leader elected for it.
+func runDatabaseJobs(backgroundCtx context.Context, queueClient *queue.QueueClient, partitionConfig database.PartitionConfig, eventTimeoutInterval, leaderTTL time.Duration) {
+	singleton := func(job string, run func(ctx context.Context)) {
+		go queueClient.RunAsLeader(backgroundCtx, job, leaderTTL, run)
+	}
+
+	// Resume executions waiting for events and time out the ones waiting too long
+	go events.Listen(backgroundCtx)
+	singleton("event-timeouts", func(ctx context.Context) { events.ExpireSubscriptions(ctx, eventTimeoutInterval) })
+
+	// Remove expired values of the state store
+	singleton("state-retention", func(ctx context.Context) { state.PurgeExpired(ctx, time.Hour) })
+
+	// Remove webhook deliveries older than the retention period
+	webhook.Configure(webhook.ConfigFromEnv())
+	singleton("webhook-retention", func(ctx context.Context) { webhook.PurgeExpired(ctx, time.Hour) })
+
+	// Remove expired artifacts and their blobs
+	singleton("artifact-retention", func(ctx context.Context) { artifacts.PurgeExpired(ctx, time.Hour) })
+
+	// Start the executions held back by the concurrency, debounce and throttle settings of triggers
+	// and the automatic retries of failed executions
+	singleton("dispatch-release", func(ctx context.Context) {
+		dispatch.NewDispatcher(queueClient).ReleaseQueued(ctx, time.Second)
+	})
+
+	// Measure the execution data stored for the storage quotas of organizations
+	singleton("storage-usage", func(ctx context.Context) { quota.MeasureStorage(ctx, 10*time.Minute) })
+
+	// Create upcoming partitions of execution data and drop the ones past the retention period
+	singleton("partitions", func(ctx context.Context) { database.MaintainPartitions(ctx, partitionConfig, time.Hour) })
+
+	// Start the executions of schedule triggers and one-off scheduled runs
+	singleton("scheduler", func(ctx context.Context) {
+		schedule.Run(ctx, dispatch.NewDispatcher(queueClient), 15*time.Second)
+	})
+
+	// Subscribe to the topics and queues of message broker triggers
+	singleton("brokers", func(ctx context.Context) {
+		brokers.Run(ctx, dispatch.NewDispatcher(queueClient), 30*time.Second)
+	})
+
+	// Stream the records of completed executions to the configured data warehouses
+	singleton("warehouse-export", func(ctx context.Context) { sink.ExportWarehouses(ctx, time.Minute) })
+
+	// Record the SLA breaches of workflows and escalate them
+	singleton("sla", func(ctx context.Context) { sla.Run(ctx, dispatch.NewDispatcher(queueClient), time.Minute) })
+
+	// Alert operators about failing and slow workflows
+	singleton("alerting", func(ctx context.Context) { alerting.Run(ctx, alerting.ConfigFromEnv()) })
+
+	// Learn the typical durations of workflows and nodes and score how unusual executions are
+	singleton("anomaly", func(ctx context.Context) { anomaly.Run(ctx, anomaly.ConfigFromEnv()) })
+
+	// Infer the schemas of node outputs from recent executions for the editor
+	singleton("inference", func(ctx context.Context) { inference.Run(ctx, inference.ConfigFromEnv()) })
+
+	// Move old executions to the archive, leaving stub rows
+	archive.Configure(archive.ConfigFromEnv())
+	singleton("archive", archive.Run)
+}
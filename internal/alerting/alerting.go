@@ -0,0 +1,464 @@
+// Package alerting evaluates alert rules against recent executions and notifies operators by
+// email, Slack or webhook when workflows start failing, and again when they recover
+package alerting
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/notify"
+)
+
+// Bounds of the window of alert rules
+const (
+	minWindow = time.Minute
+	maxWindow = 31 * 24 * time.Hour
+)
+
+// Config holds the settings of alert evaluation
+type Config struct {
+	// Interval between evaluations of each rule, 0 disables alerting
+	Interval time.Duration
+}
+
+// ConfigFromEnv reads the alerting settings from the environment
+func ConfigFromEnv() Config {
+	cfg := Config{Interval: time.Minute}
+
+	if interval, err := time.ParseDuration(os.Getenv("ALERT_EVALUATION_INTERVAL")); err == nil && interval >= 0 {
+		cfg.Interval = interval
+	}
+
+	return cfg
+}
+
+// Validate checks an alert rule and fills in the default window and minimum executions
+func Validate(rule *models.AlertRule) error {
+	if rule.Name == "" {
+		return errors.New("name is required")
+	}
+
+	switch rule.Condition {
+	case models.AlertFailureRate:
+		if rule.Threshold <= 0 || rule.Threshold > 100 {
+			return errors.New("threshold of a failure rate must be a percentage above 0")
+		}
+		if rule.MinExecutions <= 0 {
+			rule.MinExecutions = 5
+		}
+	case models.AlertConsecutiveFailures:
+		if rule.Threshold < 1 {
+			return errors.New("threshold of consecutive failures must be at least 1")
+		}
+	case models.AlertDuration:
+		if rule.Threshold <= 0 {
+			return errors.New("threshold of a duration must be a positive number of seconds")
+		}
+	default:
+		return fmt.Errorf("condition must be %s, %s or %s", models.AlertFailureRate, models.AlertConsecutiveFailures, models.AlertDuration)
+	}
+
+	if rule.Window == "" {
+		// Consecutive failures look further back, workflows may run only a few times a day
+		rule.Window = "1h"
+		if rule.Condition == models.AlertConsecutiveFailures {
+			rule.Window = "24h"
+		}
+	}
+	window, err := time.ParseDuration(rule.Window)
+	if err != nil {
+		return fmt.Errorf("invalid window: %v", err)
+	}
+	if window < minWindow || window > maxWindow {
+		return fmt.Errorf("window must be between %s and %s", minWindow, maxWindow)
+	}
+
+	switch rule.Scope {
+	case models.AlertScopeWorkflow:
+		if rule.WorkflowID == nil {
+			return errors.New("workflow_id is required for the workflow scope")
+		}
+		rule.Tag = ""
+	case models.AlertScopeTag:
+		rule.Tag = strings.TrimSpace(rule.Tag)
+		if rule.Tag == "" {
+			return errors.New("tag is required for the tag scope")
+		}
+		rule.WorkflowID = nil
+	case models.AlertScopeGlobal:
+		rule.WorkflowID, rule.Tag = nil, ""
+	default:
+		return fmt.Errorf("scope must be %s, %s or %s", models.AlertScopeWorkflow, models.AlertScopeTag, models.AlertScopeGlobal)
+	}
+
+	return ValidateChannel(rule.Channel, rule.Target)
+}
+
+// ValidateChannel checks an alert channel and its target
+func ValidateChannel(channel, target string) error {
+	switch channel {
+	case models.AlertChannelEmail:
+		if len(recipients(target)) == 0 {
+			return errors.New("target must list the email addresses to alert")
+		}
+	case models.AlertChannelSlack:
+		if target == "" && os.Getenv("SLACK_WEBHOOK_URL") == "" {
+			return errors.New("target must be a Slack webhook URL, SLACK_WEBHOOK_URL is not set")
+		}
+		if target != "" {
+			if err := validateURL(target); err != nil {
+				return err
+			}
+		}
+	case models.AlertChannelWebhook:
+		if err := validateURL(target); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("channel must be %s, %s or %s", models.AlertChannelEmail, models.AlertChannelSlack, models.AlertChannelWebhook)
+	}
+	return nil
+}
+
+func validateURL(target string) error {
+	u, err := url.Parse(target)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("target must be an http or https URL")
+	}
+	return nil
+}
+
+// Run evaluates the enabled alert rules at the configured interval until the context is done
+func Run(ctx context.Context, cfg Config) {
+	if cfg.Interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var rules []models.AlertRule
+		if err := database.DB.Where("disabled = ?", false).Find(&rules).Error; err != nil {
+			log.Printf("Failed to load alert rules: %v", err)
+			continue
+		}
+
+		for _, rule := range rules {
+			// Claim the evaluation, so each rule is evaluated by one worker per interval
+			now := time.Now()
+			due := now.Add(-cfg.Interval / 2)
+			result := database.DB.Model(&models.AlertRule{}).
+				Where("id = ? AND (last_evaluated_at IS NULL OR last_evaluated_at <= ?)", rule.ID, due).
+				Update("last_evaluated_at", now)
+			if result.Error != nil || result.RowsAffected == 0 {
+				continue
+			}
+
+			err := Evaluate(ctx, rule)
+			lastError := ""
+			if err != nil {
+				log.Printf("Failed to evaluate alert rule %d: %v", rule.ID, err)
+				lastError = err.Error()
+			}
+			database.DB.Model(&models.AlertRule{}).Where("id = ?", rule.ID).Update("last_error", lastError)
+		}
+	}
+}
+
+// measurement is the value of a rule's condition for one workflow
+type measurement struct {
+	WorkflowID uint
+	Name       string
+	Value      float64
+	Total      int64
+}
+
+// Evaluate measures the condition of a rule for the workflows in its scope and updates their
+// alerts. Alerts are notified when they start firing and when they resolve, unless the rule is
+// silenced; alerts still firing when a silence ends are notified then.
+func Evaluate(ctx context.Context, rule models.AlertRule) error {
+	measurements, err := measure(rule, time.Now())
+	if err != nil {
+		return err
+	}
+
+	var alerts []models.Alert
+	if err := database.DB.Where("alert_rule_id = ?", rule.ID).Find(&alerts).Error; err != nil {
+		return err
+	}
+	existing := make(map[uint]*models.Alert, len(alerts))
+	for i := range alerts {
+		existing[alerts[i].WorkflowID] = &alerts[i]
+	}
+
+	var errs []string
+	now := time.Now()
+	silenced := rule.Silenced(now)
+
+	for _, m := range measurements {
+		alert, ok := existing[m.WorkflowID]
+		if !breached(rule, m) {
+			if ok {
+				alert.Value = m.Value
+			}
+			continue
+		}
+		if !ok {
+			alert = &models.Alert{AlertRuleID: rule.ID, WorkflowID: m.WorkflowID, State: models.AlertOK}
+			existing[m.WorkflowID] = alert
+		}
+		alert.WorkflowName, alert.Value = m.Name, m.Value
+		if alert.State != models.AlertFiring {
+			alert.State, alert.FiredAt, alert.ResolvedAt = models.AlertFiring, &now, nil
+		}
+	}
+
+	for workflowID, alert := range existing {
+		if alert.State == models.AlertFiring {
+			if m, ok := measurements[workflowID]; !ok || !breached(rule, m) {
+				if !ok {
+					alert.Value = 0
+				}
+				alert.State, alert.ResolvedAt = models.AlertOK, &now
+				// Only alerts whose firing was notified are notified as resolved
+				if notified(alert) && !silenced {
+					if err := send(ctx, rule, *alert); err != nil {
+						errs = append(errs, err.Error())
+					}
+				}
+			} else if !notified(alert) && !silenced {
+				if err := send(ctx, rule, *alert); err != nil {
+					errs = append(errs, err.Error())
+				} else {
+					alert.NotifiedAt = &now
+				}
+			}
+		}
+
+		if err := database.DB.Save(alert).Error; err != nil {
+			return err
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to send alerts: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// notified reports whether the current firing of an alert was notified
+func notified(alert *models.Alert) bool {
+	return alert.NotifiedAt != nil && alert.FiredAt != nil && !alert.NotifiedAt.Before(*alert.FiredAt)
+}
+
+func breached(rule models.AlertRule, m measurement) bool {
+	if rule.Condition == models.AlertFailureRate && m.Total < int64(rule.MinExecutions) {
+		return false
+	}
+	return m.Value >= rule.Threshold
+}
+
+// measure returns the value of the rule's condition for each workflow in its scope with
+// executions in the window
+func measure(rule models.AlertRule, now time.Time) (map[uint]measurement, error) {
+	window, err := time.ParseDuration(rule.Window)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window: %v", err)
+	}
+	since := now.Add(-window)
+
+	// Executions of published versions count for their workflow
+	query := database.DB.Model(&models.WorkflowExecution{}).
+		Joins("JOIN workflows ON workflows.id = workflow_executions.workflow_id").
+		Joins("JOIN workflows roots ON roots.id = COALESCE(workflows.parent_id, workflows.id)").
+		Where("roots.deleted_at IS NULL").
+		Group("roots.id, roots.name")
+	if rule.OrganizationID != 0 {
+		query = query.Where("roots.organization_id = ?", rule.OrganizationID)
+	}
+	switch rule.Scope {
+	case models.AlertScopeWorkflow:
+		query = query.Where("roots.id = ?", rule.WorkflowID)
+	case models.AlertScopeTag:
+		query = query.Where("? = ANY(string_to_array(replace(roots.tags, ' ', ''), ','))", strings.ReplaceAll(rule.Tag, " ", ""))
+	}
+
+	var rows []measurement
+	switch rule.Condition {
+	case models.AlertFailureRate:
+		err = query.
+			Select("roots.id AS workflow_id, roots.name, COUNT(*) AS total, "+
+				"100.0 * COUNT(*) FILTER (WHERE workflow_executions.status = 'failed') / COUNT(*) AS value").
+			Where("workflow_executions.status IN ? AND workflow_executions.completed_at >= ?", []string{"completed", "failed"}, since).
+			Scan(&rows).Error
+	case models.AlertConsecutiveFailures:
+		// Failures since the last successful execution
+		err = query.
+			Select("roots.id AS workflow_id, roots.name, COUNT(*) AS total, COUNT(*) AS value").
+			Where("workflow_executions.status = 'failed' AND workflow_executions.completed_at >= ?", since).
+			Where("workflow_executions.completed_at > COALESCE((" +
+				"SELECT MAX(e.completed_at) FROM workflow_executions e JOIN workflows w ON w.id = e.workflow_id " +
+				"WHERE COALESCE(w.parent_id, w.id) = roots.id AND e.status = 'completed' AND e.deleted_at IS NULL" +
+				"), '-infinity')").
+			Scan(&rows).Error
+	case models.AlertDuration:
+		// Running executions count with their duration so far
+		err = query.
+			Select("roots.id AS workflow_id, roots.name, COUNT(*) AS total, "+
+				"MAX(EXTRACT(EPOCH FROM COALESCE(workflow_executions.completed_at, NOW()) - workflow_executions.started_at)) AS value").
+			Where("workflow_executions.completed_at >= ? OR workflow_executions.status = 'running'", since).
+			Scan(&rows).Error
+	default:
+		return nil, fmt.Errorf("unknown condition %q", rule.Condition)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	measurements := make(map[uint]measurement, len(rows))
+	for _, row := range rows {
+		measurements[row.WorkflowID] = row
+	}
+	return measurements, nil
+}
+
+// describe explains the condition of a rule as measured for an alert
+func describe(rule models.AlertRule, alert models.Alert) string {
+	switch rule.Condition {
+	case models.AlertFailureRate:
+		return fmt.Sprintf("%.0f%% of the executions in the last %s failed (threshold %.0f%%)", alert.Value, rule.Window, rule.Threshold)
+	case models.AlertConsecutiveFailures:
+		return fmt.Sprintf("The last %.0f executions failed (threshold %.0f)", alert.Value, rule.Threshold)
+	default:
+		return fmt.Sprintf("An execution in the last %s ran for %s (threshold %s)", rule.Window,
+			(time.Duration(alert.Value) * time.Second).String(), (time.Duration(rule.Threshold) * time.Second).String())
+	}
+}
+
+// webhookPayload is posted to the webhook of rules with the webhook channel
+type webhookPayload struct {
+	Rule       string    `json:"rule"`
+	RuleID     uint      `json:"rule_id"`
+	State      string    `json:"state"`
+	Condition  string    `json:"condition"`
+	Threshold  float64   `json:"threshold"`
+	Value      float64   `json:"value"`
+	WorkflowID uint      `json:"workflow_id"`
+	Workflow   string    `json:"workflow"`
+	Message    string    `json:"message"`
+	Link       string    `json:"link,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// send notifies the channel of a rule about the state of an alert
+func send(ctx context.Context, rule models.AlertRule, alert models.Alert) error {
+	state := "FIRING"
+	if alert.State == models.AlertOK {
+		state = "RESOLVED"
+	}
+	link := ""
+	if publicURL := os.Getenv("PUBLIC_URL"); publicURL != "" {
+		link = fmt.Sprintf("%s/api/workflows/%d", strings.TrimSuffix(publicURL, "/"), alert.WorkflowID)
+	}
+	msg := notify.Message{
+		Subject: fmt.Sprintf("[%s] %s: %s", state, rule.Name, alert.WorkflowName),
+		Text:    fmt.Sprintf("Workflow %q (%d): %s.", alert.WorkflowName, alert.WorkflowID, describe(rule, alert)),
+		Link:    link,
+	}
+
+	return Deliver(ctx, rule.Channel, rule.Target, msg, webhookPayload{
+		Rule:       rule.Name,
+		RuleID:     rule.ID,
+		State:      alert.State,
+		Condition:  rule.Condition,
+		Threshold:  rule.Threshold,
+		Value:      alert.Value,
+		WorkflowID: alert.WorkflowID,
+		Workflow:   alert.WorkflowName,
+		Message:    msg.Subject + "\n" + msg.Text,
+		Link:       link,
+		Timestamp:  time.Now(),
+	})
+}
+
+// Deliver sends a message to an alert channel: by email to the addresses of the target, to the
+// Slack webhook of the target (SLACK_WEBHOOK_URL if empty), or the payload as JSON to the
+// webhook of the target
+func Deliver(ctx context.Context, channel, target string, msg notify.Message, payload interface{}) error {
+	switch channel {
+	case models.AlertChannelEmail:
+		email := notify.EmailFromEnv()
+		if email == nil {
+			return errors.New("SMTP_HOST is not set")
+		}
+		msg.Recipients = recipients(target)
+		return email.Notify(ctx, msg)
+	case models.AlertChannelSlack:
+		webhookURL := target
+		if webhookURL == "" {
+			webhookURL = os.Getenv("SLACK_WEBHOOK_URL")
+		}
+		return notify.NewSlackNotifier(webhookURL).Notify(ctx, msg)
+	case models.AlertChannelWebhook:
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := webhookClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("alert webhook request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("alert webhook returned status %d", resp.StatusCode)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown channel %q", channel)
+	}
+}
+
+// recipients splits a comma separated list of email addresses
+func recipients(target string) []string {
+	var addresses []string
+	for _, address := range strings.Split(target, ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			addresses = append(addresses, address)
+		}
+	}
+	return addresses
+}
+
+// Silence suppresses the notifications of a rule until the given time, a zero time ends the silence
+func Silence(rule *models.AlertRule, until time.Time) error {
+	var value *time.Time
+	if !until.IsZero() {
+		value = &until
+	}
+	rule.SilencedUntil = value
+	return database.DB.Model(rule).Update("silenced_until", value).Error
+}
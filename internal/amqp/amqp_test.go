@@ -0,0 +1,288 @@
+package amqp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeBroker accepts a single connection and runs serve with it. It returns the address of
+// the broker.
+func fakeBroker(t *testing.T, serve func(b *broker)) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		serve(&broker{t: t, conn: conn, r: bufio.NewReader(conn)})
+	}()
+	return listener.Addr().String()
+}
+
+// broker is the server side of a connection of a fake broker
+type broker struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (b *broker) send(channel uint16, method uint32, args []byte) {
+	b.conn.Write(methodFrame(channel, method, args).encode())
+}
+
+// expect reads the next method from the client and returns its arguments, failing the test if
+// it is another method
+func (b *broker) expect(channel uint16, method uint32) *decoder {
+	b.t.Helper()
+	f, err := readFrame(b.r, 0)
+	if err != nil {
+		b.t.Errorf("reading method %d.%d: %v", method>>16, method&0xffff, err)
+		return newDecoder(nil)
+	}
+	id, args, err := methodID(f.payload)
+	if err != nil || f.kind != frameMethod || id != method || f.channel != channel {
+		b.t.Errorf("got frame type %d on channel %d with method %d.%d, want method %d.%d on channel %d",
+			f.kind, f.channel, id>>16, id&0xffff, method>>16, method&0xffff, channel)
+	}
+	return newDecoder(args)
+}
+
+// start reads the protocol header and sends connection.start offering the mechanisms
+func (b *broker) start(mechanisms string) {
+	b.t.Helper()
+	header := make([]byte, len(protocolHeader))
+	if _, err := io.ReadFull(b.r, header); err != nil || !bytes.Equal(header, protocolHeader) {
+		b.t.Errorf("protocol header = % x (%v), want % x", header, err, protocolHeader)
+	}
+	start := []byte{0, 9}
+	start = appendTable(start, map[string]interface{}{"product": "RabbitMQ"})
+	start = appendLongString(start, mechanisms)
+	start = appendLongString(start, "en_US")
+	b.send(0, methodConnectionStart, start)
+}
+
+// login reads connection.start-ok and returns the mechanism and response
+func (b *broker) login() (string, string) {
+	b.t.Helper()
+	startOk := b.expect(0, methodConnectionStartOk)
+	properties := startOk.table()
+	mechanism := startOk.shortString()
+	response := startOk.longString()
+	if capabilities, _ := properties["capabilities"].(map[string]interface{}); capabilities["authentication_failure_close"] != true {
+		b.t.Errorf("client properties = %v, want the authentication_failure_close capability", properties)
+	}
+	return mechanism, response
+}
+
+// open accepts the login and opens the connection and the consumer channel, returning the
+// login and the virtual host requested by the client
+func (b *broker) open() (login, vhost string) {
+	b.t.Helper()
+	b.start("AMQPLAIN PLAIN")
+	mechanism, response := b.login()
+
+	tune := binary.BigEndian.AppendUint16(nil, 2047)
+	tune = binary.BigEndian.AppendUint32(tune, 1<<20)
+	tune = binary.BigEndian.AppendUint16(tune, 30)
+	b.send(0, methodConnectionTune, tune)
+	tuneOk := b.expect(0, methodConnectionTuneOk)
+	if channelMax, frameMax, heartbeat := tuneOk.short(), tuneOk.long(), tuneOk.short(); channelMax != 2047 || frameMax != defaultFrameMax || heartbeat != 30 {
+		b.t.Errorf("tune-ok = %d, %d, %d; want 2047, %d, 30", channelMax, frameMax, heartbeat, defaultFrameMax)
+	}
+
+	vhost = b.expect(0, methodConnectionOpen).shortString()
+	b.send(0, methodConnectionOpenOk, appendShortString(nil, ""))
+	b.expect(consumerChannel, methodChannelOpen)
+	b.send(consumerChannel, methodChannelOpenOk, appendLongString(nil, ""))
+	return mechanism + " " + response, vhost
+}
+
+func dial(t *testing.T, address string, opts Options) (*Conn, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if opts.URL == "" {
+		opts.URL = "amqp://" + address
+	}
+	return Dial(ctx, opts)
+}
+
+func TestDialHandshake(t *testing.T) {
+	logins := make(chan string, 1)
+	vhosts := make(chan string, 1)
+	address := fakeBroker(t, func(b *broker) {
+		login, vhost := b.open()
+		logins <- login
+		vhosts <- vhost
+		b.expect(0, methodConnectionClose)
+	})
+
+	conn, err := dial(t, address, Options{URL: "amqp://guest:guest@" + address + "/orders", Username: "flowcraft", Password: "secret"})
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+	if conn.heartbeat != 30*time.Second || conn.frameMax != defaultFrameMax {
+		t.Errorf("heartbeat = %s, frame max = %d; want 30s, %d", conn.heartbeat, conn.frameMax, defaultFrameMax)
+	}
+	if got := <-logins; got != "PLAIN \x00flowcraft\x00secret" {
+		t.Errorf("login = %q, want PLAIN with the username and password of the options", got)
+	}
+	if got := <-vhosts; got != "orders" {
+		t.Errorf("virtual host = %q, want orders", got)
+	}
+}
+
+func TestDialRefused(t *testing.T) {
+	closedOk := make(chan bool, 1)
+	address := fakeBroker(t, func(b *broker) {
+		b.start("PLAIN")
+		b.login()
+		refused := binary.BigEndian.AppendUint16(nil, 403)
+		refused = appendShortString(refused, "ACCESS_REFUSED - Login was refused")
+		refused = binary.BigEndian.AppendUint32(refused, 0)
+		b.send(0, methodConnectionClose, refused)
+		b.expect(0, methodConnectionCloseOk)
+		closedOk <- true
+	})
+
+	_, err := dial(t, address, Options{})
+	var exception *Error
+	if !errors.As(err, &exception) || exception.Code != 403 || !strings.Contains(exception.Text, "ACCESS_REFUSED") {
+		t.Fatalf("Dial() error = %v, want the refused login", err)
+	}
+	if !IsAuthError(err) {
+		t.Error("IsAuthError() = false, want true")
+	}
+	<-closedOk
+}
+
+func TestDialWithoutPlain(t *testing.T) {
+	address := fakeBroker(t, func(b *broker) {
+		b.start("EXTERNAL")
+		io.Copy(io.Discard, b.r)
+	})
+
+	_, err := dial(t, address, Options{})
+	if err == nil || !strings.Contains(err.Error(), "PLAIN") {
+		t.Errorf("Dial() error = %v, want the missing PLAIN mechanism", err)
+	}
+}
+
+func TestConsume(t *testing.T) {
+	acks := make(chan uint64, 1)
+	address := fakeBroker(t, func(b *broker) {
+		b.open()
+		if prefetch := b.expect(consumerChannel, methodBasicQos); prefetch.long() != 0 || prefetch.short() != 5 {
+			t.Error("basic.qos does not set the prefetch count 5")
+		}
+		b.send(consumerChannel, methodBasicQosOk, nil)
+		consume := b.expect(consumerChannel, methodBasicConsume)
+		consume.short()
+		if queue := consume.shortString(); queue != "orders" {
+			t.Errorf("consumed queue = %q, want orders", queue)
+		}
+		b.send(consumerChannel, methodBasicConsumeOk, appendShortString(nil, "ctag"))
+
+		deliver := appendShortString(nil, "ctag")
+		deliver = binary.BigEndian.AppendUint64(deliver, 42)
+		deliver = append(deliver, 1)
+		deliver = appendShortString(deliver, "shop")
+		deliver = appendShortString(deliver, "order.created")
+		b.send(consumerChannel, methodBasicDeliver, deliver)
+
+		body := []byte(`{"id":1}`)
+		header := binary.BigEndian.AppendUint16(nil, 60)
+		header = binary.BigEndian.AppendUint16(header, 0)
+		header = binary.BigEndian.AppendUint64(header, uint64(len(body)))
+		header = binary.BigEndian.AppendUint16(header, 1<<15|1<<7)
+		header = appendShortString(header, "application/json")
+		header = appendShortString(header, "msg-1")
+		b.conn.Write(frame{kind: frameHeader, channel: consumerChannel, payload: header}.encode())
+		// The body is split into two frames, with a heartbeat in between
+		b.conn.Write(frame{kind: frameBody, channel: consumerChannel, payload: body[:3]}.encode())
+		b.conn.Write(frame{kind: frameHeartbeat}.encode())
+		b.conn.Write(frame{kind: frameBody, channel: consumerChannel, payload: body[3:]}.encode())
+
+		ack := b.expect(consumerChannel, methodBasicAck)
+		acks <- ack.longlong()
+		io.Copy(io.Discard, b.r)
+	})
+
+	conn, err := dial(t, address, Options{})
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	deliveries := make(chan Delivery, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- conn.Consume(ctx, "orders", 5, func(delivery Delivery) error {
+			deliveries <- delivery
+			return nil
+		})
+	}()
+
+	delivery := <-deliveries
+	if delivery.Exchange != "shop" || delivery.RoutingKey != "order.created" || !delivery.Redelivered ||
+		string(delivery.Body) != `{"id":1}` || delivery.Properties.ContentType != "application/json" || delivery.Properties.MessageID != "msg-1" {
+		t.Errorf("delivery = %+v", delivery)
+	}
+	if tag := <-acks; tag != 42 {
+		t.Errorf("acknowledged delivery tag %d, want 42", tag)
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Consume() error = %v after cancelling, want nil", err)
+	}
+}
+
+func TestConsumeMissingQueue(t *testing.T) {
+	address := fakeBroker(t, func(b *broker) {
+		b.open()
+		b.expect(consumerChannel, methodBasicQos)
+		b.send(consumerChannel, methodBasicQosOk, nil)
+		b.expect(consumerChannel, methodBasicConsume)
+		notFound := binary.BigEndian.AppendUint16(nil, 404)
+		notFound = appendShortString(notFound, "NOT_FOUND - no queue 'orders'")
+		notFound = binary.BigEndian.AppendUint32(notFound, 60<<16|20)
+		b.send(consumerChannel, methodChannelClose, notFound)
+		b.expect(consumerChannel, methodChannelCloseOk)
+		io.Copy(io.Discard, b.r)
+	})
+
+	conn, err := dial(t, address, Options{})
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer conn.Close()
+
+	err = conn.Consume(context.Background(), "orders", 1, func(Delivery) error { return nil })
+	var exception *Error
+	if !errors.As(err, &exception) || exception.Code != 404 {
+		t.Errorf("Consume() error = %v, want the channel exception", err)
+	}
+	if IsAuthError(err) {
+		t.Error("IsAuthError() = true for a missing queue")
+	}
+}
@@ -0,0 +1,253 @@
+package amqp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Frame types of AMQP 0-9-1
+const (
+	frameMethod    = 1
+	frameHeader    = 2
+	frameBody      = 3
+	frameHeartbeat = 8
+	frameEnd       = 0xce
+)
+
+// Classes and methods used by the client, as class<<16 | method
+const (
+	methodConnectionStart   = 10<<16 | 10
+	methodConnectionStartOk = 10<<16 | 11
+	methodConnectionTune    = 10<<16 | 30
+	methodConnectionTuneOk  = 10<<16 | 31
+	methodConnectionOpen    = 10<<16 | 40
+	methodConnectionOpenOk  = 10<<16 | 41
+	methodConnectionClose   = 10<<16 | 50
+	methodConnectionCloseOk = 10<<16 | 51
+	methodChannelOpen       = 20<<16 | 10
+	methodChannelOpenOk     = 20<<16 | 11
+	methodChannelClose      = 20<<16 | 40
+	methodChannelCloseOk    = 20<<16 | 41
+	methodBasicQos          = 60<<16 | 10
+	methodBasicQosOk        = 60<<16 | 11
+	methodBasicConsume      = 60<<16 | 20
+	methodBasicConsumeOk    = 60<<16 | 21
+	methodBasicCancel       = 60<<16 | 30
+	methodBasicDeliver      = 60<<16 | 60
+	methodBasicAck          = 60<<16 | 80
+	methodBasicNack         = 60<<16 | 120
+)
+
+// protocolHeader starts every connection
+var protocolHeader = []byte{'A', 'M', 'Q', 'P', 0, 0, 9, 1}
+
+// frame is a frame of a channel
+type frame struct {
+	kind    byte
+	channel uint16
+	payload []byte
+}
+
+// encode returns the frame as sent on the wire
+func (f frame) encode() []byte {
+	data := make([]byte, 7, 8+len(f.payload))
+	data[0] = f.kind
+	binary.BigEndian.PutUint16(data[1:], f.channel)
+	binary.BigEndian.PutUint32(data[3:], uint32(len(f.payload)))
+	data = append(data, f.payload...)
+	return append(data, frameEnd)
+}
+
+// readFrame reads the next frame, rejecting frames larger than maxSize
+func readFrame(r *bufio.Reader, maxSize uint32) (frame, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return frame{}, err
+	}
+	size := binary.BigEndian.Uint32(header[3:])
+	if maxSize > 0 && size > maxSize {
+		return frame{}, fmt.Errorf("amqp: frame of %d bytes exceeds the negotiated frame size", size)
+	}
+	payload := make([]byte, size+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return frame{}, err
+	}
+	if payload[size] != frameEnd {
+		return frame{}, errors.New("amqp: malformed frame")
+	}
+	return frame{kind: header[0], channel: binary.BigEndian.Uint16(header[1:]), payload: payload[:size]}, nil
+}
+
+// methodFrame returns the frame of a method with its encoded arguments
+func methodFrame(channel uint16, method uint32, args []byte) frame {
+	payload := binary.BigEndian.AppendUint32(nil, method)
+	return frame{kind: frameMethod, channel: channel, payload: append(payload, args...)}
+}
+
+// methodID reads the class and method of a method frame
+func methodID(payload []byte) (uint32, []byte, error) {
+	if len(payload) < 4 {
+		return 0, nil, errors.New("amqp: malformed method frame")
+	}
+	return binary.BigEndian.Uint32(payload), payload[4:], nil
+}
+
+// appendShortString appends a string of up to 255 bytes
+func appendShortString(data []byte, value string) []byte {
+	if len(value) > math.MaxUint8 {
+		value = value[:math.MaxUint8]
+	}
+	data = append(data, byte(len(value)))
+	return append(data, value...)
+}
+
+// appendLongString appends a string with a 32 bit length
+func appendLongString(data []byte, value string) []byte {
+	data = binary.BigEndian.AppendUint32(data, uint32(len(value)))
+	return append(data, value...)
+}
+
+// appendTable appends a field table of strings, booleans and nested tables
+func appendTable(data []byte, table map[string]interface{}) []byte {
+	var entries []byte
+	for key, value := range table {
+		entries = appendShortString(entries, key)
+		switch value := value.(type) {
+		case string:
+			entries = append(entries, 'S')
+			entries = appendLongString(entries, value)
+		case bool:
+			entries = append(entries, 't', 0)
+			if value {
+				entries[len(entries)-1] = 1
+			}
+		case map[string]interface{}:
+			entries = append(entries, 'F')
+			entries = appendTable(entries, value)
+		default:
+			entries = append(entries, 'V')
+		}
+	}
+	data = binary.BigEndian.AppendUint32(data, uint32(len(entries)))
+	return append(data, entries...)
+}
+
+// decoder reads the arguments of methods and content headers
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func newDecoder(data []byte) *decoder {
+	return &decoder{r: bytes.NewReader(data)}
+}
+
+func (d *decoder) read(n int) []byte {
+	if d.err != nil {
+		return make([]byte, n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(d.r, data); err != nil {
+		d.err = errors.New("amqp: malformed arguments")
+	}
+	return data
+}
+
+func (d *decoder) octet() byte      { return d.read(1)[0] }
+func (d *decoder) short() uint16    { return binary.BigEndian.Uint16(d.read(2)) }
+func (d *decoder) long() uint32     { return binary.BigEndian.Uint32(d.read(4)) }
+func (d *decoder) longlong() uint64 { return binary.BigEndian.Uint64(d.read(8)) }
+
+func (d *decoder) shortString() string {
+	return string(d.read(int(d.octet())))
+}
+
+func (d *decoder) longString() string {
+	size := d.long()
+	if d.err != nil || int64(size) > int64(d.r.Len()) {
+		d.err = errors.New("amqp: malformed arguments")
+		return ""
+	}
+	return string(d.read(int(size)))
+}
+
+// table reads a field table
+func (d *decoder) table() map[string]interface{} {
+	size := d.long()
+	if d.err != nil || int64(size) > int64(d.r.Len()) {
+		d.err = errors.New("amqp: malformed field table")
+		return nil
+	}
+	entries := &decoder{r: bytes.NewReader(d.read(int(size)))}
+	table := map[string]interface{}{}
+	for entries.err == nil && entries.r.Len() > 0 {
+		name := entries.shortString()
+		table[name] = entries.value()
+	}
+	if entries.err != nil {
+		d.err = entries.err
+	}
+	return table
+}
+
+// value reads a typed value of a field table or array
+func (d *decoder) value() interface{} {
+	switch kind := d.octet(); kind {
+	case 't':
+		return d.octet() != 0
+	case 'b':
+		return int8(d.octet())
+	case 'B':
+		return d.octet()
+	case 's':
+		return int16(d.short())
+	case 'u':
+		return d.short()
+	case 'I':
+		return int32(d.long())
+	case 'i':
+		return d.long()
+	case 'l':
+		return int64(d.longlong())
+	case 'f':
+		return math.Float32frombits(d.long())
+	case 'd':
+		return math.Float64frombits(d.longlong())
+	case 'D':
+		scale := d.octet()
+		value := int32(d.long())
+		return float64(value) / math.Pow10(int(scale))
+	case 'S', 'x':
+		return d.longString()
+	case 'T':
+		return time.Unix(int64(d.longlong()), 0).UTC().Format(time.RFC3339)
+	case 'F':
+		return d.table()
+	case 'A':
+		size := d.long()
+		if d.err != nil || int64(size) > int64(d.r.Len()) {
+			d.err = errors.New("amqp: malformed field array")
+			return nil
+		}
+		items := &decoder{r: bytes.NewReader(d.read(int(size)))}
+		values := []interface{}{}
+		for items.err == nil && items.r.Len() > 0 {
+			values = append(values, items.value())
+		}
+		if items.err != nil {
+			d.err = items.err
+		}
+		return values
+	case 'V':
+		return nil
+	default:
+		d.err = fmt.Errorf("amqp: unknown field type %q", kind)
+		return nil
+	}
+}
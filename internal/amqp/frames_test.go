@@ -0,0 +1,180 @@
+package amqp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFrameEncode(t *testing.T) {
+	data := methodFrame(1, methodBasicQosOk, nil).encode()
+	want := []byte{
+		frameMethod,
+		0x00, 0x01, // channel
+		0x00, 0x00, 0x00, 0x04, // payload size
+		0x00, 0x3c, 0x00, 0x0b, // basic.qos-ok
+		frameEnd,
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("encode() = % x, want % x", data, want)
+	}
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	frames := []frame{
+		methodFrame(0, methodConnectionStartOk, []byte("arguments")),
+		{kind: frameBody, channel: 1, payload: bytes.Repeat([]byte{0xce}, 1000)},
+		{kind: frameHeartbeat},
+	}
+	var data []byte
+	for _, f := range frames {
+		data = append(data, f.encode()...)
+	}
+
+	r := bufio.NewReader(bytes.NewReader(data))
+	for _, want := range frames {
+		got, err := readFrame(r, defaultFrameMax)
+		if err != nil {
+			t.Fatalf("readFrame() error = %v", err)
+		}
+		if got.kind != want.kind || got.channel != want.channel || !bytes.Equal(got.payload, want.payload) {
+			t.Errorf("readFrame() = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestReadFrameInvalid(t *testing.T) {
+	tooLarge := frame{kind: frameBody, channel: 1, payload: make([]byte, 100)}.encode()
+	if _, err := readFrame(bufio.NewReader(bytes.NewReader(tooLarge)), 50); err == nil || !strings.Contains(err.Error(), "frame size") {
+		t.Errorf("readFrame() of an oversized frame error = %v", err)
+	}
+
+	malformed := frame{kind: frameBody, channel: 1, payload: []byte("body")}.encode()
+	malformed[len(malformed)-1] = 0
+	if _, err := readFrame(bufio.NewReader(bytes.NewReader(malformed)), 0); err == nil || !strings.Contains(err.Error(), "malformed") {
+		t.Errorf("readFrame() without frame end error = %v", err)
+	}
+
+	truncated := frame{kind: frameBody, channel: 1, payload: []byte("body")}.encode()[:8]
+	if _, err := readFrame(bufio.NewReader(bytes.NewReader(truncated)), 0); err == nil {
+		t.Error("readFrame() of a truncated frame succeeded")
+	}
+}
+
+func TestTableRoundTrip(t *testing.T) {
+	table := map[string]interface{}{
+		"product": "FlowCraft",
+		"enabled": true,
+		"missing": nil,
+		"capabilities": map[string]interface{}{
+			"consumer_cancel_notify": true,
+			"publisher_confirms":     false,
+		},
+	}
+	d := newDecoder(appendTable(nil, table))
+	got := d.table()
+	if d.err != nil {
+		t.Fatalf("table() error = %v", d.err)
+	}
+	if !reflect.DeepEqual(got, table) {
+		t.Errorf("table() = %v, want %v", got, table)
+	}
+}
+
+func TestDecodeValues(t *testing.T) {
+	u16 := func(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+	u32 := func(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+	u64 := func(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+	tests := []struct {
+		name  string
+		data  []byte
+		value interface{}
+	}{
+		{"boolean", []byte{'t', 1}, true},
+		{"signed octet", []byte{'b', 0xff}, int8(-1)},
+		{"octet", []byte{'B', 0xff}, byte(255)},
+		{"signed short", join([]byte{'s'}, u16(0xfffe)), int16(-2)},
+		{"short", join([]byte{'u'}, u16(512)), uint16(512)},
+		{"signed long", join([]byte{'I'}, u32(0xfffffffd)), int32(-3)},
+		{"long", join([]byte{'i'}, u32(70000)), uint32(70000)},
+		{"signed long long", join([]byte{'l'}, u64(1<<40)), int64(1 << 40)},
+		{"float", join([]byte{'f'}, u32(math.Float32bits(1.5))), float32(1.5)},
+		{"double", join([]byte{'d'}, u64(math.Float64bits(-2.25))), -2.25},
+		{"decimal", join([]byte{'D', 2}, u32(12345)), 123.45},
+		{"long string", join([]byte{'S'}, u32(5), []byte("hello")), "hello"},
+		{"byte array", join([]byte{'x'}, u32(2), []byte{0x01, 0x02}), "\x01\x02"},
+		{"timestamp", join([]byte{'T'}, u64(1700000000)), time.Unix(1700000000, 0).UTC().Format(time.RFC3339)},
+		{"array", join([]byte{'A'}, u32(9), []byte{'t', 0}, []byte{'S'}, u32(2), []byte("ok")), []interface{}{false, "ok"}},
+		{"void", []byte{'V'}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDecoder(tt.data)
+			got := d.value()
+			if d.err != nil {
+				t.Fatalf("value() error = %v", d.err)
+			}
+			if !reflect.DeepEqual(got, tt.value) {
+				t.Errorf("value() = %#v, want %#v", got, tt.value)
+			}
+		})
+	}
+}
+
+func TestDecodeMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"unknown type", []byte{'?'}},
+		{"string longer than data", append([]byte{'S'}, binary.BigEndian.AppendUint32(nil, 100)...)},
+		{"truncated short", []byte{'u', 0x01}},
+		{"table longer than data", append([]byte{'F'}, binary.BigEndian.AppendUint32(nil, 10)...)},
+		{"array longer than data", append([]byte{'A'}, binary.BigEndian.AppendUint32(nil, 10)...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDecoder(tt.data)
+			d.value()
+			if d.err == nil {
+				t.Error("value() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestReadProperties(t *testing.T) {
+	flags := uint16(1<<15 | 1<<13 | 1<<12 | 1<<10 | 1<<7 | 1<<6 | 1<<3)
+	data := binary.BigEndian.AppendUint16(nil, flags)
+	data = appendShortString(data, "application/json")
+	data = appendTable(data, map[string]interface{}{"tenant": "acme"})
+	data = append(data, 2)
+	data = appendShortString(data, "corr-1")
+	data = appendShortString(data, "msg-1")
+	data = binary.BigEndian.AppendUint64(data, 1700000000)
+	data = appendShortString(data, "shop")
+
+	d := newDecoder(data)
+	got := readProperties(d)
+	if d.err != nil {
+		t.Fatalf("readProperties() error = %v", d.err)
+	}
+	want := Properties{
+		ContentType:   "application/json",
+		Headers:       map[string]interface{}{"tenant": "acme"},
+		DeliveryMode:  2,
+		CorrelationID: "corr-1",
+		MessageID:     "msg-1",
+		Timestamp:     time.Unix(1700000000, 0).UTC(),
+		AppID:         "shop",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readProperties() = %+v, want %+v", got, want)
+	}
+}
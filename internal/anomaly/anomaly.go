@@ -0,0 +1,279 @@
+// Package anomaly learns the typical durations of workflows and nodes from completed
+// executions and scores how far each execution deviates from them, surfacing slowdowns that do
+// not fail anything, e.g. of the APIs nodes depend on
+package anomaly
+
+import (
+	"context"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// cursorName identifies the position of the analyzer
+	cursorName = "duration_anomalies"
+	// batchSize is the number of executions analyzed per transaction
+	batchSize = 500
+	// initialLookback is how far back the first run learns from
+	initialLookback = 7 * 24 * time.Hour
+	// minStdDev bounds the standard deviation of log durations, so workflows with very stable
+	// durations are not flagged for small jitter; 0.1 is about 10%
+	minStdDev = 0.1
+	// outlierClamp limits the influence of outliers on the baseline, in standard deviations
+	outlierClamp = 3
+)
+
+// Config holds the settings of the analyzer
+type Config struct {
+	// Interval between analyzer runs, 0 disables anomaly detection
+	Interval time.Duration
+	// MinSamples is the number of executions learned from before they are scored
+	MinSamples int64
+	// Smoothing is the weight of a new duration in the baseline; lower values adapt more slowly
+	Smoothing float64
+}
+
+// ConfigFromEnv reads the analyzer settings from the environment
+func ConfigFromEnv() Config {
+	cfg := Config{Interval: time.Minute, MinSamples: 20, Smoothing: 0.05}
+
+	if interval, err := time.ParseDuration(os.Getenv("ANOMALY_DETECTION_INTERVAL")); err == nil && interval >= 0 {
+		cfg.Interval = interval
+	}
+	if samples, err := strconv.ParseInt(os.Getenv("ANOMALY_MIN_SAMPLES"), 10, 64); err == nil && samples > 1 {
+		cfg.MinSamples = samples
+	}
+	if smoothing, err := strconv.ParseFloat(os.Getenv("ANOMALY_SMOOTHING"), 64); err == nil && smoothing > 0 && smoothing < 1 {
+		cfg.Smoothing = smoothing
+	}
+
+	return cfg
+}
+
+// Run analyzes the executions completed since the previous run at the configured interval until
+// the context is done
+func Run(ctx context.Context, cfg Config) {
+	if cfg.Interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			analyzed, err := Analyze(cfg)
+			if err != nil {
+				log.Printf("Failed to analyze execution durations: %v", err)
+				break
+			}
+			if analyzed < batchSize || ctx.Err() != nil {
+				break
+			}
+		}
+	}
+}
+
+// execution is a completed execution to analyze
+type execution struct {
+	ID          uint
+	RootID      uint
+	StartedAt   time.Time
+	CompletedAt time.Time
+}
+
+// nodeExecution is a completed node execution to analyze
+type nodeExecution struct {
+	ID                  uint
+	WorkflowExecutionID uint
+	NodeID              uint
+	DurationMs          int64
+}
+
+type baselineKey struct {
+	workflowID, nodeID uint
+}
+
+// Analyze scores the next batch of successfully completed executions and their node executions
+// against the baselines and updates the baselines with them. Workers analyzing at the same time
+// wait for each other. It returns the number of executions analyzed.
+func Analyze(cfg Config) (int, error) {
+	var analyzed int
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		cursor := models.AnalysisCursor{Name: cursorName}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&cursor).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&cursor, "name = ?", cursorName).Error; err != nil {
+			return err
+		}
+		position := time.Now().Add(-initialLookback)
+		if cursor.LastCompletedAt != nil {
+			position = *cursor.LastCompletedAt
+		}
+
+		// Executions of published versions count for their workflow
+		var executions []execution
+		err := tx.Model(&models.WorkflowExecution{}).
+			Select("workflow_executions.id, COALESCE(workflows.parent_id, workflows.id) AS root_id, "+
+				"workflow_executions.started_at, workflow_executions.completed_at").
+			Joins("JOIN workflows ON workflows.id = workflow_executions.workflow_id").
+			Where("workflow_executions.status = ?", "completed").
+			Where("(workflow_executions.completed_at, workflow_executions.id) > (?, ?)", position, cursor.LastExecutionID).
+			Order("workflow_executions.completed_at, workflow_executions.id").
+			Limit(batchSize).
+			Scan(&executions).Error
+		if err != nil || len(executions) == 0 {
+			return err
+		}
+
+		executionIDs := make([]uint, len(executions))
+		for i, e := range executions {
+			executionIDs[i] = e.ID
+		}
+		var nodeExecutions []nodeExecution
+		err = tx.Model(&models.NodeExecution{}).
+			Select("id, workflow_execution_id, node_id, duration_ms").
+			Where("workflow_execution_id IN ? AND status = ? AND duration_ms > 0", executionIDs, "completed").
+			Order("id").
+			Scan(&nodeExecutions).Error
+		if err != nil {
+			return err
+		}
+		nodesByExecution := make(map[uint][]nodeExecution, len(executions))
+		for _, n := range nodeExecutions {
+			nodesByExecution[n.WorkflowExecutionID] = append(nodesByExecution[n.WorkflowExecutionID], n)
+		}
+
+		baselines, err := loadBaselines(tx, executions)
+		if err != nil {
+			return err
+		}
+		observed := map[baselineKey]bool{}
+		baseline := func(workflowID, nodeID uint) *models.DurationBaseline {
+			key := baselineKey{workflowID, nodeID}
+			observed[key] = true
+			if b, ok := baselines[key]; ok {
+				return b
+			}
+			b := &models.DurationBaseline{WorkflowID: workflowID, NodeID: nodeID}
+			baselines[key] = b
+			return b
+		}
+
+		for _, e := range executions {
+			durationMs := float64(e.CompletedAt.Sub(e.StartedAt).Milliseconds())
+			if durationMs > 0 {
+				if score, ok := observe(baseline(e.RootID, 0), durationMs, cfg); ok {
+					if err := tx.Model(&models.WorkflowExecution{}).Where("id = ?", e.ID).
+						Update("anomaly_score", score).Error; err != nil {
+						return err
+					}
+				}
+			}
+
+			for _, n := range nodesByExecution[e.ID] {
+				if score, ok := observe(baseline(e.RootID, n.NodeID), float64(n.DurationMs), cfg); ok {
+					if err := tx.Model(&models.NodeExecution{}).Where("id = ?", n.ID).
+						Update("anomaly_score", score).Error; err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		for key := range observed {
+			if err := tx.Save(baselines[key]).Error; err != nil {
+				return err
+			}
+		}
+
+		last := executions[len(executions)-1]
+		analyzed = len(executions)
+		return tx.Model(&cursor).Updates(map[string]interface{}{
+			"last_completed_at": last.CompletedAt,
+			"last_execution_id": last.ID,
+		}).Error
+	})
+	return analyzed, err
+}
+
+// loadBaselines loads the baselines of the workflows of the executions and their nodes
+func loadBaselines(tx *gorm.DB, executions []execution) (map[baselineKey]*models.DurationBaseline, error) {
+	workflowIDs := make([]uint, 0, len(executions))
+	seen := map[uint]bool{}
+	for _, e := range executions {
+		if !seen[e.RootID] {
+			seen[e.RootID] = true
+			workflowIDs = append(workflowIDs, e.RootID)
+		}
+	}
+
+	var rows []models.DurationBaseline
+	if err := tx.Where("workflow_id IN ?", workflowIDs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	baselines := make(map[baselineKey]*models.DurationBaseline, len(rows))
+	for i := range rows {
+		baselines[baselineKey{rows[i].WorkflowID, rows[i].NodeID}] = &rows[i]
+	}
+	return baselines, nil
+}
+
+// observe scores a duration against the baseline, if it learned from enough samples, and adds
+// the duration to the baseline. The score is the deviation of the log duration from the mean in
+// standard deviations; positive scores are slower than usual.
+func observe(b *models.DurationBaseline, durationMs float64, cfg Config) (float64, bool) {
+	x := math.Log(durationMs)
+
+	var score float64
+	scored := b.Samples >= cfg.MinSamples
+	stdDev := math.Max(math.Sqrt(b.VarLog), minStdDev)
+	if scored {
+		score = deviation(*b, x)
+		// Outliers shift the baseline only as far as a clearly unusual duration would
+		x = math.Max(math.Min(x, b.MeanLog+outlierClamp*stdDev), b.MeanLog-outlierClamp*stdDev)
+	}
+
+	// The first samples are averaged evenly, later ones weighted exponentially
+	b.Samples++
+	alpha := math.Max(cfg.Smoothing, 1/float64(b.Samples))
+	delta := x - b.MeanLog
+	b.MeanLog += alpha * delta
+	b.VarLog = (1 - alpha) * (b.VarLog + alpha*delta*delta)
+
+	return score, scored
+}
+
+// deviation returns the deviation of a log duration from the baseline's mean in standard deviations
+func deviation(b models.DurationBaseline, x float64) float64 {
+	stdDev := math.Max(math.Sqrt(b.VarLog), minStdDev)
+	return math.Round((x-b.MeanLog)/stdDev*100) / 100
+}
+
+// Score scores a duration of a workflow's executions (nodeID 0) or of a node's executions against
+// its baseline without learning from it, e.g. to judge an execution as soon as it finished. ok is
+// false if the baseline did not learn from enough executions yet.
+func Score(workflowID, nodeID uint, durationMs float64, cfg Config) (score float64, ok bool) {
+	var b models.DurationBaseline
+	if durationMs <= 0 || database.DB.Where("workflow_id = ? AND node_id = ?", workflowID, nodeID).Limit(1).Find(&b).RowsAffected == 0 {
+		return 0, false
+	}
+	if b.Samples < cfg.MinSamples {
+		return 0, false
+	}
+	return deviation(b, math.Log(durationMs)), true
+}
@@ -0,0 +1,225 @@
+// Package archive moves finished executions past a configured age to an S3 compatible object
+// store, leaving stub rows with their status and timings in the database, and loads them back
+// when they are accessed
+package archive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/cache"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/s3"
+	"gorm.io/gorm"
+)
+
+// rehydratedTTL is how long executions loaded from the archive are cached
+const rehydratedTTL = 10 * time.Minute
+
+// ErrNotConfigured is returned when loading an archived execution without archive bucket
+var ErrNotConfigured = errors.New("execution archive is not configured")
+
+// Config configures the archival of executions
+type Config struct {
+	Bucket s3.Bucket
+	// Prefix of the keys of archived executions
+	Prefix string
+	// After is the age of finished executions that are archived, 0 disables archiving
+	After time.Duration
+	// Interval is how often executions are archived
+	Interval time.Duration
+	// BatchSize is the number of executions archived per query
+	BatchSize int
+}
+
+// ConfigFromEnv reads the archive configuration from ARCHIVE_BUCKET, ARCHIVE_PREFIX (default
+// "flowcraft/archive"), ARCHIVE_REGION, ARCHIVE_ENDPOINT, ARCHIVE_AFTER_DAYS (0 disables
+// archiving), ARCHIVE_INTERVAL (default 1h) and ARCHIVE_BATCH_SIZE (default 100)
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Bucket: s3.Bucket{
+			Name:     os.Getenv("ARCHIVE_BUCKET"),
+			Region:   os.Getenv("ARCHIVE_REGION"),
+			Endpoint: os.Getenv("ARCHIVE_ENDPOINT"),
+		},
+		Prefix:    "flowcraft/archive",
+		Interval:  time.Hour,
+		BatchSize: 100,
+	}
+	if prefix, ok := os.LookupEnv("ARCHIVE_PREFIX"); ok {
+		cfg.Prefix = strings.Trim(prefix, "/")
+	}
+	if days, err := strconv.Atoi(os.Getenv("ARCHIVE_AFTER_DAYS")); err == nil && days > 0 {
+		cfg.After = time.Duration(days) * 24 * time.Hour
+	}
+	if interval, err := time.ParseDuration(os.Getenv("ARCHIVE_INTERVAL")); err == nil && interval > 0 {
+		cfg.Interval = interval
+	}
+	if size, err := strconv.Atoi(os.Getenv("ARCHIVE_BATCH_SIZE")); err == nil && size > 0 {
+		cfg.BatchSize = size
+	}
+	return cfg
+}
+
+var config Config
+
+// Configure sets the archive configuration, also needed to load archived executions
+func Configure(cfg Config) {
+	config = cfg
+}
+
+// Document is the archived form of an execution with its node executions
+type Document struct {
+	ArchivedAt time.Time                `json:"archived_at"`
+	Execution  models.WorkflowExecution `json:"execution"`
+}
+
+// Run archives the finished executions older than the configured age at the configured
+// interval until the context is done
+func Run(ctx context.Context) {
+	cfg := config
+	if cfg.Bucket.Name == "" || cfg.After == 0 {
+		return
+	}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		archived, err := ArchiveBefore(ctx, time.Now().Add(-cfg.After))
+		if err != nil {
+			log.Printf("Failed to archive executions: %v", err)
+		}
+		if archived > 0 {
+			log.Printf("Archived %d executions", archived)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ArchiveBefore archives the executions that finished before the cutoff, in batches, and
+// returns the number archived
+func ArchiveBefore(ctx context.Context, cutoff time.Time) (int, error) {
+	archived := 0
+	for ctx.Err() == nil {
+		var executions []models.WorkflowExecution
+		err := database.DB.Where("archived_at IS NULL AND status IN ? AND completed_at < ?", []string{"completed", "failed", "cancelled"}, cutoff).
+			Order("id").Limit(config.BatchSize).Find(&executions).Error
+		if err != nil {
+			return archived, err
+		}
+		for i := range executions {
+			if err := Archive(ctx, &executions[i]); err != nil {
+				return archived, fmt.Errorf("execution %d: %v", executions[i].ID, err)
+			}
+			archived++
+		}
+		if len(executions) < config.BatchSize {
+			break
+		}
+	}
+	return archived, nil
+}
+
+// Archive uploads the execution with its node executions and replaces them with a stub: the
+// execution keeps its status, timings and error, its payloads and node executions are removed
+func Archive(ctx context.Context, execution *models.WorkflowExecution) error {
+	if err := database.DB.Where("workflow_execution_id = ?", execution.ID).Order("id").
+		Find(&execution.NodeExecutions).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	document, err := encode(Document{ArchivedAt: now, Execution: *execution})
+	if err != nil {
+		return err
+	}
+	key := fmt.Sprintf("%s/%s/execution-%d.json.gz", config.Prefix, execution.CreatedAt.UTC().Format("2006/01"), execution.ID)
+	key = strings.TrimPrefix(key, "/")
+	if err := config.Bucket.Put(ctx, key, document, "application/gzip"); err != nil {
+		return err
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workflow_execution_id = ?", execution.ID).Delete(&models.NodeExecution{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(execution).Updates(map[string]interface{}{
+			"input_data":  "{}",
+			"output_data": "{}",
+			"archived_at": now,
+			"archive_key": key,
+		}).Error
+	})
+}
+
+// Rehydrate restores the payloads and node executions of an archived execution from the
+// archive, without writing them back to the database. Loaded executions are cached for a while,
+// as the object store is slow to access.
+func Rehydrate(ctx context.Context, execution *models.WorkflowExecution) error {
+	if execution.ArchivedAt == nil {
+		return nil
+	}
+
+	var document Document
+	cacheKey := fmt.Sprintf("archive:execution:%d", execution.ID)
+	if found, _ := cache.Get(ctx, cacheKey, &document); !found {
+		if config.Bucket.Name == "" {
+			return ErrNotConfigured
+		}
+		data, err := config.Bucket.Get(ctx, execution.ArchiveKey)
+		if err != nil {
+			return fmt.Errorf("failed to load archived execution %d: %v", execution.ID, err)
+		}
+		if document, err = decode(data); err != nil {
+			return fmt.Errorf("failed to read archived execution %d: %v", execution.ID, err)
+		}
+		cache.Set(ctx, cacheKey, document, rehydratedTTL)
+	}
+
+	execution.InputData = document.Execution.InputData
+	execution.OutputData = document.Execution.OutputData
+	execution.NodeExecutions = document.Execution.NodeExecutions
+	return nil
+}
+
+func encode(document Document) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(zw).Encode(document); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decode(data []byte) (Document, error) {
+	var document Document
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return document, err
+	}
+	raw, err := io.ReadAll(zr)
+	if err != nil {
+		return document, err
+	}
+	err = json.Unmarshal(raw, &document)
+	return document, err
+}
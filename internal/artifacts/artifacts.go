@@ -0,0 +1,119 @@
+// Package artifacts keeps the records of the artifacts of executions, the outputs nodes mark as
+// named files like reports or exports, and removes them with their blobs after their retention
+package artifacts
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/blob"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"gorm.io/gorm/clause"
+)
+
+// purgeBatchSize is the number of expired artifacts removed at a time
+const purgeBatchSize = 500
+
+// Config holds the settings of artifacts
+type Config struct {
+	// Retention is how long artifacts are kept, independent of the execution data
+	Retention time.Duration
+}
+
+var config = Config{Retention: 90 * 24 * time.Hour}
+
+// ConfigFromEnv reads the artifact retention from ARTIFACT_RETENTION (default 90 days)
+func ConfigFromEnv() Config {
+	cfg := Config{Retention: 90 * 24 * time.Hour}
+	if retention, err := time.ParseDuration(os.Getenv("ARTIFACT_RETENTION")); err == nil && retention > 0 {
+		cfg.Retention = retention
+	}
+	return cfg
+}
+
+// Configure sets the artifact settings
+func Configure(cfg Config) {
+	config = cfg
+}
+
+// Save records an artifact, expiring after the retention. A node execution run again after an
+// interruption replaces its artifacts of the same name.
+func Save(artifact *models.ExecutionArtifact) error {
+	artifact.ExpiresAt = time.Now().Add(config.Retention)
+	return database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "node_execution_id"}, {Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"blob_id", "file_name", "content_type", "size", "expires_at"}),
+	}).Create(artifact).Error
+}
+
+// PurgeExpired removes the expired artifacts and their blobs at the given interval until ctx is done
+func PurgeExpired(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for ctx.Err() == nil {
+			purged, err := purge(ctx)
+			if err != nil {
+				log.Printf("Failed to purge artifacts: %v", err)
+				break
+			}
+			if purged < purgeBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// purge removes the next batch of expired artifacts and returns their number. Blobs are only
+// deleted once no artifact references them anymore, e.g. a blob a node passed on to several
+// nodes keeping it as artifact.
+func purge(ctx context.Context) (int, error) {
+	var expired []models.ExecutionArtifact
+	if err := database.DB.Select("id", "blob_id").Where("expires_at < ?", time.Now()).
+		Order("id").Limit(purgeBatchSize).Find(&expired).Error; err != nil {
+		return 0, err
+	}
+	if len(expired) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]uint, len(expired))
+	blobIDs := make([]string, 0, len(expired))
+	for i, artifact := range expired {
+		ids[i] = artifact.ID
+		blobIDs = append(blobIDs, artifact.BlobID)
+	}
+	if err := database.DB.Where("id IN ?", ids).Delete(&models.ExecutionArtifact{}).Error; err != nil {
+		return 0, err
+	}
+
+	var referenced []string
+	if err := database.DB.Model(&models.ExecutionArtifact{}).Where("blob_id IN ?", blobIDs).
+		Distinct().Pluck("blob_id", &referenced).Error; err != nil {
+		return 0, err
+	}
+	keep := make(map[string]bool, len(referenced))
+	for _, id := range referenced {
+		keep[id] = true
+	}
+	for _, id := range blobIDs {
+		if keep[id] {
+			continue
+		}
+		keep[id] = true
+		if err := blob.Delete(ctx, id); err != nil {
+			log.Printf("Failed to delete blob %s of expired artifact: %v", id, err)
+		}
+	}
+	return len(expired), nil
+}
@@ -0,0 +1,263 @@
+// Package auth authenticates API requests and manages users, tokens and identity providers
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// Echo context keys holding the authenticated user and session
+const (
+	userContextKey    = "auth_user"
+	sessionContextKey = "auth_session"
+)
+
+// ErrInvalidToken is returned for unknown or expired tokens
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Config holds the authentication settings of the installation
+type Config struct {
+	// Required rejects unauthenticated API requests (except the login endpoints)
+	Required bool
+	// Secret signs short-lived values such as the OIDC state cookie
+	Secret []byte
+	// AccessTokenTTL is the lifetime of issued access tokens
+	AccessTokenTTL time.Duration
+	// RefreshTokenTTL is the lifetime of a session and its refresh tokens
+	RefreshTokenTTL time.Duration
+	// InternalAPIToken authenticates workers and other services calling the internal API
+	InternalAPIToken string
+}
+
+var config = Config{AccessTokenTTL: 15 * time.Minute, RefreshTokenTTL: 30 * 24 * time.Hour}
+
+// publicPathPrefixes are reachable without a user token even if authentication is required
+var publicPathPrefixes = []string{"/api/auth/"}
+
+// internalPathPrefix marks service-to-service endpoints authenticated with the internal API token
+const internalPathPrefix = "/api/internal/"
+
+// ConfigFromEnv reads the authentication settings from the environment
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Required:         os.Getenv("AUTH_REQUIRED") == "true",
+		Secret:           []byte(os.Getenv("AUTH_SECRET")),
+		AccessTokenTTL:   15 * time.Minute,
+		RefreshTokenTTL:  30 * 24 * time.Hour,
+		InternalAPIToken: os.Getenv("INTERNAL_API_TOKEN"),
+	}
+
+	if ttl, err := time.ParseDuration(os.Getenv("AUTH_ACCESS_TOKEN_TTL")); err == nil && ttl > 0 {
+		cfg.AccessTokenTTL = ttl
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("AUTH_REFRESH_TOKEN_TTL")); err == nil && ttl > 0 {
+		cfg.RefreshTokenTTL = ttl
+	}
+
+	return cfg
+}
+
+// Configure sets the authentication settings
+func Configure(cfg Config) {
+	config = cfg
+}
+
+// Middleware resolves the bearer token of a request into the current user.
+// Requests without a token are rejected if authentication is required.
+func Middleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		// Internal endpoints carry a service token instead of a user token
+		if strings.HasPrefix(c.Request().URL.Path, internalPathPrefix) {
+			return next(c)
+		}
+
+		token := bearerToken(c.Request())
+		if token == "" {
+			if config.Required && !isPublicPath(c.Request().URL.Path) {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+			}
+			return next(c)
+		}
+
+		user, session, err := Authenticate(token)
+		if err != nil {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid or expired token"})
+		}
+
+		c.Set(userContextKey, user)
+		c.Set(sessionContextKey, session)
+		return next(c)
+	}
+}
+
+// RequireUser rejects requests without an authenticated user
+func RequireUser(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if CurrentUser(c) == nil {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+		}
+		return next(c)
+	}
+}
+
+// RequireRole rejects requests of users without one of the given roles.
+// If authentication is not required, anonymous requests are let through.
+func RequireRole(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			user := CurrentUser(c)
+			if user == nil {
+				if config.Required {
+					return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+				}
+				return next(c)
+			}
+
+			for _, role := range roles {
+				if user.Role == role {
+					return next(c)
+				}
+			}
+
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Insufficient permissions"})
+		}
+	}
+}
+
+// CurrentUser returns the authenticated user of the request, or nil
+func CurrentUser(c echo.Context) *models.User {
+	user, _ := c.Get(userContextKey).(*models.User)
+	return user
+}
+
+// Authenticate returns the active user owning the access token and the token's session
+func Authenticate(token string) (*models.User, *models.Session, error) {
+	var authToken models.AuthToken
+	if err := database.DB.Preload("User").Preload("Session").Where("token_hash = ?", hashToken(token)).First(&authToken).Error; err != nil {
+		return nil, nil, ErrInvalidToken
+	}
+
+	now := time.Now()
+	if now.After(authToken.ExpiresAt) || !authToken.User.IsActive {
+		return nil, nil, ErrInvalidToken
+	}
+
+	session := &authToken.Session
+	if session.ID == 0 || session.RevokedAt != nil || now.After(session.ExpiresAt) {
+		return nil, nil, ErrInvalidToken
+	}
+
+	database.DB.Model(&authToken).Update("last_used_at", &now)
+
+	return &authToken.User, session, nil
+}
+
+// CurrentSession returns the session of the request's access token, or nil
+func CurrentSession(c echo.Context) *models.Session {
+	session, _ := c.Get(sessionContextKey).(*models.Session)
+	return session
+}
+
+// ProvisionUser finds the user of an external identity or creates it on first login
+// (just-in-time provisioning). Name and role are synchronized on every login. The first login of
+// an identity needs an email address verified by the provider; it is linked to an existing user
+// with that address only if an admin created the user for the provider. Logins with the address
+// of any other account, e.g. a local one, are refused.
+func ProvisionUser(provider, externalID, email string, emailVerified bool, name, role string) (*models.User, error) {
+	var user models.User
+	result := database.DB.Where("auth_provider = ? AND external_id = ?", provider, externalID).Limit(1).Find(&user)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+
+	if result.RowsAffected == 0 {
+		if email == "" || !emailVerified {
+			return nil, errors.New("the identity provider returned no verified email address")
+		}
+
+		// Link the account an admin created for the provider
+		result = database.DB.Where("email = ?", email).Limit(1).Find(&user)
+		if result.Error != nil {
+			return nil, result.Error
+		}
+		if result.RowsAffected > 0 && (user.AuthProvider != provider || user.ExternalID != "") {
+			return nil, fmt.Errorf("the email address belongs to another account, an admin has to set its auth provider to %s first", provider)
+		}
+	}
+
+	now := time.Now()
+	user.AuthProvider = provider
+	user.ExternalID = externalID
+	user.LastLoginAt = &now
+	if email != "" && emailVerified {
+		user.Email = email
+	}
+	if name != "" {
+		user.Name = name
+	}
+	if role != "" {
+		user.Role = role
+	}
+
+	if user.ID == 0 {
+		user.IsActive = true
+		if err := database.DB.Create(&user).Error; err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+
+	if !user.IsActive {
+		return nil, errors.New("user is deactivated")
+	}
+
+	if err := database.DB.Save(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// bearerToken extracts the token from the Authorization header
+func bearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	return ""
+}
+
+// isPublicPath reports whether the path is reachable without authentication
+func isPublicPath(path string) bool {
+	for _, prefix := range publicPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// randomToken returns a random hex encoded 256 bit token
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// hashToken returns the SHA-256 hash of a token as stored in the database
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"gorm.io/gorm/clause"
+)
+
+// IssueCalendarToken returns a new token for the calendar feed of a user, replacing the previous one
+func IssueCalendarToken(userID uint) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	calendarToken := models.CalendarToken{UserID: userID, TokenHash: hashToken(token)}
+	err = database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"token_hash": calendarToken.TokenHash, "created_at": time.Now(), "last_used_at": nil}),
+	}).Create(&calendarToken).Error
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RevokeCalendarToken stops the calendar feed of a user
+func RevokeCalendarToken(userID uint) error {
+	return database.DB.Where("user_id = ?", userID).Delete(&models.CalendarToken{}).Error
+}
+
+// AuthenticateCalendarToken returns the active user owning the calendar token
+func AuthenticateCalendarToken(token string) (*models.User, error) {
+	var calendarToken models.CalendarToken
+	if err := database.DB.Preload("User").Where("token_hash = ?", hashToken(token)).First(&calendarToken).Error; err != nil {
+		return nil, ErrInvalidToken
+	}
+	if !calendarToken.User.IsActive {
+		return nil, ErrInvalidToken
+	}
+
+	now := time.Now()
+	database.DB.Model(&calendarToken).Update("last_used_at", &now)
+
+	return &calendarToken.User, nil
+}
@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPConfig configures the LDAP / Active Directory auth provider
+type LDAPConfig struct {
+	URL                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	// BindDN and BindPassword identify the service account used to search users and groups
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter finds the user entry, %s is replaced with the escaped username
+	UserFilter string
+	// GroupBaseDN and GroupFilter find the user's groups, %s is replaced with the escaped user DN
+	GroupBaseDN string
+	GroupFilter string
+	// GroupAttribute reads groups from an attribute of the user entry instead (e.g. memberOf on AD)
+	GroupAttribute     string
+	GroupNameAttribute string
+	// Attribute mapping of the user entry
+	IDAttribute    string
+	EmailAttribute string
+	NameAttribute  string
+	RoleMapping    map[string]string
+	DefaultRole    string
+}
+
+// LDAPConfigFromEnv reads the LDAP settings from the environment
+func LDAPConfigFromEnv() (LDAPConfig, error) {
+	cfg := LDAPConfig{
+		URL:                os.Getenv("LDAP_URL"),
+		StartTLS:           os.Getenv("LDAP_START_TLS") == "true",
+		InsecureSkipVerify: os.Getenv("LDAP_INSECURE_SKIP_VERIFY") == "true",
+		BindDN:             os.Getenv("LDAP_BIND_DN"),
+		BindPassword:       os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:             os.Getenv("LDAP_BASE_DN"),
+		UserFilter:         envOrDefault("LDAP_USER_FILTER", "(uid=%s)"),
+		GroupBaseDN:        os.Getenv("LDAP_GROUP_BASE_DN"),
+		GroupFilter:        envOrDefault("LDAP_GROUP_FILTER", "(member=%s)"),
+		GroupAttribute:     os.Getenv("LDAP_GROUP_ATTRIBUTE"),
+		GroupNameAttribute: envOrDefault("LDAP_GROUP_NAME_ATTRIBUTE", "cn"),
+		IDAttribute:        envOrDefault("LDAP_ID_ATTRIBUTE", "dn"),
+		EmailAttribute:     envOrDefault("LDAP_EMAIL_ATTRIBUTE", "mail"),
+		NameAttribute:      envOrDefault("LDAP_NAME_ATTRIBUTE", "cn"),
+		RoleMapping:        ParseRoleMapping(os.Getenv("LDAP_ROLE_MAPPING")),
+		DefaultRole:        envOrDefault("LDAP_DEFAULT_ROLE", models.RoleViewer),
+	}
+
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return cfg, errors.New("LDAP_URL and LDAP_BASE_DN are required for the ldap auth provider")
+	}
+	if cfg.GroupBaseDN == "" {
+		cfg.GroupBaseDN = cfg.BaseDN
+	}
+
+	return cfg, nil
+}
+
+// LDAPProvider authenticates users with a bind against an LDAP directory
+type LDAPProvider struct {
+	config LDAPConfig
+}
+
+// NewLDAPProvider creates a new LDAPProvider
+func NewLDAPProvider(cfg LDAPConfig) *LDAPProvider {
+	return &LDAPProvider{config: cfg}
+}
+
+// Name returns "ldap"
+func (p *LDAPProvider) Name() string {
+	return "ldap"
+}
+
+// Login looks up the user with the service account, verifies the password by binding as the user,
+// resolves the user's groups and provisions the FlowCraft user
+func (p *LDAPProvider) Login(ctx context.Context, username, password string) (*models.User, error) {
+	conn, err := p.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if p.config.BindDN != "" {
+		if err := conn.Bind(p.config.BindDN, p.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap service bind failed: %v", err)
+		}
+	}
+
+	attributes := []string{p.config.EmailAttribute, p.config.NameAttribute}
+	if p.config.IDAttribute != "dn" {
+		attributes = append(attributes, p.config.IDAttribute)
+	}
+	if p.config.GroupAttribute != "" {
+		attributes = append(attributes, p.config.GroupAttribute)
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		p.config.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(p.config.UserFilter, ldap.EscapeFilter(username)),
+		attributes, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ldap user search failed: %v", err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	// Verify the password by binding as the user
+	if err := conn.Bind(entry.DN, password); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	// Search groups with the service account again
+	if p.config.BindDN != "" {
+		if err := conn.Bind(p.config.BindDN, p.config.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap service bind failed: %v", err)
+		}
+	}
+
+	groups, err := p.groups(conn, entry)
+	if err != nil {
+		return nil, err
+	}
+
+	externalID := entry.DN
+	if p.config.IDAttribute != "dn" {
+		externalID = entry.GetAttributeValue(p.config.IDAttribute)
+	}
+
+	// Email addresses in the directory are maintained by its administrators, not by the users
+	role := MapRole(groups, p.config.RoleMapping, p.config.DefaultRole)
+	return ProvisionUser("ldap", externalID, entry.GetAttributeValue(p.config.EmailAttribute), true, entry.GetAttributeValue(p.config.NameAttribute), role)
+}
+
+// connect opens a connection to the directory, upgrading it with StartTLS if configured
+func (p *LDAPProvider) connect() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: p.config.InsecureSkipVerify}
+
+	conn, err := ldap.DialURL(p.config.URL, ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("ldap connection failed: %v", err)
+	}
+
+	if p.config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls failed: %v", err)
+		}
+	}
+
+	return conn, nil
+}
+
+// groups returns the names of the groups the user is a member of
+func (p *LDAPProvider) groups(conn *ldap.Conn, entry *ldap.Entry) ([]string, error) {
+	var groups []string
+
+	if p.config.GroupAttribute != "" {
+		for _, groupDN := range entry.GetAttributeValues(p.config.GroupAttribute) {
+			groups = append(groups, groupName(groupDN, p.config.GroupNameAttribute))
+		}
+		return groups, nil
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		p.config.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(p.config.GroupFilter, ldap.EscapeFilter(entry.DN)),
+		[]string{p.config.GroupNameAttribute}, nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("ldap group search failed: %v", err)
+	}
+
+	for _, group := range result.Entries {
+		groups = append(groups, group.GetAttributeValue(p.config.GroupNameAttribute))
+	}
+	return groups, nil
+}
+
+// groupName extracts the value of the name attribute from a group DN, e.g. "admins" from "cn=admins,ou=groups,dc=example"
+func groupName(groupDN, nameAttribute string) string {
+	dn, err := ldap.ParseDN(groupDN)
+	if err != nil || len(dn.RDNs) == 0 {
+		return groupDN
+	}
+
+	for _, attribute := range dn.RDNs[0].Attributes {
+		if strings.EqualFold(attribute.Type, nameAttribute) {
+			return attribute.Value
+		}
+	}
+	return groupDN
+}
+
+// envOrDefault returns the environment variable or the fallback if it is unset
+func envOrDefault(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
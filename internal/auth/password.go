@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials is returned when a username/password combination is rejected
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// PasswordProvider authenticates users by username and password
+type PasswordProvider interface {
+	// Name identifies the provider, e.g. "local" or "ldap"
+	Name() string
+	// Login verifies the credentials and returns the (provisioned) user
+	Login(ctx context.Context, username, password string) (*models.User, error)
+}
+
+// PasswordProvidersFromEnv creates the password providers listed in AUTH_PROVIDERS (default "local"),
+// in the order they are tried
+func PasswordProvidersFromEnv() ([]PasswordProvider, error) {
+	names := os.Getenv("AUTH_PROVIDERS")
+	if names == "" {
+		names = "local"
+	}
+
+	var providers []PasswordProvider
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case "local":
+			providers = append(providers, &LocalProvider{})
+		case "ldap":
+			ldapConfig, err := LDAPConfigFromEnv()
+			if err != nil {
+				return nil, err
+			}
+			providers = append(providers, NewLDAPProvider(ldapConfig))
+		case "":
+		default:
+			return nil, errors.New("unknown auth provider: " + name)
+		}
+	}
+
+	return providers, nil
+}
+
+// LoginWithPassword tries the providers in order and returns the first user accepted.
+// If provider is not empty, only the provider with that name is used.
+func LoginWithPassword(ctx context.Context, providers []PasswordProvider, provider, username, password string) (*models.User, error) {
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	var lastErr error = ErrInvalidCredentials
+	for _, p := range providers {
+		if provider != "" && p.Name() != provider {
+			continue
+		}
+
+		user, err := p.Login(ctx, username, password)
+		if err == nil {
+			return user, nil
+		}
+		lastErr = err
+	}
+
+	return nil, lastErr
+}
+
+// LocalProvider authenticates users against password hashes stored in the database
+type LocalProvider struct{}
+
+// Name returns "local"
+func (p *LocalProvider) Name() string {
+	return "local"
+}
+
+// Login verifies the password of a local user identified by email address
+func (p *LocalProvider) Login(ctx context.Context, username, password string) (*models.User, error) {
+	var user models.User
+	if err := database.DB.Where("email = ? AND auth_provider = ?", username, "local").First(&user).Error; err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	if !user.IsActive || user.PasswordHash == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	now := time.Now()
+	user.LastLoginAt = &now
+	database.DB.Model(&user).Update("last_login_at", &now)
+
+	return &user, nil
+}
+
+// HashPassword returns the bcrypt hash of a password for local users
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
@@ -0,0 +1,230 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again.
+// The session is revoked because the token has most likely been stolen.
+var ErrRefreshTokenReused = errors.New("refresh token reuse detected, session revoked")
+
+// TokenPair is the result of a login or a token refresh
+type TokenPair struct {
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	SessionID             uint      `json:"session_id"`
+}
+
+// Introspection describes an access token (modelled after RFC 7662)
+type Introspection struct {
+	Active    bool   `json:"active"`
+	UserID    uint   `json:"user_id,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Role      string `json:"role,omitempty"`
+	SessionID uint   `json:"session_id,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// StartSession creates a session for a freshly logged in user and issues its first token pair
+func StartSession(user *models.User, userAgent, ipAddress string) (*TokenPair, error) {
+	session := models.Session{
+		UserID:    user.ID,
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+		ExpiresAt: time.Now().Add(config.RefreshTokenTTL),
+	}
+
+	var pair *TokenPair
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		pair, err = issueTokenPair(tx, user.ID, session)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Drop expired tokens of the user
+	database.DB.Where("user_id = ? AND expires_at < ?", user.ID, time.Now()).Delete(&models.AuthToken{})
+
+	return pair, nil
+}
+
+// Refresh exchanges a refresh token for a new token pair. Each refresh token can be used only once;
+// presenting a used token revokes the whole session.
+func Refresh(refreshToken string) (*TokenPair, error) {
+	var pair *TokenPair
+	var reused bool
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var token models.RefreshToken
+		if err := tx.Preload("Session").Where("token_hash = ?", hashToken(refreshToken)).First(&token).Error; err != nil {
+			return ErrInvalidToken
+		}
+
+		now := time.Now()
+		session := token.Session
+		if session.RevokedAt != nil || now.After(session.ExpiresAt) || now.After(token.ExpiresAt) {
+			return ErrInvalidToken
+		}
+
+		if token.UsedAt != nil {
+			reused = true
+			return ErrRefreshTokenReused
+		}
+
+		// Mark the token as used; the condition guards against concurrent refreshes
+		result := tx.Model(&models.RefreshToken{}).Where("id = ? AND used_at IS NULL", token.ID).Update("used_at", &now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			reused = true
+			return ErrRefreshTokenReused
+		}
+
+		var user models.User
+		if err := tx.First(&user, session.UserID).Error; err != nil || !user.IsActive {
+			return ErrInvalidToken
+		}
+
+		tx.Model(&session).Update("last_used_at", &now)
+
+		var err error
+		pair, err = issueTokenPair(tx, user.ID, session)
+		return err
+	})
+
+	if reused {
+		var token models.RefreshToken
+		if database.DB.Where("token_hash = ?", hashToken(refreshToken)).First(&token).Error == nil {
+			RevokeSession(token.SessionID)
+		}
+	}
+
+	return pair, err
+}
+
+// RevokeSession invalidates a session together with all of its access and refresh tokens
+func RevokeSession(sessionID uint) error {
+	now := time.Now()
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Session{}).Where("id = ? AND revoked_at IS NULL", sessionID).Update("revoked_at", &now).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("session_id = ?", sessionID).Delete(&models.AuthToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("session_id = ?", sessionID).Delete(&models.RefreshToken{}).Error
+	})
+}
+
+// RevokeUserSessions invalidates all sessions of a user (logout everywhere)
+func RevokeUserSessions(userID uint) error {
+	var sessionIDs []uint
+	if err := database.DB.Model(&models.Session{}).Where("user_id = ? AND revoked_at IS NULL", userID).Pluck("id", &sessionIDs).Error; err != nil {
+		return err
+	}
+
+	for _, sessionID := range sessionIDs {
+		if err := RevokeSession(sessionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ActiveSessions returns the sessions of a user that are neither revoked nor expired
+func ActiveSessions(userID uint) ([]models.Session, error) {
+	var sessions []models.Session
+	err := database.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("created_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+// Introspect describes an access token. Unknown, expired or revoked tokens are reported as inactive.
+func Introspect(token string) Introspection {
+	user, session, err := Authenticate(token)
+	if err != nil {
+		return Introspection{Active: false}
+	}
+
+	var authToken models.AuthToken
+	database.DB.Where("token_hash = ?", hashToken(token)).First(&authToken)
+
+	return Introspection{
+		Active:    true,
+		UserID:    user.ID,
+		Email:     user.Email,
+		Role:      user.Role,
+		SessionID: session.ID,
+		ExpiresAt: authToken.ExpiresAt.Unix(),
+	}
+}
+
+// RequireServiceToken protects internal endpoints called by workers and other services
+func RequireServiceToken(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		token := bearerToken(c.Request())
+		if config.InternalAPIToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(config.InternalAPIToken)) != 1 {
+			return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid service token"})
+		}
+		return next(c)
+	}
+}
+
+// issueTokenPair creates a new access token and refresh token for the session
+func issueTokenPair(tx *gorm.DB, userID uint, session models.Session) (*TokenPair, error) {
+	accessToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	accessExpiresAt := time.Now().Add(config.AccessTokenTTL)
+	if accessExpiresAt.After(session.ExpiresAt) {
+		accessExpiresAt = session.ExpiresAt
+	}
+
+	if err := tx.Create(&models.AuthToken{
+		UserID:    userID,
+		SessionID: session.ID,
+		TokenHash: hashToken(accessToken),
+		ExpiresAt: accessExpiresAt,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	if err := tx.Create(&models.RefreshToken{
+		SessionID: session.ID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: session.ExpiresAt,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessExpiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: session.ExpiresAt,
+		SessionID:             session.ID,
+	}, nil
+}
@@ -0,0 +1,227 @@
+// Package blob stores binary payloads (files, archives, reports) outside of the execution data.
+// Nodes pass them on as references instead of inlining the bytes into their output.
+package blob
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/s3"
+)
+
+// ErrNotConfigured is returned if no blob store is configured
+var ErrNotConfigured = errors.New("blob store is not configured")
+
+// ErrNotFound is returned for unknown blobs
+var ErrNotFound = errors.New("blob not found")
+
+// idPattern matches the IDs generated for blobs
+var idPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// Ref references a stored blob in node inputs and outputs
+type Ref struct {
+	ID          string `json:"blob_id"`
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+// Map returns the reference as a node output value
+func (r Ref) Map() map[string]interface{} {
+	return map[string]interface{}{
+		"blob_id":      r.ID,
+		"name":         r.Name,
+		"content_type": r.ContentType,
+		"size":         r.Size,
+	}
+}
+
+// RefFromValue reads a reference from a node input value
+func RefFromValue(value interface{}) (Ref, bool) {
+	m, ok := value.(map[string]interface{})
+	if !ok {
+		return Ref{}, false
+	}
+	id, _ := m["blob_id"].(string)
+	if !idPattern.MatchString(id) {
+		return Ref{}, false
+	}
+
+	ref := Ref{ID: id}
+	ref.Name, _ = m["name"].(string)
+	ref.ContentType, _ = m["content_type"].(string)
+	if size, ok := m["size"].(float64); ok {
+		ref.Size = int64(size)
+	} else if size, ok := m["size"].(int64); ok {
+		ref.Size = size
+	}
+	return ref, true
+}
+
+// Store keeps the contents of blobs
+type Store interface {
+	Put(ctx context.Context, id string, r io.Reader) (int64, error)
+	Open(ctx context.Context, id string) (io.ReadCloser, error)
+	Delete(ctx context.Context, id string) error
+}
+
+var store Store
+
+// Configure sets the store blobs are kept in
+func Configure(s Store) {
+	store = s
+}
+
+// DirFromEnv returns the directory of the file blob store (BLOB_STORE_DIR, default data/blobs)
+func DirFromEnv() string {
+	if dir := os.Getenv("BLOB_STORE_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join("data", "blobs")
+}
+
+// Config selects the store blobs are kept in: a bucket if one is set, otherwise a directory
+type Config struct {
+	Dir    string
+	Bucket s3.Bucket
+	// Prefix of the keys of blobs in the bucket
+	Prefix string
+}
+
+// ConfigFromEnv reads the blob store configuration from BLOB_STORE_BUCKET, BLOB_STORE_PREFIX
+// (default "flowcraft/blobs"), BLOB_STORE_REGION, BLOB_STORE_ENDPOINT and BLOB_STORE_DIR
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Dir: DirFromEnv(),
+		Bucket: s3.Bucket{
+			Name:     os.Getenv("BLOB_STORE_BUCKET"),
+			Region:   os.Getenv("BLOB_STORE_REGION"),
+			Endpoint: os.Getenv("BLOB_STORE_ENDPOINT"),
+		},
+		Prefix: "flowcraft/blobs",
+	}
+	if prefix, ok := os.LookupEnv("BLOB_STORE_PREFIX"); ok {
+		cfg.Prefix = strings.Trim(prefix, "/")
+	}
+	return cfg
+}
+
+// NewStore creates the store of the configuration
+func NewStore(cfg Config) (Store, error) {
+	if cfg.Bucket.Name != "" {
+		return &S3Store{Bucket: cfg.Bucket, Prefix: cfg.Prefix}, nil
+	}
+	return NewFileStore(cfg.Dir)
+}
+
+// Save stores the contents read from r as a new blob
+func Save(ctx context.Context, name, contentType string, r io.Reader) (Ref, error) {
+	if store == nil {
+		return Ref{}, ErrNotConfigured
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Ref{}, err
+	}
+	ref := Ref{ID: hex.EncodeToString(id), Name: name, ContentType: contentType}
+	if ref.ContentType == "" {
+		ref.ContentType = "application/octet-stream"
+	}
+
+	size, err := store.Put(ctx, ref.ID, r)
+	if err != nil {
+		return Ref{}, fmt.Errorf("failed to store blob: %v", err)
+	}
+	ref.Size = size
+	return ref, nil
+}
+
+// Open opens the contents of a blob
+func Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	if store == nil {
+		return nil, ErrNotConfigured
+	}
+	if !idPattern.MatchString(id) {
+		return nil, ErrNotFound
+	}
+	return store.Open(ctx, id)
+}
+
+// Delete removes a blob
+func Delete(ctx context.Context, id string) error {
+	if store == nil {
+		return ErrNotConfigured
+	}
+	if !idPattern.MatchString(id) {
+		return ErrNotFound
+	}
+	return store.Delete(ctx, id)
+}
+
+// FileStore keeps blobs as files in a directory shared by the API server and the workers
+type FileStore struct {
+	Dir string
+}
+
+// NewFileStore creates a file store, creating its directory if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+// path spreads blobs over subdirectories by the first characters of their ID
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.Dir, id[:2], id)
+}
+
+func (s *FileStore) Put(ctx context.Context, id string, r io.Reader) (int64, error) {
+	path := s.path(id)
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return 0, err
+	}
+
+	// Write to a temporary file first so readers never see partial blobs
+	tmp, err := os.CreateTemp(filepath.Dir(path), id+".tmp*")
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return 0, err
+	}
+	return size, nil
+}
+
+func (s *FileStore) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	f, err := os.Open(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+func (s *FileStore) Delete(ctx context.Context, id string) error {
+	err := os.Remove(s.path(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
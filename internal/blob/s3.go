@@ -0,0 +1,52 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/altipard/flowcraft/internal/s3"
+)
+
+// S3Store keeps blobs in a bucket of an S3 compatible object store, so that API servers and
+// workers on different hosts share them without a shared directory
+type S3Store struct {
+	Bucket s3.Bucket
+	// Prefix of the keys of blobs
+	Prefix string
+}
+
+// key returns the key of a blob in the bucket
+func (s *S3Store) key(id string) string {
+	if s.Prefix == "" {
+		return id
+	}
+	return s.Prefix + "/" + id
+}
+
+func (s *S3Store) Put(ctx context.Context, id string, r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if err := s.Bucket.Put(ctx, s.key(id), data, "application/octet-stream"); err != nil {
+		return 0, err
+	}
+	return int64(len(data)), nil
+}
+
+func (s *S3Store) Open(ctx context.Context, id string) (io.ReadCloser, error) {
+	data, err := s.Bucket.Get(ctx, s.key(id))
+	if errors.Is(err, s3.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, id string) error {
+	return s.Bucket.Delete(ctx, s.key(id))
+}
@@ -0,0 +1,344 @@
+// Package bpmn converts between FlowCraft workflows and a subset of BPMN 2.0 XML: tasks,
+// exclusive and parallel gateways, sequence flows, start and end events and text annotations,
+// with diagram information for the positions
+package bpmn
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// Namespaces of BPMN 2.0 and of the FlowCraft extensions
+const (
+	namespaceModel     = "http://www.omg.org/spec/BPMN/20100524/MODEL"
+	namespaceDI        = "http://www.omg.org/spec/BPMN/20100524/DI"
+	namespaceDC        = "http://www.omg.org/spec/DD/20100524/DC"
+	namespaceDDI       = "http://www.omg.org/spec/DD/20100524/DI"
+	namespaceFlowCraft = "https://flowcraft.dev/schema/bpmn"
+)
+
+// Sizes of the shapes in the diagram
+const (
+	taskWidth, taskHeight       = 100.0, 80.0
+	gatewaySize                 = 50.0
+	eventSize                   = 36.0
+	shapeSpacing                = 150.0
+	annotationWidth, annotation = 200.0, 60.0
+)
+
+// userTaskClasses are the executor classes waiting for people, exported as user tasks
+var userTaskClasses = map[string]bool{"approval": true, "humanTask": true}
+
+type definitions struct {
+	XMLName         xml.Name `xml:"definitions"`
+	Xmlns           string   `xml:"xmlns,attr"`
+	XmlnsBPMNDI     string   `xml:"xmlns:bpmndi,attr"`
+	XmlnsDC         string   `xml:"xmlns:dc,attr"`
+	XmlnsDI         string   `xml:"xmlns:di,attr"`
+	XmlnsFlowCraft  string   `xml:"xmlns:flowcraft,attr"`
+	ID              string   `xml:"id,attr"`
+	TargetNamespace string   `xml:"targetNamespace,attr"`
+	Exporter        string   `xml:"exporter,attr"`
+	Process         process  `xml:"process"`
+	Diagram         diagram  `xml:"bpmndi:BPMNDiagram"`
+}
+
+type process struct {
+	ID                string           `xml:"id,attr"`
+	Name              string           `xml:"name,attr"`
+	IsExecutable      bool             `xml:"isExecutable,attr"`
+	StartEvents       []element        `xml:"startEvent"`
+	ServiceTasks      []task           `xml:"serviceTask"`
+	UserTasks         []task           `xml:"userTask"`
+	ExclusiveGateways []element        `xml:"exclusiveGateway"`
+	EndEvents         []element        `xml:"endEvent"`
+	Flows             []sequenceFlow   `xml:"sequenceFlow"`
+	TextAnnotations   []textAnnotation `xml:"textAnnotation"`
+}
+
+type element struct {
+	ID       string   `xml:"id,attr"`
+	Name     string   `xml:"name,attr,omitempty"`
+	Incoming []string `xml:"incoming"`
+	Outgoing []string `xml:"outgoing"`
+}
+
+type task struct {
+	ID         string      `xml:"id,attr"`
+	Name       string      `xml:"name,attr,omitempty"`
+	NodeType   string      `xml:"flowcraft:nodeType,attr,omitempty"`
+	Extensions *extensions `xml:"extensionElements"`
+	Incoming   []string    `xml:"incoming"`
+	Outgoing   []string    `xml:"outgoing"`
+}
+
+type extensions struct {
+	Config cdata `xml:"flowcraft:config"`
+}
+
+type cdata struct {
+	Value string `xml:",cdata"`
+}
+
+type sequenceFlow struct {
+	ID        string `xml:"id,attr"`
+	Name      string `xml:"name,attr,omitempty"`
+	SourceRef string `xml:"sourceRef,attr"`
+	TargetRef string `xml:"targetRef,attr"`
+	// TargetHandle is the input handle of the FlowCraft connection, if not the default
+	TargetHandle string               `xml:"flowcraft:targetHandle,attr,omitempty"`
+	Condition    *conditionExpression `xml:"conditionExpression"`
+}
+
+type conditionExpression struct {
+	Type  string `xml:"xsi:type,attr"`
+	Xmlns string `xml:"xmlns:xsi,attr"`
+	Value string `xml:",chardata"`
+}
+
+type textAnnotation struct {
+	ID   string `xml:"id,attr"`
+	Text string `xml:"text"`
+}
+
+type diagram struct {
+	ID    string `xml:"id,attr"`
+	Plane plane  `xml:"bpmndi:BPMNPlane"`
+}
+
+type plane struct {
+	ID          string  `xml:"id,attr"`
+	BPMNElement string  `xml:"bpmnElement,attr"`
+	Shapes      []shape `xml:"bpmndi:BPMNShape"`
+	Edges       []edge  `xml:"bpmndi:BPMNEdge"`
+}
+
+type shape struct {
+	ID          string `xml:"id,attr"`
+	BPMNElement string `xml:"bpmnElement,attr"`
+	Bounds      bounds `xml:"dc:Bounds"`
+}
+
+type bounds struct {
+	X      float64 `xml:"x,attr"`
+	Y      float64 `xml:"y,attr"`
+	Width  float64 `xml:"width,attr"`
+	Height float64 `xml:"height,attr"`
+}
+
+type edge struct {
+	ID          string     `xml:"id,attr"`
+	BPMNElement string     `xml:"bpmnElement,attr"`
+	Waypoints   []waypoint `xml:"di:waypoint"`
+}
+
+type waypoint struct {
+	X float64 `xml:"x,attr"`
+	Y float64 `xml:"y,attr"`
+}
+
+// exporter builds the process and diagram of a workflow
+type exporter struct {
+	process process
+	shapes  map[string]bounds
+	plane   plane
+	// elements indexes the incoming and outgoing flows to add to the elements by ID
+	incoming map[string][]string
+	outgoing map[string][]string
+}
+
+// Export converts a workflow with its nodes and connections into BPMN 2.0 XML. Nodes become
+// service tasks (user tasks for approvals and human tasks) carrying their node type and
+// configuration, nodes taking a single output handle are followed by an exclusive gateway, and
+// sticky notes become text annotations.
+func Export(workflow models.Workflow, executorClasses map[string]string) ([]byte, error) {
+	e := &exporter{
+		process: process{
+			ID:           fmt.Sprintf("Process_%d", workflow.ID),
+			Name:         workflow.Name,
+			IsExecutable: true,
+		},
+		shapes:   map[string]bounds{},
+		incoming: map[string][]string{},
+		outgoing: map[string][]string{},
+	}
+
+	nodes := append([]models.Node(nil), workflow.Nodes...)
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	connections := append([]models.Connection(nil), workflow.Connections...)
+	sort.Slice(connections, func(i, j int) bool { return connections[i].ID < connections[j].ID })
+
+	hasIncoming := map[uint]bool{}
+	outgoing := map[uint][]models.Connection{}
+	for _, conn := range connections {
+		hasIncoming[conn.TargetNodeID] = true
+		outgoing[conn.SourceNodeID] = append(outgoing[conn.SourceNodeID], conn)
+	}
+
+	minX := 0.0
+	for i, node := range nodes {
+		if i == 0 || node.PositionX < minX {
+			minX = node.PositionX
+		}
+	}
+
+	start := "StartEvent_1"
+	startY := 0.0
+	e.process.StartEvents = append(e.process.StartEvents, element{ID: start})
+
+	flow := 0
+	addFlow := func(source, target, name, targetHandle string) {
+		flow++
+		f := sequenceFlow{ID: fmt.Sprintf("Flow_%d", flow), Name: name, SourceRef: source, TargetRef: target}
+		if targetHandle != "" && targetHandle != "input" {
+			f.TargetHandle = targetHandle
+		}
+		if name != "" {
+			f.Condition = &conditionExpression{
+				Type:  "tFormalExpression",
+				Xmlns: "http://www.w3.org/2001/XMLSchema-instance",
+				Value: fmt.Sprintf("handle == %q", name),
+			}
+		}
+		e.process.Flows = append(e.process.Flows, f)
+		e.outgoing[source] = append(e.outgoing[source], f.ID)
+		e.incoming[target] = append(e.incoming[target], f.ID)
+	}
+
+	for _, node := range nodes {
+		id := nodeElementID(node.ID)
+		if node.IsAnnotation() {
+			var config map[string]interface{}
+			json.Unmarshal([]byte(node.Config), &config)
+			text, _ := config["content"].(string)
+			e.process.TextAnnotations = append(e.process.TextAnnotations, textAnnotation{ID: fmt.Sprintf("TextAnnotation_%d", node.ID), Text: text})
+			e.shapes[fmt.Sprintf("TextAnnotation_%d", node.ID)] = bounds{node.PositionX, node.PositionY, annotationWidth, annotation}
+			continue
+		}
+
+		t := task{ID: id, Name: node.Name, NodeType: node.NodeType}
+		if node.Config != "" && node.Config != "{}" {
+			t.Extensions = &extensions{Config: cdata{node.Config}}
+		}
+		if userTaskClasses[executorClasses[node.NodeType]] {
+			e.process.UserTasks = append(e.process.UserTasks, t)
+		} else {
+			e.process.ServiceTasks = append(e.process.ServiceTasks, t)
+		}
+		e.shapes[id] = bounds{node.PositionX, node.PositionY, taskWidth, taskHeight}
+
+		if !hasIncoming[node.ID] {
+			addFlow(start, id, "", "")
+			startY = node.PositionY
+		}
+
+		conns := outgoing[node.ID]
+		if len(conns) == 0 {
+			end := fmt.Sprintf("EndEvent_%d", node.ID)
+			e.process.EndEvents = append(e.process.EndEvents, element{ID: end})
+			e.shapes[end] = bounds{node.PositionX + shapeSpacing, node.PositionY + (taskHeight-eventSize)/2, eventSize, eventSize}
+			addFlow(id, end, "", "")
+			continue
+		}
+
+		// Nodes taking one of their output handles decide like exclusive gateways
+		if branching(conns) {
+			gateway := fmt.Sprintf("Gateway_%d", node.ID)
+			e.process.ExclusiveGateways = append(e.process.ExclusiveGateways, element{ID: gateway})
+			e.shapes[gateway] = bounds{node.PositionX + shapeSpacing, node.PositionY + (taskHeight-gatewaySize)/2, gatewaySize, gatewaySize}
+			addFlow(id, gateway, "", "")
+			for _, conn := range conns {
+				addFlow(gateway, nodeElementID(conn.TargetNodeID), conn.SourceHandle, conn.TargetHandle)
+			}
+			continue
+		}
+		for _, conn := range conns {
+			addFlow(id, nodeElementID(conn.TargetNodeID), "", conn.TargetHandle)
+		}
+	}
+	e.shapes[start] = bounds{minX - shapeSpacing, startY + (taskHeight-eventSize)/2, eventSize, eventSize}
+
+	e.link()
+	e.diagram()
+
+	doc := definitions{
+		Xmlns:           namespaceModel,
+		XmlnsBPMNDI:     namespaceDI,
+		XmlnsDC:         namespaceDC,
+		XmlnsDI:         namespaceDDI,
+		XmlnsFlowCraft:  namespaceFlowCraft,
+		ID:              "Definitions_1",
+		TargetNamespace: namespaceFlowCraft,
+		Exporter:        "FlowCraft",
+		Process:         e.process,
+		Diagram:         diagram{ID: "BPMNDiagram_1", Plane: e.plane},
+	}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// branching reports whether the connections leave from specific output handles of the node
+func branching(conns []models.Connection) bool {
+	for _, conn := range conns {
+		if conn.SourceHandle != "" && conn.SourceHandle != "output" {
+			return true
+		}
+	}
+	return false
+}
+
+// link sets the incoming and outgoing flows of the elements
+func (e *exporter) link() {
+	for i := range e.process.StartEvents {
+		e.process.StartEvents[i].Outgoing = e.outgoing[e.process.StartEvents[i].ID]
+	}
+	for i := range e.process.EndEvents {
+		e.process.EndEvents[i].Incoming = e.incoming[e.process.EndEvents[i].ID]
+	}
+	for i := range e.process.ExclusiveGateways {
+		g := &e.process.ExclusiveGateways[i]
+		g.Incoming, g.Outgoing = e.incoming[g.ID], e.outgoing[g.ID]
+	}
+	for _, tasks := range [][]task{e.process.ServiceTasks, e.process.UserTasks} {
+		for i := range tasks {
+			tasks[i].Incoming, tasks[i].Outgoing = e.incoming[tasks[i].ID], e.outgoing[tasks[i].ID]
+		}
+	}
+}
+
+// diagram adds the shapes of the elements and straight edges between them
+func (e *exporter) diagram() {
+	e.plane = plane{ID: "BPMNPlane_1", BPMNElement: e.process.ID}
+
+	ids := make([]string, 0, len(e.shapes))
+	for id := range e.shapes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		e.plane.Shapes = append(e.plane.Shapes, shape{ID: id + "_di", BPMNElement: id, Bounds: e.shapes[id]})
+	}
+
+	for _, f := range e.process.Flows {
+		source, target := e.shapes[f.SourceRef], e.shapes[f.TargetRef]
+		e.plane.Edges = append(e.plane.Edges, edge{
+			ID:          f.ID + "_di",
+			BPMNElement: f.ID,
+			Waypoints: []waypoint{
+				{source.X + source.Width, source.Y + source.Height/2},
+				{target.X, target.Y + target.Height/2},
+			},
+		})
+	}
+}
+
+func nodeElementID(nodeID uint) string {
+	return fmt.Sprintf("Node_%d", nodeID)
+}
@@ -0,0 +1,285 @@
+package bpmn
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// importSpacing is the distance of imported elements on the canvas without diagram information
+const importSpacing = 250
+
+// handleConditionPattern matches the conditions of exported flows, e.g. handle == "approved"
+var handleConditionPattern = regexp.MustCompile(`^\s*handle\s*==\s*"([^"]+)"\s*$`)
+
+// Element kinds of imported BPMN documents
+var (
+	taskElements = map[string]bool{
+		"task": true, "serviceTask": true, "userTask": true, "scriptTask": true, "sendTask": true,
+		"receiveTask": true, "manualTask": true, "businessRuleTask": true,
+	}
+	gatewayElements = map[string]bool{
+		"exclusiveGateway": true, "parallelGateway": true, "inclusiveGateway": true,
+		"eventBasedGateway": true, "complexGateway": true,
+	}
+	// unsupportedElements become sticky notes, other elements (lanes, data objects,
+	// associations) are ignored
+	unsupportedElements = map[string]bool{
+		"subProcess": true, "callActivity": true, "transaction": true, "adHocSubProcess": true,
+		"intermediateCatchEvent": true, "intermediateThrowEvent": true, "boundaryEvent": true,
+	}
+)
+
+type inDefinitions struct {
+	Processes []inProcess `xml:"process"`
+	Shapes    []inShape   `xml:"BPMNDiagram>BPMNPlane>BPMNShape"`
+}
+
+type inProcess struct {
+	ID       string      `xml:"id,attr"`
+	Name     string      `xml:"name,attr"`
+	Elements []inElement `xml:",any"`
+}
+
+type inElement struct {
+	XMLName      xml.Name
+	ID           string `xml:"id,attr"`
+	Name         string `xml:"name,attr"`
+	NodeType     string `xml:"nodeType,attr"`
+	SourceRef    string `xml:"sourceRef,attr"`
+	TargetRef    string `xml:"targetRef,attr"`
+	TargetHandle string `xml:"targetHandle,attr"`
+	Config       string `xml:"extensionElements>config"`
+	Condition    string `xml:"conditionExpression"`
+	Text         string `xml:"text"`
+}
+
+type inShape struct {
+	BPMNElement string `xml:"bpmnElement,attr"`
+	Bounds      struct {
+		X float64 `xml:"x,attr"`
+		Y float64 `xml:"y,attr"`
+	} `xml:"Bounds"`
+}
+
+// importer collects the nodes and connections converted from a process
+type importer struct {
+	result   *models.ImportResult
+	elements map[string]inElement
+	outgoing map[string][]inElement
+	incoming map[string]int
+	nodes    map[string]uint // node IDs by element ID
+}
+
+// Import converts the first process of a BPMN 2.0 document into a workflow with nodes and
+// connections, which are not stored yet. Nodes have temporary IDs (1, 2, ...) referenced by the
+// connections. Tasks exported by FlowCraft keep their node type and configuration; other tasks
+// become disabled placeholders to complete by hand.
+func Import(data []byte) (*models.ImportResult, error) {
+	var doc inDefinitions
+	if err := xml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid BPMN document: %v", err)
+	}
+	var proc *inProcess
+	for i := range doc.Processes {
+		if len(doc.Processes[i].Elements) > 0 {
+			proc = &doc.Processes[i]
+			break
+		}
+	}
+	if proc == nil {
+		return nil, fmt.Errorf("invalid BPMN document: no process with elements")
+	}
+
+	name := proc.Name
+	if name == "" {
+		name = "Imported process"
+	}
+	im := &importer{
+		result: &models.ImportResult{
+			Workflow: models.Workflow{Name: name, Nodes: []models.Node{}, Connections: []models.Connection{}},
+			Warnings: []models.ImportWarning{},
+		},
+		elements: map[string]inElement{},
+		outgoing: map[string][]inElement{},
+		incoming: map[string]int{},
+		nodes:    map[string]uint{},
+	}
+	if len(doc.Processes) > 1 {
+		im.warn(name, "process", "The document contains %d processes, only the first with elements was imported", len(doc.Processes))
+	}
+
+	positions := make(map[string][2]float64, len(doc.Shapes))
+	for _, s := range doc.Shapes {
+		positions[s.BPMNElement] = [2]float64{s.Bounds.X, s.Bounds.Y}
+	}
+	position := func(id string) (float64, float64) {
+		if p, ok := positions[id]; ok {
+			return p[0], p[1]
+		}
+		return float64(len(im.result.Workflow.Nodes)) * importSpacing, 0
+	}
+
+	for _, el := range proc.Elements {
+		if el.XMLName.Local == "sequenceFlow" {
+			im.outgoing[el.SourceRef] = append(im.outgoing[el.SourceRef], el)
+			im.incoming[el.TargetRef]++
+			continue
+		}
+		im.elements[el.ID] = el
+	}
+
+	for _, el := range proc.Elements {
+		kind := el.XMLName.Local
+		label := el.Name
+		if label == "" {
+			label = el.ID
+		}
+		x, y := position(el.ID)
+
+		switch {
+		case taskElements[kind]:
+			im.nodes[el.ID] = im.addNode(im.task(el, label), x, y)
+		case kind == "textAnnotation":
+			im.addNode(models.Node{
+				NodeType: models.NodeTypeAnnotation,
+				Name:     label,
+				Config:   configJSON(map[string]interface{}{"content": strings.TrimSpace(el.Text), "color": "yellow"}),
+			}, x, y)
+		case kind == "eventBasedGateway" || kind == "complexGateway":
+			im.warn(label, kind, "Imported as a parallel gateway, the outgoing flows are all taken")
+		case unsupportedElements[kind]:
+			im.warn(label, kind, "There is no FlowCraft equivalent for this element")
+			im.addNode(models.Node{
+				NodeType: models.NodeTypeAnnotation,
+				Name:     label,
+				Config: configJSON(map[string]interface{}{
+					"content": fmt.Sprintf("**%s** (`%s`) could not be imported, it is not connected to the other nodes.", label, kind),
+					"color":   "pink",
+				}),
+			}, x, y)
+		}
+	}
+
+	for _, el := range proc.Elements {
+		if source, ok := im.nodes[el.ID]; ok {
+			im.connect(source, el.ID, "", map[string]bool{})
+		}
+	}
+	return im.result, nil
+}
+
+// task converts a task element into a node
+func (im *importer) task(el inElement, label string) models.Node {
+	node := models.Node{NodeType: el.NodeType, Name: label, Config: "{}"}
+	if config := strings.TrimSpace(el.Config); config != "" {
+		if json.Valid([]byte(config)) {
+			node.Config = config
+		} else {
+			im.warn(label, el.XMLName.Local, "The FlowCraft configuration is not valid JSON and was dropped")
+		}
+	}
+	if node.NodeType != "" {
+		return node
+	}
+
+	// Tasks of other BPM tools have no FlowCraft equivalent, user tasks wait for a person
+	if el.XMLName.Local == "userTask" {
+		node.NodeType = "humanTask"
+		node.Config = configJSON(map[string]interface{}{"title": label})
+		im.warn(label, el.XMLName.Local, "Imported as a human task, set the assignees")
+		return node
+	}
+	node.NodeType = "transform"
+	node.Config = configJSON(map[string]interface{}{"mapping": map[string]interface{}{}})
+	node.Disabled = true
+	node.DisabledMode = models.DisabledPassthrough
+	im.warn(label, el.XMLName.Local, "Imported as a disabled placeholder, replace it with a node doing the work of the task")
+	return node
+}
+
+// connect connects a node to the nodes its element leads to, following the sequence flows
+// through gateways. The flows leaving an exclusive or inclusive gateway the node decides at
+// become connections from the output handles named by their conditions or names.
+func (im *importer) connect(source uint, from, handle string, visited map[string]bool) {
+	for _, flow := range im.outgoing[from] {
+		flowHandle := handle
+		if decision := im.elements[from]; handle == "" && (decision.XMLName.Local == "exclusiveGateway" || decision.XMLName.Local == "inclusiveGateway") && im.incoming[from] == 1 {
+			flowHandle = im.flowHandle(decision, flow)
+		}
+
+		if target, ok := im.nodes[flow.TargetRef]; ok {
+			im.addConnection(source, target, flowHandle, flow.TargetHandle)
+			continue
+		}
+		target := im.elements[flow.TargetRef]
+		if gatewayElements[target.XMLName.Local] && !visited[target.ID] {
+			visited[target.ID] = true
+			im.connect(source, target.ID, flowHandle, visited)
+		}
+	}
+}
+
+// flowHandle returns the output handle of a flow leaving a decision gateway
+func (im *importer) flowHandle(gateway, flow inElement) string {
+	if match := handleConditionPattern.FindStringSubmatch(flow.Condition); match != nil {
+		return match[1]
+	}
+	label := gateway.Name
+	if label == "" {
+		label = gateway.ID
+	}
+	if flow.Name != "" {
+		im.warn(label, gateway.XMLName.Local, "The flow %q was converted into a connection from the output handle %q, check the node emits it", flow.ID, flow.Name)
+		return flow.Name
+	}
+	if strings.TrimSpace(flow.Condition) != "" {
+		im.warn(label, gateway.XMLName.Local, "The condition of flow %q could not be converted, the connection is always taken", flow.ID)
+	}
+	return ""
+}
+
+func (im *importer) addNode(node models.Node, x, y float64) uint {
+	node.ID = uint(len(im.result.Workflow.Nodes) + 1)
+	node.PositionX, node.PositionY = x, y
+	im.result.Workflow.Nodes = append(im.result.Workflow.Nodes, node)
+	return node.ID
+}
+
+func (im *importer) addConnection(source, target uint, sourceHandle, targetHandle string) {
+	if sourceHandle == "" {
+		sourceHandle = "output"
+	}
+	if targetHandle == "" {
+		targetHandle = "input"
+	}
+	for _, conn := range im.result.Workflow.Connections {
+		// Paths through several gateways may lead to the same node
+		if conn.SourceNodeID == source && conn.TargetNodeID == target && conn.SourceHandle == sourceHandle && conn.TargetHandle == targetHandle {
+			return
+		}
+	}
+	im.result.Workflow.Connections = append(im.result.Workflow.Connections, models.Connection{
+		SourceNodeID: source,
+		TargetNodeID: target,
+		SourceHandle: sourceHandle,
+		TargetHandle: targetHandle,
+	})
+}
+
+func (im *importer) warn(step, stepType, format string, args ...interface{}) {
+	im.result.Warnings = append(im.result.Warnings, models.ImportWarning{
+		Step:    step,
+		Type:    stepType,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func configJSON(config map[string]interface{}) string {
+	data, _ := json.Marshal(config)
+	return string(data)
+}
@@ -0,0 +1,210 @@
+// Package breaker implements circuit breakers failing requests to unhealthy downstream
+// services fast instead of piling up timeouts
+package breaker
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrorCode identifies errors of requests rejected by an open circuit
+const ErrorCode = "CIRCUIT_OPEN"
+
+// Circuit states
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half_open"
+)
+
+// Config holds the thresholds of the circuit breakers
+type Config struct {
+	// Enabled turns the circuit breakers on
+	Enabled bool
+	// FailureRate opens the circuit if this share of the requests in a window failed
+	FailureRate float64
+	// MinRequests is the number of requests in a window before the failure rate is considered
+	MinRequests int
+	// Window is the duration failures are counted in
+	Window time.Duration
+	// OpenDuration is how long an open circuit rejects requests before a probe is let through
+	OpenDuration time.Duration
+}
+
+// ConfigFromEnv reads the circuit breaker settings from the environment
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Enabled:      os.Getenv("CIRCUIT_BREAKER_ENABLED") != "false",
+		FailureRate:  0.5,
+		MinRequests:  10,
+		Window:       time.Minute,
+		OpenDuration: 30 * time.Second,
+	}
+
+	if rate, err := strconv.ParseFloat(os.Getenv("CIRCUIT_BREAKER_FAILURE_RATE"), 64); err == nil && rate > 0 && rate <= 1 {
+		cfg.FailureRate = rate
+	}
+	if min, err := strconv.Atoi(os.Getenv("CIRCUIT_BREAKER_MIN_REQUESTS")); err == nil && min > 0 {
+		cfg.MinRequests = min
+	}
+	if window, err := time.ParseDuration(os.Getenv("CIRCUIT_BREAKER_WINDOW")); err == nil && window > 0 {
+		cfg.Window = window
+	}
+	if open, err := time.ParseDuration(os.Getenv("CIRCUIT_BREAKER_OPEN_DURATION")); err == nil && open > 0 {
+		cfg.OpenDuration = open
+	}
+
+	return cfg
+}
+
+// OpenError is returned for requests rejected by an open circuit
+type OpenError struct {
+	Key   string
+	Until time.Time
+}
+
+func (e *OpenError) Error() string {
+	return fmt.Sprintf("circuit open for %s until %s", e.Key, e.Until.Format(time.RFC3339))
+}
+
+// ErrorCode returns the code identifying circuit breaker rejections
+func (e *OpenError) ErrorCode() string {
+	return ErrorCode
+}
+
+// circuit is the state of a single downstream target
+type circuit struct {
+	state       string
+	windowStart time.Time
+	requests    int
+	failures    int
+	openedAt    time.Time
+	probing     bool
+}
+
+// Registry holds the circuits of all downstream targets
+type Registry struct {
+	config   Config
+	mu       sync.Mutex
+	circuits map[string]*circuit
+	now      func() time.Time
+}
+
+// NewRegistry creates a new Registry
+func NewRegistry(config Config) *Registry {
+	return &Registry{
+		config:   config,
+		circuits: make(map[string]*circuit),
+		now:      time.Now,
+	}
+}
+
+var defaultRegistry = NewRegistry(Config{})
+
+// Configure replaces the default registry with one using the given settings
+func Configure(config Config) {
+	defaultRegistry = NewRegistry(config)
+}
+
+// Default returns the registry used by the executors
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Allow reports whether a request to the target may be made. Rejections return an *OpenError.
+// Every allowed request must be followed by a call to Done.
+func (r *Registry) Allow(key string) error {
+	if !r.config.Enabled {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := r.circuit(key)
+	now := r.now()
+
+	switch c.state {
+	case StateOpen:
+		if now.Before(c.openedAt.Add(r.config.OpenDuration)) {
+			return &OpenError{Key: key, Until: c.openedAt.Add(r.config.OpenDuration)}
+		}
+		// Let a single probe through to find out whether the target recovered
+		c.state = StateHalfOpen
+		c.probing = true
+		return nil
+	case StateHalfOpen:
+		if c.probing {
+			return &OpenError{Key: key, Until: now.Add(r.config.OpenDuration)}
+		}
+		c.probing = true
+		return nil
+	}
+
+	return nil
+}
+
+// Done records the outcome of a request allowed by Allow
+func (r *Registry) Done(key string, failed bool) {
+	if !r.config.Enabled {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c := r.circuit(key)
+	now := r.now()
+
+	if c.state == StateHalfOpen {
+		c.probing = false
+		if failed {
+			c.state = StateOpen
+			c.openedAt = now
+		} else {
+			c.state = StateClosed
+			c.windowStart = now
+			c.requests, c.failures = 0, 0
+		}
+		return
+	}
+
+	if now.Sub(c.windowStart) > r.config.Window {
+		c.windowStart = now
+		c.requests, c.failures = 0, 0
+	}
+
+	c.requests++
+	if failed {
+		c.failures++
+	}
+
+	if c.requests >= r.config.MinRequests && float64(c.failures)/float64(c.requests) >= r.config.FailureRate {
+		c.state = StateOpen
+		c.openedAt = now
+	}
+}
+
+// State returns the state of the target's circuit
+func (r *Registry) State(key string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if c, ok := r.circuits[key]; ok {
+		return c.state
+	}
+	return StateClosed
+}
+
+// circuit returns the circuit of the target, creating a closed one if needed
+func (r *Registry) circuit(key string) *circuit {
+	c, ok := r.circuits[key]
+	if !ok {
+		c = &circuit{state: StateClosed, windowStart: r.now()}
+		r.circuits[key] = c
+	}
+	return c
+}
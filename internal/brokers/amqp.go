@@ -0,0 +1,92 @@
+package brokers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/amqp"
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// AMQPTriggerType is the type of triggers consuming a queue of an AMQP 0-9-1 broker such as RabbitMQ
+const AMQPTriggerType = "amqp"
+
+// AMQPCredentialType is the type of the credentials holding the URL and login of an AMQP broker
+const AMQPCredentialType = "amqp"
+
+// AMQPConfig is the config of an amqp trigger
+type AMQPConfig struct {
+	// CredentialID is the amqp credential with the url, username and password of the broker
+	CredentialID uint `json:"credential_id"`
+	// Queue is the existing queue consumed
+	Queue string `json:"queue"`
+	// Prefetch is how many unacknowledged messages the broker sends ahead, 10 by default
+	Prefetch int `json:"prefetch,omitempty"`
+}
+
+// ParseAMQPConfig reads and checks the config of an amqp trigger
+func ParseAMQPConfig(config string) (AMQPConfig, error) {
+	var cfg AMQPConfig
+	if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid amqp trigger config: %v", err)
+	}
+	if cfg.CredentialID == 0 {
+		return cfg, errors.New("amqp triggers need the credential_id of an amqp credential in config")
+	}
+	if cfg.Queue == "" {
+		return cfg, errors.New("amqp triggers need a queue in config")
+	}
+	if cfg.Prefetch == 0 {
+		cfg.Prefetch = 10
+	}
+	if cfg.Prefetch < 1 || cfg.Prefetch > 1000 {
+		return cfg, errors.New("prefetch must be between 1 and 1000")
+	}
+	return cfg, nil
+}
+
+// amqpCredentialID returns the credential of an amqp trigger
+func amqpCredentialID(config string) (uint, error) {
+	cfg, err := ParseAMQPConfig(config)
+	return cfg.CredentialID, err
+}
+
+// listenAMQP consumes the queue of an amqp trigger and starts an execution per message. The
+// input holds the queue, exchange and routing key, the payload as body (parsed if it is JSON),
+// the headers and properties of the message and whether it was delivered before.
+func listenAMQP(ctx context.Context, trigger models.Trigger, secret map[string]string, deliver deliverFunc) error {
+	cfg, err := ParseAMQPConfig(trigger.Config)
+	if err != nil {
+		return err
+	}
+
+	conn, err := amqp.Dial(ctx, amqp.Options{URL: secret["url"], Username: secret["username"], Password: secret["password"]})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Consume(ctx, cfg.Queue, cfg.Prefetch, func(delivery amqp.Delivery) error {
+		input := map[string]interface{}{
+			"queue":          cfg.Queue,
+			"exchange":       delivery.Exchange,
+			"routing_key":    delivery.RoutingKey,
+			"body":           decodePayload(delivery.Body),
+			"headers":        delivery.Properties.Headers,
+			"content_type":   delivery.Properties.ContentType,
+			"message_id":     delivery.Properties.MessageID,
+			"correlation_id": delivery.Properties.CorrelationID,
+			"redelivered":    delivery.Redelivered,
+		}
+		if input["headers"] == nil {
+			input["headers"] = map[string]interface{}{}
+		}
+		if !delivery.Properties.Timestamp.IsZero() {
+			input["timestamp"] = delivery.Properties.Timestamp.Format(time.RFC3339)
+		}
+		return deliver(input)
+	})
+}
@@ -0,0 +1,215 @@
+// Package brokers runs the triggers consuming messages from message brokers. Each active trigger
+// keeps a subscription to its broker and starts an execution per message received.
+package brokers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/credentials"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/dispatch"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/schemas"
+)
+
+// maxBackoff is the longest wait before reconnecting a subscription that failed
+const maxBackoff = time.Minute
+
+// deliverFunc starts an execution of the trigger with the input of a message. Messages it
+// returns an error for are not acknowledged, so the broker delivers them again.
+type deliverFunc func(input map[string]interface{}) error
+
+// listenFunc consumes the messages of a trigger until ctx is done or the subscription fails
+type listenFunc func(ctx context.Context, trigger models.Trigger, secret map[string]string, deliver deliverFunc) error
+
+// source is a kind of broker triggers consume from
+type source struct {
+	credentialType string
+	// credentialID returns the credential with the connection settings from the trigger config
+	credentialID func(config string) (uint, error)
+	listen       listenFunc
+}
+
+// sources are the broker sources by trigger type
+var sources = map[string]source{
+	MQTTTriggerType: {credentialType: MQTTCredentialType, credentialID: mqttCredentialID, listen: listenMQTT},
+	AMQPTriggerType: {credentialType: AMQPCredentialType, credentialID: amqpCredentialID, listen: listenAMQP},
+	SQSTriggerType:  {credentialType: AWSCredentialType, credentialID: sqsCredentialID, listen: listenSQS},
+}
+
+// IsTriggerType reports whether triggers of the type consume from a broker
+func IsTriggerType(triggerType string) bool {
+	_, ok := sources[triggerType]
+	return ok
+}
+
+// Validate checks the config of a broker trigger and its credential
+func Validate(trigger models.Trigger, organizationID uint) error {
+	source, ok := sources[trigger.TriggerType]
+	if !ok {
+		return fmt.Errorf("unsupported trigger type: %s", trigger.TriggerType)
+	}
+	id, err := source.credentialID(trigger.Config)
+	if err != nil {
+		return err
+	}
+	_, err = credentials.Resolve(id, organizationID, source.credentialType)
+	return err
+}
+
+// subscription is the running consumer of a trigger
+type subscription struct {
+	trigger models.Trigger
+	cancel  context.CancelFunc
+	done    chan struct{}
+}
+
+// Run keeps a subscription for each active broker trigger until ctx is done, checking for new,
+// changed and removed triggers at the given interval
+func Run(ctx context.Context, dispatcher *dispatch.Dispatcher, interval time.Duration) {
+	running := map[uint]*subscription{}
+	defer func() {
+		for _, sub := range running {
+			sub.cancel()
+			<-sub.done
+		}
+	}()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		types := make([]string, 0, len(sources))
+		for triggerType := range sources {
+			types = append(types, triggerType)
+		}
+		var triggers []models.Trigger
+		if err := database.DB.Where("trigger_type IN ? AND is_active = ?", types, true).Find(&triggers).Error; err != nil {
+			log.Printf("Failed to load broker triggers: %v", err)
+		} else {
+			active := make(map[uint]bool, len(triggers))
+			for _, trigger := range triggers {
+				active[trigger.ID] = true
+				sub, ok := running[trigger.ID]
+				if ok && sub.trigger.Config == trigger.Config && sub.trigger.WorkflowID == trigger.WorkflowID {
+					continue
+				}
+				if ok {
+					sub.cancel()
+					<-sub.done
+				}
+				running[trigger.ID] = subscribe(ctx, dispatcher, trigger)
+			}
+			for id, sub := range running {
+				if !active[id] {
+					sub.cancel()
+					<-sub.done
+					delete(running, id)
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// subscribe starts consuming the messages of a trigger, reconnecting with backoff after failures
+func subscribe(ctx context.Context, dispatcher *dispatch.Dispatcher, trigger models.Trigger) *subscription {
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &subscription{trigger: trigger, cancel: cancel, done: make(chan struct{})}
+
+	go func() {
+		defer close(sub.done)
+		backoff := time.Second
+		for ctx.Err() == nil {
+			started := time.Now()
+			err := listen(ctx, dispatcher, trigger)
+			if ctx.Err() != nil {
+				return
+			}
+			// Subscriptions that ran for a while start over with a short backoff
+			if time.Since(started) > maxBackoff {
+				backoff = time.Second
+			}
+			log.Printf("Broker trigger %d: subscription failed, reconnecting in %s: %v", trigger.ID, backoff, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+	}()
+	return sub
+}
+
+// listen resolves the credential of a trigger and consumes its messages
+func listen(ctx context.Context, dispatcher *dispatch.Dispatcher, trigger models.Trigger) error {
+	source := sources[trigger.TriggerType]
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, trigger.WorkflowID).Error; err != nil {
+		return fmt.Errorf("workflow %d: %v", trigger.WorkflowID, err)
+	}
+	id, err := source.credentialID(trigger.Config)
+	if err != nil {
+		return err
+	}
+	secret, err := credentials.Resolve(id, workflow.OrganizationID, source.credentialType)
+	if err != nil {
+		return err
+	}
+
+	return source.listen(ctx, trigger, secret, func(input map[string]interface{}) error {
+		return deliver(dispatcher, trigger, input)
+	})
+}
+
+// deliver starts an execution of the trigger for a message. Messages not matching the payload
+// schema of the trigger, dropped by its throttle or already accepted are acknowledged without one.
+func deliver(dispatcher *dispatch.Dispatcher, trigger models.Trigger, input map[string]interface{}) error {
+	if trigger.PayloadSchema != "" {
+		_, err := schemas.ValidatePayload(trigger.PayloadSchema, trigger.PayloadSchemaVersion, input["body"])
+		var invalid *schemas.InvalidPayloadError
+		if errors.As(err, &invalid) {
+			log.Printf("Broker trigger %d: rejected message: %v", trigger.ID, err)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// The workflow is loaded for each message, so rollouts apply right away
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, trigger.WorkflowID).Error; err != nil {
+		return err
+	}
+	input["trigger_id"] = trigger.ID
+	input["received_at"] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	_, err := dispatcher.DispatchTrigger(workflow, trigger, input)
+	var duplicate *dispatch.DuplicateError
+	if errors.Is(err, dispatch.ErrDropped) || errors.As(err, &duplicate) {
+		return nil
+	}
+	return err
+}
+
+// decodePayload returns a message payload as JSON value if it is valid JSON, otherwise as text
+func decodePayload(payload []byte) interface{} {
+	var value interface{}
+	if err := json.Unmarshal(payload, &value); err == nil {
+		return value
+	}
+	return string(payload)
+}
@@ -0,0 +1,115 @@
+package brokers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/mqtt"
+)
+
+// MQTTTriggerType is the type of triggers subscribing to topics of an MQTT broker
+const MQTTTriggerType = "mqtt"
+
+// MQTTCredentialType is the type of the credentials holding the URL and login of an MQTT broker
+const MQTTCredentialType = "mqtt"
+
+// MQTTConfig is the config of an mqtt trigger
+type MQTTConfig struct {
+	// CredentialID is the mqtt credential with the url, username and password of the broker
+	CredentialID uint `json:"credential_id"`
+	// Topics are the topic filters subscribed to, which may contain the wildcards + and #
+	Topics []string `json:"topics"`
+	// QoS of the subscriptions, 0 (at most once), 1 (at least once, default) or 2 (exactly once)
+	QoS *int `json:"qos,omitempty"`
+	// ClientID of the session, flowcraft-trigger-<id> by default
+	ClientID string `json:"client_id,omitempty"`
+	// CleanSession discards the messages published while no worker was subscribed; by default
+	// the broker keeps them for the session of the trigger
+	CleanSession bool `json:"clean_session,omitempty"`
+}
+
+// ParseMQTTConfig reads and checks the config of an mqtt trigger
+func ParseMQTTConfig(config string) (MQTTConfig, error) {
+	var cfg MQTTConfig
+	if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid mqtt trigger config: %v", err)
+	}
+	if cfg.CredentialID == 0 {
+		return cfg, errors.New("mqtt triggers need the credential_id of an mqtt credential in config")
+	}
+	if len(cfg.Topics) == 0 {
+		return cfg, errors.New("mqtt triggers need topics in config")
+	}
+	for _, topic := range cfg.Topics {
+		if topic == "" {
+			return cfg, errors.New("topics must not be empty")
+		}
+	}
+	if cfg.QoS == nil {
+		qos := 1
+		cfg.QoS = &qos
+	}
+	if *cfg.QoS < 0 || *cfg.QoS > 2 {
+		return cfg, errors.New("qos must be 0, 1 or 2")
+	}
+	return cfg, nil
+}
+
+// mqttCredentialID returns the credential of an mqtt trigger
+func mqttCredentialID(config string) (uint, error) {
+	cfg, err := ParseMQTTConfig(config)
+	return cfg.CredentialID, err
+}
+
+// listenMQTT subscribes to the topics of an mqtt trigger and starts an execution per message.
+// The input holds the topic, the payload as body (parsed if it is JSON), the QoS and whether
+// the message was retained.
+func listenMQTT(ctx context.Context, trigger models.Trigger, secret map[string]string, deliver deliverFunc) error {
+	cfg, err := ParseMQTTConfig(trigger.Config)
+	if err != nil {
+		return err
+	}
+
+	opts := mqtt.Options{
+		URL:          secret["url"],
+		Username:     secret["username"],
+		Password:     secret["password"],
+		ClientID:     cfg.ClientID,
+		CleanSession: cfg.CleanSession,
+		Handler: func(message mqtt.Message) error {
+			return deliver(map[string]interface{}{
+				"topic":    message.Topic,
+				"body":     decodePayload(message.Payload),
+				"qos":      message.QoS,
+				"retained": message.Retain,
+			})
+		},
+	}
+	if opts.ClientID == "" {
+		opts.ClientID = fmt.Sprintf("flowcraft-trigger-%d", trigger.ID)
+	}
+
+	client, err := mqtt.Dial(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	subscriptions := make([]mqtt.Subscription, len(cfg.Topics))
+	for i, topic := range cfg.Topics {
+		subscriptions[i] = mqtt.Subscription{Topic: topic, QoS: byte(*cfg.QoS)}
+	}
+	if err := client.Subscribe(ctx, subscriptions...); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case <-client.Done():
+		return client.Err()
+	}
+}
@@ -0,0 +1,218 @@
+package brokers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/sqs"
+)
+
+// SQSTriggerType is the type of triggers receiving the messages of an Amazon SQS queue
+const SQSTriggerType = "sqs"
+
+// AWSCredentialType is the type of the credentials holding the access keys of an AWS account
+const AWSCredentialType = "aws"
+
+// SQSConfig is the config of an sqs trigger
+type SQSConfig struct {
+	// CredentialID is the aws credential with the access_key_id and secret_access_key
+	CredentialID uint `json:"credential_id"`
+	// QueueURL is the URL of the queue, e.g. https://sqs.eu-west-1.amazonaws.com/123456789012/orders
+	QueueURL string `json:"queue_url"`
+	// BatchSize is the most messages received per request, 1 to 10 (default)
+	BatchSize int `json:"batch_size,omitempty"`
+	// WaitTimeSeconds is how long receive requests wait for messages, 0 to 20 (default)
+	WaitTimeSeconds *int `json:"wait_time_seconds,omitempty"`
+	// VisibilityTimeout is how many seconds received messages are hidden from other consumers,
+	// 30 by default. Messages whose execution could not be started reappear after it and are
+	// received again, until the redrive policy of the queue moves them to its dead-letter queue.
+	VisibilityTimeout int `json:"visibility_timeout,omitempty"`
+}
+
+// ParseSQSConfig reads and checks the config of an sqs trigger
+func ParseSQSConfig(config string) (SQSConfig, error) {
+	var cfg SQSConfig
+	if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid sqs trigger config: %v", err)
+	}
+	if cfg.CredentialID == 0 {
+		return cfg, errors.New("sqs triggers need the credential_id of an aws credential in config")
+	}
+	if cfg.QueueURL == "" {
+		return cfg, errors.New("sqs triggers need a queue_url in config")
+	}
+	if err := sqs.ValidateQueueURL(cfg.QueueURL); err != nil {
+		return cfg, err
+	}
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = sqs.MaxBatchSize
+	}
+	if cfg.BatchSize < 1 || cfg.BatchSize > sqs.MaxBatchSize {
+		return cfg, fmt.Errorf("batch_size must be between 1 and %d", sqs.MaxBatchSize)
+	}
+	if cfg.WaitTimeSeconds == nil {
+		wait := int(sqs.MaxWaitTime / time.Second)
+		cfg.WaitTimeSeconds = &wait
+	}
+	if *cfg.WaitTimeSeconds < 0 || *cfg.WaitTimeSeconds > int(sqs.MaxWaitTime/time.Second) {
+		return cfg, fmt.Errorf("wait_time_seconds must be between 0 and %d", int(sqs.MaxWaitTime/time.Second))
+	}
+	if cfg.VisibilityTimeout == 0 {
+		cfg.VisibilityTimeout = 30
+	}
+	if cfg.VisibilityTimeout < 1 || cfg.VisibilityTimeout > int(sqs.MaxVisibilityTimeout/time.Second) {
+		return cfg, fmt.Errorf("visibility_timeout must be between 1 and %d seconds", int(sqs.MaxVisibilityTimeout/time.Second))
+	}
+	return cfg, nil
+}
+
+// sqsCredentialID returns the credential of an sqs trigger
+func sqsCredentialID(config string) (uint, error) {
+	cfg, err := ParseSQSConfig(config)
+	return cfg.CredentialID, err
+}
+
+// listenSQS receives batches of messages of the queue of an sqs trigger and starts an execution
+// per message. Messages are deleted once their execution started; the others stay hidden until
+// their visibility timeout expires, so they are received again. The input holds the queue URL,
+// the message ID, the payload as body (parsed if it is JSON), the message attributes and how
+// often the message was received.
+func listenSQS(ctx context.Context, trigger models.Trigger, secret map[string]string, deliver deliverFunc) error {
+	cfg, err := ParseSQSConfig(trigger.Config)
+	if err != nil {
+		return err
+	}
+	client := sqs.Client{
+		AccessKeyID:     secret["access_key_id"],
+		SecretAccessKey: secret["secret_access_key"],
+		SessionToken:    secret["session_token"],
+		Region:          secret["region"],
+	}
+	opts := sqs.ReceiveOptions{
+		MaxMessages:       cfg.BatchSize,
+		WaitTime:          time.Duration(*cfg.WaitTimeSeconds) * time.Second,
+		VisibilityTimeout: time.Duration(cfg.VisibilityTimeout) * time.Second,
+	}
+
+	for ctx.Err() == nil {
+		messages, err := client.Receive(ctx, cfg.QueueURL, opts)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		if err := handleSQSBatch(ctx, client, cfg, messages, deliver); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleSQSBatch delivers a batch of messages and deletes the delivered ones. While the batch is
+// handled, the visibility of the messages not delivered yet is extended, so they don't reappear
+// for other consumers in the meantime.
+func handleSQSBatch(ctx context.Context, client sqs.Client, cfg SQSConfig, messages []sqs.Message, deliver deliverFunc) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	timeout := time.Duration(cfg.VisibilityTimeout) * time.Second
+
+	var mu sync.Mutex
+	pending := make(map[string]bool, len(messages))
+	for _, message := range messages {
+		pending[message.ReceiptHandle] = true
+	}
+	stop := make(chan struct{})
+	heartbeat := make(chan struct{})
+	go func() {
+		defer close(heartbeat)
+		ticker := time.NewTicker(timeout / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			mu.Lock()
+			handles := make([]string, 0, len(pending))
+			for handle := range pending {
+				handles = append(handles, handle)
+			}
+			mu.Unlock()
+			if err := client.ChangeVisibilityBatch(ctx, cfg.QueueURL, handles, timeout); err != nil {
+				log.Printf("SQS queue %s: failed to extend the visibility timeout: %v", cfg.QueueURL, err)
+			}
+		}
+	}()
+
+	var delivered []string
+	var deliverErr error
+	for _, message := range messages {
+		if ctx.Err() != nil {
+			break
+		}
+		input := map[string]interface{}{
+			"queue_url":          cfg.QueueURL,
+			"message_id":         message.MessageID,
+			"body":               decodePayload([]byte(message.Body)),
+			"message_attributes": sqsAttributes(message.MessageAttributes),
+			"attributes":         message.Attributes,
+		}
+		if count, err := strconv.Atoi(message.Attributes["ApproximateReceiveCount"]); err == nil {
+			input["receive_count"] = count
+		}
+		// After a failed delivery the remaining messages are left to reappear as well, the
+		// subscription reconnects with backoff
+		if deliverErr = deliver(input); deliverErr != nil {
+			break
+		}
+		delivered = append(delivered, message.ReceiptHandle)
+		mu.Lock()
+		delete(pending, message.ReceiptHandle)
+		mu.Unlock()
+	}
+	close(stop)
+	<-heartbeat
+
+	// Deleting uses its own context, so messages delivered before a shutdown aren't received
+	// again
+	deleteCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := client.DeleteBatch(deleteCtx, cfg.QueueURL, delivered); err != nil {
+		return fmt.Errorf("failed to delete delivered messages: %v", err)
+	}
+	// Messages left undelivered by a shutdown are released to other consumers right away
+	if ctx.Err() != nil && len(pending) > 0 {
+		handles := make([]string, 0, len(pending))
+		for handle := range pending {
+			handles = append(handles, handle)
+		}
+		if err := client.ChangeVisibilityBatch(deleteCtx, cfg.QueueURL, handles, 0); err != nil {
+			log.Printf("SQS queue %s: failed to release undelivered messages: %v", cfg.QueueURL, err)
+		}
+	}
+	return deliverErr
+}
+
+// sqsAttributes returns the message attributes by name, binary values base64 encoded
+func sqsAttributes(attributes map[string]sqs.MessageAttribute) map[string]interface{} {
+	values := make(map[string]interface{}, len(attributes))
+	for name, attribute := range attributes {
+		if attribute.BinaryValue != nil {
+			values[name] = base64.StdEncoding.EncodeToString(attribute.BinaryValue)
+		} else {
+			values[name] = attribute.StringValue
+		}
+	}
+	return values
+}
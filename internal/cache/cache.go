@@ -0,0 +1,99 @@
+// Package cache stores results of slow operations, e.g. HTTP responses, in Redis
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// keyPrefix namespaces cache keys in Redis
+const keyPrefix = "flowcraft:cache:"
+
+// ErrNotConfigured is returned if no cache store is configured
+var ErrNotConfigured = errors.New("cache is not configured")
+
+// Store is a key-value store with expiring entries
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+var store Store
+
+// Configure sets the store used for caching
+func Configure(s Store) {
+	store = s
+}
+
+// Get reads a cached value into v and reports whether the key was found
+func Get(ctx context.Context, key string, v interface{}) (bool, error) {
+	if store == nil {
+		return false, ErrNotConfigured
+	}
+
+	data, found, err := store.Get(ctx, keyPrefix+key)
+	if err != nil || !found {
+		return false, err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("failed to parse cached value: %v", err)
+	}
+	return true, nil
+}
+
+// Set caches the value for ttl
+func Set(ctx context.Context, key string, v interface{}, ttl time.Duration) error {
+	if store == nil {
+		return ErrNotConfigured
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value: %v", err)
+	}
+	return store.Set(ctx, keyPrefix+key, data, ttl)
+}
+
+// Delete removes a cached value
+func Delete(ctx context.Context, key string) error {
+	if store == nil {
+		return ErrNotConfigured
+	}
+	return store.Delete(ctx, keyPrefix+key)
+}
+
+// RedisStore stores cache entries in Redis
+type RedisStore struct {
+	client redis.UniversalClient
+}
+
+// NewRedisStore creates a store using the Redis client
+func NewRedisStore(client redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: client}
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	data, err := s.client.Get(ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	return s.client.Set(ctx, key, value, ttl).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	return s.client.Del(ctx, key).Err()
+}
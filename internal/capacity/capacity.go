@@ -0,0 +1,278 @@
+// Package capacity plans the number of workers needed for a load by replaying the executions of
+// a past time range against simulated workers, optionally at a higher rate, e.g. before a launch
+package capacity
+
+import (
+	"container/heap"
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// MaxJobs bounds the executions replayed by a simulation
+const MaxJobs = 200000
+
+// ErrTooManyJobs is returned by History if the time range has more than MaxJobs executions
+var ErrTooManyJobs = errors.New("too many executions in the time range, choose a shorter one")
+
+// Job is an execution to simulate: when it was due and how long it kept a worker busy
+type Job struct {
+	Due     time.Time
+	Service time.Duration
+}
+
+// Options are the settings of a capacity plan
+type Options struct {
+	// LoadFactor multiplies the rate of the executions, e.g. 2 for twice as many executions
+	LoadFactor float64
+	// TargetWait is the longest an execution may wait for a worker at the percentile
+	TargetWait time.Duration
+	// Percentile of the waits that must be within the target, e.g. 95
+	Percentile float64
+	// MaxWorkers bounds the worker counts simulated
+	MaxWorkers int
+	// Workers are worker counts to simulate in addition to the recommended one, e.g. the current
+	Workers []int
+}
+
+// Scenario is the simulated queue wait of executions with a number of workers
+type Scenario struct {
+	Workers     int     `json:"workers"`
+	Utilization float64 `json:"utilization"`
+	AvgWaitMs   float64 `json:"avg_wait_ms"`
+	P50WaitMs   float64 `json:"p50_wait_ms"`
+	P95WaitMs   float64 `json:"p95_wait_ms"`
+	P99WaitMs   float64 `json:"p99_wait_ms"`
+	MaxWaitMs   float64 `json:"max_wait_ms"`
+	// WaitMs is the wait at the percentile of the plan
+	WaitMs      float64 `json:"wait_ms"`
+	MeetsTarget bool    `json:"meets_target"`
+}
+
+// Plan is the result of a capacity simulation
+type Plan struct {
+	From                time.Time `json:"from"`
+	To                  time.Time `json:"to"`
+	Executions          int       `json:"executions"`
+	LoadFactor          float64   `json:"load_factor"`
+	ArrivalsPerHour     float64   `json:"arrivals_per_hour"`      // average at the load factor
+	PeakArrivalsPerHour float64   `json:"peak_arrivals_per_hour"` // busiest hour at the load factor
+	AvgDurationMs       float64   `json:"avg_duration_ms"`
+	P95DurationMs       float64   `json:"p95_duration_ms"`
+	TargetWaitMs        float64   `json:"target_wait_ms"`
+	Percentile          float64   `json:"percentile"`
+	// RecommendedWorkers is the fewest workers meeting the target, 0 if MaxWorkers do not
+	RecommendedWorkers int        `json:"recommended_workers"`
+	Scenarios          []Scenario `json:"scenarios"`
+}
+
+// History loads the executions started in the time range, of a workflow and its published
+// versions if workflowID is not 0. Executions are due when they were created or released by the
+// controls of their trigger and keep a worker busy for the time their nodes ran; the time
+// executions wait for approvals or events does not occupy a worker.
+func History(from, to time.Time, workflowID uint) ([]Job, error) {
+	query := database.Replica().Model(&models.WorkflowExecution{}).
+		Select("GREATEST(workflow_executions.created_at, COALESCE(workflow_executions.queued_until, workflow_executions.created_at)) AS due, "+
+			"COALESCE(SUM(node_executions.duration_ms), 0) AS service_ms").
+		Joins("LEFT JOIN node_executions ON node_executions.workflow_execution_id = workflow_executions.id").
+		Where("workflow_executions.started_at >= ? AND workflow_executions.started_at < ?", from, to).
+		Where("workflow_executions.status NOT IN ?", []string{"held", "queued", "pending"})
+	if workflowID != 0 {
+		query = query.
+			Joins("JOIN workflows ON workflows.id = workflow_executions.workflow_id").
+			Where("COALESCE(workflows.parent_id, workflows.id) = ?", workflowID)
+	}
+
+	var rows []struct {
+		Due       time.Time
+		ServiceMs int64
+	}
+	err := query.Group("workflow_executions.id").Order("due").Limit(MaxJobs + 1).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) > MaxJobs {
+		return nil, ErrTooManyJobs
+	}
+
+	jobs := make([]Job, len(rows))
+	for i, row := range rows {
+		jobs[i] = Job{Due: row.Due, Service: time.Duration(row.ServiceMs) * time.Millisecond}
+	}
+	return jobs, nil
+}
+
+// NewPlan simulates the jobs due in the time range with increasing numbers of workers to find
+// the fewest meeting the target wait, and the worker counts of the options
+func NewPlan(jobs []Job, from, to time.Time, opts Options) Plan {
+	jobs = scale(jobs, from, opts.LoadFactor)
+	window := time.Duration(float64(to.Sub(from)) / opts.LoadFactor)
+
+	plan := Plan{
+		From:         from,
+		To:           to,
+		Executions:   len(jobs),
+		LoadFactor:   opts.LoadFactor,
+		TargetWaitMs: float64(opts.TargetWait.Milliseconds()),
+		Percentile:   opts.Percentile,
+		Scenarios:    []Scenario{},
+	}
+	if len(jobs) == 0 {
+		return plan
+	}
+
+	plan.ArrivalsPerHour = float64(len(jobs)) / window.Hours()
+	perHour := map[int64]int{}
+	services := make([]float64, len(jobs))
+	var total float64
+	for i, job := range jobs {
+		hour := job.Due.Sub(from) / time.Hour
+		perHour[int64(hour)]++
+		services[i] = float64(job.Service.Milliseconds())
+		total += services[i]
+	}
+	for _, count := range perHour {
+		plan.PeakArrivalsPerHour = math.Max(plan.PeakArrivalsPerHour, float64(count))
+	}
+	// Windows shorter than an hour have no full hour to count
+	plan.PeakArrivalsPerHour = math.Max(plan.PeakArrivalsPerHour, plan.ArrivalsPerHour)
+	sort.Float64s(services)
+	plan.AvgDurationMs = total / float64(len(jobs))
+	plan.P95DurationMs = percentile(services, 95)
+
+	simulate := func(workers int) Scenario {
+		return Simulate(jobs, workers, window, opts)
+	}
+
+	// Waits only get shorter with more workers, so the fewest meeting the target are searched
+	low, high := 1, opts.MaxWorkers
+	if simulate(high).MeetsTarget {
+		for low < high {
+			mid := (low + high) / 2
+			if simulate(mid).MeetsTarget {
+				high = mid
+			} else {
+				low = mid + 1
+			}
+		}
+		plan.RecommendedWorkers = low
+	}
+
+	// The recommendation with its neighbours show what a worker more or less changes
+	counts := map[int]bool{}
+	if plan.RecommendedWorkers > 0 {
+		for workers := plan.RecommendedWorkers - 2; workers <= plan.RecommendedWorkers+2; workers++ {
+			counts[workers] = true
+		}
+	} else {
+		counts[opts.MaxWorkers] = true
+	}
+	for _, workers := range opts.Workers {
+		counts[workers] = true
+	}
+	for workers := range counts {
+		if workers >= 1 && workers <= opts.MaxWorkers {
+			plan.Scenarios = append(plan.Scenarios, simulate(workers))
+		}
+	}
+	sort.Slice(plan.Scenarios, func(i, j int) bool { return plan.Scenarios[i].Workers < plan.Scenarios[j].Workers })
+
+	return plan
+}
+
+// scale compresses the time between the jobs by the load factor
+func scale(jobs []Job, from time.Time, factor float64) []Job {
+	if factor == 1 {
+		return jobs
+	}
+	scaled := make([]Job, len(jobs))
+	for i, job := range jobs {
+		scaled[i] = Job{Due: from.Add(time.Duration(float64(job.Due.Sub(from)) / factor)), Service: job.Service}
+	}
+	return scaled
+}
+
+// Simulate runs the jobs, ordered by due time, on a number of workers taking them first come,
+// first served, and measures how long the jobs waited for a worker
+func Simulate(jobs []Job, workers int, window time.Duration, opts Options) Scenario {
+	scenario := Scenario{Workers: workers}
+	if len(jobs) == 0 {
+		scenario.MeetsTarget = true
+		return scenario
+	}
+
+	// The times the workers become free, the earliest first
+	free := make(freeTimes, workers)
+	for i := range free {
+		free[i] = jobs[0].Due
+	}
+	heap.Init(&free)
+
+	waits := make([]float64, len(jobs))
+	var totalWait, busy float64
+	end := jobs[0].Due.Add(window)
+	for i, job := range jobs {
+		start := job.Due
+		if free[0].After(start) {
+			start = free[0]
+		}
+		finish := start.Add(job.Service)
+		free[0] = finish
+		heap.Fix(&free, 0)
+		if finish.After(end) {
+			end = finish
+		}
+
+		waits[i] = float64(start.Sub(job.Due).Milliseconds())
+		totalWait += waits[i]
+		busy += float64(job.Service.Milliseconds())
+	}
+	sort.Float64s(waits)
+
+	span := float64(end.Sub(jobs[0].Due).Milliseconds())
+	if span > 0 {
+		scenario.Utilization = round(busy / (span * float64(workers)))
+	}
+	scenario.AvgWaitMs = round(totalWait / float64(len(waits)))
+	scenario.P50WaitMs = percentile(waits, 50)
+	scenario.P95WaitMs = percentile(waits, 95)
+	scenario.P99WaitMs = percentile(waits, 99)
+	scenario.MaxWaitMs = waits[len(waits)-1]
+	scenario.WaitMs = percentile(waits, opts.Percentile)
+	scenario.MeetsTarget = scenario.WaitMs <= float64(opts.TargetWait.Milliseconds())
+	return scenario
+}
+
+// percentile returns the nearest-rank percentile of sorted values
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func round(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
+
+// freeTimes is a min-heap of the times workers become free
+type freeTimes []time.Time
+
+func (f freeTimes) Len() int            { return len(f) }
+func (f freeTimes) Less(i, j int) bool  { return f[i].Before(f[j]) }
+func (f freeTimes) Swap(i, j int)       { f[i], f[j] = f[j], f[i] }
+func (f *freeTimes) Push(x interface{}) { *f = append(*f, x.(time.Time)) }
+func (f *freeTimes) Pop() interface{} {
+	old := *f
+	x := old[len(old)-1]
+	*f = old[:len(old)-1]
+	return x
+}
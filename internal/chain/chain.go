@@ -0,0 +1,69 @@
+// Package chain starts the workflows chained to an execution once it completes, passing the
+// execution's output as their input
+package chain
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/dispatch"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/queue"
+)
+
+var dispatcher *dispatch.Dispatcher
+
+// Configure sets the queue client the chained executions are enqueued with
+func Configure(client *queue.QueueClient) {
+	dispatcher = dispatch.NewDispatcher(client)
+}
+
+// Continue starts the workflows chained to a completed execution. The chains of executions that
+// did not complete are skipped.
+func Continue(execution *models.WorkflowExecution) {
+	var chains []models.ExecutionChain
+	if err := database.DB.Where("workflow_execution_id = ? AND status = ?", execution.ID, models.ChainPending).Find(&chains).Error; err != nil {
+		log.Printf("Failed to load chains of execution %d: %v", execution.ID, err)
+		return
+	}
+
+	for i := range chains {
+		chain := &chains[i]
+		if execution.Status != "completed" {
+			chain.Status = models.ChainSkipped
+		} else if target, err := start(chain, execution); err != nil {
+			chain.Status = models.ChainFailed
+			chain.ErrorMessage = err.Error()
+			log.Printf("Failed to start workflow %d chained to execution %d: %v", chain.TargetWorkflowID, execution.ID, err)
+		} else {
+			chain.Status = models.ChainStarted
+			chain.TargetExecutionID = &target.ID
+		}
+		database.DB.Save(chain)
+	}
+}
+
+// start dispatches the target workflow of a chain with the output of the execution
+func start(chain *models.ExecutionChain, execution *models.WorkflowExecution) (*models.WorkflowExecution, error) {
+	if dispatcher == nil {
+		return nil, errors.New("execution chains are not configured")
+	}
+
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, chain.TargetWorkflowID).Error; err != nil {
+		return nil, err
+	}
+
+	var input map[string]interface{}
+	if err := json.Unmarshal([]byte(execution.OutputData), &input); err != nil {
+		return nil, err
+	}
+
+	then, err := dispatch.ParseChain(chain.Then)
+	if err != nil {
+		return nil, err
+	}
+	return dispatcher.DispatchChained(workflow, input, then)
+}
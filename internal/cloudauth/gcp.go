@@ -0,0 +1,41 @@
+package cloudauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// gcpMetadataTokenURL returns access tokens of the service account of GCE, GKE and Cloud Run workloads
+const gcpMetadataTokenURL = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+var metadataClient = &http.Client{Timeout: 10 * time.Second}
+
+// GCPMetadataToken returns an access token of the service account the workload runs as, from
+// the metadata server of Google Cloud
+func GCPMetadataToken(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataTokenURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+
+	resp, err := metadataClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get an access token from the metadata server: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get an access token from the metadata server: status %d", resp.StatusCode)
+	}
+
+	var response struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return "", fmt.Errorf("failed to decode the access token of the metadata server: %v", err)
+	}
+	return response.AccessToken, nil
+}
@@ -0,0 +1,223 @@
+// Package credentials stores the secrets of external services encrypted in the database
+package credentials
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/altipard/flowcraft/internal/amqp"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/mqtt"
+	"github.com/altipard/flowcraft/internal/secrets"
+)
+
+// ErrNoKey is returned when credentials are used without an encryption key configured
+var ErrNoKey = errors.New("CREDENTIALS_KEY is not set")
+
+// requiredFields lists the fields each credential type must have. A list of alternatives
+// means one of them is required.
+var requiredFields = map[string][][]string{
+	"jira":    {{"base_url"}, {"api_token", "token"}},
+	"github":  {{"token"}},
+	"bearer":  {{"token"}},
+	"basic":   {{"username"}},
+	"api_key": {{"api_key"}},
+	"slack":   {{"signing_secret"}},
+	"mqtt":    {{"url"}},
+	"amqp":    {{"url"}},
+	"aws":     {{"access_key_id"}, {"secret_access_key"}},
+
+	TypeOAuth2AuthCode: {{"client_id"}, {"client_secret"}},
+}
+
+var key struct {
+	sync.RWMutex
+	aead cipher.AEAD
+}
+
+// KeyFromEnv returns the encryption key configured in CREDENTIALS_KEY, or nil
+func KeyFromEnv() []byte {
+	value := os.Getenv("CREDENTIALS_KEY")
+	if value == "" {
+		return nil
+	}
+	return []byte(value)
+}
+
+// Configure sets the key credentials are encrypted with. Any secret works, it is stretched
+// to an AES-256 key with SHA-256.
+func Configure(secret []byte) {
+	var aead cipher.AEAD
+	if len(secret) > 0 {
+		sum := sha256.Sum256(secret)
+		block, _ := aes.NewCipher(sum[:])
+		aead, _ = cipher.NewGCM(block)
+	}
+
+	key.Lock()
+	key.aead = aead
+	key.Unlock()
+}
+
+// Validate checks the credential type and its required fields
+func Validate(credentialType string, data map[string]string) error {
+	required, ok := requiredFields[credentialType]
+	if !ok {
+		return fmt.Errorf("unknown credential type: %s", credentialType)
+	}
+
+	for _, alternatives := range required {
+		found := false
+		for _, field := range alternatives {
+			if data[field] != "" {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("credential type %s requires the field %s", credentialType, alternatives[0])
+		}
+	}
+	if credentialType == TypeOAuth2AuthCode {
+		if _, err := oauth2Endpoints(data); err != nil {
+			return err
+		}
+	}
+	if credentialType == "mqtt" {
+		return mqtt.ValidateURL(data["url"])
+	}
+	if credentialType == "amqp" {
+		return amqp.ValidateURL(data["url"])
+	}
+	return nil
+}
+
+// Encrypt encrypts the secret fields of a credential
+func Encrypt(data map[string]string) (string, error) {
+	key.RLock()
+	aead := key.aead
+	key.RUnlock()
+	if aead == nil {
+		return "", ErrNoKey
+	}
+
+	plaintext, err := json.Marshal(data)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, plaintext, nil)), nil
+}
+
+// Decrypt decrypts the secret fields of a credential
+func Decrypt(encrypted string) (map[string]string, error) {
+	key.RLock()
+	aead := key.aead
+	key.RUnlock()
+	if aead == nil {
+		return nil, ErrNoKey
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(encrypted)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return nil, errors.New("invalid credential data")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.New("failed to decrypt credential, was CREDENTIALS_KEY changed?")
+	}
+
+	var data map[string]string
+	if err := json.Unmarshal(plaintext, &data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// CheckExternal resolves the secret of a credential kept in the external secrets manager and
+// checks that it has the fields its type requires
+func CheckExternal(credentialType, ref string) error {
+	if !secrets.Enabled() {
+		return errors.New("external_ref requires a secrets manager (SECRETS_PROVIDER)")
+	}
+	if credentialType == TypeOAuth2AuthCode {
+		return errors.New("oauth2_authcode credentials store their tokens and cannot be kept in the secrets manager")
+	}
+	secrets.Invalidate(ref)
+	data, err := secrets.Get(context.Background(), ref)
+	if err != nil {
+		return err
+	}
+	return Validate(credentialType, data)
+}
+
+// external resolves a credential kept in the external secrets manager
+func external(credential models.Credential) (map[string]string, error) {
+	return secrets.Get(context.Background(), credential.ExternalRef)
+}
+
+// FieldNames returns the sorted names of the fields of a credential, for display without the secrets
+func FieldNames(credential *models.Credential) []string {
+	data, err := Decrypt(credential.Data)
+	if err != nil {
+		return []string{}
+	}
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve loads and decrypts a credential for a workflow of the given organization. Credentials
+// of other organizations are not available; credentials without organization are shared.
+// An empty credentialType accepts any type. Credentials kept in the external secrets manager are
+// resolved from there. The access token of oauth2_authcode credentials is
+// refreshed if it is about to expire.
+func Resolve(id uint, organizationID uint, credentialType string) (map[string]string, error) {
+	var credential models.Credential
+	if err := database.DB.First(&credential, id).Error; err != nil {
+		return nil, fmt.Errorf("credential %d not found", id)
+	}
+	if credential.OrganizationID != 0 && credential.OrganizationID != organizationID {
+		return nil, fmt.Errorf("credential %d not found", id)
+	}
+	if credentialType != "" && credential.CredentialType != credentialType {
+		return nil, fmt.Errorf("credential %d is not a %s credential", id, credentialType)
+	}
+	if credential.ExternalRef != "" {
+		return external(credential)
+	}
+	if credential.CredentialType == TypeOAuth2AuthCode {
+		return oauth2AccessData(credential.ID)
+	}
+	return Decrypt(credential.Data)
+}
+
+// Usages returns the nodes of active workflows and their published versions referencing the
+// credential by credential_id
+func Usages(id uint) ([]models.CredentialUsage, error) {
+	usages := []models.CredentialUsage{}
+	err := database.DB.Table("nodes").
+		Select("workflows.id AS workflow_id, workflows.name AS workflow_name, workflows.version AS workflow_version, nodes.id AS node_id, nodes.name AS node_name, nodes.node_type").
+		Joins("JOIN workflows ON workflows.id = nodes.workflow_id AND workflows.deleted_at IS NULL").
+		Where("nodes.config->>'credential_id' = ?", fmt.Sprint(id)).
+		Order("workflows.id, nodes.id").
+		Scan(&usages).Error
+	return usages, err
+}
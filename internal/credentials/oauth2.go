@@ -0,0 +1,378 @@
+package credentials
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TypeOAuth2AuthCode is the type of credentials authorized by a user through the OAuth2
+// authorization code flow
+const TypeOAuth2AuthCode = "oauth2_authcode"
+
+// refreshMargin refreshes access tokens this long before they expire
+const refreshMargin = time.Minute
+
+// oauth2Timeout limits the requests to the token endpoints
+const oauth2Timeout = 15 * time.Second
+
+// ErrNotAuthorized is returned for oauth2_authcode credentials no user has authorized yet
+var ErrNotAuthorized = errors.New("credential has not been authorized yet")
+
+// oauth2Provider holds the endpoints of a well-known OAuth2 provider
+type oauth2Provider struct {
+	authURL  string
+	tokenURL string
+	// params are added to the authorization URL, e.g. to get a refresh token
+	params map[string]string
+	// scopes are always requested, e.g. to get a refresh token
+	scopes []string
+}
+
+// oauth2Providers are the providers that need no endpoints configured on the credential.
+// {tenant} and {login_url} are replaced with the fields of the credential.
+var oauth2Providers = map[string]oauth2Provider{
+	"google": {
+		authURL:  "https://accounts.google.com/o/oauth2/v2/auth",
+		tokenURL: "https://oauth2.googleapis.com/token",
+		params:   map[string]string{"access_type": "offline", "prompt": "consent"},
+	},
+	"microsoft": {
+		authURL:  "https://login.microsoftonline.com/{tenant}/oauth2/v2.0/authorize",
+		tokenURL: "https://login.microsoftonline.com/{tenant}/oauth2/v2.0/token",
+		scopes:   []string{"offline_access"},
+	},
+	"salesforce": {
+		authURL:  "{login_url}/services/oauth2/authorize",
+		tokenURL: "{login_url}/services/oauth2/token",
+		scopes:   []string{"refresh_token"},
+	},
+}
+
+// oauth2Endpoints returns the provider of the credential with the endpoints of custom providers
+// (auth_url and token_url) and placeholders of well-known ones resolved
+func oauth2Endpoints(data map[string]string) (oauth2Provider, error) {
+	name := data["provider"]
+	if name == "" || name == "custom" {
+		if data["auth_url"] == "" || data["token_url"] == "" {
+			return oauth2Provider{}, errors.New("oauth2_authcode credentials require a provider (google, microsoft, salesforce) or auth_url and token_url")
+		}
+		return oauth2Provider{authURL: data["auth_url"], tokenURL: data["token_url"]}, nil
+	}
+
+	provider, ok := oauth2Providers[name]
+	if !ok {
+		return oauth2Provider{}, fmt.Errorf("unknown oauth2 provider: %s", name)
+	}
+	tenant := data["tenant"]
+	if tenant == "" {
+		tenant = "common"
+	}
+	loginURL := strings.TrimSuffix(data["login_url"], "/")
+	if loginURL == "" {
+		loginURL = "https://login.salesforce.com"
+	}
+	replacer := strings.NewReplacer("{tenant}", url.PathEscape(tenant), "{login_url}", loginURL)
+	provider.authURL = replacer.Replace(provider.authURL)
+	provider.tokenURL = replacer.Replace(provider.tokenURL)
+	return provider, nil
+}
+
+// requestedScopes returns the scopes configured on the credential and those the provider needs
+func (p oauth2Provider) requestedScopes(data map[string]string) []string {
+	scopes := strings.Fields(data["scopes"])
+	for _, scope := range p.scopes {
+		if !containsScope(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+var oauth2Config struct {
+	sync.RWMutex
+	redirectURL string
+}
+
+// OAuth2RedirectURLFromEnv returns the callback URL registered with the OAuth2 providers:
+// OAUTH2_REDIRECT_URL, or the callback below PUBLIC_URL
+func OAuth2RedirectURLFromEnv() string {
+	if redirectURL := os.Getenv("OAUTH2_REDIRECT_URL"); redirectURL != "" {
+		return redirectURL
+	}
+	if publicURL := os.Getenv("PUBLIC_URL"); publicURL != "" {
+		return strings.TrimSuffix(publicURL, "/") + "/api/auth/oauth2/callback"
+	}
+	return ""
+}
+
+// ConfigureOAuth2 sets the callback URL of the authorization code flow
+func ConfigureOAuth2(redirectURL string) {
+	oauth2Config.Lock()
+	oauth2Config.redirectURL = redirectURL
+	oauth2Config.Unlock()
+}
+
+// redirectURL returns the configured callback URL
+func redirectURL() (string, error) {
+	oauth2Config.RLock()
+	defer oauth2Config.RUnlock()
+	if oauth2Config.redirectURL == "" {
+		return "", errors.New("OAUTH2_REDIRECT_URL or PUBLIC_URL is not set")
+	}
+	return oauth2Config.redirectURL, nil
+}
+
+// AuthorizationURL returns the URL of the provider's consent page for the credential. state is
+// passed back to the callback and must identify the credential.
+func AuthorizationURL(credential models.Credential, state string) (string, error) {
+	if credential.CredentialType != TypeOAuth2AuthCode {
+		return "", fmt.Errorf("credential %d is not an %s credential", credential.ID, TypeOAuth2AuthCode)
+	}
+	data, err := Decrypt(credential.Data)
+	if err != nil {
+		return "", err
+	}
+	provider, err := oauth2Endpoints(data)
+	if err != nil {
+		return "", err
+	}
+	callback, err := redirectURL()
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", data["client_id"])
+	params.Set("redirect_uri", callback)
+	params.Set("state", state)
+	if scopes := provider.requestedScopes(data); len(scopes) > 0 {
+		params.Set("scope", strings.Join(scopes, " "))
+	}
+	for key, value := range provider.params {
+		params.Set(key, value)
+	}
+
+	separator := "?"
+	if strings.Contains(provider.authURL, "?") {
+		separator = "&"
+	}
+	return provider.authURL + separator + params.Encode(), nil
+}
+
+// SaveAuthorizationState records the nonce of an authorization of the credential that is started,
+// removing the expired states of abandoned authorizations
+func SaveAuthorizationState(credentialID uint, nonce string, expiresAt time.Time) error {
+	if err := database.DB.Where("expires_at <= ?", time.Now()).Delete(&models.OAuth2State{}).Error; err != nil {
+		return err
+	}
+	return database.DB.Create(&models.OAuth2State{CredentialID: credentialID, Nonce: nonce, ExpiresAt: expiresAt}).Error
+}
+
+// ConsumeAuthorizationState removes the state of an authorization of the credential, failing if
+// there is no such state because it expired or was used before
+func ConsumeAuthorizationState(credentialID uint, nonce string) error {
+	result := database.DB.Where("credential_id = ? AND nonce = ? AND expires_at > ?", credentialID, nonce, time.Now()).
+		Delete(&models.OAuth2State{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("authorization state expired or already used")
+	}
+	return nil
+}
+
+// oauth2Token is the response of a token endpoint
+type oauth2Token struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	Scope            string `json:"scope"`
+	InstanceURL      string `json:"instance_url"` // Salesforce
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// requestToken sends a token request with the client credentials of the credential
+func requestToken(ctx context.Context, provider oauth2Provider, data map[string]string, form url.Values) (*oauth2Token, error) {
+	form.Set("client_id", data["client_id"])
+	form.Set("client_secret", data["client_secret"])
+
+	ctx, cancel := context.WithTimeout(ctx, oauth2Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var token oauth2Token
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return nil, fmt.Errorf("failed to decode token response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || token.Error != "" {
+		return nil, fmt.Errorf("token request rejected: %s %s", token.Error, token.ErrorDescription)
+	}
+	if token.AccessToken == "" {
+		return nil, errors.New("token response contains no access_token")
+	}
+	return &token, nil
+}
+
+// storeToken stores the tokens of a token response on the credential. Providers that don't
+// rotate refresh tokens omit them when refreshing, and the granted scopes if they are unchanged.
+func storeToken(tx *gorm.DB, credential *models.Credential, data map[string]string, token *oauth2Token) error {
+	data["access_token"] = token.AccessToken
+	if token.RefreshToken != "" {
+		data["refresh_token"] = token.RefreshToken
+	}
+	if token.InstanceURL != "" {
+		data["instance_url"] = token.InstanceURL
+	}
+
+	encrypted, err := Encrypt(data)
+	if err != nil {
+		return err
+	}
+	credential.Data = encrypted
+	if token.Scope != "" {
+		credential.GrantedScopes = strings.Join(strings.Fields(strings.ReplaceAll(token.Scope, ",", " ")), " ")
+	}
+	credential.TokenExpiresAt = nil
+	if token.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+		credential.TokenExpiresAt = &expiresAt
+	}
+	return tx.Save(credential).Error
+}
+
+// CompleteAuthorization redeems the authorization code returned to the callback and stores the
+// tokens on the credential. The result lists the requested scopes the user did not grant.
+func CompleteAuthorization(ctx context.Context, credentialID uint, code string) (*models.OAuth2Authorization, error) {
+	var credential models.Credential
+	if err := database.DB.First(&credential, credentialID).Error; err != nil {
+		return nil, fmt.Errorf("credential %d not found", credentialID)
+	}
+	if credential.CredentialType != TypeOAuth2AuthCode {
+		return nil, fmt.Errorf("credential %d is not an %s credential", credential.ID, TypeOAuth2AuthCode)
+	}
+	data, err := Decrypt(credential.Data)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := oauth2Endpoints(data)
+	if err != nil {
+		return nil, err
+	}
+	callback, err := redirectURL()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", callback)
+	token, err := requestToken(ctx, provider, data, form)
+	if err != nil {
+		return nil, err
+	}
+
+	// A new authorization starts without the refresh token and scopes of the previous one
+	delete(data, "refresh_token")
+	credential.GrantedScopes = strings.Join(provider.requestedScopes(data), " ")
+	now := time.Now()
+	credential.AuthorizedAt = &now
+	if err := storeToken(database.DB, &credential, data, token); err != nil {
+		return nil, err
+	}
+
+	granted := strings.Fields(credential.GrantedScopes)
+	result := &models.OAuth2Authorization{Credential: credential, MissingScopes: []string{}}
+	for _, scope := range strings.Fields(data["scopes"]) {
+		if !containsScope(granted, scope) {
+			result.MissingScopes = append(result.MissingScopes, scope)
+		}
+	}
+	result.Credential.Fields = FieldNames(&credential)
+	return result, nil
+}
+
+// oauth2AccessData returns the fields of an authorized oauth2_authcode credential, refreshing
+// the access token first if it expires soon. The access token is also returned as "token", so
+// that the credential works wherever bearer credentials do.
+func oauth2AccessData(id uint) (map[string]string, error) {
+	var data map[string]string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the credential so that concurrent executions don't redeem the refresh token twice
+		var credential models.Credential
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&credential, id).Error; err != nil {
+			return err
+		}
+		var err error
+		if data, err = Decrypt(credential.Data); err != nil {
+			return err
+		}
+		if data["access_token"] == "" {
+			return ErrNotAuthorized
+		}
+
+		if credential.TokenExpiresAt == nil || time.Until(*credential.TokenExpiresAt) > refreshMargin {
+			return nil
+		}
+		if data["refresh_token"] == "" {
+			return fmt.Errorf("access token of credential %d expired and no refresh token was issued, authorize it again", id)
+		}
+
+		provider, err := oauth2Endpoints(data)
+		if err != nil {
+			return err
+		}
+		form := url.Values{}
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", data["refresh_token"])
+		token, err := requestToken(context.Background(), provider, data, form)
+		if err != nil {
+			return fmt.Errorf("failed to refresh the access token of credential %d: %v", id, err)
+		}
+		return storeToken(tx, &credential, data, token)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	data["token"] = data["access_token"]
+	return data, nil
+}
+
+// containsScope reports whether the scope is in the list
+func containsScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
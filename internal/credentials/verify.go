@@ -0,0 +1,259 @@
+package credentials
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/amqp"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/mqtt"
+	"github.com/altipard/flowcraft/internal/sqs"
+)
+
+// verifyTimeout limits how long the request verifying a credential may take
+const verifyTimeout = 15 * time.Second
+
+// maxVerifyResponse limits how much of the response of the service is read
+const maxVerifyResponse = 64 << 10
+
+// ErrNoTestURL is returned when a credential without a known service is verified without a URL
+var ErrNoTestURL = errors.New("credentials of this type need a url to be tested against")
+
+// Verify checks the secrets of a credential against its service: Jira and GitHub credentials
+// fetch the authenticated user, mqtt and amqp credentials connect to their broker, aws
+// credentials list the SQS queues of their region, other types send a GET
+// request with the secrets to the URL of the request (oauth2_authcode credentials with their
+// access token). Failures of the check are reported in the result, errors are only returned
+// for requests that cannot be made.
+func Verify(ctx context.Context, credential models.Credential, data map[string]string, request models.CredentialTestRequest) (*models.CredentialTestResult, error) {
+	headers := map[string]string{"Accept": "application/json"}
+	target := request.URL
+
+	switch credential.CredentialType {
+	case "jira":
+		target = strings.TrimSuffix(data["base_url"], "/") + "/rest/api/2/myself"
+		if data["api_token"] != "" {
+			headers["Authorization"] = basicAuth(data["email"], data["api_token"])
+		} else {
+			headers["Authorization"] = "Bearer " + data["token"]
+		}
+	case "github":
+		baseURL := strings.TrimSuffix(data["base_url"], "/")
+		if baseURL == "" {
+			baseURL = "https://api.github.com"
+		}
+		target = baseURL + "/user"
+		headers["Accept"] = "application/vnd.github+json"
+		headers["Authorization"] = "Bearer " + data["token"]
+	case "bearer":
+		headers["Authorization"] = "Bearer " + data["token"]
+	case "basic":
+		headers["Authorization"] = basicAuth(data["username"], data["password"])
+	case TypeOAuth2AuthCode:
+		if data["access_token"] == "" {
+			return nil, ErrNotAuthorized
+		}
+		headers["Authorization"] = "Bearer " + data["access_token"]
+	case "slack":
+		// The signing secret is only checked by requests of Slack, the bot token by the API
+		if data["bot_token"] == "" {
+			return nil, fmt.Errorf("slack credentials can only be tested with a bot_token")
+		}
+		target = "https://slack.com/api/auth.test"
+		headers["Authorization"] = "Bearer " + data["bot_token"]
+	case "mqtt":
+		return verifyMQTT(ctx, data), nil
+	case "amqp":
+		return verifyAMQP(ctx, data), nil
+	case "aws":
+		return verifyAWS(ctx, data), nil
+	case "api_key":
+		header := request.Header
+		if header == "" {
+			header = "X-API-Key"
+		}
+		headers[header] = data["api_key"]
+	default:
+		return nil, fmt.Errorf("unknown credential type: %s", credential.CredentialType)
+	}
+
+	if target == "" {
+		return nil, ErrNoTestURL
+	}
+	parsed, err := url.Parse(target)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid url: %s", target)
+	}
+
+	method := credential.CredentialType
+	if method != "jira" && method != "github" {
+		method = "http"
+	}
+	result := &models.CredentialTestResult{Method: method, URL: target}
+
+	ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	start := time.Now()
+	resp, err := http.DefaultClient.Do(req)
+	result.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Message = fmt.Sprintf("service not reachable: %v", err)
+		return result, nil
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxVerifyResponse))
+
+	result.StatusCode = resp.StatusCode
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		result.Message = fmt.Sprintf("credentials rejected with status %d", resp.StatusCode)
+	case resp.StatusCode >= 400:
+		result.Message = fmt.Sprintf("service responded with status %d", resp.StatusCode)
+	default:
+		result.Success = true
+		result.Message = "credentials accepted"
+		if user := authenticatedUser(credential.CredentialType, body); user != "" {
+			result.Message = "authenticated as " + user
+		}
+	}
+
+	// Error responses often explain what is wrong with the credentials
+	if !result.Success {
+		var details interface{}
+		if json.Unmarshal(body, &details) == nil {
+			result.Details = details
+		} else if len(body) > 0 {
+			result.Details = string(body)
+		}
+	}
+	return result, nil
+}
+
+// verifyMQTT connects to the broker of an mqtt credential with its login
+func verifyMQTT(ctx context.Context, data map[string]string) *models.CredentialTestResult {
+	result := &models.CredentialTestResult{Method: "mqtt", URL: data["url"]}
+
+	ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+	start := time.Now()
+	client, err := mqtt.Dial(ctx, mqtt.Options{
+		URL:          data["url"],
+		Username:     data["username"],
+		Password:     data["password"],
+		ClientID:     fmt.Sprintf("flowcraft-verify-%d", start.UnixNano()),
+		CleanSession: true,
+	})
+	result.DurationMs = time.Since(start).Milliseconds()
+	switch {
+	case mqtt.IsAuthError(err):
+		result.Message = fmt.Sprintf("credentials rejected: %v", err)
+	case err != nil:
+		result.Message = fmt.Sprintf("broker not reachable: %v", err)
+	default:
+		client.Close()
+		result.Success = true
+		result.Message = "connected to the broker"
+	}
+	return result
+}
+
+// verifyAMQP connects to the broker of an amqp credential with its login
+func verifyAMQP(ctx context.Context, data map[string]string) *models.CredentialTestResult {
+	result := &models.CredentialTestResult{Method: "amqp", URL: redactURL(data["url"])}
+
+	ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+	start := time.Now()
+	conn, err := amqp.Dial(ctx, amqp.Options{URL: data["url"], Username: data["username"], Password: data["password"]})
+	result.DurationMs = time.Since(start).Milliseconds()
+	switch {
+	case amqp.IsAuthError(err):
+		result.Message = fmt.Sprintf("credentials rejected: %v", err)
+	case err != nil:
+		result.Message = fmt.Sprintf("broker not reachable: %v", err)
+	default:
+		conn.Close()
+		result.Success = true
+		result.Message = "connected to the broker"
+	}
+	return result
+}
+
+// verifyAWS lists a queue of the region of an aws credential with its access keys
+func verifyAWS(ctx context.Context, data map[string]string) *models.CredentialTestResult {
+	client := sqs.Client{
+		AccessKeyID:     data["access_key_id"],
+		SecretAccessKey: data["secret_access_key"],
+		SessionToken:    data["session_token"],
+		Region:          data["region"],
+	}
+	result := &models.CredentialTestResult{Method: "aws"}
+
+	ctx, cancel := context.WithTimeout(ctx, verifyTimeout)
+	defer cancel()
+	start := time.Now()
+	_, err := client.ListQueues(ctx, 1)
+	result.DurationMs = time.Since(start).Milliseconds()
+	var sqsErr *sqs.Error
+	if errors.As(err, &sqsErr) {
+		result.StatusCode = sqsErr.StatusCode
+	}
+	switch {
+	case sqs.IsAuthError(err):
+		result.Message = fmt.Sprintf("credentials rejected: %v", err)
+	case err != nil:
+		result.Message = fmt.Sprintf("service not reachable: %v", err)
+	default:
+		result.Success = true
+		result.Message = "credentials accepted"
+	}
+	return result
+}
+
+// redactURL removes the password of a URL
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return parsed.Redacted()
+}
+
+// basicAuth returns the Authorization header value for HTTP basic authentication
+func basicAuth(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+// authenticatedUser returns the user a Jira or GitHub response describes
+func authenticatedUser(credentialType string, body []byte) string {
+	var user map[string]interface{}
+	if json.Unmarshal(body, &user) != nil {
+		return ""
+	}
+	keys := map[string][]string{
+		"jira":   {"emailAddress", "displayName", "name"},
+		"github": {"login"},
+	}[credentialType]
+	for _, key := range keys {
+		if value, _ := user[key].(string); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -4,36 +4,89 @@ import (
 	"log"
 
 	"github.com/altipard/flowcraft/internal/models"
-	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
 var DB *gorm.DB
 
-// Initialize establishes the connection to the database and performs migrations
+// migratedModels are the models whose tables are created and updated by Migrate
+var migratedModels = []interface{}{
+	&models.Workflow{},
+	&models.Node{},
+	&models.Connection{},
+	&models.WorkflowExecution{},
+	&models.NodeExecution{},
+	&models.NodeProfile{},
+	&models.LineageEdge{},
+	&models.ObservedOutputSchema{},
+	&models.NodeGroup{},
+	&models.Comment{},
+	&models.ExecutionBatch{},
+	&models.NodeType{},
+	&models.Trigger{},
+	&models.Organization{},
+	&models.Holiday{},
+	&models.UsageCounter{},
+	&models.User{},
+	&models.Session{},
+	&models.RefreshToken{},
+	&models.AuthToken{},
+	&models.CalendarToken{},
+	&models.Approval{},
+	&models.ApprovalDecision{},
+	&models.HumanTask{},
+	&models.OutputSink{},
+	&models.OutputDelivery{},
+	&models.WarehouseExport{},
+	&models.AlertRule{},
+	&models.Alert{},
+	&models.SLABreach{},
+	&models.DurationBaseline{},
+	&models.AnalysisCursor{},
+	&models.ExecutionShare{},
+	&models.StatusBadge{},
+	&models.Event{},
+	&models.EventSubscription{},
+	&models.StateEntry{},
+	&models.Credential{},
+	&models.OAuth2State{},
+	&models.WebhookDelivery{},
+	&models.ScheduledRun{},
+	&models.ExecutionChain{},
+	&models.ExecutionNote{},
+	&models.PayloadSchema{},
+	&models.ExecutionArtifact{},
+}
+
+// Initialize establishes the connection to the database and performs migrations. It waits up to
+// DATABASE_STARTUP_TIMEOUT for the database to accept connections.
 func Initialize(dsn string) {
-	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
+	if err := Connect(dsn, StartupTimeoutFromEnv()); err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
-
-	// Auto-migration for models
-	err = DB.AutoMigrate(
-		&models.Workflow{},
-		&models.Node{},
-		&models.Connection{},
-		&models.WorkflowExecution{},
-		&models.NodeExecution{},
-		&models.NodeType{},
-		&models.Trigger{},
-	)
-	if err != nil {
+	if err := Migrate(); err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
+}
+
+// Migrate creates and updates the tables of the models and registers the default node types.
+// Processes starting at the same time migrate one after the other, holding the migration lock.
+func Migrate() error {
+	return withMigrationLock(func() error {
+		// Foreign keys cannot reference partitioned execution tables (see PartitionExecutions)
+		if isPartitioned(DB, "workflow_executions") {
+			DB.Config.DisableForeignKeyConstraintWhenMigrating = true
+		}
+
+		// Auto-migration for models
+		if err := DB.AutoMigrate(migratedModels...); err != nil {
+			return err
+		}
 
-	// Register default node types
-	registerDefaultNodeTypes()
+		// Register default node types
+		registerDefaultNodeTypes()
+		return nil
+	})
 }
 
 // Registers the default node types in the database if they don't exist yet
@@ -45,7 +98,7 @@ func registerDefaultNodeTypes() {
 			Description:   "Executes HTTP requests",
 			Icon:          "globe",
 			Category:      "API",
-			ConfigSchema:  `{"properties":{"url":{"type":"string"},"method":{"type":"string","enum":["GET","POST","PUT","DELETE"]},"headers":{"type":"object"},"json_data":{"type":"object"}}}`,
+			ConfigSchema:  `{"properties":{"url":{"type":"string"},"method":{"type":"string","enum":["GET","POST","PUT","DELETE"]},"headers":{"type":"object"},"json_data":{"type":"object"},"reject_template_input":{"type":"boolean"},"cache_ttl":{"type":"string"},"cache_key":{"type":"string"}}}`,
 			InputSchema:   `{}`,
 			OutputSchema:  `{}`,
 			ExecutorClass: "httpRequest",
@@ -61,6 +114,17 @@ func registerDefaultNodeTypes() {
 			OutputSchema:  `{}`,
 			ExecutorClass: "filter",
 		},
+		{
+			Key:           "condition",
+			Name:          "If/Else",
+			Description:   "Continues with the true or false branch depending on a condition",
+			Icon:          "git-branch",
+			Category:      "Data Processing",
+			ConfigSchema:  `{"properties":{"field":{"type":"string"},"operator":{"type":"string","enum":["equals","not_equals","contains","not_contains","greater_than","greater_or_equal","less_than","less_or_equal","exists","not_exists","is_true","is_false"],"default":"equals"},"value":{}}}`,
+			InputSchema:   `{}`,
+			OutputSchema:  `{"handles":["true","false"]}`,
+			ExecutorClass: "condition",
+		},
 		{
 			Key:           "transform",
 			Name:          "Transform",
@@ -72,6 +136,149 @@ func registerDefaultNodeTypes() {
 			OutputSchema:  `{}`,
 			ExecutorClass: "transform",
 		},
+		{
+			Key:           "template",
+			Name:          "Template",
+			Description:   "Renders text or HTML documents from input data",
+			Icon:          "file-text",
+			Category:      "Data Processing",
+			ConfigSchema:  `{"properties":{"template":{"type":"string"},"templates":{"type":"object","additionalProperties":{"type":"string"}},"partials":{"type":"string"},"format":{"type":"string","enum":["text","html"],"default":"text"},"strict":{"type":"boolean"}}}`,
+			InputSchema:   `{}`,
+			OutputSchema:  `{}`,
+			ExecutorClass: "template",
+		},
+		{
+			Key:           "compression",
+			Name:          "Compression",
+			Description:   "Compresses and archives binary payloads",
+			Icon:          "archive",
+			Category:      "Data Processing",
+			ConfigSchema:  `{"properties":{"operation":{"type":"string","enum":["gzip","gunzip","zip","unzip"]},"source":{},"files":{"type":"array"},"name":{"type":"string"}}}`,
+			InputSchema:   `{}`,
+			OutputSchema:  `{}`,
+			ExecutorClass: "compression",
+		},
+		{
+			Key:           "approval",
+			Name:          "Approval",
+			Description:   "Pauses the execution until people approve or reject it",
+			Icon:          "user-check",
+			Category:      "Human",
+			ConfigSchema:  `{"properties":{"message":{"type":"string"},"assignees":{"type":"array","items":{"type":"string"}},"required_approvals":{"type":"integer","minimum":1,"default":2},"data":{"type":"object"}}}`,
+			InputSchema:   `{}`,
+			OutputSchema:  `{"handles":["approved","rejected"]}`,
+			ExecutorClass: "approval",
+		},
+		{
+			Key:           "humanTask",
+			Name:          "Human Task",
+			Description:   "Pauses the execution until a person completes a task",
+			Icon:          "clipboard-check",
+			Category:      "Human",
+			ConfigSchema:  `{"properties":{"title":{"type":"string"},"description":{"type":"string"},"assignees":{"type":"array","items":{"type":"string"}},"assignee_role":{"type":"string","enum":["admin","editor","viewer"]},"due_in":{"type":"string"},"data":{"type":"object"}}}`,
+			InputSchema:   `{}`,
+			OutputSchema:  `{}`,
+			ExecutorClass: "humanTask",
+		},
+		{
+			Key:           "emitEvent",
+			Name:          "Emit Event",
+			Description:   "Emits a named event other workflows can wait for",
+			Icon:          "broadcast",
+			Category:      "Events",
+			ConfigSchema:  `{"properties":{"name":{"type":"string"},"payload":{"type":"object"}}}`,
+			InputSchema:   `{}`,
+			OutputSchema:  `{}`,
+			ExecutorClass: "emitEvent",
+		},
+		{
+			Key:           "waitForEvent",
+			Name:          "Wait for Event",
+			Description:   "Pauses the execution until a matching event is emitted",
+			Icon:          "hourglass",
+			Category:      "Events",
+			ConfigSchema:  `{"properties":{"name":{"type":"string"},"match":{"type":"object"},"timeout":{"type":"string","default":"24h"},"lookback":{"type":"string"}}}`,
+			InputSchema:   `{}`,
+			OutputSchema:  `{"handles":["received","timeout"]}`,
+			ExecutorClass: "waitForEvent",
+		},
+		{
+			Key:           "state",
+			Name:          "State",
+			Description:   "Reads and writes the key-value state store",
+			Icon:          "database",
+			Category:      "Data Processing",
+			ConfigSchema:  `{"properties":{"operation":{"type":"string","enum":["get","set","incr","delete","check"]},"scope":{"type":"string","enum":["workflow","trigger","global"],"default":"workflow"},"key":{"type":"string"},"value":{},"delta":{"type":"number","default":1},"ttl":{"type":"string"}}}`,
+			InputSchema:   `{}`,
+			OutputSchema:  `{"handles":["found","missing"]}`,
+			ExecutorClass: "state",
+		},
+		{
+			Key:           "cache",
+			Name:          "Cache",
+			Description:   "Reads and writes cached values",
+			Icon:          "bolt",
+			Category:      "Data Processing",
+			ConfigSchema:  `{"properties":{"operation":{"type":"string","enum":["get","set","delete"]},"key":{"type":"string"},"value":{},"ttl":{"type":"string","default":"1h"}}}`,
+			InputSchema:   `{}`,
+			OutputSchema:  `{"handles":["hit","miss"]}`,
+			ExecutorClass: "cache",
+		},
+		{
+			Key:           "jira",
+			Name:          "Jira",
+			Description:   "Creates, updates and searches Jira issues",
+			Icon:          "ticket",
+			Category:      "Integrations",
+			ConfigSchema:  `{"properties":{"credential_id":{"type":"integer"},"operation":{"type":"string","enum":["create","update","search"]},"project":{"type":"string"},"issue_type":{"type":"string","default":"Task"},"issue_key":{"type":"string"},"summary":{"type":"string"},"description":{"type":"string"},"labels":{"type":"array","items":{"type":"string"}},"fields":{"type":"object"},"jql":{"type":"string"},"fields_list":{"type":"array","items":{"type":"string"}},"max_results":{"type":"integer","default":100,"maximum":1000}}}`,
+			InputSchema:   `{}`,
+			OutputSchema:  `{}`,
+			ExecutorClass: "jira",
+		},
+		{
+			Key:           "github",
+			Name:          "GitHub",
+			Description:   "Creates, updates, comments on and searches GitHub issues and pull requests",
+			Icon:          "github",
+			Category:      "Integrations",
+			ConfigSchema:  `{"properties":{"credential_id":{"type":"integer"},"operation":{"type":"string","enum":["create_issue","update_issue","create_comment","search_issues"]},"owner":{"type":"string"},"repo":{"type":"string"},"number":{"type":"integer"},"title":{"type":"string"},"body":{"type":"string"},"state":{"type":"string","enum":["open","closed"]},"labels":{"type":"array","items":{"type":"string"}},"assignees":{"type":"array","items":{"type":"string"}},"query":{"type":"string"},"max_results":{"type":"integer","default":100,"maximum":1000}}}`,
+			InputSchema:   `{}`,
+			OutputSchema:  `{}`,
+			ExecutorClass: "github",
+		},
+		{
+			Key:           "slackRespond",
+			Name:          "Respond to Slack",
+			Description:   "Responds to the Slack slash command or interaction that started the execution",
+			Icon:          "message-square",
+			Category:      "Integrations",
+			ConfigSchema:  `{"properties":{"text":{"type":"string"},"blocks":{"type":"array"},"response_type":{"type":"string","enum":["ephemeral","in_channel"],"default":"ephemeral"},"replace_original":{"type":"boolean"},"response_url":{"type":"string"}}}`,
+			InputSchema:   `{}`,
+			OutputSchema:  `{}`,
+			ExecutorClass: "slackRespond",
+		},
+		{
+			Key:           "mqttPublish",
+			Name:          "MQTT Publish",
+			Description:   "Publishes a message to a topic of an MQTT broker",
+			Icon:          "radio",
+			Category:      "Integrations",
+			ConfigSchema:  `{"properties":{"credential_id":{"type":"integer"},"topic":{"type":"string"},"payload":{},"qos":{"type":"integer","enum":[0,1,2],"default":1},"retain":{"type":"boolean"}}}`,
+			InputSchema:   `{}`,
+			OutputSchema:  `{}`,
+			ExecutorClass: "mqttPublish",
+		},
+		{
+			Key:           models.NodeTypeAnnotation,
+			Name:          "Sticky Note",
+			Description:   "Documents a section of the workflow on the canvas, not executed",
+			Icon:          "sticky-note",
+			Category:      "Canvas",
+			ConfigSchema:  `{"properties":{"content":{"type":"string","format":"markdown"},"color":{"type":"string","enum":["yellow","blue","green","pink","purple","gray"],"default":"yellow"},"width":{"type":"number","default":240},"height":{"type":"number","default":160}}}`,
+			InputSchema:   `{}`,
+			OutputSchema:  `{}`,
+			ExecutorClass: "",
+		},
 	}
 
 	// Register node types in the database if they don't exist yet
@@ -0,0 +1,327 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/models"
+	"gorm.io/gorm"
+)
+
+// partitionedTables are the execution tables partitioned by month of their creation
+var partitionedTables = []string{"workflow_executions", "node_executions"}
+
+// PartitionConfig holds the settings of the partitioning of execution data
+type PartitionConfig struct {
+	// Enabled converts the execution tables to tables partitioned by month
+	Enabled bool
+	// Ahead is the number of months partitions are created for in advance
+	Ahead int
+	// RetentionMonths is the number of past months kept, older partitions are dropped; 0 keeps all
+	RetentionMonths int
+}
+
+// PartitionConfigFromEnv reads the partitioning settings from the environment
+func PartitionConfigFromEnv() PartitionConfig {
+	cfg := PartitionConfig{
+		Enabled: os.Getenv("EXECUTION_PARTITIONING") == "true",
+		Ahead:   3,
+	}
+	if months, err := strconv.Atoi(os.Getenv("EXECUTION_RETENTION_MONTHS")); err == nil && months > 0 {
+		cfg.RetentionMonths = months
+	}
+	return cfg
+}
+
+// isPartitioned reports whether the table is a partitioned table
+func isPartitioned(db *gorm.DB, table string) bool {
+	var count int64
+	db.Raw("SELECT COUNT(*) FROM pg_partitioned_table WHERE partrelid = to_regclass(?)", table).Scan(&count)
+	return count > 0
+}
+
+// PartitionExecutions converts the execution tables to tables partitioned by month of created_at
+// and creates the partitions of the coming months. Existing rows stay in place: the old table is
+// attached as the partition of everything up to the end of the current month. Foreign keys
+// referencing the tables are dropped, since they would require unique execution IDs across all
+// partitions.
+func PartitionExecutions(cfg PartitionConfig) error {
+	if !cfg.Enabled {
+		return nil
+	}
+	return withMigrationLock(func() error {
+		return partitionExecutions(cfg)
+	})
+}
+
+// partitionExecutions partitions the execution tables, holding the migration lock
+func partitionExecutions(cfg PartitionConfig) error {
+	for _, table := range partitionedTables {
+		if isPartitioned(DB, table) {
+			continue
+		}
+		if err := DB.Transaction(func(tx *gorm.DB) error {
+			// Servers and workers starting at the same time convert the table only once
+			if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", table).Error; err != nil {
+				return err
+			}
+			if isPartitioned(tx, table) {
+				return nil
+			}
+			log.Printf("Converting %s to a partitioned table", table)
+			return convertToPartitioned(tx, table)
+		}); err != nil {
+			return fmt.Errorf("failed to partition %s: %v", table, err)
+		}
+	}
+
+	// Create the indexes of the models on the partitioned tables, attaching the existing ones
+	DB.Config.DisableForeignKeyConstraintWhenMigrating = true
+	if err := DB.AutoMigrate(&models.WorkflowExecution{}, &models.NodeExecution{}); err != nil {
+		return err
+	}
+
+	return CreatePartitions(time.Now(), cfg.Ahead)
+}
+
+// convertToPartitioned replaces the table by a partitioned table with the old table as its first partition
+func convertToPartitioned(tx *gorm.DB, table string) error {
+	legacy := table + "_legacy"
+
+	// Partition keys cannot be NULL; rows created before the column existed use their start time
+	statements := []string{
+		fmt.Sprintf(`UPDATE %s SET created_at = COALESCE(started_at, now()) WHERE created_at IS NULL`, table),
+		fmt.Sprintf(`ALTER TABLE %s ALTER COLUMN created_at SET NOT NULL`, table),
+	}
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+
+	var foreignKeys []struct {
+		Table string
+		Name  string
+	}
+	err := tx.Raw(`SELECT conrelid::regclass::text AS "table", conname AS name FROM pg_constraint
+		WHERE contype = 'f' AND (confrelid = to_regclass(?) OR conrelid = to_regclass(?))`, table, table).
+		Scan(&foreignKeys).Error
+	if err != nil {
+		return err
+	}
+	for _, fk := range foreignKeys {
+		if err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s DROP CONSTRAINT IF EXISTS %q`, fk.Table, fk.Name)).Error; err != nil {
+			return err
+		}
+	}
+
+	// Free the names of the constraints and indexes for the partitioned table
+	var indexes []string
+	if err := tx.Raw(`SELECT indexname FROM pg_indexes WHERE schemaname = current_schema() AND tablename = ?`, table).Scan(&indexes).Error; err != nil {
+		return err
+	}
+	var sequence string
+	if err := tx.Raw(`SELECT pg_get_serial_sequence(?, 'id')`, table).Scan(&sequence).Error; err != nil {
+		return err
+	}
+
+	var upper time.Time
+	if err := tx.Raw(fmt.Sprintf(`SELECT GREATEST(COALESCE(MAX(created_at), now()), now()) FROM %s`, table)).Scan(&upper).Error; err != nil {
+		return err
+	}
+	upper = monthStart(upper).AddDate(0, 1, 0)
+
+	statements = []string{
+		fmt.Sprintf(`ALTER TABLE %s RENAME TO %s`, table, legacy),
+	}
+	for _, index := range indexes {
+		statements = append(statements, fmt.Sprintf(`ALTER INDEX %q RENAME TO %q`, index, index+"_legacy"))
+	}
+	statements = append(statements,
+		fmt.Sprintf(`CREATE TABLE %s (LIKE %s INCLUDING DEFAULTS INCLUDING CONSTRAINTS) PARTITION BY RANGE (created_at)`, table, legacy),
+		fmt.Sprintf(`ALTER TABLE %s ADD PRIMARY KEY (id, created_at)`, table),
+		fmt.Sprintf(`ALTER TABLE %s ATTACH PARTITION %s FOR VALUES FROM (MINVALUE) TO ('%s')`, table, legacy, upper.Format(time.RFC3339)),
+	)
+	if sequence != "" {
+		statements = append(statements, fmt.Sprintf(`ALTER SEQUENCE %s OWNED BY %s.id`, sequence, table))
+	}
+
+	for _, statement := range statements {
+		if err := tx.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// monthStart returns the start of the month of t in UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// partitionName returns the name of the partition of the table for the month starting at start
+func partitionName(table string, start time.Time) string {
+	return fmt.Sprintf("%s_p%s", table, start.Format("2006_01"))
+}
+
+// CreatePartitions creates the monthly partitions of the execution tables from the month of now
+// up to the given number of months ahead. Months covered by an existing partition are skipped.
+func CreatePartitions(now time.Time, ahead int) error {
+	for _, table := range partitionedTables {
+		if !isPartitioned(DB, table) {
+			continue
+		}
+
+		for i := 0; i <= ahead; i++ {
+			start := monthStart(now).AddDate(0, i, 0)
+			end := start.AddDate(0, 1, 0)
+
+			covered, err := partitionCovers(table, start)
+			if err != nil {
+				return err
+			}
+			if covered {
+				continue
+			}
+
+			err = DB.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s PARTITION OF %s FOR VALUES FROM ('%s') TO ('%s')`,
+				partitionName(table, start), table, start.Format(time.RFC3339), end.Format(time.RFC3339))).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// partitionCovers reports whether a partition of the table contains the given time
+func partitionCovers(table string, t time.Time) (bool, error) {
+	partitions, err := partitionBounds(table)
+	if err != nil {
+		return false, err
+	}
+	for _, partition := range partitions {
+		if (partition.from.IsZero() || !t.Before(partition.from)) && t.Before(partition.to) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// partition is a partition of a table with its range, from is zero for MINVALUE
+type partition struct {
+	name     string
+	from, to time.Time
+}
+
+// boundPattern matches the range of a partition as rendered by pg_get_expr
+var boundPattern = regexp.MustCompile(`FROM \((MINVALUE|'[^']+')\) TO \('([^']+)'\)`)
+
+// partitionBounds returns the partitions of the table with their ranges
+func partitionBounds(table string) ([]partition, error) {
+	var rows []struct {
+		Name  string
+		Bound string
+	}
+	err := DB.Raw(`SELECT c.relname AS name, pg_get_expr(c.relpartbound, c.oid) AS bound
+		FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = to_regclass(?)`, table).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var partitions []partition
+	for _, row := range rows {
+		match := boundPattern.FindStringSubmatch(row.Bound)
+		if match == nil {
+			continue
+		}
+		p := partition{name: row.Name}
+		if match[1] != "MINVALUE" {
+			if p.from, err = parseBound(match[1][1 : len(match[1])-1]); err != nil {
+				return nil, err
+			}
+		}
+		if p.to, err = parseBound(match[2]); err != nil {
+			return nil, err
+		}
+		partitions = append(partitions, p)
+	}
+	return partitions, nil
+}
+
+// parseBound parses a timestamp rendered by Postgres in a partition bound
+func parseBound(value string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05-07", "2006-01-02 15:04:05-07:00", "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid partition bound: %s", value)
+}
+
+// DropPartitionsBefore drops the partitions of the execution tables containing only rows created
+// before the cutoff. Dropping a partition removes its rows instantly, unlike DELETE. Returns the
+// names of the dropped partitions.
+func DropPartitionsBefore(cutoff time.Time) ([]string, error) {
+	var dropped []string
+	for _, table := range partitionedTables {
+		if !isPartitioned(DB, table) {
+			continue
+		}
+
+		partitions, err := partitionBounds(table)
+		if err != nil {
+			return dropped, err
+		}
+		for _, partition := range partitions {
+			if partition.to.After(cutoff) {
+				continue
+			}
+			if err := DB.Exec(fmt.Sprintf(`DROP TABLE %q`, partition.name)).Error; err != nil {
+				return dropped, err
+			}
+			dropped = append(dropped, partition.name)
+		}
+	}
+	return dropped, nil
+}
+
+// MaintainPartitions creates upcoming partitions and drops the ones past the retention period at
+// the given interval until ctx is done
+func MaintainPartitions(ctx context.Context, cfg PartitionConfig, interval time.Duration) {
+	if !cfg.Enabled {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		if err := CreatePartitions(now, cfg.Ahead); err != nil {
+			log.Printf("Failed to create execution partitions: %v", err)
+		}
+		if cfg.RetentionMonths > 0 {
+			dropped, err := DropPartitionsBefore(monthStart(now).AddDate(0, -cfg.RetentionMonths, 0))
+			if err != nil {
+				log.Printf("Failed to drop execution partitions: %v", err)
+			}
+			for _, name := range dropped {
+				log.Printf("Dropped execution partition %s", name)
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package database
+
+import (
+	"os"
+	"strings"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+// replicaResolver is the name of the resolver routing reads to the replicas. It is only used by
+// queries started with Replica, all other queries keep using the primary.
+const replicaResolver = "replicas"
+
+var replicasConfigured bool
+
+// ReplicasFromEnv returns the connection strings of the read replicas (DATABASE_REPLICA_URLS,
+// comma separated)
+func ReplicasFromEnv() []string {
+	var dsns []string
+	for _, dsn := range strings.Split(os.Getenv("DATABASE_REPLICA_URLS"), ",") {
+		if dsn = strings.TrimSpace(dsn); dsn != "" {
+			dsns = append(dsns, dsn)
+		}
+	}
+	return dsns
+}
+
+// ConfigureReplicas registers read replicas for the queries started with Replica. Reads are
+// distributed randomly across the replicas.
+func ConfigureReplicas(dsns []string) error {
+	if len(dsns) == 0 {
+		return nil
+	}
+
+	dialectors := make([]gorm.Dialector, len(dsns))
+	for i, dsn := range dsns {
+		dialectors[i] = postgres.Open(dsn)
+	}
+
+	err := DB.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: dialectors,
+		Policy:   dbresolver.RandomPolicy{},
+	}, replicaResolver))
+	if err != nil {
+		return err
+	}
+
+	replicasConfigured = true
+	return nil
+}
+
+// Replica returns a query reading from a replica if replicas are configured, and from the primary
+// otherwise. It is meant for read-heavy endpoints that tolerate replication lag, e.g. history and
+// statistics; writes made through it still go to the primary.
+func Replica() *gorm.DB {
+	if !replicasConfigured {
+		return DB
+	}
+	return DB.Clauses(dbresolver.Use(replicaResolver))
+}
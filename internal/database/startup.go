@@ -0,0 +1,132 @@
+package database
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// migrationLock is the name of the advisory lock held while migrating the schema
+const migrationLock = "flowcraft:migrate"
+
+// startupPollInterval is how often processes check whether the database or schema became ready
+const startupPollInterval = 2 * time.Second
+
+// StartupTimeoutFromEnv reads how long processes wait for the database when starting
+func StartupTimeoutFromEnv() time.Duration {
+	if timeout, err := time.ParseDuration(os.Getenv("DATABASE_STARTUP_TIMEOUT")); err == nil && timeout > 0 {
+		return timeout
+	}
+	return 2 * time.Minute
+}
+
+// Connect establishes the connection to the database, retrying until it accepts connections or
+// the timeout passed, e.g. while the database container is still starting
+func Connect(dsn string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		if err == nil {
+			DB = db
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+		log.Printf("Waiting for the database: %v", err)
+		time.Sleep(startupPollInterval)
+	}
+}
+
+// withMigrationLock runs fn while holding the migration lock, waiting for other processes
+// migrating the schema. The lock is held by a session, so it is released if the process dies.
+func withMigrationLock(fn func() error) error {
+	return DB.Connection(func(conn *gorm.DB) error {
+		if err := conn.Exec("SELECT pg_advisory_lock(hashtext(?))", migrationLock).Error; err != nil {
+			return fmt.Errorf("failed to acquire migration lock: %v", err)
+		}
+		defer conn.Exec("SELECT pg_advisory_unlock(hashtext(?))", migrationLock)
+		return fn()
+	})
+}
+
+// WaitForSchema waits until the tables and columns of all models exist and no process is
+// migrating the schema, for processes leaving the migrations to the server
+func WaitForSchema(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	logged := false
+	for {
+		missing, err := missingColumns()
+		if err == nil && len(missing) == 0 {
+			var free bool
+			err = DB.Transaction(func(tx *gorm.DB) error {
+				return tx.Raw("SELECT pg_try_advisory_xact_lock(hashtext(?))", migrationLock).Scan(&free).Error
+			})
+			if err == nil && free {
+				return nil
+			}
+			if err == nil {
+				missing = []string{"migration in progress"}
+			}
+		}
+
+		if time.Now().After(deadline) {
+			if err != nil {
+				return err
+			}
+			return fmt.Errorf("schema not ready after %s: %s", timeout, summarize(missing))
+		}
+		if !logged {
+			log.Printf("Waiting for the schema to be migrated by the server: %s", summarize(missing))
+			logged = true
+		}
+		time.Sleep(startupPollInterval)
+	}
+}
+
+// missingColumns returns the columns of the models missing in the database as table.column
+func missingColumns() ([]string, error) {
+	var columns []struct {
+		TableName  string
+		ColumnName string
+	}
+	err := DB.Raw(`SELECT table_name, column_name FROM information_schema.columns
+		WHERE table_schema = current_schema()`).Scan(&columns).Error
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		existing[column.TableName+"."+column.ColumnName] = true
+	}
+
+	var missing []string
+	for _, model := range migratedModels {
+		stmt := &gorm.Statement{DB: DB}
+		if err := stmt.Parse(model); err != nil {
+			return nil, err
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" || field.IgnoreMigration {
+				continue
+			}
+			if column := stmt.Schema.Table + "." + field.DBName; !existing[column] {
+				missing = append(missing, column)
+			}
+		}
+	}
+	return missing, nil
+}
+
+// summarize lists the first few missing columns
+func summarize(missing []string) string {
+	if len(missing) > 5 {
+		return fmt.Sprintf("%s and %d more", strings.Join(missing[:5], ", "), len(missing)-5)
+	}
+	return strings.Join(missing, ", ")
+}
@@ -0,0 +1,249 @@
+// Package dependencies determines which workflows, credentials, state keys and triggers a
+// workflow depends on or is used by, before shared resources are changed or deleted
+package dependencies
+
+import (
+	"encoding/json"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/graphcache"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/state"
+)
+
+// statePlaceholder matches state store references in templates, e.g. "{{$state.global.counter}}"
+var statePlaceholder = regexp.MustCompile(`\$state\.(global|workflow|trigger)\.([A-Za-z0-9_\-.]+)`)
+
+// variable identifies a key of the state store
+type variable struct {
+	scope, key string
+}
+
+// node is a node with its parsed configuration and executor class
+type node struct {
+	models.Node
+	executorClass string
+	config        map[string]interface{}
+}
+
+// loadNodes parses the configuration and resolves the executor class of the queried nodes
+func loadNodes(query func() []models.Node) []node {
+	var nodes []node
+	for _, n := range query() {
+		parsed := node{Node: n}
+		if nodeType, err := graphcache.NodeType(n.NodeType); err == nil {
+			parsed.executorClass = nodeType.ExecutorClass
+		}
+		json.Unmarshal([]byte(n.Config), &parsed.config)
+		nodes = append(nodes, parsed)
+	}
+	return nodes
+}
+
+// eventName returns the event name configured on emitEvent and waitForEvent nodes
+func (n node) eventName() string {
+	name, _ := n.config["name"].(string)
+	return strings.TrimSpace(name)
+}
+
+// Analyze returns the dependencies of the workflow
+func Analyze(workflow models.Workflow) (*models.WorkflowDependencies, error) {
+	deps := &models.WorkflowDependencies{
+		WorkflowID:    workflow.ID,
+		Calls:         []models.WorkflowReference{},
+		CalledBy:      []models.WorkflowReference{},
+		EmittedEvents: []string{},
+		AwaitedEvents: []string{},
+		Credentials:   []models.CredentialReference{},
+		Variables:     []models.VariableReference{},
+		Triggers:      []models.TriggerReference{},
+		Versions:      []models.WorkflowReference{},
+	}
+
+	nodes := loadNodes(func() []models.Node {
+		var nodes []models.Node
+		database.DB.Where("workflow_id = ?", workflow.ID).Order("id").Find(&nodes)
+		return nodes
+	})
+
+	emitted := map[string]bool{}
+	awaited := map[string]bool{}
+	credentialNodes := map[uint][]uint{}
+	variableNodes := map[variable][]uint{}
+	for _, n := range nodes {
+		switch n.executorClass {
+		case "emitEvent":
+			if name := n.eventName(); name != "" {
+				emitted[name] = true
+			}
+		case "waitForEvent":
+			if name := n.eventName(); name != "" {
+				awaited[name] = true
+			}
+		case "state":
+			scope, _ := n.config["scope"].(string)
+			if scope == "" {
+				scope = state.ScopeWorkflow
+			}
+			if key, _ := n.config["key"].(string); key != "" {
+				v := variable{scope, key}
+				variableNodes[v] = appendID(variableNodes[v], n.ID)
+			}
+		}
+
+		if id, ok := n.config["credential_id"].(float64); ok && id > 0 {
+			credentialNodes[uint(id)] = appendID(credentialNodes[uint(id)], n.ID)
+		}
+
+		for _, match := range statePlaceholder.FindAllStringSubmatch(n.Config, -1) {
+			v := variable{match[1], match[2]}
+			variableNodes[v] = appendID(variableNodes[v], n.ID)
+		}
+	}
+	deps.EmittedEvents = sortedKeys(emitted)
+	deps.AwaitedEvents = sortedKeys(awaited)
+
+	// Workflows on the other side of the events
+	if len(emitted) > 0 || len(awaited) > 0 {
+		var classes []string
+		if len(emitted) > 0 {
+			classes = append(classes, "waitForEvent")
+		}
+		if len(awaited) > 0 {
+			classes = append(classes, "emitEvent")
+		}
+		others := loadNodes(func() []models.Node {
+			var nodeTypes []string
+			database.DB.Model(&models.NodeType{}).Where("executor_class IN ?", classes).Pluck("key", &nodeTypes)
+
+			var nodes []models.Node
+			database.DB.Joins("JOIN workflows ON workflows.id = nodes.workflow_id AND workflows.deleted_at IS NULL AND workflows.parent_id IS NULL").
+				Where("nodes.workflow_id <> ? AND nodes.node_type IN ?", workflow.ID, nodeTypes).
+				Order("nodes.id").Find(&nodes)
+			return nodes
+		})
+
+		calls := map[uint]*models.WorkflowReference{}
+		calledBy := map[uint]*models.WorkflowReference{}
+		for _, other := range others {
+			name := other.eventName()
+			switch {
+			case other.executorClass == "waitForEvent" && emitted[name]:
+				addReference(calls, other, name)
+			case other.executorClass == "emitEvent" && awaited[name]:
+				addReference(calledBy, other, name)
+			}
+		}
+		deps.Calls = references(calls)
+		deps.CalledBy = references(calledBy)
+	}
+
+	// Credentials
+	for id, nodeIDs := range credentialNodes {
+		ref := models.CredentialReference{ID: id, NodeIDs: nodeIDs}
+		var credential models.Credential
+		if database.DB.Limit(1).Find(&credential, id).RowsAffected == 0 {
+			ref.Missing = true
+		} else {
+			ref.Name = credential.Name
+			ref.CredentialType = credential.CredentialType
+		}
+		deps.Credentials = append(deps.Credentials, ref)
+	}
+	sort.Slice(deps.Credentials, func(i, j int) bool { return deps.Credentials[i].ID < deps.Credentials[j].ID })
+
+	// State keys
+	for v, nodeIDs := range variableNodes {
+		deps.Variables = append(deps.Variables, models.VariableReference{Scope: v.scope, Key: v.key, NodeIDs: nodeIDs})
+	}
+	sort.Slice(deps.Variables, func(i, j int) bool {
+		if deps.Variables[i].Scope != deps.Variables[j].Scope {
+			return deps.Variables[i].Scope < deps.Variables[j].Scope
+		}
+		return deps.Variables[i].Key < deps.Variables[j].Key
+	})
+
+	// Triggers
+	var triggers []models.Trigger
+	if err := database.DB.Where("workflow_id = ?", workflow.ID).Order("id").Find(&triggers).Error; err != nil {
+		return nil, err
+	}
+	for _, trigger := range triggers {
+		deps.Triggers = append(deps.Triggers, models.TriggerReference{
+			ID:          trigger.ID,
+			Name:        trigger.Name,
+			TriggerType: trigger.TriggerType,
+			IsActive:    trigger.IsActive,
+		})
+	}
+
+	// Published versions
+	var versions []models.Workflow
+	if err := database.DB.Where("parent_id = ?", workflow.ID).Order("version").Find(&versions).Error; err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		deps.Versions = append(deps.Versions, models.WorkflowReference{ID: version.ID, Name: version.Name, Version: version.Version})
+	}
+	if workflow.ParentID != nil {
+		var parent models.Workflow
+		if database.DB.Limit(1).Find(&parent, *workflow.ParentID).RowsAffected > 0 {
+			deps.Parent = &models.WorkflowReference{ID: parent.ID, Name: parent.Name}
+		}
+	}
+
+	return deps, nil
+}
+
+// addReference records that a node of another workflow is connected through the event
+func addReference(refs map[uint]*models.WorkflowReference, n node, event string) {
+	ref, ok := refs[n.WorkflowID]
+	if !ok {
+		ref = &models.WorkflowReference{ID: n.WorkflowID}
+		var workflow models.Workflow
+		if database.DB.Select("id", "name").Limit(1).Find(&workflow, n.WorkflowID).RowsAffected > 0 {
+			ref.Name = workflow.Name
+		}
+		refs[n.WorkflowID] = ref
+	}
+
+	ref.NodeIDs = appendID(ref.NodeIDs, n.ID)
+	for _, existing := range ref.Events {
+		if existing == event {
+			return
+		}
+	}
+	ref.Events = append(ref.Events, event)
+}
+
+// references returns the references ordered by workflow ID
+func references(refs map[uint]*models.WorkflowReference) []models.WorkflowReference {
+	list := make([]models.WorkflowReference, 0, len(refs))
+	for _, ref := range refs {
+		sort.Strings(ref.Events)
+		list = append(list, *ref)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+// appendID appends the ID unless it is already the last one
+func appendID(ids []uint, id uint) []uint {
+	if len(ids) > 0 && ids[len(ids)-1] == id {
+		return ids
+	}
+	return append(ids, id)
+}
+
+// sortedKeys returns the keys of the set in order
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,41 @@
+package dispatch
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// newChain creates the chain record starting the first of the workflows after the execution and
+// keeping the others for the executions that follow
+func newChain(executionID uint, workflowIDs []uint) *models.ExecutionChain {
+	then := make([]string, len(workflowIDs)-1)
+	for i, id := range workflowIDs[1:] {
+		then[i] = strconv.FormatUint(uint64(id), 10)
+	}
+
+	return &models.ExecutionChain{
+		WorkflowExecutionID: executionID,
+		TargetWorkflowID:    workflowIDs[0],
+		Then:                strings.Join(then, ","),
+		Status:              models.ChainPending,
+	}
+}
+
+// ParseChain parses a comma separated list of workflow IDs
+func ParseChain(value string) ([]uint, error) {
+	var ids []uint
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, uint(id))
+	}
+	return ids, nil
+}
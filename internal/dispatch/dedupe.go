@@ -0,0 +1,103 @@
+package dispatch
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/expression"
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+const (
+	// dedupeKeyPrefix prefixes the Redis keys of the requests accepted within dedupe windows
+	dedupeKeyPrefix = "flowcraft:dedupe:"
+	// defaultDedupeSeconds is the dedupe window of triggers with a dedupe key but no window
+	defaultDedupeSeconds = 24 * 60 * 60
+	// maxDedupeSeconds bounds the dedupe window of triggers
+	maxDedupeSeconds = 7 * 24 * 60 * 60
+)
+
+// DuplicateError is returned when a request has the dedupe key of a request accepted by the
+// trigger within its dedupe window
+type DuplicateError struct {
+	// ExecutionID is the execution started by the original request, 0 if it is still starting
+	ExecutionID uint
+}
+
+func (e *DuplicateError) Error() string {
+	if e.ExecutionID == 0 {
+		return "duplicate of a request being started"
+	}
+	return fmt.Sprintf("duplicate of the request that started execution %d", e.ExecutionID)
+}
+
+// ValidateDedupe checks the dedupe settings of a trigger and sets the default window
+func ValidateDedupe(trigger *models.Trigger) error {
+	if trigger.DedupeSeconds < 0 || trigger.DedupeSeconds > maxDedupeSeconds {
+		return fmt.Errorf("dedupe_seconds must be between 0 and %d", maxDedupeSeconds)
+	}
+	if trigger.DedupeKey == "" {
+		return nil
+	}
+	if !expression.ContainsTemplateSyntax(trigger.DedupeKey) {
+		return errors.New("dedupe_key must reference the input, e.g. {{ body.order_id }}")
+	}
+	if trigger.DedupeSeconds == 0 {
+		trigger.DedupeSeconds = defaultDedupeSeconds
+	}
+	return nil
+}
+
+// dedupeKey returns the Redis key of the trigger's dedupe key for the input, empty if the trigger
+// does not dedupe its requests or the input lacks a field of the key
+func dedupeKey(trigger models.Trigger, inputData map[string]interface{}) string {
+	if trigger.DedupeKey == "" || trigger.DedupeSeconds <= 0 {
+		return ""
+	}
+	if len(expression.Unresolved(trigger.DedupeKey, inputData, expression.Options{})) > 0 {
+		return ""
+	}
+	value, err := expression.Render(trigger.DedupeKey, inputData, nil, expression.Options{})
+	if err != nil || value == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(value))
+	return fmt.Sprintf("%s%d:%s", dedupeKeyPrefix, trigger.ID, hex.EncodeToString(sum[:]))
+}
+
+// claimDedupeKey records the dedupe key of a request for the trigger's dedupe window. It returns a
+// *DuplicateError if a request with the same key was accepted within the window. Requests are
+// let through if Redis is unavailable, since upstream systems redeliver anyway.
+func (d *Dispatcher) claimDedupeKey(trigger models.Trigger, key string) error {
+	ctx := context.Background()
+	client := d.queueClient.RedisClient()
+	window := time.Duration(trigger.DedupeSeconds) * time.Second
+	claimed, err := client.SetNX(ctx, key, 0, window).Result()
+	if err != nil {
+		log.Printf("Failed to check trigger %d for duplicates: %v", trigger.ID, err)
+		return nil
+	}
+	if claimed {
+		return nil
+	}
+
+	executionID, _ := client.Get(ctx, key).Uint64()
+	return &DuplicateError{ExecutionID: uint(executionID)}
+}
+
+// recordDedupeKey stores the execution started by the request with the dedupe key, or releases
+// the key if no execution was started, so that a redelivery is accepted
+func (d *Dispatcher) recordDedupeKey(trigger models.Trigger, key string, execution *models.WorkflowExecution) {
+	ctx := context.Background()
+	client := d.queueClient.RedisClient()
+	if execution == nil {
+		client.Del(ctx, key)
+		return
+	}
+	client.SetXX(ctx, key, execution.ID, time.Duration(trigger.DedupeSeconds)*time.Second)
+}
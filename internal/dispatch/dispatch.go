@@ -0,0 +1,244 @@
+// Package dispatch creates workflow executions and hands them to the worker queue
+package dispatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/maintenance"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/queue"
+	"github.com/altipard/flowcraft/internal/quota"
+	"github.com/altipard/flowcraft/internal/rollout"
+	"gorm.io/gorm"
+)
+
+// WorkflowTaskQueue is the queue the workers consume workflow tasks from
+const WorkflowTaskQueue = "workflow_tasks"
+
+// Dispatcher creates executions and enqueues them for the workers
+type Dispatcher struct {
+	queueClient *queue.QueueClient
+}
+
+// NewDispatcher creates a new Dispatcher
+func NewDispatcher(queueClient *queue.QueueClient) *Dispatcher {
+	return &Dispatcher{
+		queueClient: queueClient,
+	}
+}
+
+// Dispatch creates a pending execution of the workflow with the given input and enqueues it.
+// Returns a *quota.ExceededError if the workflow's organization has used up a quota.
+func (d *Dispatcher) Dispatch(workflow models.Workflow, inputData map[string]interface{}) (*models.WorkflowExecution, error) {
+	return d.dispatch(workflow, inputData, nil, nil, nil, false)
+}
+
+// DispatchChained creates and enqueues an execution that starts the given workflows one after
+// another once it completes successfully, each receiving the output of the previous execution
+func (d *Dispatcher) DispatchChained(workflow models.Workflow, inputData map[string]interface{}, chain []uint) (*models.WorkflowExecution, error) {
+	return d.dispatch(workflow, inputData, nil, nil, chain, false)
+}
+
+// DispatchProfiled creates and enqueues an execution like DispatchChained, recording the time and
+// allocation breakdown of each of its nodes
+func (d *Dispatcher) DispatchProfiled(workflow models.Workflow, inputData map[string]interface{}, chain []uint) (*models.WorkflowExecution, error) {
+	return d.dispatch(workflow, inputData, nil, nil, chain, true)
+}
+
+// DispatchTrigger creates and enqueues an execution started by a trigger of the workflow. Executions
+// held back by the trigger's concurrency, debounce or throttle settings are created as queued;
+// ErrDropped is returned if the throttle drops the request, a *DuplicateError if the trigger
+// accepted a request with the same dedupe key within its dedupe window. Workflows with a rollout
+// run their live or canary version.
+func (d *Dispatcher) DispatchTrigger(workflow models.Workflow, trigger models.Trigger, inputData map[string]interface{}) (*models.WorkflowExecution, error) {
+	workflow, err := rollout.Target(workflow)
+	if err != nil {
+		return nil, err
+	}
+
+	key := ""
+	if d.queueClient != nil {
+		key = dedupeKey(trigger, inputData)
+	}
+	if key != "" {
+		if err := d.claimDedupeKey(trigger, key); err != nil {
+			return nil, err
+		}
+	}
+
+	var execution *models.WorkflowExecution
+	if hasControls(trigger) {
+		execution, err = d.dispatchControlled(workflow, trigger, inputData)
+	} else {
+		execution, err = d.dispatch(workflow, inputData, nil, &trigger.ID, nil, false)
+	}
+	if key != "" {
+		d.recordDedupeKey(trigger, key, execution)
+	}
+	return execution, err
+}
+
+// DispatchBatch creates a batch for the inputs and dispatches one execution per input (mode
+// "per_item") or a single execution receiving all inputs as "items" (mode "single").
+// Dispatching stops at the first error; the executions created so far are returned with it.
+func (d *Dispatcher) DispatchBatch(workflow models.Workflow, items []map[string]interface{}, mode string) (*models.ExecutionBatch, []models.WorkflowExecution, error) {
+	batch, err := d.CreateBatch(workflow, mode, len(items))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if mode == "single" {
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			list[i] = item
+		}
+		items = []map[string]interface{}{{"items": list}}
+	}
+
+	var executions []models.WorkflowExecution
+	for _, item := range items {
+		execution, err := d.DispatchToBatch(workflow, item, batch)
+		if err != nil {
+			return batch, executions, err
+		}
+		executions = append(executions, *execution)
+	}
+
+	return batch, executions, nil
+}
+
+// CreateBatch creates an empty batch for executions of the workflow
+func (d *Dispatcher) CreateBatch(workflow models.Workflow, mode string, itemCount int) (*models.ExecutionBatch, error) {
+	batch := models.ExecutionBatch{
+		WorkflowID: workflow.ID,
+		Mode:       mode,
+		ItemCount:  itemCount,
+	}
+	if err := database.DB.Create(&batch).Error; err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// DispatchToBatch creates and enqueues an execution belonging to the batch
+func (d *Dispatcher) DispatchToBatch(workflow models.Workflow, inputData map[string]interface{}, batch *models.ExecutionBatch) (*models.WorkflowExecution, error) {
+	return d.dispatch(workflow, inputData, &batch.ID, nil, nil, false)
+}
+
+// dispatch creates and enqueues an execution, optionally as part of a batch, started by a trigger
+// or followed by a chain of workflows
+func (d *Dispatcher) dispatch(workflow models.Workflow, inputData map[string]interface{}, batchID, triggerID *uint, chain []uint, profile bool) (*models.WorkflowExecution, error) {
+	if inputData == nil {
+		inputData = make(map[string]interface{})
+	}
+
+	// Create workflow execution
+	execution := models.WorkflowExecution{
+		WorkflowID: workflow.ID,
+		Status:     "pending",
+		StartedAt:  time.Now(),
+		BatchID:    batchID,
+		TriggerID:  triggerID,
+		Profiling:  profile,
+	}
+	if maintenance.Enabled() {
+		execution.Status = StatusHeld
+	}
+
+	// Save input data as JSON
+	inputJSON, err := json.Marshal(inputData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input data: %v", err)
+	}
+	execution.InputData = string(inputJSON)
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := quota.Reserve(tx, workflow.OrganizationID, int64(len(inputJSON))); err != nil {
+			return err
+		}
+		if err := tx.Create(&execution).Error; err != nil {
+			return err
+		}
+
+		// Store the chain before the execution is queued, so that it cannot complete without it
+		if len(chain) > 0 {
+			return tx.Create(newChain(execution.ID, chain)).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Queue asynchronous execution, held executions are queued once maintenance mode ends
+	if execution.Status == StatusHeld {
+		return &execution, nil
+	}
+	if err := d.enqueueExecution(execution.ID); err != nil {
+		discard(execution, workflow.OrganizationID)
+		return nil, err
+	}
+
+	return &execution, nil
+}
+
+// discard removes an execution that could not be queued, along with its chain and its usage
+func discard(execution models.WorkflowExecution, organizationID uint) {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workflow_execution_id = ?", execution.ID).Delete(&models.ExecutionChain{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Delete(&execution).Error; err != nil {
+			return err
+		}
+		return quota.Release(tx, organizationID, execution.CreatedAt, int64(len(execution.InputData)))
+	})
+	if err != nil {
+		log.Printf("Failed to discard execution %d that could not be queued: %v", execution.ID, err)
+	}
+}
+
+// Resume enqueues the continuation of a waiting node with the given output handle and output
+func (d *Dispatcher) Resume(executionID, nodeID uint, handle string, output interface{}) error {
+	return d.queueClient.EnqueueTask(WorkflowTaskQueue, "resume_execution", map[string]interface{}{
+		"execution_id": executionID,
+		"node_id":      nodeID,
+		"handle":       handle,
+		"output":       output,
+	})
+}
+
+// Restart enqueues an interrupted or failed execution again. The engine continues from the
+// nodes completed before, retrying the others.
+func (d *Dispatcher) Restart(execution *models.WorkflowExecution) error {
+	execution.Status = "pending"
+	if maintenance.Enabled() {
+		execution.Status = StatusHeld
+	}
+	execution.ErrorMessage = ""
+	execution.CompletedAt = nil
+	// A new failure of the restarted execution needs to be triaged again
+	execution.TriageStatus = ""
+	execution.TriagedBy = nil
+	execution.TriagedAt = nil
+	if err := database.DB.Save(execution).Error; err != nil {
+		return err
+	}
+
+	// Chains skipped because the execution failed apply to the restarted execution again
+	err := database.DB.Model(&models.ExecutionChain{}).
+		Where("workflow_execution_id = ? AND status = ?", execution.ID, models.ChainSkipped).
+		Update("status", models.ChainPending).Error
+	if err != nil {
+		return err
+	}
+
+	if execution.Status == StatusHeld {
+		return nil
+	}
+	return d.enqueueExecution(execution.ID)
+}
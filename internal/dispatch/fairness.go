@@ -0,0 +1,43 @@
+package dispatch
+
+import (
+	"fmt"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/queue"
+)
+
+// enqueueExecution enqueues an execution for the workers. With a fair queue it is added to the
+// sub-queue of its organization or workflow, weighted by the organization's queue weight.
+func (d *Dispatcher) enqueueExecution(executionID uint) error {
+	payload := map[string]interface{}{
+		"execution_id": executionID,
+	}
+	fairness := queue.Fairness()
+	if fairness == "" {
+		return d.queueClient.EnqueueTask(WorkflowTaskQueue, "execute_workflow", payload)
+	}
+
+	// Executions of published versions belong to the workflow they were published from
+	var owner struct {
+		OrganizationID uint
+		WorkflowID     uint
+		QueueWeight    int
+	}
+	err := database.DB.Table("workflow_executions").
+		Select("workflows.organization_id, COALESCE(workflows.parent_id, workflows.id) AS workflow_id, "+
+			"COALESCE(organizations.queue_weight, 1) AS queue_weight").
+		Joins("JOIN workflows ON workflows.id = workflow_executions.workflow_id").
+		Joins("LEFT JOIN organizations ON organizations.id = workflows.organization_id").
+		Where("workflow_executions.id = ?", executionID).
+		Scan(&owner).Error
+	if err != nil {
+		return err
+	}
+
+	group := fmt.Sprintf("org:%d", owner.OrganizationID)
+	if fairness == queue.FairnessWorkflow {
+		group = fmt.Sprintf("workflow:%d", owner.WorkflowID)
+	}
+	return d.queueClient.EnqueueFairTask(WorkflowTaskQueue, group, owner.QueueWeight, "execute_workflow", payload)
+}
@@ -0,0 +1,46 @@
+package dispatch
+
+import (
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// StatusHeld is the status of executions created while maintenance mode is enabled
+const StatusHeld = "held"
+
+// releaseHeldBatch limits the number of held executions started at once
+const releaseHeldBatch = 500
+
+// releaseHeld starts the executions held back during maintenance in the order they were created
+func (d *Dispatcher) releaseHeld() error {
+	for {
+		var ids []uint
+		err := database.DB.Model(&models.WorkflowExecution{}).
+			Where("status = ?", StatusHeld).
+			Order("id").Limit(releaseHeldBatch).Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+
+		for _, id := range ids {
+			// Only one worker releases each execution
+			result := database.DB.Model(&models.WorkflowExecution{}).
+				Where("id = ? AND status = ?", id, StatusHeld).
+				Update("status", "pending")
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				continue
+			}
+
+			if err := d.enqueueExecution(id); err != nil {
+				return err
+			}
+		}
+
+		if len(ids) < releaseHeldBatch {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package dispatch
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/quota"
+	"gorm.io/gorm"
+)
+
+const (
+	// maxAutoRetries bounds the automatic retries of a failed execution
+	maxAutoRetries = 10
+	// defaultAutoRetryDelay is the delay before an automatic retry if the workflow sets none
+	defaultAutoRetryDelay = time.Minute
+)
+
+// ValidateRetryPolicy checks the automatic retry settings of a workflow
+func ValidateRetryPolicy(workflow *models.Workflow) error {
+	if workflow.AutoRetryMax < 0 || workflow.AutoRetryMax > maxAutoRetries {
+		return fmt.Errorf("auto_retry_max must be between 0 and %d", maxAutoRetries)
+	}
+	if workflow.AutoRetryDelay != "" {
+		delay, err := time.ParseDuration(workflow.AutoRetryDelay)
+		if err != nil || delay < time.Second || delay > 24*time.Hour {
+			return fmt.Errorf("invalid auto_retry_delay %q, expected a duration between 1s and 24h", workflow.AutoRetryDelay)
+		}
+	}
+	return nil
+}
+
+// autoRetryDelay returns the delay before the automatic retries of the workflow's executions
+func autoRetryDelay(workflow models.Workflow) time.Duration {
+	if delay, err := time.ParseDuration(workflow.AutoRetryDelay); err == nil && delay > 0 {
+		return delay
+	}
+	return defaultAutoRetryDelay
+}
+
+// Retry creates an execution retrying a failed execution with the same input, unless the
+// workflow's retry policy does not allow another retry; it returns nil then. The retry is queued
+// until the retry delay of the workflow passed and then started by ReleaseQueued. Retries are
+// not part of the batch or trigger of the failed execution, so they neither count against the
+// controls of the trigger nor are collapsed with its other requests.
+func Retry(execution *models.WorkflowExecution, workflow models.Workflow) (*models.WorkflowExecution, error) {
+	if execution.RetryAttempt >= workflow.AutoRetryMax {
+		return nil, nil
+	}
+
+	// Only one retry per failed execution, even if it is completed twice
+	var count int64
+	database.DB.Model(&models.WorkflowExecution{}).Where("retry_of_id = ?", execution.ID).Count(&count)
+	if count > 0 {
+		return nil, nil
+	}
+
+	until := time.Now().Add(autoRetryDelay(workflow))
+	retry := models.WorkflowExecution{
+		WorkflowID:   execution.WorkflowID,
+		Status:       StatusQueued,
+		StartedAt:    until,
+		QueuedUntil:  &until,
+		InputData:    execution.InputData,
+		RetryOfID:    &execution.ID,
+		RetryAttempt: execution.RetryAttempt + 1,
+	}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := quota.Reserve(tx, workflow.OrganizationID, int64(len(retry.InputData))); err != nil {
+			return err
+		}
+		return tx.Create(&retry).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &retry, nil
+}
+
+// releaseRetries starts the due queued executions without trigger, i.e. automatic retries
+func (d *Dispatcher) releaseRetries() error {
+	var ids []uint
+	err := database.DB.Model(&models.WorkflowExecution{}).
+		Where("status = ? AND queued_until <= ? AND trigger_id IS NULL", StatusQueued, time.Now()).
+		Order("id").Pluck("id", &ids).Error
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		// Only one worker releases each execution
+		result := database.DB.Model(&models.WorkflowExecution{}).
+			Where("id = ? AND status = ?", id, StatusQueued).
+			Updates(map[string]interface{}{"status": "pending", "started_at": time.Now()})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		if err := d.enqueueExecution(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package dispatch
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/maintenance"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/quota"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrDropped is returned when a request is dropped by the throttle of its trigger
+var ErrDropped = errors.New("execution dropped by the throttle of the trigger")
+
+// StatusQueued is the status of executions held back by the controls of their trigger
+const StatusQueued = "queued"
+
+// activeStatuses count against the concurrency limit of a trigger
+var activeStatuses = []string{"pending", "running", StatusHeld}
+
+// hasControls reports whether the trigger limits the executions it starts
+func hasControls(trigger models.Trigger) bool {
+	return trigger.MaxConcurrency > 0 || trigger.DebounceSeconds > 0 || trigger.ThrottleSeconds > 0
+}
+
+// dispatchControlled creates an execution for a trigger with concurrency, debounce or throttle
+// controls. Executions that may not start yet are created as queued and released by
+// ReleaseQueued; requests within a debounce window update the queued execution instead.
+func (d *Dispatcher) dispatchControlled(workflow models.Workflow, trigger models.Trigger, inputData map[string]interface{}) (*models.WorkflowExecution, error) {
+	if inputData == nil {
+		inputData = make(map[string]interface{})
+	}
+	inputJSON, err := json.Marshal(inputData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal input data: %v", err)
+	}
+
+	var execution models.WorkflowExecution
+	collapsed := false
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Serialize the dispatches of the trigger so that bursts are counted correctly
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.Trigger{}, trigger.ID).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		until := now
+
+		if trigger.DebounceSeconds > 0 {
+			until = now.Add(time.Duration(trigger.DebounceSeconds) * time.Second)
+			collapsed = tx.Where("trigger_id = ? AND status = ?", trigger.ID, StatusQueued).
+				Order("id DESC").Limit(1).Find(&execution).RowsAffected > 0
+		}
+
+		if trigger.ThrottleSeconds > 0 {
+			// The slot of an execution is its planned start while queued and its actual start afterwards
+			var last sql.NullTime
+			err := tx.Model(&models.WorkflowExecution{}).
+				Select("MAX(CASE WHEN status = ? THEN queued_until ELSE started_at END)", StatusQueued).
+				Where("trigger_id = ? AND id <> ?", trigger.ID, execution.ID).
+				Row().Scan(&last)
+			if err != nil {
+				return err
+			}
+			if last.Valid {
+				next := last.Time.Add(time.Duration(trigger.ThrottleSeconds) * time.Second)
+				if next.After(until) {
+					if trigger.ThrottleMode == "drop" && !collapsed {
+						return ErrDropped
+					}
+					until = next
+				}
+			}
+		}
+
+		if collapsed {
+			return tx.Model(&execution).Updates(map[string]interface{}{
+				"input_data":   string(inputJSON),
+				"queued_until": until,
+			}).Error
+		}
+
+		status := "pending"
+		if until.After(now) {
+			status = StatusQueued
+		} else if trigger.MaxConcurrency > 0 {
+			// Queue behind executions waiting for capacity to keep the order of the requests
+			var active, queued int64
+			tx.Model(&models.WorkflowExecution{}).Where("trigger_id = ? AND status IN ?", trigger.ID, activeStatuses).Count(&active)
+			tx.Model(&models.WorkflowExecution{}).Where("trigger_id = ? AND status = ?", trigger.ID, StatusQueued).Count(&queued)
+			if active >= int64(trigger.MaxConcurrency) || queued > 0 {
+				status = StatusQueued
+			}
+		}
+		if status == "pending" && maintenance.Enabled() {
+			status = StatusHeld
+		}
+
+		execution = models.WorkflowExecution{
+			WorkflowID: workflow.ID,
+			Status:     status,
+			StartedAt:  now,
+			TriggerID:  &trigger.ID,
+			InputData:  string(inputJSON),
+		}
+		if status == StatusQueued {
+			execution.QueuedUntil = &until
+		}
+		if err := quota.Reserve(tx, workflow.OrganizationID, int64(len(inputJSON))); err != nil {
+			return err
+		}
+		return tx.Create(&execution).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if collapsed {
+		return &execution, nil
+	}
+
+	if execution.Status == "pending" {
+		if err := d.enqueueExecution(execution.ID); err != nil {
+			discard(execution, workflow.OrganizationID)
+			return nil, err
+		}
+	}
+
+	return &execution, nil
+}
+
+// ReleaseQueued starts the queued executions that are due and whose trigger has capacity, the
+// due automatic retries of failed executions and the executions held back during maintenance
+// once it ended, at the given interval until ctx is done
+func (d *Dispatcher) ReleaseQueued(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Nothing is started during maintenance, afterwards the held executions go first
+		if maintenance.Enabled() {
+			continue
+		}
+		if err := d.releaseHeld(); err != nil {
+			log.Printf("Failed to release held executions: %v", err)
+			continue
+		}
+
+		if err := d.releaseRetries(); err != nil {
+			log.Printf("Failed to release retried executions: %v", err)
+		}
+
+		var triggerIDs []uint
+		err := database.DB.Model(&models.WorkflowExecution{}).
+			Where("status = ? AND queued_until <= ? AND trigger_id IS NOT NULL", StatusQueued, time.Now()).
+			Distinct().Pluck("trigger_id", &triggerIDs).Error
+		if err != nil {
+			log.Printf("Failed to load queued executions: %v", err)
+			continue
+		}
+
+		for _, triggerID := range triggerIDs {
+			if err := d.releaseTrigger(triggerID); err != nil {
+				log.Printf("Failed to release queued executions of trigger %d: %v", triggerID, err)
+			}
+		}
+	}
+}
+
+// releaseTrigger starts the due queued executions of a trigger in the order they were created,
+// as far as the trigger's concurrency limit allows
+func (d *Dispatcher) releaseTrigger(triggerID uint) error {
+	var released []uint
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// A deleted trigger no longer limits its executions
+		var trigger models.Trigger
+		tx.Clauses(clause.Locking{Strength: "UPDATE"}).Limit(1).Find(&trigger, triggerID)
+
+		var executions []models.WorkflowExecution
+		err := tx.Where("trigger_id = ? AND status = ? AND queued_until <= ?", triggerID, StatusQueued, time.Now()).
+			Order("id").Find(&executions).Error
+		if err != nil {
+			return err
+		}
+
+		var active int64
+		tx.Model(&models.WorkflowExecution{}).Where("trigger_id = ? AND status IN ?", triggerID, activeStatuses).Count(&active)
+
+		for _, execution := range executions {
+			if trigger.MaxConcurrency > 0 && active >= int64(trigger.MaxConcurrency) {
+				break
+			}
+			result := tx.Model(&models.WorkflowExecution{}).
+				Where("id = ? AND status = ?", execution.ID, StatusQueued).
+				Updates(map[string]interface{}{"status": "pending", "started_at": time.Now()})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected > 0 {
+				released = append(released, execution.ID)
+				active++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, executionID := range released {
+		if err := d.enqueueExecution(executionID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"strings"
+	"sync"
+)
+
+// executorAllowlist holds the installation-level list of permitted executor classes.
+// An empty list permits every executor class.
+var executorAllowlist struct {
+	sync.RWMutex
+	patterns []string
+}
+
+// ConfigureAllowedExecutors sets the allowed executor classes from a comma-separated list.
+// Entries ending in "*" match by prefix, e.g. "plugin:*" allows all plugins.
+func ConfigureAllowedExecutors(list string) {
+	var patterns []string
+	for _, entry := range strings.Split(list, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry != "" {
+			patterns = append(patterns, entry)
+		}
+	}
+
+	executorAllowlist.Lock()
+	executorAllowlist.patterns = patterns
+	executorAllowlist.Unlock()
+}
+
+// IsExecutorClassAllowed reports whether the executor class may be used on this installation
+func IsExecutorClassAllowed(executorClass string) bool {
+	executorAllowlist.RLock()
+	defer executorAllowlist.RUnlock()
+
+	if len(executorAllowlist.patterns) == 0 {
+		return true
+	}
+
+	for _, pattern := range executorAllowlist.patterns {
+		if strings.HasSuffix(pattern, "*") {
+			if strings.HasPrefix(executorClass, strings.TrimSuffix(pattern, "*")) {
+				return true
+			}
+		} else if pattern == executorClass {
+			return true
+		}
+	}
+
+	return false
+}
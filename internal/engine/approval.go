@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/expression"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/notify"
+)
+
+// ApprovalExecutor pauses the execution until the configured number of people approved
+// (continuing with the "approved" handle) or someone rejected (continuing with "rejected")
+type ApprovalExecutor struct{}
+
+func (e *ApprovalExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return nil, fmt.Errorf("approval nodes can only run inside a workflow execution")
+}
+
+func (e *ApprovalExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	info, ok := ExecutionInfoFromContext(ctx)
+	if !ok {
+		return e.Execute(config, input)
+	}
+
+	// Message shown to the approvers, may reference input data
+	message, _ := config["message"].(string)
+	message, err := expression.Render(message, input, nil, expression.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render message: %v", err)
+	}
+
+	var assignees []string
+	if list, ok := config["assignees"].([]interface{}); ok {
+		for _, assignee := range list {
+			if email, ok := assignee.(string); ok && email != "" {
+				assignees = append(assignees, email)
+			}
+		}
+	}
+
+	requiredApprovals := 2
+	if required, ok := config["required_approvals"].(float64); ok && required >= 1 {
+		requiredApprovals = int(required)
+	}
+
+	// Data attached to the approval request, defaults to the node input
+	data := interface{}(input)
+	if configData, ok := config["data"]; ok {
+		data = configData
+	}
+
+	assigneesJSON, _ := json.Marshal(assignees)
+	if assignees == nil {
+		assigneesJSON = []byte("[]")
+	}
+	dataJSON, _ := json.Marshal(data)
+
+	approval := models.Approval{
+		WorkflowExecutionID: info.ExecutionID,
+		NodeID:              info.NodeID,
+		Message:             message,
+		Assignees:           string(assigneesJSON),
+		RequiredApprovals:   requiredApprovals,
+		Status:              "pending",
+		Data:                string(dataJSON),
+	}
+	if err := database.DB.Create(&approval).Error; err != nil {
+		return nil, fmt.Errorf("failed to create approval: %v", err)
+	}
+
+	// Notification failures must not fail the workflow, the approval can still be found via the API
+	link := ""
+	if publicURL := os.Getenv("PUBLIC_URL"); publicURL != "" {
+		link = fmt.Sprintf("%s/api/approvals/%d", strings.TrimSuffix(publicURL, "/"), approval.ID)
+	}
+	err = notify.Send(ctx, notify.Message{
+		Subject:    fmt.Sprintf("Approval required (execution %d)", info.ExecutionID),
+		Text:       message,
+		Recipients: assignees,
+		Link:       link,
+	})
+	if err != nil {
+		log.Printf("Failed to send approval notification for approval %d: %v", approval.ID, err)
+	}
+
+	return &SuspendResult{Output: map[string]interface{}{
+		"approval_id": approval.ID,
+		"status":      approval.Status,
+	}}, nil
+}
@@ -0,0 +1,80 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/blob"
+	"github.com/altipard/flowcraft/internal/expression"
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// saveArtifacts keeps the outputs the node marks as artifacts. Blob references in the output
+// become artifacts as they are, strings are stored as text and other values as JSON. It returns
+// a warning naming the artifacts that could not be kept, empty if all were.
+func saveArtifacts(node models.Node, nodeExecution *models.NodeExecution, resultJSON []byte) string {
+	var paths map[string]string
+	if err := json.Unmarshal([]byte(node.Artifacts), &paths); err != nil || len(paths) == 0 {
+		return ""
+	}
+	var output interface{}
+	json.Unmarshal(resultJSON, &output)
+
+	names := make([]string, 0, len(paths))
+	for name := range paths {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var problems []string
+	for _, name := range names {
+		value, ok := expression.Lookup(output, paths[name])
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: no output at %q", name, paths[name]))
+			continue
+		}
+		artifact, err := storeArtifact(name, value)
+		if err == nil {
+			artifact.WorkflowExecutionID = nodeExecution.WorkflowExecutionID
+			artifact.NodeID = nodeExecution.NodeID
+			artifact.NodeExecutionID = nodeExecution.ID
+			err = store.SaveArtifact(artifact)
+		}
+		if err != nil {
+			log.Printf("Execution %d, node %d: failed to keep artifact %s: %v", nodeExecution.WorkflowExecutionID, nodeExecution.NodeID, name, err)
+			problems = append(problems, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+
+	if len(problems) == 0 {
+		return ""
+	}
+	return "artifacts not kept: " + strings.Join(problems, "; ")
+}
+
+// storeArtifact stores the contents of an artifact in the blob store unless they already are
+func storeArtifact(name string, value interface{}) (*models.ExecutionArtifact, error) {
+	if ref, ok := blob.RefFromValue(value); ok {
+		fileName := ref.Name
+		if fileName == "" {
+			fileName = name
+		}
+		return &models.ExecutionArtifact{Name: name, BlobID: ref.ID, FileName: fileName, ContentType: ref.ContentType, Size: ref.Size}, nil
+	}
+
+	data, _ := json.Marshal(value)
+	contentType, fileName := "application/json", name+".json"
+	if text, ok := value.(string); ok {
+		data, contentType, fileName = []byte(text), "text/plain; charset=utf-8", name+".txt"
+	}
+	ref, err := blob.Save(context.Background(), fileName, contentType, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return &models.ExecutionArtifact{Name: name, BlobID: ref.ID, FileName: fileName, ContentType: contentType, Size: ref.Size}, nil
+}
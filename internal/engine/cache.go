@@ -0,0 +1,73 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/cache"
+	"github.com/altipard/flowcraft/internal/expression"
+)
+
+// CacheExecutor reads and writes the shared cache. Operations: get, which continues with the
+// "hit" or "miss" handle, set and delete.
+type CacheExecutor struct{}
+
+func (e *CacheExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return e.ExecuteContext(context.Background(), config, input)
+}
+
+func (e *CacheExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	opts := templateOptions(ctx, expression.Options{})
+
+	key, _ := config["key"].(string)
+	key, err := expression.Render(key, input, nil, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render key: %v", err)
+	}
+	if key == "" {
+		return nil, NewExecError(ErrorConfig, "key is required")
+	}
+	key = "node:" + key
+
+	operation, _ := config["operation"].(string)
+	switch operation {
+	case "get", "":
+		var value interface{}
+		found, err := cache.Get(ctx, key, &value)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return &BranchResult{Handle: "miss", Output: input}, nil
+		}
+		return &BranchResult{Handle: "hit", Output: value}, nil
+
+	case "set":
+		ttl := time.Hour
+		if value, ok := config["ttl"].(string); ok && value != "" {
+			if ttl, err = time.ParseDuration(value); err != nil {
+				return nil, fmt.Errorf("invalid ttl: %v", err)
+			}
+		}
+
+		// Caches the configured value or the node input
+		value, ok := config["value"]
+		if !ok {
+			value = input
+		}
+		if err := cache.Set(ctx, key, value, ttl); err != nil {
+			return nil, err
+		}
+		return value, nil
+
+	case "delete":
+		if err := cache.Delete(ctx, key); err != nil {
+			return nil, err
+		}
+		return input, nil
+
+	default:
+		return nil, NewExecError(ErrorConfig, "unknown operation: %s", operation)
+	}
+}
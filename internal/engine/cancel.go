@@ -0,0 +1,90 @@
+package engine
+
+import (
+	"errors"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/models"
+	core "github.com/altipard/flowcraft/pkg/engine"
+)
+
+// StatusCancelled is the status of executions stopped by a cancellation
+const StatusCancelled = core.StatusCancelled
+
+// ErrCancelled is returned by runs of executions whose cancellation was requested
+var ErrCancelled = errors.New("execution cancelled")
+
+// Cancelled reports whether the execution was cancelled or its cancellation was requested
+func Cancelled(execution *models.WorkflowExecution) bool {
+	return execution.CancelRequestedAt != nil || execution.Status == StatusCancelled
+}
+
+// checkCancelled returns ErrCancelled once the cancellation of the execution was requested. Runs
+// check it before each node, so the node running when the request arrives still finishes.
+func checkCancelled(executionID uint) error {
+	requested, err := store.CancelRequested(executionID)
+	if err != nil {
+		return err
+	}
+	if requested {
+		return ErrCancelled
+	}
+	return nil
+}
+
+// CancelExecution cancels an execution no worker runs, e.g. a queued or waiting one. Running
+// executions are cancelled by their worker before the next node.
+func CancelExecution(executionID uint) error {
+	execution, err := store.Execution(executionID)
+	if err != nil {
+		return err
+	}
+	return cancelExecution(execution)
+}
+
+// cancelExecution finishes an execution as cancelled: its waiting nodes and the nodes it did not
+// reach yet are recorded as skipped. Completed nodes are not compensated, and neither sinks nor
+// chained workflows receive the output of cancelled executions.
+func cancelExecution(execution *models.WorkflowExecution) error {
+	nodeExecutions, err := store.NodeExecutions(execution.ID, NodeExecutionFilter{ExcludeCompensations: true})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	reached := make(map[uint]bool, len(nodeExecutions))
+	for i := range nodeExecutions {
+		nodeExecution := &nodeExecutions[i]
+		reached[nodeExecution.NodeID] = true
+		if nodeExecution.Status != "waiting" {
+			continue
+		}
+		nodeExecution.Status = "skipped"
+		nodeExecution.CompletedAt = &now
+		if err := store.SaveNodeExecution(nodeExecution); err != nil {
+			return err
+		}
+	}
+
+	compensationNodes := compensationNodeIDs(execution.Workflow.Nodes)
+	for _, node := range execution.Workflow.Nodes {
+		if reached[node.ID] || compensationNodes[node.ID] || node.IsAnnotation() {
+			continue
+		}
+		// Claimed like skipped nodes, so nodes another run started meanwhile are left alone
+		if _, err := store.ClaimNode(&models.NodeExecution{
+			WorkflowExecutionID: execution.ID,
+			NodeID:              node.ID,
+			Status:              "skipped",
+			StartedAt:           &now,
+			CompletedAt:         &now,
+		}, 0); err != nil {
+			return err
+		}
+	}
+
+	execution.Status = StatusCancelled
+	execution.ErrorMessage = ""
+	execution.CompletedAt = &now
+	return store.CompleteExecution(execution)
+}
@@ -0,0 +1,177 @@
+package engine
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/anomaly"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// keepsPayloads reports whether the capture mode of the workflow keeps the payloads of the
+// finished execution
+func keepsPayloads(workflow models.Workflow, execution *models.WorkflowExecution) bool {
+	switch workflow.CaptureMode {
+	case models.CaptureMetadata:
+		return false
+	case models.CaptureErrors:
+		return execution.Status == "failed"
+	case models.CaptureSample:
+		if execution.Status == "failed" {
+			return true
+		}
+		return workflow.SampleRate > 0 && execution.ID%uint(workflow.SampleRate) == 0
+	case models.CaptureTail:
+		if execution.Status == "failed" || slow(workflow, execution) {
+			return true
+		}
+		return workflow.SampleRate > 0 && execution.ID%uint(workflow.SampleRate) == 0
+	default:
+		return true
+	}
+}
+
+// defaultSlowScore is the deviation from the typical duration, in standard deviations, from
+// which capture mode tail considers executions slow
+const defaultSlowScore = 2
+
+// slow reports whether the execution took longer than the workflow's CaptureSlowAfter, or
+// deviated from the typical duration of the workflow by its CaptureSlowScore
+func slow(workflow models.Workflow, execution *models.WorkflowExecution) bool {
+	if execution.CompletedAt == nil {
+		return false
+	}
+	duration := execution.CompletedAt.Sub(execution.StartedAt)
+	if threshold, err := time.ParseDuration(workflow.CaptureSlowAfter); err == nil && threshold > 0 && duration > threshold {
+		return true
+	}
+
+	threshold := workflow.CaptureSlowScore
+	if threshold == 0 {
+		threshold = defaultSlowScore
+	}
+	// Executions of published versions are scored against the baseline of their workflow
+	rootID := workflow.ID
+	if workflow.ParentID != nil {
+		rootID = *workflow.ParentID
+	}
+	score, ok := anomaly.Score(rootID, 0, float64(duration.Milliseconds()), anomaly.ConfigFromEnv())
+	return ok && score >= threshold
+}
+
+// PayloadSummary is stored in place of a payload dropped by capture mode tail
+type PayloadSummary struct {
+	Summary bool   `json:"_summary"`
+	Size    int    `json:"size"`
+	Type    string `json:"type,omitempty"`
+	// Items is the length of arrays, Keys are the (first 50) field names of objects
+	Items *int     `json:"items,omitempty"`
+	Keys  []string `json:"keys,omitempty"`
+}
+
+// maxSummaryKeys limits the field names kept by payload summaries
+const maxSummaryKeys = 50
+
+// summarize returns the summary of a stored payload
+func summarize(stored string) string {
+	summary := PayloadSummary{Summary: true, Size: len(stored)}
+	if truncated, ok := truncatedPayload(stored); ok {
+		// Only the size of truncated payloads is known without loading them
+		summary.Size = truncated.Size
+	} else {
+		var value interface{}
+		json.Unmarshal([]byte(stored), &value)
+		switch v := value.(type) {
+		case []interface{}:
+			summary.Type = "array"
+			items := len(v)
+			summary.Items = &items
+		case map[string]interface{}:
+			summary.Type = "object"
+			for key := range v {
+				summary.Keys = append(summary.Keys, key)
+			}
+			sort.Strings(summary.Keys)
+			if len(summary.Keys) > maxSummaryKeys {
+				summary.Keys = summary.Keys[:maxSummaryKeys]
+			}
+		case string:
+			summary.Type = "string"
+		case float64:
+			summary.Type = "number"
+		case bool:
+			summary.Type = "boolean"
+		}
+	}
+	data, _ := json.Marshal(summary)
+	return string(data)
+}
+
+// applyCaptureMode drops the input and output payloads of a finished execution and its nodes
+// if the workflow's capture mode doesn't keep them, capture mode tail keeps their summaries. Payloads are needed while the execution
+// runs (checkpoints, resuming) and are only dropped afterwards.
+func applyCaptureMode(execution *models.WorkflowExecution) {
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, execution.WorkflowID).Error; err != nil {
+		return
+	}
+
+	if keepsPayloads(workflow, execution) {
+		return
+	}
+
+	if workflow.CaptureMode == models.CaptureTail {
+		summarizePayloads(execution)
+		return
+	}
+
+	// Payloads offloaded for their size are dropped as well
+	var offloaded []models.NodeExecution
+	database.DB.Select("input_data", "output_data").
+		Where("workflow_execution_id = ? AND (input_data->>'_truncated' = 'true' OR output_data->>'_truncated' = 'true')", execution.ID).
+		Find(&offloaded)
+	for _, nodeExecution := range offloaded {
+		deleteOffloadedPayloads(nodeExecution.InputData, nodeExecution.OutputData)
+	}
+
+	database.DB.Model(&models.NodeExecution{}).
+		Where("workflow_execution_id = ?", execution.ID).
+		Updates(map[string]interface{}{"input_data": "{}", "output_data": "{}"})
+
+	execution.InputData = "{}"
+	execution.OutputData = "{}"
+	execution.DataCaptured = false
+	database.DB.Model(execution).Updates(map[string]interface{}{
+		"input_data":    "{}",
+		"output_data":   "{}",
+		"data_captured": false,
+	})
+}
+
+// summarizePayloads replaces the payloads of a finished execution and its nodes with their
+// summaries, deleting offloaded payloads
+func summarizePayloads(execution *models.WorkflowExecution) {
+	var nodeExecutions []models.NodeExecution
+	database.DB.Select("id", "input_data", "output_data").
+		Where("workflow_execution_id = ?", execution.ID).
+		Find(&nodeExecutions)
+	for _, nodeExecution := range nodeExecutions {
+		deleteOffloadedPayloads(nodeExecution.InputData, nodeExecution.OutputData)
+		database.DB.Model(&models.NodeExecution{}).Where("id = ?", nodeExecution.ID).
+			Updates(map[string]interface{}{
+				"input_data":  summarize(nodeExecution.InputData),
+				"output_data": summarize(nodeExecution.OutputData),
+			})
+	}
+
+	execution.InputData = summarize(execution.InputData)
+	execution.OutputData = summarize(execution.OutputData)
+	execution.DataCaptured = false
+	database.DB.Model(execution).Updates(map[string]interface{}{
+		"input_data":    execution.InputData,
+		"output_data":   execution.OutputData,
+		"data_captured": false,
+	})
+}
@@ -0,0 +1,152 @@
+package engine
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	core "github.com/altipard/flowcraft/pkg/engine"
+)
+
+// ChaosConfig configures the injection of faults into node executions, to verify that retries,
+// restarts and resumption work as intended. It is meant for test installations only.
+type ChaosConfig struct {
+	// ErrorRate is the probability of a node failing with a ChaosError instead of running
+	ErrorRate float64
+	// DelayRate is the probability of a node being delayed by up to MaxDelay before running
+	DelayRate float64
+	MaxDelay  time.Duration
+	// CrashRate is the probability of the worker process exiting after a node's executor ran
+	// but before its result was stored, like a worker crashing mid-node
+	CrashRate float64
+	// NodeTypes restricts the faults to nodes of these types, all nodes if empty
+	NodeTypes []string
+}
+
+// Enabled reports whether any faults are injected
+func (c ChaosConfig) Enabled() bool {
+	return c.ErrorRate > 0 || c.DelayRate > 0 || c.CrashRate > 0
+}
+
+// ChaosConfigFromEnv reads the fault injection settings from CHAOS_ERROR_RATE, CHAOS_DELAY_RATE,
+// CHAOS_MAX_DELAY, CHAOS_CRASH_RATE and CHAOS_NODE_TYPES. All faults are disabled by default.
+func ChaosConfigFromEnv() ChaosConfig {
+	cfg := ChaosConfig{MaxDelay: 5 * time.Second}
+	if v, err := strconv.ParseFloat(os.Getenv("CHAOS_ERROR_RATE"), 64); err == nil {
+		cfg.ErrorRate = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("CHAOS_DELAY_RATE"), 64); err == nil {
+		cfg.DelayRate = v
+	}
+	if v, err := time.ParseDuration(os.Getenv("CHAOS_MAX_DELAY")); err == nil {
+		cfg.MaxDelay = v
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("CHAOS_CRASH_RATE"), 64); err == nil {
+		cfg.CrashRate = v
+	}
+	for _, nodeType := range strings.Split(os.Getenv("CHAOS_NODE_TYPES"), ",") {
+		if nodeType = strings.TrimSpace(nodeType); nodeType != "" {
+			cfg.NodeTypes = append(cfg.NodeTypes, nodeType)
+		}
+	}
+	return cfg
+}
+
+var chaosConfig struct {
+	sync.RWMutex
+	cfg ChaosConfig
+}
+
+// ConfigureChaos sets the faults injected into node executions of this process
+func ConfigureChaos(cfg ChaosConfig) {
+	if cfg.Enabled() {
+		log.Printf("WARNING: fault injection enabled (error rate %.2f, delay rate %.2f up to %s, crash rate %.2f), do not use in production",
+			cfg.ErrorRate, cfg.DelayRate, cfg.MaxDelay, cfg.CrashRate)
+	}
+
+	chaosConfig.Lock()
+	chaosConfig.cfg = cfg
+	chaosConfig.Unlock()
+}
+
+// ChaosError is the error of nodes failed by fault injection
+type ChaosError struct{}
+
+func (e *ChaosError) Error() string {
+	return "injected failure"
+}
+
+// ErrorCode implements ErrorCoder
+func (e *ChaosError) ErrorCode() string {
+	return "CHAOS"
+}
+
+// ErrorCategory implements ErrorCategorizer, injected failures are retried like network errors
+func (e *ChaosError) ErrorCategory() ErrorCategory {
+	return ErrorTransient
+}
+
+// withChaos wraps the executor of a node of the given type with fault injection if enabled
+func withChaos(executor NodeExecutor, nodeType string) NodeExecutor {
+	chaosConfig.RLock()
+	cfg := chaosConfig.cfg
+	chaosConfig.RUnlock()
+
+	if !cfg.Enabled() {
+		return executor
+	}
+	if len(cfg.NodeTypes) > 0 {
+		matches := false
+		for _, t := range cfg.NodeTypes {
+			if t == nodeType {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			return executor
+		}
+	}
+
+	return &chaosExecutor{executor: executor, cfg: cfg}
+}
+
+// chaosExecutor injects faults around the execution of the executor it wraps
+type chaosExecutor struct {
+	executor NodeExecutor
+	cfg      ChaosConfig
+}
+
+func (e *chaosExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return e.ExecuteContext(context.Background(), config, input)
+}
+
+// ExecuteContext delays or fails the node, or crashes the worker after the wrapped executor ran
+func (e *chaosExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	info, _ := ExecutionInfoFromContext(ctx)
+
+	if e.cfg.DelayRate > 0 && rand.Float64() < e.cfg.DelayRate && e.cfg.MaxDelay > 0 {
+		delay := time.Duration(rand.Int63n(int64(e.cfg.MaxDelay)))
+		log.Printf("Chaos: delaying node %d of execution %d by %s", info.NodeID, info.ExecutionID, delay)
+		time.Sleep(delay)
+	}
+
+	if e.cfg.ErrorRate > 0 && rand.Float64() < e.cfg.ErrorRate {
+		log.Printf("Chaos: failing node %d of execution %d", info.NodeID, info.ExecutionID)
+		return nil, &ChaosError{}
+	}
+
+	result, err := core.Invoke(ctx, e.executor, config, input)
+
+	if e.cfg.CrashRate > 0 && rand.Float64() < e.cfg.CrashRate {
+		log.Printf("Chaos: crashing worker after node %d of execution %d ran", info.NodeID, info.ExecutionID)
+		os.Exit(3)
+	}
+
+	return result, err
+}
@@ -0,0 +1,179 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/models"
+	core "github.com/altipard/flowcraft/pkg/engine"
+)
+
+// compensate runs the compensation nodes of all completed nodes of a failed execution
+// in reverse completion order. Failing compensations do not stop the remaining ones;
+// their errors are returned together.
+func (e *Engine) compensate(execution *models.WorkflowExecution, cause error) error {
+	nodeExecutions, err := store.NodeExecutions(execution.ID, NodeExecutionFilter{
+		Statuses:             []string{"completed"},
+		ExcludeCompensations: true,
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(nodeExecutions, func(i, j int) bool {
+		return completedLater(nodeExecutions[i], nodeExecutions[j])
+	})
+
+	graph := newWorkflowGraph(execution.Workflow)
+	var failures []string
+	for _, nodeExecution := range nodeExecutions {
+		node, err := graph.node(nodeExecution.NodeID)
+		if err != nil || node.CompensationNodeID == nil {
+			continue
+		}
+
+		if err := e.runCompensation(execution, graph, node, nodeExecution, cause); err != nil {
+			log.Printf("Compensation of node %d in execution %d failed: %v", node.ID, execution.ID, err)
+			failures = append(failures, fmt.Sprintf("node %d: %v", node.ID, err))
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("compensation failed for %s", strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// runCompensation executes the compensation node of a completed node. The compensation node
+// receives the input and output of the node it undoes and the error that failed the execution.
+func (e *Engine) runCompensation(execution *models.WorkflowExecution, graph *workflowGraph, node models.Node, completed models.NodeExecution, cause error) error {
+	compensationNode, err := graph.node(*node.CompensationNodeID)
+	if err != nil {
+		return fmt.Errorf("compensation node %d not found", *node.CompensationNodeID)
+	}
+
+	nodeType, err := store.NodeType(compensationNode.NodeType)
+	if err != nil {
+		return err
+	}
+
+	inputData := map[string]interface{}{
+		"node_id": node.ID,
+		"input":   payloadValue(completed.InputData),
+		"output":  payloadValue(completed.OutputData),
+		"error":   cause.Error(),
+	}
+	inputJSON, _ := json.Marshal(inputData)
+
+	now := time.Now()
+	nodeExecution := models.NodeExecution{
+		WorkflowExecutionID: completed.WorkflowExecutionID,
+		NodeID:              compensationNode.ID,
+		Status:              "running",
+		StartedAt:           &now,
+		BytesIn:             int64(len(inputJSON)),
+		CompensatedNodeID:   &node.ID,
+		Attempt:             1,
+		IdempotencyKey:      completed.IdempotencyKey + "-compensation",
+	}
+	nodeExecution.InputData = storedPayload(inputJSON, nodePayloadName(&nodeExecution, "input"))
+	if err := store.SaveNodeExecution(&nodeExecution); err != nil {
+		return err
+	}
+
+	fail := func(err error) error {
+		nodeExecution.Status = "failed"
+		nodeExecution.ErrorMessage = err.Error()
+		nodeExecution.ErrorCode = errorCode(err)
+		nodeExecution.ErrorCategory = string(errorCategory(err))
+		nodeExecution.StackTrace = stackTrace(err)
+		now := time.Now()
+		nodeExecution.CompletedAt = &now
+		saveNodeExecution(&nodeExecution)
+		return err
+	}
+
+	executor, err := LoadExecutor(nodeType.ExecutorClass)
+	if err != nil {
+		return fail(fmt.Errorf("failed to load executor: %v", err))
+	}
+
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(compensationNode.Config), &config); err != nil {
+		return fail(fmt.Errorf("failed to parse node config: %v", err))
+	}
+
+	// Published versions share the state of the workflow they belong to
+	workflowID := compensationNode.WorkflowID
+	if execution.Workflow.ParentID != nil {
+		workflowID = *execution.Workflow.ParentID
+	}
+	ctx := core.WithExecutionInfo(context.Background(), ExecutionInfo{
+		WorkflowID:      workflowID,
+		ExecutionID:     completed.WorkflowExecutionID,
+		NodeID:          compensationNode.ID,
+		NodeExecutionID: nodeExecution.ID,
+		TriggerID:       triggerID(execution),
+		Attempt:         nodeExecution.Attempt,
+		IdempotencyKey:  nodeExecution.IdempotencyKey,
+	})
+	executeStart := time.Now()
+	result, err := invokeRecovering(ctx, nodeType.ExecutorClass, executor, config, inputData)
+	nodeExecution.DurationMs = time.Since(executeStart).Milliseconds()
+	nodeExecution.Cost = estimateCost(nodeType, result, err)
+	if err != nil {
+		return fail(err)
+	}
+
+	// Compensations run synchronously, suspending is not supported
+	switch typed := result.(type) {
+	case *SuspendResult:
+		return fail(fmt.Errorf("node type %s cannot be used for compensation", compensationNode.NodeType))
+	case *BranchResult:
+		result = typed.Output
+	}
+
+	resultJSON, _ := json.Marshal(result)
+	nodeExecution.OutputData = storedPayload(resultJSON, nodePayloadName(&nodeExecution, "output"))
+	nodeExecution.BytesOut = int64(len(resultJSON))
+	nodeExecution.Status = "completed"
+	now = time.Now()
+	nodeExecution.CompletedAt = &now
+	return store.SaveNodeExecution(&nodeExecution)
+}
+
+// completedLater reports whether node execution a completed after b, the later one of the same
+// completion time being the one created later
+func completedLater(a, b models.NodeExecution) bool {
+	if a.CompletedAt == nil || b.CompletedAt == nil || a.CompletedAt.Equal(*b.CompletedAt) {
+		if (a.CompletedAt == nil) != (b.CompletedAt == nil) {
+			return a.CompletedAt == nil
+		}
+		return a.ID > b.ID
+	}
+	return a.CompletedAt.After(*b.CompletedAt)
+}
+
+// compensationNodeIDs returns the IDs of the nodes used as compensation of other nodes.
+// They only run when compensating and are never start nodes.
+func compensationNodeIDs(nodes []models.Node) map[uint]bool {
+	ids := make(map[uint]bool)
+	for _, node := range nodes {
+		if node.CompensationNodeID != nil {
+			ids[*node.CompensationNodeID] = true
+		}
+	}
+	return ids
+}
+
+// triggerID returns the ID of the trigger that started the execution, or 0
+func triggerID(execution *models.WorkflowExecution) uint {
+	if execution.TriggerID == nil {
+		return 0
+	}
+	return *execution.TriggerID
+}
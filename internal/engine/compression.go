@@ -0,0 +1,254 @@
+package engine
+
+import (
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/blob"
+	"github.com/altipard/flowcraft/internal/expression"
+)
+
+// maxDecompressedSize limits the size of decompressed payloads, protecting workers from zip bombs
+const maxDecompressedSize = 256 << 20
+
+// errDecompressedTooLarge is returned when a decompressed payload exceeds maxDecompressedSize
+var errDecompressedTooLarge = errors.New("decompressed payload exceeds 256 MB")
+
+// CompressionExecutor compresses and archives binary payloads. Operations: gzip, gunzip,
+// zip and unzip. Payloads are blob references ({"blob_id": ...}) or text.
+type CompressionExecutor struct{}
+
+func (e *CompressionExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return e.ExecuteContext(context.Background(), config, input)
+}
+
+func (e *CompressionExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	rendered, err := expression.RenderValue(config, input, templateOptions(ctx, expression.Options{}))
+	if err != nil {
+		return nil, NewExecError(ErrorData, "failed to render config: %v", err)
+	}
+	config = rendered.(map[string]interface{})
+
+	// The payload defaults to the node input if it is a blob reference itself
+	source, ok := config["source"]
+	if !ok {
+		source = input
+	}
+	name, _ := config["name"].(string)
+
+	operation, _ := config["operation"].(string)
+	switch operation {
+	case "gzip":
+		return gzipPayload(ctx, source, name)
+	case "gunzip":
+		return gunzipPayload(ctx, source, name)
+	case "zip":
+		files, ok := config["files"].([]interface{})
+		if !ok || len(files) == 0 {
+			return nil, NewExecError(ErrorConfig, "files is required for zip")
+		}
+		return zipPayloads(ctx, files, name)
+	case "unzip":
+		return unzipPayload(ctx, source)
+	default:
+		return nil, NewExecError(ErrorConfig, "unknown operation: %q", operation)
+	}
+}
+
+// openPayload opens a blob reference or text payload and returns its name
+func openPayload(ctx context.Context, value interface{}) (io.ReadCloser, string, error) {
+	if ref, ok := blob.RefFromValue(value); ok {
+		r, err := blob.Open(ctx, ref.ID)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to open blob %s: %v", ref.ID, err)
+		}
+		return r, ref.Name, nil
+	}
+	if text, ok := value.(string); ok {
+		return io.NopCloser(strings.NewReader(text)), "", nil
+	}
+	return nil, "", fmt.Errorf("payload must be a blob reference or text")
+}
+
+// savePipe stores the output written by write as a new blob
+func savePipe(ctx context.Context, name, contentType string, write func(w io.Writer) error) (interface{}, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(write(pw))
+	}()
+
+	ref, err := blob.Save(ctx, name, contentType, pr)
+	pr.Close()
+	if err != nil {
+		return nil, err
+	}
+	return ref.Map(), nil
+}
+
+func gzipPayload(ctx context.Context, source interface{}, name string) (interface{}, error) {
+	r, sourceName, err := openPayload(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	if name == "" {
+		name = defaultName(sourceName, "payload") + ".gz"
+	}
+	return savePipe(ctx, name, "application/gzip", func(w io.Writer) error {
+		gz := gzip.NewWriter(w)
+		gz.Name = strings.TrimSuffix(path.Base(name), ".gz")
+		if _, err := io.Copy(gz, r); err != nil {
+			return err
+		}
+		return gz.Close()
+	})
+}
+
+func gunzipPayload(ctx context.Context, source interface{}, name string) (interface{}, error) {
+	r, sourceName, err := openPayload(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gzip payload: %v", err)
+	}
+	if name == "" {
+		name = gz.Name
+	}
+	if name == "" {
+		name = defaultName(strings.TrimSuffix(sourceName, ".gz"), "payload")
+	}
+	return savePipe(ctx, name, "", func(w io.Writer) error {
+		return copyLimited(w, gz)
+	})
+}
+
+func zipPayloads(ctx context.Context, files []interface{}, name string) (interface{}, error) {
+	if name == "" {
+		name = "archive.zip"
+	}
+	return savePipe(ctx, name, "application/zip", func(w io.Writer) error {
+		archive := zip.NewWriter(w)
+		used := map[string]int{}
+		for i, file := range files {
+			// Text entries are given as {"name": ..., "content": ...}
+			value := file
+			entryName := ""
+			if entry, ok := file.(map[string]interface{}); ok {
+				if content, ok := entry["content"]; ok {
+					value = content
+				}
+				entryName, _ = entry["name"].(string)
+			}
+
+			r, sourceName, err := openPayload(ctx, value)
+			if err != nil {
+				return fmt.Errorf("file %d: %v", i, err)
+			}
+			if entryName == "" {
+				entryName = defaultName(sourceName, fmt.Sprintf("file%d", i+1))
+			}
+			entryName = uniqueEntryName(used, entryName)
+
+			entry, err := archive.Create(entryName)
+			if err == nil {
+				_, err = io.Copy(entry, r)
+			}
+			r.Close()
+			if err != nil {
+				return fmt.Errorf("file %s: %v", entryName, err)
+			}
+		}
+		return archive.Close()
+	})
+}
+
+func unzipPayload(ctx context.Context, source interface{}) (interface{}, error) {
+	r, _, err := openPayload(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// Archives are read from a temporary file since zip needs random access
+	tmp, err := os.CreateTemp("", "flowcraft-unzip-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, r)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip payload: %v", err)
+	}
+
+	files := []interface{}{}
+	var total int64
+	for _, entry := range archive.File {
+		if entry.FileInfo().IsDir() {
+			continue
+		}
+		total += int64(entry.UncompressedSize64)
+		if total > maxDecompressedSize {
+			return nil, errDecompressedTooLarge
+		}
+
+		content, err := entry.Open()
+		if err != nil {
+			return nil, fmt.Errorf("file %s: %v", entry.Name, err)
+		}
+		ref, err := savePipe(ctx, entry.Name, "", func(w io.Writer) error {
+			return copyLimited(w, content)
+		})
+		content.Close()
+		if err != nil {
+			return nil, fmt.Errorf("file %s: %v", entry.Name, err)
+		}
+		files = append(files, ref)
+	}
+
+	return map[string]interface{}{"files": files, "count": len(files)}, nil
+}
+
+// copyLimited copies decompressed data, failing beyond maxDecompressedSize
+func copyLimited(w io.Writer, r io.Reader) error {
+	n, err := io.Copy(w, io.LimitReader(r, maxDecompressedSize+1))
+	if err == nil && n > maxDecompressedSize {
+		return errDecompressedTooLarge
+	}
+	return err
+}
+
+// uniqueEntryName appends a counter to names already used in an archive
+func uniqueEntryName(used map[string]int, name string) string {
+	used[name]++
+	if used[name] == 1 {
+		return name
+	}
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(name, ext), used[name], ext)
+}
+
+// defaultName returns name, or fallback if it is empty
+func defaultName(name, fallback string) string {
+	if name == "" {
+		return fallback
+	}
+	return name
+}
@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/expression"
+)
+
+// Output handles of condition nodes
+const (
+	HandleTrue  = "true"
+	HandleFalse = "false"
+)
+
+// ConditionExecutor compares a field of its input with a value and continues with the "true" or
+// "false" handle, passing its input on. Nodes only reachable through the other handle are skipped.
+type ConditionExecutor struct{}
+
+func (e *ConditionExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return e.ExecuteContext(context.Background(), config, input)
+}
+
+func (e *ConditionExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	config, err := renderConfig(ctx, config, input)
+	if err != nil {
+		return nil, NewExecError(ErrorData, "failed to render config: %v", err)
+	}
+
+	field, _ := config["field"].(string)
+	operator, _ := config["operator"].(string)
+	if operator == "" {
+		operator = "equals"
+	}
+	value, found := expression.Lookup(input, field)
+
+	matched, err := evaluateCondition(value, found, operator, config["value"])
+	if err != nil {
+		return nil, &ExecError{Category: ErrorConfig, Err: err}
+	}
+	handle := HandleFalse
+	if matched {
+		handle = HandleTrue
+	}
+	return &BranchResult{Handle: handle, Output: input}, nil
+}
+
+// evaluateCondition applies an operator to the value of a field, found reporting whether the
+// field exists. Numbers are compared numerically, other values as text.
+func evaluateCondition(actual interface{}, found bool, operator string, expected interface{}) (bool, error) {
+	switch operator {
+	case "exists":
+		return found && actual != nil, nil
+	case "not_exists":
+		return !found || actual == nil, nil
+	case "is_true":
+		return truthy(actual), nil
+	case "is_false":
+		return !truthy(actual), nil
+	case "equals":
+		return valuesEqual(actual, expected), nil
+	case "not_equals":
+		return !valuesEqual(actual, expected), nil
+	case "contains":
+		return containsValue(actual, expected), nil
+	case "not_contains":
+		return !containsValue(actual, expected), nil
+	case "greater_than", "greater_or_equal", "less_than", "less_or_equal":
+		if !found || actual == nil {
+			return false, nil
+		}
+		comparison := compareOrdered(actual, expected)
+		switch operator {
+		case "greater_than":
+			return comparison > 0, nil
+		case "greater_or_equal":
+			return comparison >= 0, nil
+		case "less_than":
+			return comparison < 0, nil
+		default:
+			return comparison <= 0, nil
+		}
+	default:
+		return false, fmt.Errorf("unknown operator %q", operator)
+	}
+}
+
+// truthy reports whether a value counts as true: true, non-zero numbers, and texts other than
+// "", "false" and "0"
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != "" && v != "false" && v != "0"
+	}
+	if number, ok := toNumber(value); ok {
+		return number != 0
+	}
+	return true
+}
+
+// valuesEqual compares two values, numerically if both are numbers
+func valuesEqual(a, b interface{}) bool {
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			return x == y
+		}
+	}
+	return conditionText(a) == conditionText(b)
+}
+
+// containsValue reports whether a list has an element equal to the value, an object has the
+// value as key, or a text contains it
+func containsValue(container, value interface{}) bool {
+	switch c := container.(type) {
+	case []interface{}:
+		for _, element := range c {
+			if valuesEqual(element, value) {
+				return true
+			}
+		}
+		return false
+	case map[string]interface{}:
+		_, ok := c[conditionText(value)]
+		return ok
+	case nil:
+		return false
+	}
+	return strings.Contains(conditionText(container), conditionText(value))
+}
+
+// compareOrdered returns -1, 0 or 1, comparing numbers numerically and other values as text,
+// so that e.g. ISO 8601 timestamps compare chronologically
+func compareOrdered(a, b interface{}) int {
+	if x, ok := toNumber(a); ok {
+		if y, ok := toNumber(b); ok {
+			switch {
+			case x < y:
+				return -1
+			case x > y:
+				return 1
+			}
+			return 0
+		}
+	}
+	return strings.Compare(conditionText(a), conditionText(b))
+}
+
+// toNumber converts numbers and numeric texts to float64
+func toNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case json.Number:
+		number, err := v.Float64()
+		return number, err == nil
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return number, err == nil
+	}
+	return 0, false
+}
+
+// conditionText returns the text of a value; objects and lists as JSON
+func conditionText(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return fmt.Sprintf("%v", value)
+}
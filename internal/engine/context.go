@@ -0,0 +1,68 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/altipard/flowcraft/internal/expression"
+	"github.com/altipard/flowcraft/internal/secrets"
+	"github.com/altipard/flowcraft/internal/state"
+	core "github.com/altipard/flowcraft/pkg/engine"
+)
+
+// ContextExecutor is implemented by executors that need to know which execution they run in,
+// e.g. to create records referencing it. The engine prefers ExecuteContext over Execute.
+type ContextExecutor = core.ContextExecutor
+
+// ExecutionInfo describes the node execution an executor is invoked for
+type ExecutionInfo = core.ExecutionInfo
+
+// BranchResult is returned by executors that route the execution to the connections
+// of a single output handle. Nodes reachable only through other handles are skipped.
+type BranchResult = core.BranchResult
+
+// IdempotencyKey derives the idempotency key of a node execution attempt
+func IdempotencyKey(executionID, nodeID uint, attempt int) string {
+	return fmt.Sprintf("flowcraft-%d-%d-%d", executionID, nodeID, attempt)
+}
+
+// ExecutionInfoFromContext returns the execution info passed to a ContextExecutor
+func ExecutionInfoFromContext(ctx context.Context) (ExecutionInfo, bool) {
+	return core.ExecutionInfoFromContext(ctx)
+}
+
+// SuspendResult is returned by executors that pause their branch of the execution until
+// it is resumed from outside, e.g. by a human decision
+type SuspendResult struct {
+	Output interface{}
+}
+
+// templateOptions adds the namespaces available to templates of the execution to opts:
+// "$state" resolves values of the state store, "$secret" secrets of the external secrets manager.
+// The state store is not available on workers without database access.
+func templateOptions(ctx context.Context, opts expression.Options) expression.Options {
+	opts.Namespaces = map[string]expression.Resolver{
+		"secret": secrets.Resolver,
+	}
+	if usesDatabase() {
+		info, _ := ExecutionInfoFromContext(ctx)
+		resolver := state.Resolver{WorkflowID: info.WorkflowID, TriggerID: info.TriggerID}
+		opts.Namespaces["state"] = resolver.Resolve
+	}
+	return opts
+}
+
+// ErrorCoder is implemented by errors carrying a machine readable code, e.g. "CIRCUIT_OPEN"
+type ErrorCoder interface {
+	ErrorCode() string
+}
+
+// errorCode returns the code of an error, or an empty string
+func errorCode(err error) string {
+	var coder ErrorCoder
+	if errors.As(err, &coder) {
+		return coder.ErrorCode()
+	}
+	return ""
+}
@@ -0,0 +1,107 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/expression"
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// CostModel estimates the cost of the external API calls of a node type's executions: a price per
+// call and, for LLM APIs, prices per input and output token read from the usage in the output
+type CostModel struct {
+	PerCall        float64 `json:"per_call"`
+	PerInputToken  float64 `json:"per_input_token"`
+	PerOutputToken float64 `json:"per_output_token"`
+	// Paths of the token counts in the output, by default the usage reported by the OpenAI
+	// (usage.prompt_tokens) and Anthropic (usage.input_tokens) APIs, also below "body"
+	InputTokensPath  string `json:"input_tokens_path,omitempty"`
+	OutputTokensPath string `json:"output_tokens_path,omitempty"`
+}
+
+// Default paths of token counts in the outputs of LLM APIs
+var (
+	defaultInputTokensPaths  = []string{"usage.prompt_tokens", "usage.input_tokens", "body.usage.prompt_tokens", "body.usage.input_tokens"}
+	defaultOutputTokensPaths = []string{"usage.completion_tokens", "usage.output_tokens", "body.usage.completion_tokens", "body.usage.output_tokens"}
+)
+
+// ParseCostModel parses the cost model of a node type, nil if it has none
+func ParseCostModel(data string) (*CostModel, error) {
+	if strings.TrimSpace(data) == "" {
+		return nil, nil
+	}
+
+	var model CostModel
+	if err := json.Unmarshal([]byte(data), &model); err != nil {
+		return nil, fmt.Errorf("invalid cost model: %v", err)
+	}
+	if model.PerCall < 0 || model.PerInputToken < 0 || model.PerOutputToken < 0 {
+		return nil, errors.New("prices of the cost model must not be negative")
+	}
+	if model.PerCall == 0 && model.PerInputToken == 0 && model.PerOutputToken == 0 {
+		return nil, nil
+	}
+	return &model, nil
+}
+
+// Estimate returns the estimated cost of an execution with the given output. Failed executions
+// are charged per call, the APIs may bill them as well.
+func (m *CostModel) Estimate(output interface{}, failed bool) float64 {
+	cost := m.PerCall
+	if failed {
+		return cost
+	}
+
+	switch result := output.(type) {
+	case *BranchResult:
+		output = result.Output
+	case *SuspendResult:
+		output = result.Output
+	}
+	if m.PerInputToken > 0 {
+		cost += m.PerInputToken * tokens(output, m.InputTokensPath, defaultInputTokensPaths)
+	}
+	if m.PerOutputToken > 0 {
+		cost += m.PerOutputToken * tokens(output, m.OutputTokensPath, defaultOutputTokensPaths)
+	}
+	return cost
+}
+
+// tokens reads a token count from the output at the path, or the first of the default paths found
+func tokens(output interface{}, path string, defaults []string) float64 {
+	paths := defaults
+	if path != "" {
+		paths = []string{path}
+	}
+
+	for _, path := range paths {
+		value, ok := expression.Lookup(output, path)
+		if !ok {
+			continue
+		}
+		switch n := value.(type) {
+		case float64:
+			return n
+		case int:
+			return float64(n)
+		case int64:
+			return float64(n)
+		case json.Number:
+			f, _ := n.Float64()
+			return f
+		}
+	}
+	return 0
+}
+
+// estimateCost estimates the cost of a node execution with the cost model of its node type
+func estimateCost(nodeType models.NodeType, output interface{}, err error) float64 {
+	model, parseErr := ParseCostModel(nodeType.CostModel)
+	if parseErr != nil || model == nil {
+		return 0
+	}
+	return model.Estimate(output, err != nil)
+}
@@ -0,0 +1,169 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/credentials"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/expression"
+	"github.com/altipard/flowcraft/internal/graphcache"
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// nodeCredential resolves the credential referenced by the node's credential_id, restricted to
+// the organization of the workflow. An empty credentialType accepts any type.
+func nodeCredential(ctx context.Context, config map[string]interface{}, credentialType string) (map[string]string, error) {
+	id, ok := config["credential_id"].(float64)
+	if !ok || id <= 0 {
+		return nil, NewExecError(ErrorConfig, "credential_id is required in config")
+	}
+
+	if candidate, ok := ctx.Value(candidateCredentialKey{}).(candidateCredential); ok && candidate.credential.ID == uint(id) {
+		if credentialType != "" && candidate.credential.CredentialType != credentialType {
+			return nil, NewExecError(ErrorConfig, "credential %d is not a %s credential", candidate.credential.ID, credentialType)
+		}
+		return candidate.data, nil
+	}
+
+	// Credentials are stored in the database, which workers using the worker API cannot read
+	if !usesDatabase() {
+		return nil, fmt.Errorf("credential %d: %w", uint(id), ErrNoDatabase)
+	}
+
+	var organizationID uint
+	if info, ok := ExecutionInfoFromContext(ctx); ok {
+		var workflow models.Workflow
+		if err := database.DB.Select("organization_id").First(&workflow, info.WorkflowID).Error; err == nil {
+			organizationID = workflow.OrganizationID
+		}
+	}
+
+	data, err := credentials.Resolve(uint(id), organizationID, credentialType)
+	if err != nil {
+		return nil, &ExecError{Category: ErrorConfig, Err: err}
+	}
+	return data, nil
+}
+
+// credentialTestTimeout limits how long the test node of a credential may run
+const credentialTestTimeout = 30 * time.Second
+
+// credentialTestClasses are the executor classes test nodes of credentials may use. They only
+// call the external service, other executors would create records for an execution that does
+// not exist.
+var credentialTestClasses = map[string]bool{
+	"jira":                      true,
+	"github":                    true,
+	HttpDefinitionExecutorClass: true,
+}
+
+// candidateCredentialKey is the context key for candidateCredential
+type candidateCredentialKey struct{}
+
+// candidateCredential holds secrets of a credential that are tested before they are stored
+type candidateCredential struct {
+	credential models.Credential
+	data       map[string]string
+}
+
+// ValidateCredentialTest checks that the node type can be used to test credentials
+func ValidateCredentialTest(nodeTypeKey string) error {
+	nodeType, err := graphcache.NodeType(nodeTypeKey)
+	if err != nil {
+		return fmt.Errorf("unknown node type: %s", nodeTypeKey)
+	}
+	if !credentialTestClasses[nodeType.ExecutorClass] {
+		return fmt.Errorf("node type %s cannot test credentials, its executor class must be jira, github or %s", nodeTypeKey, HttpDefinitionExecutorClass)
+	}
+	return nil
+}
+
+// TestCredential runs the test node of the credential with the given secrets in place of the
+// stored ones and returns its output. The node's configuration references the credential.
+func TestCredential(credential models.Credential, data map[string]string) (interface{}, error) {
+	if credential.TestNodeType == "" {
+		return nil, fmt.Errorf("credential %d has no test_node_type", credential.ID)
+	}
+	if err := ValidateCredentialTest(credential.TestNodeType); err != nil {
+		return nil, err
+	}
+	nodeType, err := graphcache.NodeType(credential.TestNodeType)
+	if err != nil {
+		return nil, err
+	}
+	executor, err := LoadExecutor(nodeType.ExecutorClass)
+	if err != nil {
+		return nil, err
+	}
+
+	config := map[string]interface{}{}
+	if credential.TestConfig != "" {
+		if err := json.Unmarshal([]byte(credential.TestConfig), &config); err != nil {
+			return nil, fmt.Errorf("failed to parse test_config: %v", err)
+		}
+	}
+	config["credential_id"] = float64(credential.ID)
+
+	ctx, cancel := context.WithTimeout(context.Background(), credentialTestTimeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, candidateCredentialKey{}, candidateCredential{credential: credential, data: data})
+
+	result, err := invokeRecovering(ctx, nodeType.ExecutorClass, executor, config, map[string]interface{}{})
+	if branch, ok := result.(*BranchResult); ok {
+		result = branch.Output
+	}
+	return result, err
+}
+
+// callJSONAPI sends a request with a JSON body to an API of an integration and returns the
+// decoded response. Responses with a status code of 400 or above are returned as errors.
+func callJSONAPI(ctx context.Context, method, url string, headers map[string]string, body interface{}) (interface{}, error) {
+	request := httpRequest{Method: method, URL: url, Headers: headers}
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %v", err)
+		}
+		request.Body = data
+		request.JSON = true
+	}
+
+	result, err := sendHTTPRequest(ctx, request, map[string]interface{}{}, nil, expression.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	response := result.(map[string]interface{})
+	if status := response["status_code"].(int); status >= 400 {
+		message, _ := json.Marshal(response["data"])
+		return nil, NewExecError(statusErrorCategory(status), "%s %s failed with status %d: %s", method, url, status, message)
+	}
+	return response["data"], nil
+}
+
+// statusErrorCategory returns the category of a failed response of an API
+func statusErrorCategory(status int) ErrorCategory {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrorAuth
+	case status == http.StatusTooManyRequests:
+		return ErrorRateLimited
+	case status == http.StatusRequestTimeout || status >= 500:
+		return ErrorTransient
+	}
+	return ErrorData
+}
+
+// renderConfig renders the placeholders of a node's configuration against its input, keeping
+// the type of values consisting of a single placeholder
+func renderConfig(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (map[string]interface{}, error) {
+	rendered, err := expression.RenderValue(config, input, templateOptions(ctx, expression.Options{}))
+	if err != nil {
+		return nil, err
+	}
+	return rendered.(map[string]interface{}), nil
+}
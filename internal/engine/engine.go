@@ -1,13 +1,16 @@
 package engine
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"time"
 
-	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/lineage"
 	"github.com/altipard/flowcraft/internal/models"
+	core "github.com/altipard/flowcraft/pkg/engine"
 )
 
 // Engine is the central component for workflow execution
@@ -21,20 +24,110 @@ func NewEngine() *Engine {
 // ExecuteWorkflow executes a workflow
 func (e *Engine) ExecuteWorkflow(executionID uint) error {
 	// Load workflow execution
-	var execution models.WorkflowExecution
-	if err := database.DB.Preload("Workflow").Preload("Workflow.Nodes").Preload("Workflow.Connections").First(&execution, executionID).Error; err != nil {
+	execution, err := store.Execution(executionID)
+	if err != nil {
 		return err
 	}
+	// Executions cancelled before a worker picked them up are not started
+	if Cancelled(execution) {
+		return e.skipCancelled(execution)
+	}
+	// Duplicate tasks of finished executions neither run nor complete them again
+	if execution.Status == "completed" || execution.Status == "failed" {
+		return nil
+	}
 
 	// Update status
 	execution.Status = "running"
 	execution.StartedAt = time.Now()
-	database.DB.Save(&execution)
+	if err := store.SaveExecution(execution); err != nil {
+		return err
+	}
 
 	// Start execution
-	err := e.executeWorkflowInternal(&execution)
+	err = e.executeWorkflowInternal(execution)
 
 	// Completion
+	e.finishExecution(execution, err)
+
+	if errors.Is(err, ErrCancelled) {
+		return nil
+	}
+	return err
+}
+
+// ResumeNode completes a waiting node with the given output and continues the execution
+// with the nodes connected to the given output handle
+func (e *Engine) ResumeNode(executionID, nodeID uint, handle string, output interface{}) error {
+	execution, err := store.Execution(executionID)
+	if err != nil {
+		return err
+	}
+	if Cancelled(execution) {
+		return e.skipCancelled(execution)
+	}
+
+	waiting, err := store.NodeExecutions(executionID, NodeExecutionFilter{NodeID: nodeID, Statuses: []string{"waiting"}})
+	if err != nil {
+		return err
+	}
+	if len(waiting) == 0 {
+		return fmt.Errorf("node %d of execution %d is not waiting", nodeID, executionID)
+	}
+	nodeExecution := waiting[0]
+
+	execution.Status = "running"
+	if err := store.SaveExecution(execution); err != nil {
+		return err
+	}
+
+	err = e.resumeNodeInternal(execution, &nodeExecution, handle, output)
+
+	e.finishExecution(execution, err)
+
+	if errors.Is(err, ErrCancelled) {
+		return nil
+	}
+	return err
+}
+
+// skipCancelled finishes an execution cancelled while no worker ran it, unless that happened
+// already
+func (e *Engine) skipCancelled(execution *models.WorkflowExecution) error {
+	log.Printf("Execution %d was cancelled", execution.ID)
+	if execution.Status == StatusCancelled {
+		return nil
+	}
+	return cancelExecution(execution)
+}
+
+// finishExecution stores the final status of an execution. Executions with nodes still
+// waiting to be resumed stay in the status "waiting". Failed executions are compensated first,
+// cancelled ones are not.
+func (e *Engine) finishExecution(execution *models.WorkflowExecution, err error) {
+	if errors.Is(err, ErrCancelled) {
+		log.Printf("Execution %d was cancelled", execution.ID)
+		if err := cancelExecution(execution); err != nil {
+			log.Printf("Failed to cancel execution %d: %v", execution.ID, err)
+		}
+		return
+	}
+
+	if err == nil && e.hasWaitingNodes(execution.ID) {
+		execution.Status = "waiting"
+		if err := store.SaveExecution(execution); err != nil {
+			log.Printf("Failed to save execution %d: %v", execution.ID, err)
+		}
+		return
+	}
+
+	if err != nil {
+		// Undo the effects of the nodes completed so far before failing the execution
+		if compensationErr := e.compensate(execution, err); compensationErr != nil {
+			err = fmt.Errorf("%v (%v)", err, compensationErr)
+		}
+	}
+
 	now := time.Now()
 	execution.CompletedAt = &now
 	if err != nil {
@@ -43,9 +136,9 @@ func (e *Engine) ExecuteWorkflow(executionID uint) error {
 	} else {
 		execution.Status = "completed"
 	}
-	database.DB.Save(&execution)
-
-	return err
+	if err := store.CompleteExecution(execution); err != nil {
+		log.Printf("Failed to complete execution %d: %v", execution.ID, err)
+	}
 }
 
 // executeWorkflowInternal is the internal implementation of workflow execution
@@ -53,42 +146,108 @@ func (e *Engine) executeWorkflowInternal(execution *models.WorkflowExecution) er
 	// Workflow data
 	workflow := execution.Workflow
 
+	// Prepare context for execution
+	var inputData map[string]interface{}
+	err := json.Unmarshal([]byte(execution.InputData), &inputData)
+	if err != nil {
+		return fmt.Errorf("failed to parse input data: %v", err)
+	}
+
+	context := newExecutionContext(execution, inputData)
+
 	// Start with the start nodes (nodes without incoming connections)
-	var startNodes []models.Node
+	compensationNodes := compensationNodeIDs(workflow.Nodes)
+	var nodeIDs []uint
 	for _, node := range workflow.Nodes {
-		hasIncoming := false
-		for _, conn := range workflow.Connections {
-			if conn.TargetNodeID == node.ID {
-				hasIncoming = true
-				break
-			}
-		}
-		if !hasIncoming {
-			startNodes = append(startNodes, node)
+		if !compensationNodes[node.ID] && !node.IsAnnotation() {
+			nodeIDs = append(nodeIDs, node.ID)
 		}
 	}
-
-	if len(startNodes) == 0 {
+	steps := context.scheduler.StartSteps(nodeIDs)
+	if len(steps) == 0 {
 		return errors.New("workflow has no start nodes")
 	}
 
-	// Prepare context for execution
+	// Execute the start nodes and everything reachable from them
+	if err := e.run(execution.ID, context, steps); err != nil {
+		return err
+	}
+
+	return e.saveOutput(execution, context)
+}
+
+// resumeNodeInternal restores the execution context from the stored node results,
+// completes the waiting node and executes its successors
+func (e *Engine) resumeNodeInternal(execution *models.WorkflowExecution, nodeExecution *models.NodeExecution, handle string, output interface{}) error {
+	context, err := e.restoreContext(execution)
+	if err != nil {
+		return err
+	}
+
+	resultJSON, _ := json.Marshal(output)
+	nodeExecution.OutputData = string(resultJSON)
+	nodeExecution.BytesOut = int64(len(resultJSON))
+	nodeExecution.OutputHandle = handle
+	nodeExecution.Status = "completed"
+	now := time.Now()
+	nodeExecution.CompletedAt = &now
+	if err := store.SaveNodeExecution(nodeExecution); err != nil {
+		return err
+	}
+
+	context.Results[nodeExecution.NodeID] = output
+	context.scheduler.Claim(nodeExecution.NodeID)
+	context.finish(*nodeExecution)
+
+	if err := e.run(execution.ID, context, context.scheduler.ReadySuccessors(nodeExecution.NodeID)); err != nil {
+		return err
+	}
+
+	return e.saveOutput(execution, context)
+}
+
+// restoreContext rebuilds the execution context from the execution input and the outputs
+// of the nodes completed or skipped so far
+func (e *Engine) restoreContext(execution *models.WorkflowExecution) (*ExecutionContext, error) {
 	var inputData map[string]interface{}
-	err := json.Unmarshal([]byte(execution.InputData), &inputData)
+	if err := json.Unmarshal([]byte(execution.InputData), &inputData); err != nil {
+		return nil, fmt.Errorf("failed to parse input data: %v", err)
+	}
+
+	context := newExecutionContext(execution, inputData)
+
+	nodeExecutions, err := store.NodeExecutions(execution.ID, NodeExecutionFilter{
+		Statuses:             []string{"completed", "skipped"},
+		ExcludeCompensations: true,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to parse input data: %v", err)
+		return nil, err
 	}
 
-	context := NewExecutionContext(inputData)
+	for _, nodeExecution := range nodeExecutions {
+		// Finished nodes are not run again, their successors are ready once all inputs finished
+		context.scheduler.Claim(nodeExecution.NodeID)
+		context.finish(nodeExecution)
+		if nodeExecution.Status != "completed" {
+			continue
+		}
 
-	// Execute start nodes
-	for _, node := range startNodes {
-		if err := e.executeNode(node.ID, execution.ID, context); err != nil {
-			return err
+		output, err := loadPayload(nodeExecution.OutputData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load output of node %d: %v", nodeExecution.NodeID, err)
+		}
+		var result interface{}
+		if err := json.Unmarshal(output, &result); err != nil {
+			return nil, fmt.Errorf("failed to parse output of node %d: %v", nodeExecution.NodeID, err)
 		}
+		context.Results[nodeExecution.NodeID] = result
 	}
 
-	// Save results to execution
+	return context, nil
+}
+
+// saveOutput stores the results of all executed nodes as the execution output
+func (e *Engine) saveOutput(execution *models.WorkflowExecution, context *ExecutionContext) error {
 	outputJSON, err := json.Marshal(context.Results)
 	if err != nil {
 		return fmt.Errorf("failed to marshal output data: %v", err)
@@ -98,43 +257,141 @@ func (e *Engine) executeWorkflowInternal(execution *models.WorkflowExecution) er
 	return nil
 }
 
-// executeNode executes a single node
-func (e *Engine) executeNode(nodeID, executionID uint, context *ExecutionContext) error {
+// run executes or skips the scheduled nodes and the nodes becoming ready through them in
+// topological order, see core.Scheduler. Before each node it checks whether the execution was
+// cancelled and stops with ErrCancelled.
+func (e *Engine) run(executionID uint, execContext *ExecutionContext, steps []core.Step) error {
+	return execContext.scheduler.Run(steps, func(step core.Step) (bool, error) {
+		if err := checkCancelled(executionID); err != nil {
+			return false, err
+		}
+		if step.Skip {
+			return e.skipNode(step.NodeID, executionID, execContext)
+		}
+		return e.executeNode(step.NodeID, executionID, execContext)
+	})
+}
+
+// executeNode executes a single node. It reports whether the node finished, i.e. completed or
+// was skipped, so its successors may be ready; waiting nodes and nodes claimed by another run of
+// the execution did not.
+func (e *Engine) executeNode(nodeID, executionID uint, execContext *ExecutionContext) (bool, error) {
 	// Load node and related information
-	var node models.Node
-	if err := database.DB.First(&node, nodeID).Error; err != nil {
-		return err
+	node, err := execContext.graph.node(nodeID)
+	if err != nil {
+		return false, err
 	}
 
+	// The nodes of disabled groups are skipped as a unit
+	if node.GroupID != nil && execContext.graph.disabledGroups[*node.GroupID] {
+		return e.skipNode(nodeID, executionID, execContext)
+	}
+	if node.Disabled && node.DisabledMode == models.DisabledSkip {
+		return e.skipNode(nodeID, executionID, execContext)
+	}
+	profiler := newNodeProfiler(execContext, executionID, node)
+
 	// Load node type
-	var nodeType models.NodeType
-	if err := database.DB.Where("key = ?", node.NodeType).First(&nodeType).Error; err != nil {
-		return err
+	nodeType, err := store.NodeType(node.NodeType)
+	if err != nil {
+		return false, err
+	}
+
+	// Checkpoints of an earlier run of this execution (e.g. before a worker crash or restart)
+	checkpoints, err := store.NodeExecutions(executionID, NodeExecutionFilter{NodeID: nodeID, ExcludeCompensations: true})
+	if err != nil {
+		return false, err
+	}
+	var previous models.NodeExecution
+	hasPrevious := len(checkpoints) > 0
+	if hasPrevious {
+		previous = checkpoints[len(checkpoints)-1]
+	}
+
+	if hasPrevious {
+		switch previous.Status {
+		case "completed":
+			// Completed nodes are not executed again, their stored output is reused
+			output, err := loadPayload(previous.OutputData)
+			if err != nil {
+				return false, fmt.Errorf("failed to load output of node %d: %v", nodeID, err)
+			}
+			var result interface{}
+			if err := json.Unmarshal(output, &result); err != nil {
+				return false, fmt.Errorf("failed to parse output of node %d: %v", nodeID, err)
+			}
+			execContext.Results[nodeID] = result
+			execContext.finish(previous)
+			return true, nil
+		case "skipped":
+			execContext.finish(previous)
+			return true, nil
+		case "waiting":
+			return false, nil
+		}
 	}
 
-	// Create node execution
+	// Create node execution. A node interrupted while running is retried with the same attempt
+	// (and idempotency key) since its side effects may already have happened, a failed node
+	// with the next attempt.
+	attempt := 1
+	if hasPrevious {
+		attempt = previous.Attempt
+		if previous.Status == "failed" {
+			attempt++
+		}
+	}
 	nodeExecution := models.NodeExecution{
 		WorkflowExecutionID: executionID,
 		NodeID:              nodeID,
 		Status:              "running",
+		Attempt:             attempt,
+		IdempotencyKey:      IdempotencyKey(executionID, nodeID, attempt),
 	}
 	now := time.Now()
 	nodeExecution.StartedAt = &now
-	database.DB.Create(&nodeExecution)
+	if hasPrevious && previous.Status == "running" {
+		nodeExecution.ID = previous.ID
+		nodeExecution.CreatedAt = previous.CreatedAt
+	}
+	// Another run of the execution may have started the node since its checkpoints were loaded
+	claimed, err := store.ClaimNode(&nodeExecution, previous.ID)
+	if err != nil {
+		return false, err
+	}
+	if !claimed {
+		log.Printf("Execution %d, node %d: already claimed by another run", executionID, nodeID)
+		return false, nil
+	}
+	profiler.loaded()
+	defer profiler.save(&nodeExecution)
 
 	// Prepare input data
-	inputData := e.prepareNodeInput(node, executionID, context)
+	inputData, sources := execContext.scheduler.Input(nodeID, execContext.Input, execContext.Results)
 	inputJSON, _ := json.Marshal(inputData)
-	nodeExecution.InputData = string(inputJSON)
-	database.DB.Save(&nodeExecution)
+	nodeExecution.InputData = storedPayload(inputJSON, nodePayloadName(&nodeExecution, "input"))
+	nodeExecution.BytesIn = int64(len(inputJSON))
+	if err := store.SaveNodeExecution(&nodeExecution); err != nil {
+		return false, err
+	}
 
-	// Load executor for this node type and execute
-	executor, err := LoadExecutor(nodeType.ExecutorClass)
-	if err != nil {
-		nodeExecution.Status = "failed"
-		nodeExecution.ErrorMessage = fmt.Sprintf("failed to load executor: %v", err)
-		database.DB.Save(&nodeExecution)
-		return err
+	// Load executor for this node type and execute. Disabled nodes forward their input instead.
+	executor := core.NewPassthroughExecutor(execContext.scheduler.IsStart(nodeID))
+	if !node.Disabled {
+		executor, err = LoadExecutor(nodeType.ExecutorClass)
+		if err != nil {
+			nodeExecution.Status = "failed"
+			nodeExecution.ErrorMessage = fmt.Sprintf("failed to load executor: %v", err)
+			nodeExecution.ErrorCategory = string(ErrorConfig)
+			saveNodeExecution(&nodeExecution)
+			return false, err
+		}
+		// Pinned versions guard against silent behavior changes after node pack upgrades
+		if warning := versionWarning(node.NodeType, execContext.NodeTypeVersions[node.NodeType], executorVersion(executor, nodeType)); warning != "" {
+			log.Printf("Execution %d, node %d: %s", executionID, nodeID, warning)
+			nodeExecution.Warning = warning
+		}
+		executor = withChaos(executor, node.NodeType)
 	}
 
 	// Load node configuration
@@ -142,108 +399,200 @@ func (e *Engine) executeNode(nodeID, executionID uint, context *ExecutionContext
 	if err := json.Unmarshal([]byte(node.Config), &config); err != nil {
 		nodeExecution.Status = "failed"
 		nodeExecution.ErrorMessage = fmt.Sprintf("failed to parse node config: %v", err)
-		database.DB.Save(&nodeExecution)
-		return err
+		nodeExecution.ErrorCategory = string(ErrorConfig)
+		saveNodeExecution(&nodeExecution)
+		return false, err
+	}
+	timeout, err := NodeTimeout(config)
+	if err != nil {
+		nodeExecution.Status = "failed"
+		nodeExecution.ErrorMessage = err.Error()
+		nodeExecution.ErrorCategory = string(ErrorConfig)
+		saveNodeExecution(&nodeExecution)
+		return false, err
 	}
 
 	// Execute node
-	result, err := executor.Execute(config, inputData)
+	info := ExecutionInfo{
+		WorkflowID:      execContext.RootWorkflowID(node.WorkflowID),
+		ExecutionID:     executionID,
+		NodeID:          nodeID,
+		NodeExecutionID: nodeExecution.ID,
+		TriggerID:       execContext.TriggerID,
+		Attempt:         nodeExecution.Attempt,
+		IdempotencyKey:  nodeExecution.IdempotencyKey,
+	}
+	profiler.executing()
+	executeStart := time.Now()
+	result, err := executeWithRetries(context.Background(), executor, &Invocation{
+		ExecutionInfo: info,
+		NodeType:      node.NodeType,
+		ExecutorClass: nodeType.ExecutorClass,
+		Config:        config,
+		Input:         inputData,
+		Timeout:       timeout,
+	}, retriesTimeouts(executor, config))
+	nodeExecution.DurationMs = time.Since(executeStart).Milliseconds()
+	if !node.Disabled {
+		nodeExecution.Cost = estimateCost(nodeType, result, err)
+	}
+	profiler.executed()
 	if err != nil {
 		nodeExecution.Status = "failed"
 		nodeExecution.ErrorMessage = fmt.Sprintf("execution failed: %v", err)
+		nodeExecution.ErrorCode = errorCode(err)
+		nodeExecution.ErrorCategory = string(errorCategory(err))
+		nodeExecution.StackTrace = stackTrace(err)
 		now := time.Now()
 		nodeExecution.CompletedAt = &now
-		database.DB.Save(&nodeExecution)
-		return err
+		saveNodeExecution(&nodeExecution)
+		return false, err
+	}
+
+	// Suspended nodes wait to be resumed, their branch does not continue for now
+	if suspended, ok := result.(*SuspendResult); ok {
+		resultJSON, _ := json.Marshal(suspended.Output)
+		nodeExecution.OutputData = storedPayload(resultJSON, nodePayloadName(&nodeExecution, "output"))
+		nodeExecution.Status = "waiting"
+		return false, store.SaveNodeExecution(&nodeExecution)
+	}
+
+	// Branching nodes only activate the connections of one output handle
+	if branch, ok := result.(*BranchResult); ok {
+		nodeExecution.OutputHandle = branch.Handle
+		result = branch.Output
 	}
 
 	// Save result
 	resultJSON, _ := json.Marshal(result)
-	nodeExecution.OutputData = string(resultJSON)
+	nodeExecution.OutputData = storedPayload(resultJSON, nodePayloadName(&nodeExecution, "output"))
+	nodeExecution.BytesOut = int64(len(resultJSON))
+	if !node.Disabled {
+		if warning := saveArtifacts(node, &nodeExecution, resultJSON); warning != "" && nodeExecution.Warning != "" {
+			nodeExecution.Warning += "; " + warning
+		} else if warning != "" {
+			nodeExecution.Warning = warning
+		}
+	}
 	nodeExecution.Status = "completed"
 	now = time.Now()
 	nodeExecution.CompletedAt = &now
-	database.DB.Save(&nodeExecution)
+	if err := store.SaveNodeExecution(&nodeExecution); err != nil {
+		return false, err
+	}
 
-	// Save result in execution context
-	context.Results[nodeID] = result
+	profiler.save(&nodeExecution)
+	if node.Disabled {
+		// Disabled nodes pass on their input like filters
+		lineage.Record(executionID, nodeExecution.ID, nodeID, "filter", nil, lineage.Sources(sources))
+	} else {
+		lineage.Record(executionID, nodeExecution.ID, nodeID, nodeType.ExecutorClass, config, lineage.Sources(sources))
+	}
 
-	// Find and execute subsequent nodes
-	var connections []models.Connection
-	database.DB.Where("source_node_id = ?", nodeID).Find(&connections)
+	// Save result in execution context
+	execContext.Results[nodeID] = result
+	execContext.finish(nodeExecution)
 
-	for _, conn := range connections {
-		targetNodeID := conn.TargetNodeID
+	return true, nil
+}
 
-		// Check if all incoming connections for the target node are ready
-		if e.allInputsReady(targetNodeID, executionID) {
-			if err := e.executeNode(targetNodeID, executionID, context); err != nil {
-				return err
-			}
+// skipNode records a node as skipped, so the skip propagates to the successors only reachable
+// through it. It reports whether the node was skipped, false if another run claimed it.
+func (e *Engine) skipNode(nodeID, executionID uint, execContext *ExecutionContext) (bool, error) {
+	// Nodes skipped in an earlier run of the execution are already recorded
+	previous, err := store.NodeExecutions(executionID, NodeExecutionFilter{NodeID: nodeID, ExcludeCompensations: true})
+	if err != nil {
+		return false, err
+	}
+	var previousID uint
+	for _, nodeExecution := range previous {
+		if nodeExecution.Status == "skipped" {
+			execContext.finish(nodeExecution)
+			return true, nil
 		}
+		previousID = nodeExecution.ID
 	}
 
-	return nil
-}
-
-// prepareNodeInput prepares the input data for a node
-func (e *Engine) prepareNodeInput(node models.Node, executionID uint, context *ExecutionContext) map[string]interface{} {
-	// If there are no incoming connections, use the global input
-	var connections []models.Connection
-	database.DB.Where("target_node_id = ?", node.ID).Find(&connections)
-
-	if len(connections) == 0 {
-		return context.Input
+	now := time.Now()
+	nodeExecution := models.NodeExecution{
+		WorkflowExecutionID: executionID,
+		NodeID:              nodeID,
+		Status:              "skipped",
+		StartedAt:           &now,
+		CompletedAt:         &now,
 	}
-
-	// Otherwise, collect the outputs of the predecessor nodes
-	inputs := make(map[string]interface{})
-
-	for _, conn := range connections {
-		sourceNodeID := conn.SourceNodeID
-		targetHandle := conn.TargetHandle
-
-		if result, ok := context.Results[sourceNodeID]; ok {
-			if _, exists := inputs[targetHandle]; !exists {
-				inputs[targetHandle] = []interface{}{}
-			}
-
-			inputArray, _ := inputs[targetHandle].([]interface{})
-			inputs[targetHandle] = append(inputArray, result)
-		}
+	claimed, err := store.ClaimNode(&nodeExecution, previousID)
+	if err != nil || !claimed {
+		return false, err
 	}
 
-	return inputs
+	execContext.finish(nodeExecution)
+	return true, nil
 }
 
-// allInputsReady checks if all inputs of a node are ready
-func (e *Engine) allInputsReady(nodeID uint, executionID uint) bool {
-	var connections []models.Connection
-	database.DB.Where("target_node_id = ?", nodeID).Find(&connections)
-
-	for _, conn := range connections {
-		var nodeExecution models.NodeExecution
-		result := database.DB.Where("workflow_execution_id = ? AND node_id = ? AND status = ?",
-			executionID, conn.SourceNodeID, "completed").First(&nodeExecution)
-
-		if result.Error != nil {
-			return false
-		}
+// saveNodeExecution stores a failed node execution, logging errors since the failure of the
+// node is reported instead
+func saveNodeExecution(nodeExecution *models.NodeExecution) {
+	if err := store.SaveNodeExecution(nodeExecution); err != nil {
+		log.Printf("Failed to save execution of node %d: %v", nodeExecution.NodeID, err)
 	}
+}
 
-	return true
+// hasWaitingNodes reports whether nodes of the execution are waiting to be resumed
+func (e *Engine) hasWaitingNodes(executionID uint) bool {
+	waiting, err := store.NodeExecutions(executionID, NodeExecutionFilter{Statuses: []string{"waiting"}})
+	if err != nil {
+		log.Printf("Failed to load waiting nodes of execution %d: %v", executionID, err)
+	}
+	return len(waiting) > 0
 }
 
 // ExecutionContext holds the state during a workflow execution
 type ExecutionContext struct {
-	Input   map[string]interface{}
-	Results map[uint]interface{}
+	Input     map[string]interface{}
+	Results   map[uint]interface{}
+	TriggerID uint
+	// WorkflowID is the workflow the state and tasks of the execution belong to, for published
+	// versions the workflow they were published from
+	WorkflowID uint
+	// Profiling records a NodeProfile for each executed node
+	Profiling bool
+	// NodeTypeVersions are the node type versions pinned by the workflow version
+	NodeTypeVersions map[string]string
+
+	graph *workflowGraph
+	// scheduler decides which nodes are ready, tracking the nodes claimed and finished in this run
+	scheduler *core.Scheduler
+}
+
+// finish records a completed or skipped node execution
+func (c *ExecutionContext) finish(nodeExecution models.NodeExecution) {
+	c.scheduler.Finish(nodeExecution.NodeID, core.Outcome{
+		Skipped: nodeExecution.Status == "skipped",
+		Handle:  nodeExecution.OutputHandle,
+	})
+}
+
+// RootWorkflowID returns the workflow the state and tasks of the execution belong to, falling
+// back to the workflow of the node
+func (c *ExecutionContext) RootWorkflowID(nodeWorkflowID uint) uint {
+	if c.WorkflowID != 0 {
+		return c.WorkflowID
+	}
+	return nodeWorkflowID
 }
 
-// NewExecutionContext creates a new execution context
-func NewExecutionContext(input map[string]interface{}) *ExecutionContext {
+// newExecutionContext creates the context for running the nodes of an execution
+func newExecutionContext(execution *models.WorkflowExecution, input map[string]interface{}) *ExecutionContext {
+	graph := newWorkflowGraph(execution.Workflow)
 	return &ExecutionContext{
-		Input:   input,
-		Results: make(map[uint]interface{}),
+		Input:            input,
+		Results:          make(map[uint]interface{}),
+		TriggerID:        triggerID(execution),
+		Profiling:        execution.Profiling,
+		WorkflowID:       execution.Workflow.RootID(),
+		NodeTypeVersions: PinnedVersions(execution.Workflow),
+		graph:            graph,
+		scheduler:        core.NewScheduler(graph.connections),
 	}
 }
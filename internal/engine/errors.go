@@ -0,0 +1,196 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/breaker"
+)
+
+// ErrorCategory classifies why a node failed. The engine retries nodes failing with a retryable
+// category and fails the others right away.
+type ErrorCategory string
+
+const (
+	// ErrorConfig is an invalid or incomplete node configuration
+	ErrorConfig ErrorCategory = "config"
+	// ErrorAuth is a request rejected for missing or invalid credentials or permissions
+	ErrorAuth ErrorCategory = "auth"
+	// ErrorRateLimited is a request rejected by the rate limit of a service, retried
+	ErrorRateLimited ErrorCategory = "rate_limited"
+	// ErrorTransient is a network error or failure of a service that may succeed later, retried
+	ErrorTransient ErrorCategory = "transient"
+	// ErrorTimeout is a call exceeding the timeout of its node, only retried if the node sets
+	// retry_on_timeout and its executor stops at the deadline (see executeWithRetries)
+	ErrorTimeout ErrorCategory = "timeout"
+	// ErrorData is input the node or the service cannot process
+	ErrorData ErrorCategory = "data"
+)
+
+// ErrorCategories are the known error categories
+var ErrorCategories = []ErrorCategory{ErrorConfig, ErrorAuth, ErrorRateLimited, ErrorTransient, ErrorTimeout, ErrorData}
+
+// Retryable reports whether nodes failing with the category are retried
+func (c ErrorCategory) Retryable() bool {
+	return c == ErrorRateLimited || c == ErrorTransient
+}
+
+// ExecError is an error of an executor with its category. Executors return it so the engine
+// can tell failures worth retrying from ones that fail again.
+type ExecError struct {
+	Category ErrorCategory
+	Err      error
+	// RetryAfter is the delay requested by the service, e.g. via Retry-After, 0 for the default
+	RetryAfter time.Duration
+}
+
+// NewExecError returns an ExecError with the category and a formatted message
+func NewExecError(category ErrorCategory, format string, args ...interface{}) *ExecError {
+	return &ExecError{Category: category, Err: fmt.Errorf(format, args...)}
+}
+
+func (e *ExecError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExecError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCategory implements ErrorCategorizer
+func (e *ExecError) ErrorCategory() ErrorCategory {
+	return e.Category
+}
+
+// ErrorCategorizer is implemented by errors carrying their category, e.g. ExecError
+type ErrorCategorizer interface {
+	ErrorCategory() ErrorCategory
+}
+
+// errorCategory returns the category of an error. Network errors and rejections of open
+// circuits are transient; other errors without a category are not categorized.
+func errorCategory(err error) ErrorCategory {
+	var categorizer ErrorCategorizer
+	if errors.As(err, &categorizer) {
+		return categorizer.ErrorCategory()
+	}
+	var timeoutErr *TimeoutError
+	if errors.As(err, &timeoutErr) {
+		return ErrorTimeout
+	}
+	var netErr net.Error
+	var openErr *breaker.OpenError
+	if errors.As(err, &netErr) || errors.As(err, &openErr) || errors.Is(err, context.DeadlineExceeded) {
+		return ErrorTransient
+	}
+	return ""
+}
+
+// retryAfter returns the delay requested by the error, 0 if none
+func retryAfter(err error) time.Duration {
+	var execErr *ExecError
+	if errors.As(err, &execErr) {
+		return execErr.RetryAfter
+	}
+	return 0
+}
+
+// RetryConfig holds how often nodes failing with a retryable error are retried
+type RetryConfig struct {
+	// MaxRetries is the number of retries after the first failure, 0 disables retries
+	MaxRetries int
+	// Backoff is the delay before the first retry, doubled for each further retry
+	Backoff time.Duration
+	// MaxDelay bounds the delay before a retry, including delays requested by services
+	MaxDelay time.Duration
+}
+
+// RetryConfigFromEnv reads the retry settings from the environment
+func RetryConfigFromEnv() RetryConfig {
+	cfg := RetryConfig{MaxRetries: 2, Backoff: time.Second, MaxDelay: time.Minute}
+	if retries, err := strconv.Atoi(os.Getenv("NODE_RETRY_MAX")); err == nil && retries >= 0 {
+		cfg.MaxRetries = retries
+	}
+	if backoff, err := time.ParseDuration(os.Getenv("NODE_RETRY_BACKOFF")); err == nil && backoff > 0 {
+		cfg.Backoff = backoff
+	}
+	if delay, err := time.ParseDuration(os.Getenv("NODE_RETRY_MAX_DELAY")); err == nil && delay > 0 {
+		cfg.MaxDelay = delay
+	}
+	return cfg
+}
+
+// retryConfig are the retry settings of this process
+var retryConfig = RetryConfig{}
+
+// ConfigureRetries sets how often nodes failing with a retryable error are retried
+func ConfigureRetries(cfg RetryConfig) {
+	retryConfig = cfg
+}
+
+// retryDelay returns the delay before the given retry of a node that failed with err of the
+// category, and whether the node is retried at all
+func retryDelay(err error, category ErrorCategory, retry int) (time.Duration, bool) {
+	cfg := retryConfig
+	if retry > cfg.MaxRetries || !category.Retryable() {
+		return 0, false
+	}
+	delay := retryAfter(err)
+	if delay == 0 {
+		delay = cfg.Backoff << (retry - 1)
+	}
+	if cfg.MaxDelay > 0 && delay > cfg.MaxDelay {
+		delay = cfg.MaxDelay
+	}
+	return delay, true
+}
+
+// executeWithRetries executes a node, retrying retryable failures with the same attempt and
+// idempotency key as configured. Each try gets the full timeout of the node.
+//
+// Timed out calls of executors ignoring their context are abandoned but keep running, so
+// retrying them could apply the node twice. Timeouts are only retried like transient errors if
+// retryTimeouts is set, see retriesTimeouts.
+func executeWithRetries(ctx context.Context, executor NodeExecutor, invocation *Invocation, retryTimeouts bool) (interface{}, error) {
+	for retry := 1; ; retry++ {
+		result, err := execute(ctx, executor, invocation)
+		if err == nil {
+			return result, nil
+		}
+		category := errorCategory(err)
+		if category == ErrorTimeout && retryTimeouts {
+			category = ErrorTransient
+		}
+		delay, ok := retryDelay(err, category, retry)
+		if !ok {
+			return result, err
+		}
+		log.Printf("Execution %d, node %d: %s error, retrying in %s (%d/%d): %v",
+			invocation.ExecutionID, invocation.NodeID, errorCategory(err), delay, retry, retryConfig.MaxRetries, err)
+		time.Sleep(delay)
+	}
+}
+
+// retriesTimeouts reports whether timed out calls of the executor are retried: the node must opt
+// in with "retry_on_timeout": true in its config, and the executor must implement
+// ContextExecutor so that calls stop at the deadline
+func retriesTimeouts(executor NodeExecutor, config map[string]interface{}) bool {
+	if retry, _ := config["retry_on_timeout"].(bool); !retry {
+		return false
+	}
+	// What counts is the executor wrapped for fault injection or by plugins
+	if chaos, ok := executor.(*chaosExecutor); ok {
+		executor = chaos.executor
+	}
+	if quarantining, ok := executor.(*quarantiningExecutor); ok {
+		executor = quarantining.executor
+	}
+	_, ok := executor.(ContextExecutor)
+	return ok
+}
@@ -0,0 +1,59 @@
+package engine
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowExecutor ignores its context and takes longer than the timeout of the tests
+type slowExecutor struct {
+	calls *int32
+}
+
+func (e slowExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	atomic.AddInt32(e.calls, 1)
+	time.Sleep(50 * time.Millisecond)
+	return nil, nil
+}
+
+// stoppingExecutor stops at the deadline of its context
+type stoppingExecutor struct {
+	slowExecutor
+}
+
+func (e stoppingExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	atomic.AddInt32(e.calls, 1)
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestExecuteWithRetriesTimeouts(t *testing.T) {
+	ConfigureRetries(RetryConfig{MaxRetries: 2, Backoff: time.Millisecond})
+	defer ConfigureRetries(RetryConfig{})
+
+	tests := []struct {
+		name     string
+		executor func(calls *int32) NodeExecutor
+		config   map[string]interface{}
+		calls    int32
+	}{
+		{"not opted in", func(calls *int32) NodeExecutor { return stoppingExecutor{slowExecutor{calls}} }, map[string]interface{}{}, 1},
+		{"ignoring the context", func(calls *int32) NodeExecutor { return slowExecutor{calls} }, map[string]interface{}{"retry_on_timeout": true}, 1},
+		{"stopping at the deadline", func(calls *int32) NodeExecutor { return stoppingExecutor{slowExecutor{calls}} }, map[string]interface{}{"retry_on_timeout": true}, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			executor := tt.executor(&calls)
+			_, err := executeWithRetries(context.Background(), executor, &Invocation{Config: tt.config, Timeout: 5 * time.Millisecond}, retriesTimeouts(executor, tt.config))
+			if errorCategory(err) != ErrorTimeout {
+				t.Errorf("error = %v, want a timeout", err)
+			}
+			if got := atomic.LoadInt32(&calls); got != tt.calls {
+				t.Errorf("executor called %d times, want %d", got, tt.calls)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/events"
+	"github.com/altipard/flowcraft/internal/expression"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/schemas"
+)
+
+// defaultEventTimeout is how long waitForEvent nodes wait if no timeout is configured
+const defaultEventTimeout = 24 * time.Hour
+
+// EmitEventExecutor emits a named event other workflows can wait for
+type EmitEventExecutor struct{}
+
+func (e *EmitEventExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return e.ExecuteContext(context.Background(), config, input)
+}
+
+func (e *EmitEventExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	name, _ := config["name"].(string)
+	name, err := expression.Render(name, input, nil, expression.Options{RejectTemplateSyntax: true})
+	if err != nil {
+		return nil, NewExecError(ErrorData, "failed to render name: %v", err)
+	}
+
+	// Payload of the event, defaults to the node input
+	payload := interface{}(input)
+	if configPayload, ok := config["payload"]; ok {
+		payload = configPayload
+	}
+
+	var sourceExecutionID *uint
+	if info, ok := ExecutionInfoFromContext(ctx); ok {
+		sourceExecutionID = &info.ExecutionID
+	}
+
+	event, err := events.Emit(name, payload, sourceExecutionID)
+	var invalid *schemas.InvalidPayloadError
+	if errors.As(err, &invalid) {
+		return nil, &ExecError{Category: ErrorData, Err: err}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to emit event: %v", err)
+	}
+
+	return map[string]interface{}{
+		"event_id": event.ID,
+		"name":     event.Name,
+	}, nil
+}
+
+// WaitForEventExecutor pauses the execution until a matching event is emitted (continuing
+// with the "received" handle) or the timeout passed (continuing with "timeout")
+type WaitForEventExecutor struct{}
+
+func (e *WaitForEventExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return nil, fmt.Errorf("waitForEvent nodes can only run inside a workflow execution")
+}
+
+func (e *WaitForEventExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	info, ok := ExecutionInfoFromContext(ctx)
+	if !ok {
+		return e.Execute(config, input)
+	}
+
+	name, _ := config["name"].(string)
+	name, err := expression.Render(name, input, nil, expression.Options{RejectTemplateSyntax: true})
+	if err != nil {
+		return nil, NewExecError(ErrorData, "failed to render name: %v", err)
+	}
+	if name == "" {
+		return nil, NewExecError(ErrorConfig, "name is required")
+	}
+
+	// Payload fields the event must have, values may reference input data
+	match := make(map[string]interface{})
+	if configMatch, ok := config["match"].(map[string]interface{}); ok {
+		for key, value := range configMatch {
+			if str, ok := value.(string); ok {
+				rendered, err := expression.Render(str, input, nil, expression.Options{RejectTemplateSyntax: true})
+				if err != nil {
+					return nil, fmt.Errorf("failed to render match %s: %v", key, err)
+				}
+				value = rendered
+			}
+			match[key] = value
+		}
+	}
+
+	timeout := defaultEventTimeout
+	if value, ok := config["timeout"].(string); ok && value != "" {
+		if timeout, err = time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("invalid timeout: %v", err)
+		}
+	}
+
+	// Events emitted shortly before the node started can be taken from the event log
+	if value, ok := config["lookback"].(string); ok && value != "" {
+		lookback, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid lookback: %v", err)
+		}
+		event, err := events.FindRecent(name, match, time.Now().Add(-lookback))
+		if err != nil {
+			return nil, err
+		}
+		if event != nil {
+			return &BranchResult{Handle: events.HandleReceived, Output: events.Output(event)}, nil
+		}
+	}
+
+	matchJSON, _ := json.Marshal(match)
+	expiresAt := time.Now().Add(timeout)
+	subscription := models.EventSubscription{
+		WorkflowExecutionID: info.ExecutionID,
+		NodeID:              info.NodeID,
+		EventName:           name,
+		Match:               string(matchJSON),
+		Status:              "waiting",
+		ExpiresAt:           &expiresAt,
+	}
+	if err := database.DB.Create(&subscription).Error; err != nil {
+		return nil, fmt.Errorf("failed to create subscription: %v", err)
+	}
+
+	return &SuspendResult{Output: map[string]interface{}{
+		"subscription_id": subscription.ID,
+		"name":            name,
+		"expires_at":      expiresAt,
+	}}, nil
+}
@@ -1,34 +1,81 @@
 package engine
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"plugin"
 	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/breaker"
+	"github.com/altipard/flowcraft/internal/cache"
+	"github.com/altipard/flowcraft/internal/expression"
+	core "github.com/altipard/flowcraft/pkg/engine"
 )
 
 // NodeExecutor is the interface for all node executors
-type NodeExecutor interface {
-	Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error)
-}
+type NodeExecutor = core.NodeExecutor
 
 // LoadExecutor dynamically loads an executor
 func LoadExecutor(executorClass string) (NodeExecutor, error) {
+	// Refuse executor classes disabled on this installation
+	if !IsExecutorClassAllowed(executorClass) {
+		return nil, fmt.Errorf("executor class %s is not allowed on this installation", executorClass)
+	}
+	if databaseExecutorClasses[executorClass] && !usesDatabase() {
+		return nil, fmt.Errorf("executor class %s: %w", executorClass, ErrNoDatabase)
+	}
+
 	// For built-in executors
 	switch executorClass {
 	case "httpRequest":
 		return &HttpRequestExecutor{}, nil
 	case "filter":
 		return &FilterExecutor{}, nil
+	case "condition":
+		return &ConditionExecutor{}, nil
 	case "transform":
 		return &TransformExecutor{}, nil
+	case "template":
+		return &TemplateExecutor{}, nil
+	case "compression":
+		return &CompressionExecutor{}, nil
+	case "approval":
+		return &ApprovalExecutor{}, nil
+	case "humanTask":
+		return &HumanTaskExecutor{}, nil
+	case "emitEvent":
+		return &EmitEventExecutor{}, nil
+	case "waitForEvent":
+		return &WaitForEventExecutor{}, nil
+	case "state":
+		return &StateExecutor{}, nil
+	case "cache":
+		return &CacheExecutor{}, nil
+	case "jira":
+		return &JiraExecutor{}, nil
+	case "github":
+		return &GitHubExecutor{}, nil
+	case "slackRespond":
+		return &SlackRespondExecutor{}, nil
+	case "mqttPublish":
+		return &MQTTPublishExecutor{}, nil
+	case HttpDefinitionExecutorClass:
+		return &HttpDefinitionExecutor{}, nil
 	}
 
 	// For plugins (dynamically loaded executors)
 	if strings.HasPrefix(executorClass, "plugin:") {
 		pluginPath := strings.TrimPrefix(executorClass, "plugin:")
+		// Plugins of the plugins directory are reloaded when they change
+		if executor, ok, err := pluginExecutor(pluginPath); ok {
+			return executor, err
+		}
 		return loadPluginExecutor(pluginPath)
 	}
 
@@ -59,10 +106,16 @@ func loadPluginExecutor(pluginPath string) (NodeExecutor, error) {
 type HttpRequestExecutor struct{}
 
 func (e *HttpRequestExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return e.ExecuteContext(context.Background(), config, input)
+}
+
+// ExecuteContext sends the idempotency key of the node execution with requests that are not GET requests
+// and makes the state store available to the templates
+func (e *HttpRequestExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
 	// Get URL from configuration
 	url, ok := config["url"].(string)
 	if !ok {
-		return nil, fmt.Errorf("url is required in config")
+		return nil, NewExecError(ErrorConfig, "url is required in config")
 	}
 
 	// Get method from configuration or use default
@@ -71,69 +124,128 @@ func (e *HttpRequestExecutor) Execute(config map[string]interface{}, input map[s
 		method = "GET"
 	}
 
-	// Get headers from configuration
+	// Optionally refuse input values that contain template syntax themselves
+	templateOpts := expression.Options{}
+	templateOpts.RejectTemplateSyntax, _ = config["reject_template_input"].(bool)
+	templateOpts = templateOptions(ctx, templateOpts)
+
+	// Replace template placeholders in the URL, escaping values for their position
+	url, err := expression.RenderURL(url, input, templateOpts)
+	if err != nil {
+		return nil, NewExecError(ErrorData, "failed to render url: %v", err)
+	}
+
+	// Get headers from configuration and replace template placeholders in their values
 	headers := make(map[string]string)
 	if headersConfig, ok := config["headers"].(map[string]interface{}); ok {
 		for key, value := range headersConfig {
 			if strValue, ok := value.(string); ok {
-				headers[key] = strValue
+				rendered, err := expression.Render(strValue, input, expression.HeaderEscape, templateOpts)
+				if err != nil {
+					return nil, NewExecError(ErrorData, "failed to render header %s: %v", key, err)
+				}
+				headers[key] = rendered
 			}
 		}
 	}
 
-	// Replace template placeholders in the URL
-	if strings.Contains(url, "{{") && strings.Contains(url, "}}") {
-		for key, value := range input {
-			placeholder := "{{" + key + "}}"
-			if strings.Contains(url, placeholder) {
-				url = strings.Replace(url, placeholder, fmt.Sprintf("%v", value), -1)
+	// Prepare the request body for POST/PUT from configuration
+	request := httpRequest{Method: method, URL: url, Headers: headers}
+	if method != "GET" && method != "DELETE" {
+		if data, ok := config["json_data"]; ok {
+			request.Body, err = json.Marshal(data)
+			if err != nil {
+				return nil, NewExecError(ErrorConfig, "failed to marshal json data: %v", err)
 			}
 		}
+		request.JSON = true
 	}
 
+	return sendHTTPRequest(ctx, request, config, input, templateOpts)
+}
+
+// httpRequest is a fully rendered request of an HTTP node
+type httpRequest struct {
+	Method  string
+	URL     string
+	Headers map[string]string
+	Body    []byte
+	// JSON sends Body with a JSON content type
+	JSON bool
+}
+
+// sendHTTPRequest executes a rendered request of an HTTP node. config provides the node's
+// cache and circuit breaker settings, input and templateOpts are used to render cache_key.
+func sendHTTPRequest(ctx context.Context, request httpRequest, config map[string]interface{}, input map[string]interface{}, templateOpts expression.Options) (interface{}, error) {
+	info, _ := ExecutionInfoFromContext(ctx)
+	idempotencyKey := info.IdempotencyKey
+	method := request.Method
+
 	// Create HTTP client
 	client := &http.Client{}
 
 	// Prepare HTTP request
 	var req *http.Request
 	var err error
-
-	if method == "GET" || method == "DELETE" {
-		req, err = http.NewRequest(method, url, nil)
-	} else {
-		// Get JSON data for POST/PUT from configuration
-		var jsonData []byte
-		if data, ok := config["json_data"]; ok {
-			jsonData, err = json.Marshal(data)
-			if err != nil {
-				return nil, fmt.Errorf("failed to marshal json data: %v", err)
-			}
+	if request.JSON {
+		req, err = http.NewRequestWithContext(ctx, method, request.URL, strings.NewReader(string(request.Body)))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/json")
 		}
-
-		req, err = http.NewRequest(method, url, strings.NewReader(string(jsonData)))
-		req.Header.Set("Content-Type", "application/json")
+	} else {
+		req, err = http.NewRequestWithContext(ctx, method, request.URL, nil)
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %v", err)
+		return nil, NewExecError(ErrorConfig, "failed to create request: %v", err)
 	}
 
 	// Set headers
-	for key, value := range headers {
+	for key, value := range request.Headers {
 		req.Header.Set(key, value)
 	}
 
+	// Let the receiver deduplicate retried requests, unless the node configures its own key
+	if idempotencyKey != "" && method != "GET" && req.Header.Get("Idempotency-Key") == "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	// Reuse a cached response if caching is enabled for the node
+	cacheTTL, cacheKey, err := httpCacheSettings(config, input, templateOpts, method, request.URL, request.Body)
+	if err != nil {
+		return nil, err
+	}
+	if cacheTTL > 0 {
+		var cached map[string]interface{}
+		if found, err := cache.Get(ctx, cacheKey, &cached); err == nil && found {
+			cached["cached"] = true
+			return cached, nil
+		}
+	}
+
+	// Fail fast while the target is unhealthy, unless the node opts out
+	breakerKey := ""
+	if useBreaker, ok := config["circuit_breaker"].(bool); !ok || useBreaker {
+		breakerKey = circuitKey(req)
+		if err := breaker.Default().Allow(breakerKey); err != nil {
+			return nil, err
+		}
+	}
+
 	// Execute request
 	resp, err := client.Do(req)
+	if breakerKey != "" {
+		breaker.Default().Done(breakerKey, err != nil || resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("request failed: %v", err)
+		return nil, NewExecError(ErrorTransient, "request failed: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// Read response body
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read response: %v", err)
+		return nil, NewExecError(ErrorTransient, "failed to read response: %v", err)
 	}
 
 	// Try to parse the response as JSON
@@ -145,10 +257,54 @@ func (e *HttpRequestExecutor) Execute(config map[string]interface{}, input map[s
 		}
 	}
 
-	return map[string]interface{}{
+	response := map[string]interface{}{
 		"status_code": resp.StatusCode,
 		"data":        result,
-	}, nil
+	}
+
+	// Only successful responses are cached, cache failures don't fail the request
+	if cacheTTL > 0 {
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			cache.Set(ctx, cacheKey, response, cacheTTL)
+		}
+		response["cached"] = false
+	}
+
+	return response, nil
+}
+
+// circuitKey identifies the circuit of a request: its host and, if present, its credentials
+func circuitKey(req *http.Request) string {
+	key := req.URL.Host
+	if authorization := req.Header.Get("Authorization"); authorization != "" {
+		sum := sha256.Sum256([]byte(authorization))
+		key += "#" + hex.EncodeToString(sum[:4])
+	}
+	return key
+}
+
+// httpCacheSettings returns the cache TTL of an HTTP request node and the cache key of the request.
+// Without cache_key the key is derived from method, URL and body.
+func httpCacheSettings(config map[string]interface{}, input map[string]interface{}, opts expression.Options, method, url string, body []byte) (time.Duration, string, error) {
+	value, _ := config["cache_ttl"].(string)
+	if value == "" {
+		return 0, "", nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, "", NewExecError(ErrorConfig, "invalid cache_ttl: %v", err)
+	}
+
+	if keyTemplate, ok := config["cache_key"].(string); ok && keyTemplate != "" {
+		key, err := expression.Render(keyTemplate, input, nil, opts)
+		if err != nil {
+			return 0, "", NewExecError(ErrorData, "failed to render cache_key: %v", err)
+		}
+		return ttl, "http:" + key, nil
+	}
+
+	sum := sha256.Sum256([]byte(method + " " + url + "\n" + string(body)))
+	return ttl, "http:" + hex.EncodeToString(sum[:]), nil
 }
 
 // FilterExecutor filters data based on conditions
@@ -252,7 +408,7 @@ func (e *TransformExecutor) Execute(config map[string]interface{}, input map[str
 	// Mapping-Template aus der Konfiguration holen
 	mapping, ok := config["mapping"]
 	if !ok {
-		return nil, fmt.Errorf("mapping is required in config")
+		return nil, NewExecError(ErrorConfig, "mapping is required in config")
 	}
 
 	// Eingangsdaten auslesen
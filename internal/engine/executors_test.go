@@ -0,0 +1,38 @@
+package engine
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHttpRequestExecutorEscapesHeaderValues(t *testing.T) {
+	received := make(chan http.Header, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Clone()
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	config := map[string]interface{}{
+		"url":             server.URL,
+		"circuit_breaker": false,
+		"headers": map[string]interface{}{
+			"X-Name": "Name: {{ name }}",
+		},
+	}
+	input := map[string]interface{}{"name": "alice\r\nX-Injected: 1\n"}
+
+	executor := &HttpRequestExecutor{}
+	if _, err := executor.Execute(config, input); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	header := <-received
+	if got, want := header.Get("X-Name"), "Name: aliceX-Injected: 1"; got != want {
+		t.Errorf("X-Name = %q, want %q", got, want)
+	}
+	if got := header.Get("X-Injected"); got != "" {
+		t.Errorf("X-Injected = %q, want no injected header", got)
+	}
+}
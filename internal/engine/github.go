@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	neturl "net/url"
+	"strings"
+)
+
+// githubSearchPageSize is the number of issues requested per page of a search (the API maximum)
+const githubSearchPageSize = 100
+
+// GitHubExecutor creates, updates, comments on and searches GitHub issues and pull requests
+// using a stored github credential
+type GitHubExecutor struct{}
+
+func (e *GitHubExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return e.ExecuteContext(context.Background(), config, input)
+}
+
+func (e *GitHubExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	config, err := renderConfig(ctx, config, input)
+	if err != nil {
+		return nil, NewExecError(ErrorData, "failed to render config: %v", err)
+	}
+
+	credential, err := nodeCredential(ctx, config, "github")
+	if err != nil {
+		return nil, err
+	}
+
+	// GitHub Enterprise Server installations configure their API URL on the credential
+	baseURL := strings.TrimSuffix(credential["base_url"], "/")
+	if baseURL == "" {
+		baseURL = "https://api.github.com"
+	}
+	headers := map[string]string{
+		"Accept":               "application/vnd.github+json",
+		"Authorization":        "Bearer " + credential["token"],
+		"X-GitHub-Api-Version": "2022-11-28",
+	}
+
+	operation, _ := config["operation"].(string)
+	if operation == "search_issues" {
+		query, _ := config["query"].(string)
+		if query == "" {
+			return nil, NewExecError(ErrorConfig, "query is required in config")
+		}
+		return e.search(ctx, baseURL, headers, query, maxResultsSetting(config))
+	}
+
+	owner, _ := config["owner"].(string)
+	repo, _ := config["repo"].(string)
+	if owner == "" || repo == "" {
+		return nil, NewExecError(ErrorConfig, "owner and repo are required in config")
+	}
+	issuesURL := fmt.Sprintf("%s/repos/%s/%s/issues", baseURL, neturl.PathEscape(owner), neturl.PathEscape(repo))
+
+	switch operation {
+	case "create_issue":
+		issue := githubIssueFields(config)
+		if issue["title"] == nil {
+			return nil, NewExecError(ErrorConfig, "title is required in config")
+		}
+		return callJSONAPI(ctx, "POST", issuesURL, headers, issue)
+
+	case "update_issue":
+		number, err := githubNumber(config)
+		if err != nil {
+			return nil, err
+		}
+		return callJSONAPI(ctx, "PATCH", fmt.Sprintf("%s/%d", issuesURL, number), headers, githubIssueFields(config))
+
+	case "create_comment":
+		// Pull requests share the comments API of issues
+		number, err := githubNumber(config)
+		if err != nil {
+			return nil, err
+		}
+		body, _ := config["body"].(string)
+		if body == "" {
+			return nil, NewExecError(ErrorConfig, "body is required in config")
+		}
+		return callJSONAPI(ctx, "POST", fmt.Sprintf("%s/%d/comments", issuesURL, number), headers, map[string]interface{}{"body": body})
+
+	default:
+		return nil, NewExecError(ErrorConfig, "unknown operation: %q", operation)
+	}
+}
+
+// search pages through the issues and pull requests matching the search query
+func (e *GitHubExecutor) search(ctx context.Context, baseURL string, headers map[string]string, query string, maxResults int) (interface{}, error) {
+	items := []interface{}{}
+	total := 0
+	for page := 1; len(items) < maxResults; page++ {
+		url := fmt.Sprintf("%s/search/issues?q=%s&per_page=%d&page=%d", baseURL, neturl.QueryEscape(query), githubSearchPageSize, page)
+		result, err := callJSONAPI(ctx, "GET", url, headers, nil)
+		if err != nil {
+			return nil, err
+		}
+		response, _ := result.(map[string]interface{})
+		pageItems, _ := response["items"].([]interface{})
+		if value, ok := response["total_count"].(float64); ok {
+			total = int(value)
+		}
+
+		items = append(items, pageItems...)
+		if len(pageItems) < githubSearchPageSize {
+			break
+		}
+	}
+	if len(items) > maxResults {
+		items = items[:maxResults]
+	}
+
+	return map[string]interface{}{
+		"items": items,
+		"count": len(items),
+		"total": total,
+	}, nil
+}
+
+// githubIssueFields collects the configured fields of an issue to create or update
+func githubIssueFields(config map[string]interface{}) map[string]interface{} {
+	issue := map[string]interface{}{}
+	for _, key := range []string{"title", "body", "state", "state_reason", "labels", "assignees", "milestone"} {
+		if value, ok := config[key]; ok {
+			issue[key] = value
+		}
+	}
+	return issue
+}
+
+// githubNumber returns the configured issue or pull request number
+func githubNumber(config map[string]interface{}) (int, error) {
+	switch value := config["number"].(type) {
+	case float64:
+		return int(value), nil
+	case string:
+		var number int
+		if _, err := fmt.Sscanf(value, "%d", &number); err == nil {
+			return number, nil
+		}
+	}
+	return 0, NewExecError(ErrorConfig, "number is required in config")
+}
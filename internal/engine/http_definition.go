@@ -0,0 +1,366 @@
+package engine
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"sort"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/expression"
+	"github.com/altipard/flowcraft/internal/graphcache"
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// HttpDefinitionExecutorClass is the executor class of node types defined by an HttpNodeDefinition
+const HttpDefinitionExecutorClass = "httpDefinition"
+
+// HttpNodeDefinition describes a REST API as a node type: each operation becomes a request
+// built from the parameters configured on the node
+type HttpNodeDefinition struct {
+	BaseURL    string                       `json:"base_url"`
+	Auth       HttpNodeAuth                 `json:"auth"`
+	Headers    map[string]string            `json:"headers"`
+	Operations map[string]HttpNodeOperation `json:"operations"`
+}
+
+// HttpNodeAuth describes how the credentials configured on a node are sent
+type HttpNodeAuth struct {
+	Type string `json:"type"` // none, bearer, basic, api_key
+	// In is where an API key is sent: header (default) or query
+	In string `json:"in"`
+	// Name is the header or query parameter of an API key (default X-API-Key)
+	Name string `json:"name"`
+}
+
+// HttpNodeOperation is a single request of a declarative HTTP node type. Path, query, header
+// and body values are templates rendered against the operation's parameters.
+type HttpNodeOperation struct {
+	Description string              `json:"description"`
+	Method      string              `json:"method"`
+	Path        string              `json:"path"`
+	Query       map[string]string   `json:"query"`
+	Headers     map[string]string   `json:"headers"`
+	Body        interface{}         `json:"body"`
+	Parameters  []HttpNodeParameter `json:"parameters"`
+}
+
+// HttpNodeParameter is a parameter of an operation
+type HttpNodeParameter struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Required    bool        `json:"required"`
+	Default     interface{} `json:"default"`
+	// Schema is the JSON schema of the parameter's value, used in the node type's config schema
+	Schema map[string]interface{} `json:"schema,omitempty"`
+}
+
+// ParseHttpNodeDefinition parses and validates the definition of a declarative HTTP node type
+func ParseHttpNodeDefinition(data string) (*HttpNodeDefinition, error) {
+	var definition HttpNodeDefinition
+	if err := json.Unmarshal([]byte(data), &definition); err != nil {
+		return nil, fmt.Errorf("invalid definition: %v", err)
+	}
+
+	baseURL, err := neturl.Parse(definition.BaseURL)
+	if err != nil || (baseURL.Scheme != "http" && baseURL.Scheme != "https") || baseURL.Host == "" {
+		return nil, fmt.Errorf("base_url must be an absolute http(s) URL")
+	}
+
+	switch definition.Auth.Type {
+	case "", "none", "bearer", "basic":
+	case "api_key":
+		if definition.Auth.In != "" && definition.Auth.In != "header" && definition.Auth.In != "query" {
+			return nil, fmt.Errorf("auth.in must be header or query")
+		}
+	default:
+		return nil, fmt.Errorf("unknown auth type: %s", definition.Auth.Type)
+	}
+
+	if len(definition.Operations) == 0 {
+		return nil, fmt.Errorf("at least one operation is required")
+	}
+	for name, operation := range definition.Operations {
+		switch strings.ToUpper(operation.Method) {
+		case "GET", "POST", "PUT", "PATCH", "DELETE":
+		default:
+			return nil, fmt.Errorf("operation %s: unsupported method %q", name, operation.Method)
+		}
+		if operation.Path != "" && !strings.HasPrefix(operation.Path, "/") {
+			return nil, fmt.Errorf("operation %s: path must start with /", name)
+		}
+		for _, parameter := range operation.Parameters {
+			if parameter.Name == "" {
+				return nil, fmt.Errorf("operation %s: parameters need a name", name)
+			}
+		}
+	}
+
+	return &definition, nil
+}
+
+// ConfigSchema derives the configuration schema of nodes of the type from the definition
+func (d *HttpNodeDefinition) ConfigSchema() string {
+	operations := make([]string, 0, len(d.Operations))
+	parameters := map[string]interface{}{}
+	for name, operation := range d.Operations {
+		operations = append(operations, name)
+		for _, parameter := range operation.Parameters {
+			property := map[string]interface{}{}
+			for key, value := range parameter.Schema {
+				property[key] = value
+			}
+			if parameter.Description != "" {
+				property["description"] = parameter.Description
+			}
+			parameters[parameter.Name] = property
+		}
+	}
+	sort.Strings(operations)
+
+	credentials := map[string]interface{}{}
+	switch d.Auth.Type {
+	case "bearer":
+		credentials["token"] = map[string]string{"type": "string"}
+	case "basic":
+		credentials["username"] = map[string]string{"type": "string"}
+		credentials["password"] = map[string]string{"type": "string"}
+	case "api_key":
+		credentials["api_key"] = map[string]string{"type": "string"}
+	}
+
+	schema, _ := json.Marshal(map[string]interface{}{
+		"properties": map[string]interface{}{
+			"operation":       map[string]interface{}{"type": "string", "enum": operations},
+			"parameters":      map[string]interface{}{"type": "object", "properties": parameters},
+			"credentials":     map[string]interface{}{"type": "object", "properties": credentials},
+			"credential_id":   map[string]string{"type": "integer"},
+			"cache_ttl":       map[string]string{"type": "string"},
+			"circuit_breaker": map[string]string{"type": "boolean"},
+		},
+	})
+	return string(schema)
+}
+
+// HttpDefinitionExecutor executes the operations of declarative HTTP node types
+type HttpDefinitionExecutor struct{}
+
+func (e *HttpDefinitionExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return e.ExecuteContext(context.Background(), config, input)
+}
+
+// ExecuteContext loads the definition of the node's type and sends the configured operation
+func (e *HttpDefinitionExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	info, ok := ExecutionInfoFromContext(ctx)
+	if !ok {
+		return nil, fmt.Errorf("declarative HTTP nodes require an execution context")
+	}
+
+	var node models.Node
+	if err := database.DB.First(&node, info.NodeID).Error; err != nil {
+		return nil, err
+	}
+	nodeType, err := graphcache.NodeType(node.NodeType)
+	if err != nil {
+		return nil, err
+	}
+	definition, err := ParseHttpNodeDefinition(nodeType.Definition)
+	if err != nil {
+		return nil, fmt.Errorf("node type %s: %v", nodeType.Key, err)
+	}
+
+	// Nodes of types with a single operation don't have to name it
+	operationName, _ := config["operation"].(string)
+	if operationName == "" && len(definition.Operations) == 1 {
+		for name := range definition.Operations {
+			operationName = name
+		}
+	}
+	operation, ok := definition.Operations[operationName]
+	if !ok {
+		return nil, NewExecError(ErrorConfig, "unknown operation: %q", operationName)
+	}
+
+	templateOpts := expression.Options{}
+	templateOpts.RejectTemplateSyntax, _ = config["reject_template_input"].(bool)
+	templateOpts = templateOptions(ctx, templateOpts)
+
+	params, err := httpDefinitionParams(operation, config, input, templateOpts)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build the URL, escaping parameters for their position. Query parameters rendering to an
+	// empty value are omitted.
+	path, err := expression.Render(operation.Path, params, neturl.PathEscape, templateOpts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render path: %v", err)
+	}
+	query := neturl.Values{}
+	for key, template := range operation.Query {
+		value, err := expression.Render(template, params, nil, templateOpts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render query parameter %s: %v", key, err)
+		}
+		if value != "" && !expression.ContainsTemplateSyntax(value) {
+			query.Set(key, value)
+		}
+	}
+
+	// Headers rendering to an empty value are omitted as well
+	headers := make(map[string]string)
+	for _, source := range []map[string]string{definition.Headers, operation.Headers} {
+		for key, template := range source {
+			value, err := expression.Render(template, params, expression.HeaderEscape, templateOpts)
+			if err != nil {
+				return nil, NewExecError(ErrorData, "failed to render header %s: %v", key, err)
+			}
+			if value != "" && !expression.ContainsTemplateSyntax(value) {
+				headers[key] = value
+			}
+		}
+	}
+
+	// Credentials are configured on the node or taken from a stored credential
+	credentials, _ := config["credentials"].(map[string]interface{})
+	if _, ok := config["credential_id"]; ok {
+		stored, err := nodeCredential(ctx, config, "")
+		if err != nil {
+			return nil, err
+		}
+		credentials = make(map[string]interface{}, len(stored))
+		for key, value := range stored {
+			credentials[key] = value
+		}
+	}
+	if err := applyHttpDefinitionAuth(definition.Auth, credentials, headers, query); err != nil {
+		return nil, err
+	}
+
+	request := httpRequest{
+		Method:  strings.ToUpper(operation.Method),
+		URL:     strings.TrimSuffix(definition.BaseURL, "/") + path,
+		Headers: headers,
+	}
+	if len(query) > 0 {
+		separator := "?"
+		if strings.Contains(request.URL, "?") {
+			separator = "&"
+		}
+		request.URL += separator + query.Encode()
+	}
+	if operation.Body != nil {
+		body, err := expression.RenderValue(omitMissingFields(operation.Body, params), params, templateOpts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render body: %v", err)
+		}
+		if request.Body, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("failed to marshal body: %v", err)
+		}
+		request.JSON = true
+	}
+
+	return sendHTTPRequest(ctx, request, config, params, templateOpts)
+}
+
+// httpDefinitionParams collects the parameters of an operation: the node input, overridden by
+// the parameter defaults and the parameters configured on the node (rendered against the input)
+func httpDefinitionParams(operation HttpNodeOperation, config map[string]interface{}, input map[string]interface{}, opts expression.Options) (map[string]interface{}, error) {
+	params := make(map[string]interface{}, len(input))
+	for key, value := range input {
+		params[key] = value
+	}
+	for _, parameter := range operation.Parameters {
+		if parameter.Default != nil {
+			params[parameter.Name] = parameter.Default
+		}
+	}
+
+	if configured, ok := config["parameters"].(map[string]interface{}); ok {
+		for key, value := range configured {
+			rendered, err := expression.RenderValue(value, input, opts)
+			if err != nil {
+				return nil, fmt.Errorf("failed to render parameter %s: %v", key, err)
+			}
+			params[key] = rendered
+		}
+	}
+
+	for _, parameter := range operation.Parameters {
+		if value, ok := params[parameter.Name]; parameter.Required && (!ok || value == nil || value == "") {
+			return nil, NewExecError(ErrorConfig, "parameter %s is required", parameter.Name)
+		}
+	}
+
+	return params, nil
+}
+
+// omitMissingFields removes the fields of a body template whose value is a single placeholder
+// referencing a parameter without value, so optional fields are not sent
+func omitMissingFields(body interface{}, params map[string]interface{}) interface{} {
+	fields, ok := body.(map[string]interface{})
+	if !ok {
+		return body
+	}
+
+	result := make(map[string]interface{}, len(fields))
+	for key, value := range fields {
+		if template, isString := value.(string); isString {
+			if path, ok := expression.Placeholder(template); ok && !strings.HasPrefix(path, "$") {
+				if _, found := expression.Lookup(params, path); !found {
+					continue
+				}
+			}
+		}
+		result[key] = omitMissingFields(value, params)
+	}
+	return result
+}
+
+// applyHttpDefinitionAuth adds the node's credentials to the request as described by the definition
+func applyHttpDefinitionAuth(auth HttpNodeAuth, credentials map[string]interface{}, headers map[string]string, query neturl.Values) error {
+	credential := func(name string) (string, error) {
+		value, _ := credentials[name].(string)
+		if value == "" {
+			return "", NewExecError(ErrorConfig, "credentials.%s is required", name)
+		}
+		return value, nil
+	}
+
+	switch auth.Type {
+	case "bearer":
+		token, err := credential("token")
+		if err != nil {
+			return err
+		}
+		headers["Authorization"] = "Bearer " + expression.HeaderEscape(token)
+	case "basic":
+		username, err := credential("username")
+		if err != nil {
+			return err
+		}
+		password, _ := credentials["password"].(string)
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	case "api_key":
+		key, err := credential("api_key")
+		if err != nil {
+			return err
+		}
+		name := auth.Name
+		if auth.In == "query" {
+			if name == "" {
+				name = "api_key"
+			}
+			query.Set(name, key)
+		} else {
+			if name == "" {
+				name = "X-API-Key"
+			}
+			headers[name] = expression.HeaderEscape(key)
+		}
+	}
+	return nil
+}
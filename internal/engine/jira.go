@@ -0,0 +1,146 @@
+package engine
+
+import (
+	"context"
+	"encoding/base64"
+	neturl "net/url"
+	"strings"
+)
+
+// jiraSearchPageSize is the number of issues requested per page of a search
+const jiraSearchPageSize = 50
+
+// JiraExecutor creates, updates and searches Jira issues using a stored jira credential
+type JiraExecutor struct{}
+
+func (e *JiraExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return e.ExecuteContext(context.Background(), config, input)
+}
+
+func (e *JiraExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	config, err := renderConfig(ctx, config, input)
+	if err != nil {
+		return nil, NewExecError(ErrorData, "failed to render config: %v", err)
+	}
+
+	credential, err := nodeCredential(ctx, config, "jira")
+	if err != nil {
+		return nil, err
+	}
+	baseURL := strings.TrimSuffix(credential["base_url"], "/") + "/rest/api/2"
+
+	// Jira Cloud authenticates with email and API token, Jira Data Center with a personal access token
+	headers := map[string]string{"Accept": "application/json"}
+	if credential["api_token"] != "" {
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(credential["email"]+":"+credential["api_token"]))
+	} else {
+		headers["Authorization"] = "Bearer " + credential["token"]
+	}
+
+	operation, _ := config["operation"].(string)
+	switch operation {
+	case "create":
+		fields := jiraFields(config)
+		project, _ := config["project"].(string)
+		if project == "" {
+			return nil, NewExecError(ErrorConfig, "project is required in config")
+		}
+		issueType, _ := config["issue_type"].(string)
+		if issueType == "" {
+			issueType = "Task"
+		}
+		fields["project"] = map[string]interface{}{"key": project}
+		fields["issuetype"] = map[string]interface{}{"name": issueType}
+		if fields["summary"] == nil {
+			return nil, NewExecError(ErrorConfig, "summary is required in config")
+		}
+		return callJSONAPI(ctx, "POST", baseURL+"/issue", headers, map[string]interface{}{"fields": fields})
+
+	case "update":
+		issueKey, _ := config["issue_key"].(string)
+		if issueKey == "" {
+			return nil, NewExecError(ErrorConfig, "issue_key is required in config")
+		}
+		fields := jiraFields(config)
+		if _, err := callJSONAPI(ctx, "PUT", baseURL+"/issue/"+neturl.PathEscape(issueKey), headers, map[string]interface{}{"fields": fields}); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"key": issueKey, "updated": true}, nil
+
+	case "search":
+		jql, _ := config["jql"].(string)
+		if jql == "" {
+			return nil, NewExecError(ErrorConfig, "jql is required in config")
+		}
+		return e.search(ctx, baseURL, headers, jql, config)
+
+	default:
+		return nil, NewExecError(ErrorConfig, "unknown operation: %q", operation)
+	}
+}
+
+// search pages through the issues matching the JQL query, up to max_results (default 100)
+func (e *JiraExecutor) search(ctx context.Context, baseURL string, headers map[string]string, jql string, config map[string]interface{}) (interface{}, error) {
+	maxResults := maxResultsSetting(config)
+
+	request := map[string]interface{}{"jql": jql}
+	if fields, ok := config["fields_list"].([]interface{}); ok {
+		request["fields"] = fields
+	}
+
+	issues := []interface{}{}
+	total := 0
+	for len(issues) < maxResults {
+		request["startAt"] = len(issues)
+		request["maxResults"] = min(jiraSearchPageSize, maxResults-len(issues))
+
+		result, err := callJSONAPI(ctx, "POST", baseURL+"/search", headers, request)
+		if err != nil {
+			return nil, err
+		}
+		page, _ := result.(map[string]interface{})
+		pageIssues, _ := page["issues"].([]interface{})
+		if value, ok := page["total"].(float64); ok {
+			total = int(value)
+		}
+
+		issues = append(issues, pageIssues...)
+		if len(pageIssues) == 0 || len(issues) >= total {
+			break
+		}
+	}
+
+	return map[string]interface{}{
+		"issues": issues,
+		"count":  len(issues),
+		"total":  total,
+	}, nil
+}
+
+// jiraFields collects the issue fields of a create or update operation
+func jiraFields(config map[string]interface{}) map[string]interface{} {
+	fields := map[string]interface{}{}
+	if extra, ok := config["fields"].(map[string]interface{}); ok {
+		for key, value := range extra {
+			fields[key] = value
+		}
+	}
+	for _, key := range []string{"summary", "description"} {
+		if value, ok := config[key]; ok {
+			fields[key] = value
+		}
+	}
+	if labels, ok := config["labels"].([]interface{}); ok {
+		fields["labels"] = labels
+	}
+	return fields
+}
+
+// maxResultsSetting returns the max_results of a search, 100 by default and at most 1000
+func maxResultsSetting(config map[string]interface{}) int {
+	maxResults := 100
+	if value, ok := config["max_results"].(float64); ok && value >= 1 {
+		maxResults = int(value)
+	}
+	return min(maxResults, 1000)
+}
@@ -0,0 +1,154 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"plugin"
+	"strings"
+	"sync"
+
+	core "github.com/altipard/flowcraft/pkg/engine"
+)
+
+// Invocation describes the execution of a node passed through the executor middleware.
+// Middleware may change Config and Input before calling the next handler.
+type Invocation = core.Invocation
+
+// Handler executes an invocation
+type Handler = core.Handler
+
+// Middleware wraps the execution of nodes, e.g. to record metrics, capture data lineage or
+// enforce policies, without changing the executors
+type Middleware = core.Middleware
+
+// Hooks builds middleware from callbacks. Before may reject the execution of a node by
+// returning an error, After may replace the output and OnError the error of the executor.
+type Hooks = core.Hooks
+
+var middleware struct {
+	sync.RWMutex
+	chain []Middleware
+}
+
+// Use adds middleware around the executors of all nodes of this process. Middleware added
+// first runs outermost.
+func Use(m ...Middleware) {
+	middleware.Lock()
+	defer middleware.Unlock()
+	middleware.chain = append(middleware.chain, m...)
+}
+
+// execute runs the executor for the invocation through the middleware of the process within
+// the timeout of the invocation. Panics of the executor and the middleware are returned as
+// *PanicError.
+func execute(ctx context.Context, executor NodeExecutor, invocation *Invocation) (interface{}, error) {
+	middleware.RLock()
+	chain := append([]Middleware{recovering}, middleware.chain...)
+	middleware.RUnlock()
+
+	return core.ExecuteInvocation(ctx, chain, executor, invocation)
+}
+
+// recovering is the outermost middleware of each invocation, returning panics as *PanicError
+func recovering(next Handler) Handler {
+	return func(ctx context.Context, invocation *Invocation) (result interface{}, err error) {
+		defer recoverPanic(invocation.ExecutorClass, &result, &err)
+		return next(ctx, invocation)
+	}
+}
+
+// MiddlewarePluginsFromEnv returns the paths of the middleware plugins configured in
+// EXECUTOR_MIDDLEWARE_PLUGINS (comma-separated)
+func MiddlewarePluginsFromEnv() []string {
+	var paths []string
+	for _, path := range strings.Split(os.Getenv("EXECUTOR_MIDDLEWARE_PLUGINS"), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// LoadMiddlewarePlugins adds the hooks of Go plugins as middleware. Plugins don't depend on
+// FlowCraft's packages; they export any of the functions
+//
+//	func BeforeExecute(node map[string]interface{}, config, input map[string]interface{}) error
+//	func AfterExecute(node map[string]interface{}, output interface{}) (interface{}, error)
+//	func OnExecuteError(node map[string]interface{}, err error) error
+//
+// where node describes the node execution (workflow_id, execution_id, node_id, node_type,
+// executor_class, attempt).
+func LoadMiddlewarePlugins(paths []string) error {
+	for _, path := range paths {
+		hooks, err := loadMiddlewarePlugin(path)
+		if err != nil {
+			return fmt.Errorf("failed to load middleware plugin %s: %v", path, err)
+		}
+		Use(hooks.Middleware())
+	}
+	return nil
+}
+
+// loadMiddlewarePlugin looks up the hook functions of a middleware plugin
+func loadMiddlewarePlugin(path string) (Hooks, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return Hooks{}, err
+	}
+
+	var hooks Hooks
+	found := false
+	if symbol, err := p.Lookup("BeforeExecute"); err == nil {
+		before, ok := symbol.(func(map[string]interface{}, map[string]interface{}, map[string]interface{}) error)
+		if !ok {
+			return Hooks{}, fmt.Errorf("BeforeExecute has the wrong signature")
+		}
+		hooks.Before = func(ctx context.Context, invocation *Invocation) error {
+			return before(describe(invocation), invocation.Config, invocation.Input)
+		}
+		found = true
+	}
+	if symbol, err := p.Lookup("AfterExecute"); err == nil {
+		after, ok := symbol.(func(map[string]interface{}, interface{}) (interface{}, error))
+		if !ok {
+			return Hooks{}, fmt.Errorf("AfterExecute has the wrong signature")
+		}
+		hooks.After = func(ctx context.Context, invocation *Invocation, output interface{}) (interface{}, error) {
+			// Branch results keep their handle, the plugin sees and replaces the output
+			if branch, ok := output.(*BranchResult); ok {
+				replaced, err := after(describe(invocation), branch.Output)
+				return &BranchResult{Handle: branch.Handle, Output: replaced}, err
+			}
+			return after(describe(invocation), output)
+		}
+		found = true
+	}
+	if symbol, err := p.Lookup("OnExecuteError"); err == nil {
+		onError, ok := symbol.(func(map[string]interface{}, error) error)
+		if !ok {
+			return Hooks{}, fmt.Errorf("OnExecuteError has the wrong signature")
+		}
+		hooks.OnError = func(ctx context.Context, invocation *Invocation, err error) error {
+			return onError(describe(invocation), err)
+		}
+		found = true
+	}
+	if !found {
+		return Hooks{}, fmt.Errorf("plugin exports none of BeforeExecute, AfterExecute and OnExecuteError")
+	}
+	return hooks, nil
+}
+
+// describe returns the invocation as passed to plugins
+func describe(i *Invocation) map[string]interface{} {
+	return map[string]interface{}{
+		"workflow_id":    i.WorkflowID,
+		"execution_id":   i.ExecutionID,
+		"node_id":        i.NodeID,
+		"trigger_id":     i.TriggerID,
+		"node_type":      i.NodeType,
+		"executor_class": i.ExecutorClass,
+		"attempt":        i.Attempt,
+	}
+}
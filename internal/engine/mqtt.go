@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/altipard/flowcraft/internal/mqtt"
+)
+
+// MQTTPublishExecutor publishes a message to a topic of the MQTT broker of an mqtt credential
+type MQTTPublishExecutor struct{}
+
+func (e *MQTTPublishExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return e.ExecuteContext(context.Background(), config, input)
+}
+
+func (e *MQTTPublishExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	config, err := renderConfig(ctx, config, input)
+	if err != nil {
+		return nil, NewExecError(ErrorData, "failed to render config: %v", err)
+	}
+
+	credential, err := nodeCredential(ctx, config, "mqtt")
+	if err != nil {
+		return nil, err
+	}
+	topic, _ := config["topic"].(string)
+	if topic == "" {
+		return nil, NewExecError(ErrorConfig, "topic is required in config")
+	}
+	if err := mqtt.ValidateTopic(topic); err != nil {
+		return nil, &ExecError{Category: ErrorConfig, Err: err}
+	}
+	if err := mqtt.ValidateURL(credential["url"]); err != nil {
+		return nil, &ExecError{Category: ErrorConfig, Err: err}
+	}
+	qos := 1
+	if value, ok := config["qos"].(float64); ok {
+		qos = int(value)
+	}
+	if qos < 0 || qos > 2 {
+		return nil, NewExecError(ErrorConfig, "qos must be 0, 1 or 2")
+	}
+	retain, _ := config["retain"].(bool)
+
+	// Text payloads are published as they are, other values as JSON, by default the input
+	var payload []byte
+	switch value := config["payload"].(type) {
+	case string:
+		payload = []byte(value)
+	case nil:
+		payload, _ = json.Marshal(input)
+	default:
+		payload, _ = json.Marshal(value)
+	}
+
+	// Each attempt connects with its own clean session, so parallel nodes don't take over
+	// each other's connection
+	clientID := "flowcraft-publish"
+	if info, ok := ExecutionInfoFromContext(ctx); ok && info.IdempotencyKey != "" {
+		clientID = info.IdempotencyKey
+	}
+	client, err := mqtt.Dial(ctx, mqtt.Options{
+		URL:          credential["url"],
+		Username:     credential["username"],
+		Password:     credential["password"],
+		ClientID:     clientID,
+		CleanSession: true,
+	})
+	if err != nil {
+		return nil, mqttError(err)
+	}
+	defer client.Close()
+
+	message := mqtt.Message{Topic: topic, Payload: payload, QoS: byte(qos), Retain: retain}
+	if err := client.Publish(ctx, message); err != nil {
+		return nil, mqttError(err)
+	}
+	return map[string]interface{}{
+		"topic":    topic,
+		"qos":      qos,
+		"retained": retain,
+		"bytes":    len(payload),
+	}, nil
+}
+
+// mqttError categorizes the errors of MQTT brokers: refused logins are auth errors, others,
+// e.g. unreachable brokers and dropped connections, transient
+func mqttError(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	if mqtt.IsAuthError(err) {
+		return &ExecError{Category: ErrorAuth, Err: err}
+	}
+	return &ExecError{Category: ErrorTransient, Err: err}
+}
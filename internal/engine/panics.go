@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+
+	core "github.com/altipard/flowcraft/pkg/engine"
+)
+
+// maxStackTraceBytes bounds the stack traces of panics stored with node executions
+const maxStackTraceBytes = 16 << 10
+
+// PanicError is the error of a node whose executor panicked. The worker recovers and fails the
+// node instead of crashing.
+type PanicError struct {
+	ExecutorClass string
+	Value         interface{}
+	// Stack is the stack trace of the goroutine when it panicked, truncated to maxStackTraceBytes
+	Stack string
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("executor %s panicked: %v", e.ExecutorClass, e.Value)
+}
+
+// ErrorCode implements ErrorCoder
+func (e *PanicError) ErrorCode() string {
+	return "PANIC"
+}
+
+var panics struct {
+	sync.Mutex
+	byClass map[string]int64
+}
+
+// PanicCounts returns the number of panics of executors in this process by executor class
+func PanicCounts() map[string]int64 {
+	panics.Lock()
+	defer panics.Unlock()
+	counts := make(map[string]int64, len(panics.byClass))
+	for class, count := range panics.byClass {
+		counts[class] = count
+	}
+	return counts
+}
+
+// recoverPanic turns a panic of an executor into a *PanicError returned as err. It must be
+// deferred directly by the function invoking the executor.
+func recoverPanic(executorClass string, result *interface{}, err *error) {
+	value := recover()
+	if value == nil {
+		return
+	}
+
+	stack := debug.Stack()
+	if len(stack) > maxStackTraceBytes {
+		stack = append(stack[:maxStackTraceBytes:maxStackTraceBytes], "\n... truncated"...)
+	}
+	panics.Lock()
+	if panics.byClass == nil {
+		panics.byClass = map[string]int64{}
+	}
+	panics.byClass[executorClass]++
+	panics.Unlock()
+
+	log.Printf("Executor %s panicked: %v\n%s", executorClass, value, stack)
+	*result = nil
+	*err = &PanicError{ExecutorClass: executorClass, Value: value, Stack: string(stack)}
+}
+
+// invokeRecovering runs the executor like core.Invoke, returning its panics as *PanicError
+func invokeRecovering(ctx context.Context, executorClass string, executor NodeExecutor, config map[string]interface{}, input map[string]interface{}) (result interface{}, err error) {
+	defer recoverPanic(executorClass, &result, &err)
+	return core.Invoke(ctx, executor, config, input)
+}
+
+// stackTrace returns the stack trace of a panic causing the error, or an empty string
+func stackTrace(err error) string {
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		return panicErr.Stack
+	}
+	return ""
+}
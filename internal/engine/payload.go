@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/altipard/flowcraft/internal/blob"
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// PayloadConfig limits the input and output data stored with node executions
+type PayloadConfig struct {
+	// MaxSize is the largest payload stored in full, larger ones are truncated and offloaded to
+	// the blob store; 0 disables the limit
+	MaxSize int
+	// PreviewSize is the length of the beginning of truncated payloads kept as preview
+	PreviewSize int
+}
+
+var payloadConfig = PayloadConfig{MaxSize: 1 << 20, PreviewSize: 4 << 10}
+
+// PayloadConfigFromEnv reads the payload limits from NODE_DATA_MAX_SIZE (default 1 MB) and
+// NODE_DATA_PREVIEW_SIZE (default 4 KB)
+func PayloadConfigFromEnv() PayloadConfig {
+	cfg := PayloadConfig{MaxSize: 1 << 20, PreviewSize: 4 << 10}
+	if size, err := strconv.Atoi(os.Getenv("NODE_DATA_MAX_SIZE")); err == nil && size >= 0 {
+		cfg.MaxSize = size
+	}
+	if size, err := strconv.Atoi(os.Getenv("NODE_DATA_PREVIEW_SIZE")); err == nil && size >= 0 {
+		cfg.PreviewSize = size
+	}
+	return cfg
+}
+
+// ConfigurePayloads sets the payload limits
+func ConfigurePayloads(cfg PayloadConfig) {
+	payloadConfig = cfg
+}
+
+// TruncatedPayload is stored in place of a node payload exceeding the maximum size. The full
+// payload can be downloaded from the blob store, unless it could not be offloaded.
+type TruncatedPayload struct {
+	Truncated bool   `json:"_truncated"`
+	Size      int    `json:"size"`
+	Preview   string `json:"preview"`
+	// Reference of the full payload in the blob store, like the blob references of node outputs
+	BlobID      string `json:"blob_id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// storedPayload returns the payload to store in a jsonb column: the payload itself, or a
+// TruncatedPayload if it exceeds the maximum size
+func storedPayload(data []byte, name string) string {
+	cfg := payloadConfig
+	if cfg.MaxSize == 0 || len(data) <= cfg.MaxSize {
+		return string(data)
+	}
+
+	preview := data
+	if len(preview) > cfg.PreviewSize {
+		preview = preview[:cfg.PreviewSize]
+		// Don't cut a character in half
+		for len(preview) > 0 && !utf8.Valid(preview) {
+			preview = preview[:len(preview)-1]
+		}
+	}
+	truncated := TruncatedPayload{Truncated: true, Size: len(data), Preview: string(preview)}
+
+	ref, err := blob.Save(context.Background(), name, "application/json", bytes.NewReader(data))
+	if err != nil {
+		log.Printf("Failed to offload payload %s of %d bytes, storing it truncated: %v", name, len(data), err)
+	} else {
+		truncated.BlobID, truncated.Name, truncated.ContentType = ref.ID, ref.Name, ref.ContentType
+	}
+
+	marker, _ := json.Marshal(truncated)
+	return string(marker)
+}
+
+// truncatedPayload reads the marker of a truncated payload, ok is false for other payloads
+func truncatedPayload(stored string) (payload TruncatedPayload, ok bool) {
+	// Markers start with the flag, so other payloads are not parsed to check
+	if !strings.HasPrefix(stored, `{"_truncated":true`) {
+		return payload, false
+	}
+	if json.Unmarshal([]byte(stored), &payload) != nil || !payload.Truncated {
+		return payload, false
+	}
+	return payload, true
+}
+
+// loadPayload returns a stored payload in full, loading truncated ones from the blob store
+func loadPayload(stored string) ([]byte, error) {
+	truncated, ok := truncatedPayload(stored)
+	if !ok {
+		return []byte(stored), nil
+	}
+	if truncated.BlobID == "" {
+		return nil, fmt.Errorf("payload of %d bytes was truncated and is not available in full", truncated.Size)
+	}
+
+	r, err := blob.Open(context.Background(), truncated.BlobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load offloaded payload: %v", err)
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// payloadValue parses a stored payload, loading it in full if it was truncated. Payloads that
+// are not available in full are returned as their TruncatedPayload marker.
+func payloadValue(stored string) interface{} {
+	data, err := loadPayload(stored)
+	if err != nil {
+		data = []byte(stored)
+	}
+	var value interface{}
+	json.Unmarshal(data, &value)
+	return value
+}
+
+// nodePayloadName names the blob of an offloaded payload of a node execution
+func nodePayloadName(nodeExecution *models.NodeExecution, kind string) string {
+	return fmt.Sprintf("execution-%d-node-%d-%s.json", nodeExecution.WorkflowExecutionID, nodeExecution.NodeID, kind)
+}
+
+// deleteOffloadedPayloads removes the offloaded payloads of the stored payloads from the blob store
+func deleteOffloadedPayloads(stored ...string) {
+	for _, s := range stored {
+		if truncated, ok := truncatedPayload(s); ok && truncated.BlobID != "" {
+			blob.Delete(context.Background(), truncated.BlobID)
+		}
+	}
+}
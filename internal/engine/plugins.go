@@ -0,0 +1,357 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"plugin"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/queue"
+	core "github.com/altipard/flowcraft/pkg/engine"
+)
+
+// Health of executor plugins loaded from the plugins directory
+const (
+	PluginLoaded      = "loaded"
+	PluginFailed      = "failed"
+	PluginQuarantined = "quarantined"
+)
+
+// PluginConfig configures the executor plugins a worker loads from a directory and reloads when
+// they change, without restarting the worker
+type PluginConfig struct {
+	// Dir is watched for executor plugins (*.so), disabled if empty
+	Dir string
+	// Interval is how often the directory is checked for new, updated and removed plugins
+	Interval time.Duration
+	// MaxCrashes is the number of panics after which a plugin is quarantined until it is updated
+	MaxCrashes int
+}
+
+// PluginConfigFromEnv reads the plugin settings from PLUGIN_DIR, PLUGIN_RELOAD_INTERVAL
+// (default 10s) and PLUGIN_MAX_CRASHES (default 3)
+func PluginConfigFromEnv() PluginConfig {
+	cfg := PluginConfig{
+		Dir:        os.Getenv("PLUGIN_DIR"),
+		Interval:   10 * time.Second,
+		MaxCrashes: 3,
+	}
+	if d, err := time.ParseDuration(os.Getenv("PLUGIN_RELOAD_INTERVAL")); err == nil && d > 0 {
+		cfg.Interval = d
+	}
+	if n, err := strconv.Atoi(os.Getenv("PLUGIN_MAX_CRASHES")); err == nil && n > 0 {
+		cfg.MaxCrashes = n
+	}
+	return cfg
+}
+
+// managedPlugin is an executor plugin of the plugins directory
+type managedPlugin struct {
+	status     queue.PluginStatus
+	newFunc    func() NodeExecutor
+	modTime    time.Time
+	size       int64
+	failedHash string
+}
+
+var plugins struct {
+	sync.RWMutex
+	cfg    PluginConfig
+	byName map[string]*managedPlugin
+}
+
+// ConfigurePlugins loads the executor plugins of the directory. Plugins that fail to load are
+// reported as failed and do not stop the worker.
+func ConfigurePlugins(cfg PluginConfig) {
+	plugins.Lock()
+	plugins.cfg = cfg
+	plugins.byName = map[string]*managedPlugin{}
+	plugins.Unlock()
+
+	if cfg.Dir != "" {
+		scanPlugins()
+	}
+}
+
+// WatchPlugins loads new and updated plugins of the directory and unloads removed ones at the
+// configured interval until the context is done
+func WatchPlugins(ctx context.Context) {
+	plugins.RLock()
+	cfg := plugins.cfg
+	plugins.RUnlock()
+	if cfg.Dir == "" {
+		return
+	}
+
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			scanPlugins()
+		}
+	}
+}
+
+// PluginStatuses returns the health of the plugins of the directory, for the worker status
+func PluginStatuses() []queue.PluginStatus {
+	plugins.RLock()
+	defer plugins.RUnlock()
+	statuses := make([]queue.PluginStatus, 0, len(plugins.byName))
+	for _, p := range plugins.byName {
+		statuses = append(statuses, p.status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
+
+// scanPlugins compares the plugins of the directory with the loaded ones by modification time
+// and size, and loads the changed ones
+func scanPlugins() {
+	plugins.RLock()
+	cfg := plugins.cfg
+	plugins.RUnlock()
+
+	paths, err := filepath.Glob(filepath.Join(cfg.Dir, "*.so"))
+	if err != nil {
+		log.Printf("Failed to list plugins in %s: %v", cfg.Dir, err)
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".so")
+		seen[name] = true
+
+		plugins.RLock()
+		current := plugins.byName[name]
+		plugins.RUnlock()
+		if current != nil && current.modTime.Equal(info.ModTime()) && current.size == info.Size() {
+			continue
+		}
+		reloadPlugin(cfg, name, path, info, current)
+	}
+
+	plugins.Lock()
+	for name := range plugins.byName {
+		if !seen[name] {
+			// Go cannot unload plugins, removed ones are no longer handed out
+			log.Printf("Plugin %s was removed", name)
+			delete(plugins.byName, name)
+		}
+	}
+	plugins.Unlock()
+}
+
+// reloadPlugin opens a new or updated plugin. A plugin that fails to load keeps the version
+// loaded before, if any, and is reported as failed.
+func reloadPlugin(cfg PluginConfig, name, path string, info os.FileInfo, current *managedPlugin) {
+	hash, err := fileHash(path)
+	if err != nil {
+		log.Printf("Failed to read plugin %s: %v", path, err)
+		return
+	}
+
+	loaded := &managedPlugin{modTime: info.ModTime(), size: info.Size()}
+	if current != nil {
+		// Touching a plugin without changing it keeps it as it is, also quarantined
+		if hash == current.status.Hash || hash == current.failedHash {
+			plugins.Lock()
+			current.modTime, current.size = info.ModTime(), info.Size()
+			plugins.Unlock()
+			return
+		}
+		plugins.RLock()
+		*loaded = *current
+		plugins.RUnlock()
+		loaded.modTime, loaded.size = info.ModTime(), info.Size()
+	}
+
+	newFunc, version, err := openExecutorPlugin(cfg.Dir, name, path, hash)
+	if err != nil {
+		log.Printf("Failed to load plugin %s: %v", path, err)
+		loaded.failedHash = hash
+		loaded.status.Name, loaded.status.Path = name, path
+		loaded.status.Error = err.Error()
+		if loaded.newFunc == nil {
+			loaded.status.Status = PluginFailed
+		}
+	} else {
+		if current != nil {
+			log.Printf("Reloaded plugin %s (%s)", name, hash)
+		} else {
+			log.Printf("Loaded plugin %s (%s)", name, hash)
+		}
+		loaded.newFunc = newFunc
+		loaded.failedHash = ""
+		loaded.status = queue.PluginStatus{
+			Name:     name,
+			Path:     path,
+			Version:  version,
+			Hash:     hash,
+			Status:   PluginLoaded,
+			LoadedAt: time.Now(),
+		}
+	}
+
+	plugins.Lock()
+	plugins.byName[name] = loaded
+	plugins.Unlock()
+}
+
+// openExecutorPlugin opens a copy of the plugin named after its content. Go keeps plugins open
+// by path, so an updated plugin is only loaded from a new path.
+func openExecutorPlugin(dir, name, path, hash string) (func() NodeExecutor, string, error) {
+	loadDir := filepath.Join(dir, ".loaded")
+	if err := os.MkdirAll(loadDir, 0o755); err != nil {
+		return nil, "", err
+	}
+	copyPath := filepath.Join(loadDir, name+"-"+hash+".so")
+	if _, err := os.Stat(copyPath); err != nil {
+		if err := copyFile(path, copyPath); err != nil {
+			return nil, "", err
+		}
+	}
+
+	p, err := plugin.Open(copyPath)
+	if err != nil {
+		return nil, "", err
+	}
+	symbol, err := p.Lookup("NewExecutor")
+	if err != nil {
+		return nil, "", err
+	}
+	newFunc, ok := symbol.(func() NodeExecutor)
+	if !ok {
+		return nil, "", fmt.Errorf("plugin does not provide a valid NewExecutor function")
+	}
+
+	// Plugins may export their version as a string variable or function
+	var version string
+	if symbol, err := p.Lookup("Version"); err == nil {
+		switch v := symbol.(type) {
+		case *string:
+			version = *v
+		case func() string:
+			version = v()
+		}
+	}
+	return newFunc, version, nil
+}
+
+// pluginExecutor returns an executor of a plugin of the directory, by its name or path. ok is
+// false if the directory has no such plugin.
+func pluginExecutor(ref string) (executor NodeExecutor, ok bool, err error) {
+	plugins.RLock()
+	defer plugins.RUnlock()
+	p := plugins.byName[ref]
+	if p == nil && plugins.cfg.Dir != "" && filepath.Dir(ref) == filepath.Clean(plugins.cfg.Dir) {
+		p = plugins.byName[strings.TrimSuffix(filepath.Base(ref), ".so")]
+	}
+	if p == nil {
+		return nil, false, nil
+	}
+
+	switch {
+	case p.status.Status == PluginQuarantined:
+		return nil, true, fmt.Errorf("plugin %s is quarantined after %d crashes, update it to load it again", p.status.Name, p.status.Crashes)
+	case p.newFunc == nil:
+		return nil, true, fmt.Errorf("plugin %s failed to load: %s", p.status.Name, p.status.Error)
+	}
+	return &quarantiningExecutor{executor: p.newFunc(), plugin: p, version: p.status.Version}, true, nil
+}
+
+// pluginCrashed counts a panic of a plugin and quarantines it after too many
+func pluginCrashed(p *managedPlugin, cause interface{}) {
+	plugins.Lock()
+	defer plugins.Unlock()
+	p.status.Crashes++
+	p.status.Error = fmt.Sprint(cause)
+	if p.status.Crashes >= plugins.cfg.MaxCrashes && p.status.Status != PluginQuarantined {
+		log.Printf("Quarantining plugin %s after %d crashes", p.status.Name, p.status.Crashes)
+		p.status.Status = PluginQuarantined
+	}
+}
+
+// quarantiningExecutor counts the panics of a plugin executor towards the quarantine of the plugin
+type quarantiningExecutor struct {
+	executor NodeExecutor
+	plugin   *managedPlugin
+	version  string
+}
+
+func (e *quarantiningExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return e.ExecuteContext(context.Background(), config, input)
+}
+
+// ExecuteContext runs the plugin executor and counts its panics, which fail the node like panics
+// of other executors
+func (e *quarantiningExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	defer func() {
+		if cause := recover(); cause != nil {
+			pluginCrashed(e.plugin, cause)
+			panic(cause)
+		}
+	}()
+	return core.Invoke(ctx, e.executor, config, input)
+}
+
+// Version reports the version the plugin exports, if any
+func (e *quarantiningExecutor) Version() string {
+	if reporter, ok := e.executor.(VersionReporter); ok {
+		return reporter.Version()
+	}
+	return e.version
+}
+
+func fileHash(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16], nil
+}
+
+func copyFile(from, to string) error {
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	// Write to a temporary file first, so a failed copy is not opened later
+	tmp, err := os.CreateTemp(filepath.Dir(to), ".copy-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, src); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), to)
+}
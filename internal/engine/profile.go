@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"log"
+	"runtime"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// nodeProfiler records the time and allocation breakdown of a node execution of a profiled
+// execution. All methods are no-ops on a nil profiler, which is used for executions that are
+// not profiled.
+type nodeProfiler struct {
+	profile  models.NodeProfile
+	start    time.Time
+	mark     time.Time
+	memStart runtime.MemStats
+	ran      bool
+	saved    bool
+}
+
+// newNodeProfiler returns a profiler for the node if its execution is profiled, nil otherwise
+func newNodeProfiler(execContext *ExecutionContext, executionID uint, node models.Node) *nodeProfiler {
+	if !execContext.Profiling {
+		return nil
+	}
+	now := time.Now()
+	return &nodeProfiler{
+		profile: models.NodeProfile{
+			WorkflowExecutionID: executionID,
+			NodeID:              node.ID,
+			NodeType:            node.NodeType,
+		},
+		start: now,
+		mark:  now,
+	}
+}
+
+// lap returns the microseconds since the previous lap
+func (p *nodeProfiler) lap() int64 {
+	now := time.Now()
+	elapsed := now.Sub(p.mark).Microseconds()
+	p.mark = now
+	return elapsed
+}
+
+// loaded ends the phase loading the node, its type and checkpoints
+func (p *nodeProfiler) loaded() {
+	if p != nil {
+		p.profile.LoadUs = p.lap()
+	}
+}
+
+// executing ends the phase collecting and storing the input and loading the executor, and
+// starts measuring the allocations of the executor
+func (p *nodeProfiler) executing() {
+	if p != nil {
+		p.profile.PrepareUs = p.lap()
+		runtime.ReadMemStats(&p.memStart)
+		p.mark = time.Now()
+	}
+}
+
+// executed ends the phase running the executor
+func (p *nodeProfiler) executed() {
+	if p == nil {
+		return
+	}
+	p.profile.ExecuteUs = p.lap()
+	p.ran = true
+
+	var memEnd runtime.MemStats
+	runtime.ReadMemStats(&memEnd)
+	p.profile.AllocBytes = memEnd.TotalAlloc - p.memStart.TotalAlloc
+	p.profile.Allocs = memEnd.Mallocs - p.memStart.Mallocs
+	p.profile.GCCycles = memEnd.NumGC - p.memStart.NumGC
+	p.mark = time.Now()
+}
+
+// save stores the profile of the node execution. Only the first call has an effect, so that it
+// can be deferred for the early returns of failed nodes.
+func (p *nodeProfiler) save(nodeExecution *models.NodeExecution) {
+	if p == nil || p.saved || nodeExecution.ID == 0 {
+		return
+	}
+	p.saved = true
+
+	// Nodes failing before their executor ran spent the remaining time preparing it
+	if p.ran {
+		p.profile.PersistUs = p.lap()
+	} else {
+		p.profile.PrepareUs += p.lap()
+	}
+	p.profile.TotalUs = time.Since(p.start).Microseconds()
+	p.profile.NodeExecutionID = nodeExecution.ID
+	if err := store.SaveNodeProfile(&p.profile); err != nil {
+		log.Printf("Failed to save profile of node execution %d: %v", nodeExecution.ID, err)
+	}
+}
@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"context"
+	"errors"
+
+	"github.com/altipard/flowcraft/internal/slack"
+)
+
+// SlackRespondExecutor responds to the Slack request that started the execution: within the
+// request if it still waits for its response, otherwise at its response URL
+type SlackRespondExecutor struct{}
+
+func (e *SlackRespondExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return e.ExecuteContext(context.Background(), config, input)
+}
+
+func (e *SlackRespondExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	config, err := renderConfig(ctx, config, input)
+	if err != nil {
+		return nil, NewExecError(ErrorData, "failed to render config: %v", err)
+	}
+
+	message := slack.Message{ResponseType: slack.ResponseEphemeral}
+	message.Text, _ = config["text"].(string)
+	message.Blocks, _ = config["blocks"].([]interface{})
+	message.ReplaceOriginal, _ = config["replace_original"].(bool)
+	if responseType, ok := config["response_type"].(string); ok && responseType != "" {
+		if responseType != slack.ResponseEphemeral && responseType != slack.ResponseInChannel {
+			return nil, NewExecError(ErrorConfig, "response_type must be ephemeral or in_channel")
+		}
+		message.ResponseType = responseType
+	}
+	if message.Text == "" && len(message.Blocks) == 0 {
+		return nil, NewExecError(ErrorConfig, "text or blocks is required in config")
+	}
+	// Executions not started by a Slack request, e.g. replays, respond at a configured URL
+	fallbackURL, _ := config["response_url"].(string)
+
+	info, _ := ExecutionInfoFromContext(ctx)
+	inRequest, err := slack.Respond(ctx, info.ExecutionID, message, fallbackURL)
+	if errors.Is(err, slack.ErrNoRequest) || errors.Is(err, slack.ErrNotConfigured) {
+		return nil, &ExecError{Category: ErrorConfig, Err: err}
+	}
+	if err != nil {
+		return nil, &ExecError{Category: ErrorTransient, Err: err}
+	}
+
+	delivery := "response_url"
+	if inRequest {
+		delivery = "request"
+	}
+	return map[string]interface{}{
+		"delivered": delivery,
+		"message":   message,
+	}, nil
+}
@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/expression"
+	"github.com/altipard/flowcraft/internal/state"
+)
+
+// StateExecutor reads and writes the key-value state store. Operations: get, set, incr, delete
+// and check, which continues with the "found" or "missing" handle (e.g. for deduplication).
+type StateExecutor struct{}
+
+func (e *StateExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return e.ExecuteContext(context.Background(), config, input)
+}
+
+func (e *StateExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	info, _ := ExecutionInfoFromContext(ctx)
+	opts := templateOptions(ctx, expression.Options{})
+
+	scopeKind, _ := config["scope"].(string)
+	if scopeKind == "" {
+		scopeKind = state.ScopeWorkflow
+	}
+	var scopeID uint
+	switch scopeKind {
+	case state.ScopeWorkflow:
+		scopeID = info.WorkflowID
+	case state.ScopeTrigger:
+		scopeID = info.TriggerID
+	}
+	scope, err := state.ParseScope(scopeKind, scopeID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, _ := config["key"].(string)
+	key, err = expression.Render(key, input, nil, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render key: %v", err)
+	}
+
+	var ttl time.Duration
+	if value, ok := config["ttl"].(string); ok && value != "" {
+		if ttl, err = time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("invalid ttl: %v", err)
+		}
+	}
+
+	operation, _ := config["operation"].(string)
+	switch operation {
+	case "get", "":
+		value, err := state.Get(scope, key)
+		if err != nil && !errors.Is(err, state.ErrNotFound) {
+			return nil, err
+		}
+		return map[string]interface{}{"key": key, "value": value, "found": err == nil}, nil
+
+	case "check":
+		value, err := state.Get(scope, key)
+		if errors.Is(err, state.ErrNotFound) {
+			return &BranchResult{Handle: "missing", Output: map[string]interface{}{"key": key, "found": false}}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &BranchResult{Handle: "found", Output: map[string]interface{}{"key": key, "value": value, "found": true}}, nil
+
+	case "set":
+		// String values may reference input data, other values are stored as configured
+		value, ok := config["value"]
+		if !ok {
+			value = input
+		}
+		if str, ok := value.(string); ok {
+			if value, err = expression.Render(str, input, nil, opts); err != nil {
+				return nil, fmt.Errorf("failed to render value: %v", err)
+			}
+		}
+		if err := state.Set(scope, key, value, ttl); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"key": key, "value": value}, nil
+
+	case "incr":
+		delta := 1.0
+		if value, ok := config["delta"].(float64); ok {
+			delta = value
+		}
+		value, err := state.Incr(scope, key, delta, ttl)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"key": key, "value": value}, nil
+
+	case "delete":
+		if err := state.Delete(scope, key); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"key": key, "deleted": true}, nil
+
+	default:
+		return nil, NewExecError(ErrorConfig, "unknown operation: %s", operation)
+	}
+}
@@ -0,0 +1,276 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/artifacts"
+	"github.com/altipard/flowcraft/internal/chain"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/dispatch"
+	"github.com/altipard/flowcraft/internal/graphcache"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/sink"
+	core "github.com/altipard/flowcraft/pkg/engine"
+	"gorm.io/gorm"
+)
+
+// Store loads and saves the executions the engine runs. Workers with database access use
+// DatabaseStore, workers without one the internal worker API of the server (see workerapi).
+type Store interface {
+	// Execution returns the execution with its workflow graph
+	Execution(id uint) (*models.WorkflowExecution, error)
+	// NodeType returns the node type with the given key
+	NodeType(key string) (models.NodeType, error)
+	// SaveExecution stores the status and output of a running or waiting execution
+	SaveExecution(execution *models.WorkflowExecution) error
+	// CompleteExecution stores the final status of a completed, failed or cancelled execution
+	CompleteExecution(execution *models.WorkflowExecution) error
+	// CancelRequested reports whether the cancellation of the execution was requested
+	CancelRequested(executionID uint) (bool, error)
+	// NodeExecutions returns the node executions of an execution matching the filter, oldest first
+	NodeExecutions(executionID uint, filter NodeExecutionFilter) ([]models.NodeExecution, error)
+	// SaveNodeExecution creates a node execution without ID, otherwise updates it
+	SaveNodeExecution(nodeExecution *models.NodeExecution) error
+	// ClaimNode saves the node execution starting or skipping a node like SaveNodeExecution,
+	// unless the latest execution of the node (leaving out compensations) is no longer the one
+	// with previousID, 0 for none, because another run claimed the node in the meantime. It
+	// reports whether the node was claimed.
+	ClaimNode(nodeExecution *models.NodeExecution, previousID uint) (bool, error)
+	// SaveNodeProfile stores the profile of a node execution of a profiled execution
+	SaveNodeProfile(profile *models.NodeProfile) error
+	// SaveArtifact records an artifact of a node execution whose contents are in the blob store
+	SaveArtifact(artifact *models.ExecutionArtifact) error
+}
+
+// NodeExecutionFilter selects node executions of an execution
+type NodeExecutionFilter struct {
+	// NodeID selects the executions of a node, 0 those of all nodes
+	NodeID uint
+	// Statuses selects node executions in one of the statuses, empty in any
+	Statuses []string
+	// ExcludeCompensations leaves out the executions of compensation nodes
+	ExcludeCompensations bool
+}
+
+// store is the store of the engine, the database unless configured otherwise
+var store Store = DatabaseStore{}
+
+// ConfigureStore sets the store the engine loads and saves executions with
+func ConfigureStore(s Store) {
+	store = s
+}
+
+// ErrNoDatabase is returned by features that need database access on workers using the
+// internal worker API
+var ErrNoDatabase = errors.New("not available on workers without database access")
+
+// databaseExecutorClasses are the executor classes that read or create records other than node
+// executions, e.g. approvals, tasks, events and state
+var databaseExecutorClasses = map[string]bool{
+	"approval":                  true,
+	"humanTask":                 true,
+	"emitEvent":                 true,
+	"waitForEvent":              true,
+	"state":                     true,
+	HttpDefinitionExecutorClass: true,
+}
+
+// usesDatabase reports whether the engine has database access
+func usesDatabase() bool {
+	_, ok := store.(DatabaseStore)
+	return ok
+}
+
+// DatabaseStore is the Store of workers with database access
+type DatabaseStore struct{}
+
+func (DatabaseStore) Execution(id uint) (*models.WorkflowExecution, error) {
+	var execution models.WorkflowExecution
+	if err := database.DB.First(&execution, id).Error; err != nil {
+		return nil, err
+	}
+	workflow, err := graphcache.Workflow(execution.WorkflowID)
+	if err != nil {
+		return nil, err
+	}
+	execution.Workflow = workflow
+	return &execution, nil
+}
+
+func (DatabaseStore) NodeType(key string) (models.NodeType, error) {
+	return graphcache.NodeType(key)
+}
+
+func (DatabaseStore) SaveExecution(execution *models.WorkflowExecution) error {
+	return database.DB.Omit("CancelRequestedAt").Save(execution).Error
+}
+
+func (DatabaseStore) CompleteExecution(execution *models.WorkflowExecution) error {
+	return CompleteExecution(execution)
+}
+
+func (DatabaseStore) CancelRequested(executionID uint) (bool, error) {
+	var count int64
+	err := database.DB.Model(&models.WorkflowExecution{}).
+		Where("id = ? AND cancel_requested_at IS NOT NULL", executionID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (DatabaseStore) NodeExecutions(executionID uint, filter NodeExecutionFilter) ([]models.NodeExecution, error) {
+	query := database.DB.Where("workflow_execution_id = ?", executionID)
+	if filter.NodeID != 0 {
+		query = query.Where("node_id = ?", filter.NodeID)
+	}
+	if len(filter.Statuses) > 0 {
+		query = query.Where("status IN ?", filter.Statuses)
+	}
+	if filter.ExcludeCompensations {
+		query = query.Where("compensated_node_id IS NULL")
+	}
+
+	var nodeExecutions []models.NodeExecution
+	err := query.Order("id").Find(&nodeExecutions).Error
+	return nodeExecutions, err
+}
+
+func (DatabaseStore) SaveNodeExecution(nodeExecution *models.NodeExecution) error {
+	if nodeExecution.ID == 0 {
+		return database.DB.Create(nodeExecution).Error
+	}
+	return database.DB.Save(nodeExecution).Error
+}
+
+func (DatabaseStore) ClaimNode(nodeExecution *models.NodeExecution, previousID uint) (bool, error) {
+	claimed := false
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Claims of the same node by different workers are made one after the other
+		lock := fmt.Sprintf("node:%d:%d", nodeExecution.WorkflowExecutionID, nodeExecution.NodeID)
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", lock).Error; err != nil {
+			return err
+		}
+
+		var latestID uint
+		err := tx.Model(&models.NodeExecution{}).
+			Where("workflow_execution_id = ? AND node_id = ? AND compensated_node_id IS NULL", nodeExecution.WorkflowExecutionID, nodeExecution.NodeID).
+			Select("COALESCE(MAX(id), 0)").Scan(&latestID).Error
+		if err != nil || latestID != previousID {
+			return err
+		}
+
+		claimed = true
+		if nodeExecution.ID == 0 {
+			return tx.Create(nodeExecution).Error
+		}
+		return tx.Save(nodeExecution).Error
+	})
+	return claimed, err
+}
+
+func (DatabaseStore) SaveNodeProfile(profile *models.NodeProfile) error {
+	return database.DB.Create(profile).Error
+}
+
+func (DatabaseStore) SaveArtifact(artifact *models.ExecutionArtifact) error {
+	return artifacts.Save(artifact)
+}
+
+// CompleteExecution stores the final status of an execution with the cost of its nodes, pushes
+// the output of completed executions to the workflow's sinks, starts the chained workflows and
+// applies the capture mode of the workflow
+func CompleteExecution(execution *models.WorkflowExecution) error {
+	database.DB.Model(&models.NodeExecution{}).Where("workflow_execution_id = ?", execution.ID).
+		Select("COALESCE(SUM(cost), 0)").Scan(&execution.Cost)
+	if err := database.DB.Omit("CancelRequestedAt").Save(execution).Error; err != nil {
+		return err
+	}
+
+	// Push the output to the workflow's sinks
+	if execution.Status == "completed" {
+		sink.DeliverExecution(execution)
+	}
+
+	// Start the workflows chained to the execution before its payloads may be dropped
+	chain.Continue(execution)
+	retryFailed(execution)
+
+	applyCaptureMode(execution)
+	return nil
+}
+
+// retryFailed retries a failed execution as configured by the retry policy of its workflow if the
+// node failing it gave up on a rate limited or transient error
+func retryFailed(execution *models.WorkflowExecution) {
+	if execution.Status != "failed" {
+		return
+	}
+	workflow, err := graphcache.Workflow(execution.WorkflowID)
+	if err != nil || workflow.AutoRetryMax == 0 {
+		return
+	}
+
+	var categories []string
+	database.DB.Model(&models.NodeExecution{}).
+		Where("workflow_execution_id = ? AND status = ? AND compensated_node_id IS NULL", execution.ID, "failed").
+		Order("id DESC").Limit(1).Pluck("error_category", &categories)
+	if len(categories) == 0 || !ErrorCategory(categories[0]).Retryable() {
+		return
+	}
+
+	retry, err := dispatch.Retry(execution, workflow)
+	if err != nil {
+		log.Printf("Failed to retry execution %d: %v", execution.ID, err)
+	} else if retry != nil {
+		log.Printf("Retrying execution %d as execution %d at %s (%d/%d)",
+			execution.ID, retry.ID, retry.QueuedUntil.Format(time.RFC3339), retry.RetryAttempt, workflow.AutoRetryMax)
+	}
+}
+
+// workflowGraph indexes the nodes and connections of the workflow of an execution
+type workflowGraph struct {
+	workflowID     uint
+	nodes          map[uint]models.Node
+	connections    []core.Connection
+	disabledGroups map[uint]bool
+}
+
+// newWorkflowGraph indexes the graph of the workflow
+func newWorkflowGraph(workflow models.Workflow) *workflowGraph {
+	graph := &workflowGraph{
+		workflowID:     workflow.ID,
+		nodes:          make(map[uint]models.Node, len(workflow.Nodes)),
+		disabledGroups: make(map[uint]bool),
+	}
+	for _, node := range workflow.Nodes {
+		graph.nodes[node.ID] = node
+	}
+	connections := append([]models.Connection(nil), workflow.Connections...)
+	sort.SliceStable(connections, func(i, j int) bool { return connections[i].ID < connections[j].ID })
+	for _, conn := range connections {
+		graph.connections = append(graph.connections, core.Connection{
+			SourceNodeID: conn.SourceNodeID,
+			TargetNodeID: conn.TargetNodeID,
+			SourceHandle: conn.SourceHandle,
+			TargetHandle: conn.TargetHandle,
+		})
+	}
+	for _, group := range workflow.Groups {
+		if group.Disabled {
+			graph.disabledGroups[group.ID] = true
+		}
+	}
+	return graph
+}
+
+// node returns a node of the workflow
+func (g *workflowGraph) node(id uint) (models.Node, error) {
+	node, ok := g.nodes[id]
+	if !ok {
+		return node, fmt.Errorf("node %d not found in workflow %d", id, g.workflowID)
+	}
+	return node, nil
+}
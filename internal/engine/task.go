@@ -0,0 +1,123 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/expression"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/notify"
+)
+
+// HumanTaskExecutor pauses the execution until a person claimed and completed the task.
+// The data submitted on completion becomes the node output.
+type HumanTaskExecutor struct{}
+
+func (e *HumanTaskExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return nil, fmt.Errorf("human task nodes can only run inside a workflow execution")
+}
+
+func (e *HumanTaskExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	info, ok := ExecutionInfoFromContext(ctx)
+	if !ok {
+		return e.Execute(config, input)
+	}
+
+	// Title and description shown in the inbox, may reference input data
+	title, _ := config["title"].(string)
+	title, err := expression.Render(title, input, nil, expression.Options{})
+	if err != nil {
+		return nil, NewExecError(ErrorData, "failed to render title: %v", err)
+	}
+	if title == "" {
+		return nil, NewExecError(ErrorConfig, "title is required")
+	}
+
+	description, _ := config["description"].(string)
+	description, err = expression.Render(description, input, nil, expression.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to render description: %v", err)
+	}
+
+	var assignees []string
+	if list, ok := config["assignees"].([]interface{}); ok {
+		for _, assignee := range list {
+			if email, ok := assignee.(string); ok && email != "" {
+				assignees = append(assignees, email)
+			}
+		}
+	}
+	assigneeRole, _ := config["assignee_role"].(string)
+
+	// Due date relative to the creation of the task, e.g. "24h"
+	var dueAt *time.Time
+	if dueIn, ok := config["due_in"].(string); ok && dueIn != "" {
+		duration, err := time.ParseDuration(dueIn)
+		if err != nil {
+			return nil, fmt.Errorf("invalid due_in: %v", err)
+		}
+		due := time.Now().Add(duration)
+		dueAt = &due
+	}
+
+	// Data attached to the task, defaults to the node input
+	data := interface{}(input)
+	if configData, ok := config["data"]; ok {
+		data = configData
+	}
+
+	assigneesJSON, _ := json.Marshal(assignees)
+	if assignees == nil {
+		assigneesJSON = []byte("[]")
+	}
+	dataJSON, _ := json.Marshal(data)
+
+	task := models.HumanTask{
+		WorkflowID:          info.WorkflowID,
+		WorkflowExecutionID: info.ExecutionID,
+		NodeID:              info.NodeID,
+		Title:               title,
+		Description:         description,
+		Assignees:           string(assigneesJSON),
+		AssigneeRole:        assigneeRole,
+		Status:              "open",
+		DueAt:               dueAt,
+		Data:                string(dataJSON),
+	}
+	if err := database.DB.Create(&task).Error; err != nil {
+		return nil, fmt.Errorf("failed to create task: %v", err)
+	}
+
+	// Notification failures must not fail the workflow, the task is listed in the inbox anyway
+	link := ""
+	if publicURL := os.Getenv("PUBLIC_URL"); publicURL != "" {
+		link = fmt.Sprintf("%s/api/tasks/%d", strings.TrimSuffix(publicURL, "/"), task.ID)
+	}
+	text := title
+	if description != "" {
+		text += "\n\n" + description
+	}
+	if dueAt != nil {
+		text += fmt.Sprintf("\n\nDue: %s", dueAt.Format(time.RFC1123))
+	}
+	err = notify.Send(ctx, notify.Message{
+		Subject:    fmt.Sprintf("New task: %s", title),
+		Text:       text,
+		Recipients: assignees,
+		Link:       link,
+	})
+	if err != nil {
+		log.Printf("Failed to send notification for task %d: %v", task.ID, err)
+	}
+
+	return &SuspendResult{Output: map[string]interface{}{
+		"task_id": task.ID,
+		"status":  task.Status,
+	}}, nil
+}
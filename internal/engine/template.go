@@ -0,0 +1,160 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// maxTemplateOutput limits the size of a document rendered by a template node
+const maxTemplateOutput = 10 << 20
+
+// errTemplateOutputTooLarge is returned when a rendered document exceeds maxTemplateOutput
+var errTemplateOutputTooLarge = errors.New("rendered document exceeds 10 MB")
+
+// TemplateExecutor renders Go text/template documents from the node input, e.g. email bodies,
+// chat messages or file contents. With format "html" values are escaped for HTML.
+type TemplateExecutor struct{}
+
+func (e *TemplateExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	format, _ := config["format"].(string)
+	if format != "" && format != "text" && format != "html" {
+		return nil, fmt.Errorf("unknown format: %s", format)
+	}
+	strict, _ := config["strict"].(bool)
+
+	// A single template renders to "text", named templates to one output field each
+	templates := map[string]string{}
+	if text, ok := config["template"].(string); ok {
+		templates["text"] = text
+	}
+	if named, ok := config["templates"].(map[string]interface{}); ok {
+		for name, value := range named {
+			text, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("template %s must be a string", name)
+			}
+			templates[name] = text
+		}
+	}
+	if len(templates) == 0 {
+		return nil, NewExecError(ErrorConfig, "template or templates is required in config")
+	}
+
+	// Shared definitions ({{define "name"}}...{{end}}) usable by all templates
+	partials, _ := config["partials"].(string)
+
+	output := make(map[string]interface{}, len(templates))
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rendered, err := renderTemplate(name, partials+templates[name], format == "html", strict, input)
+		if err != nil {
+			return nil, err
+		}
+		output[name] = rendered
+	}
+
+	return output, nil
+}
+
+// renderTemplate parses and executes a single template against the data
+func renderTemplate(name, text string, html, strict bool, data interface{}) (string, error) {
+	missingKey := "missingkey=default"
+	if strict {
+		missingKey = "missingkey=error"
+	}
+
+	out := &limitedBuffer{limit: maxTemplateOutput}
+	var err error
+	if html {
+		var tmpl *htmltemplate.Template
+		tmpl, err = htmltemplate.New(name).Option(missingKey).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse template %s: %v", name, err)
+		}
+		err = tmpl.Execute(out, data)
+	} else {
+		var tmpl *template.Template
+		tmpl, err = template.New(name).Option(missingKey).Funcs(templateFuncs).Parse(text)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse template %s: %v", name, err)
+		}
+		err = tmpl.Execute(out, data)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to render template %s: %v", name, err)
+	}
+
+	// Missing values render as "<no value>" by default, which is never wanted in a document
+	return strings.ReplaceAll(out.String(), "<no value>", ""), nil
+}
+
+// templateFuncs are the functions available in template nodes in addition to the built-in ones
+var templateFuncs = map[string]interface{}{
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+	"trim":      strings.TrimSpace,
+	"replace":   func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"contains":  func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix": func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"split":     func(sep, s string) []string { return strings.Split(s, sep) },
+	"join": func(sep string, items interface{}) string {
+		list, _ := items.([]interface{})
+		parts := make([]string, len(list))
+		for i, item := range list {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, sep)
+	},
+	"default": func(fallback, value interface{}) interface{} {
+		if value == nil || value == "" {
+			return fallback
+		}
+		return value
+	},
+	"json": func(value interface{}) (string, error) {
+		data, err := json.Marshal(value)
+		return string(data), err
+	},
+	"add": func(a, b float64) float64 { return a + b },
+	"sub": func(a, b float64) float64 { return a - b },
+	"mul": func(a, b float64) float64 { return a * b },
+	"now": time.Now,
+	// formatTime formats an RFC 3339 timestamp or a time with a Go layout, e.g. "2006-01-02"
+	"formatTime": func(layout string, value interface{}) (string, error) {
+		switch t := value.(type) {
+		case time.Time:
+			return t.Format(layout), nil
+		case string:
+			parsed, err := time.Parse(time.RFC3339, t)
+			if err != nil {
+				return "", err
+			}
+			return parsed.Format(layout), nil
+		}
+		return "", fmt.Errorf("formatTime: unsupported value %v", value)
+	},
+}
+
+// limitedBuffer is a buffer failing writes beyond its limit
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, errTemplateOutputTooLarge
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,17 @@
+package engine
+
+import (
+	"time"
+
+	core "github.com/altipard/flowcraft/pkg/engine"
+)
+
+// TimeoutError is returned for executor calls exceeding the timeout of their node
+type TimeoutError = core.TimeoutError
+
+// NodeTimeout returns the timeout of the executor calls of a node from the duration in the
+// "timeout" of its config, e.g. "30s", 0 if the node has none. For waitForEvent nodes the
+// timeout also bounds the wait for the event.
+func NodeTimeout(config map[string]interface{}) (time.Duration, error) {
+	return core.NodeTimeout(config)
+}
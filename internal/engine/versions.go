@@ -0,0 +1,88 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// VersionReporter is implemented by executors that know their version, e.g. executors of
+// plugins, which may differ between workers after a node pack upgrade
+type VersionReporter interface {
+	Version() string
+}
+
+// executorVersion returns the version of a node type available on this worker: the version
+// reported by its executor, or else the version registered with the node type
+func executorVersion(executor NodeExecutor, nodeType models.NodeType) string {
+	if reporter, ok := executor.(VersionReporter); ok {
+		if version := reporter.Version(); version != "" {
+			return version
+		}
+	}
+	return nodeType.Version
+}
+
+// PinnedVersions returns the node type versions pinned by a workflow version by node type key
+func PinnedVersions(workflow models.Workflow) map[string]string {
+	var pins map[string]string
+	if workflow.NodeTypeVersions != "" {
+		json.Unmarshal([]byte(workflow.NodeTypeVersions), &pins)
+	}
+	return pins
+}
+
+// versionWarning describes how the version of a node type on this worker differs from the
+// version pinned by the workflow, empty if it does not
+func versionWarning(nodeType, pinned, actual string) string {
+	if pinned == "" || pinned == actual {
+		return ""
+	}
+	if actual == "" {
+		return fmt.Sprintf("node type %s is pinned to version %s, but this worker does not know its version", nodeType, pinned)
+	}
+	relation := "newer"
+	if CompareVersions(actual, pinned) < 0 {
+		relation = "older"
+	}
+	return fmt.Sprintf("node type %s is pinned to version %s, but this worker has the %s version %s", nodeType, pinned, relation, actual)
+}
+
+// CompareVersions compares dotted versions like 1.10.2 by their numeric parts, an optional "v"
+// prefix and pre-release suffixes are ignored. It returns -1, 0 or 1.
+func CompareVersions(a, b string) int {
+	partsA := versionParts(a)
+	partsB := versionParts(b)
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var x, y int
+		if i < len(partsA) {
+			x = partsA[i]
+		}
+		if i < len(partsB) {
+			y = partsB[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(version string) []int {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version = version[:i]
+	}
+	var parts []int
+	for _, part := range strings.Split(version, ".") {
+		n, _ := strconv.Atoi(part)
+		parts = append(parts, n)
+	}
+	return parts
+}
@@ -0,0 +1,213 @@
+// Package events lets workflows signal each other with named events. Events are stored
+// as a persistent log and announced via Redis pub/sub to the workers, which resume the
+// executions waiting for them.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/dispatch"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/queue"
+	"github.com/altipard/flowcraft/internal/schemas"
+)
+
+// Channel is the Redis pub/sub channel announcing new events
+const Channel = "flowcraft:events"
+
+// Output handles of waitForEvent nodes
+const (
+	HandleReceived = "received"
+	HandleTimeout  = "timeout"
+)
+
+var queueClient *queue.QueueClient
+
+// Configure sets the queue client used to announce events and resume executions
+func Configure(client *queue.QueueClient) {
+	queueClient = client
+}
+
+// eventMessage is the pub/sub message announcing an event
+type eventMessage struct {
+	EventID uint `json:"event_id"`
+}
+
+// Emit stores the event and announces it to the workers. Events with a schema in the registry
+// are rejected with a *schemas.InvalidPayloadError if the payload does not match it.
+func Emit(name string, payload interface{}, sourceExecutionID *uint) (*models.Event, error) {
+	if name == "" {
+		return nil, errors.New("event name is required")
+	}
+
+	// Payloads of events with a registered schema must match its latest version
+	schemaVersion, err := schemas.ValidatePayload(name, 0, payload)
+	if err != nil && !errors.Is(err, schemas.ErrNotFound) {
+		return nil, err
+	}
+
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %v", err)
+	}
+
+	event := models.Event{
+		Name:              name,
+		Payload:           string(payloadJSON),
+		SchemaVersion:     schemaVersion,
+		SourceExecutionID: sourceExecutionID,
+	}
+	if err := database.DB.Create(&event).Error; err != nil {
+		return nil, err
+	}
+
+	if queueClient == nil {
+		return &event, errors.New("events are not configured")
+	}
+	if err := queueClient.Publish(Channel, eventMessage{EventID: event.ID}); err != nil {
+		return &event, err
+	}
+
+	return &event, nil
+}
+
+// FindRecent returns the latest event with the given name matching the filter, emitted after since
+func FindRecent(name string, match map[string]interface{}, since time.Time) (*models.Event, error) {
+	var recent []models.Event
+	if err := database.DB.Where("name = ? AND created_at >= ?", name, since).Order("id DESC").Limit(100).Find(&recent).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range recent {
+		if Matches(recent[i], match) {
+			return &recent[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Matches reports whether every field of the filter equals the field of the event payload
+func Matches(event models.Event, match map[string]interface{}) bool {
+	if len(match) == 0 {
+		return true
+	}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal([]byte(event.Payload), &payload); err != nil {
+		return false
+	}
+
+	for key, expected := range match {
+		if fmt.Sprintf("%v", payload[key]) != fmt.Sprintf("%v", expected) {
+			return false
+		}
+	}
+	return true
+}
+
+// Output returns the output of a waitForEvent node that received the event
+func Output(event *models.Event) map[string]interface{} {
+	var payload interface{}
+	json.Unmarshal([]byte(event.Payload), &payload)
+
+	output := map[string]interface{}{
+		"event_id":   event.ID,
+		"name":       event.Name,
+		"payload":    payload,
+		"emitted_at": event.CreatedAt,
+	}
+	if event.SchemaVersion != 0 {
+		output["schema_version"] = event.SchemaVersion
+	}
+	return output
+}
+
+// Listen resumes the executions waiting for events announced on the channel until the context
+// is cancelled. Several workers may listen; each subscription is resumed only once.
+func Listen(ctx context.Context) {
+	dispatcher := dispatch.NewDispatcher(queueClient)
+
+	for message := range queueClient.Subscribe(ctx, Channel) {
+		var msg eventMessage
+		if err := json.Unmarshal(message, &msg); err != nil {
+			log.Printf("Invalid event message: %v", err)
+			continue
+		}
+
+		var event models.Event
+		if err := database.DB.First(&event, msg.EventID).Error; err != nil {
+			log.Printf("Event %d not found: %v", msg.EventID, err)
+			continue
+		}
+
+		deliver(dispatcher, &event)
+	}
+}
+
+// deliver resumes the waiting subscriptions matching the event
+func deliver(dispatcher *dispatch.Dispatcher, event *models.Event) {
+	var subscriptions []models.EventSubscription
+	database.DB.Where("event_name = ? AND status = ?", event.Name, "waiting").Find(&subscriptions)
+
+	for _, subscription := range subscriptions {
+		var match map[string]interface{}
+		json.Unmarshal([]byte(subscription.Match), &match)
+		if !Matches(*event, match) {
+			continue
+		}
+
+		// Claim the subscription, another worker may have received the same event
+		result := database.DB.Model(&models.EventSubscription{}).
+			Where("id = ? AND status = ?", subscription.ID, "waiting").
+			Updates(map[string]interface{}{"status": "received", "event_id": event.ID})
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+
+		if err := dispatcher.Resume(subscription.WorkflowExecutionID, subscription.NodeID, HandleReceived, Output(event)); err != nil {
+			log.Printf("Failed to resume execution %d for event %d: %v", subscription.WorkflowExecutionID, event.ID, err)
+		}
+	}
+}
+
+// ExpireSubscriptions periodically resumes subscriptions whose timeout passed with the
+// "timeout" handle until the context is cancelled
+func ExpireSubscriptions(ctx context.Context, interval time.Duration) {
+	dispatcher := dispatch.NewDispatcher(queueClient)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var expired []models.EventSubscription
+		database.DB.Where("status = ? AND expires_at < ?", "waiting", time.Now()).Find(&expired)
+
+		for _, subscription := range expired {
+			result := database.DB.Model(&models.EventSubscription{}).
+				Where("id = ? AND status = ?", subscription.ID, "waiting").
+				Update("status", "timed_out")
+			if result.Error != nil || result.RowsAffected == 0 {
+				continue
+			}
+
+			output := map[string]interface{}{
+				"name":      subscription.EventName,
+				"timed_out": true,
+			}
+			if err := dispatcher.Resume(subscription.WorkflowExecutionID, subscription.NodeID, HandleTimeout, output); err != nil {
+				log.Printf("Failed to resume timed out execution %d: %v", subscription.WorkflowExecutionID, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,240 @@
+// Package expression implements the {{ path }} template syntax used in node configurations
+package expression
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrTemplateInjection is returned when a substituted value contains template syntax
+// and the caller asked for such inputs to be rejected
+var ErrTemplateInjection = errors.New("input value contains template syntax")
+
+// placeholderPattern matches placeholders like "{{key}}" or "{{ data.user.name }}"
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// Escaper escapes a substituted value for the context it is inserted into
+type Escaper func(value string) string
+
+// Options controls how a template is rendered
+type Options struct {
+	// RejectTemplateSyntax makes rendering fail if a value contains "{{" or "}}"
+	RejectTemplateSyntax bool
+	// Namespaces resolve placeholders starting with "$<name>." (e.g. "{{$state.global.counter}}")
+	// instead of looking them up in the data
+	Namespaces map[string]Resolver
+}
+
+// Resolver resolves the path following a namespace prefix
+type Resolver func(path string) (interface{}, bool)
+
+// Lookup resolves a dotted path (e.g. "data.user.name") against a value.
+// Numeric path segments index into arrays.
+func Lookup(data interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return data, true
+	}
+
+	current := data
+	for _, part := range strings.Split(path, ".") {
+		switch value := current.(type) {
+		case map[string]interface{}:
+			next, exists := value[part]
+			if !exists {
+				return nil, false
+			}
+			current = next
+		case []interface{}:
+			var index int
+			if _, err := fmt.Sscanf(part, "%d", &index); err != nil || index < 0 || index >= len(value) {
+				return nil, false
+			}
+			current = value[index]
+		default:
+			return nil, false
+		}
+	}
+
+	return current, true
+}
+
+// ContainsTemplateSyntax reports whether s contains template delimiters
+func ContainsTemplateSyntax(s string) bool {
+	return strings.Contains(s, "{{") || strings.Contains(s, "}}")
+}
+
+// Render replaces all placeholders in template with values from data.
+// Placeholders that cannot be resolved are left untouched.
+func Render(template string, data interface{}, escape Escaper, opts Options) (string, error) {
+	var renderErr error
+
+	result := placeholderPattern.ReplaceAllStringFunc(template, func(match string) string {
+		if renderErr != nil {
+			return match
+		}
+
+		path := placeholderPattern.FindStringSubmatch(match)[1]
+		value, ok := lookup(data, path, opts)
+		if !ok {
+			return match
+		}
+
+		str := fmt.Sprintf("%v", value)
+		if opts.RejectTemplateSyntax && ContainsTemplateSyntax(str) {
+			renderErr = fmt.Errorf("%w: %s", ErrTemplateInjection, path)
+			return match
+		}
+
+		if escape != nil {
+			str = escape(str)
+		}
+		return str
+	})
+
+	if renderErr != nil {
+		return "", renderErr
+	}
+	return result, nil
+}
+
+// Placeholder returns the path of a template consisting of a single placeholder, e.g. "data.id"
+// for "{{ data.id }}"
+func Placeholder(template string) (string, bool) {
+	match := placeholderPattern.FindStringSubmatch(template)
+	if match == nil || match[0] != template {
+		return "", false
+	}
+	return match[1], true
+}
+
+// Unresolved returns the paths of the placeholders in template that cannot be resolved
+func Unresolved(template string, data interface{}, opts Options) []string {
+	var paths []string
+	for _, match := range placeholderPattern.FindAllStringSubmatch(template, -1) {
+		if _, ok := lookup(data, match[1], opts); !ok {
+			paths = append(paths, match[1])
+		}
+	}
+	return paths
+}
+
+// RenderValue renders the placeholders in all strings of a JSON-like value (maps, arrays and
+// scalars). A string consisting of a single placeholder is replaced by the referenced value
+// itself, keeping its type, e.g. "{{items}}" yields the array instead of its string form.
+func RenderValue(value interface{}, data interface{}, opts Options) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if path, ok := Placeholder(v); ok {
+			if resolved, ok := lookup(data, path, opts); ok {
+				if str, isString := resolved.(string); isString && opts.RejectTemplateSyntax && ContainsTemplateSyntax(str) {
+					return nil, fmt.Errorf("%w: %s", ErrTemplateInjection, path)
+				}
+				return resolved, nil
+			}
+		}
+		return Render(v, data, nil, opts)
+	case map[string]interface{}:
+		rendered := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			r, err := RenderValue(item, data, opts)
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = r
+		}
+		return rendered, nil
+	case []interface{}:
+		rendered := make([]interface{}, len(v))
+		for i, item := range v {
+			r, err := RenderValue(item, data, opts)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = r
+		}
+		return rendered, nil
+	default:
+		return value, nil
+	}
+}
+
+// lookup resolves a placeholder path against the namespaces or the data
+func lookup(data interface{}, path string, opts Options) (interface{}, bool) {
+	if strings.HasPrefix(path, "$") {
+		name, rest, _ := strings.Cut(path[1:], ".")
+		if resolve, ok := opts.Namespaces[name]; ok {
+			return resolve(rest)
+		}
+	}
+	return Lookup(data, path)
+}
+
+// RenderURL renders a URL template. Values inserted before the path (e.g. "{{base_url}}" in
+// "{{base_url}}/items" or "{{host}}" in "https://{{host}}/items") are inserted as they are, so
+// they can supply the scheme and host. Values inserted into the path are path-escaped, values
+// inserted into the query string or fragment are query-escaped.
+func RenderURL(template string, data interface{}, opts Options) (string, error) {
+	base, query, hasQuery := strings.Cut(template, "?")
+	if !hasQuery {
+		var hasFragment bool
+		base, query, hasFragment = strings.Cut(template, "#")
+		if hasFragment {
+			query = "#" + query
+		}
+	} else {
+		query = "?" + query
+	}
+
+	start := pathStart(base)
+	renderedOrigin, err := Render(base[:start], data, nil, opts)
+	if err != nil {
+		return "", err
+	}
+
+	renderedPath, err := Render(base[start:], data, url.PathEscape, opts)
+	if err != nil {
+		return "", err
+	}
+
+	renderedQuery, err := Render(query, data, url.QueryEscape, opts)
+	if err != nil {
+		return "", err
+	}
+
+	return renderedOrigin + renderedPath + renderedQuery, nil
+}
+
+// pathStart returns the index of the path in a URL template without query string: the first
+// "/" following the scheme and host. Slashes inside placeholders are ignored. Without a path
+// the whole template is scheme and host.
+func pathStart(template string) int {
+	masked := []byte(template)
+	for _, loc := range placeholderPattern.FindAllStringIndex(template, -1) {
+		for i := loc[0]; i < loc[1]; i++ {
+			masked[i] = '_'
+		}
+	}
+
+	from := 0
+	if i := strings.Index(string(masked), "://"); i >= 0 {
+		from = i + len("://")
+	}
+	if i := strings.IndexByte(string(masked[from:]), '/'); i >= 0 {
+		return from + i
+	}
+	return len(template)
+}
+
+// HeaderEscape removes characters that could be used to inject additional headers
+// or otherwise corrupt a header value (CR, LF and other control characters)
+func HeaderEscape(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, value)
+}
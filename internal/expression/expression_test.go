@@ -0,0 +1,31 @@
+package expression
+
+import "testing"
+
+func TestRenderURL(t *testing.T) {
+	data := map[string]interface{}{
+		"base_url": "https://api.example.com/v1",
+		"host":     "api.example.com:8443",
+		"id":       "a/b c",
+		"q":        "x&y=z",
+	}
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"{{base_url}}/items/{{id}}", "https://api.example.com/v1/items/a%2Fb%20c"},
+		{"{{ base_url }}", "https://api.example.com/v1"},
+		{"https://{{host}}/items/{{id}}?q={{q}}", "https://api.example.com:8443/items/a%2Fb%20c?q=x%26y%3Dz"},
+		{"https://api.example.com/items/{{id}}#{{q}}", "https://api.example.com/items/a%2Fb%20c#x%26y%3Dz"},
+		{"{{base_url}}/items?id={{id}}", "https://api.example.com/v1/items?id=a%2Fb+c"},
+	}
+	for _, tt := range tests {
+		got, err := RenderURL(tt.template, data, Options{})
+		if err != nil {
+			t.Fatalf("RenderURL(%q) error = %v", tt.template, err)
+		}
+		if got != tt.want {
+			t.Errorf("RenderURL(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Package forms defines the hosted input forms of form triggers: the fields declared in the
+// trigger's config, the validation of submissions and the rendering of the form page
+package forms
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// TriggerType is the type of triggers started by submitting a hosted form
+const TriggerType = "form"
+
+// Types of form fields
+const (
+	FieldText     = "text"
+	FieldTextarea = "textarea"
+	FieldEmail    = "email"
+	FieldNumber   = "number"
+	FieldSelect   = "select"
+	FieldCheckbox = "checkbox"
+	FieldDate     = "date"
+)
+
+// fieldNamePattern restricts field names to identifiers usable in expressions like {{ body.email }}
+var fieldNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// Form is the definition of a hosted form, stored as the config of a form trigger
+type Form struct {
+	Title          string  `json:"title"`
+	Description    string  `json:"description,omitempty"`
+	SubmitLabel    string  `json:"submit_label,omitempty"`
+	SuccessMessage string  `json:"success_message,omitempty"`
+	Fields         []Field `json:"fields"`
+}
+
+// Field is an input of a form
+type Field struct {
+	Name        string   `json:"name"`
+	Label       string   `json:"label,omitempty"`
+	Type        string   `json:"type"`
+	Required    bool     `json:"required,omitempty"`
+	Placeholder string   `json:"placeholder,omitempty"`
+	Options     []string `json:"options,omitempty"`    // select
+	Min         *float64 `json:"min,omitempty"`        // number
+	Max         *float64 `json:"max,omitempty"`        // number
+	MaxLength   int      `json:"max_length,omitempty"` // text, textarea, email
+}
+
+// Parse reads and checks the form definition of a trigger's config
+func Parse(config string) (Form, error) {
+	var form Form
+	if err := json.Unmarshal([]byte(config), &form); err != nil {
+		return form, fmt.Errorf("invalid form definition: %v", err)
+	}
+	if len(form.Fields) == 0 {
+		return form, errors.New("form triggers need at least one field in config.fields")
+	}
+
+	names := make(map[string]bool, len(form.Fields))
+	for i := range form.Fields {
+		field := &form.Fields[i]
+		if !fieldNamePattern.MatchString(field.Name) {
+			return form, fmt.Errorf("field %d: name must start with a letter or underscore and contain only letters, digits and underscores", i+1)
+		}
+		if names[field.Name] {
+			return form, fmt.Errorf("field %s is declared twice", field.Name)
+		}
+		names[field.Name] = true
+
+		if field.Type == "" {
+			field.Type = FieldText
+		}
+		if field.Label == "" {
+			field.Label = field.Name
+		}
+		switch field.Type {
+		case FieldText, FieldTextarea, FieldEmail, FieldNumber, FieldCheckbox, FieldDate:
+		case FieldSelect:
+			if len(field.Options) == 0 {
+				return form, fmt.Errorf("field %s: select fields need options", field.Name)
+			}
+		default:
+			return form, fmt.Errorf("field %s: type must be text, textarea, email, number, select, checkbox or date", field.Name)
+		}
+		if field.MaxLength < 0 {
+			return form, fmt.Errorf("field %s: max_length must not be negative", field.Name)
+		}
+		if field.Min != nil && field.Max != nil && *field.Min > *field.Max {
+			return form, fmt.Errorf("field %s: min must not be greater than max", field.Name)
+		}
+	}
+	return form, nil
+}
+
+// Validate checks submitted values against the fields of a form and converts them to the types of
+// the fields: numbers to float64, checkboxes to bool, the others to strings. Values may be strings,
+// as submitted by the form page, or typed as in JSON submissions. Values of undeclared fields are
+// dropped. It returns the values and the problems by field name, empty if the submission is valid.
+func Validate(form Form, submitted map[string]interface{}) (map[string]interface{}, map[string]string) {
+	values := make(map[string]interface{}, len(form.Fields))
+	problems := map[string]string{}
+
+	for _, field := range form.Fields {
+		raw, present := submitted[field.Name]
+		if text, ok := raw.(string); ok && strings.TrimSpace(text) == "" && field.Type != FieldCheckbox {
+			present = false
+		}
+		if !present || raw == nil {
+			if field.Type == FieldCheckbox {
+				if field.Required {
+					problems[field.Name] = "must be checked"
+				}
+				values[field.Name] = false
+				continue
+			}
+			if field.Required {
+				problems[field.Name] = "is required"
+			}
+			continue
+		}
+
+		value, err := convert(field, raw)
+		if err != nil {
+			problems[field.Name] = err.Error()
+			continue
+		}
+		values[field.Name] = value
+	}
+	return values, problems
+}
+
+// Problems lists the problems of a submission in the order of the form's fields
+func Problems(form Form, problems map[string]string) []string {
+	list := make([]string, 0, len(problems))
+	for _, field := range form.Fields {
+		if problem, ok := problems[field.Name]; ok {
+			list = append(list, field.Name+": "+problem)
+		}
+	}
+	return list
+}
+
+// convert checks a submitted value and converts it to the type of its field
+func convert(field Field, raw interface{}) (interface{}, error) {
+	switch field.Type {
+	case FieldNumber:
+		var number float64
+		switch value := raw.(type) {
+		case float64:
+			number = value
+		case string:
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				return nil, errors.New("must be a number")
+			}
+			number = parsed
+		default:
+			return nil, errors.New("must be a number")
+		}
+		if field.Min != nil && number < *field.Min {
+			return nil, fmt.Errorf("must be at least %v", *field.Min)
+		}
+		if field.Max != nil && number > *field.Max {
+			return nil, fmt.Errorf("must be at most %v", *field.Max)
+		}
+		return number, nil
+
+	case FieldCheckbox:
+		checked := false
+		switch value := raw.(type) {
+		case bool:
+			checked = value
+		case string:
+			// Browsers submit checked checkboxes with the value "on"
+			checked = value == "on" || value == "true" || value == "1"
+		default:
+			return nil, errors.New("must be true or false")
+		}
+		if field.Required && !checked {
+			return nil, errors.New("must be checked")
+		}
+		return checked, nil
+	}
+
+	text, ok := raw.(string)
+	if !ok {
+		return nil, errors.New("must be a string")
+	}
+	text = strings.TrimSpace(text)
+	if field.MaxLength > 0 && utf8.RuneCountInString(text) > field.MaxLength {
+		return nil, fmt.Errorf("must be at most %d characters", field.MaxLength)
+	}
+
+	switch field.Type {
+	case FieldEmail:
+		address, err := mail.ParseAddress(text)
+		if err != nil || address.Address != text {
+			return nil, errors.New("must be an email address")
+		}
+	case FieldSelect:
+		for _, option := range field.Options {
+			if option == text {
+				return text, nil
+			}
+		}
+		return nil, errors.New("must be one of " + strings.Join(field.Options, ", "))
+	case FieldDate:
+		if _, err := time.Parse("2006-01-02", text); err != nil {
+			return nil, errors.New("must be a date like 2026-01-31")
+		}
+	}
+	return text, nil
+}
@@ -0,0 +1,85 @@
+package forms
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+)
+
+// Page is a rendering of a form: empty, with the values and problems of an invalid submission, or
+// the confirmation of a submitted form
+type Page struct {
+	Form Form
+	// Values are the submitted values to fill in again, by field name
+	Values map[string]string
+	// Problems are the problems of the submitted values, by field name
+	Problems map[string]string
+	// Error is shown above the form if the submission could not be processed
+	Error string
+	// Submitted shows the success message instead of the form
+	Submitted bool
+}
+
+// Render writes the HTML page of a form
+func Render(w io.Writer, page Page) error {
+	if page.Form.SubmitLabel == "" {
+		page.Form.SubmitLabel = "Submit"
+	}
+	if page.Form.SuccessMessage == "" {
+		page.Form.SuccessMessage = "Thank you, your response was submitted."
+	}
+	return pageTemplate.Execute(w, page)
+}
+
+var pageTemplate = template.Must(template.New("form").Funcs(template.FuncMap{
+	"value": func(values map[string]string, name string) string { return values[name] },
+	"number": func(n *float64) string {
+		if n == nil {
+			return ""
+		}
+		return fmt.Sprint(*n)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Form.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; background: #f5f6f8; color: #1f2328; margin: 0; }
+main { max-width: 560px; margin: 40px auto; background: #fff; padding: 32px; border-radius: 8px; box-shadow: 0 1px 3px rgba(0,0,0,.12); }
+h1 { font-size: 1.5em; margin-top: 0; }
+label { display: block; font-weight: 600; margin: 18px 0 6px; }
+label.checkbox { font-weight: normal; }
+input[type=text], input[type=email], input[type=number], input[type=date], select, textarea { width: 100%; box-sizing: border-box; padding: 8px; border: 1px solid #d0d7de; border-radius: 6px; font: inherit; }
+textarea { min-height: 120px; }
+.problem { color: #cf222e; font-size: .9em; margin-top: 4px; }
+.error { background: #ffebe9; border: 1px solid #ff8182; padding: 10px; border-radius: 6px; }
+button { margin-top: 24px; padding: 10px 20px; border: 0; border-radius: 6px; background: #1f6feb; color: #fff; font: inherit; cursor: pointer; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Form.Title}}</h1>
+{{if .Submitted}}<p>{{.Form.SuccessMessage}}</p>{{else}}
+{{with .Form.Description}}<p>{{.}}</p>{{end}}
+{{with .Error}}<p class="error">{{.}}</p>{{end}}
+<form method="post">
+{{range .Form.Fields}}{{$value := value $.Values .Name}}
+{{if eq .Type "checkbox"}}<label class="checkbox"><input type="checkbox" name="{{.Name}}"{{if $value}} checked{{end}}{{if .Required}} required{{end}}> {{.Label}}</label>
+{{else}}<label for="field-{{.Name}}">{{.Label}}</label>
+{{if eq .Type "textarea"}}<textarea id="field-{{.Name}}" name="{{.Name}}" placeholder="{{.Placeholder}}"{{if .MaxLength}} maxlength="{{.MaxLength}}"{{end}}{{if .Required}} required{{end}}>{{$value}}</textarea>
+{{else if eq .Type "select"}}<select id="field-{{.Name}}" name="{{.Name}}"{{if .Required}} required{{end}}>
+<option value=""></option>
+{{range .Options}}<option{{if eq . $value}} selected{{end}}>{{.}}</option>
+{{end}}</select>
+{{else}}<input type="{{.Type}}" id="field-{{.Name}}" name="{{.Name}}" value="{{$value}}" placeholder="{{.Placeholder}}"{{if eq .Type "number"}} step="any"{{with number .Min}} min="{{.}}"{{end}}{{with number .Max}} max="{{.}}"{{end}}{{end}}{{if .MaxLength}} maxlength="{{.MaxLength}}"{{end}}{{if .Required}} required{{end}}>
+{{end}}{{end}}{{with index $.Problems .Name}}<div class="problem">{{.}}</div>
+{{end}}{{end}}
+<button type="submit">{{.Form.SubmitLabel}}</button>
+</form>
+{{end}}
+</main>
+</body>
+</html>
+`))
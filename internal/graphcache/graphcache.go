@@ -0,0 +1,215 @@
+// Package graphcache caches node types and workflow graphs for the engine, which otherwise
+// loads them from the database for every execution and node. Entries are kept in process and
+// optionally in Redis, and evicted in all processes when a node type or workflow changes.
+package graphcache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/queue"
+)
+
+// Channel is the Redis pub/sub channel announcing changed node types and workflows
+const Channel = "flowcraft:graphcache"
+
+// keyPrefix prefixes the Redis keys of cached entries
+const keyPrefix = "flowcraft:graphcache:"
+
+// Config holds the settings of the cache
+type Config struct {
+	// TTL is how long entries are kept; 0 disables caching
+	TTL time.Duration
+	// Redis shares the cached entries between the processes via Redis
+	Redis bool
+}
+
+// ConfigFromEnv reads the cache settings from the environment
+func ConfigFromEnv() Config {
+	cfg := Config{TTL: 5 * time.Minute}
+	if ttl, err := time.ParseDuration(os.Getenv("GRAPH_CACHE_TTL")); err == nil && ttl >= 0 {
+		cfg.TTL = ttl
+	}
+	cfg.Redis = os.Getenv("GRAPH_CACHE_REDIS") == "true"
+	return cfg
+}
+
+// entry is a cached value with its expiry
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+var (
+	config      = Config{TTL: 5 * time.Minute}
+	queueClient *queue.QueueClient
+
+	mu      sync.RWMutex
+	entries = map[string]entry{}
+)
+
+// Configure sets the cache settings and the queue client used to share entries and announce
+// changes. Without a queue client, changes only evict the entries of this process.
+func Configure(cfg Config, client *queue.QueueClient) {
+	config = cfg
+	queueClient = client
+}
+
+// invalidation is the pub/sub message announcing a changed entry
+type invalidation struct {
+	Key string `json:"key"`
+}
+
+func nodeTypeKey(key string) string {
+	return "node_type:" + key
+}
+
+func workflowKey(id uint) string {
+	return "workflow:" + strconv.FormatUint(uint64(id), 10)
+}
+
+// NodeType returns the node type with the given key
+func NodeType(key string) (models.NodeType, error) {
+	var nodeType models.NodeType
+	err := load(nodeTypeKey(key), &nodeType, func() error {
+		return database.DB.Where("key = ?", key).First(&nodeType).Error
+	})
+	return nodeType, err
+}
+
+// Workflow returns the workflow with its nodes and connections. The returned workflow is a copy
+// and may be modified by the caller.
+func Workflow(id uint) (models.Workflow, error) {
+	var workflow models.Workflow
+	err := load(workflowKey(id), &workflow, func() error {
+		return database.DB.Preload("Nodes").Preload("Connections").Preload("Groups").First(&workflow, id).Error
+	})
+	if err != nil {
+		return workflow, err
+	}
+
+	workflow.Nodes = append([]models.Node(nil), workflow.Nodes...)
+	workflow.Connections = append([]models.Connection(nil), workflow.Connections...)
+	workflow.Groups = append([]models.NodeGroup(nil), workflow.Groups...)
+	return workflow, nil
+}
+
+// InvalidateNodeType evicts a changed node type in all processes
+func InvalidateNodeType(key string) {
+	invalidate(nodeTypeKey(key))
+}
+
+// InvalidateWorkflow evicts the graph of a changed workflow in all processes
+func InvalidateWorkflow(id uint) {
+	invalidate(workflowKey(id))
+}
+
+// load reads the entry with the given key into dest, from the process, Redis or the database
+func load(key string, dest interface{}, fetch func() error) error {
+	if config.TTL <= 0 {
+		return fetch()
+	}
+
+	mu.RLock()
+	cached, ok := entries[key]
+	mu.RUnlock()
+	if ok && time.Now().Before(cached.expires) {
+		return assign(dest, cached.value)
+	}
+
+	if config.Redis && queueClient != nil {
+		data, err := queueClient.RedisClient().Get(context.Background(), keyPrefix+key).Bytes()
+		if err == nil && json.Unmarshal(data, dest) == nil {
+			store(key, dest)
+			return nil
+		}
+	}
+
+	if err := fetch(); err != nil {
+		return err
+	}
+	store(key, dest)
+
+	if config.Redis && queueClient != nil {
+		if data, err := json.Marshal(dest); err == nil {
+			queueClient.RedisClient().Set(context.Background(), keyPrefix+key, data, config.TTL)
+		}
+	}
+	return nil
+}
+
+// store keeps a copy of the value in the process
+func store(key string, value interface{}) {
+	var copied interface{}
+	switch v := value.(type) {
+	case *models.NodeType:
+		copied = *v
+	case *models.Workflow:
+		copied = *v
+	default:
+		return
+	}
+
+	mu.Lock()
+	entries[key] = entry{value: copied, expires: time.Now().Add(config.TTL)}
+	mu.Unlock()
+}
+
+// assign copies a cached value into dest
+func assign(dest, value interface{}) error {
+	switch d := dest.(type) {
+	case *models.NodeType:
+		*d = value.(models.NodeType)
+	case *models.Workflow:
+		*d = value.(models.Workflow)
+	default:
+		return fmt.Errorf("unsupported cache entry type %T", dest)
+	}
+	return nil
+}
+
+// evict removes an entry from the process
+func evict(key string) {
+	mu.Lock()
+	delete(entries, key)
+	mu.Unlock()
+}
+
+// invalidate removes an entry from the process and Redis and announces the change to the other processes
+func invalidate(key string) {
+	evict(key)
+	if queueClient == nil {
+		return
+	}
+
+	if config.Redis {
+		queueClient.RedisClient().Del(context.Background(), keyPrefix+key)
+	}
+	if err := queueClient.Publish(Channel, invalidation{Key: key}); err != nil {
+		log.Printf("Failed to announce change of %s: %v", key, err)
+	}
+}
+
+// Listen evicts the entries announced as changed by other processes until ctx is done
+func Listen(ctx context.Context) {
+	if queueClient == nil {
+		return
+	}
+
+	for message := range queueClient.Subscribe(ctx, Channel) {
+		var msg invalidation
+		if err := json.Unmarshal(message, &msg); err != nil {
+			log.Printf("Invalid graph cache message: %v", err)
+			continue
+		}
+		evict(msg.Key)
+	}
+}
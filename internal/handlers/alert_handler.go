@@ -0,0 +1,337 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/alerting"
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// AlertHandler manages the HTTP requests for alert rules and their alerts
+type AlertHandler struct{}
+
+// NewAlertHandler creates a new AlertHandler
+func NewAlertHandler() *AlertHandler {
+	return &AlertHandler{}
+}
+
+// GetRules godoc
+// @Summary Get all alert rules
+// @Description Returns the alert rules of the user's organization
+// @Tags alerts
+// @Accept json
+// @Produce json
+// @Success 200 {array} models.AlertRule
+// @Failure 500 {object} map[string]string
+// @Router /alert-rules [get]
+func (h *AlertHandler) GetRules(c echo.Context) error {
+	var rules []models.AlertRule
+	if err := organizationRules(c, database.Replica()).Order("id").Find(&rules).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, rules)
+}
+
+// GetRule godoc
+// @Summary Get alert rule by ID
+// @Description Returns an alert rule
+// @Tags alerts
+// @Accept json
+// @Produce json
+// @Param id path int true "Alert rule ID"
+// @Success 200 {object} models.AlertRule
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /alert-rules/{id} [get]
+func (h *AlertHandler) GetRule(c echo.Context) error {
+	rule, err := h.findRule(c)
+	if err != nil {
+		return ruleError(c, err)
+	}
+	return c.JSON(http.StatusOK, rule)
+}
+
+// CreateRule godoc
+// @Summary Create an alert rule
+// @Description Creates a rule alerting by email, Slack or webhook when the failure rate, the consecutive failures or the execution duration of a workflow, the workflows with a tag or all workflows reaches the threshold
+// @Tags alerts
+// @Accept json
+// @Produce json
+// @Param rule body models.AlertRule true "Alert rule data"
+// @Success 201 {object} models.AlertRule
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /alert-rules [post]
+func (h *AlertHandler) CreateRule(c echo.Context) error {
+	var rule models.AlertRule
+	if err := c.Bind(&rule); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	rule = models.AlertRule{
+		Name:          rule.Name,
+		Condition:     rule.Condition,
+		Threshold:     rule.Threshold,
+		Window:        rule.Window,
+		MinExecutions: rule.MinExecutions,
+		Scope:         rule.Scope,
+		WorkflowID:    rule.WorkflowID,
+		Tag:           rule.Tag,
+		Channel:       rule.Channel,
+		Target:        rule.Target,
+		Disabled:      rule.Disabled,
+	}
+	if user := auth.CurrentUser(c); user != nil {
+		rule.CreatedBy = user.ID
+		rule.OrganizationID = user.OrganizationID
+	}
+
+	if err := alerting.Validate(&rule); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := database.DB.Create(&rule).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, rule)
+}
+
+// UpdateRule godoc
+// @Summary Update an alert rule
+// @Description Updates the condition, scope and channel of an alert rule or disables it. Changing the condition or scope resets the rule's alerts.
+// @Tags alerts
+// @Accept json
+// @Produce json
+// @Param id path int true "Alert rule ID"
+// @Param rule body models.AlertRule true "Updated alert rule data"
+// @Success 200 {object} models.AlertRule
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /alert-rules/{id} [put]
+func (h *AlertHandler) UpdateRule(c echo.Context) error {
+	rule, err := h.findRule(c)
+	if err != nil {
+		return ruleError(c, err)
+	}
+	previous := *rule
+
+	var update models.AlertRule
+	if err := c.Bind(&update); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	rule.Name = update.Name
+	rule.Condition = update.Condition
+	rule.Threshold = update.Threshold
+	rule.Window = update.Window
+	rule.MinExecutions = update.MinExecutions
+	rule.Scope = update.Scope
+	rule.WorkflowID = update.WorkflowID
+	rule.Tag = update.Tag
+	rule.Channel = update.Channel
+	rule.Target = update.Target
+	rule.Disabled = update.Disabled
+
+	if err := alerting.Validate(rule); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := database.DB.Save(rule).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	// The alerts of a different condition or scope measure something else
+	if rule.Condition != previous.Condition || rule.Scope != previous.Scope || rule.Tag != previous.Tag ||
+		!sameID(rule.WorkflowID, previous.WorkflowID) {
+		database.DB.Where("alert_rule_id = ?", rule.ID).Delete(&models.Alert{})
+	}
+	return c.JSON(http.StatusOK, rule)
+}
+
+// DeleteRule godoc
+// @Summary Delete an alert rule
+// @Description Deletes an alert rule and its alerts
+// @Tags alerts
+// @Accept json
+// @Produce json
+// @Param id path int true "Alert rule ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /alert-rules/{id} [delete]
+func (h *AlertHandler) DeleteRule(c echo.Context) error {
+	rule, err := h.findRule(c)
+	if err != nil {
+		return ruleError(c, err)
+	}
+
+	if err := database.DB.Where("alert_rule_id = ?", rule.ID).Delete(&models.Alert{}).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if err := database.DB.Delete(rule).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Silence godoc
+// @Summary Silence an alert rule
+// @Description Suppresses the notifications of an alert rule for a duration or until a time. Its alerts are still tracked; the ones firing when the silence ends are notified then.
+// @Tags alerts
+// @Accept json
+// @Produce json
+// @Param id path int true "Alert rule ID"
+// @Param silence body models.SilenceRequest true "Duration or end of the silence"
+// @Success 200 {object} models.AlertRule
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /alert-rules/{id}/silence [post]
+func (h *AlertHandler) Silence(c echo.Context) error {
+	rule, err := h.findRule(c)
+	if err != nil {
+		return ruleError(c, err)
+	}
+
+	var req models.SilenceRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	var until time.Time
+	switch {
+	case req.Until != nil:
+		until = *req.Until
+	case req.Duration != "":
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil || duration <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid duration"})
+		}
+		until = time.Now().Add(duration)
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "duration or until is required"})
+	}
+	if !until.After(time.Now()) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "The silence must end in the future"})
+	}
+
+	if err := alerting.Silence(rule, until); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, rule)
+}
+
+// Unsilence godoc
+// @Summary End the silence of an alert rule
+// @Description Ends the silence of an alert rule, its firing alerts are notified with the next evaluation
+// @Tags alerts
+// @Accept json
+// @Produce json
+// @Param id path int true "Alert rule ID"
+// @Success 200 {object} models.AlertRule
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /alert-rules/{id}/silence [delete]
+func (h *AlertHandler) Unsilence(c echo.Context) error {
+	rule, err := h.findRule(c)
+	if err != nil {
+		return ruleError(c, err)
+	}
+
+	if err := alerting.Silence(rule, time.Time{}); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, rule)
+}
+
+// GetAlerts godoc
+// @Summary Get alerts
+// @Description Returns the alerts of the organization's rules, by default only the firing ones
+// @Tags alerts
+// @Accept json
+// @Produce json
+// @Param rule_id query int false "Only alerts of this rule"
+// @Param state query string false "firing (default), ok or all"
+// @Success 200 {array} models.Alert
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /alerts [get]
+func (h *AlertHandler) GetAlerts(c echo.Context) error {
+	query := database.Replica().
+		Where("alert_rule_id IN (?)", organizationRules(c, database.Replica().Model(&models.AlertRule{})).Select("id"))
+
+	if ruleID := c.QueryParam("rule_id"); ruleID != "" {
+		id, err := strconv.Atoi(ruleID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid rule ID"})
+		}
+		query = query.Where("alert_rule_id = ?", id)
+	}
+
+	switch state := c.QueryParam("state"); state {
+	case "":
+		query = query.Where("state = ?", models.AlertFiring)
+	case "all":
+	case models.AlertFiring, models.AlertOK:
+		query = query.Where("state = ?", state)
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid state"})
+	}
+
+	var alerts []models.Alert
+	if err := query.Order("updated_at DESC").Find(&alerts).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, alerts)
+}
+
+var errInvalidAlertRuleID = errors.New("Invalid ID")
+
+// findRule loads the alert rule of the request, see ruleError for the responses of its errors
+func (h *AlertHandler) findRule(c echo.Context) (*models.AlertRule, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, errInvalidAlertRuleID
+	}
+
+	var rule models.AlertRule
+	if err := organizationRules(c, database.DB).First(&rule, id).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// ruleError maps errors of findRule to responses
+func ruleError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, errInvalidAlertRuleID):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Alert rule not found"})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
+
+// organizationRules restricts a query of alert rules to the organization of the user
+func organizationRules(c echo.Context, query *gorm.DB) *gorm.DB {
+	if user := auth.CurrentUser(c); user != nil && user.OrganizationID != 0 {
+		return query.Where("organization_id = ?", user.OrganizationID)
+	}
+	return query
+}
+
+func sameID(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
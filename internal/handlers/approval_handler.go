@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/dispatch"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/queue"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// ApprovalHandler manages the HTTP requests for approvals
+type ApprovalHandler struct {
+	dispatcher *dispatch.Dispatcher
+}
+
+// NewApprovalHandler creates a new ApprovalHandler
+func NewApprovalHandler(queueClient *queue.QueueClient) *ApprovalHandler {
+	return &ApprovalHandler{
+		dispatcher: dispatch.NewDispatcher(queueClient),
+	}
+}
+
+// DecisionRequest represents the input data for an approval decision
+type DecisionRequest struct {
+	Decision string `json:"decision"` // approve, reject
+	Comment  string `json:"comment"`
+}
+
+// errDecisionNotAllowed is returned when the user may not decide on an approval
+var errDecisionNotAllowed = errors.New("you are not an assignee of this approval")
+
+// GetAll godoc
+// @Summary Get approvals
+// @Description Returns approvals, optionally filtered by status
+// @Tags approvals
+// @Accept json
+// @Produce json
+// @Param status query string false "Filter by status (pending, approved, rejected)"
+// @Success 200 {array} models.Approval
+// @Failure 500 {object} map[string]string
+// @Router /approvals [get]
+func (h *ApprovalHandler) GetAll(c echo.Context) error {
+	query := database.DB.Preload("Decisions").Order("created_at DESC")
+	if status := c.QueryParam("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var approvals []models.Approval
+	if err := query.Find(&approvals).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, approvals)
+}
+
+// GetByID godoc
+// @Summary Get approval by ID
+// @Description Returns a specific approval with its decisions
+// @Tags approvals
+// @Accept json
+// @Produce json
+// @Param id path int true "Approval ID"
+// @Success 200 {object} models.Approval
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /approvals/{id} [get]
+func (h *ApprovalHandler) GetByID(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var approval models.Approval
+	if err := database.DB.Preload("Decisions").First(&approval, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Approval not found"})
+	}
+
+	return c.JSON(http.StatusOK, approval)
+}
+
+// Decide godoc
+// @Summary Decide on an approval
+// @Description Approves or rejects a pending approval. The execution continues down the "approved" handle once enough distinct users approved, or down the "rejected" handle as soon as someone rejects.
+// @Tags approvals
+// @Accept json
+// @Produce json
+// @Param id path int true "Approval ID"
+// @Param decision body DecisionRequest true "Decision"
+// @Success 200 {object} models.Approval
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /approvals/{id}/decide [post]
+func (h *ApprovalHandler) Decide(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var request DecisionRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if request.Decision != "approve" && request.Decision != "reject" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "decision must be approve or reject"})
+	}
+
+	user := auth.CurrentUser(c)
+
+	var approval models.Approval
+	var decided bool
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the approval so concurrent decisions are counted correctly
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&approval, id).Error; err != nil {
+			return gorm.ErrRecordNotFound
+		}
+		if approval.Status != "pending" {
+			return errAlreadyDecided
+		}
+		if !mayDecide(user, approval) {
+			return errDecisionNotAllowed
+		}
+
+		decision := models.ApprovalDecision{
+			ApprovalID: approval.ID,
+			UserID:     user.ID,
+			Decision:   request.Decision,
+			Comment:    request.Comment,
+		}
+		if err := tx.Create(&decision).Error; err != nil {
+			return errAlreadyVoted
+		}
+
+		var approvals int64
+		tx.Model(&models.ApprovalDecision{}).Where("approval_id = ? AND decision = ?", approval.ID, "approve").Count(&approvals)
+
+		now := time.Now()
+		switch {
+		case request.Decision == "reject":
+			approval.Status = "rejected"
+		case approvals >= int64(approval.RequiredApprovals):
+			approval.Status = "approved"
+		default:
+			return nil
+		}
+
+		approval.DecidedAt = &now
+		decided = true
+		return tx.Save(&approval).Error
+	})
+
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Approval not found"})
+	case errors.Is(err, errDecisionNotAllowed):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, errAlreadyDecided), errors.Is(err, errAlreadyVoted):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case err != nil:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	database.DB.Preload("Decisions").First(&approval, approval.ID)
+
+	// Continue the waiting execution down the handle matching the outcome
+	if decided {
+		var data interface{}
+		json.Unmarshal([]byte(approval.Data), &data)
+
+		output := map[string]interface{}{
+			"approval_id": approval.ID,
+			"status":      approval.Status,
+			"decisions":   approval.Decisions,
+			"data":        data,
+		}
+		if err := h.dispatcher.Resume(approval.WorkflowExecutionID, approval.NodeID, approval.Status, output); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+	}
+
+	return c.JSON(http.StatusOK, approval)
+}
+
+// Errors of conflicting decisions
+var (
+	errAlreadyDecided = errors.New("approval has already been decided")
+	errAlreadyVoted   = errors.New("you have already decided on this approval")
+)
+
+// mayDecide reports whether the user is allowed to decide on the approval.
+// Without assignees any admin or editor may decide; admins may always decide.
+func mayDecide(user *models.User, approval models.Approval) bool {
+	if user.Role == models.RoleAdmin {
+		return true
+	}
+
+	var assignees []string
+	json.Unmarshal([]byte(approval.Assignees), &assignees)
+	if len(assignees) == 0 {
+		return user.Role == models.RoleEditor
+	}
+
+	for _, assignee := range assignees {
+		if assignee == user.Email {
+			return true
+		}
+	}
+	return false
+}
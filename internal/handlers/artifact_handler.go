@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/blob"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// ArtifactHandler manages the HTTP requests for the artifacts of executions
+type ArtifactHandler struct{}
+
+// NewArtifactHandler creates a new ArtifactHandler
+func NewArtifactHandler() *ArtifactHandler {
+	return &ArtifactHandler{}
+}
+
+// GetAll godoc
+// @Summary Get the artifacts of an execution
+// @Description Returns the artifacts the nodes of an execution kept, e.g. reports or exports, oldest first. Artifacts are listed until they expire, even if the execution data was removed before.
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Success 200 {array} models.ExecutionArtifact
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id}/artifacts [get]
+func (h *ArtifactHandler) GetAll(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	artifacts := []models.ExecutionArtifact{}
+	if err := database.Replica().Where("workflow_execution_id = ? AND expires_at > ?", id, time.Now()).
+		Order("id").Find(&artifacts).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, artifacts)
+}
+
+// Download godoc
+// @Summary Download an artifact of an execution
+// @Description Returns the contents of an artifact as attachment named by its file name
+// @Tags executions
+// @Produce octet-stream
+// @Param id path int true "Execution ID"
+// @Param artifact_id path int true "Artifact ID"
+// @Success 200 {file} binary
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id}/artifacts/{artifact_id} [get]
+func (h *ArtifactHandler) Download(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+	artifactID, err := strconv.Atoi(c.Param("artifact_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid artifact ID"})
+	}
+
+	var artifact models.ExecutionArtifact
+	if err := database.Replica().Where("id = ? AND workflow_execution_id = ? AND expires_at > ?", artifactID, id, time.Now()).
+		First(&artifact).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Artifact not found"})
+	}
+
+	r, err := blob.Open(c.Request().Context(), artifact.BlobID)
+	if errors.Is(err, blob.ErrNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Artifact not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	defer r.Close()
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": artifact.FileName}))
+	contentType := artifact.ContentType
+	if contentType == "" {
+		contentType = echo.MIMEOctetStream
+	}
+	return c.Stream(http.StatusOK, contentType, r)
+}
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// AuthHandler manages the HTTP requests for login and the current user
+type AuthHandler struct {
+	oidcProvider      *auth.OIDCProvider
+	passwordProviders []auth.PasswordProvider
+}
+
+// NewAuthHandler creates a new AuthHandler. oidcProvider may be nil if OIDC is not configured.
+func NewAuthHandler(oidcProvider *auth.OIDCProvider, passwordProviders []auth.PasswordProvider) *AuthHandler {
+	return &AuthHandler{
+		oidcProvider:      oidcProvider,
+		passwordProviders: passwordProviders,
+	}
+}
+
+// LoginRequest represents the credentials for a password login
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Provider restricts the login to one provider (local, ldap); all configured providers are tried if empty
+	Provider string `json:"provider"`
+}
+
+// LoginResponse is returned after a successful login or token refresh
+type LoginResponse struct {
+	auth.TokenPair
+	User *models.User `json:"user,omitempty"`
+}
+
+// RefreshRequest represents the input data for a token refresh
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// IntrospectRequest represents the input data for a token introspection
+type IntrospectRequest struct {
+	Token string `json:"token"`
+}
+
+// Providers godoc
+// @Summary List login providers
+// @Description Returns the authentication providers configured on this installation
+// @Tags auth
+// @Produce json
+// @Success 200 {object} map[string][]string
+// @Router /auth/providers [get]
+func (h *AuthHandler) Providers(c echo.Context) error {
+	providers := []string{}
+	for _, provider := range h.passwordProviders {
+		providers = append(providers, provider.Name())
+	}
+	if h.oidcProvider != nil {
+		providers = append(providers, "oidc")
+	}
+
+	return c.JSON(http.StatusOK, map[string][]string{"providers": providers})
+}
+
+// Login godoc
+// @Summary Log in with username and password
+// @Description Authenticates against the configured password providers (local, ldap) and issues a bearer token
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param credentials body LoginRequest true "Credentials"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /auth/login [post]
+func (h *AuthHandler) Login(c echo.Context) error {
+	var request LoginRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	user, err := auth.LoginWithPassword(c.Request().Context(), h.passwordProviders, request.Provider, request.Username, request.Password)
+	if err != nil {
+		if err != auth.ErrInvalidCredentials {
+			c.Logger().Errorf("login failed: %v", err)
+		}
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": auth.ErrInvalidCredentials.Error()})
+	}
+
+	return h.startSession(c, user)
+}
+
+// OIDCLogin godoc
+// @Summary Start OIDC login
+// @Description Redirects to the login page of the configured OpenID Connect identity provider
+// @Tags auth
+// @Success 302 "Redirect to the identity provider"
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /auth/oidc/login [get]
+func (h *AuthHandler) OIDCLogin(c echo.Context) error {
+	if h.oidcProvider == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "OIDC login is not configured"})
+	}
+	if !auth.CanSign() {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "AUTH_SECRET is not set, OIDC login state cannot be signed"})
+	}
+
+	redirectURL, stateCookie, err := auth.BeginOIDCLogin(c.Request().Context(), h.oidcProvider)
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     auth.OIDCStateCookie,
+		Value:    stateCookie,
+		Path:     "/api/auth/oidc",
+		Expires:  time.Now().Add(10 * time.Minute),
+		HttpOnly: true,
+		Secure:   c.Scheme() == "https",
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return c.Redirect(http.StatusFound, redirectURL)
+}
+
+// OIDCCallback godoc
+// @Summary Complete OIDC login
+// @Description Handles the redirect from the identity provider, provisions the user and issues a bearer token
+// @Tags auth
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "Login state"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /auth/oidc/callback [get]
+func (h *AuthHandler) OIDCCallback(c echo.Context) error {
+	if h.oidcProvider == nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "OIDC login is not configured"})
+	}
+
+	if errorCode := c.QueryParam("error"); errorCode != "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": errorCode + ": " + c.QueryParam("error_description")})
+	}
+
+	cookie, err := c.Cookie(auth.OIDCStateCookie)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing login state"})
+	}
+
+	user, err := auth.CompleteOIDCLogin(c.Request().Context(), h.oidcProvider, c.QueryParam("code"), c.QueryParam("state"), cookie.Value)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	}
+
+	return h.startSession(c, user)
+}
+
+// Me godoc
+// @Summary Get current user
+// @Description Returns the authenticated user
+// @Tags auth
+// @Produce json
+// @Success 200 {object} models.User
+// @Failure 401 {object} map[string]string
+// @Router /auth/me [get]
+func (h *AuthHandler) Me(c echo.Context) error {
+	return c.JSON(http.StatusOK, auth.CurrentUser(c))
+}
+
+// Refresh godoc
+// @Summary Refresh tokens
+// @Description Exchanges a refresh token for a new access/refresh token pair. Refresh tokens are single-use; reusing one revokes the session.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body RefreshRequest true "Refresh token"
+// @Success 200 {object} LoginResponse
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /auth/refresh [post]
+func (h *AuthHandler) Refresh(c echo.Context) error {
+	var request RefreshRequest
+	if err := c.Bind(&request); err != nil || request.RefreshToken == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "refresh_token is required"})
+	}
+
+	pair, err := auth.Refresh(request.RefreshToken)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, LoginResponse{TokenPair: *pair})
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description Revokes the session of the current access token
+// @Tags auth
+// @Success 204 "No Content"
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/logout [post]
+func (h *AuthHandler) Logout(c echo.Context) error {
+	session := auth.CurrentSession(c)
+	if session == nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Authentication required"})
+	}
+
+	if err := auth.RevokeSession(session.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// LogoutAll godoc
+// @Summary Log out everywhere
+// @Description Revokes all sessions of the current user
+// @Tags auth
+// @Success 204 "No Content"
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/logout-all [post]
+func (h *AuthHandler) LogoutAll(c echo.Context) error {
+	if err := auth.RevokeUserSessions(auth.CurrentUser(c).ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// Sessions godoc
+// @Summary List sessions
+// @Description Returns the active sessions of the current user
+// @Tags auth
+// @Produce json
+// @Success 200 {array} models.Session
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /auth/sessions [get]
+func (h *AuthHandler) Sessions(c echo.Context) error {
+	sessions, err := auth.ActiveSessions(auth.CurrentUser(c).ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, sessions)
+}
+
+// Introspect godoc
+// @Summary Introspect an access token
+// @Description Reports whether an access token is active and whom it belongs to. Requires the internal API service token.
+// @Tags internal
+// @Accept json
+// @Produce json
+// @Param request body IntrospectRequest true "Token to introspect"
+// @Success 200 {object} auth.Introspection
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /internal/introspect [post]
+func (h *AuthHandler) Introspect(c echo.Context) error {
+	var request IntrospectRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, auth.Introspect(request.Token))
+}
+
+// startSession creates a session for the user and responds with its tokens
+func (h *AuthHandler) startSession(c echo.Context, user *models.User) error {
+	pair, err := auth.StartSession(user, c.Request().UserAgent(), c.RealIP())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, LoginResponse{TokenPair: *pair, User: user})
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// badgeColors are the colors of the status badges by status
+var badgeColors = map[string]string{
+	models.WorkflowPassing: "#4c1",
+	models.WorkflowFailing: "#e05d44",
+	models.WorkflowUnknown: "#9f9f9f",
+}
+
+// BadgeHandler manages the HTTP requests for the public status badges of workflows
+type BadgeHandler struct{}
+
+// NewBadgeHandler creates a new BadgeHandler
+func NewBadgeHandler() *BadgeHandler {
+	return &BadgeHandler{}
+}
+
+// GetBadge godoc
+// @Summary Get the status badge of a workflow
+// @Description Returns the token and public URLs of the workflow's status badge
+// @Tags workflows
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Success 200 {object} models.StatusBadge
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /workflows/{id}/status-badge [get]
+func (h *BadgeHandler) GetBadge(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var badge models.StatusBadge
+	if err := database.DB.Where("workflow_id = ?", id).First(&badge).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow has no status badge"})
+	}
+	setBadgeURLs(&badge)
+	return c.JSON(http.StatusOK, badge)
+}
+
+// CreateBadge godoc
+// @Summary Create the status badge of a workflow
+// @Description Publishes the last-run status of a workflow as JSON and as an SVG badge at URLs containing a new token, which can be opened without authentication. An existing badge gets a new token, the old URLs stop working.
+// @Tags workflows
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Success 201 {object} models.StatusBadge
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/status-badge [post]
+func (h *BadgeHandler) CreateBadge(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	// Published versions share the status of their workflow
+	var workflow models.Workflow
+	if err := database.DB.Where("parent_id IS NULL").First(&workflow, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	var badge models.StatusBadge
+	err = database.DB.Where("workflow_id = ?", workflow.ID).First(&badge).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	badge.WorkflowID = workflow.ID
+	badge.Token = hex.EncodeToString(token)
+	if user := auth.CurrentUser(c); user != nil {
+		badge.CreatedBy = user.ID
+	}
+	if err := database.DB.Save(&badge).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	setBadgeURLs(&badge)
+	return c.JSON(http.StatusCreated, badge)
+}
+
+// DeleteBadge godoc
+// @Summary Delete the status badge of a workflow
+// @Description Stops publishing the status of a workflow, its badge URLs stop working
+// @Tags workflows
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/status-badge [delete]
+func (h *BadgeHandler) DeleteBadge(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	if err := database.DB.Where("workflow_id = ?", id).Delete(&models.StatusBadge{}).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetStatus godoc
+// @Summary Get the public status of a workflow
+// @Description Returns the last-run status of the workflow of a status badge, without authentication
+// @Tags workflows
+// @Produce json
+// @Param token path string true "Token of the status badge"
+// @Success 200 {object} models.WorkflowStatus
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /status/{token} [get]
+func (h *BadgeHandler) GetStatus(c echo.Context) error {
+	status, err := workflowStatus(c.Param("token"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Status not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	c.Response().Header().Set("Cache-Control", "no-cache")
+	return c.JSON(http.StatusOK, status)
+}
+
+// GetBadgeSVG godoc
+// @Summary Get the status badge of a workflow as SVG
+// @Description Returns an SVG badge like "nightly sync: passing" for the workflow of a status badge, without authentication, to embed in wikis and READMEs
+// @Tags workflows
+// @Produce image/svg+xml
+// @Param token path string true "Token of the status badge"
+// @Param label query string false "Label of the badge (default the workflow name)"
+// @Success 200 {string} string "SVG badge"
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /status/{token}/badge.svg [get]
+func (h *BadgeHandler) GetBadgeSVG(c echo.Context) error {
+	status, err := workflowStatus(c.Param("token"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Status not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	label := c.QueryParam("label")
+	if label == "" {
+		label = status.Workflow
+	}
+
+	// Image proxies of wikis and code hosts would serve a stale status for long otherwise
+	c.Response().Header().Set("Cache-Control", "no-cache, max-age=0")
+	return c.Blob(http.StatusOK, "image/svg+xml", []byte(badgeSVG(label, status.Status, badgeColors[status.Status])))
+}
+
+// workflowStatus returns the status of the workflow of a status badge. Executions of published
+// versions count for their workflow.
+func workflowStatus(token string) (*models.WorkflowStatus, error) {
+	if token == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	var badge models.StatusBadge
+	if err := database.Replica().Where("token = ?", token).First(&badge).Error; err != nil {
+		return nil, err
+	}
+	var workflow models.Workflow
+	if err := database.Replica().First(&workflow, badge.WorkflowID).Error; err != nil {
+		return nil, err
+	}
+
+	status := &models.WorkflowStatus{Workflow: workflow.Name, Status: models.WorkflowUnknown}
+	executions := func() *gorm.DB {
+		return database.Replica().Model(&models.WorkflowExecution{}).
+			Where("workflow_id IN (?)", database.Replica().Model(&models.Workflow{}).Unscoped().
+				Select("id").Where("id = ? OR parent_id = ?", workflow.ID, workflow.ID))
+	}
+
+	var last models.WorkflowExecution
+	result := executions().Where("status IN ?", []string{"completed", "failed"}).
+		Order("completed_at DESC").Limit(1).Find(&last)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected > 0 {
+		status.Status = models.WorkflowPassing
+		if last.Status == "failed" {
+			status.Status = models.WorkflowFailing
+		}
+		status.LastExecutionID = last.ID
+		status.LastStartedAt = &last.StartedAt
+		status.LastCompletedAt = last.CompletedAt
+	}
+
+	var running int64
+	if err := executions().Where("status = ?", "running").Count(&running).Error; err != nil {
+		return nil, err
+	}
+	status.Running = running > 0
+
+	return status, nil
+}
+
+// setBadgeURLs sets the public URLs of a status badge
+func setBadgeURLs(badge *models.StatusBadge) {
+	base := strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/") + "/status/" + badge.Token
+	badge.StatusURL = base
+	badge.BadgeURL = base + "/badge.svg"
+}
+
+// badgeSVG renders a flat badge with the label on grey and the message on the color
+func badgeSVG(label, message, color string) string {
+	// Verdana 11px averages about 7px per character
+	labelWidth := utf8.RuneCountInString(label)*7 + 10
+	messageWidth := utf8.RuneCountInString(message)*7 + 10
+	width := labelWidth + messageWidth
+	label = html.EscapeString(label)
+	message = html.EscapeString(message)
+
+	return fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="20" role="img" aria-label="%[4]s: %[5]s">`+
+		`<title>%[4]s: %[5]s</title>`+
+		`<linearGradient id="s" x2="0" y2="100%%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>`+
+		`<clipPath id="r"><rect width="%[1]d" height="20" rx="3" fill="#fff"/></clipPath>`+
+		`<g clip-path="url(#r)"><rect width="%[2]d" height="20" fill="#555"/><rect x="%[2]d" width="%[3]d" height="20" fill="%[6]s"/><rect width="%[1]d" height="20" fill="url(#s)"/></g>`+
+		`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">`+
+		`<text x="%[7]d" y="14">%[4]s</text><text x="%[8]d" y="14">%[5]s</text></g></svg>`,
+		width, labelWidth, messageWidth, label, message, color, labelWidth/2, labelWidth+messageWidth/2)
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/altipard/flowcraft/internal/blob"
+	"github.com/labstack/echo/v4"
+)
+
+// BlobHandler manages the HTTP requests for binary payloads
+type BlobHandler struct{}
+
+// NewBlobHandler creates a new BlobHandler
+func NewBlobHandler() *BlobHandler {
+	return &BlobHandler{}
+}
+
+// Upload godoc
+// @Summary Upload a binary payload
+// @Description Stores an uploaded file and returns a blob reference that can be passed to workflow executions
+// @Tags blobs
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "File"
+// @Success 201 {object} blob.Ref
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /blobs [post]
+func (h *BlobHandler) Upload(c echo.Context) error {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "file is required"})
+	}
+	file, err := header.Open()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	defer file.Close()
+
+	ref, err := blob.Save(c.Request().Context(), header.Filename, header.Header.Get("Content-Type"), file)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, ref)
+}
+
+// Download godoc
+// @Summary Download a binary payload
+// @Description Returns the contents of a blob, e.g. an archive created by a compression node
+// @Tags blobs
+// @Produce octet-stream
+// @Param id path string true "Blob ID"
+// @Param name query string false "File name of the download"
+// @Success 200 {file} binary
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /blobs/{id} [get]
+func (h *BlobHandler) Download(c echo.Context) error {
+	r, err := blob.Open(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, blob.ErrNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Blob not found"})
+	} else if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	defer r.Close()
+
+	if name := c.QueryParam("name"); name != "" {
+		c.Response().Header().Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	}
+	return c.Stream(http.StatusOK, echo.MIMEOctetStream, r)
+}
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// CommentHandler manages the HTTP requests for comments on workflows and nodes
+type CommentHandler struct{}
+
+// NewCommentHandler creates a new CommentHandler
+func NewCommentHandler() *CommentHandler {
+	return &CommentHandler{}
+}
+
+// GetByWorkflowID godoc
+// @Summary Get comments of a workflow
+// @Description Returns the comments on a workflow and its nodes, oldest first
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Param node_id query int false "Only comments on this node"
+// @Param unresolved query bool false "Only unresolved comments"
+// @Success 200 {array} models.Comment
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/comments [get]
+func (h *CommentHandler) GetByWorkflowID(c echo.Context) error {
+	workflowID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+	}
+
+	query := database.DB.Where("workflow_id = ?", workflowID)
+	if nodeParam := c.QueryParam("node_id"); nodeParam != "" {
+		nodeID, err := strconv.Atoi(nodeParam)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid node_id"})
+		}
+		query = query.Where("node_id = ?", nodeID)
+	}
+	if c.QueryParam("unresolved") == "true" {
+		query = query.Where("NOT resolved")
+	}
+
+	var comments []models.Comment
+	if err := query.Order("id").Find(&comments).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, comments)
+}
+
+// Create godoc
+// @Summary Comment on a workflow
+// @Description Adds a comment to a workflow, or to one of its nodes if node_id is given
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Param comment body models.CommentRequest true "Comment"
+// @Success 201 {object} models.Comment
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/comments [post]
+func (h *CommentHandler) Create(c echo.Context) error {
+	workflowID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+	}
+
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, workflowID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+
+	var request models.CommentRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	body := strings.TrimSpace(request.Body)
+	if body == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "body is required"})
+	}
+	if request.NodeID != nil {
+		var count int64
+		database.DB.Model(&models.Node{}).Where("id = ? AND workflow_id = ?", *request.NodeID, workflow.ID).Count(&count)
+		if count == 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Node not found in workflow"})
+		}
+	}
+
+	comment := models.Comment{
+		WorkflowID: workflow.ID,
+		NodeID:     request.NodeID,
+		Body:       body,
+	}
+	if user := auth.CurrentUser(c); user != nil {
+		comment.UserID = user.ID
+	}
+	if err := database.DB.Create(&comment).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, comment)
+}
+
+// Update godoc
+// @Summary Update a comment
+// @Description Changes the body of a comment (only its author) or resolves and reopens it
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param id path int true "Comment ID"
+// @Param comment body models.CommentRequest true "New body and/or resolved state"
+// @Success 200 {object} models.Comment
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /comments/{id} [put]
+func (h *CommentHandler) Update(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var comment models.Comment
+	if err := database.DB.First(&comment, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Comment not found"})
+	}
+
+	var request models.CommentRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	user := auth.CurrentUser(c)
+	if body := strings.TrimSpace(request.Body); body != "" && body != comment.Body {
+		if user != nil && user.ID != comment.UserID {
+			return c.JSON(http.StatusForbidden, map[string]string{"error": "Only the author can edit a comment"})
+		}
+		comment.Body = body
+	}
+	if request.Resolved != nil && *request.Resolved != comment.Resolved {
+		comment.Resolved = *request.Resolved
+		comment.ResolvedBy = nil
+		comment.ResolvedAt = nil
+		if comment.Resolved {
+			now := time.Now()
+			comment.ResolvedAt = &now
+			if user != nil {
+				comment.ResolvedBy = &user.ID
+			}
+		}
+	}
+
+	if err := database.DB.Save(&comment).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, comment)
+}
+
+// Delete godoc
+// @Summary Delete a comment
+// @Description Deletes a comment; only its author and admins can delete it
+// @Tags comments
+// @Accept json
+// @Produce json
+// @Param id path int true "Comment ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /comments/{id} [delete]
+func (h *CommentHandler) Delete(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var comment models.Comment
+	if database.DB.Limit(1).Find(&comment, id).RowsAffected == 0 {
+		return c.NoContent(http.StatusNoContent)
+	}
+	if user := auth.CurrentUser(c); user != nil && user.ID != comment.UserID && user.Role != models.RoleAdmin {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Only the author or an admin can delete a comment"})
+	}
+
+	if err := database.DB.Delete(&models.Comment{}, id).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -2,10 +2,12 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
 	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/graphcache"
 	"github.com/altipard/flowcraft/internal/models"
 	"github.com/labstack/echo/v4"
 )
@@ -70,6 +72,7 @@ func (h *ConnectionHandler) GetByID(c echo.Context) error {
 // @Success 201 {object} models.Connection
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Router /connections [post]
 func (h *ConnectionHandler) Create(c echo.Context) error {
 	connection := new(models.Connection)
@@ -77,9 +80,18 @@ func (h *ConnectionHandler) Create(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
+	if err := checkWorkflowEditable(connection.WorkflowID); err != nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+
+	if err := checkConnectionNodes(connection); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
 	if err := database.DB.Create(connection).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	graphcache.InvalidateWorkflow(connection.WorkflowID)
 
 	return c.JSON(http.StatusCreated, connection)
 }
@@ -96,6 +108,7 @@ func (h *ConnectionHandler) Create(c echo.Context) error {
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Router /connections/{id} [put]
 func (h *ConnectionHandler) Update(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -107,18 +120,45 @@ func (h *ConnectionHandler) Update(c echo.Context) error {
 	if err := database.DB.First(&connection, id).Error; err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Connection not found"})
 	}
+	previousWorkflowID := connection.WorkflowID
 
 	if err := c.Bind(&connection); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
+	for _, workflowID := range []uint{previousWorkflowID, connection.WorkflowID} {
+		if err := checkWorkflowEditable(workflowID); err != nil {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+	}
+
+	if err := checkConnectionNodes(&connection); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
 	if err := database.DB.Save(&connection).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	graphcache.InvalidateWorkflow(previousWorkflowID)
+	if connection.WorkflowID != previousWorkflowID {
+		graphcache.InvalidateWorkflow(connection.WorkflowID)
+	}
 
 	return c.JSON(http.StatusOK, connection)
 }
 
+// checkConnectionNodes rejects connections from or to annotations, which are never executed
+func checkConnectionNodes(connection *models.Connection) error {
+	var count int64
+	database.DB.Model(&models.Node{}).
+		Where("id IN ? AND node_type = ?", []uint{connection.SourceNodeID, connection.TargetNodeID}, models.NodeTypeAnnotation).
+		Count(&count)
+	if count > 0 {
+		return errors.New("annotations cannot be connected")
+	}
+	return nil
+}
+
 // Delete godoc
 // @Summary Delete a connection
 // @Description Deletes a connection based on its ID
@@ -129,6 +169,7 @@ func (h *ConnectionHandler) Update(c echo.Context) error {
 // @Success 204 "No Content"
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Router /connections/{id} [delete]
 func (h *ConnectionHandler) Delete(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -136,9 +177,18 @@ func (h *ConnectionHandler) Delete(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
 	}
 
+	var connection models.Connection
+	if database.DB.Limit(1).Find(&connection, id).RowsAffected == 0 {
+		return c.NoContent(http.StatusNoContent)
+	}
+	if err := checkWorkflowEditable(connection.WorkflowID); err != nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+
 	if err := database.DB.Delete(&models.Connection{}, id).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	graphcache.InvalidateWorkflow(connection.WorkflowID)
 
 	return c.NoContent(http.StatusNoContent)
 }
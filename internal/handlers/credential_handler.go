@@ -0,0 +1,508 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/credentials"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/engine"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// CredentialHandler manages the HTTP requests for credentials
+type CredentialHandler struct{}
+
+// oauth2StateTTL limits how long users have to consent to the authorization of a credential
+const oauth2StateTTL = 15 * time.Minute
+
+// NewCredentialHandler creates a new CredentialHandler
+func NewCredentialHandler() *CredentialHandler {
+	return &CredentialHandler{}
+}
+
+// GetAll godoc
+// @Summary Get all credentials
+// @Description Returns the credentials of the current user's organization and the shared ones, without their secrets
+// @Tags credentials
+// @Accept json
+// @Produce json
+// @Success 200 {array} models.Credential
+// @Failure 500 {object} map[string]string
+// @Router /credentials [get]
+func (h *CredentialHandler) GetAll(c echo.Context) error {
+	var list []models.Credential
+	if err := credentialScope(c).Order("name").Find(&list).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	for i := range list {
+		list[i].Fields = credentials.FieldNames(&list[i])
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// GetByID godoc
+// @Summary Get credential by ID
+// @Description Returns a specific credential without its secrets
+// @Tags credentials
+// @Accept json
+// @Produce json
+// @Param id path int true "Credential ID"
+// @Success 200 {object} models.Credential
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /credentials/{id} [get]
+func (h *CredentialHandler) GetByID(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var credential models.Credential
+	if err := credentialScope(c).First(&credential, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Credential not found"})
+	}
+	credential.Fields = credentials.FieldNames(&credential)
+	return c.JSON(http.StatusOK, credential)
+}
+
+// Create godoc
+// @Summary Create a credential
+// @Description Stores the secrets of an external service encrypted, for use by nodes via credential_id. With external_ref instead of data, the secrets stay in the configured secrets manager.
+// @Tags credentials
+// @Accept json
+// @Produce json
+// @Param credential body models.CredentialRequest true "Credential data"
+// @Success 201 {object} models.Credential
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /credentials [post]
+func (h *CredentialHandler) Create(c echo.Context) error {
+	var request models.CredentialRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if request.Name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "name is required"})
+	}
+
+	credential := models.Credential{
+		Name:           request.Name,
+		CredentialType: request.CredentialType,
+	}
+	if request.ExternalRef != "" {
+		// The secret stays in the secrets manager, it is only checked here
+		if request.Data != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "data and external_ref are mutually exclusive"})
+		}
+		if err := credentials.CheckExternal(request.CredentialType, request.ExternalRef); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		credential.ExternalRef = request.ExternalRef
+	} else {
+		if err := credentials.Validate(request.CredentialType, request.Data); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		data, err := credentials.Encrypt(request.Data)
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		credential.Data = data
+	}
+	if err := applyCredentialTest(&credential, request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if user := auth.CurrentUser(c); user != nil {
+		credential.CreatedBy = user.ID
+		credential.OrganizationID = user.OrganizationID
+	}
+
+	if err := database.DB.Create(&credential).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	credential.Fields = credentials.FieldNames(&credential)
+	return c.JSON(http.StatusCreated, credential)
+}
+
+// Update godoc
+// @Summary Update a credential
+// @Description Renames a credential and/or replaces its secrets. Omitted data keeps the stored secrets.
+// @Tags credentials
+// @Accept json
+// @Produce json
+// @Param id path int true "Credential ID"
+// @Param credential body models.CredentialRequest true "Updated credential data"
+// @Success 200 {object} models.Credential
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /credentials/{id} [put]
+func (h *CredentialHandler) Update(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var credential models.Credential
+	if err := credentialScope(c).First(&credential, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Credential not found"})
+	}
+
+	var request models.CredentialRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if request.Name != "" {
+		credential.Name = request.Name
+	}
+	if err := applyCredentialTest(&credential, request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if request.ExternalRef != "" && request.Data != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "data and external_ref are mutually exclusive"})
+	}
+	if request.ExternalRef != "" {
+		if err := credentials.CheckExternal(credential.CredentialType, request.ExternalRef); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		credential.ExternalRef = request.ExternalRef
+		credential.Data = ""
+	}
+	if request.Data != nil {
+		credential.ExternalRef = ""
+		if err := credentials.Validate(credential.CredentialType, request.Data); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		if credential.Data, err = credentials.Encrypt(request.Data); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		// Replacing the data of an OAuth2 credential drops its tokens, it has to be authorized again
+		credential.AuthorizedAt = nil
+		credential.GrantedScopes = ""
+		credential.TokenExpiresAt = nil
+	}
+
+	if err := database.DB.Save(&credential).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	credential.Fields = credentials.FieldNames(&credential)
+	return c.JSON(http.StatusOK, credential)
+}
+
+// Delete godoc
+// @Summary Delete a credential
+// @Description Deletes a credential, nodes using it fail until they are given another one
+// @Tags credentials
+// @Accept json
+// @Produce json
+// @Param id path int true "Credential ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /credentials/{id} [delete]
+func (h *CredentialHandler) Delete(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var credential models.Credential
+	if err := credentialScope(c).First(&credential, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Credential not found"})
+	}
+
+	if err := database.DB.Delete(&credential).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetUsages godoc
+// @Summary Get credential usages
+// @Description Returns the nodes of workflows and their published versions that reference the credential by credential_id
+// @Tags credentials
+// @Accept json
+// @Produce json
+// @Param id path int true "Credential ID"
+// @Success 200 {array} models.CredentialUsage
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /credentials/{id}/usages [get]
+func (h *CredentialHandler) GetUsages(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var credential models.Credential
+	if err := credentialScope(c).First(&credential, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Credential not found"})
+	}
+
+	usages, err := credentials.Usages(credential.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, usages)
+}
+
+// Rotate godoc
+// @Summary Rotate a credential
+// @Description Replaces the secrets of a credential. With validate, the credential's test node runs with the new secrets first and they are only stored if it succeeds.
+// @Tags credentials
+// @Accept json
+// @Produce json
+// @Param id path int true "Credential ID"
+// @Param rotation body models.CredentialRotationRequest true "New secrets"
+// @Success 200 {object} models.CredentialRotation
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 422 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /credentials/{id}/rotate [post]
+func (h *CredentialHandler) Rotate(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var credential models.Credential
+	if err := credentialScope(c).First(&credential, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Credential not found"})
+	}
+
+	if credential.ExternalRef != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "credential is kept in the secrets manager, rotate it there"})
+	}
+
+	var request models.CredentialRotationRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := credentials.Validate(credential.CredentialType, request.Data); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	rotation := models.CredentialRotation{}
+	if request.Validate {
+		if credential.TestNodeType == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "credential has no test_node_type to validate with"})
+		}
+		output, err := engine.TestCredential(credential, request.Data)
+		if err != nil {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]string{"error": "connection test failed, the secrets were not changed: " + err.Error()})
+		}
+		rotation.Validated = true
+		rotation.TestOutput = output
+	}
+
+	if credential.Data, err = credentials.Encrypt(request.Data); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	now := time.Now()
+	credential.RotatedAt = &now
+	if err := database.DB.Save(&credential).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	actor := "anonymous"
+	if user := auth.CurrentUser(c); user != nil {
+		actor = user.Email
+	}
+	log.Printf("Credential %d rotated by %s (validated: %t)", credential.ID, actor, rotation.Validated)
+
+	credential.Fields = credentials.FieldNames(&credential)
+	rotation.Credential = credential
+	return c.JSON(http.StatusOK, rotation)
+}
+
+// Test godoc
+// @Summary Test a credential
+// @Description Checks that the stored secrets of a credential work. Credentials with a test node run it; otherwise Jira and GitHub credentials fetch the authenticated user and bearer, basic and api_key credentials send a GET request to the given url. The result reports failures of the check with diagnostics.
+// @Tags credentials
+// @Accept json
+// @Produce json
+// @Param id path int true "Credential ID"
+// @Param test body models.CredentialTestRequest false "URL to test bearer, basic and api_key credentials against"
+// @Success 200 {object} models.CredentialTestResult
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /credentials/{id}/test [post]
+func (h *CredentialHandler) Test(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var credential models.Credential
+	if err := credentialScope(c).First(&credential, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Credential not found"})
+	}
+
+	var request models.CredentialTestRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// Resolving refreshes the access token of OAuth2 credentials, which is part of the test
+	data, err := credentials.Resolve(credential.ID, credential.OrganizationID, "")
+	if err != nil {
+		if errors.Is(err, credentials.ErrNotAuthorized) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, models.CredentialTestResult{Method: credential.CredentialType, Message: err.Error()})
+	}
+
+	// A configured test node knows the service best, unless a URL is given explicitly
+	if credential.TestNodeType != "" && request.URL == "" {
+		result := models.CredentialTestResult{Method: "test_node"}
+		start := time.Now()
+		output, err := engine.TestCredential(credential, data)
+		result.DurationMs = time.Since(start).Milliseconds()
+		if err != nil {
+			result.Message = fmt.Sprintf("test node %s failed: %v", credential.TestNodeType, err)
+		} else {
+			result.Success = true
+			result.Message = fmt.Sprintf("test node %s succeeded", credential.TestNodeType)
+			result.Details = output
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+
+	result, err := credentials.Verify(c.Request().Context(), credential, data, request)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, result)
+}
+
+// OAuth2Authorize godoc
+// @Summary Start the authorization of an OAuth2 credential
+// @Description Returns the URL of the provider's consent page for an oauth2_authcode credential. After the user consents, the provider redirects to /auth/oauth2/callback, which stores the tokens on the credential.
+// @Tags credentials
+// @Produce json
+// @Param id path int true "Credential ID"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /credentials/{id}/oauth2/authorize [get]
+func (h *CredentialHandler) OAuth2Authorize(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+	if !auth.CanSign() {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "AUTH_SECRET is not set, the authorization state cannot be signed"})
+	}
+
+	var credential models.Credential
+	if err := credentialScope(c).First(&credential, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Credential not found"})
+	}
+
+	// The callback is not authenticated, the signed state tells it which credential was authorized.
+	// Its nonce is stored and consumed by the callback, so that each state is accepted once.
+	nonceBytes := make([]byte, 16)
+	if _, err := rand.Read(nonceBytes); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	nonce := hex.EncodeToString(nonceBytes)
+	expiresAt := time.Now().Add(oauth2StateTTL)
+	state := auth.SignValue(fmt.Sprintf("%d|%s", credential.ID, nonce), expiresAt)
+
+	authorizationURL, err := credentials.AuthorizationURL(credential, state)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := credentials.SaveAuthorizationState(credential.ID, nonce, expiresAt); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]string{"authorization_url": authorizationURL})
+}
+
+// OAuth2Callback godoc
+// @Summary Complete the authorization of an OAuth2 credential
+// @Description Handles the redirect from the OAuth2 provider and stores the tokens on the credential. missing_scopes lists the requested scopes the user did not grant.
+// @Tags credentials
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State returned by /credentials/{id}/oauth2/authorize"
+// @Success 200 {object} models.OAuth2Authorization
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 502 {object} map[string]string
+// @Router /auth/oauth2/callback [get]
+func (h *CredentialHandler) OAuth2Callback(c echo.Context) error {
+	if errorCode := c.QueryParam("error"); errorCode != "" {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": errorCode + ": " + c.QueryParam("error_description")})
+	}
+
+	payload, err := auth.VerifyValue(c.QueryParam("state"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid authorization state: " + err.Error()})
+	}
+	idValue, nonce, _ := strings.Cut(payload, "|")
+	id, err := strconv.Atoi(idValue)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid authorization state"})
+	}
+	if c.QueryParam("code") == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "code is required"})
+	}
+	if err := credentials.ConsumeAuthorizationState(uint(id), nonce); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid authorization state: " + err.Error()})
+	}
+
+	result, err := credentials.CompleteAuthorization(c.Request().Context(), uint(id), c.QueryParam("code"))
+	if err != nil {
+		return c.JSON(http.StatusBadGateway, map[string]string{"error": err.Error()})
+	}
+	log.Printf("Credential %d authorized with scopes %q", result.Credential.ID, result.Credential.GrantedScopes)
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// applyCredentialTest sets the test node of the credential from the request, if given
+func applyCredentialTest(credential *models.Credential, request models.CredentialRequest) error {
+	if request.TestNodeType != "" {
+		if err := engine.ValidateCredentialTest(request.TestNodeType); err != nil {
+			return err
+		}
+		credential.TestNodeType = request.TestNodeType
+	}
+	if request.TestConfig != "" {
+		var config map[string]interface{}
+		if err := json.Unmarshal([]byte(request.TestConfig), &config); err != nil {
+			return fmt.Errorf("test_config must be a JSON object: %v", err)
+		}
+		credential.TestConfig = request.TestConfig
+	}
+	return nil
+}
+
+// credentialScope limits credential queries to the current user's organization and shared credentials
+func credentialScope(c echo.Context) *gorm.DB {
+	query := database.DB.Model(&models.Credential{})
+	if user := auth.CurrentUser(c); user != nil && user.OrganizationID != 0 {
+		query = query.Where("organization_id IN ?", []uint{0, user.OrganizationID})
+	}
+	return query
+}
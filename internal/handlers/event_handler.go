@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/events"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/schemas"
+	"github.com/labstack/echo/v4"
+)
+
+// EventHandler manages the HTTP requests for events
+type EventHandler struct{}
+
+// NewEventHandler creates a new EventHandler
+func NewEventHandler() *EventHandler {
+	return &EventHandler{}
+}
+
+// EmitEventRequest represents the input data for emitting an event
+type EmitEventRequest struct {
+	Name    string                 `json:"name"`
+	Payload map[string]interface{} `json:"payload"`
+}
+
+// GetAll godoc
+// @Summary Get events
+// @Description Returns the event log, newest first
+// @Tags events
+// @Accept json
+// @Produce json
+// @Param name query string false "Filter by event name"
+// @Param limit query int false "Maximum number of events (default 100)"
+// @Success 200 {array} models.Event
+// @Failure 500 {object} map[string]string
+// @Router /events [get]
+func (h *EventHandler) GetAll(c echo.Context) error {
+	limit := 100
+	if value, err := strconv.Atoi(c.QueryParam("limit")); err == nil && value > 0 && value <= 1000 {
+		limit = value
+	}
+
+	query := database.Replica().Order("id DESC").Limit(limit)
+	if name := c.QueryParam("name"); name != "" {
+		query = query.Where("name = ?", name)
+	}
+
+	var eventLog []models.Event
+	if err := query.Find(&eventLog).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, eventLog)
+}
+
+// Emit godoc
+// @Summary Emit an event
+// @Description Emits an event from an external system, resuming executions waiting for it. Payloads of events with a registered schema must match its latest version.
+// @Tags events
+// @Accept json
+// @Produce json
+// @Param event body EmitEventRequest true "Event"
+// @Success 201 {object} models.Event
+// @Failure 400 {object} map[string]string
+// @Failure 422 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Router /events [post]
+func (h *EventHandler) Emit(c echo.Context) error {
+	var request EmitEventRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if request.Name == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "name is required"})
+	}
+	if request.Payload == nil {
+		request.Payload = make(map[string]interface{})
+	}
+
+	event, err := events.Emit(request.Name, request.Payload, nil)
+	var invalid *schemas.InvalidPayloadError
+	if errors.As(err, &invalid) {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{"error": err.Error(), "problems": invalid.Problems})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, event)
+}
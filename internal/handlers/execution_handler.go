@@ -1,26 +1,37 @@
 package handlers
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/altipard/flowcraft/internal/archive"
 	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/dispatch"
+	"github.com/altipard/flowcraft/internal/engine"
+	"github.com/altipard/flowcraft/internal/ingest"
+	"github.com/altipard/flowcraft/internal/lineage"
 	"github.com/altipard/flowcraft/internal/models"
 	"github.com/altipard/flowcraft/internal/queue"
+	"github.com/altipard/flowcraft/internal/quota"
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 // ExecutionHandler manages the HTTP requests for workflow executions
 type ExecutionHandler struct {
 	queueClient *queue.QueueClient
+	dispatcher  *dispatch.Dispatcher
 }
 
 // NewExecutionHandler creates a new ExecutionHandler
 func NewExecutionHandler(queueClient *queue.QueueClient) *ExecutionHandler {
 	return &ExecutionHandler{
 		queueClient: queueClient,
+		dispatcher:  dispatch.NewDispatcher(queueClient),
 	}
 }
 
@@ -31,13 +42,41 @@ func NewExecutionHandler(queueClient *queue.QueueClient) *ExecutionHandler {
 // @Accept json
 // @Produce json
 // @Param id path int true "Workflow ID"
+// @Param on_success query string false "Comma separated IDs of workflows to run one after another on success, each with the output of the previous execution as input"
 // @Param inputData body object false "Input data for workflow execution"
 // @Success 202 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
+// @Failure 402 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 429 {object} map[string]string
 // @Failure 500 {object} map[string]string
 // @Router /workflows/{id}/execute [post]
 func (h *ExecutionHandler) ExecuteWorkflow(c echo.Context) error {
+	return h.execute(c, false)
+}
+
+// ProfileWorkflow godoc
+// @Summary Execute a workflow with profiling
+// @Description Executes a workflow like /workflows/{id}/execute and records the time and allocation breakdown of each node, see /executions/{id}/profile
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Param on_success query string false "Comma separated IDs of workflows to run one after another on success, each with the output of the previous execution as input"
+// @Param inputData body object false "Input data for workflow execution"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 402 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/profile [post]
+func (h *ExecutionHandler) ProfileWorkflow(c echo.Context) error {
+	return h.execute(c, true)
+}
+
+// execute starts an execution of the workflow in the request, optionally profiled
+func (h *ExecutionHandler) execute(c echo.Context, profile bool) error {
 	workflowID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
@@ -56,43 +95,486 @@ func (h *ExecutionHandler) ExecuteWorkflow(c echo.Context) error {
 		inputData = make(map[string]interface{})
 	}
 
-	// Create workflow execution
-	execution := models.WorkflowExecution{
-		WorkflowID: uint(workflowID),
-		Status:     "pending",
-		StartedAt:  time.Now(),
+	// Workflows to run after the execution completes
+	chain, err := dispatch.ParseChain(c.QueryParam("on_success"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid on_success, expected comma separated workflow IDs"})
+	}
+	for _, id := range chain {
+		var count int64
+		database.DB.Model(&models.Workflow{}).Where("id = ?", id).Count(&count)
+		if count == 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Chained workflow %d not found", id)})
+		}
 	}
 
-	// Save input data as JSON
-	inputJSON, _ := json.Marshal(inputData)
-	execution.InputData = string(inputJSON)
-
-	if err := database.DB.Create(&execution).Error; err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	// Create and queue the workflow execution
+	var execution *models.WorkflowExecution
+	if profile {
+		execution, err = h.dispatcher.DispatchProfiled(workflow, inputData, chain)
+	} else {
+		execution, err = h.dispatcher.DispatchChained(workflow, inputData, chain)
+	}
+	if err != nil {
+		return dispatchErrorResponse(c, err)
 	}
 
-	// Queue asynchronous execution
-	err = h.queueClient.EnqueueTask("workflow_tasks", "execute_workflow", map[string]interface{}{
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
 		"execution_id": execution.ID,
+		"status":       "pending",
 	})
+}
+
+// maxBatchItems limits the number of inputs of a batch execution
+const maxBatchItems = 1000
 
+// ExecuteBatch godoc
+// @Summary Execute a workflow for many inputs
+// @Description Creates one execution per input object, or with mode=single one execution receiving all inputs as "items". Returns the execution IDs and a batch ID for tracking the aggregate status.
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Param mode query string false "per_item (default) or single"
+// @Param items body []object true "Input data, one object per item"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 402 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/execute-batch [post]
+func (h *ExecutionHandler) ExecuteBatch(c echo.Context) error {
+	workflowID, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+	}
+
+	mode := c.QueryParam("mode")
+	if mode == "" {
+		mode = "per_item"
+	}
+	if mode != "per_item" && mode != "single" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "mode must be per_item or single"})
+	}
+
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, workflowID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+
+	var items []map[string]interface{}
+	if err := c.Bind(&items); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Request body must be an array of input objects"})
+	}
+	if len(items) == 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "At least one input is required"})
+	}
+	if len(items) > maxBatchItems {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("A batch can have at most %d inputs", maxBatchItems)})
+	}
+
+	batch, executions, err := h.dispatcher.DispatchBatch(workflow, items, mode)
+	if err != nil && batch == nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	if err != nil && len(executions) == 0 {
+		return dispatchErrorResponse(c, err)
+	}
 
-	return c.JSON(http.StatusAccepted, map[string]interface{}{
-		"execution_id": execution.ID,
-		"status":       "pending",
+	executionIDs := make([]uint, len(executions))
+	for i, execution := range executions {
+		executionIDs[i] = execution.ID
+	}
+
+	response := map[string]interface{}{
+		"batch_id":      batch.ID,
+		"mode":          batch.Mode,
+		"execution_ids": executionIDs,
+		"status":        "pending",
+	}
+	// Partially dispatched batches report why the remaining inputs were not executed
+	if err != nil {
+		response["error"] = err.Error()
+	}
+
+	return c.JSON(http.StatusAccepted, response)
+}
+
+// Defaults and limits of streamed executions
+const (
+	defaultStreamChunkSize  = 1000
+	maxStreamChunkSize      = 10000
+	defaultStreamMaxPending = 10
+	streamBackpressureDelay = 500 * time.Millisecond
+)
+
+// ExecuteStream godoc
+// @Summary Execute a workflow over a streamed dataset
+// @Description Reads an NDJSON or CSV upload record by record and dispatches one execution per chunk of records, receiving the chunk as "items". Reading pauses while max_pending executions of the upload are waiting to be processed.
+// @Tags executions
+// @Accept plain
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Param format query string false "ndjson or csv (defaults to the Content-Type: application/x-ndjson or text/csv)"
+// @Param chunk_size query int false "Records per execution (default 1000)"
+// @Param max_pending query int false "Maximum number of queued executions before reading pauses (default 10)"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 402 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 429 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/execute-stream [post]
+func (h *ExecutionHandler) ExecuteStream(c echo.Context) error {
+	workflowID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+	}
+
+	format := c.QueryParam("format")
+	if format == "" {
+		format = ingest.FormatFromContentType(c.Request().Header.Get(echo.HeaderContentType))
+	}
+	if format == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Unknown format, use format=ndjson or format=csv"})
+	}
+
+	chunkSize := defaultStreamChunkSize
+	if value := c.QueryParam("chunk_size"); value != "" {
+		chunkSize, err = strconv.Atoi(value)
+		if err != nil || chunkSize < 1 || chunkSize > maxStreamChunkSize {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("chunk_size must be between 1 and %d", maxStreamChunkSize)})
+		}
+	}
+
+	maxPending := defaultStreamMaxPending
+	if value := c.QueryParam("max_pending"); value != "" {
+		maxPending, err = strconv.Atoi(value)
+		if err != nil || maxPending < 1 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "max_pending must be a positive number"})
+		}
+	}
+
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, workflowID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+
+	reader, err := ingest.NewReader(format, c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	batch, err := h.dispatcher.CreateBatch(workflow, "stream", 0)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	ctx := c.Request().Context()
+	records := 0
+	var executionIDs []uint
+	var chunk []interface{}
+
+	// dispatchChunk waits until the workers caught up and dispatches the current chunk
+	dispatchChunk := func() error {
+		for pendingBatchExecutions(batch.ID) >= int64(maxPending) {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(streamBackpressureDelay):
+			}
+		}
+
+		execution, err := h.dispatcher.DispatchToBatch(workflow, map[string]interface{}{"items": chunk}, batch)
+		if err != nil {
+			return err
+		}
+		executionIDs = append(executionIDs, execution.ID)
+		chunk = nil
+		return nil
+	}
+
+	for {
+		var record map[string]interface{}
+		record, err = reader.Next()
+		if err == io.EOF {
+			err = nil
+			if len(chunk) > 0 {
+				err = dispatchChunk()
+			}
+			break
+		}
+		if err != nil {
+			err = fmt.Errorf("failed to read record %d: %v", records+1, err)
+			break
+		}
+
+		records++
+		chunk = append(chunk, record)
+		if len(chunk) >= chunkSize {
+			if err = dispatchChunk(); err != nil {
+				break
+			}
+		}
+	}
+
+	batch.ItemCount = records
+	database.DB.Model(batch).Update("item_count", records)
+
+	if err != nil && len(executionIDs) == 0 {
+		var quotaErr *quota.ExceededError
+		if errors.As(err, &quotaErr) {
+			return dispatchErrorResponse(c, err)
+		}
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	response := map[string]interface{}{
+		"batch_id":      batch.ID,
+		"mode":          batch.Mode,
+		"records":       records,
+		"execution_ids": executionIDs,
+		"status":        "pending",
+	}
+	// Partially dispatched uploads report why the remaining records were not executed
+	if err != nil {
+		response["error"] = err.Error()
+	}
+
+	return c.JSON(http.StatusAccepted, response)
+}
+
+// pendingBatchExecutions counts the executions of a batch not yet picked up or still running
+func pendingBatchExecutions(batchID uint) int64 {
+	var count int64
+	database.DB.Model(&models.WorkflowExecution{}).
+		Where("batch_id = ? AND status IN ?", batchID, []string{"pending", "running"}).
+		Count(&count)
+	return count
+}
+
+// GetBatchStatus godoc
+// @Summary Get batch status
+// @Description Returns the aggregate status of the executions of a batch
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Batch ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /batches/{id} [get]
+func (h *ExecutionHandler) GetBatchStatus(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var batch models.ExecutionBatch
+	if err := database.DB.First(&batch, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Batch not found"})
+	}
+
+	var executions []models.WorkflowExecution
+	if err := database.DB.Select("id", "status").Where("batch_id = ?", batch.ID).Order("id").Find(&executions).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	counts := make(map[string]int)
+	executionIDs := make([]uint, len(executions))
+	for i, execution := range executions {
+		counts[execution.Status]++
+		executionIDs[i] = execution.ID
+	}
+
+	// The batch is finished once no execution is pending, running or waiting
+	status := "completed"
+	switch {
+	case counts["pending"]+counts["running"]+counts["waiting"] > 0:
+		status = "running"
+	case counts["failed"] > 0:
+		status = "failed"
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"id":            batch.ID,
+		"workflow_id":   batch.WorkflowID,
+		"mode":          batch.Mode,
+		"item_count":    batch.ItemCount,
+		"status":        status,
+		"counts":        counts,
+		"execution_ids": executionIDs,
+		"created_at":    batch.CreatedAt,
 	})
 }
 
+// GetAll godoc
+// @Summary Get the execution history
+// @Description Returns executions without their input, output and node executions, newest first. Failed executions can be filtered by their triage status to find the failures nobody handled yet.
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param workflow_id query int false "Only executions of this workflow"
+// @Param status query string false "Only executions with this status, e.g. failed"
+// @Param triage_status query string false "Only executions with this triage status: acknowledged, ignored, fixed or untriaged for failed executions without one"
+// @Param since query string false "Only executions started after this time (RFC3339)"
+// @Param retry_of_id query int false "Only the automatic retry of this failed execution"
+// @Param before_id query int false "Only executions with a lower ID, to page through the history"
+// @Param limit query int false "Maximum number of executions (default 50, at most 500)"
+// @Success 200 {array} models.WorkflowExecution
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions [get]
+func (h *ExecutionHandler) GetAll(c echo.Context) error {
+	query := database.Replica().Omit(executionJSONColumns...)
+
+	limit := 50
+	if param := c.QueryParam("limit"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid limit, expected 1 to 500"})
+		}
+		limit = parsed
+	}
+	if param := c.QueryParam("workflow_id"); param != "" {
+		workflowID, err := strconv.Atoi(param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+		}
+		query = query.Where("workflow_id = ?", workflowID)
+	}
+	if param := c.QueryParam("retry_of_id"); param != "" {
+		retryOfID, err := strconv.Atoi(param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid retry_of_id"})
+		}
+		query = query.Where("retry_of_id = ?", retryOfID)
+	}
+	if param := c.QueryParam("before_id"); param != "" {
+		beforeID, err := strconv.Atoi(param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid before_id"})
+		}
+		query = query.Where("id < ?", beforeID)
+	}
+	if param := c.QueryParam("since"); param != "" {
+		since, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid since parameter, expected RFC3339"})
+		}
+		query = query.Where("started_at >= ?", since)
+	}
+	if status := c.QueryParam("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	switch triage := c.QueryParam("triage_status"); triage {
+	case "":
+	case "untriaged":
+		query = query.Where("status = ? AND (triage_status IS NULL OR triage_status = '')", "failed")
+	default:
+		if !validTriageStatus(triage) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid triage status %s", triage)})
+		}
+		query = query.Where("triage_status = ?", triage)
+	}
+
+	executions := []models.WorkflowExecution{}
+	if err := query.Order("id DESC").Limit(limit).Find(&executions).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, executions)
+}
+
+// GetByID godoc
+// @Summary Get an execution
+// @Description Returns a workflow execution with its input, output and node executions. Executions moved to the archive are loaded from it, which is slower; such responses carry a Warning header. With fields, only the given fields are returned, e.g. fields=status,output_data.summary.total; fields within the input and output are extracted by the database.
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Param fields query string false "Comma separated fields to return, as dot separated paths (numbers select array elements)"
+// @Success 200 {object} models.WorkflowExecution
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id} [get]
+func (h *ExecutionHandler) GetByID(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	fields, err := parseFields(c.QueryParam("fields"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// Projected payloads are extracted by the database instead of loading them
+	query := database.Replica()
+	if fields != nil {
+		query = query.Omit(executionJSONColumns...)
+	}
+	var execution models.WorkflowExecution
+	if err := query.First(&execution, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Execution not found"})
+	}
+
+	if execution.ArchivedAt != nil {
+		err = rehydrateExecution(c, &execution)
+	} else if fields == nil || requestsField(fields, "node_executions") {
+		err = database.Replica().Where("workflow_execution_id = ?", execution.ID).Order("id").
+			Find(&execution.NodeExecutions).Error
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	if fields == nil {
+		return c.JSON(http.StatusOK, execution)
+	}
+	return projectExecutionResponse(c, database.Replica(), &execution, execution, fields)
+}
+
+// projectExecutionResponse responds with the requested fields of the response for an execution,
+// extracting fields of its payloads with db
+func projectExecutionResponse(c echo.Context, db *gorm.DB, execution *models.WorkflowExecution, response interface{}, fields []fieldPath) error {
+	values, err := responseFields(response)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if field := unknownField(values, fields); field != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Unknown field %q", field)})
+	}
+	projected, err := projectExecution(db, execution.ID, execution.ArchivedAt != nil, values, fields)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, projected)
+}
+
+// rehydrateExecution loads the payloads and node executions of an archived execution from the
+// archive and warns the client that the access was slower
+func rehydrateExecution(c echo.Context, execution *models.WorkflowExecution) error {
+	if execution.ArchivedAt == nil {
+		return nil
+	}
+	if err := archive.Rehydrate(c.Request().Context(), execution); err != nil {
+		return err
+	}
+	c.Response().Header().Set("Warning", `199 flowcraft "Execution loaded from the archive, access is slower"`)
+	return nil
+}
+
 // GetStatus godoc
 // @Summary Get execution status
-// @Description Returns the status of a workflow execution
+// @Description Returns the status of a workflow execution. With fields, only the given fields are returned, e.g. fields=status,output_data.summary.total; fields within the output are extracted by the database.
 // @Tags executions
 // @Accept json
 // @Produce json
 // @Param id path int true "Execution ID"
+// @Param fields query string false "Comma separated fields to return, as dot separated paths (numbers select array elements)"
 // @Success 200 {object} map[string]interface{}
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
@@ -103,12 +585,24 @@ func (h *ExecutionHandler) GetStatus(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
 	}
 
+	fields, err := parseFields(c.QueryParam("fields"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	query := database.DB
+	if fields != nil {
+		query = query.Omit(executionJSONColumns...)
+	}
 	var execution models.WorkflowExecution
-	if err := database.DB.First(&execution, id).Error; err != nil {
+	if err := query.First(&execution, id).Error; err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Execution not found"})
 	}
+	if err := rehydrateExecution(c, &execution); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
 
-	return c.JSON(http.StatusOK, map[string]interface{}{
+	status := map[string]interface{}{
 		"id":            execution.ID,
 		"workflow_id":   execution.WorkflowID,
 		"status":        execution.Status,
@@ -116,5 +610,262 @@ func (h *ExecutionHandler) GetStatus(c echo.Context) error {
 		"completed_at":  execution.CompletedAt,
 		"error_message": execution.ErrorMessage,
 		"output_data":   execution.OutputData,
+	}
+	if fields != nil {
+		return projectExecutionResponse(c, database.DB, &execution, status, fields)
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+// GetChains godoc
+// @Summary Get execution chains
+// @Description Returns the workflows chained to an execution and the executions they started
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Success 200 {array} models.ExecutionChain
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id}/chains [get]
+func (h *ExecutionHandler) GetChains(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var chains []models.ExecutionChain
+	if err := database.DB.Where("workflow_execution_id = ?", id).Find(&chains).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, chains)
+}
+
+// GetProfile godoc
+// @Summary Get execution profile
+// @Description Returns the time and allocation breakdown per node of an execution started via /workflows/{id}/profile, slowest nodes first
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Success 200 {object} models.ExecutionProfile
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id}/profile [get]
+func (h *ExecutionHandler) GetProfile(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var execution models.WorkflowExecution
+	if err := database.DB.First(&execution, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Execution not found"})
+	}
+	if !execution.Profiling {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Execution was not profiled"})
+	}
+
+	profile := models.ExecutionProfile{
+		ExecutionID: execution.ID,
+		Status:      execution.Status,
+	}
+	if execution.CompletedAt != nil {
+		profile.DurationMs = execution.CompletedAt.Sub(execution.StartedAt).Milliseconds()
+	}
+	if err := database.DB.Where("workflow_execution_id = ?", execution.ID).
+		Order("total_us DESC").Find(&profile.Nodes).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	for _, node := range profile.Nodes {
+		profile.LoadUs += node.LoadUs
+		profile.PrepareUs += node.PrepareUs
+		profile.ExecuteUs += node.ExecuteUs
+		profile.PersistUs += node.PersistUs
+		profile.AllocBytes += node.AllocBytes
+		profile.Allocs += node.Allocs
+	}
+
+	return c.JSON(http.StatusOK, profile)
+}
+
+// GetLineage godoc
+// @Summary Get execution lineage
+// @Description Returns where the output fields of the nodes of an execution came from. With node_id, traces the output of that node (or one of its fields) back through the upstream nodes to the execution input.
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Param node_id query int false "Node whose output to trace"
+// @Param field query string false "Dotted path of the output field to trace, e.g. 0.contact.email"
+// @Success 200 {array} models.LineageEdge
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id}/lineage [get]
+func (h *ExecutionHandler) GetLineage(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var execution models.WorkflowExecution
+	if err := database.DB.First(&execution, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Execution not found"})
+	}
+
+	if nodeParam := c.QueryParam("node_id"); nodeParam != "" {
+		nodeID, err := strconv.Atoi(nodeParam)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid node_id"})
+		}
+		steps, err := lineage.Trace(execution.ID, uint(nodeID), c.QueryParam("field"))
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, steps)
+	}
+
+	var edges []models.LineageEdge
+	if err := database.DB.Where("workflow_execution_id = ?", execution.ID).Order("id").Find(&edges).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, edges)
+}
+
+// Restart godoc
+// @Summary Restart an execution
+// @Description Restarts a failed or interrupted execution from its last checkpoint. Completed nodes are not executed again; nodes interrupted while running are retried with the same idempotency key.
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id}/restart [post]
+func (h *ExecutionHandler) Restart(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var execution models.WorkflowExecution
+	if err := database.DB.First(&execution, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Execution not found"})
+	}
+
+	if execution.Status != "failed" && execution.Status != "running" {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Only failed or interrupted executions can be restarted"})
+	}
+	// Archived executions have no checkpoints in the database to continue from
+	if execution.ArchivedAt != nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Archived executions cannot be restarted"})
+	}
+
+	// The effects of compensated executions were undone, their checkpoints are no longer valid
+	var compensations int64
+	database.DB.Model(&models.NodeExecution{}).
+		Where("workflow_execution_id = ? AND compensated_node_id IS NOT NULL", execution.ID).
+		Count(&compensations)
+	if compensations > 0 {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Compensated executions cannot be restarted"})
+	}
+
+	if err := h.dispatcher.Restart(&execution); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"execution_id": execution.ID,
+		"status":       execution.Status,
 	})
 }
+
+// Cancel godoc
+// @Summary Cancel an execution
+// @Description Requests the cancellation of an unfinished execution. Held, queued and waiting executions are cancelled right away; running executions are stopped by their worker before the next node, the node running at that moment still finishes. Cancelled executions have the status cancelled, the nodes they did not reach are skipped. Completed nodes are not compensated.
+// @Tags executions
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id}/cancel [post]
+func (h *ExecutionHandler) Cancel(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var execution models.WorkflowExecution
+	if err := database.DB.First(&execution, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Execution not found"})
+	}
+
+	if execution.Status == "completed" || execution.Status == "failed" {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Only unfinished executions can be cancelled"})
+	}
+
+	// Repeated requests keep the time of the first one
+	finished := []string{"completed", "failed", engine.StatusCancelled}
+	err = database.DB.Model(&models.WorkflowExecution{}).
+		Where("id = ? AND status NOT IN ? AND cancel_requested_at IS NULL", execution.ID, finished).
+		Update("cancel_requested_at", time.Now()).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	// Executions no worker runs are cancelled here, the others by their worker
+	idle := []string{dispatch.StatusHeld, dispatch.StatusQueued, "waiting"}
+	result := database.DB.Model(&models.WorkflowExecution{}).
+		Where("id = ? AND status IN ?", execution.ID, idle).
+		Update("status", engine.StatusCancelled)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": result.Error.Error()})
+	}
+	if result.RowsAffected > 0 {
+		if err := engine.CancelExecution(execution.ID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+	}
+
+	if err := database.DB.First(&execution, id).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusAccepted, map[string]interface{}{
+		"execution_id":        execution.ID,
+		"status":              execution.Status,
+		"cancel_requested_at": execution.CancelRequestedAt,
+	})
+}
+
+// dispatchErrorResponse converts an error returned by the dispatcher into an HTTP response
+func dispatchErrorResponse(c echo.Context, err error) error {
+	return c.JSON(dispatchError(err))
+}
+
+// dispatchError returns the status and body of the response to an error returned by the
+// dispatcher. Concurrency limits are reported as 429, exhausted monthly or storage quotas as 402.
+func dispatchError(err error) (int, map[string]interface{}) {
+	var quotaErr *quota.ExceededError
+	if errors.As(err, &quotaErr) {
+		status := http.StatusPaymentRequired
+		if quotaErr.Quota == quota.ConcurrentExecutions {
+			status = http.StatusTooManyRequests
+		}
+		return status, map[string]interface{}{
+			"error":   quotaErr.Error(),
+			"quota":   quotaErr.Quota,
+			"limit":   quotaErr.Limit,
+			"current": quotaErr.Current,
+		}
+	}
+
+	return http.StatusInternalServerError, map[string]interface{}{"error": err.Error()}
+}
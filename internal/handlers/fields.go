@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// maxProjectedFields limits the number of fields requested with the fields parameter
+const maxProjectedFields = 20
+
+// executionJSONColumns are the jsonb columns of executions, whose fields are extracted in the
+// database so that large payloads are not loaded
+var executionJSONColumns = []string{"input_data", "output_data"}
+
+// fieldPath is a field of a response, given as dot separated path like output_data.summary.total.
+// Numbers select elements of arrays.
+type fieldPath []string
+
+// parseFields parses the comma separated fields parameter of the execution endpoints, nil if
+// all fields are requested
+func parseFields(param string) ([]fieldPath, error) {
+	if param == "" {
+		return nil, nil
+	}
+	var fields []fieldPath
+	for _, field := range strings.Split(param, ",") {
+		path := fieldPath(strings.Split(strings.TrimSpace(field), "."))
+		for _, segment := range path {
+			if segment == "" {
+				return nil, fmt.Errorf("Invalid field %q", field)
+			}
+		}
+		fields = append(fields, path)
+	}
+	if len(fields) > maxProjectedFields {
+		return nil, fmt.Errorf("At most %d fields can be requested", maxProjectedFields)
+	}
+	return fields, nil
+}
+
+// requestsField reports whether one of the fields is the top level field or lies within it
+func requestsField(fields []fieldPath, name string) bool {
+	for _, path := range fields {
+		if path[0] == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isExecutionJSONColumn reports whether the field is stored in a jsonb column of the execution
+func isExecutionJSONColumn(name string) bool {
+	for _, column := range executionJSONColumns {
+		if column == name {
+			return true
+		}
+	}
+	return false
+}
+
+// unknownField returns the first field whose top level field is not in the response, empty if
+// all are
+func unknownField(response map[string]interface{}, fields []fieldPath) string {
+	for _, path := range fields {
+		if _, ok := response[path[0]]; !ok {
+			return path[0]
+		}
+	}
+	return ""
+}
+
+// projectExecution returns the requested fields of the response for an execution. Fields within
+// the jsonb columns of an execution still in the database are extracted by the database, all
+// others from the response.
+func projectExecution(db *gorm.DB, executionID uint, archived bool, response map[string]interface{}, fields []fieldPath) (map[string]interface{}, error) {
+	projected := map[string]interface{}{}
+	var columnFields []fieldPath
+	for _, path := range fields {
+		if isExecutionJSONColumn(path[0]) {
+			if !archived {
+				columnFields = append(columnFields, path)
+				continue
+			}
+			// The payloads of archived executions were loaded from the archive
+			var document interface{}
+			if text, ok := response[path[0]].(string); ok {
+				json.Unmarshal([]byte(text), &document)
+			}
+			setField(projected, path, lookupField(document, path[1:]))
+			continue
+		}
+		setField(projected, path, lookupField(response, path))
+	}
+	if len(columnFields) == 0 {
+		return projected, nil
+	}
+
+	values, err := selectJSONFields(db, "workflow_executions", executionID, columnFields)
+	if err != nil {
+		return nil, err
+	}
+	for i, path := range columnFields {
+		setField(projected, path, values[i])
+	}
+	return projected, nil
+}
+
+// selectJSONFields extracts the fields from the jsonb columns of a row in the database, nil for
+// fields the row does not have
+func selectJSONFields(db *gorm.DB, table string, id uint, fields []fieldPath) ([]interface{}, error) {
+	selects := make([]string, len(fields))
+	var args []interface{}
+	for i, path := range fields {
+		placeholders := make([]string, len(path)-1)
+		for j, segment := range path[1:] {
+			placeholders[j] = "?"
+			args = append(args, segment)
+		}
+		// The column name was checked against the jsonb columns
+		selects[i] = fmt.Sprintf("(%s #> ARRAY[%s]::text[])::text", path[0], strings.Join(placeholders, ", "))
+	}
+	args = append(args, id)
+
+	rows, err := db.
+		Raw(fmt.Sprintf("SELECT %s FROM %s WHERE id = ?", strings.Join(selects, ", "), table), args...).
+		Rows()
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	raw := make([]sql.NullString, len(fields))
+	dest := make([]interface{}, len(fields))
+	for i := range raw {
+		dest[i] = &raw[i]
+	}
+	if rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(fields))
+	for i, value := range raw {
+		if value.Valid {
+			json.Unmarshal([]byte(value.String), &values[i])
+		}
+	}
+	return values, nil
+}
+
+// lookupField returns the field of a decoded JSON value, nil if it has none. JSON documents
+// stored as strings, like the payloads of node executions, are decoded on the way.
+func lookupField(value interface{}, path fieldPath) interface{} {
+	for _, segment := range path {
+		if text, ok := value.(string); ok {
+			var decoded interface{}
+			if json.Unmarshal([]byte(text), &decoded) != nil {
+				return nil
+			}
+			value = decoded
+		}
+		switch current := value.(type) {
+		case map[string]interface{}:
+			value = current[segment]
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(current) {
+				return nil
+			}
+			value = current[index]
+		default:
+			return nil
+		}
+	}
+	return value
+}
+
+// setField sets the field in the nested objects of a projection
+func setField(projected map[string]interface{}, path fieldPath, value interface{}) {
+	for _, segment := range path[:len(path)-1] {
+		next, ok := projected[segment].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			projected[segment] = next
+		}
+		projected = next
+	}
+	projected[path[len(path)-1]] = value
+}
+
+// responseFields converts a response to its decoded JSON form for projections
+func responseFields(response interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
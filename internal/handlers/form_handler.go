@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/forms"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/webhook"
+	"github.com/labstack/echo/v4"
+)
+
+// GetForm godoc
+// @Summary Get the form of a form trigger
+// @Description Returns the hosted form of a form trigger as HTML page, or its definition as JSON for requests accepting application/json or with format=json
+// @Tags triggers
+// @Produce html
+// @Produce json
+// @Param path path string true "Webhook path of the trigger"
+// @Param format query string false "json for the form definition"
+// @Success 200 {object} forms.Form
+// @Failure 404 {object} map[string]string
+// @Router /forms/{path} [get]
+func (h *TriggerHandler) GetForm(c echo.Context) error {
+	_, form, err := formTrigger(c.Param("path"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Form not found"})
+	}
+	if wantsJSON(c) {
+		return c.JSON(http.StatusOK, form)
+	}
+	return renderForm(c, http.StatusOK, forms.Page{Form: form})
+}
+
+// SubmitForm godoc
+// @Summary Submit the form of a form trigger
+// @Description Validates a submission of a hosted form, URL encoded as sent by the form page or as JSON object, and starts an execution of the trigger's workflow. The validated values are the body of the execution input, converted to the types of their fields. Invalid submissions are rejected with 422 and the problems by field; browsers get the form page again with the problems shown at their fields.
+// @Tags triggers
+// @Accept x-www-form-urlencoded
+// @Accept json
+// @Produce html
+// @Produce json
+// @Param path path string true "Webhook path of the trigger"
+// @Success 200 {object} map[string]interface{}
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 422 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Router /forms/{path} [post]
+func (h *TriggerHandler) SubmitForm(c echo.Context) error {
+	trigger, form, err := formTrigger(c.Param("path"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Form not found"})
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, webhook.MaxBodySize()+1))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if int64(len(body)) > webhook.MaxBodySize() {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "Request body too large"})
+	}
+
+	submitted := map[string]interface{}{}
+	entered := map[string]string{}
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType == echo.MIMEApplicationJSON {
+		if err := json.Unmarshal(body, &submitted); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid form submission"})
+		}
+	} else {
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid form submission"})
+		}
+		for name := range values {
+			submitted[name] = values.Get(name)
+			entered[name] = values.Get(name)
+		}
+	}
+
+	values, problems := forms.Validate(form, submitted)
+	if len(problems) > 0 {
+		if wantsJSON(c) {
+			return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{
+				"error":    "Invalid form submission",
+				"problems": forms.Problems(form, problems),
+			})
+		}
+		return renderForm(c, http.StatusUnprocessableEntity, forms.Page{Form: form, Values: entered, Problems: problems})
+	}
+
+	// The validated values are delivered as JSON body, so the input has the same shape for
+	// submissions of the form page and of API clients
+	valuesJSON, _ := json.Marshal(values)
+	delivery := webhook.NewDelivery(trigger, c.Request().Method, c.QueryParams(), c.Request().Header, valuesJSON)
+	delivery.ContentType = echo.MIMEApplicationJSON
+
+	status, response := h.accept(trigger, &delivery)
+	if wantsJSON(c) {
+		return c.JSON(status, response)
+	}
+	if status >= http.StatusBadRequest {
+		message, _ := response["error"].(string)
+		return renderForm(c, status, forms.Page{Form: form, Values: entered, Error: message})
+	}
+	return renderForm(c, http.StatusOK, forms.Page{Form: form, Submitted: true})
+}
+
+// formTrigger loads an active form trigger by its path and its form
+func formTrigger(path string) (models.Trigger, forms.Form, error) {
+	var trigger models.Trigger
+	err := database.DB.Where("webhook_path = ? AND trigger_type = ? AND is_active = ?", path, forms.TriggerType, true).
+		First(&trigger).Error
+	if err != nil {
+		return trigger, forms.Form{}, err
+	}
+	form, err := forms.Parse(trigger.Config)
+	if form.Title == "" {
+		form.Title = trigger.Name
+	}
+	return trigger, form, err
+}
+
+// renderForm responds with the HTML page of a form
+func renderForm(c echo.Context, status int, page forms.Page) error {
+	var html bytes.Buffer
+	if err := forms.Render(&html, page); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.HTMLBlob(status, html.Bytes())
+}
+
+// wantsJSON reports whether a form request is made by an API client rather than a browser
+func wantsJSON(c echo.Context) bool {
+	if c.QueryParam("format") == "json" {
+		return true
+	}
+	request := c.Request()
+	return strings.Contains(request.Header.Get(echo.HeaderAccept), echo.MIMEApplicationJSON) ||
+		strings.HasPrefix(request.Header.Get(echo.HeaderContentType), echo.MIMEApplicationJSON)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/maintenance"
+	"github.com/labstack/echo/v4"
+)
+
+// MaintenanceHandler manages the HTTP requests for the maintenance mode
+type MaintenanceHandler struct{}
+
+// NewMaintenanceHandler creates a new MaintenanceHandler
+func NewMaintenanceHandler() *MaintenanceHandler {
+	return &MaintenanceHandler{}
+}
+
+// SetMaintenanceRequest represents the input data for toggling the maintenance mode
+type SetMaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason"`
+}
+
+// Get godoc
+// @Summary Get the maintenance mode
+// @Description Returns whether maintenance mode is enabled, since when and why
+// @Tags maintenance
+// @Accept json
+// @Produce json
+// @Success 200 {object} maintenance.State
+// @Failure 500 {object} map[string]string
+// @Router /admin/maintenance [get]
+func (h *MaintenanceHandler) Get(c echo.Context) error {
+	state, err := maintenance.Status()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, state)
+}
+
+// Set godoc
+// @Summary Toggle the maintenance mode
+// @Description Enables or disables maintenance mode for all servers and workers. While it is enabled, new executions are accepted but held back and workers finish their current tasks without taking new ones. Held executions start once it is disabled.
+// @Tags maintenance
+// @Accept json
+// @Produce json
+// @Param request body SetMaintenanceRequest true "Maintenance mode"
+// @Success 200 {object} maintenance.State
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/maintenance [put]
+func (h *MaintenanceHandler) Set(c echo.Context) error {
+	var request SetMaintenanceRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if !request.Enabled {
+		if err := maintenance.Disable(); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, maintenance.State{})
+	}
+
+	by := ""
+	if user := auth.CurrentUser(c); user != nil {
+		by = user.Email
+	}
+	state, err := maintenance.Enable(request.Reason, by)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, state)
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/graphcache"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// NodeGroupHandler manages the HTTP requests for node groups
+type NodeGroupHandler struct{}
+
+// NewNodeGroupHandler creates a new NodeGroupHandler
+func NewNodeGroupHandler() *NodeGroupHandler {
+	return &NodeGroupHandler{}
+}
+
+// GetByWorkflowID godoc
+// @Summary Get node groups of a workflow
+// @Description Returns the groups of the workflow's nodes
+// @Tags node-groups
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Success 200 {array} models.NodeGroup
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/groups [get]
+func (h *NodeGroupHandler) GetByWorkflowID(c echo.Context) error {
+	workflowID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+	}
+
+	var groups []models.NodeGroup
+	if err := database.DB.Where("workflow_id = ?", workflowID).Find(&groups).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, groups)
+}
+
+// Create godoc
+// @Summary Create a node group
+// @Description Creates a group for nodes of a workflow. Nodes join the group by setting their group_id.
+// @Tags node-groups
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Param group body models.NodeGroup true "Group data"
+// @Success 201 {object} models.NodeGroup
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/groups [post]
+func (h *NodeGroupHandler) Create(c echo.Context) error {
+	workflowID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+	}
+
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, workflowID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+	if err := checkWorkflowEditable(workflow.ID); err != nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+
+	var group models.NodeGroup
+	if err := c.Bind(&group); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	group.ID = 0
+	group.WorkflowID = workflow.ID
+
+	if err := database.DB.Create(&group).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	graphcache.InvalidateWorkflow(workflow.ID)
+
+	return c.JSON(http.StatusCreated, group)
+}
+
+// Update godoc
+// @Summary Update a node group
+// @Description Updates a node group, e.g. to collapse or disable it. The nodes of a disabled group are skipped by the engine.
+// @Tags node-groups
+// @Accept json
+// @Produce json
+// @Param id path int true "Group ID"
+// @Param group body models.NodeGroup true "Updated group data"
+// @Success 200 {object} models.NodeGroup
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /groups/{id} [put]
+func (h *NodeGroupHandler) Update(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var group models.NodeGroup
+	if err := database.DB.First(&group, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Group not found"})
+	}
+	if err := checkWorkflowEditable(group.WorkflowID); err != nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+
+	workflowID := group.WorkflowID
+	if err := c.Bind(&group); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	group.ID = uint(id)
+	group.WorkflowID = workflowID
+
+	if err := database.DB.Save(&group).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	graphcache.InvalidateWorkflow(group.WorkflowID)
+
+	return c.JSON(http.StatusOK, group)
+}
+
+// Delete godoc
+// @Summary Delete a node group
+// @Description Deletes a node group; its nodes are kept and leave the group
+// @Tags node-groups
+// @Accept json
+// @Produce json
+// @Param id path int true "Group ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /groups/{id} [delete]
+func (h *NodeGroupHandler) Delete(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var group models.NodeGroup
+	if database.DB.Limit(1).Find(&group, id).RowsAffected == 0 {
+		return c.NoContent(http.StatusNoContent)
+	}
+	if err := checkWorkflowEditable(group.WorkflowID); err != nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Node{}).Where("group_id = ?", group.ID).Update("group_id", nil).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.NodeGroup{}, group.ID).Error
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	graphcache.InvalidateWorkflow(group.WorkflowID)
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -2,10 +2,17 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"regexp"
 	"strconv"
 
 	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/engine"
+	"github.com/altipard/flowcraft/internal/graphcache"
+	"github.com/altipard/flowcraft/internal/inference"
 	"github.com/altipard/flowcraft/internal/models"
 	"github.com/labstack/echo/v4"
 )
@@ -60,6 +67,40 @@ func (h *NodeHandler) GetByID(c echo.Context) error {
 	return c.JSON(http.StatusOK, node)
 }
 
+// GetObservedSchema godoc
+// @Summary Get the observed output schema of a node
+// @Description Returns the JSON schema inferred from the recent outputs of the node, or of its node type if the node was not executed yet, with the paths of its fields for autocompletion
+// @Tags nodes
+// @Accept json
+// @Produce json
+// @Param id path int true "Node ID"
+// @Success 200 {object} models.ObservedOutputSchema
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /nodes/{id}/observed-schema [get]
+func (h *NodeHandler) GetObservedSchema(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var node models.Node
+	if err := database.DB.First(&node, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Node not found"})
+	}
+
+	schemas, err := inference.ForNodes([]models.Node{node})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	schema, ok := schemas[node.ID]
+	if !ok {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "No outputs observed yet"})
+	}
+	return c.JSON(http.StatusOK, schema)
+}
+
 // Create godoc
 // @Summary Create a new node
 // @Description Creates a new node in a workflow
@@ -69,7 +110,9 @@ func (h *NodeHandler) GetByID(c echo.Context) error {
 // @Param node body models.Node true "Node data"
 // @Success 201 {object} models.Node
 // @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Router /nodes [post]
 func (h *NodeHandler) Create(c echo.Context) error {
 	node := new(models.Node)
@@ -81,13 +124,194 @@ func (h *NodeHandler) Create(c echo.Context) error {
 		node.Config = "{}"
 	}
 
+	if err := checkWorkflowEditable(node.WorkflowID); err != nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+
+	if err := checkNodeTypeAllowed(node.NodeType); err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+
+	if err := checkCompensationNode(node); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := checkAnnotation(node); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := checkNodeGroup(node); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := checkDisabledMode(node); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := checkArtifacts(node); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := checkTimeout(node); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
 	if err := database.DB.Create(node).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	graphcache.InvalidateWorkflow(node.WorkflowID)
 
 	return c.JSON(http.StatusCreated, node)
 }
 
+// checkNodeTypeAllowed rejects node types whose executor class is disabled on this installation
+func checkNodeTypeAllowed(nodeTypeKey string) error {
+	// Annotations have no executor
+	if nodeTypeKey == models.NodeTypeAnnotation {
+		return nil
+	}
+
+	nodeType, err := graphcache.NodeType(nodeTypeKey)
+	if err != nil {
+		// Unknown node types are not validated here
+		return nil
+	}
+
+	if !engine.IsExecutorClassAllowed(nodeType.ExecutorClass) {
+		return fmt.Errorf("node type %s is disabled on this installation", nodeTypeKey)
+	}
+
+	return nil
+}
+
+// annotationColors are the colors of sticky notes offered by the editor
+var annotationColors = map[string]bool{"yellow": true, "blue": true, "green": true, "pink": true, "purple": true, "gray": true}
+
+// checkAnnotation validates the content and color of annotations, which cannot be connected or
+// compensated since they are never executed
+func checkAnnotation(node *models.Node) error {
+	if !node.IsAnnotation() {
+		return nil
+	}
+
+	if node.CompensationNodeID != nil {
+		return fmt.Errorf("annotations cannot have a compensation node")
+	}
+	if node.ID != 0 {
+		var count int64
+		database.DB.Model(&models.Connection{}).Where("source_node_id = ? OR target_node_id = ?", node.ID, node.ID).Count(&count)
+		if count > 0 {
+			return fmt.Errorf("annotations cannot be connected, remove the node's connections first")
+		}
+	}
+
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(node.Config), &config); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	if content, ok := config["content"]; ok {
+		if _, isString := content.(string); !isString {
+			return fmt.Errorf("content of annotations must be a string")
+		}
+	}
+	if color, ok := config["color"]; ok {
+		if name, isString := color.(string); !isString || !annotationColors[name] {
+			return fmt.Errorf("unknown annotation color: %v", color)
+		}
+	}
+	return nil
+}
+
+// checkDisabledMode validates how a disabled node is bypassed, defaulting to passthrough
+func checkDisabledMode(node *models.Node) error {
+	switch node.DisabledMode {
+	case "":
+		node.DisabledMode = models.DisabledPassthrough
+	case models.DisabledPassthrough, models.DisabledSkip:
+	default:
+		return fmt.Errorf("disabled_mode must be %s or %s", models.DisabledPassthrough, models.DisabledSkip)
+	}
+	return nil
+}
+
+// artifactNamePattern restricts the names of artifacts, which name their downloads
+var artifactNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// checkArtifacts validates the outputs a node keeps as artifacts, defaulting to none
+func checkArtifacts(node *models.Node) error {
+	if node.Artifacts == "" {
+		node.Artifacts = "{}"
+		return nil
+	}
+	var paths map[string]string
+	if err := json.Unmarshal([]byte(node.Artifacts), &paths); err != nil {
+		return errors.New("artifacts must be an object mapping artifact names to output paths")
+	}
+	for name := range paths {
+		if !artifactNamePattern.MatchString(name) {
+			return fmt.Errorf("invalid artifact name %q, expected up to 64 letters, digits or ._- characters", name)
+		}
+	}
+	return nil
+}
+
+// checkTimeout validates the timeout of a node's executor calls in its config and whether
+// timed out calls are retried
+func checkTimeout(node *models.Node) error {
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(node.Config), &config); err != nil {
+		// Invalid configs fail the node when it is executed
+		return nil
+	}
+	if value, ok := config["retry_on_timeout"]; ok {
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("retry_on_timeout must be true or false")
+		}
+	}
+	_, err := engine.NodeTimeout(config)
+	return err
+}
+
+// checkNodeGroup rejects groups of other workflows
+func checkNodeGroup(node *models.Node) error {
+	if node.GroupID == nil {
+		return nil
+	}
+
+	var group models.NodeGroup
+	if err := database.DB.First(&group, *node.GroupID).Error; err != nil {
+		return fmt.Errorf("group %d not found", *node.GroupID)
+	}
+	if group.WorkflowID != node.WorkflowID {
+		return fmt.Errorf("group %d belongs to another workflow", group.ID)
+	}
+	return nil
+}
+
+// checkCompensationNode rejects compensation nodes outside the node's workflow
+func checkCompensationNode(node *models.Node) error {
+	if node.CompensationNodeID == nil {
+		return nil
+	}
+
+	if node.ID != 0 && *node.CompensationNodeID == node.ID {
+		return fmt.Errorf("a node cannot compensate itself")
+	}
+
+	var compensationNode models.Node
+	if err := database.DB.First(&compensationNode, *node.CompensationNodeID).Error; err != nil {
+		return fmt.Errorf("compensation node %d not found", *node.CompensationNodeID)
+	}
+	if compensationNode.WorkflowID != node.WorkflowID {
+		return fmt.Errorf("compensation node %d belongs to another workflow", compensationNode.ID)
+	}
+	if compensationNode.IsAnnotation() {
+		return fmt.Errorf("compensation node %d is an annotation", compensationNode.ID)
+	}
+
+	return nil
+}
+
 // Update godoc
 // @Summary Update a node
 // @Description Updates an existing node
@@ -98,8 +322,10 @@ func (h *NodeHandler) Create(c echo.Context) error {
 // @Param node body models.Node true "Updated node data"
 // @Success 200 {object} models.Node
 // @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
 // @Failure 404 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Router /nodes/{id} [put]
 func (h *NodeHandler) Update(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -111,14 +337,53 @@ func (h *NodeHandler) Update(c echo.Context) error {
 	if err := database.DB.First(&node, id).Error; err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Node not found"})
 	}
+	previousWorkflowID := node.WorkflowID
 
 	if err := c.Bind(&node); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
+	for _, workflowID := range []uint{previousWorkflowID, node.WorkflowID} {
+		if err := checkWorkflowEditable(workflowID); err != nil {
+			return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+		}
+	}
+
+	if err := checkNodeTypeAllowed(node.NodeType); err != nil {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	}
+
+	if err := checkCompensationNode(&node); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := checkAnnotation(&node); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := checkNodeGroup(&node); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := checkDisabledMode(&node); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := checkArtifacts(&node); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := checkTimeout(&node); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
 	if err := database.DB.Save(&node).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	graphcache.InvalidateWorkflow(previousWorkflowID)
+	if node.WorkflowID != previousWorkflowID {
+		graphcache.InvalidateWorkflow(node.WorkflowID)
+	}
 
 	return c.JSON(http.StatusOK, node)
 }
@@ -133,6 +398,7 @@ func (h *NodeHandler) Update(c echo.Context) error {
 // @Success 204 "No Content"
 // @Failure 400 {object} map[string]string
 // @Failure 500 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Router /nodes/{id} [delete]
 func (h *NodeHandler) Delete(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -140,9 +406,18 @@ func (h *NodeHandler) Delete(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
 	}
 
+	var node models.Node
+	if database.DB.Limit(1).Find(&node, id).RowsAffected == 0 {
+		return c.NoContent(http.StatusNoContent)
+	}
+	if err := checkWorkflowEditable(node.WorkflowID); err != nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+
 	if err := database.DB.Delete(&models.Node{}, id).Error; err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	graphcache.InvalidateWorkflow(node.WorkflowID)
 
 	return c.NoContent(http.StatusNoContent)
 }
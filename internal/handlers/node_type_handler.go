@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/engine"
+	"github.com/altipard/flowcraft/internal/graphcache"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/openapi"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// maxSpecSize limits the size of imported OpenAPI specifications
+const maxSpecSize = 10 << 20
+
+// NodeTypeHandler manages the HTTP requests for node types
+type NodeTypeHandler struct{}
+
+// NewNodeTypeHandler creates a new NodeTypeHandler
+func NewNodeTypeHandler() *NodeTypeHandler {
+	return &NodeTypeHandler{}
+}
+
+// GetAll godoc
+// @Summary Get all node types
+// @Description Returns the built-in and declarative node types
+// @Tags node-types
+// @Accept json
+// @Produce json
+// @Success 200 {array} models.NodeType
+// @Failure 500 {object} map[string]string
+// @Router /node-types [get]
+func (h *NodeTypeHandler) GetAll(c echo.Context) error {
+	var nodeTypes []models.NodeType
+	if err := database.DB.Order("category, name").Find(&nodeTypes).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, nodeTypes)
+}
+
+// GetByID godoc
+// @Summary Get node type by ID
+// @Description Returns a specific node type based on its ID
+// @Tags node-types
+// @Accept json
+// @Produce json
+// @Param id path int true "Node type ID"
+// @Success 200 {object} models.NodeType
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /node-types/{id} [get]
+func (h *NodeTypeHandler) GetByID(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var nodeType models.NodeType
+	if err := database.DB.First(&nodeType, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Node type not found"})
+	}
+	return c.JSON(http.StatusOK, nodeType)
+}
+
+// Create godoc
+// @Summary Create a declarative HTTP node type
+// @Description Creates a node type calling a REST API described by its definition, without Go code or plugins
+// @Tags node-types
+// @Accept json
+// @Produce json
+// @Param nodeType body models.NodeType true "Node type with definition"
+// @Success 201 {object} models.NodeType
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /node-types [post]
+func (h *NodeTypeHandler) Create(c echo.Context) error {
+	var nodeType models.NodeType
+	if err := c.Bind(&nodeType); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	nodeType.ID = 0
+
+	if err := prepareDeclarativeNodeType(&nodeType); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	var count int64
+	database.DB.Model(&models.NodeType{}).Where("key = ?", nodeType.Key).Count(&count)
+	if count > 0 {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Node type key already exists"})
+	}
+
+	if err := database.DB.Create(&nodeType).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	graphcache.InvalidateNodeType(nodeType.Key)
+
+	return c.JSON(http.StatusCreated, nodeType)
+}
+
+// ImportOpenAPI godoc
+// @Summary Import node types from an OpenAPI specification
+// @Description Generates declarative HTTP node types for the operations of an OpenAPI 3 specification (JSON or YAML). Node types imported before with the same key are updated.
+// @Tags node-types
+// @Accept json
+// @Produce json
+// @Param key query string false "Key of the node type or key prefix if grouped by tag (defaults to the title)"
+// @Param base_url query string false "Base URL of the API (defaults to the first server)"
+// @Param group_by query string false "api (one node type, default) or tag (one node type per tag)"
+// @Param spec body object true "OpenAPI 3 specification"
+// @Success 201 {array} models.NodeType
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /node-types/import [post]
+func (h *NodeTypeHandler) ImportOpenAPI(c echo.Context) error {
+	opts := openapi.Options{
+		Key:     c.QueryParam("key"),
+		BaseURL: c.QueryParam("base_url"),
+	}
+	switch c.QueryParam("group_by") {
+	case "", "api":
+	case "tag":
+		opts.GroupByTag = true
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "group_by must be api or tag"})
+	}
+
+	spec, err := io.ReadAll(io.LimitReader(c.Request().Body, maxSpecSize+1))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if len(spec) > maxSpecSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "Specification too large"})
+	}
+
+	nodeTypes, err := openapi.NodeTypes(spec, opts)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// Create the node types or update the ones of an earlier import, but never replace built-in types
+	var conflict error
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		for i := range nodeTypes {
+			var existing models.NodeType
+			if tx.Where("key = ?", nodeTypes[i].Key).Limit(1).Find(&existing).RowsAffected > 0 {
+				if existing.ExecutorClass != engine.HttpDefinitionExecutorClass {
+					conflict = fmt.Errorf("node type %s already exists and is not a declarative node type", existing.Key)
+					return conflict
+				}
+				nodeTypes[i].ID = existing.ID
+				nodeTypes[i].Icon = existing.Icon
+				nodeTypes[i].Category = existing.Category
+				nodeTypes[i].CostModel = existing.CostModel
+			}
+			if err := tx.Save(&nodeTypes[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if conflict != nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": conflict.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	for _, nodeType := range nodeTypes {
+		graphcache.InvalidateNodeType(nodeType.Key)
+	}
+
+	return c.JSON(http.StatusCreated, nodeTypes)
+}
+
+// Update godoc
+// @Summary Update a declarative HTTP node type
+// @Description Updates a declarative node type. Built-in node types cannot be changed.
+// @Tags node-types
+// @Accept json
+// @Produce json
+// @Param id path int true "Node type ID"
+// @Param nodeType body models.NodeType true "Updated node type"
+// @Success 200 {object} models.NodeType
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /node-types/{id} [put]
+func (h *NodeTypeHandler) Update(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var nodeType models.NodeType
+	if err := database.DB.First(&nodeType, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Node type not found"})
+	}
+	if nodeType.ExecutorClass != engine.HttpDefinitionExecutorClass {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Built-in node types cannot be changed"})
+	}
+
+	// The key is referenced by the nodes of the type and cannot be changed
+	key := nodeType.Key
+	if err := c.Bind(&nodeType); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	nodeType.ID = uint(id)
+	nodeType.Key = key
+
+	if err := prepareDeclarativeNodeType(&nodeType); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := database.DB.Save(&nodeType).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	graphcache.InvalidateNodeType(nodeType.Key)
+
+	return c.JSON(http.StatusOK, nodeType)
+}
+
+// SetCostModel godoc
+// @Summary Set the cost model of a node type
+// @Description Sets the prices used to estimate the cost of the node type's executions: per call and, for LLM APIs, per input and output token read from the usage in the output. Built-in node types can be priced as well; zero prices remove the cost model.
+// @Tags node-types
+// @Accept json
+// @Produce json
+// @Param id path int true "Node type ID"
+// @Param costModel body engine.CostModel true "Cost model"
+// @Success 200 {object} models.NodeType
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /node-types/{id}/cost-model [put]
+func (h *NodeTypeHandler) SetCostModel(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var nodeType models.NodeType
+	if err := database.DB.First(&nodeType, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Node type not found"})
+	}
+
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	costModel, err := engine.ParseCostModel(string(body))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	nodeType.CostModel = `{}`
+	if costModel != nil {
+		data, _ := json.Marshal(costModel)
+		nodeType.CostModel = string(data)
+	}
+
+	if err := database.DB.Model(&nodeType).Update("cost_model", nodeType.CostModel).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	graphcache.InvalidateNodeType(nodeType.Key)
+
+	return c.JSON(http.StatusOK, nodeType)
+}
+
+// Delete godoc
+// @Summary Delete a declarative HTTP node type
+// @Description Deletes a declarative node type that is not used by any node
+// @Tags node-types
+// @Accept json
+// @Produce json
+// @Param id path int true "Node type ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /node-types/{id} [delete]
+func (h *NodeTypeHandler) Delete(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var nodeType models.NodeType
+	if err := database.DB.First(&nodeType, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Node type not found"})
+	}
+	if nodeType.ExecutorClass != engine.HttpDefinitionExecutorClass {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Built-in node types cannot be deleted"})
+	}
+
+	var count int64
+	database.DB.Model(&models.Node{}).Where("node_type = ?", nodeType.Key).Count(&count)
+	if count > 0 {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Node type is used by existing nodes"})
+	}
+
+	if err := database.DB.Delete(&nodeType).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	graphcache.InvalidateNodeType(nodeType.Key)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// prepareDeclarativeNodeType validates the definition of a node type created via the API and
+// derives its schemas. Only declarative HTTP node types can be created this way, other executor
+// classes (e.g. plugins) are registered by the installation.
+func prepareDeclarativeNodeType(nodeType *models.NodeType) error {
+	if nodeType.Key == "" || nodeType.Name == "" {
+		return errors.New("key and name are required")
+	}
+
+	definition, err := engine.ParseHttpNodeDefinition(nodeType.Definition)
+	if err != nil {
+		return err
+	}
+	if _, err := engine.ParseCostModel(nodeType.CostModel); err != nil {
+		return err
+	}
+	if nodeType.CostModel == "" {
+		nodeType.CostModel = `{}`
+	}
+
+	nodeType.ExecutorClass = engine.HttpDefinitionExecutorClass
+	nodeType.ConfigSchema = definition.ConfigSchema()
+	nodeType.InputSchema = `{}`
+	nodeType.OutputSchema = `{}`
+	if nodeType.Category == "" {
+		nodeType.Category = "Integrations"
+	}
+	return nil
+}
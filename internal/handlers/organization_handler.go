@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/quota"
+	"github.com/altipard/flowcraft/internal/schedule"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// OrganizationHandler manages the HTTP requests for organizations and their quotas
+type OrganizationHandler struct{}
+
+// NewOrganizationHandler creates a new OrganizationHandler
+func NewOrganizationHandler() *OrganizationHandler {
+	return &OrganizationHandler{}
+}
+
+// GetAll godoc
+// @Summary Get all organizations
+// @Description Returns a list of all organizations
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Success 200 {array} models.Organization
+// @Failure 500 {object} map[string]string
+// @Router /organizations [get]
+func (h *OrganizationHandler) GetAll(c echo.Context) error {
+	var organizations []models.Organization
+	if err := database.DB.Find(&organizations).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, organizations)
+}
+
+// GetByID godoc
+// @Summary Get organization by ID
+// @Description Returns a specific organization based on its ID
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Success 200 {object} models.Organization
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /organizations/{id} [get]
+func (h *OrganizationHandler) GetByID(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var organization models.Organization
+	if err := database.DB.First(&organization, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Organization not found"})
+	}
+
+	return c.JSON(http.StatusOK, organization)
+}
+
+// Create godoc
+// @Summary Create a new organization
+// @Description Creates a new organization with optional quotas (0 means unlimited)
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param organization body models.Organization true "Organization data"
+// @Success 201 {object} models.Organization
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /organizations [post]
+func (h *OrganizationHandler) Create(c echo.Context) error {
+	organization := new(models.Organization)
+	if err := c.Bind(organization); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := database.DB.Create(organization).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, organization)
+}
+
+// Update godoc
+// @Summary Update an organization
+// @Description Updates an existing organization and its quotas
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Param organization body models.Organization true "Updated organization data"
+// @Success 200 {object} models.Organization
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /organizations/{id} [put]
+func (h *OrganizationHandler) Update(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var organization models.Organization
+	if err := database.DB.First(&organization, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Organization not found"})
+	}
+
+	if err := c.Bind(&organization); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// The storage counter is maintained by the dispatches and the storage measurement
+	if err := database.DB.Omit("storage_bytes").Save(&organization).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, organization)
+}
+
+// Delete godoc
+// @Summary Delete an organization
+// @Description Deletes an organization based on its ID
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /organizations/{id} [delete]
+func (h *OrganizationHandler) Delete(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	if err := database.DB.Delete(&models.Organization{}, id).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetUsage godoc
+// @Summary Get organization usage
+// @Description Returns the usage counters and quota limits of an organization for a billing period
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Param period query string false "Billing period as YYYY-MM (default: current month)"
+// @Success 200 {object} quota.Usage
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /organizations/{id}/usage [get]
+func (h *OrganizationHandler) GetUsage(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var organization models.Organization
+	if err := database.DB.First(&organization, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Organization not found"})
+	}
+
+	period := c.QueryParam("period")
+	if period == "" {
+		period = quota.CurrentPeriod(time.Now())
+	} else if _, err := time.Parse("2006-01", period); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid period, expected YYYY-MM"})
+	}
+
+	usage, err := quota.GetUsage(organization, period)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, usage)
+}
+
+// GetHolidays godoc
+// @Summary Get organization holidays
+// @Description Returns the holidays skipped by schedule triggers of the organization's workflows that run on business days only
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Success 200 {array} models.Holiday
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /organizations/{id}/holidays [get]
+func (h *OrganizationHandler) GetHolidays(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var holidays []models.Holiday
+	if err := database.DB.Where("organization_id = ?", id).Order("date").Find(&holidays).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, holidays)
+}
+
+// SetHolidays godoc
+// @Summary Replace organization holidays
+// @Description Replaces the holiday list of an organization and reschedules the schedule triggers of its workflows
+// @Tags organizations
+// @Accept json
+// @Produce json
+// @Param id path int true "Organization ID"
+// @Param holidays body []models.Holiday true "Holidays with date (YYYY-MM-DD) and name"
+// @Success 200 {array} models.Holiday
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /organizations/{id}/holidays [put]
+func (h *OrganizationHandler) SetHolidays(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var organization models.Organization
+	if err := database.DB.First(&organization, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Organization not found"})
+	}
+
+	var holidays []models.Holiday
+	if err := c.Bind(&holidays); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	seen := make(map[string]bool, len(holidays))
+	for i := range holidays {
+		if _, err := time.Parse("2006-01-02", holidays[i].Date); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid holiday date, expected YYYY-MM-DD: " + holidays[i].Date})
+		}
+		if seen[holidays[i].Date] {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Duplicate holiday date: " + holidays[i].Date})
+		}
+		seen[holidays[i].Date] = true
+		holidays[i].ID = 0
+		holidays[i].OrganizationID = organization.ID
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("organization_id = ?", organization.ID).Delete(&models.Holiday{}).Error; err != nil {
+			return err
+		}
+		if len(holidays) == 0 {
+			return nil
+		}
+		return tx.Create(&holidays).Error
+	})
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	if err := schedule.Reschedule(organization.ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, holidays)
+}
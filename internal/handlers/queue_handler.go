@@ -0,0 +1,300 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/queue"
+	"github.com/labstack/echo/v4"
+)
+
+// QueueHandler manages the admin endpoints for inspecting and repairing the task queues
+type QueueHandler struct {
+	queueClient *queue.QueueClient
+}
+
+// NewQueueHandler creates a new QueueHandler
+func NewQueueHandler(queueClient *queue.QueueClient) *QueueHandler {
+	return &QueueHandler{
+		queueClient: queueClient,
+	}
+}
+
+// DrainQueueRequest represents the input data for draining a queue
+type DrainQueueRequest struct {
+	Target string `json:"target"`
+	Limit  int64  `json:"limit"` // maximum number of tasks to move, 0 for all
+}
+
+// queueNamePattern restricts the Redis keys reachable through the queue endpoints, including the
+// fair sub-queues like {workflow_tasks}:group:org:1
+var queueNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.:{}-]{1,128}$`)
+
+// maxPeekTasks limits the number of tasks returned by Peek
+const maxPeekTasks = 500
+
+// queueName returns the validated name of the queue in the path
+func queueName(c echo.Context) (string, error) {
+	name := c.Param("name")
+	if !queueNamePattern.MatchString(name) {
+		return "", errors.New("Invalid queue name")
+	}
+	return name, nil
+}
+
+// queueErrorResponse maps errors of the queue operations to responses
+func queueErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, queue.ErrTaskNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Task not found in queue"})
+	case errors.Is(err, queue.ErrNotAQueue):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Key is not a queue"})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
+
+// logQueueAction records actions changing a queue with the admin performing them
+func logQueueAction(c echo.Context, format string, args ...interface{}) {
+	actor := "anonymous"
+	if user := auth.CurrentUser(c); user != nil {
+		actor = user.Email
+	}
+	log.Printf("Queue admin %s: "+format, append([]interface{}{actor}, args...)...)
+}
+
+// Get godoc
+// @Summary Get a queue
+// @Description Returns the number of tasks waiting in a queue, whether it is paused and the groups with tasks waiting in its fair sub-queues
+// @Tags queues
+// @Accept json
+// @Produce json
+// @Param name path string true "Queue name, e.g. workflow_tasks"
+// @Success 200 {object} queue.QueueInfo
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/queues/{name} [get]
+func (h *QueueHandler) Get(c echo.Context) error {
+	name, err := queueName(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	info, err := h.queueClient.Info(name)
+	if err != nil {
+		return queueErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, info)
+}
+
+// Peek godoc
+// @Summary Peek at queued tasks
+// @Description Returns the tasks waiting in a queue without removing them, starting at the head of the queue
+// @Tags queues
+// @Accept json
+// @Produce json
+// @Param name path string true "Queue name"
+// @Param offset query int false "Position of the first task (default 0)"
+// @Param limit query int false "Maximum number of tasks (default 50, at most 500)"
+// @Success 200 {array} queue.QueuedTask
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/queues/{name}/tasks [get]
+func (h *QueueHandler) Peek(c echo.Context) error {
+	name, err := queueName(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	offset, limit := int64(0), int64(50)
+	if v := c.QueryParam("offset"); v != "" {
+		if offset, err = strconv.ParseInt(v, 10, 64); err != nil || offset < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid offset"})
+		}
+	}
+	if v := c.QueryParam("limit"); v != "" {
+		if limit, err = strconv.ParseInt(v, 10, 64); err != nil || limit < 1 || limit > maxPeekTasks {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid limit, expected 1 to 500"})
+		}
+	}
+
+	tasks, err := h.queueClient.Peek(name, offset, limit)
+	if err != nil {
+		return queueErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, tasks)
+}
+
+// DeleteTask godoc
+// @Summary Delete a queued task
+// @Description Removes a task from a queue, so that no worker processes it
+// @Tags queues
+// @Accept json
+// @Produce json
+// @Param name path string true "Queue name"
+// @Param task_id path string true "Task ID as returned by /admin/queues/{name}/tasks"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/queues/{name}/tasks/{task_id} [delete]
+func (h *QueueHandler) DeleteTask(c echo.Context) error {
+	name, err := queueName(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := h.queueClient.DeleteTask(name, c.Param("task_id")); err != nil {
+		return queueErrorResponse(c, err)
+	}
+	logQueueAction(c, "deleted task %s from queue %s", c.Param("task_id"), name)
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RequeueTask godoc
+// @Summary Requeue a task
+// @Description Moves a task to the end of its queue, or to the end of another queue
+// @Tags queues
+// @Accept json
+// @Produce json
+// @Param name path string true "Queue name"
+// @Param task_id path string true "Task ID as returned by /admin/queues/{name}/tasks"
+// @Param to query string false "Target queue (default: the same queue)"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/queues/{name}/tasks/{task_id}/requeue [post]
+func (h *QueueHandler) RequeueTask(c echo.Context) error {
+	name, err := queueName(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	target := c.QueryParam("to")
+	if target == "" {
+		target = name
+	}
+	if !queueNamePattern.MatchString(target) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid target queue name"})
+	}
+
+	if err := h.queueClient.MoveTask(name, c.Param("task_id"), target); err != nil {
+		return queueErrorResponse(c, err)
+	}
+	logQueueAction(c, "requeued task %s from queue %s to %s", c.Param("task_id"), name, target)
+
+	return c.JSON(http.StatusOK, map[string]string{"status": "requeued", "queue": target})
+}
+
+// Pause godoc
+// @Summary Pause a queue
+// @Description Stops the workers from taking tasks from a queue. Tasks are still enqueued while the queue is paused.
+// @Tags queues
+// @Accept json
+// @Produce json
+// @Param name path string true "Queue name"
+// @Success 200 {object} queue.QueueInfo
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/queues/{name}/pause [post]
+func (h *QueueHandler) Pause(c echo.Context) error {
+	return h.setPaused(c, true)
+}
+
+// Resume godoc
+// @Summary Resume a queue
+// @Description Lets the workers take tasks from a paused queue again
+// @Tags queues
+// @Accept json
+// @Produce json
+// @Param name path string true "Queue name"
+// @Success 200 {object} queue.QueueInfo
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/queues/{name}/resume [post]
+func (h *QueueHandler) Resume(c echo.Context) error {
+	return h.setPaused(c, false)
+}
+
+// setPaused pauses or resumes the queue in the request
+func (h *QueueHandler) setPaused(c echo.Context, paused bool) error {
+	name, err := queueName(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if paused {
+		err = h.queueClient.Pause(name)
+	} else {
+		err = h.queueClient.Resume(name)
+	}
+	if err != nil {
+		return queueErrorResponse(c, err)
+	}
+	logQueueAction(c, "set paused=%t on queue %s", paused, name)
+
+	info, err := h.queueClient.Info(name)
+	if err != nil {
+		return queueErrorResponse(c, err)
+	}
+	return c.JSON(http.StatusOK, info)
+}
+
+// Drain godoc
+// @Summary Drain a queue
+// @Description Moves the tasks of a queue to the end of another queue, keeping their order
+// @Tags queues
+// @Accept json
+// @Produce json
+// @Param name path string true "Queue name"
+// @Param request body DrainQueueRequest true "Target queue and maximum number of tasks"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/queues/{name}/drain [post]
+func (h *QueueHandler) Drain(c echo.Context) error {
+	name, err := queueName(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	var request DrainQueueRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if !queueNamePattern.MatchString(request.Target) || request.Target == name {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "target must be the name of another queue"})
+	}
+	if request.Limit < 0 {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "limit must not be negative"})
+	}
+
+	moved, err := h.queueClient.Drain(name, request.Target, request.Limit)
+	logQueueAction(c, "drained %d tasks from queue %s to %s", moved, name, request.Target)
+	if err != nil {
+		return queueErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"moved": moved, "target": request.Target})
+}
+
+// Leaders godoc
+// @Summary List the leaders of background jobs
+// @Description Returns the worker process running each singleton background job, e.g. the scheduler, and when its leadership expires unless renewed. Jobs without a leader have no holder.
+// @Tags queues
+// @Accept json
+// @Produce json
+// @Success 200 {array} queue.Leadership
+// @Failure 500 {object} map[string]string
+// @Router /admin/leaders [get]
+func (h *QueueHandler) Leaders(c echo.Context) error {
+	leaders, err := h.queueClient.Leaders()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, leaders)
+}
@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/schedule"
+	"github.com/labstack/echo/v4"
+)
+
+// ScheduleHandler manages the HTTP requests for one-off scheduled runs
+type ScheduleHandler struct{}
+
+// NewScheduleHandler creates a new ScheduleHandler
+func NewScheduleHandler() *ScheduleHandler {
+	return &ScheduleHandler{}
+}
+
+// Schedule godoc
+// @Summary Schedule a workflow run
+// @Description Schedules a single execution of the workflow at a future time with an optional input
+// @Tags schedules
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Param run body models.ScheduledRunRequest true "Time (RFC 3339) and input of the run"
+// @Success 201 {object} models.ScheduledRun
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/schedule [post]
+func (h *ScheduleHandler) Schedule(c echo.Context) error {
+	workflowID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+	}
+
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, workflowID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+
+	var req models.ScheduledRunRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if req.RunAt.IsZero() {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "run_at is required"})
+	}
+	if !req.RunAt.After(time.Now()) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "run_at must be in the future"})
+	}
+
+	if req.Input == nil {
+		req.Input = make(map[string]interface{})
+	}
+	inputJSON, err := json.Marshal(req.Input)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	run := models.ScheduledRun{
+		WorkflowID: workflow.ID,
+		RunAt:      req.RunAt,
+		InputData:  string(inputJSON),
+		Status:     schedule.RunScheduled,
+	}
+	if user := auth.CurrentUser(c); user != nil {
+		run.CreatedBy = user.ID
+	}
+
+	if err := database.DB.Create(&run).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, run)
+}
+
+// GetByWorkflowID godoc
+// @Summary Get scheduled runs of a workflow
+// @Description Returns the one-off runs of the workflow, by default only the ones still pending
+// @Tags schedules
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Param status query string false "scheduled (default), started, cancelled, failed or all"
+// @Success 200 {array} models.ScheduledRun
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/scheduled-runs [get]
+func (h *ScheduleHandler) GetByWorkflowID(c echo.Context) error {
+	workflowID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+	}
+
+	query := database.DB.Where("workflow_id = ?", workflowID)
+	switch status := c.QueryParam("status"); status {
+	case "":
+		query = query.Where("status = ?", schedule.RunScheduled)
+	case "all":
+	case schedule.RunScheduled, schedule.RunStarted, schedule.RunCancelled, schedule.RunFailed:
+		query = query.Where("status = ?", status)
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid status"})
+	}
+
+	var runs []models.ScheduledRun
+	if err := query.Order("run_at").Find(&runs).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, runs)
+}
+
+// GetByID godoc
+// @Summary Get scheduled run by ID
+// @Description Returns a one-off scheduled run and the execution it started
+// @Tags schedules
+// @Accept json
+// @Produce json
+// @Param id path int true "Scheduled run ID"
+// @Success 200 {object} models.ScheduledRun
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /scheduled-runs/{id} [get]
+func (h *ScheduleHandler) GetByID(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var run models.ScheduledRun
+	if err := database.DB.First(&run, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Scheduled run not found"})
+	}
+	return c.JSON(http.StatusOK, run)
+}
+
+// Cancel godoc
+// @Summary Cancel a scheduled run
+// @Description Cancels a one-off run that has not started yet
+// @Tags schedules
+// @Accept json
+// @Produce json
+// @Param id path int true "Scheduled run ID"
+// @Success 200 {object} models.ScheduledRun
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /scheduled-runs/{id}/cancel [post]
+func (h *ScheduleHandler) Cancel(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var run models.ScheduledRun
+	if err := database.DB.First(&run, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Scheduled run not found"})
+	}
+
+	// Only cancel the run if no worker has started it in the meantime
+	result := database.DB.Model(&run).Where("status = ?", schedule.RunScheduled).Update("status", schedule.RunCancelled)
+	if result.Error != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": result.Error.Error()})
+	}
+	if result.RowsAffected == 0 {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Scheduled run is no longer pending"})
+	}
+
+	return c.JSON(http.StatusOK, run)
+}
+
+// Time ranges of the calendar feed in days
+const (
+	defaultCalendarDays = 7
+	maxCalendarDays     = 31
+)
+
+// CreateCalendarToken godoc
+// @Summary Create a calendar feed link
+// @Description Returns the link of the user's iCalendar feed of scheduled runs for calendar apps, which authenticates with a token instead of the access token. A new link replaces the previous one.
+// @Tags schedules
+// @Accept json
+// @Produce json
+// @Success 201 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /calendar/token [post]
+func (h *ScheduleHandler) CreateCalendarToken(c echo.Context) error {
+	user := auth.CurrentUser(c)
+	token, err := auth.IssueCalendarToken(user.ID)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, map[string]string{
+		"url": strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/") + "/calendar/" + token + ".ics",
+	})
+}
+
+// RevokeCalendarToken godoc
+// @Summary Revoke the calendar feed link
+// @Description Stops the user's calendar feed link from working
+// @Tags schedules
+// @Accept json
+// @Produce json
+// @Success 204 "No Content"
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /calendar/token [delete]
+func (h *ScheduleHandler) RevokeCalendarToken(c echo.Context) error {
+	if err := auth.RevokeCalendarToken(auth.CurrentUser(c).ID); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetCalendar godoc
+// @Summary Get the calendar of scheduled runs
+// @Description Returns an iCalendar feed of the upcoming runs of schedule triggers and one-off runs and the results of recent scheduled executions of the user's organization
+// @Tags schedules
+// @Produce text/calendar
+// @Param days query int false "Days of upcoming runs (default 7, at most 31)"
+// @Param history_days query int false "Days of recent results (default 7, at most 31)"
+// @Success 200 {string} string "iCalendar feed"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /calendar.ics [get]
+func (h *ScheduleHandler) GetCalendar(c echo.Context) error {
+	return h.calendar(c, auth.CurrentUser(c))
+}
+
+// GetCalendarFeed godoc
+// @Summary Get the calendar of scheduled runs by feed link
+// @Description Returns the iCalendar feed of GET /calendar.ics for calendar apps, authenticated by the token of the user's feed link
+// @Tags schedules
+// @Produce text/calendar
+// @Param token path string true "Token of the feed link, optionally with the suffix .ics"
+// @Param days query int false "Days of upcoming runs (default 7, at most 31)"
+// @Param history_days query int false "Days of recent results (default 7, at most 31)"
+// @Success 200 {string} string "iCalendar feed"
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /calendar/{token} [get]
+func (h *ScheduleHandler) GetCalendarFeed(c echo.Context) error {
+	user, err := auth.AuthenticateCalendarToken(strings.TrimSuffix(c.Param("token"), ".ics"))
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": "Invalid calendar token"})
+	}
+	return h.calendar(c, user)
+}
+
+// calendar responds with the calendar feed for the user, of all workflows if the user belongs to
+// no organization or authentication is not required
+func (h *ScheduleHandler) calendar(c echo.Context, user *models.User) error {
+	opts := schedule.FeedOptions{
+		Horizon: defaultCalendarDays * 24 * time.Hour,
+		History: defaultCalendarDays * 24 * time.Hour,
+	}
+	for param, value := range map[string]*time.Duration{"days": &opts.Horizon, "history_days": &opts.History} {
+		if raw := c.QueryParam(param); raw != "" {
+			days, err := strconv.Atoi(raw)
+			if err != nil || days < 0 || days > maxCalendarDays {
+				return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid %s, expected 0 to %d", param, maxCalendarDays)})
+			}
+			*value = time.Duration(days) * 24 * time.Hour
+		}
+	}
+	if user != nil {
+		opts.OrganizationID = user.OrganizationID
+	}
+
+	feed, err := schedule.Feed(opts, time.Now())
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.Blob(http.StatusOK, "text/calendar; charset=utf-8", []byte(feed))
+}
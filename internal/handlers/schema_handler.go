@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/schemas"
+	"github.com/labstack/echo/v4"
+)
+
+// SchemaHandler manages the HTTP requests for the payload schema registry
+type SchemaHandler struct{}
+
+// NewSchemaHandler creates a new SchemaHandler
+func NewSchemaHandler() *SchemaHandler {
+	return &SchemaHandler{}
+}
+
+// SchemaUsage lists the triggers and the event nodes using a payload schema
+type SchemaUsage struct {
+	Triggers []models.Trigger `json:"triggers"`
+	Nodes    []SchemaNode     `json:"nodes"`
+}
+
+// SchemaNode is an emitEvent or waitForEvent node of the event named like a payload schema
+type SchemaNode struct {
+	NodeID     uint   `json:"node_id"`
+	WorkflowID uint   `json:"workflow_id"`
+	Name       string `json:"name"`
+	NodeType   string `json:"node_type"`
+}
+
+// GetAll godoc
+// @Summary Get payload schemas
+// @Description Returns the latest version of each schema of the registry, by name
+// @Tags schemas
+// @Accept json
+// @Produce json
+// @Success 200 {array} models.PayloadSchema
+// @Failure 500 {object} map[string]string
+// @Router /schemas [get]
+func (h *SchemaHandler) GetAll(c echo.Context) error {
+	latest := []models.PayloadSchema{}
+	err := database.Replica().
+		Where("version = (SELECT MAX(version) FROM payload_schemas latest WHERE latest.name = payload_schemas.name)").
+		Order("name").Find(&latest).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, latest)
+}
+
+// GetVersions godoc
+// @Summary Get the versions of a payload schema
+// @Description Returns all versions of a schema, newest first
+// @Tags schemas
+// @Accept json
+// @Produce json
+// @Param name path string true "Schema name"
+// @Success 200 {array} models.PayloadSchema
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /schemas/{name}/versions [get]
+func (h *SchemaHandler) GetVersions(c echo.Context) error {
+	versions := []models.PayloadSchema{}
+	if err := database.Replica().Where("name = ?", c.Param("name")).Order("version DESC").Find(&versions).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if len(versions) == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Schema not found"})
+	}
+	return c.JSON(http.StatusOK, versions)
+}
+
+// GetVersion godoc
+// @Summary Get a version of a payload schema
+// @Description Returns a version of a schema, the latest for version "latest"
+// @Tags schemas
+// @Accept json
+// @Produce json
+// @Param name path string true "Schema name"
+// @Param version path string true "Version number or latest"
+// @Success 200 {object} models.PayloadSchema
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /schemas/{name}/versions/{version} [get]
+func (h *SchemaHandler) GetVersion(c echo.Context) error {
+	version := 0
+	if param := c.Param("version"); param != "latest" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid version"})
+		}
+		version = parsed
+	}
+
+	schema, err := schemas.Get(c.Param("name"), version)
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Schema not found"})
+	}
+	return c.JSON(http.StatusOK, schema)
+}
+
+// Register godoc
+// @Summary Register a payload schema version
+// @Description Registers a schema, or a new version of it if the name is taken. New versions must be compatible with the previous version in the compatibility mode of the schema: forward (default) if payloads of the new version are valid under the previous one, backward for the reverse, full for both, none to accept any change. With dry_run the compatibility is only checked.
+// @Tags schemas
+// @Accept json
+// @Produce json
+// @Param schema body models.PayloadSchemaRequest true "Schema"
+// @Param dry_run query bool false "Only check the compatibility with the previous version"
+// @Success 200 {object} models.SchemaCompatibility
+// @Success 201 {object} models.PayloadSchema
+// @Failure 400 {object} map[string]string
+// @Failure 409 {object} models.SchemaCompatibility
+// @Failure 500 {object} map[string]string
+// @Router /schemas [post]
+func (h *SchemaHandler) Register(c echo.Context) error {
+	var request models.PayloadSchemaRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if c.QueryParam("dry_run") == "true" {
+		result, err := schemas.CheckCompatibility(request)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+
+	var userID *uint
+	if user := auth.CurrentUser(c); user != nil {
+		userID = &user.ID
+	}
+	schema, err := schemas.Register(request, userID)
+	var incompatible *schemas.IncompatibleError
+	if errors.As(err, &incompatible) {
+		return c.JSON(http.StatusConflict, incompatible.Result)
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, schema)
+}
+
+// GetUsage godoc
+// @Summary Get the users of a payload schema
+// @Description Returns the triggers validating their requests with the schema and the emitEvent and waitForEvent nodes of the event named like the schema, i.e. the producers and consumers affected by new versions
+// @Tags schemas
+// @Accept json
+// @Produce json
+// @Param name path string true "Schema name"
+// @Success 200 {object} SchemaUsage
+// @Failure 500 {object} map[string]string
+// @Router /schemas/{name}/usage [get]
+func (h *SchemaHandler) GetUsage(c echo.Context) error {
+	name := c.Param("name")
+	usage := SchemaUsage{Triggers: []models.Trigger{}, Nodes: []SchemaNode{}}
+	db := database.Replica()
+
+	if err := db.Where("payload_schema = ?", name).Order("id").Find(&usage.Triggers).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	err := db.Model(&models.Node{}).
+		Select("id AS node_id, workflow_id, name, node_type").
+		Where("node_type IN ? AND config->>'name' = ?", []string{"emitEvent", "waitForEvent"}, name).
+		Order("id").Scan(&usage.Nodes).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, usage)
+}
@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/redact"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Lifetimes of share links
+const (
+	defaultShareTTL = 7 * 24 * time.Hour
+	maxShareTTL     = 30 * 24 * time.Hour
+)
+
+// sharePayloadPrefix marks signed values that are share links
+const sharePayloadPrefix = "execution-share|"
+
+// ShareHandler manages the HTTP requests for read-only share links of executions
+type ShareHandler struct{}
+
+// NewShareHandler creates a new ShareHandler
+func NewShareHandler() *ShareHandler {
+	return &ShareHandler{}
+}
+
+// Create godoc
+// @Summary Share an execution
+// @Description Creates a signed, expiring link to the timeline and outputs of an execution that can be opened without an account, e.g. by the support team of a vendor. Personal data is redacted unless redacted is false.
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Param share body models.ShareRequest false "Lifetime and redaction of the link"
+// @Success 201 {object} models.ExecutionShare
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id}/shares [post]
+func (h *ShareHandler) Create(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+	if !auth.CanSign() {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "AUTH_SECRET is not set, share links cannot be signed"})
+	}
+
+	var req models.ShareRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	ttl := defaultShareTTL
+	if req.ExpiresIn != "" {
+		ttl, err = time.ParseDuration(req.ExpiresIn)
+		if err != nil || ttl <= 0 || ttl > maxShareTTL {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid expires_in, expected a duration up to %s", maxShareTTL)})
+		}
+	}
+
+	var execution models.WorkflowExecution
+	if err := database.DB.First(&execution, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Execution not found"})
+	}
+
+	share := models.ExecutionShare{
+		WorkflowExecutionID: execution.ID,
+		Redacted:            req.Redacted == nil || *req.Redacted,
+		ExpiresAt:           time.Now().Add(ttl).Truncate(time.Second),
+	}
+	if user := auth.CurrentUser(c); user != nil {
+		share.CreatedBy = user.ID
+	}
+	if err := database.DB.Create(&share).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	// The link carries the share, so it can be checked for revocation
+	token := auth.SignValue(sharePayloadPrefix+strconv.FormatUint(uint64(share.ID), 10), share.ExpiresAt)
+	share.URL = strings.TrimSuffix(os.Getenv("PUBLIC_URL"), "/") + "/shared/executions/" + token
+
+	return c.JSON(http.StatusCreated, share)
+}
+
+// GetAll godoc
+// @Summary Get the share links of an execution
+// @Description Returns the share links created for an execution, including expired and revoked ones. The links themselves are only returned on creation.
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Success 200 {array} models.ExecutionShare
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id}/shares [get]
+func (h *ShareHandler) GetAll(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	shares := []models.ExecutionShare{}
+	if err := database.DB.Where("workflow_execution_id = ?", id).Order("id").Find(&shares).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, shares)
+}
+
+// Revoke godoc
+// @Summary Revoke a share link
+// @Description Revokes a share link of an execution before it expires
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Param share_id path int true "Share ID"
+// @Success 200 {object} models.ExecutionShare
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id}/shares/{share_id} [delete]
+func (h *ShareHandler) Revoke(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+	shareID, err := strconv.Atoi(c.Param("share_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid share ID"})
+	}
+
+	var share models.ExecutionShare
+	if err := database.DB.Where("workflow_execution_id = ?", id).First(&share, shareID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Share not found"})
+	}
+	if share.RevokedAt == nil {
+		now := time.Now()
+		share.RevokedAt = &now
+		if err := database.DB.Model(&share).Update("revoked_at", now).Error; err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+	}
+	return c.JSON(http.StatusOK, share)
+}
+
+// GetShared godoc
+// @Summary Get a shared execution
+// @Description Returns the timeline and outputs of the execution behind a share link, without authentication
+// @Tags executions
+// @Produce json
+// @Param token path string true "Token of the share link"
+// @Success 200 {object} models.SharedExecution
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /shared/executions/{token} [get]
+func (h *ShareHandler) GetShared(c echo.Context) error {
+	// Invalid, expired and revoked links are indistinguishable for their holder
+	notFound := func() error {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Share link not found or expired"})
+	}
+	payload, err := auth.VerifyValue(c.Param("token"))
+	if err != nil || !strings.HasPrefix(payload, sharePayloadPrefix) {
+		return notFound()
+	}
+	shareID, err := strconv.Atoi(strings.TrimPrefix(payload, sharePayloadPrefix))
+	if err != nil {
+		return notFound()
+	}
+
+	var share models.ExecutionShare
+	if err := database.DB.First(&share, shareID).Error; err != nil {
+		return notFound()
+	}
+	if share.RevokedAt != nil || time.Now().After(share.ExpiresAt) {
+		return notFound()
+	}
+
+	var execution models.WorkflowExecution
+	if err := database.Replica().Preload("Workflow").First(&execution, share.WorkflowExecutionID).Error; err != nil {
+		return notFound()
+	}
+
+	var nodeExecutions []sharedNodeRow
+	if execution.ArchivedAt != nil {
+		err = rehydrateSharedNodes(c, &execution, &nodeExecutions)
+	} else {
+		err = database.Replica().Model(&models.NodeExecution{}).
+			Select("node_executions.*, nodes.name, nodes.node_type").
+			Joins("LEFT JOIN nodes ON nodes.id = node_executions.node_id").
+			Where("node_executions.workflow_execution_id = ?", execution.ID).
+			Order("node_executions.started_at, node_executions.id").
+			Scan(&nodeExecutions).Error
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	var redaction *redact.Redaction
+	if share.Redacted {
+		redaction = redact.New()
+	}
+	shared := models.SharedExecution{
+		ExecutionID:  execution.ID,
+		WorkflowName: execution.Workflow.Name,
+		Status:       execution.Status,
+		StartedAt:    execution.StartedAt,
+		CompletedAt:  execution.CompletedAt,
+		ErrorMessage: sharedText(execution.ErrorMessage, redaction),
+		Output:       sharedPayload(execution.OutputData, redaction),
+		Redacted:     share.Redacted,
+		ExpiresAt:    share.ExpiresAt,
+		Nodes:        make([]models.SharedNodeExecution, len(nodeExecutions)),
+	}
+	for i, ne := range nodeExecutions {
+		shared.Nodes[i] = models.SharedNodeExecution{
+			NodeID:        ne.NodeID,
+			Name:          ne.Name,
+			NodeType:      ne.NodeType,
+			Status:        ne.Status,
+			Attempt:       ne.Attempt,
+			StartedAt:     ne.StartedAt,
+			CompletedAt:   ne.CompletedAt,
+			DurationMs:    ne.DurationMs,
+			ErrorMessage:  sharedText(ne.ErrorMessage, redaction),
+			ErrorCode:     ne.ErrorCode,
+			ErrorCategory: ne.ErrorCategory,
+			Output:        sharedPayload(ne.OutputData, redaction),
+		}
+	}
+
+	database.DB.Model(&share).Updates(map[string]interface{}{
+		"views":          gorm.Expr("views + 1"),
+		"last_viewed_at": time.Now(),
+	})
+
+	return c.JSON(http.StatusOK, shared)
+}
+
+// sharedNodeRow is a node execution of a shared execution with the name and type of its node
+type sharedNodeRow struct {
+	models.NodeExecution
+	Name     string
+	NodeType string
+}
+
+// rehydrateSharedNodes loads the node executions of an archived execution from the archive,
+// with the names and types of their nodes
+func rehydrateSharedNodes(c echo.Context, execution *models.WorkflowExecution, nodeExecutions *[]sharedNodeRow) error {
+	if err := rehydrateExecution(c, execution); err != nil {
+		return err
+	}
+
+	nodeIDs := make([]uint, len(execution.NodeExecutions))
+	for i, ne := range execution.NodeExecutions {
+		nodeIDs[i] = ne.NodeID
+	}
+	var nodes []models.Node
+	if err := database.Replica().Where("id IN ?", nodeIDs).Find(&nodes).Error; err != nil {
+		return err
+	}
+	byID := make(map[uint]models.Node, len(nodes))
+	for _, node := range nodes {
+		byID[node.ID] = node
+	}
+
+	sort.SliceStable(execution.NodeExecutions, func(i, j int) bool {
+		a, b := execution.NodeExecutions[i].StartedAt, execution.NodeExecutions[j].StartedAt
+		return a != nil && (b == nil || a.Before(*b))
+	})
+	for _, ne := range execution.NodeExecutions {
+		node := byID[ne.NodeID]
+		*nodeExecutions = append(*nodeExecutions, sharedNodeRow{ne, node.Name, node.NodeType})
+	}
+	return nil
+}
+
+// sharedText redacts a message of a shared execution, if the share is redacted
+func sharedText(text string, redaction *redact.Redaction) string {
+	if redaction == nil {
+		return text
+	}
+	return redaction.Text(text)
+}
+
+// sharedPayload decodes a payload of a shared execution and redacts it, if the share is redacted
+func sharedPayload(data string, redaction *redact.Redaction) interface{} {
+	var value interface{}
+	if data == "" || json.Unmarshal([]byte(data), &value) != nil {
+		return nil
+	}
+	if redaction == nil {
+		return value
+	}
+	return redaction.Value(value)
+}
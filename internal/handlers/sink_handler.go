@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/sink"
+	"github.com/labstack/echo/v4"
+)
+
+// SinkHandler manages the HTTP requests for output sinks and their deliveries
+type SinkHandler struct{}
+
+// NewSinkHandler creates a new SinkHandler
+func NewSinkHandler() *SinkHandler {
+	return &SinkHandler{}
+}
+
+// GetByWorkflowID godoc
+// @Summary Get output sinks of a workflow
+// @Description Returns the output sinks the workflow's completed executions are delivered to
+// @Tags sinks
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Success 200 {array} models.OutputSink
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/sinks [get]
+func (h *SinkHandler) GetByWorkflowID(c echo.Context) error {
+	workflowID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+	}
+
+	var sinks []models.OutputSink
+	if err := database.DB.Where("workflow_id = ?", workflowID).Find(&sinks).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, sinks)
+}
+
+// Create godoc
+// @Summary Create an output sink
+// @Description Creates an output sink (webhook, s3 or database) for a workflow
+// @Tags sinks
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Param sink body models.OutputSink true "Sink data"
+// @Success 201 {object} models.OutputSink
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/sinks [post]
+func (h *SinkHandler) Create(c echo.Context) error {
+	workflowID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+	}
+
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, workflowID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+
+	outputSink := models.OutputSink{IsActive: true}
+	if err := c.Bind(&outputSink); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	outputSink.ID = 0
+	outputSink.WorkflowID = workflow.ID
+
+	if err := validateSink(&outputSink); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := database.DB.Create(&outputSink).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, outputSink)
+}
+
+// Update godoc
+// @Summary Update an output sink
+// @Description Updates an existing output sink
+// @Tags sinks
+// @Accept json
+// @Produce json
+// @Param id path int true "Sink ID"
+// @Param sink body models.OutputSink true "Updated sink data"
+// @Success 200 {object} models.OutputSink
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /sinks/{id} [put]
+func (h *SinkHandler) Update(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var outputSink models.OutputSink
+	if err := database.DB.First(&outputSink, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Sink not found"})
+	}
+
+	workflowID := outputSink.WorkflowID
+	if err := c.Bind(&outputSink); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	outputSink.ID = uint(id)
+	outputSink.WorkflowID = workflowID
+
+	if err := validateSink(&outputSink); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := database.DB.Save(&outputSink).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, outputSink)
+}
+
+// Delete godoc
+// @Summary Delete an output sink
+// @Description Deletes an output sink based on its ID
+// @Tags sinks
+// @Accept json
+// @Produce json
+// @Param id path int true "Sink ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /sinks/{id} [delete]
+func (h *SinkHandler) Delete(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	if err := database.DB.Delete(&models.OutputSink{}, id).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetDeliveries godoc
+// @Summary Get output deliveries of an execution
+// @Description Returns the delivery status of an execution's output for each sink
+// @Tags sinks
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Success 200 {array} models.OutputDelivery
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id}/deliveries [get]
+func (h *SinkHandler) GetDeliveries(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var deliveries []models.OutputDelivery
+	if err := database.Replica().Where("workflow_execution_id = ?", id).Order("id").Find(&deliveries).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+// RetryDelivery godoc
+// @Summary Retry a failed delivery
+// @Description Delivers the execution's output to the sink again
+// @Tags sinks
+// @Accept json
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Success 200 {object} models.OutputDelivery
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /deliveries/{id}/retry [post]
+func (h *SinkHandler) RetryDelivery(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var delivery models.OutputDelivery
+	if err := database.DB.Preload("OutputSink").First(&delivery, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Delivery not found"})
+	}
+	if delivery.Status != "failed" {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Only failed deliveries can be retried"})
+	}
+
+	var execution models.WorkflowExecution
+	if err := database.DB.First(&execution, delivery.WorkflowExecutionID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Execution not found"})
+	}
+
+	sink.Deliver(&delivery, delivery.OutputSink, &execution)
+
+	return c.JSON(http.StatusOK, delivery)
+}
+
+// GetWarehouseExports godoc
+// @Summary Get warehouse exports
+// @Description Returns the exports streaming execution records to data warehouses, with their position and last run
+// @Tags sinks
+// @Accept json
+// @Produce json
+// @Success 200 {array} models.WarehouseExport
+// @Failure 500 {object} map[string]string
+// @Router /admin/warehouse-exports [get]
+func (h *SinkHandler) GetWarehouseExports(c echo.Context) error {
+	var exports []models.WarehouseExport
+	if err := database.DB.Order("id").Find(&exports).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, exports)
+}
+
+// CreateWarehouseExport godoc
+// @Summary Create a warehouse export
+// @Description Creates an export streaming completed executions and node executions (flattened, with personal data redacted) to BigQuery, Snowflake, ClickHouse or S3 at the given interval. The first run exports all completed executions.
+// @Tags sinks
+// @Accept json
+// @Produce json
+// @Param export body models.WarehouseExport true "Export data"
+// @Success 201 {object} models.WarehouseExport
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/warehouse-exports [post]
+func (h *SinkHandler) CreateWarehouseExport(c echo.Context) error {
+	var export models.WarehouseExport
+	if err := c.Bind(&export); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	export = models.WarehouseExport{
+		Name:            export.Name,
+		Destination:     export.Destination,
+		Config:          export.Config,
+		Interval:        export.Interval,
+		IncludePayloads: export.IncludePayloads,
+		Paused:          export.Paused,
+	}
+
+	if err := sink.ValidateWarehouseExport(&export); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := database.DB.Create(&export).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, export)
+}
+
+// UpdateWarehouseExport godoc
+// @Summary Update a warehouse export
+// @Description Updates the destination, config, interval and payload setting of an export or pauses it. The position of the export is kept.
+// @Tags sinks
+// @Accept json
+// @Produce json
+// @Param id path int true "Export ID"
+// @Param export body models.WarehouseExport true "Updated export data"
+// @Success 200 {object} models.WarehouseExport
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/warehouse-exports/{id} [put]
+func (h *SinkHandler) UpdateWarehouseExport(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var export models.WarehouseExport
+	if err := database.DB.First(&export, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Warehouse export not found"})
+	}
+
+	var update models.WarehouseExport
+	if err := c.Bind(&update); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	export.Name = update.Name
+	export.Destination = update.Destination
+	export.Config = update.Config
+	export.Interval = update.Interval
+	export.IncludePayloads = update.IncludePayloads
+	export.Paused = update.Paused
+
+	if err := sink.ValidateWarehouseExport(&export); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := database.DB.Save(&export).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, export)
+}
+
+// DeleteWarehouseExport godoc
+// @Summary Delete a warehouse export
+// @Description Deletes a warehouse export, the exported records are kept in the destination
+// @Tags sinks
+// @Accept json
+// @Produce json
+// @Param id path int true "Export ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/warehouse-exports/{id} [delete]
+func (h *SinkHandler) DeleteWarehouseExport(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	if err := database.DB.Delete(&models.WarehouseExport{}, id).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// RunWarehouseExport godoc
+// @Summary Run a warehouse export now
+// @Description Schedules the next run of an export immediately, a worker picks it up within a minute
+// @Tags sinks
+// @Accept json
+// @Produce json
+// @Param id path int true "Export ID"
+// @Success 202 {object} models.WarehouseExport
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /admin/warehouse-exports/{id}/run [post]
+func (h *SinkHandler) RunWarehouseExport(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var export models.WarehouseExport
+	if err := database.DB.First(&export, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Warehouse export not found"})
+	}
+	if export.Paused {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Warehouse export is paused"})
+	}
+
+	now := time.Now()
+	if err := database.DB.Model(&export).Update("next_run_at", now).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusAccepted, export)
+}
+
+// validateSink checks the sink type and config of a sink
+func validateSink(outputSink *models.OutputSink) error {
+	if _, err := sink.NewDeliverer(outputSink.SinkType); err != nil {
+		return err
+	}
+
+	if outputSink.Config == "" {
+		outputSink.Config = "{}"
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(outputSink.Config), &config); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/credentials"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/slack"
+	"github.com/altipard/flowcraft/internal/webhook"
+	"github.com/labstack/echo/v4"
+)
+
+// ReceiveSlack godoc
+// @Summary Receive a Slack slash command or interaction
+// @Description Verifies the signature of a Slack slash command or interactivity request with the signing secret of the trigger's slack credential and starts an execution of the trigger's workflow. The fields of the request are the body of the execution input. The request waits up to 2.5 seconds for a slackRespond node of the execution to respond; otherwise it is answered with the trigger's acknowledgement and the nodes respond at the request's response URL.
+// @Tags triggers
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param path path string true "Webhook path of the trigger"
+// @Success 200 {object} slack.Message
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /slack/{path} [post]
+func (h *TriggerHandler) ReceiveSlack(c echo.Context) error {
+	deadline := time.Now().Add(slack.ResponseWindow)
+
+	var trigger models.Trigger
+	err := database.DB.Where("webhook_path = ? AND trigger_type = ? AND is_active = ?", c.Param("path"), slack.TriggerType, true).
+		First(&trigger).Error
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Trigger not found"})
+	}
+	cfg, err := slack.ParseConfig(trigger.Config)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, trigger.WorkflowID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+	secret, err := credentials.Resolve(cfg.CredentialID, workflow.OrganizationID, slack.CredentialType)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, webhook.MaxBodySize()+1))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if int64(len(body)) > webhook.MaxBodySize() {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "Request body too large"})
+	}
+	header := c.Request().Header
+	if err := slack.Verify(secret["signing_secret"], header.Get("X-Slack-Request-Timestamp"), header.Get("X-Slack-Signature"), body, time.Now()); err != nil {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"error": err.Error()})
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	// Slack checks the certificate of the request URL with signed requests without a command
+	if values.Get("ssl_check") == "1" {
+		return c.NoContent(http.StatusOK)
+	}
+	input, err := slack.Input(values)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// The mapped fields are delivered as JSON body, like the values of form triggers
+	inputJSON, _ := json.Marshal(input)
+	delivery := webhook.NewDelivery(trigger, c.Request().Method, c.QueryParams(), header, inputJSON)
+	delivery.ContentType = echo.MIMEApplicationJSON
+
+	status, response := h.accept(trigger, &delivery)
+	if status >= http.StatusBadRequest {
+		// Slack only shows the responses of successful requests to the user
+		message, _ := response["error"].(string)
+		return c.JSON(http.StatusOK, slack.Message{Text: "The workflow could not be started: " + message, ResponseType: slack.ResponseEphemeral})
+	}
+
+	if executionID, ok := response["execution_id"].(uint); ok && status == http.StatusAccepted {
+		responseURL, _ := input["response_url"].(string)
+		message, err := slack.Await(c.Request().Context(), executionID, responseURL, deadline)
+		if err != nil {
+			log.Printf("Slack trigger %d: failed to wait for the response of execution %d: %v", trigger.ID, executionID, err)
+		}
+		if message != nil {
+			return c.JSON(http.StatusOK, message)
+		}
+	}
+
+	if cfg.Acknowledgement == "" {
+		return c.NoContent(http.StatusOK)
+	}
+	return c.JSON(http.StatusOK, slack.Message{Text: cfg.Acknowledgement, ResponseType: cfg.ResponseType})
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/state"
+	"github.com/labstack/echo/v4"
+)
+
+// StateHandler manages the HTTP requests for the key-value state store
+type StateHandler struct{}
+
+// NewStateHandler creates a new StateHandler
+func NewStateHandler() *StateHandler {
+	return &StateHandler{}
+}
+
+// SetStateRequest represents the input data for setting a value
+type SetStateRequest struct {
+	Value interface{} `json:"value"`
+	TTL   string      `json:"ttl"` // e.g. "24h", empty keeps the value until it is deleted
+}
+
+// IncrStateRequest represents the input data for incrementing a value
+type IncrStateRequest struct {
+	Delta *float64 `json:"delta"` // defaults to 1
+	TTL   string   `json:"ttl"`
+}
+
+// Get godoc
+// @Summary Get a state value
+// @Description Returns the value of a key of the state store
+// @Tags state
+// @Accept json
+// @Produce json
+// @Param scope path string true "Scope (global, workflow, trigger)"
+// @Param key path string true "Key"
+// @Param scope_id query int false "Workflow or trigger ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /state/{scope}/{key} [get]
+func (h *StateHandler) Get(c echo.Context) error {
+	scope, err := stateScope(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	value, err := state.Get(scope, c.Param("key"))
+	if errors.Is(err, state.ErrNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Key not found"})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"key": c.Param("key"), "value": value})
+}
+
+// Set godoc
+// @Summary Set a state value
+// @Description Stores the value of a key of the state store, optionally expiring after a TTL
+// @Tags state
+// @Accept json
+// @Produce json
+// @Param scope path string true "Scope (global, workflow, trigger)"
+// @Param key path string true "Key"
+// @Param scope_id query int false "Workflow or trigger ID"
+// @Param value body SetStateRequest true "Value"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /state/{scope}/{key} [put]
+func (h *StateHandler) Set(c echo.Context) error {
+	scope, err := stateScope(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	var request SetStateRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	ttl, err := parseTTL(request.TTL)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := state.Set(scope, c.Param("key"), request.Value, ttl); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"key": c.Param("key"), "value": request.Value})
+}
+
+// Incr godoc
+// @Summary Increment a state value
+// @Description Atomically adds delta to a numeric value of the state store. Missing keys start at 0.
+// @Tags state
+// @Accept json
+// @Produce json
+// @Param scope path string true "Scope (global, workflow, trigger)"
+// @Param key path string true "Key"
+// @Param scope_id query int false "Workflow or trigger ID"
+// @Param increment body IncrStateRequest false "Increment"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /state/{scope}/{key}/incr [post]
+func (h *StateHandler) Incr(c echo.Context) error {
+	scope, err := stateScope(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	var request IncrStateRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	delta := 1.0
+	if request.Delta != nil {
+		delta = *request.Delta
+	}
+	ttl, err := parseTTL(request.TTL)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	value, err := state.Incr(scope, c.Param("key"), delta, ttl)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, map[string]interface{}{"key": c.Param("key"), "value": value})
+}
+
+// Delete godoc
+// @Summary Delete a state value
+// @Description Removes a key from the state store
+// @Tags state
+// @Accept json
+// @Produce json
+// @Param scope path string true "Scope (global, workflow, trigger)"
+// @Param key path string true "Key"
+// @Param scope_id query int false "Workflow or trigger ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /state/{scope}/{key} [delete]
+func (h *StateHandler) Delete(c echo.Context) error {
+	scope, err := stateScope(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := state.Delete(scope, c.Param("key")); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// stateScope reads the scope of a state request from the path and the scope_id parameter
+func stateScope(c echo.Context) (state.Scope, error) {
+	var id uint
+	if value := c.QueryParam("scope_id"); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return state.Scope{}, errors.New("invalid scope_id")
+		}
+		id = uint(parsed)
+	}
+	return state.ParseScope(c.Param("scope"), id)
+}
+
+// parseTTL parses an optional duration
+func parseTTL(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	ttl, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.New("invalid ttl")
+	}
+	return ttl, nil
+}
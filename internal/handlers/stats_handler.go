@@ -0,0 +1,947 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/cache"
+	"github.com/altipard/flowcraft/internal/capacity"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/queue"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// Stats overview settings
+const (
+	// overviewCacheTTL is how long an overview is served from the cache
+	overviewCacheTTL = time.Minute
+	// maxOverviewRange bounds the time range of an overview
+	maxOverviewRange = 31 * 24 * time.Hour
+	// workerMaxAge is how long a worker counts as live after its last report
+	workerMaxAge = 30 * time.Second
+	// maxAnomalyNodes is the number of nodes listed per execution with an unusual duration
+	maxAnomalyNodes = 3
+)
+
+// StatsHandler manages the HTTP requests for usage statistics
+type StatsHandler struct {
+	queueClient *queue.QueueClient
+}
+
+// NewStatsHandler creates a new StatsHandler
+func NewStatsHandler(queueClient *queue.QueueClient) *StatsHandler {
+	return &StatsHandler{queueClient: queueClient}
+}
+
+// StatsOverview sums up the operation of the installation over a time range for ops dashboards
+type StatsOverview struct {
+	From                time.Time              `json:"from"`
+	To                  time.Time              `json:"to"`
+	Hours               []HourlyStats          `json:"hours"`
+	TopFailingWorkflows []FailingWorkflowStats `json:"top_failing_workflows"`
+	SLABreaches         []SLABreachStats       `json:"sla_breaches"`
+	QueueWait           QueueWaitStats         `json:"queue_wait"`
+	Workers             WorkerStats            `json:"workers"`
+	GeneratedAt         time.Time              `json:"generated_at"`
+}
+
+// HourlyStats counts the executions started in an hour by status
+type HourlyStats struct {
+	Hour           time.Time        `json:"hour"`
+	Executions     map[string]int64 `json:"executions"`
+	Total          int64            `json:"total"`
+	AvgQueueWaitMs float64          `json:"avg_queue_wait_ms"`
+	SLABreaches    int64            `json:"sla_breaches"`
+	// Utilization is the share of the hour the workers were busy, nil if no worker reported
+	Utilization *float64 `json:"utilization"`
+}
+
+// FailingWorkflowStats counts the failed executions of a workflow, including its published versions
+type FailingWorkflowStats struct {
+	WorkflowID  uint    `json:"workflow_id"`
+	Name        string  `json:"name"`
+	Failed      int64   `json:"failed"`
+	Finished    int64   `json:"finished"`
+	FailureRate float64 `json:"failure_rate"`
+}
+
+// SLABreachStats counts the SLA breaches of a workflow
+type SLABreachStats struct {
+	WorkflowID          uint   `json:"workflow_id"`
+	Name                string `json:"name"`
+	DurationBreaches    int64  `json:"duration_breaches"`
+	FailureRateBreaches int64  `json:"failure_rate_breaches"`
+}
+
+// QueueWaitStats describes how long executions waited for a worker after they were due
+type QueueWaitStats struct {
+	Executions int64   `json:"executions"`
+	AvgMs      float64 `json:"avg_ms"`
+	P50Ms      float64 `json:"p50_ms"`
+	P95Ms      float64 `json:"p95_ms"`
+	P99Ms      float64 `json:"p99_ms"`
+	MaxMs      float64 `json:"max_ms"`
+}
+
+// WorkerStats describes the live workers
+type WorkerStats struct {
+	Live        int                  `json:"live"`
+	Busy        int                  `json:"busy"`
+	Utilization float64              `json:"utilization"`
+	Workers     []queue.WorkerStatus `json:"workers"`
+	// Panics counts the panics of executors of the live worker processes by executor class
+	Panics map[string]int64 `json:"panics"`
+}
+
+// queueWaitMs is the time an execution waited for a worker after it was created or released by
+// the controls of its trigger
+const queueWaitMs = `EXTRACT(EPOCH FROM (started_at - GREATEST(created_at, COALESCE(queued_until, created_at)))) * 1000`
+
+// executionQueueWaitMs is queueWaitMs for queries joining the executions with other tables
+const executionQueueWaitMs = `EXTRACT(EPOCH FROM (workflow_executions.started_at - GREATEST(workflow_executions.created_at, ` +
+	`COALESCE(workflow_executions.queued_until, workflow_executions.created_at)))) * 1000`
+
+// QueueWaitGroupStats describes how long the executions of an organization or workflow waited for a worker
+type QueueWaitGroupStats struct {
+	OrganizationID uint   `json:"organization_id"`
+	WorkflowID     uint   `json:"workflow_id,omitempty"`
+	Name           string `json:"name"`
+	QueueWaitStats
+}
+
+// Overview godoc
+// @Summary Get an overview of the operation
+// @Description Returns the executions and SLA breaches per hour, the workflows failing most and breaching their SLA most, queue wait times and worker utilization over a time range (default the last 24 hours), for ops dashboards like Grafana. Overviews are cached for a minute.
+// @Tags stats
+// @Accept json
+// @Produce json
+// @Param from query string false "Start of the time range (RFC3339)"
+// @Param to query string false "End of the time range (RFC3339, default now)"
+// @Param top query int false "Number of failing and SLA breaching workflows (default 10)"
+// @Success 200 {object} StatsOverview
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /stats/overview [get]
+func (h *StatsHandler) Overview(c echo.Context) error {
+	to := time.Now().Truncate(time.Minute)
+	if param := c.QueryParam("to"); param != "" {
+		parsed, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid to parameter, expected RFC3339"})
+		}
+		to = parsed
+	}
+	from := to.Add(-24 * time.Hour)
+	if param := c.QueryParam("from"); param != "" {
+		parsed, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid from parameter, expected RFC3339"})
+		}
+		from = parsed
+	}
+	if !from.Before(to) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must be before to"})
+	}
+	if to.Sub(from) > maxOverviewRange {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("The time range must not exceed %s", maxOverviewRange)})
+	}
+
+	top := 10
+	if param := c.QueryParam("top"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed <= 0 || parsed > 100 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid top, expected 1 to 100"})
+		}
+		top = parsed
+	}
+
+	ctx := c.Request().Context()
+	key := fmt.Sprintf("stats:overview:%d:%d:%d", from.Unix(), to.Unix(), top)
+	var overview StatsOverview
+	if found, _ := cache.Get(ctx, key, &overview); found {
+		return c.JSON(http.StatusOK, overview)
+	}
+
+	overview, err := h.overview(from, to, top)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	cache.Set(ctx, key, overview, overviewCacheTTL)
+
+	return c.JSON(http.StatusOK, overview)
+}
+
+func (h *StatsHandler) overview(from, to time.Time, top int) (StatsOverview, error) {
+	overview := StatsOverview{From: from, To: to, GeneratedAt: time.Now()}
+	db := database.Replica()
+
+	// One entry per hour of the range, also for hours without executions
+	hours := map[int64]*HourlyStats{}
+	for hour := from.UTC().Truncate(time.Hour); hour.Before(to); hour = hour.Add(time.Hour) {
+		overview.Hours = append(overview.Hours, HourlyStats{Hour: hour, Executions: map[string]int64{}})
+	}
+	for i := range overview.Hours {
+		hours[overview.Hours[i].Hour.Unix()] = &overview.Hours[i]
+	}
+
+	var counts []struct {
+		Hour   time.Time
+		Status string
+		Count  int64
+	}
+	err := db.Model(&models.WorkflowExecution{}).
+		Select("date_trunc('hour', created_at AT TIME ZONE 'UTC') AS hour, status, COUNT(*) AS count").
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group("1, 2").Scan(&counts).Error
+	if err != nil {
+		return overview, err
+	}
+	for _, count := range counts {
+		if hour, ok := hours[count.Hour.Unix()]; ok {
+			hour.Executions[count.Status] = count.Count
+			hour.Total += count.Count
+		}
+	}
+
+	// Executions still waiting for a worker have no start yet
+	started := db.Model(&models.WorkflowExecution{}).
+		Where("started_at >= ? AND started_at < ? AND status NOT IN ?", from, to, []string{"held", "queued", "pending"}).
+		Session(&gorm.Session{})
+
+	var waits []struct {
+		Hour  time.Time
+		AvgMs float64
+	}
+	err = started.
+		Select("date_trunc('hour', started_at AT TIME ZONE 'UTC') AS hour, AVG(" + queueWaitMs + ") AS avg_ms").
+		Group("1").Scan(&waits).Error
+	if err != nil {
+		return overview, err
+	}
+	for _, wait := range waits {
+		if hour, ok := hours[wait.Hour.Unix()]; ok {
+			hour.AvgQueueWaitMs = wait.AvgMs
+		}
+	}
+
+	err = started.
+		Select("COUNT(*) AS executions, " +
+			"COALESCE(AVG(" + queueWaitMs + "), 0) AS avg_ms, " +
+			"COALESCE(percentile_cont(0.5) WITHIN GROUP (ORDER BY " + queueWaitMs + "), 0) AS p50_ms, " +
+			"COALESCE(percentile_cont(0.95) WITHIN GROUP (ORDER BY " + queueWaitMs + "), 0) AS p95_ms, " +
+			"COALESCE(percentile_cont(0.99) WITHIN GROUP (ORDER BY " + queueWaitMs + "), 0) AS p99_ms, " +
+			"COALESCE(MAX(" + queueWaitMs + "), 0) AS max_ms").
+		Scan(&overview.QueueWait).Error
+	if err != nil {
+		return overview, err
+	}
+
+	// Executions of published versions count for the workflow they belong to
+	overview.TopFailingWorkflows = []FailingWorkflowStats{}
+	err = db.Table("workflow_executions").
+		Select("roots.id AS workflow_id, roots.name, "+
+			"COUNT(*) FILTER (WHERE workflow_executions.status = 'failed') AS failed, "+
+			"COUNT(*) AS finished, "+
+			"COUNT(*) FILTER (WHERE workflow_executions.status = 'failed')::float / COUNT(*) AS failure_rate").
+		Joins("JOIN workflows ON workflows.id = workflow_executions.workflow_id").
+		Joins("JOIN workflows roots ON roots.id = COALESCE(workflows.parent_id, workflows.id)").
+		Where("workflow_executions.created_at >= ? AND workflow_executions.created_at < ?", from, to).
+		Where("workflow_executions.status IN ?", []string{"completed", "failed"}).
+		Where("workflow_executions.deleted_at IS NULL").
+		Group("roots.id, roots.name").
+		Having("COUNT(*) FILTER (WHERE workflow_executions.status = 'failed') > 0").
+		Order("failed DESC, failure_rate DESC").Limit(top).
+		Scan(&overview.TopFailingWorkflows).Error
+	if err != nil {
+		return overview, err
+	}
+
+	var breaches []struct {
+		Hour  time.Time
+		Count int64
+	}
+	err = db.Model(&models.SLABreach{}).
+		Select("date_trunc('hour', created_at AT TIME ZONE 'UTC') AS hour, COUNT(*) AS count").
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group("1").Scan(&breaches).Error
+	if err != nil {
+		return overview, err
+	}
+	for _, breach := range breaches {
+		if hour, ok := hours[breach.Hour.Unix()]; ok {
+			hour.SLABreaches = breach.Count
+		}
+	}
+
+	overview.SLABreaches = []SLABreachStats{}
+	err = db.Table("sla_breaches").
+		Select("sla_breaches.workflow_id, workflows.name, "+
+			"COUNT(*) FILTER (WHERE sla_breaches.kind = ?) AS duration_breaches, "+
+			"COUNT(*) FILTER (WHERE sla_breaches.kind = ?) AS failure_rate_breaches", models.SLABreachDuration, models.SLABreachFailureRate).
+		Joins("JOIN workflows ON workflows.id = sla_breaches.workflow_id").
+		Where("sla_breaches.created_at >= ? AND sla_breaches.created_at < ?", from, to).
+		Group("sla_breaches.workflow_id, workflows.name").
+		Order("COUNT(*) DESC").Limit(top).
+		Scan(&overview.SLABreaches).Error
+	if err != nil {
+		return overview, err
+	}
+
+	// Worker utilization is reported by the workers to Redis
+	overview.Workers = WorkerStats{Workers: []queue.WorkerStatus{}, Panics: map[string]int64{}}
+	if h.queueClient == nil {
+		return overview, nil
+	}
+	utilization, err := h.queueClient.Utilization(from, to)
+	if err != nil {
+		return overview, err
+	}
+	for _, u := range utilization {
+		if hour, ok := hours[u.Hour.Unix()]; ok {
+			value := u.Utilization
+			hour.Utilization = &value
+		}
+	}
+
+	overview.Workers, err = h.workerStats()
+	return overview, err
+}
+
+// workerStats returns the live workers as last reported
+func (h *StatsHandler) workerStats() (WorkerStats, error) {
+	stats := WorkerStats{Workers: []queue.WorkerStatus{}, Panics: map[string]int64{}}
+	if h.queueClient == nil {
+		return stats, nil
+	}
+	workers, err := h.queueClient.Workers(workerMaxAge)
+	if err != nil {
+		return stats, err
+	}
+	stats.Workers = workers
+	stats.Live = len(workers)
+	// The workers of a process report the same panics
+	hosts := map[string]bool{}
+	for _, worker := range workers {
+		if worker.Busy {
+			stats.Busy++
+		}
+		if !hosts[worker.Host] {
+			hosts[worker.Host] = true
+			for class, count := range worker.Panics {
+				stats.Panics[class] += count
+			}
+		}
+	}
+	if stats.Live > 0 {
+		stats.Utilization = float64(stats.Busy) / float64(stats.Live)
+	}
+	return stats, nil
+}
+
+// Workers godoc
+// @Summary Get the live workers
+// @Description Returns the workers that reported within the last 30 seconds, whether they are busy, the health of the executor plugins their processes loaded (loaded, failed to load or quarantined after crashing) and the panics of executors by executor class
+// @Tags stats
+// @Accept json
+// @Produce json
+// @Success 200 {object} WorkerStats
+// @Failure 500 {object} map[string]string
+// @Router /stats/workers [get]
+func (h *StatsHandler) Workers(c echo.Context) error {
+	stats, err := h.workerStats()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, stats)
+}
+
+// QueueWait godoc
+// @Summary Get the queue wait per organization or workflow
+// @Description Returns how long the executions of each organization or workflow (including its published versions) waited for a worker over a time range (default the last 24 hours), ordered by the 95th percentile, to check that the fair queue keeps tenants from starving each other
+// @Tags stats
+// @Accept json
+// @Produce json
+// @Param from query string false "Start of the time range (RFC3339)"
+// @Param to query string false "End of the time range (RFC3339, default now)"
+// @Param group_by query string false "Aggregation level: organization (default) or workflow"
+// @Param limit query int false "Maximum number of entries (default 50)"
+// @Success 200 {array} QueueWaitGroupStats
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /stats/queue-wait [get]
+func (h *StatsHandler) QueueWait(c echo.Context) error {
+	to := time.Now()
+	if param := c.QueryParam("to"); param != "" {
+		parsed, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid to parameter, expected RFC3339"})
+		}
+		to = parsed
+	}
+	from := to.Add(-24 * time.Hour)
+	if param := c.QueryParam("from"); param != "" {
+		parsed, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid from parameter, expected RFC3339"})
+		}
+		from = parsed
+	}
+	if !from.Before(to) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must be before to"})
+	}
+	if to.Sub(from) > maxOverviewRange {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("The time range must not exceed %s", maxOverviewRange)})
+	}
+
+	limit := 50
+	if param := c.QueryParam("limit"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid limit, expected 1 to 500"})
+		}
+		limit = parsed
+	}
+
+	// Executions still waiting for a worker have no start yet
+	query := database.Replica().Table("workflow_executions").
+		Joins("JOIN workflows ON workflows.id = workflow_executions.workflow_id").
+		Joins("JOIN workflows roots ON roots.id = COALESCE(workflows.parent_id, workflows.id)").
+		Where("workflow_executions.started_at >= ? AND workflow_executions.started_at < ?", from, to).
+		Where("workflow_executions.status NOT IN ?", []string{"held", "queued", "pending"}).
+		Where("workflow_executions.deleted_at IS NULL")
+
+	aggregates := "COUNT(*) AS executions, " +
+		"AVG(" + executionQueueWaitMs + ") AS avg_ms, " +
+		"percentile_cont(0.5) WITHIN GROUP (ORDER BY " + executionQueueWaitMs + ") AS p50_ms, " +
+		"percentile_cont(0.95) WITHIN GROUP (ORDER BY " + executionQueueWaitMs + ") AS p95_ms, " +
+		"percentile_cont(0.99) WITHIN GROUP (ORDER BY " + executionQueueWaitMs + ") AS p99_ms, " +
+		"MAX(" + executionQueueWaitMs + ") AS max_ms"
+	switch c.QueryParam("group_by") {
+	case "", "organization":
+		query = query.Select("roots.organization_id, COALESCE(organizations.name, '') AS name, " + aggregates).
+			Joins("LEFT JOIN organizations ON organizations.id = roots.organization_id").
+			Group("roots.organization_id, organizations.name")
+	case "workflow":
+		query = query.Select("roots.organization_id, roots.id AS workflow_id, roots.name, " + aggregates).
+			Group("roots.organization_id, roots.id, roots.name")
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid group_by, expected organization or workflow"})
+	}
+
+	stats := []QueueWaitGroupStats{}
+	if err := query.Order("p95_ms DESC").Limit(limit).Scan(&stats).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, stats)
+}
+
+// NodeUsageStats aggregates the resource usage of node executions
+type NodeUsageStats struct {
+	NodeID          uint    `json:"node_id,omitempty"`
+	WorkflowID      uint    `json:"workflow_id,omitempty"`
+	NodeType        string  `json:"node_type"`
+	Executions      int64   `json:"executions"`
+	TotalDurationMs int64   `json:"total_duration_ms"`
+	AvgDurationMs   float64 `json:"avg_duration_ms"`
+	MaxDurationMs   int64   `json:"max_duration_ms"`
+	TotalBytesIn    int64   `json:"total_bytes_in"`
+	TotalBytesOut   int64   `json:"total_bytes_out"`
+}
+
+// NodeUsage godoc
+// @Summary Get node resource usage
+// @Description Returns resource usage aggregated per node or per node type, ordered by total wall time
+// @Tags stats
+// @Accept json
+// @Produce json
+// @Param workflow_id query int false "Only include nodes of this workflow"
+// @Param since query string false "Only include node executions started after this time (RFC3339)"
+// @Param group_by query string false "Aggregation level: node (default) or node_type"
+// @Param limit query int false "Maximum number of entries (default 50)"
+// @Success 200 {array} NodeUsageStats
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /stats/nodes [get]
+func (h *StatsHandler) NodeUsage(c echo.Context) error {
+	query := database.Replica().Model(&models.NodeExecution{}).
+		Joins("JOIN nodes ON nodes.id = node_executions.node_id")
+
+	if workflowID := c.QueryParam("workflow_id"); workflowID != "" {
+		id, err := strconv.Atoi(workflowID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+		}
+		query = query.Where("nodes.workflow_id = ?", id)
+	}
+
+	if since := c.QueryParam("since"); since != "" {
+		sinceTime, err := time.Parse(time.RFC3339, since)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid since parameter, expected RFC3339"})
+		}
+		query = query.Where("node_executions.started_at >= ?", sinceTime)
+	}
+
+	limit := 50
+	if limitParam := c.QueryParam("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid limit"})
+		}
+		limit = parsed
+	}
+
+	aggregates := `COUNT(*) AS executions,
+		COALESCE(SUM(node_executions.duration_ms), 0) AS total_duration_ms,
+		COALESCE(AVG(node_executions.duration_ms), 0) AS avg_duration_ms,
+		COALESCE(MAX(node_executions.duration_ms), 0) AS max_duration_ms,
+		COALESCE(SUM(node_executions.bytes_in), 0) AS total_bytes_in,
+		COALESCE(SUM(node_executions.bytes_out), 0) AS total_bytes_out`
+
+	switch c.QueryParam("group_by") {
+	case "", "node":
+		query = query.Select("node_executions.node_id, nodes.workflow_id, nodes.node_type, " + aggregates).
+			Group("node_executions.node_id, nodes.workflow_id, nodes.node_type")
+	case "node_type":
+		query = query.Select("nodes.node_type, " + aggregates).
+			Group("nodes.node_type")
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid group_by, expected node or node_type"})
+	}
+
+	var stats []NodeUsageStats
+	if err := query.Order("total_duration_ms DESC").Limit(limit).Scan(&stats).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, stats)
+}
+
+// Anomalies godoc
+// @Summary Get executions with unusual durations
+// @Description Returns the executions whose duration deviated from the typical duration of their workflow by at least min_score standard deviations, newest first, with their nodes deviating most. Durations are learned and scored by the workers in the background.
+// @Tags stats
+// @Accept json
+// @Produce json
+// @Param workflow_id query int false "Only executions of this workflow and its published versions"
+// @Param since query string false "Only executions completed after this time (RFC3339, default the last 24 hours)"
+// @Param min_score query number false "Minimum anomaly score (default 3)"
+// @Param limit query int false "Maximum number of executions (default 50)"
+// @Success 200 {array} models.DurationAnomaly
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /stats/anomalies [get]
+func (h *StatsHandler) Anomalies(c echo.Context) error {
+	db := database.Replica()
+	query := db.Model(&models.WorkflowExecution{}).
+		Select("workflow_executions.id AS execution_id, roots.id AS workflow_id, roots.name, workflow_executions.completed_at, " +
+			"EXTRACT(EPOCH FROM workflow_executions.completed_at - workflow_executions.started_at) * 1000 AS duration_ms, " +
+			"COALESCE(EXP(duration_baselines.mean_log), 0) AS typical_ms, workflow_executions.anomaly_score").
+		Joins("JOIN workflows ON workflows.id = workflow_executions.workflow_id").
+		Joins("JOIN workflows roots ON roots.id = COALESCE(workflows.parent_id, workflows.id)").
+		Joins("LEFT JOIN duration_baselines ON duration_baselines.workflow_id = roots.id AND duration_baselines.node_id = 0")
+
+	if workflowID := c.QueryParam("workflow_id"); workflowID != "" {
+		id, err := strconv.Atoi(workflowID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+		}
+		query = query.Where("roots.id = ?", id)
+	}
+
+	since := time.Now().Add(-24 * time.Hour)
+	if param := c.QueryParam("since"); param != "" {
+		parsed, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid since parameter, expected RFC3339"})
+		}
+		since = parsed
+	}
+
+	minScore := 3.0
+	if param := c.QueryParam("min_score"); param != "" {
+		parsed, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid min_score"})
+		}
+		minScore = parsed
+	}
+
+	limit := 50
+	if param := c.QueryParam("limit"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid limit, expected 1 to 500"})
+		}
+		limit = parsed
+	}
+
+	anomalies := []models.DurationAnomaly{}
+	err := query.
+		Where("workflow_executions.completed_at >= ? AND workflow_executions.anomaly_score >= ?", since, minScore).
+		Order("workflow_executions.completed_at DESC").Limit(limit).
+		Scan(&anomalies).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if len(anomalies) == 0 {
+		return c.JSON(http.StatusOK, anomalies)
+	}
+
+	executionIDs := make([]uint, len(anomalies))
+	byExecution := make(map[uint]*models.DurationAnomaly, len(anomalies))
+	for i := range anomalies {
+		anomalies[i].Nodes = []models.NodeAnomaly{}
+		executionIDs[i] = anomalies[i].ExecutionID
+		byExecution[anomalies[i].ExecutionID] = &anomalies[i]
+	}
+
+	// The nodes slower than usual point to the cause, e.g. a slow API
+	var nodes []struct {
+		models.NodeAnomaly
+		WorkflowExecutionID uint
+	}
+	err = db.Model(&models.NodeExecution{}).
+		Select("node_executions.id AS node_execution_id, node_executions.workflow_execution_id, node_executions.node_id, "+
+			"nodes.name, nodes.node_type, node_executions.duration_ms, COALESCE(EXP(duration_baselines.mean_log), 0) AS typical_ms, "+
+			"node_executions.anomaly_score").
+		Joins("JOIN nodes ON nodes.id = node_executions.node_id").
+		Joins("JOIN workflows ON workflows.id = nodes.workflow_id").
+		Joins("LEFT JOIN duration_baselines ON duration_baselines.workflow_id = COALESCE(workflows.parent_id, workflows.id) AND duration_baselines.node_id = node_executions.node_id").
+		Where("node_executions.workflow_execution_id IN ? AND node_executions.anomaly_score > 0", executionIDs).
+		Order("node_executions.anomaly_score DESC").
+		Scan(&nodes).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	for _, node := range nodes {
+		if anomaly := byExecution[node.WorkflowExecutionID]; len(anomaly.Nodes) < maxAnomalyNodes {
+			anomaly.Nodes = append(anomaly.Nodes, node.NodeAnomaly)
+		}
+	}
+
+	return c.JSON(http.StatusOK, anomalies)
+}
+
+// FailureStats lists the failed node executions matching a filter by cause
+type FailureStats struct {
+	// Categories counts the matching failures by error category, "" for uncategorized failures
+	Categories map[string]int64 `json:"categories"`
+	// Failures are the newest matching failures
+	Failures []NodeFailure `json:"failures"`
+}
+
+// NodeFailure is a failed node execution
+type NodeFailure struct {
+	NodeExecutionID uint       `json:"node_execution_id"`
+	ExecutionID     uint       `json:"execution_id"`
+	WorkflowID      uint       `json:"workflow_id"`
+	NodeID          uint       `json:"node_id"`
+	Name            string     `json:"name"`
+	NodeType        string     `json:"node_type"`
+	Attempt         int        `json:"attempt"`
+	ErrorCategory   string     `json:"error_category"`
+	ErrorCode       string     `json:"error_code"`
+	ErrorMessage    string     `json:"error_message"`
+	CompletedAt     *time.Time `json:"completed_at"`
+}
+
+// Failures godoc
+// @Summary Get node failures by cause
+// @Description Returns the failed node executions over a time range (default the last 24 hours), newest first, with their counts by error category: config, auth, rate_limited, transient, timeout, data or empty if unknown. Rate limited and transient failures were retried before failing.
+// @Tags stats
+// @Accept json
+// @Produce json
+// @Param category query string false "Only failures of this error category, none for uncategorized failures"
+// @Param workflow_id query int false "Only failures of nodes of this workflow"
+// @Param node_type query string false "Only failures of nodes of this node type"
+// @Param since query string false "Only failures of node executions started after this time (RFC3339, default the last 24 hours)"
+// @Param limit query int false "Maximum number of failures (default 50, at most 500)"
+// @Success 200 {object} FailureStats
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /stats/failures [get]
+func (h *StatsHandler) Failures(c echo.Context) error {
+	since := time.Now().Add(-24 * time.Hour)
+	if param := c.QueryParam("since"); param != "" {
+		parsed, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid since parameter, expected RFC3339"})
+		}
+		since = parsed
+	}
+
+	limit := 50
+	if param := c.QueryParam("limit"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid limit, expected 1 to 500"})
+		}
+		limit = parsed
+	}
+
+	workflowID := 0
+	if param := c.QueryParam("workflow_id"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+		}
+		workflowID = parsed
+	}
+
+	// The counts by category ignore the category filter
+	db := database.Replica()
+	filter := func() *gorm.DB {
+		query := db.Model(&models.NodeExecution{}).
+			Joins("JOIN nodes ON nodes.id = node_executions.node_id").
+			Where("node_executions.status = ? AND node_executions.started_at >= ?", "failed", since)
+		if workflowID != 0 {
+			query = query.Where("nodes.workflow_id = ?", workflowID)
+		}
+		if nodeType := c.QueryParam("node_type"); nodeType != "" {
+			query = query.Where("nodes.node_type = ?", nodeType)
+		}
+		return query
+	}
+
+	var counts []struct {
+		ErrorCategory string
+		Count         int64
+	}
+	if err := filter().Select("node_executions.error_category, COUNT(*) AS count").
+		Group("node_executions.error_category").Scan(&counts).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	stats := FailureStats{Categories: map[string]int64{}, Failures: []NodeFailure{}}
+	for _, count := range counts {
+		stats.Categories[count.ErrorCategory] = count.Count
+	}
+
+	query := filter()
+	if category, ok := c.QueryParams()["category"]; ok {
+		query = query.Where("node_executions.error_category = ?", category[0])
+	}
+	err := query.Select("node_executions.id AS node_execution_id, node_executions.workflow_execution_id AS execution_id, " +
+		"nodes.workflow_id, node_executions.node_id, nodes.name, nodes.node_type, node_executions.attempt, " +
+		"node_executions.error_category, node_executions.error_code, node_executions.error_message, node_executions.completed_at").
+		Order("node_executions.id DESC").Limit(limit).
+		Scan(&stats.Failures).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, stats)
+}
+
+// CostStats sums up the estimated cost of the external API calls of node executions
+type CostStats struct {
+	ExecutionID    uint    `json:"execution_id,omitempty"`
+	WorkflowID     uint    `json:"workflow_id,omitempty"`
+	OrganizationID uint    `json:"organization_id,omitempty"`
+	Name           string  `json:"name,omitempty"`
+	NodeType       string  `json:"node_type,omitempty"`
+	NodeExecutions int64   `json:"node_executions"`
+	Cost           float64 `json:"cost"`
+}
+
+// Costs godoc
+// @Summary Get estimated costs
+// @Description Returns the estimated cost of external API usage per execution, workflow, organization or node type over a time range (default the last 30 days), highest first. Costs are estimated with the cost models of the node types.
+// @Tags stats
+// @Accept json
+// @Produce json
+// @Param from query string false "Start of the time range (RFC3339)"
+// @Param to query string false "End of the time range (RFC3339, default now)"
+// @Param group_by query string false "Aggregation level: workflow (default), execution, organization or node_type"
+// @Param workflow_id query int false "Only executions of this workflow and its published versions"
+// @Param organization_id query int false "Only workflows of this organization"
+// @Param limit query int false "Maximum number of entries (default 50)"
+// @Success 200 {array} CostStats
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /stats/costs [get]
+func (h *StatsHandler) Costs(c echo.Context) error {
+	to := time.Now()
+	if param := c.QueryParam("to"); param != "" {
+		parsed, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid to parameter, expected RFC3339"})
+		}
+		to = parsed
+	}
+	from := to.Add(-30 * 24 * time.Hour)
+	if param := c.QueryParam("from"); param != "" {
+		parsed, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid from parameter, expected RFC3339"})
+		}
+		from = parsed
+	}
+	if !from.Before(to) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must be before to"})
+	}
+	if to.Sub(from) > maxOverviewRange {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("The time range must not exceed %s", maxOverviewRange)})
+	}
+
+	// Executions of published versions count for their workflow
+	query := database.Replica().Model(&models.NodeExecution{}).
+		Joins("JOIN workflow_executions ON workflow_executions.id = node_executions.workflow_execution_id").
+		Joins("JOIN workflows ON workflows.id = workflow_executions.workflow_id").
+		Joins("JOIN workflows roots ON roots.id = COALESCE(workflows.parent_id, workflows.id)").
+		Where("node_executions.started_at >= ? AND node_executions.started_at < ? AND node_executions.cost > 0", from, to)
+
+	if workflowID := c.QueryParam("workflow_id"); workflowID != "" {
+		id, err := strconv.Atoi(workflowID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+		}
+		query = query.Where("roots.id = ?", id)
+	}
+	if organizationID := c.QueryParam("organization_id"); organizationID != "" {
+		id, err := strconv.Atoi(organizationID)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid organization ID"})
+		}
+		query = query.Where("roots.organization_id = ?", id)
+	}
+
+	limit := 50
+	if param := c.QueryParam("limit"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed <= 0 || parsed > 500 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid limit, expected 1 to 500"})
+		}
+		limit = parsed
+	}
+
+	aggregates := "COUNT(*) AS node_executions, SUM(node_executions.cost) AS cost"
+	switch c.QueryParam("group_by") {
+	case "", "workflow":
+		query = query.Select("roots.id AS workflow_id, roots.organization_id, roots.name, " + aggregates).
+			Group("roots.id, roots.organization_id, roots.name")
+	case "execution":
+		query = query.Select("node_executions.workflow_execution_id AS execution_id, roots.id AS workflow_id, roots.organization_id, roots.name, " + aggregates).
+			Group("node_executions.workflow_execution_id, roots.id, roots.organization_id, roots.name")
+	case "organization":
+		query = query.Select("roots.organization_id, COALESCE(organizations.name, '') AS name, " + aggregates).
+			Joins("LEFT JOIN organizations ON organizations.id = roots.organization_id").
+			Group("roots.organization_id, organizations.name")
+	case "node_type":
+		query = query.Select("nodes.node_type, " + aggregates).
+			Joins("JOIN nodes ON nodes.id = node_executions.node_id").
+			Group("nodes.node_type")
+	default:
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid group_by, expected workflow, execution, organization or node_type"})
+	}
+
+	stats := []CostStats{}
+	if err := query.Order("cost DESC").Limit(limit).Scan(&stats).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, stats)
+}
+
+// CapacityPlan godoc
+// @Summary Plan the worker capacity for a load
+// @Description Replays the executions of a past time range (default the last 7 days) against simulated workers, at load_factor times their rate, and returns the fewest workers keeping the queue wait at the percentile within the target, with the simulated waits of nearby and the current worker counts. For capacity planning before launches.
+// @Tags stats
+// @Accept json
+// @Produce json
+// @Param from query string false "Start of the time range (RFC3339)"
+// @Param to query string false "End of the time range (RFC3339, default now)"
+// @Param workflow_id query int false "Only executions of this workflow and its published versions"
+// @Param load_factor query number false "Multiplier of the execution rate (default 1)"
+// @Param target_wait query string false "Longest queue wait at the percentile, e.g. 30s (default 1m)"
+// @Param percentile query number false "Percentile of the queue waits within the target (default 95)"
+// @Param max_workers query int false "Most workers simulated (default 200)"
+// @Success 200 {object} capacity.Plan
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /stats/capacity-plan [get]
+func (h *StatsHandler) CapacityPlan(c echo.Context) error {
+	to := time.Now()
+	if param := c.QueryParam("to"); param != "" {
+		parsed, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid to parameter, expected RFC3339"})
+		}
+		to = parsed
+	}
+	from := to.Add(-7 * 24 * time.Hour)
+	if param := c.QueryParam("from"); param != "" {
+		parsed, err := time.Parse(time.RFC3339, param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid from parameter, expected RFC3339"})
+		}
+		from = parsed
+	}
+	if !from.Before(to) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "from must be before to"})
+	}
+	if to.Sub(from) > maxOverviewRange {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("The time range must not exceed %s", maxOverviewRange)})
+	}
+
+	var workflowID uint
+	if param := c.QueryParam("workflow_id"); param != "" {
+		id, err := strconv.Atoi(param)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+		}
+		workflowID = uint(id)
+	}
+
+	opts := capacity.Options{LoadFactor: 1, TargetWait: time.Minute, Percentile: 95, MaxWorkers: 200}
+	if param := c.QueryParam("load_factor"); param != "" {
+		parsed, err := strconv.ParseFloat(param, 64)
+		if err != nil || parsed <= 0 || parsed > 100 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid load_factor, expected more than 0 and at most 100"})
+		}
+		opts.LoadFactor = parsed
+	}
+	if param := c.QueryParam("target_wait"); param != "" {
+		parsed, err := time.ParseDuration(param)
+		if err != nil || parsed < 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid target_wait, expected a duration like 30s"})
+		}
+		opts.TargetWait = parsed
+	}
+	if param := c.QueryParam("percentile"); param != "" {
+		parsed, err := strconv.ParseFloat(param, 64)
+		if err != nil || parsed <= 0 || parsed > 100 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid percentile, expected more than 0 and at most 100"})
+		}
+		opts.Percentile = parsed
+	}
+	if param := c.QueryParam("max_workers"); param != "" {
+		parsed, err := strconv.Atoi(param)
+		if err != nil || parsed <= 0 || parsed > 1000 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid max_workers, expected 1 to 1000"})
+		}
+		opts.MaxWorkers = parsed
+	}
+
+	// The current workers are simulated for comparison
+	if h.queueClient != nil {
+		if workers, err := h.queueClient.Workers(workerMaxAge); err == nil && len(workers) > 0 {
+			opts.Workers = append(opts.Workers, len(workers))
+		}
+	}
+
+	jobs, err := capacity.History(from, to, workflowID)
+	if errors.Is(err, capacity.ErrTooManyJobs) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, capacity.NewPlan(jobs, from, to, opts))
+}
@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/dispatch"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/queue"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// TaskHandler manages the HTTP requests for the human task inbox
+type TaskHandler struct {
+	dispatcher *dispatch.Dispatcher
+}
+
+// NewTaskHandler creates a new TaskHandler
+func NewTaskHandler(queueClient *queue.QueueClient) *TaskHandler {
+	return &TaskHandler{
+		dispatcher: dispatch.NewDispatcher(queueClient),
+	}
+}
+
+// CompleteTaskRequest represents the input data for completing a task
+type CompleteTaskRequest struct {
+	Result map[string]interface{} `json:"result"`
+}
+
+// Errors of task state transitions
+var (
+	errTaskNotAssigned   = errors.New("you are not an assignee of this task")
+	errTaskClaimed       = errors.New("task is claimed by another user")
+	errTaskNotClaimed    = errors.New("task is not claimed by you")
+	errTaskAlreadyClosed = errors.New("task has already been completed")
+	errInvalidTaskID     = errors.New("Invalid ID")
+)
+
+// Inbox godoc
+// @Summary Get task inbox
+// @Description Returns the open tasks the current user can work on and the tasks claimed by them, ordered by due date
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param status query string false "Filter by status (open, claimed)"
+// @Param workflow_id query int false "Filter by workflow"
+// @Param overdue query bool false "Only tasks past their due date"
+// @Success 200 {array} models.HumanTask
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tasks [get]
+func (h *TaskHandler) Inbox(c echo.Context) error {
+	user := auth.CurrentUser(c)
+
+	assignee, _ := json.Marshal([]string{user.Email})
+	query := database.DB.
+		Where("status IN ?", []string{"open", "claimed"}).
+		Where("claimed_by IS NULL OR claimed_by = ?", user.ID).
+		Where("assignees @> ?::jsonb OR (assignees = '[]'::jsonb AND (assignee_role = '' OR assignee_role = ?))", string(assignee), user.Role).
+		Order("due_at ASC NULLS LAST").
+		Order("created_at ASC")
+
+	if status := c.QueryParam("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if workflowID := c.QueryParam("workflow_id"); workflowID != "" {
+		query = query.Where("workflow_id = ?", workflowID)
+	}
+	if c.QueryParam("overdue") == "true" {
+		query = query.Where("due_at < ?", time.Now())
+	}
+
+	var tasks []models.HumanTask
+	if err := query.Find(&tasks).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, tasks)
+}
+
+// GetByID godoc
+// @Summary Get task by ID
+// @Description Returns a specific human task
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Success 200 {object} models.HumanTask
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /tasks/{id} [get]
+func (h *TaskHandler) GetByID(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var task models.HumanTask
+	if err := database.DB.First(&task, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Task not found"})
+	}
+
+	return c.JSON(http.StatusOK, task)
+}
+
+// Claim godoc
+// @Summary Claim a task
+// @Description Claims an open task for the current user, hiding it from the inboxes of the other assignees
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Success 200 {object} models.HumanTask
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /tasks/{id}/claim [post]
+func (h *TaskHandler) Claim(c echo.Context) error {
+	user := auth.CurrentUser(c)
+
+	task, err := h.updateTask(c, func(task *models.HumanTask) error {
+		if !mayWorkOn(user, *task) {
+			return errTaskNotAssigned
+		}
+		if task.Status == "claimed" && task.ClaimedBy != nil && *task.ClaimedBy != user.ID {
+			return errTaskClaimed
+		}
+
+		now := time.Now()
+		task.Status = "claimed"
+		task.ClaimedBy = &user.ID
+		task.ClaimedAt = &now
+		return nil
+	})
+	if err != nil {
+		return taskError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, task)
+}
+
+// Unclaim godoc
+// @Summary Release a task
+// @Description Releases a task claimed by the current user back to the inboxes of all assignees
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Success 200 {object} models.HumanTask
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /tasks/{id}/unclaim [post]
+func (h *TaskHandler) Unclaim(c echo.Context) error {
+	user := auth.CurrentUser(c)
+
+	task, err := h.updateTask(c, func(task *models.HumanTask) error {
+		if task.ClaimedBy == nil || (*task.ClaimedBy != user.ID && user.Role != models.RoleAdmin) {
+			return errTaskNotClaimed
+		}
+
+		task.Status = "open"
+		task.ClaimedBy = nil
+		task.ClaimedAt = nil
+		return nil
+	})
+	if err != nil {
+		return taskError(c, err)
+	}
+
+	return c.JSON(http.StatusOK, task)
+}
+
+// Complete godoc
+// @Summary Complete a task
+// @Description Completes a task claimed by the current user. The submitted result becomes the output of the human task node and the execution continues.
+// @Tags tasks
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param result body CompleteTaskRequest true "Task result"
+// @Success 200 {object} models.HumanTask
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /tasks/{id}/complete [post]
+func (h *TaskHandler) Complete(c echo.Context) error {
+	user := auth.CurrentUser(c)
+
+	var request CompleteTaskRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if request.Result == nil {
+		request.Result = make(map[string]interface{})
+	}
+	resultJSON, err := json.Marshal(request.Result)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	task, err := h.updateTask(c, func(task *models.HumanTask) error {
+		if task.Status != "claimed" || task.ClaimedBy == nil || *task.ClaimedBy != user.ID {
+			return errTaskNotClaimed
+		}
+
+		now := time.Now()
+		task.Status = "completed"
+		task.Result = string(resultJSON)
+		task.CompletedBy = &user.ID
+		task.CompletedAt = &now
+		return nil
+	})
+	if err != nil {
+		return taskError(c, err)
+	}
+
+	// Continue the waiting execution with the submitted result
+	var data interface{}
+	json.Unmarshal([]byte(task.Data), &data)
+
+	output := map[string]interface{}{
+		"task_id":      task.ID,
+		"completed_by": user.Email,
+		"data":         data,
+		"result":       request.Result,
+	}
+	if err := h.dispatcher.Resume(task.WorkflowExecutionID, task.NodeID, "", output); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, task)
+}
+
+// updateTask locks the task of the request, applies the change and saves it
+func (h *TaskHandler) updateTask(c echo.Context, change func(task *models.HumanTask) error) (*models.HumanTask, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return nil, errInvalidTaskID
+	}
+
+	var task models.HumanTask
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&task, id).Error; err != nil {
+			return gorm.ErrRecordNotFound
+		}
+		if task.Status == "completed" {
+			return errTaskAlreadyClosed
+		}
+		if err := change(&task); err != nil {
+			return err
+		}
+		return tx.Save(&task).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &task, nil
+}
+
+// taskError maps errors of task state transitions to responses
+func taskError(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, errInvalidTaskID):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Task not found"})
+	case errors.Is(err, errTaskNotAssigned):
+		return c.JSON(http.StatusForbidden, map[string]string{"error": err.Error()})
+	case errors.Is(err, errTaskClaimed), errors.Is(err, errTaskNotClaimed), errors.Is(err, errTaskAlreadyClosed):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	default:
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+}
+
+// mayWorkOn reports whether the user is allowed to claim the task.
+// Assigned tasks are restricted to their assignees, others to the assignee role if set.
+func mayWorkOn(user *models.User, task models.HumanTask) bool {
+	if user.Role == models.RoleAdmin {
+		return true
+	}
+
+	var assignees []string
+	json.Unmarshal([]byte(task.Assignees), &assignees)
+	if len(assignees) == 0 {
+		return task.AssigneeRole == "" || task.AssigneeRole == user.Role
+	}
+
+	for _, assignee := range assignees {
+		if assignee == user.Email {
+			return true
+		}
+	}
+	return false
+}
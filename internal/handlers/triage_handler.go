@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// TriageHandler manages the HTTP requests for the triage of failed executions and the notes on
+// executions
+type TriageHandler struct{}
+
+// NewTriageHandler creates a new TriageHandler
+func NewTriageHandler() *TriageHandler {
+	return &TriageHandler{}
+}
+
+// errExecutionNotFailed is returned when triaging an execution that did not fail
+var errExecutionNotFailed = errors.New("Only failed executions can be triaged")
+
+// validTriageStatus reports whether failed executions can be set to the triage status
+func validTriageStatus(status string) bool {
+	for _, triage := range models.TriageStatuses {
+		if status == triage {
+			return true
+		}
+	}
+	return false
+}
+
+// Triage godoc
+// @Summary Triage a failed execution
+// @Description Sets the triage status of a failed execution to acknowledged, ignored or fixed, or clears it with an empty status. A note given with the status is added to the notes of the execution.
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Param triage body models.TriageRequest true "Triage status and note"
+// @Success 200 {object} models.WorkflowExecution
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id}/triage [put]
+func (h *TriageHandler) Triage(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var request models.TriageRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if request.Status != "" && !validTriageStatus(request.Status) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid triage status %s", request.Status)})
+	}
+
+	var execution models.WorkflowExecution
+	if err := database.DB.Omit(executionJSONColumns...).First(&execution, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Execution not found"})
+	}
+	if execution.Status != "failed" {
+		return c.JSON(http.StatusConflict, map[string]string{"error": errExecutionNotFailed.Error()})
+	}
+
+	execution.TriageStatus = request.Status
+	execution.TriagedBy = nil
+	execution.TriagedAt = nil
+	user := auth.CurrentUser(c)
+	if request.Status != "" {
+		now := time.Now()
+		execution.TriagedAt = &now
+		if user != nil {
+			execution.TriagedBy = &user.ID
+		}
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Only the triage columns are written, the execution may have been restarted meanwhile
+		result := tx.Model(&models.WorkflowExecution{}).Where("id = ? AND status = ?", execution.ID, "failed").
+			Updates(map[string]interface{}{
+				"triage_status": execution.TriageStatus,
+				"triaged_by":    execution.TriagedBy,
+				"triaged_at":    execution.TriagedAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errExecutionNotFailed
+		}
+
+		note := strings.TrimSpace(request.Note)
+		if note == "" {
+			return nil
+		}
+		executionNote := models.ExecutionNote{
+			WorkflowExecutionID: execution.ID,
+			Body:                note,
+			TriageStatus:        request.Status,
+		}
+		if user != nil {
+			executionNote.UserID = user.ID
+		}
+		return tx.Create(&executionNote).Error
+	})
+	if errors.Is(err, errExecutionNotFailed) {
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, execution)
+}
+
+// GetNotes godoc
+// @Summary Get the notes on an execution
+// @Description Returns the notes on an execution, oldest first
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Success 200 {array} models.ExecutionNote
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id}/notes [get]
+func (h *TriageHandler) GetNotes(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	notes := []models.ExecutionNote{}
+	if err := database.DB.Where("workflow_execution_id = ?", id).Order("id").Find(&notes).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, notes)
+}
+
+// CreateNote godoc
+// @Summary Add a note to an execution
+// @Description Adds a free-text note to an execution, e.g. on the cause of its failure
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Param note body models.ExecutionNoteRequest true "Note"
+// @Success 201 {object} models.ExecutionNote
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id}/notes [post]
+func (h *TriageHandler) CreateNote(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var count int64
+	database.DB.Model(&models.WorkflowExecution{}).Where("id = ?", id).Count(&count)
+	if count == 0 {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Execution not found"})
+	}
+
+	var request models.ExecutionNoteRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	body := strings.TrimSpace(request.Body)
+	if body == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "body is required"})
+	}
+
+	note := models.ExecutionNote{WorkflowExecutionID: uint(id), Body: body}
+	if user := auth.CurrentUser(c); user != nil {
+		note.UserID = user.ID
+	}
+	if err := database.DB.Create(&note).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, note)
+}
+
+// UpdateNote godoc
+// @Summary Update a note on an execution
+// @Description Changes the body of a note; only its author can edit it
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Param note_id path int true "Note ID"
+// @Param note body models.ExecutionNoteRequest true "New body"
+// @Success 200 {object} models.ExecutionNote
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id}/notes/{note_id} [put]
+func (h *TriageHandler) UpdateNote(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+	noteID, err := strconv.Atoi(c.Param("note_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+
+	var note models.ExecutionNote
+	if err := database.DB.Where("workflow_execution_id = ?", id).First(&note, noteID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Note not found"})
+	}
+
+	var request models.ExecutionNoteRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	body := strings.TrimSpace(request.Body)
+	if body == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "body is required"})
+	}
+	if user := auth.CurrentUser(c); user != nil && user.ID != note.UserID {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Only the author can edit a note"})
+	}
+
+	note.Body = body
+	if err := database.DB.Save(&note).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, note)
+}
+
+// DeleteNote godoc
+// @Summary Delete a note on an execution
+// @Description Deletes a note; only its author and admins can delete it
+// @Tags executions
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Param note_id path int true "Note ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /executions/{id}/notes/{note_id} [delete]
+func (h *TriageHandler) DeleteNote(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+	noteID, err := strconv.Atoi(c.Param("note_id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid note ID"})
+	}
+
+	var note models.ExecutionNote
+	if database.DB.Where("workflow_execution_id = ?", id).Limit(1).Find(&note, noteID).RowsAffected == 0 {
+		return c.NoContent(http.StatusNoContent)
+	}
+	if user := auth.CurrentUser(c); user != nil && user.ID != note.UserID && user.Role != models.RoleAdmin {
+		return c.JSON(http.StatusForbidden, map[string]string{"error": "Only the author or an admin can delete a note"})
+	}
+
+	if err := database.DB.Delete(&models.ExecutionNote{}, note.ID).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.NoContent(http.StatusNoContent)
+}
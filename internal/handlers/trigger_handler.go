@@ -0,0 +1,486 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/brokers"
+	"github.com/altipard/flowcraft/internal/credentials"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/dispatch"
+	"github.com/altipard/flowcraft/internal/forms"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/queue"
+	"github.com/altipard/flowcraft/internal/schedule"
+	"github.com/altipard/flowcraft/internal/schemas"
+	"github.com/altipard/flowcraft/internal/slack"
+	"github.com/altipard/flowcraft/internal/webhook"
+	"github.com/labstack/echo/v4"
+)
+
+// webhookPathPattern restricts the paths of webhook triggers to URL-safe characters
+var webhookPathPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8,128}$`)
+
+// TriggerHandler manages the HTTP requests for triggers and receives webhook requests
+type TriggerHandler struct {
+	dispatcher *dispatch.Dispatcher
+}
+
+// NewTriggerHandler creates a new TriggerHandler
+func NewTriggerHandler(queueClient *queue.QueueClient) *TriggerHandler {
+	return &TriggerHandler{
+		dispatcher: dispatch.NewDispatcher(queueClient),
+	}
+}
+
+// GetByWorkflowID godoc
+// @Summary Get triggers of a workflow
+// @Description Returns the triggers starting executions of the workflow
+// @Tags triggers
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Success 200 {array} models.Trigger
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/triggers [get]
+func (h *TriggerHandler) GetByWorkflowID(c echo.Context) error {
+	workflowID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+	}
+
+	var triggers []models.Trigger
+	if err := database.DB.Where("workflow_id = ?", workflowID).Find(&triggers).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, triggers)
+}
+
+// GetByID godoc
+// @Summary Get trigger by ID
+// @Description Returns a specific trigger based on its ID
+// @Tags triggers
+// @Accept json
+// @Produce json
+// @Param id path int true "Trigger ID"
+// @Success 200 {object} models.Trigger
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /triggers/{id} [get]
+func (h *TriggerHandler) GetByID(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var trigger models.Trigger
+	if err := database.DB.First(&trigger, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Trigger not found"})
+	}
+	return c.JSON(http.StatusOK, trigger)
+}
+
+// Create godoc
+// @Summary Create a trigger
+// @Description Creates a trigger for a workflow. Webhook triggers get a random path if none is given, schedule triggers run at the times of their cron expression.
+// @Tags triggers
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Param trigger body models.Trigger true "Trigger data"
+// @Success 201 {object} models.Trigger
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/triggers [post]
+func (h *TriggerHandler) Create(c echo.Context) error {
+	workflowID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workflow ID"})
+	}
+
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, workflowID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+
+	trigger := models.Trigger{IsActive: true, RecordDeliveries: true}
+	if err := c.Bind(&trigger); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	trigger.ID = 0
+	trigger.WorkflowID = workflow.ID
+
+	if err := validateTrigger(&trigger, workflow); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// Select all fields so that disabled flags are not replaced by the column defaults
+	if err := database.DB.Select("*").Create(&trigger).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, trigger)
+}
+
+// Update godoc
+// @Summary Update a trigger
+// @Description Updates an existing trigger
+// @Tags triggers
+// @Accept json
+// @Produce json
+// @Param id path int true "Trigger ID"
+// @Param trigger body models.Trigger true "Updated trigger data"
+// @Success 200 {object} models.Trigger
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /triggers/{id} [put]
+func (h *TriggerHandler) Update(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var trigger models.Trigger
+	if err := database.DB.First(&trigger, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Trigger not found"})
+	}
+
+	workflowID := trigger.WorkflowID
+	if err := c.Bind(&trigger); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	trigger.ID = uint(id)
+	trigger.WorkflowID = workflowID
+
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, workflowID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+
+	if err := validateTrigger(&trigger, workflow); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := database.DB.Save(&trigger).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, trigger)
+}
+
+// Delete godoc
+// @Summary Delete a trigger
+// @Description Deletes a trigger and its recorded webhook deliveries
+// @Tags triggers
+// @Accept json
+// @Produce json
+// @Param id path int true "Trigger ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /triggers/{id} [delete]
+func (h *TriggerHandler) Delete(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	if err := database.DB.Where("trigger_id = ?", id).Delete(&models.WebhookDelivery{}).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if err := database.DB.Delete(&models.Trigger{}, id).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ReceiveWebhook godoc
+// @Summary Receive a webhook request
+// @Description Starts an execution of the workflow of the webhook trigger with the request's method, headers, query parameters and body as input. Requests with the dedupe key of a request accepted within the trigger's dedupe window are not started again; they are answered with status duplicate and the execution of the original request. Bodies not matching the payload schema of the trigger are rejected with 422.
+// @Tags triggers
+// @Accept json
+// @Produce json
+// @Param path path string true "Webhook path of the trigger"
+// @Success 200 {object} map[string]interface{}
+// @Success 202 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 422 {object} map[string]interface{}
+// @Failure 500 {object} map[string]string
+// @Router /webhooks/{path} [post]
+func (h *TriggerHandler) ReceiveWebhook(c echo.Context) error {
+	var trigger models.Trigger
+	err := database.DB.Where("webhook_path = ? AND trigger_type = ? AND is_active = ?", c.Param("path"), "webhook", true).
+		First(&trigger).Error
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Webhook not found"})
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, webhook.MaxBodySize()+1))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if int64(len(body)) > webhook.MaxBodySize() {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "Request body too large"})
+	}
+
+	delivery := webhook.NewDelivery(trigger, c.Request().Method, c.QueryParams(), c.Request().Header, body)
+	return h.deliver(c, trigger, &delivery)
+}
+
+// GetDeliveries godoc
+// @Summary Get recorded webhook deliveries of a trigger
+// @Description Returns the requests received by a webhook trigger, newest first
+// @Tags triggers
+// @Accept json
+// @Produce json
+// @Param id path int true "Trigger ID"
+// @Param limit query int false "Maximum number of deliveries (default 50)"
+// @Success 200 {array} models.WebhookDelivery
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /triggers/{id}/deliveries [get]
+func (h *TriggerHandler) GetDeliveries(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	limit := 50
+	if value, err := strconv.Atoi(c.QueryParam("limit")); err == nil && value > 0 && value <= 1000 {
+		limit = value
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := database.Replica().Where("trigger_id = ?", id).Order("id DESC").Limit(limit).Find(&deliveries).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, deliveries)
+}
+
+// GetDelivery godoc
+// @Summary Get a recorded webhook delivery
+// @Description Returns a request received by a webhook trigger, including its raw body (base64 encoded)
+// @Tags triggers
+// @Accept json
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Success 200 {object} models.WebhookDelivery
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /webhook-deliveries/{id} [get]
+func (h *TriggerHandler) GetDelivery(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var delivery models.WebhookDelivery
+	if err := database.DB.First(&delivery, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Delivery not found"})
+	}
+	return c.JSON(http.StatusOK, delivery)
+}
+
+// ReplayDelivery godoc
+// @Summary Replay a recorded webhook delivery
+// @Description Starts a new execution of the trigger's workflow with the stored request, as if it had been received again, regardless of the trigger's dedupe key. The replay is recorded as a delivery itself.
+// @Tags triggers
+// @Accept json
+// @Produce json
+// @Param id path int true "Delivery ID"
+// @Success 202 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /webhook-deliveries/{id}/replay [post]
+func (h *TriggerHandler) ReplayDelivery(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var original models.WebhookDelivery
+	if err := database.DB.First(&original, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Delivery not found"})
+	}
+
+	var trigger models.Trigger
+	if err := database.DB.First(&trigger, original.TriggerID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Trigger not found"})
+	}
+
+	replay := original
+	replay.ID = 0
+	replay.Status = ""
+	replay.ErrorMessage = ""
+	replay.WorkflowExecutionID = nil
+	replay.ReplayOfID = &original.ID
+	if original.ReplayOfID != nil {
+		replay.ReplayOfID = original.ReplayOfID
+	}
+	// Replays are started even though the original request was accepted with the same dedupe key
+	trigger.DedupeKey = ""
+
+	return h.deliver(c, trigger, &replay)
+}
+
+// deliver starts an execution for a received or replayed delivery, records it and responds with the outcome
+func (h *TriggerHandler) deliver(c echo.Context, trigger models.Trigger, delivery *models.WebhookDelivery) error {
+	return c.JSON(h.accept(trigger, delivery))
+}
+
+// accept starts an execution for a delivery and records it. It returns the status and body of the
+// response to the request.
+func (h *TriggerHandler) accept(trigger models.Trigger, delivery *models.WebhookDelivery) (int, map[string]interface{}) {
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, trigger.WorkflowID).Error; err != nil {
+		return http.StatusNotFound, map[string]interface{}{"error": "Workflow not found"}
+	}
+
+	input := webhook.Input(*delivery)
+	if trigger.PayloadSchema != "" {
+		_, err := schemas.ValidatePayload(trigger.PayloadSchema, trigger.PayloadSchemaVersion, input["body"])
+		var invalid *schemas.InvalidPayloadError
+		if errors.As(err, &invalid) {
+			delivery.Status = "rejected"
+			delivery.ErrorMessage = err.Error()
+			webhook.Record(trigger, delivery)
+			return http.StatusUnprocessableEntity, map[string]interface{}{"error": err.Error(), "problems": invalid.Problems}
+		}
+		if err != nil {
+			return http.StatusInternalServerError, map[string]interface{}{"error": err.Error()}
+		}
+	}
+
+	execution, err := h.dispatcher.DispatchTrigger(workflow, trigger, input)
+	if errors.Is(err, dispatch.ErrDropped) {
+		delivery.Status = "dropped"
+		webhook.Record(trigger, delivery)
+
+		response := map[string]interface{}{"status": "dropped"}
+		if delivery.ID != 0 {
+			response["delivery_id"] = delivery.ID
+		}
+		return http.StatusAccepted, response
+	}
+	var duplicate *dispatch.DuplicateError
+	if errors.As(err, &duplicate) {
+		delivery.Status = "duplicate"
+		delivery.ErrorMessage = err.Error()
+		webhook.Record(trigger, delivery)
+
+		response := map[string]interface{}{"status": "duplicate"}
+		if duplicate.ExecutionID != 0 {
+			response["execution_id"] = duplicate.ExecutionID
+		}
+		if delivery.ID != 0 {
+			response["delivery_id"] = delivery.ID
+		}
+		return http.StatusOK, response
+	}
+	if err != nil {
+		delivery.Status = "failed"
+		delivery.ErrorMessage = err.Error()
+		webhook.Record(trigger, delivery)
+		return dispatchError(err)
+	}
+
+	delivery.Status = "accepted"
+	delivery.WorkflowExecutionID = &execution.ID
+	webhook.Record(trigger, delivery)
+
+	response := map[string]interface{}{
+		"execution_id": execution.ID,
+		"status":       execution.Status,
+	}
+	if delivery.ID != 0 {
+		response["delivery_id"] = delivery.ID
+	}
+	return http.StatusAccepted, response
+}
+
+// validateTrigger checks the type of a trigger and prepares its webhook path or next scheduled run.
+// The webhook path of form and slack triggers is the path of their form or request URL.
+func validateTrigger(trigger *models.Trigger, workflow models.Workflow) error {
+	if trigger.Config == "" {
+		trigger.Config = "{}"
+	}
+
+	if trigger.MaxConcurrency < 0 || trigger.DebounceSeconds < 0 || trigger.ThrottleSeconds < 0 {
+		return errors.New("max_concurrency, debounce_seconds and throttle_seconds must not be negative")
+	}
+	switch trigger.ThrottleMode {
+	case "":
+		trigger.ThrottleMode = "queue"
+	case "queue", "drop":
+	default:
+		return errors.New("throttle_mode must be queue or drop")
+	}
+	if err := dispatch.ValidateDedupe(trigger); err != nil {
+		return err
+	}
+	if trigger.PayloadSchema != "" {
+		if _, err := schemas.Get(trigger.PayloadSchema, trigger.PayloadSchemaVersion); err != nil {
+			return fmt.Errorf("payload_schema %s version %d: %v", trigger.PayloadSchema, trigger.PayloadSchemaVersion, err)
+		}
+	}
+
+	switch trigger.TriggerType {
+	case "webhook", forms.TriggerType, slack.TriggerType:
+		if trigger.WebhookPath == "" {
+			path := make([]byte, 16)
+			if _, err := rand.Read(path); err != nil {
+				return err
+			}
+			trigger.WebhookPath = hex.EncodeToString(path)
+		}
+		if !webhookPathPattern.MatchString(trigger.WebhookPath) {
+			return errors.New("webhook_path must be 8 to 128 letters, digits, dashes or underscores")
+		}
+		if trigger.TriggerType == forms.TriggerType {
+			if _, err := forms.Parse(trigger.Config); err != nil {
+				return err
+			}
+		}
+		if trigger.TriggerType == slack.TriggerType {
+			cfg, err := slack.ParseConfig(trigger.Config)
+			if err != nil {
+				return err
+			}
+			if _, err := credentials.Resolve(cfg.CredentialID, workflow.OrganizationID, slack.CredentialType); err != nil {
+				return err
+			}
+		}
+	case brokers.MQTTTriggerType, brokers.AMQPTriggerType, brokers.SQSTriggerType:
+		trigger.WebhookPath = ""
+		if err := brokers.Validate(*trigger, workflow.OrganizationID); err != nil {
+			return err
+		}
+	case schedule.TriggerType:
+		trigger.WebhookPath = ""
+		next, err := schedule.NextRun(*trigger, workflow, time.Now())
+		if err != nil {
+			return err
+		}
+		if next == nil {
+			return errors.New("cron_expression never matches")
+		}
+		trigger.NextRunAt = next
+	default:
+		return errors.New("unsupported trigger type: " + trigger.TriggerType)
+	}
+
+	return nil
+}
@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/labstack/echo/v4"
+)
+
+// UserHandler manages the HTTP requests for users
+type UserHandler struct{}
+
+// NewUserHandler creates a new UserHandler
+func NewUserHandler() *UserHandler {
+	return &UserHandler{}
+}
+
+// UserRequest represents the input data for user creation/update
+type UserRequest struct {
+	Email          string `json:"email"`
+	Name           string `json:"name"`
+	Role           string `json:"role"`
+	OrganizationID uint   `json:"organization_id"`
+	IsActive       *bool  `json:"is_active"`
+	// Password sets the password of a local user
+	Password string `json:"password"`
+	// AuthProvider is local (default) or the identity provider (oidc, ldap) the user logs in with.
+	// The first login with the user's verified email address links the user to the identity.
+	AuthProvider string `json:"auth_provider"`
+}
+
+// validAuthProvider reports whether provider is a known authentication provider
+func validAuthProvider(provider string) bool {
+	return provider == "local" || provider == "oidc" || provider == "ldap"
+}
+
+// GetAll godoc
+// @Summary Get all users
+// @Description Returns a list of all users
+// @Tags users
+// @Accept json
+// @Produce json
+// @Success 200 {array} models.User
+// @Failure 500 {object} map[string]string
+// @Router /users [get]
+func (h *UserHandler) GetAll(c echo.Context) error {
+	var users []models.User
+	if err := database.DB.Find(&users).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, users)
+}
+
+// Create godoc
+// @Summary Create a user
+// @Description Creates a user authenticating with a password stored in FlowCraft, or a user of an identity provider linked on the first login
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param user body UserRequest true "User data"
+// @Success 201 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users [post]
+func (h *UserHandler) Create(c echo.Context) error {
+	var request UserRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if request.AuthProvider == "" {
+		request.AuthProvider = "local"
+	}
+	if !validAuthProvider(request.AuthProvider) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid auth provider"})
+	}
+	if request.Email == "" || (request.Password == "") == (request.AuthProvider == "local") {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "email and, for local users only, password are required"})
+	}
+	if request.Role == "" {
+		request.Role = models.RoleViewer
+	}
+	if !validRole(request.Role) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid role"})
+	}
+
+	user := models.User{
+		Email:          request.Email,
+		Name:           request.Name,
+		Role:           request.Role,
+		OrganizationID: request.OrganizationID,
+		AuthProvider:   request.AuthProvider,
+		IsActive:       true,
+	}
+	if request.Password != "" {
+		var err error
+		if user.PasswordHash, err = auth.HashPassword(request.Password); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+	}
+
+	if err := database.DB.Create(&user).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, user)
+}
+
+// Update godoc
+// @Summary Update a user
+// @Description Updates name, role, organization, active state, auth provider or (for local users) the password of a user. Moving a user to an identity provider removes the password.
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param user body UserRequest true "Updated user data"
+// @Success 200 {object} models.User
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/{id} [put]
+func (h *UserHandler) Update(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "User not found"})
+	}
+
+	var request UserRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if request.Name != "" {
+		user.Name = request.Name
+	}
+	if request.Role != "" {
+		if !validRole(request.Role) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid role"})
+		}
+		user.Role = request.Role
+	}
+	if request.OrganizationID != 0 {
+		user.OrganizationID = request.OrganizationID
+	}
+	if request.IsActive != nil {
+		user.IsActive = *request.IsActive
+	}
+	providerChanged := request.AuthProvider != "" && request.AuthProvider != user.AuthProvider
+	if providerChanged {
+		if !validAuthProvider(request.AuthProvider) {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid auth provider"})
+		}
+		if request.AuthProvider == "local" && request.Password == "" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "password is required for local users"})
+		}
+		user.AuthProvider = request.AuthProvider
+		user.ExternalID = ""
+		user.PasswordHash = ""
+	}
+	if request.Password != "" {
+		if user.AuthProvider != "local" {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Passwords can only be set for local users"})
+		}
+		if user.PasswordHash, err = auth.HashPassword(request.Password); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+	}
+
+	if err := database.DB.Save(&user).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	// Deactivated users, password and auth provider changes end all existing sessions
+	if !user.IsActive || request.Password != "" || providerChanged {
+		if err := auth.RevokeUserSessions(user.ID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+	}
+
+	return c.JSON(http.StatusOK, user)
+}
+
+// Delete godoc
+// @Summary Delete a user
+// @Description Deletes a user based on its ID
+// @Tags users
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/{id} [delete]
+func (h *UserHandler) Delete(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	if err := auth.RevokeUserSessions(uint(id)); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	if err := database.DB.Delete(&models.User{}, id).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
+
+// validRole reports whether role is a known user role
+func validRole(role string) bool {
+	return role == models.RoleAdmin || role == models.RoleEditor || role == models.RoleViewer
+}
+
+// RevokeSessions godoc
+// @Summary Revoke user sessions
+// @Description Logs a user out of all sessions
+// @Tags users
+// @Param id path int true "User ID"
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /users/{id}/sessions [delete]
+func (h *UserHandler) RevokeSessions(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	if err := auth.RevokeUserSessions(uint(id)); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/graphcache"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/rollout"
+	"github.com/labstack/echo/v4"
+)
+
+// VersionHandler manages the HTTP requests for published workflow versions and their rollout
+type VersionHandler struct{}
+
+// NewVersionHandler creates a new VersionHandler
+func NewVersionHandler() *VersionHandler {
+	return &VersionHandler{}
+}
+
+// errVersionImmutable is returned when changing the graph of a published version
+var errVersionImmutable = errors.New("published versions cannot be changed, publish a new version instead")
+
+// checkWorkflowEditable rejects changes to the nodes and connections of published versions
+func checkWorkflowEditable(workflowID uint) error {
+	var workflow models.Workflow
+	if database.DB.Select("id", "parent_id").Limit(1).Find(&workflow, workflowID).RowsAffected == 0 {
+		return nil
+	}
+	if workflow.ParentID != nil {
+		return errVersionImmutable
+	}
+	return nil
+}
+
+// Publish godoc
+// @Summary Publish a workflow version
+// @Description Copies the workflow with its nodes and connections into a new immutable version that can be rolled out to its triggers. The change note is stored with the version and required if REQUIRE_CHANGE_NOTES is set. The version pins the current node type versions, or those given in node_type_versions.
+// @Tags versions
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Param request body models.PublishRequest false "Change note"
+// @Success 201 {object} models.Workflow
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/versions [post]
+func (h *VersionHandler) Publish(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+
+	var request models.PublishRequest
+	if c.Request().ContentLength != 0 {
+		if err := c.Bind(&request); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+
+	var publishedBy *uint
+	if user := auth.CurrentUser(c); user != nil {
+		publishedBy = &user.ID
+	}
+
+	version, err := rollout.Publish(workflow.ID, request.ChangeNote, request.NodeTypeVersions, publishedBy)
+	if errors.Is(err, rollout.ErrVersion) || errors.Is(err, rollout.ErrChangeNoteRequired) || errors.Is(err, rollout.ErrPin) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, version)
+}
+
+// GetVersions godoc
+// @Summary Get workflow versions
+// @Description Returns the published versions of a workflow, newest first
+// @Tags versions
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Success 200 {array} models.Workflow
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/versions [get]
+func (h *VersionHandler) GetVersions(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	versions, err := rollout.Versions(uint(id))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, versions)
+}
+
+// SetRollout godoc
+// @Summary Set the rollout of a workflow
+// @Description Sets the live version run by the workflow's triggers and optionally a canary version receiving canary_percent of their executions. Without a live version the triggers run the workflow itself.
+// @Tags versions
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Param rollout body models.RolloutRequest true "Rollout"
+// @Success 200 {object} models.Workflow
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/rollout [put]
+func (h *VersionHandler) SetRollout(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+	if workflow.ParentID != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Published versions have no rollout"})
+	}
+
+	var request models.RolloutRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if request.CanaryVersionID == nil {
+		request.CanaryPercent = 0
+	}
+	if err := rollout.Validate(workflow, request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	workflow.LiveVersionID = request.LiveVersionID
+	workflow.CanaryVersionID = request.CanaryVersionID
+	workflow.CanaryPercent = request.CanaryPercent
+	err = database.DB.Model(&workflow).Updates(map[string]interface{}{
+		"live_version_id":   request.LiveVersionID,
+		"canary_version_id": request.CanaryVersionID,
+		"canary_percent":    request.CanaryPercent,
+	}).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	graphcache.InvalidateWorkflow(workflow.ID)
+
+	return c.JSON(http.StatusOK, workflow)
+}
+
+// GetRolloutStats godoc
+// @Summary Get rollout statistics
+// @Description Compares the executions of the live and canary version of a workflow
+// @Tags versions
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Param since query string false "Time window, e.g. 1h (default 24h)"
+// @Success 200 {array} models.VersionStats
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/rollout/stats [get]
+func (h *VersionHandler) GetRolloutStats(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	window := 24 * time.Hour
+	if v := c.QueryParam("since"); v != "" {
+		if window, err = time.ParseDuration(v); err != nil || window <= 0 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid since, expected a duration like 1h"})
+		}
+	}
+
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+
+	stats, err := rollout.Stats(workflow, time.Now().Add(-window))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if stats == nil {
+		stats = []models.VersionStats{}
+	}
+	return c.JSON(http.StatusOK, stats)
+}
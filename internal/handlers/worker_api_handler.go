@@ -0,0 +1,576 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/engine"
+	"github.com/altipard/flowcraft/internal/graphcache"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/workerapi"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// workerNodeStatuses are the statuses workers may store for node executions
+var workerNodeStatuses = map[string]bool{
+	"running":   true,
+	"waiting":   true,
+	"completed": true,
+	"failed":    true,
+	"skipped":   true,
+}
+
+// WorkerAPIHandler manages the requests of workers without database access, which load their
+// executions and report the results of their nodes through the internal API
+type WorkerAPIHandler struct {
+	store engine.DatabaseStore
+}
+
+// NewWorkerAPIHandler creates a new WorkerAPIHandler
+func NewWorkerAPIHandler() *WorkerAPIHandler {
+	return &WorkerAPIHandler{}
+}
+
+// GetExecution godoc
+// @Summary Load an execution for a worker
+// @Description Returns an execution with its workflow graph and the node types of its nodes. Requires the internal API service token.
+// @Tags internal
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Success 200 {object} workerapi.ExecutionDefinition
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Router /internal/executions/{id} [get]
+func (h *WorkerAPIHandler) GetExecution(c echo.Context) error {
+	execution, err := h.loadExecution(c)
+	if err != nil {
+		return workerAPIErrorResponse(c, err)
+	}
+
+	definition := workerapi.ExecutionDefinition{
+		Execution: *execution,
+		Workflow:  execution.Workflow,
+		NodeTypes: []models.NodeType{},
+	}
+	loaded := map[string]bool{}
+	for _, node := range execution.Workflow.Nodes {
+		if loaded[node.NodeType] {
+			continue
+		}
+		loaded[node.NodeType] = true
+		// Unknown node types fail the node when it runs
+		if nodeType, err := graphcache.NodeType(node.NodeType); err == nil {
+			definition.NodeTypes = append(definition.NodeTypes, nodeType)
+		}
+	}
+
+	return c.JSON(http.StatusOK, definition)
+}
+
+// UpdateExecution godoc
+// @Summary Update a running execution
+// @Description Stores the status, start time and output of an execution a worker runs. Workers can only set executions to running or waiting, they finish them with the complete endpoint. Finished executions cannot be updated (409). Requires the internal API service token.
+// @Tags internal
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Param execution body models.WorkflowExecution true "Execution"
+// @Success 200 {object} models.WorkflowExecution
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /internal/executions/{id} [put]
+func (h *WorkerAPIHandler) UpdateExecution(c echo.Context) error {
+	execution, err := h.loadRunningExecution(c)
+	if err != nil {
+		return workerAPIErrorResponse(c, err)
+	}
+
+	var update models.WorkflowExecution
+	if err := c.Bind(&update); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if update.Status != "running" && update.Status != "waiting" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Status must be running or waiting"})
+	}
+	if update.OutputData != "" && !json.Valid([]byte(update.OutputData)) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "output_data must be JSON"})
+	}
+
+	updates := map[string]interface{}{"status": update.Status}
+	if !update.StartedAt.IsZero() {
+		updates["started_at"] = update.StartedAt
+	}
+	if update.OutputData != "" {
+		updates["output_data"] = update.OutputData
+	}
+	if err := database.DB.Model(execution).Updates(updates).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, execution)
+}
+
+// CompleteExecution godoc
+// @Summary Complete an execution
+// @Description Stores the final status of an execution a worker ran, then delivers its output to the workflow's sinks, starts the chained workflows and applies the capture mode. Requires the internal API service token.
+// @Tags internal
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Param execution body models.WorkflowExecution true "Execution with status completed, failed or cancelled"
+// @Success 200 {object} models.WorkflowExecution
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /internal/executions/{id}/complete [post]
+func (h *WorkerAPIHandler) CompleteExecution(c echo.Context) error {
+	execution, err := h.loadExecution(c)
+	if err != nil {
+		return workerAPIErrorResponse(c, err)
+	}
+	if execution.Status == "completed" || execution.Status == "failed" || execution.Status == engine.StatusCancelled {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Execution is already " + execution.Status})
+	}
+
+	var update models.WorkflowExecution
+	if err := c.Bind(&update); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if update.Status != "completed" && update.Status != "failed" && update.Status != engine.StatusCancelled {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Status must be completed, failed or cancelled"})
+	}
+	// Only executions whose cancellation was requested can be cancelled by their worker
+	if update.Status == engine.StatusCancelled && execution.CancelRequestedAt == nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": "Execution was not cancelled"})
+	}
+	if update.OutputData != "" && !json.Valid([]byte(update.OutputData)) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "output_data must be JSON"})
+	}
+
+	execution.Status = update.Status
+	execution.ErrorMessage = update.ErrorMessage
+	execution.CompletedAt = update.CompletedAt
+	if execution.CompletedAt == nil {
+		now := time.Now()
+		execution.CompletedAt = &now
+	}
+	if update.OutputData != "" {
+		execution.OutputData = update.OutputData
+	}
+	if err := engine.CompleteExecution(execution); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusOK, execution)
+}
+
+// GetCancelRequested godoc
+// @Summary Check whether the cancellation of an execution was requested
+// @Description Reports whether the cancellation of an execution was requested, which workers check before each node. Requires the internal API service token.
+// @Tags internal
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Success 200 {object} map[string]bool
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /internal/executions/{id}/cancel-requested [get]
+func (h *WorkerAPIHandler) GetCancelRequested(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	requested, err := h.store.CancelRequested(uint(id))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, map[string]bool{"cancel_requested": requested})
+}
+
+// GetNodeExecutions godoc
+// @Summary List node executions for a worker
+// @Description Returns the node executions of an execution, oldest first, optionally only those of a node or in the given statuses. Requires the internal API service token.
+// @Tags internal
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Param node_id query int false "Node ID"
+// @Param status query []string false "Statuses" collectionFormat(multi)
+// @Param exclude_compensations query bool false "Leave out the executions of compensation nodes"
+// @Success 200 {array} models.NodeExecution
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /internal/executions/{id}/node-executions [get]
+func (h *WorkerAPIHandler) GetNodeExecutions(c echo.Context) error {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	filter := engine.NodeExecutionFilter{
+		Statuses:             c.QueryParams()["status"],
+		ExcludeCompensations: c.QueryParam("exclude_compensations") == "true",
+	}
+	if param := c.QueryParam("node_id"); param != "" {
+		nodeID, err := strconv.ParseUint(param, 10, 32)
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid node_id"})
+		}
+		filter.NodeID = uint(nodeID)
+	}
+
+	nodeExecutions, err := h.store.NodeExecutions(uint(id), filter)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	if nodeExecutions == nil {
+		nodeExecutions = []models.NodeExecution{}
+	}
+
+	return c.JSON(http.StatusOK, nodeExecutions)
+}
+
+// CreateNodeExecution godoc
+// @Summary Create a node execution
+// @Description Records the execution of a node of the execution's workflow by a worker. With previous_id the node execution claims the node: it is only created if the latest execution of the node is still the one with that ID (0 for none), otherwise 412 is returned. Finished executions get no further node executions (409). Requires the internal API service token.
+// @Tags internal
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Param previous_id query int false "ID of the latest execution of the node seen by the worker, to claim the node"
+// @Param node_execution body models.NodeExecution true "Node execution"
+// @Success 201 {object} models.NodeExecution
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /internal/executions/{id}/node-executions [post]
+func (h *WorkerAPIHandler) CreateNodeExecution(c echo.Context) error {
+	execution, err := h.loadRunningExecution(c)
+	if err != nil {
+		return workerAPIErrorResponse(c, err)
+	}
+
+	var nodeExecution models.NodeExecution
+	if err := c.Bind(&nodeExecution); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	nodeExecution.ID = 0
+	nodeExecution.WorkflowExecutionID = execution.ID
+	nodeExecution.AnomalyScore = nil
+	if err := validateWorkerNodeExecution(execution, nodeExecution); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := h.saveNodeExecution(c, &nodeExecution); err != nil {
+		return workerAPIErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusCreated, nodeExecution)
+}
+
+// UpdateNodeExecution godoc
+// @Summary Update a node execution
+// @Description Stores the progress and result of a node execution reported by a worker. The node of a node execution cannot be changed. With previous_id the update claims the node like creating a node execution does. The node executions of finished executions cannot be updated (409). Requires the internal API service token.
+// @Tags internal
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Param node_execution_id path int true "Node execution ID"
+// @Param previous_id query int false "ID of the latest execution of the node seen by the worker, to claim the node"
+// @Param node_execution body models.NodeExecution true "Node execution"
+// @Success 200 {object} models.NodeExecution
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 412 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /internal/executions/{id}/node-executions/{node_execution_id} [put]
+func (h *WorkerAPIHandler) UpdateNodeExecution(c echo.Context) error {
+	execution, err := h.loadRunningExecution(c)
+	if err != nil {
+		return workerAPIErrorResponse(c, err)
+	}
+	existing, err := loadWorkerNodeExecution(c, execution.ID)
+	if err != nil {
+		return workerAPIErrorResponse(c, err)
+	}
+
+	var nodeExecution models.NodeExecution
+	if err := c.Bind(&nodeExecution); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if nodeExecution.NodeID != existing.NodeID {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "The node of a node execution cannot be changed"})
+	}
+	nodeExecution.ID = existing.ID
+	nodeExecution.WorkflowExecutionID = existing.WorkflowExecutionID
+	nodeExecution.CompensatedNodeID = existing.CompensatedNodeID
+	nodeExecution.AnomalyScore = existing.AnomalyScore
+	nodeExecution.CreatedAt = existing.CreatedAt
+	if err := validateWorkerNodeExecution(execution, nodeExecution); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	if err := h.saveNodeExecution(c, &nodeExecution); err != nil {
+		return workerAPIErrorResponse(c, err)
+	}
+
+	return c.JSON(http.StatusOK, nodeExecution)
+}
+
+// CreateNodeProfile godoc
+// @Summary Store the profile of a node execution
+// @Description Stores the time and allocation breakdown of a node execution of a profiled execution. Requires the internal API service token.
+// @Tags internal
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Param node_execution_id path int true "Node execution ID"
+// @Param profile body models.NodeProfile true "Profile"
+// @Success 201 {object} models.NodeProfile
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /internal/executions/{id}/node-executions/{node_execution_id}/profile [post]
+func (h *WorkerAPIHandler) CreateNodeProfile(c echo.Context) error {
+	execution, err := h.loadExecution(c)
+	if err != nil {
+		return workerAPIErrorResponse(c, err)
+	}
+	nodeExecution, err := loadWorkerNodeExecution(c, execution.ID)
+	if err != nil {
+		return workerAPIErrorResponse(c, err)
+	}
+
+	var profile models.NodeProfile
+	if err := c.Bind(&profile); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	profile.ID = 0
+	profile.WorkflowExecutionID = execution.ID
+	profile.NodeExecutionID = nodeExecution.ID
+	profile.NodeID = nodeExecution.NodeID
+
+	if err := h.store.SaveNodeProfile(&profile); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, profile)
+}
+
+// CreateArtifact godoc
+// @Summary Record an artifact of a node execution
+// @Description Records an output of a node execution kept as artifact, whose contents the worker stored in the blob store. Requires the internal API service token.
+// @Tags internal
+// @Accept json
+// @Produce json
+// @Param id path int true "Execution ID"
+// @Param node_execution_id path int true "Node execution ID"
+// @Param artifact body models.ExecutionArtifact true "Artifact"
+// @Success 201 {object} models.ExecutionArtifact
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /internal/executions/{id}/node-executions/{node_execution_id}/artifacts [post]
+func (h *WorkerAPIHandler) CreateArtifact(c echo.Context) error {
+	execution, err := h.loadExecution(c)
+	if err != nil {
+		return workerAPIErrorResponse(c, err)
+	}
+	nodeExecution, err := loadWorkerNodeExecution(c, execution.ID)
+	if err != nil {
+		return workerAPIErrorResponse(c, err)
+	}
+
+	var artifact models.ExecutionArtifact
+	if err := c.Bind(&artifact); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	artifact.ID = 0
+	artifact.WorkflowExecutionID = execution.ID
+	artifact.NodeExecutionID = nodeExecution.ID
+	artifact.NodeID = nodeExecution.NodeID
+
+	if err := h.store.SaveArtifact(&artifact); err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+
+	return c.JSON(http.StatusCreated, artifact)
+}
+
+// GetNodeType godoc
+// @Summary Load a node type for a worker
+// @Description Returns the node type with the given key. Requires the internal API service token.
+// @Tags internal
+// @Produce json
+// @Param key path string true "Node type key"
+// @Success 200 {object} models.NodeType
+// @Failure 401 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /internal/node-types/{key} [get]
+func (h *WorkerAPIHandler) GetNodeType(c echo.Context) error {
+	nodeType, err := h.store.NodeType(c.Param("key"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Node type not found"})
+	}
+
+	return c.JSON(http.StatusOK, nodeType)
+}
+
+// Errors loading the records of worker requests, see workerAPIErrorResponse
+var (
+	errWorkerInvalidID         = errors.New("Invalid ID")
+	errWorkerExecutionNotFound = errors.New("Execution not found")
+	errWorkerExecutionArchived = errors.New("Execution is archived")
+	errWorkerExecutionFinished = errors.New("Execution is already finished")
+	errWorkerNodeNotFound      = errors.New("Node execution not found")
+	errWorkerNodeClaimed       = errors.New("Node already claimed by another run")
+)
+
+// workerAPIErrorResponse maps errors loading the records of worker requests to responses
+func workerAPIErrorResponse(c echo.Context, err error) error {
+	switch {
+	case errors.Is(err, errWorkerInvalidID):
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	case errors.Is(err, errWorkerExecutionNotFound), errors.Is(err, errWorkerNodeNotFound):
+		return c.JSON(http.StatusNotFound, map[string]string{"error": err.Error()})
+	case errors.Is(err, errWorkerExecutionArchived), errors.Is(err, errWorkerExecutionFinished):
+		return c.JSON(http.StatusConflict, map[string]string{"error": err.Error()})
+	case errors.Is(err, errWorkerNodeClaimed):
+		return c.JSON(http.StatusPreconditionFailed, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+}
+
+// loadExecution loads the execution of the path with its workflow graph. Archived executions
+// can no longer be run.
+func (h *WorkerAPIHandler) loadExecution(c echo.Context) (*models.WorkflowExecution, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return nil, errWorkerInvalidID
+	}
+
+	execution, err := h.store.Execution(uint(id))
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return nil, errWorkerExecutionNotFound
+	case err != nil:
+		return nil, err
+	case execution.ArchivedAt != nil:
+		return nil, errWorkerExecutionArchived
+	}
+	return execution, nil
+}
+
+// loadRunningExecution loads the execution of the path like loadExecution. Executions that
+// completed, failed or were cancelled can no longer be changed by workers.
+func (h *WorkerAPIHandler) loadRunningExecution(c echo.Context) (*models.WorkflowExecution, error) {
+	execution, err := h.loadExecution(c)
+	if err != nil {
+		return nil, err
+	}
+	if execution.Status == "completed" || execution.Status == "failed" || execution.Status == engine.StatusCancelled {
+		return nil, errWorkerExecutionFinished
+	}
+	return execution, nil
+}
+
+// loadWorkerNodeExecution loads the node execution of the path, which must belong to the execution
+func loadWorkerNodeExecution(c echo.Context, executionID uint) (*models.NodeExecution, error) {
+	id, err := strconv.ParseUint(c.Param("node_execution_id"), 10, 32)
+	if err != nil {
+		return nil, errWorkerInvalidID
+	}
+
+	var nodeExecution models.NodeExecution
+	err = database.DB.Where("workflow_execution_id = ?", executionID).First(&nodeExecution, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errWorkerNodeNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &nodeExecution, nil
+}
+
+// saveNodeExecution stores a node execution reported by a worker, as a claim of its node if the
+// worker passed the ID of the latest execution of the node it saw (see engine.Store.ClaimNode)
+func (h *WorkerAPIHandler) saveNodeExecution(c echo.Context, nodeExecution *models.NodeExecution) error {
+	previous := c.QueryParam("previous_id")
+	if previous == "" {
+		return h.store.SaveNodeExecution(nodeExecution)
+	}
+	previousID, err := strconv.ParseUint(previous, 10, 32)
+	if err != nil {
+		return errWorkerInvalidID
+	}
+	claimed, err := h.store.ClaimNode(nodeExecution, uint(previousID))
+	if err != nil {
+		return err
+	}
+	if !claimed {
+		return errWorkerNodeClaimed
+	}
+	return nil
+}
+
+// validateWorkerNodeExecution checks a node execution reported by a worker: it must execute a
+// node of the execution's workflow in a known status, and its payloads must be JSON
+func validateWorkerNodeExecution(execution *models.WorkflowExecution, nodeExecution models.NodeExecution) error {
+	nodes := map[uint]bool{}
+	for _, node := range execution.Workflow.Nodes {
+		nodes[node.ID] = true
+	}
+
+	if !nodes[nodeExecution.NodeID] {
+		return fmt.Errorf("Node %d is not part of workflow %d", nodeExecution.NodeID, execution.WorkflowID)
+	}
+	if nodeExecution.CompensatedNodeID != nil && !nodes[*nodeExecution.CompensatedNodeID] {
+		return fmt.Errorf("Node %d is not part of workflow %d", *nodeExecution.CompensatedNodeID, execution.WorkflowID)
+	}
+	if !workerNodeStatuses[nodeExecution.Status] {
+		return fmt.Errorf("Invalid status %q", nodeExecution.Status)
+	}
+	if category := engine.ErrorCategory(nodeExecution.ErrorCategory); category != "" && !validErrorCategory(category) {
+		return fmt.Errorf("Invalid error category %q", nodeExecution.ErrorCategory)
+	}
+	if nodeExecution.InputData != "" && !json.Valid([]byte(nodeExecution.InputData)) {
+		return errors.New("input_data must be JSON")
+	}
+	if nodeExecution.OutputData != "" && !json.Valid([]byte(nodeExecution.OutputData)) {
+		return errors.New("output_data must be JSON")
+	}
+	return nil
+}
+
+// validErrorCategory reports whether the category is one of the known error categories
+func validErrorCategory(category engine.ErrorCategory) bool {
+	for _, known := range engine.ErrorCategories {
+		if category == known {
+			return true
+		}
+	}
+	return false
+}
@@ -1,12 +1,30 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/altipard/flowcraft/internal/auth"
+	"github.com/altipard/flowcraft/internal/bpmn"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/dependencies"
+	"github.com/altipard/flowcraft/internal/dispatch"
+	"github.com/altipard/flowcraft/internal/expression"
+	"github.com/altipard/flowcraft/internal/graphcache"
+	"github.com/altipard/flowcraft/internal/importer"
+	"github.com/altipard/flowcraft/internal/inference"
+	"github.com/altipard/flowcraft/internal/layout"
 	"github.com/altipard/flowcraft/internal/models"
 	"github.com/altipard/flowcraft/internal/repository"
+	"github.com/altipard/flowcraft/internal/sla"
+	"github.com/altipard/flowcraft/internal/state"
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 // WorkflowHandler manages the workflow-related API endpoints
@@ -75,6 +93,20 @@ func (h *WorkflowHandler) Create(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
 
+	if err := validateCaptureMode(workflow); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := sla.Validate(workflow); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := dispatch.ValidateRetryPolicy(workflow); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	// Versions are published and rolled out through /versions and /rollout
+	workflow.ParentID, workflow.Version = nil, 0
+	workflow.LiveVersionID, workflow.CanaryVersionID, workflow.CanaryPercent = nil, nil, 0
+
 	if err := h.repo.Create(workflow); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
@@ -82,6 +114,93 @@ func (h *WorkflowHandler) Create(c echo.Context) error {
 	return c.JSON(http.StatusCreated, workflow)
 }
 
+// Import godoc
+// @Summary Import a workflow from another automation tool
+// @Description Converts an n8n workflow, a Zapier export or a BPMN 2.0 process into a new workflow. Steps without FlowCraft equivalent become sticky notes; they and other steps to review are listed in the warnings. With dry_run the converted workflow is only returned.
+// @Tags workflows
+// @Accept json,xml
+// @Produce json
+// @Param format query string true "n8n, zapier or bpmn"
+// @Param dry_run query bool false "Return the converted workflow without creating it"
+// @Param export body object true "Exported workflow"
+// @Success 201 {object} models.ImportResult
+// @Failure 400 {object} map[string]string
+// @Failure 413 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/import [post]
+func (h *WorkflowHandler) Import(c echo.Context) error {
+	data, err := io.ReadAll(io.LimitReader(c.Request().Body, maxSpecSize+1))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if len(data) > maxSpecSize {
+		return c.JSON(http.StatusRequestEntityTooLarge, map[string]string{"error": "Export too large"})
+	}
+
+	result, err := importer.Convert(c.QueryParam("format"), data)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	for _, node := range result.Workflow.Nodes {
+		if err := checkNodeTypeAllowed(node.NodeType); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+	if c.QueryParam("dry_run") == "true" {
+		return c.JSON(http.StatusOK, result)
+	}
+
+	if user := auth.CurrentUser(c); user != nil {
+		result.Workflow.CreatedBy = user.ID
+	}
+	workflow, err := importer.Create(result.Workflow)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	result.Workflow = *workflow
+
+	return c.JSON(http.StatusCreated, result)
+}
+
+// ExportBPMN godoc
+// @Summary Export a workflow as BPMN 2.0
+// @Description Converts the nodes and connections of a workflow into a BPMN 2.0 process with diagram, for exchanging process definitions with BPM tools. Nodes become service or user tasks carrying their node type and configuration, the output handles of branching nodes exclusive gateways and sticky notes text annotations.
+// @Tags workflows
+// @Produce xml
+// @Param id path int true "Workflow ID"
+// @Success 200 {string} string "BPMN 2.0 XML"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/bpmn [get]
+func (h *WorkflowHandler) ExportBPMN(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var workflow models.Workflow
+	if err := database.DB.Preload("Nodes").Preload("Connections").First(&workflow, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+
+	var nodeTypes []models.NodeType
+	if err := database.DB.Select("key", "executor_class").Find(&nodeTypes).Error; err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	executorClasses := make(map[string]string, len(nodeTypes))
+	for _, nodeType := range nodeTypes {
+		executorClasses[nodeType.Key] = nodeType.ExecutorClass
+	}
+
+	data, err := bpmn.Export(workflow, executorClasses)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=\"workflow-%d.bpmn\"", workflow.ID))
+	return c.Blob(http.StatusOK, echo.MIMEApplicationXMLCharsetUTF8, data)
+}
+
 // Update godoc
 // @Summary Update a workflow
 // @Description Updates an existing workflow with the provided data
@@ -93,6 +212,7 @@ func (h *WorkflowHandler) Create(c echo.Context) error {
 // @Success 200 {object} models.Workflow
 // @Failure 400 {object} map[string]string
 // @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string
 // @Router /workflows/{id} [put]
 func (h *WorkflowHandler) Update(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("id"))
@@ -104,14 +224,33 @@ func (h *WorkflowHandler) Update(c echo.Context) error {
 	if err != nil {
 		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
 	}
+	if workflow.ParentID != nil {
+		return c.JSON(http.StatusConflict, map[string]string{"error": errVersionImmutable.Error()})
+	}
+	// Versions and their rollout are managed through /versions and /rollout
+	liveVersionID, canaryVersionID, canaryPercent := workflow.LiveVersionID, workflow.CanaryVersionID, workflow.CanaryPercent
 
 	if err := c.Bind(&workflow); err != nil {
 		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
 	}
+	workflow.ID = uint(id)
+	workflow.ParentID, workflow.Version = nil, 0
+	workflow.LiveVersionID, workflow.CanaryVersionID, workflow.CanaryPercent = liveVersionID, canaryVersionID, canaryPercent
+
+	if err := validateCaptureMode(&workflow); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := sla.Validate(&workflow); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if err := dispatch.ValidateRetryPolicy(&workflow); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
 
 	if err := h.repo.Update(&workflow); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	graphcache.InvalidateWorkflow(workflow.ID)
 
 	return c.JSON(http.StatusOK, workflow)
 }
@@ -135,6 +274,273 @@ func (h *WorkflowHandler) Delete(c echo.Context) error {
 	if err := h.repo.Delete(uint(id)); err != nil {
 		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
 	}
+	graphcache.InvalidateWorkflow(uint(id))
+
+	// The published versions go with the workflow
+	var versionIDs []uint
+	database.DB.Model(&models.Workflow{}).Where("parent_id = ?", id).Pluck("id", &versionIDs)
+	for _, versionID := range versionIDs {
+		if err := h.repo.Delete(versionID); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		graphcache.InvalidateWorkflow(versionID)
+	}
 
 	return c.NoContent(http.StatusNoContent)
 }
+
+// GetDependencies godoc
+// @Summary Get workflow dependencies
+// @Description Returns the workflows connected to a workflow through events, the credentials and state keys its nodes use, the triggers starting it and its published versions
+// @Tags workflows
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Success 200 {object} models.WorkflowDependencies
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/dependencies [get]
+func (h *WorkflowHandler) GetDependencies(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+
+	deps, err := dependencies.Analyze(workflow)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, deps)
+}
+
+// GetSLABreaches godoc
+// @Summary Get the SLA breaches of a workflow
+// @Description Returns the recorded breaches of the workflow's SLA, newest first: executions exceeding the maximum duration and periods the failure rate exceeded the maximum
+// @Tags workflows
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Param limit query int false "Maximum number of breaches (default 100)"
+// @Success 200 {array} models.SLABreach
+// @Failure 400 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/sla-breaches [get]
+func (h *WorkflowHandler) GetSLABreaches(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	limit := 100
+	if param := c.QueryParam("limit"); param != "" {
+		if limit, err = strconv.Atoi(param); err != nil || limit <= 0 || limit > 1000 {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid limit, expected 1 to 1000"})
+		}
+	}
+
+	breaches := []models.SLABreach{}
+	err = database.Replica().Where("workflow_id = ?", id).Order("created_at DESC").Limit(limit).Find(&breaches).Error
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, breaches)
+}
+
+// GetObservedSchemas godoc
+// @Summary Get the observed output schemas of a workflow's nodes
+// @Description Returns the JSON schemas inferred from the recent outputs of the workflow's nodes by node ID, for autocompletion of expressions in the editor. Nodes that were not executed yet get the schema observed for their node type; nodes without observed outputs are left out.
+// @Tags workflows
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Success 200 {object} map[string]models.ObservedOutputSchema
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/observed-schemas [get]
+func (h *WorkflowHandler) GetObservedSchemas(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var workflow models.Workflow
+	if err := database.DB.Preload("Nodes").First(&workflow, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+
+	schemas, err := inference.ForNodes(workflow.Nodes)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+	}
+	return c.JSON(http.StatusOK, schemas)
+}
+
+// Layout godoc
+// @Summary Lay out a workflow
+// @Description Computes tidy canvas positions for all nodes of a workflow with a layered DAG layout and saves them, e.g. for imported or programmatically created workflows. With dry_run the positions are only returned.
+// @Tags workflows
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Param dry_run query bool false "Return the positions without saving them"
+// @Param options body layout.Options false "Direction (LR or TB) and spacings"
+// @Success 200 {array} models.Node
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 500 {object} map[string]string
+// @Router /workflows/{id}/layout [post]
+func (h *WorkflowHandler) Layout(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+
+	var opts layout.Options
+	if c.Request().ContentLength != 0 {
+		if err := c.Bind(&opts); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+	if err := opts.Validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+
+	var workflow models.Workflow
+	if err := database.DB.Preload("Nodes").Preload("Connections").First(&workflow, id).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Workflow not found"})
+	}
+
+	positions := layout.Compute(workflow.Nodes, workflow.Connections, opts)
+	for i := range workflow.Nodes {
+		if position, ok := positions[workflow.Nodes[i].ID]; ok {
+			workflow.Nodes[i].PositionX = position.X
+			workflow.Nodes[i].PositionY = position.Y
+		}
+	}
+
+	if c.QueryParam("dry_run") != "true" {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			for _, node := range workflow.Nodes {
+				if _, ok := positions[node.ID]; !ok {
+					continue
+				}
+				err := tx.Model(&models.Node{}).Where("id = ?", node.ID).
+					Updates(map[string]interface{}{"position_x": node.PositionX, "position_y": node.PositionY}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		}
+		graphcache.InvalidateWorkflow(workflow.ID)
+	}
+
+	return c.JSON(http.StatusOK, workflow.Nodes)
+}
+
+// EvaluateExpression godoc
+// @Summary Preview an expression
+// @Description Evaluates an expression like "{{ input.0.user.name }}" against the input of the latest captured execution of a node (or the given input) for live previews in the editor. Evaluation errors are returned in the error field; $state placeholders read the state of the workflow, $secret placeholders are not resolved.
+// @Tags workflows
+// @Accept json
+// @Produce json
+// @Param id path int true "Workflow ID"
+// @Param nodeId path int true "Node ID"
+// @Param request body models.ExpressionPreviewRequest true "Expression to evaluate"
+// @Success 200 {object} models.ExpressionPreview
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /workflows/{id}/nodes/{nodeId}/evaluate [post]
+func (h *WorkflowHandler) EvaluateExpression(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid ID"})
+	}
+	nodeID, err := strconv.Atoi(c.Param("nodeId"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid node ID"})
+	}
+
+	var request models.ExpressionPreviewRequest
+	if err := c.Bind(&request); err != nil {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": err.Error()})
+	}
+	if request.Expression == "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"error": "expression is required"})
+	}
+
+	var node models.Node
+	if err := database.DB.Where("workflow_id = ?", id).First(&node, nodeID).Error; err != nil {
+		return c.JSON(http.StatusNotFound, map[string]string{"error": "Node not found"})
+	}
+
+	preview := models.ExpressionPreview{}
+	input := request.Input
+	if input == nil {
+		// The input of the latest execution of the node whose payloads were kept
+		var sample models.NodeExecution
+		found := database.DB.Joins("JOIN workflow_executions ON workflow_executions.id = node_executions.workflow_execution_id").
+			Where("node_executions.node_id = ? AND node_executions.status IN ? AND workflow_executions.data_captured", node.ID, []string{"completed", "failed", "waiting"}).
+			Order("node_executions.id DESC").Limit(1).Find(&sample).RowsAffected > 0
+		if !found {
+			return c.JSON(http.StatusNotFound, map[string]string{"error": "No sample data captured for this node, provide an input"})
+		}
+		if err := json.Unmarshal([]byte(sample.InputData), &input); err != nil {
+			return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to parse sample input: " + err.Error()})
+		}
+		preview.NodeExecutionID = sample.ID
+	}
+
+	resolver := state.Resolver{WorkflowID: node.WorkflowID}
+	opts := expression.Options{Namespaces: map[string]expression.Resolver{"state": resolver.Resolve}}
+	result, err := expression.RenderValue(request.Expression, input, opts)
+	if err != nil {
+		preview.Error = err.Error()
+	} else {
+		preview.Result = result
+	}
+	preview.Unresolved = expression.Unresolved(request.Expression, input, opts)
+	if preview.Unresolved == nil {
+		preview.Unresolved = []string{}
+	}
+
+	return c.JSON(http.StatusOK, preview)
+}
+
+// validateCaptureMode checks the capture settings of a workflow, defaulting to full capture
+func validateCaptureMode(workflow *models.Workflow) error {
+	switch workflow.CaptureMode {
+	case "":
+		workflow.CaptureMode = models.CaptureFull
+	case models.CaptureFull, models.CaptureMetadata, models.CaptureErrors:
+	case models.CaptureSample:
+		if workflow.SampleRate < 1 {
+			return errors.New("sample_rate must be at least 1 for capture mode sample")
+		}
+	case models.CaptureTail:
+		if workflow.SampleRate < 0 {
+			return errors.New("sample_rate must not be negative")
+		}
+		if workflow.CaptureSlowAfter != "" {
+			if d, err := time.ParseDuration(workflow.CaptureSlowAfter); err != nil || d <= 0 {
+				return errors.New("capture_slow_after must be a positive duration like 30s")
+			}
+		}
+		if workflow.CaptureSlowScore < 0 {
+			return errors.New("capture_slow_score must not be negative")
+		}
+	default:
+		return fmt.Errorf("unknown capture mode: %s", workflow.CaptureMode)
+	}
+	return nil
+}
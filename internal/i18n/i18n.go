@@ -0,0 +1,175 @@
+// Package i18n localizes the messages of the API for the language requested with the
+// Accept-Language header. Messages are written in English, which is also the fallback. The
+// catalog of a language (locales/<language>.json) maps English messages to their translation;
+// %s in a message stands for a variable part, e.g. an ID, and is kept in the translation.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/text/language"
+)
+
+//go:embed locales/*.json
+var locales embed.FS
+
+// catalog holds the translations of a language
+type catalog struct {
+	// messages are the translations of messages without variable parts
+	messages map[string]string
+	// patterns are the translations of messages with variable parts
+	patterns []pattern
+}
+
+// pattern translates the messages matching a message with variable parts
+type pattern struct {
+	re          *regexp.Regexp
+	translation string
+}
+
+var (
+	// catalogs are the translations by language, English has none
+	catalogs = map[language.Tag]*catalog{}
+	// supported are the languages with a catalog and English, the default
+	supported = []language.Tag{language.English}
+	// matcher picks the supported language closest to the requested ones
+	matcher language.Matcher
+)
+
+func init() {
+	files, _ := locales.ReadDir("locales")
+	for _, file := range files {
+		tag, err := language.Parse(strings.TrimSuffix(file.Name(), path.Ext(file.Name())))
+		if err != nil {
+			log.Printf("Ignoring locale %s: %v", file.Name(), err)
+			continue
+		}
+		data, err := locales.ReadFile("locales/" + file.Name())
+		if err != nil {
+			log.Printf("Ignoring locale %s: %v", file.Name(), err)
+			continue
+		}
+		var translations map[string]string
+		if err := json.Unmarshal(data, &translations); err != nil {
+			log.Printf("Ignoring locale %s: %v", file.Name(), err)
+			continue
+		}
+		catalogs[tag] = newCatalog(translations)
+		supported = append(supported, tag)
+	}
+	matcher = language.NewMatcher(supported)
+}
+
+// newCatalog compiles the translations of a language
+func newCatalog(translations map[string]string) *catalog {
+	c := &catalog{messages: map[string]string{}}
+	for message, translation := range translations {
+		if !strings.Contains(message, "%s") {
+			c.messages[message] = translation
+			continue
+		}
+		expr := strings.ReplaceAll(regexp.QuoteMeta(message), "%s", "(.+?)")
+		c.patterns = append(c.patterns, pattern{re: regexp.MustCompile("^" + expr + "$"), translation: translation})
+	}
+	return c
+}
+
+// Language returns the supported language best matching an Accept-Language header, English if
+// none matches
+func Language(acceptLanguage string) language.Tag {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return language.English
+	}
+	_, index, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return language.English
+	}
+	return supported[index]
+}
+
+// Translate returns the message in the language, the message itself if it has no translation
+func Translate(tag language.Tag, message string) string {
+	c, ok := catalogs[tag]
+	if !ok {
+		return message
+	}
+	if translation, ok := c.messages[message]; ok {
+		return translation
+	}
+	for _, p := range c.patterns {
+		if match := p.re.FindStringSubmatch(message); match != nil {
+			args := make([]interface{}, len(match)-1)
+			for i, value := range match[1:] {
+				args[i] = value
+			}
+			return fmt.Sprintf(p.translation, args...)
+		}
+	}
+	return message
+}
+
+// localizedFields are the fields of JSON responses holding messages for users
+var localizedFields = []string{"error", "message"}
+
+// JSONSerializer is the JSON serializer of the API. It translates the messages of error
+// responses, e.g. {"error": "Workflow not found"}, into the language requested by the client.
+type JSONSerializer struct {
+	echo.DefaultJSONSerializer
+}
+
+// Serialize implements echo.JSONSerializer
+func (s JSONSerializer) Serialize(c echo.Context, i interface{}, indent string) error {
+	header := c.Response().Header()
+	header.Add("Vary", "Accept-Language")
+
+	tag := Language(c.Request().Header.Get("Accept-Language"))
+	header.Set("Content-Language", tag.String())
+	if _, ok := catalogs[tag]; ok {
+		i = localize(tag, i)
+	}
+	return s.DefaultJSONSerializer.Serialize(c, i, indent)
+}
+
+// localize returns a copy of a response with its messages translated, other responses as they are
+func localize(tag language.Tag, i interface{}) interface{} {
+	switch response := i.(type) {
+	case map[string]string:
+		localized := make(map[string]string, len(response))
+		for key, value := range response {
+			localized[key] = value
+		}
+		for _, field := range localizedFields {
+			if message, ok := localized[field]; ok {
+				localized[field] = Translate(tag, message)
+			}
+		}
+		return localized
+	case echo.Map:
+		return echo.Map(localizeMap(tag, response))
+	case map[string]interface{}:
+		return localizeMap(tag, response)
+	}
+	return i
+}
+
+// localizeMap returns a copy of a map response with its messages translated
+func localizeMap(tag language.Tag, response map[string]interface{}) map[string]interface{} {
+	localized := make(map[string]interface{}, len(response))
+	for key, value := range response {
+		localized[key] = value
+	}
+	for _, field := range localizedFields {
+		if message, ok := localized[field].(string); ok {
+			localized[field] = Translate(tag, message)
+		}
+	}
+	return localized
+}
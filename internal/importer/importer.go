@@ -0,0 +1,188 @@
+// Package importer converts workflows exported from other automation tools (n8n, Zapier) and
+// BPM tools (BPMN 2.0) into FlowCraft workflows. Steps without FlowCraft equivalent become
+// sticky notes and are flagged with warnings, so the imported workflow can be completed by hand.
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/bpmn"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"gorm.io/gorm"
+)
+
+// Supported export formats
+const (
+	FormatN8n    = "n8n"
+	FormatZapier = "zapier"
+	FormatBPMN   = "bpmn"
+)
+
+// Convert converts an exported workflow into a workflow with nodes and connections, which are
+// not stored yet. Nodes have temporary IDs (1, 2, ...) referenced by the connections.
+func Convert(format string, data []byte) (*models.ImportResult, error) {
+	switch format {
+	case FormatN8n:
+		return convertN8n(data)
+	case FormatZapier:
+		return convertZapier(data)
+	case FormatBPMN:
+		return bpmn.Import(data)
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected %s, %s or %s", format, FormatN8n, FormatZapier, FormatBPMN)
+	}
+}
+
+// Create stores a converted workflow with its nodes and connections
+func Create(workflow models.Workflow) (*models.Workflow, error) {
+	created := models.Workflow{
+		Name:         workflow.Name,
+		Description:  workflow.Description,
+		CreatedBy:    workflow.CreatedBy,
+		IsActive:     true,
+		WorkflowData: "{}",
+		CaptureMode:  models.CaptureFull,
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&created).Error; err != nil {
+			return err
+		}
+
+		nodeIDs := make(map[uint]uint, len(workflow.Nodes))
+		for _, node := range workflow.Nodes {
+			temporaryID := node.ID
+			node.ID = 0
+			node.WorkflowID = created.ID
+			if err := tx.Create(&node).Error; err != nil {
+				return err
+			}
+			nodeIDs[temporaryID] = node.ID
+			created.Nodes = append(created.Nodes, node)
+		}
+
+		for _, connection := range workflow.Connections {
+			connection.ID = 0
+			connection.WorkflowID = created.ID
+			connection.SourceNodeID = nodeIDs[connection.SourceNodeID]
+			connection.TargetNodeID = nodeIDs[connection.TargetNodeID]
+			if err := tx.Create(&connection).Error; err != nil {
+				return err
+			}
+			created.Connections = append(created.Connections, connection)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &created, nil
+}
+
+// graph collects the converted nodes and connections of a workflow
+type graph struct {
+	result *models.ImportResult
+}
+
+func newGraph(name string) *graph {
+	return &graph{result: &models.ImportResult{
+		Workflow: models.Workflow{Name: name, Nodes: []models.Node{}, Connections: []models.Connection{}},
+		Warnings: []models.ImportWarning{},
+	}}
+}
+
+// addNode adds a node with the configuration and returns its temporary ID
+func (g *graph) addNode(node models.Node, config map[string]interface{}) uint {
+	configJSON, _ := json.Marshal(config)
+	node.ID = uint(len(g.result.Workflow.Nodes) + 1)
+	node.Config = string(configJSON)
+	g.result.Workflow.Nodes = append(g.result.Workflow.Nodes, node)
+	return node.ID
+}
+
+// addNote adds a sticky note in place of a step that could not be converted
+func (g *graph) addNote(name, stepType string, x, y float64, details string) uint {
+	content := fmt.Sprintf("**%s** (`%s`) could not be imported.", name, stepType)
+	if details != "" {
+		content += "\n\n" + details
+	}
+	return g.addNode(models.Node{
+		NodeType:  models.NodeTypeAnnotation,
+		Name:      name,
+		PositionX: x,
+		PositionY: y,
+	}, map[string]interface{}{"content": content, "color": "pink"})
+}
+
+func (g *graph) connect(source, target uint) {
+	g.result.Workflow.Connections = append(g.result.Workflow.Connections, models.Connection{
+		SourceNodeID: source,
+		TargetNodeID: target,
+		SourceHandle: "output",
+		TargetHandle: "input",
+	})
+}
+
+func (g *graph) warn(step, stepType, format string, args ...interface{}) {
+	g.result.Warnings = append(g.result.Warnings, models.ImportWarning{
+		Step:    step,
+		Type:    stepType,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// path converts the segments of a field reference (".a", "[0]", "[\"b\"]") into a dotted path
+var pathSegmentPattern = regexp.MustCompile(`\.([A-Za-z_$][\w$]*)|\[(\d+)\]|\["([^"]*)"\]|\['([^']*)'\]`)
+
+func path(segments string) (string, bool) {
+	var parts []string
+	rest := segments
+	for rest != "" {
+		match := pathSegmentPattern.FindStringSubmatchIndex(rest)
+		if match == nil || match[0] != 0 {
+			return "", false
+		}
+		for group := 1; group <= 4; group++ {
+			if match[2*group] >= 0 {
+				parts = append(parts, rest[match[2*group]:match[2*group+1]])
+				break
+			}
+		}
+		rest = rest[match[1]:]
+	}
+	return strings.Join(parts, "."), true
+}
+
+// nest turns dotted field names into nested maps, e.g. "user.name" into {"user": {"name": ...}}
+func nest(mapping map[string]interface{}, name string, value interface{}) {
+	parts := strings.Split(name, ".")
+	current := mapping
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := current[part].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			current[part] = next
+		}
+		current = next
+	}
+	current[parts[len(parts)-1]] = value
+}
+
+// stringValue returns the string form of a parameter value
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,580 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// n8nPlaceholderPattern matches the expressions embedded in n8n parameters ("={{ $json.id }}")
+var n8nPlaceholderPattern = regexp.MustCompile(`\{\{\s*(.*?)\s*\}\}`)
+
+// n8nItemPattern matches references to fields of the current item
+var n8nItemPattern = regexp.MustCompile(`^\$(?:json|input\.item\.json)((?:\.[A-Za-z_$][\w$]*|\[\d+\]|\["[^"]*"\]|\['[^']*'\])*)$`)
+
+// n8nTriggerTypes are n8n nodes starting workflows, which are triggers in FlowCraft
+var n8nTriggerTypes = map[string]string{
+	"n8n-nodes-base.start":           "",
+	"n8n-nodes-base.manualTrigger":   "",
+	"n8n-nodes-base.webhook":         "Create a webhook trigger for the workflow.",
+	"n8n-nodes-base.cron":            "Create a schedule trigger for the workflow.",
+	"n8n-nodes-base.scheduleTrigger": "Create a schedule trigger for the workflow.",
+	"n8n-nodes-base.interval":        "Create a schedule trigger for the workflow.",
+}
+
+// n8nTrigger reports whether the node type starts workflows and how to replace it
+func n8nTrigger(nodeType string) (string, bool) {
+	if hint, ok := n8nTriggerTypes[nodeType]; ok {
+		return hint, true
+	}
+	if strings.HasSuffix(nodeType, "Trigger") {
+		return "Create a webhook or schedule trigger for the workflow.", true
+	}
+	return "", false
+}
+
+// n8nStickyColors maps the colors of n8n sticky notes to the colors of annotations
+var n8nStickyColors = map[float64]string{1: "yellow", 2: "yellow", 3: "pink", 4: "green", 5: "blue", 6: "purple", 7: "gray"}
+
+type n8nWorkflow struct {
+	Name        string                                     `json:"name"`
+	Nodes       []n8nNode                                  `json:"nodes"`
+	Connections map[string]map[string][][]n8nConnectTarget `json:"connections"`
+}
+
+type n8nNode struct {
+	Name        string                 `json:"name"`
+	Type        string                 `json:"type"`
+	TypeVersion float64                `json:"typeVersion"`
+	Position    []float64              `json:"position"`
+	Parameters  map[string]interface{} `json:"parameters"`
+	Disabled    bool                   `json:"disabled"`
+	Credentials map[string]interface{} `json:"credentials"`
+}
+
+type n8nConnectTarget struct {
+	Node  string `json:"node"`
+	Type  string `json:"type"`
+	Index int    `json:"index"`
+}
+
+// n8nConverter converts the nodes of an n8n workflow
+type n8nConverter struct {
+	*graph
+	// hasInput tells which nodes receive the outputs of converted predecessors
+	hasInput map[string]bool
+}
+
+func convertN8n(data []byte) (*models.ImportResult, error) {
+	var workflow n8nWorkflow
+	if err := json.Unmarshal(data, &workflow); err != nil {
+		return nil, fmt.Errorf("invalid n8n workflow: %v", err)
+	}
+	if len(workflow.Nodes) == 0 {
+		return nil, fmt.Errorf("invalid n8n workflow: no nodes")
+	}
+	name := workflow.Name
+	if name == "" {
+		name = "Imported n8n workflow"
+	}
+
+	c := &n8nConverter{graph: newGraph(name), hasInput: map[string]bool{}}
+	byName := map[string]n8nNode{}
+	for _, node := range workflow.Nodes {
+		byName[node.Name] = node
+	}
+	for source, outputs := range workflow.Connections {
+		if _, trigger := n8nTrigger(byName[source].Type); trigger {
+			continue
+		}
+		for _, targets := range outputs["main"] {
+			for _, target := range targets {
+				c.hasInput[target.Node] = true
+			}
+		}
+	}
+
+	// Convert the nodes, then the connections between converted nodes
+	ids := map[string]uint{}
+	notes := map[string]bool{}
+	for _, node := range workflow.Nodes {
+		if hint, trigger := n8nTrigger(node.Type); trigger {
+			if hint != "" {
+				c.warn(node.Name, node.Type, "Trigger nodes are not imported. %s", hint)
+			}
+			continue
+		}
+		id, converted := c.convert(node)
+		ids[node.Name] = id
+		if !converted {
+			notes[node.Name] = true
+		}
+	}
+
+	sources := make([]string, 0, len(workflow.Connections))
+	for source := range workflow.Connections {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	for _, source := range sources {
+		sourceID, ok := ids[source]
+		if !ok {
+			continue
+		}
+		for output, targets := range workflow.Connections[source]["main"] {
+			for _, target := range targets {
+				targetID, ok := ids[target.Node]
+				if !ok {
+					continue
+				}
+				switch {
+				case notes[source] || notes[target.Node]:
+					c.warn(source, byName[source].Type, "The connection to %s was not imported since one of the steps could not be converted", target.Node)
+				case output > 0:
+					c.warn(source, byName[source].Type, "Output %d (e.g. the false branch) to %s was not imported, only the first output is supported", output, target.Node)
+				default:
+					c.connect(sourceID, targetID)
+				}
+			}
+		}
+	}
+
+	return c.result, nil
+}
+
+// convert converts a node, adding a sticky note instead if it has no FlowCraft equivalent
+func (c *n8nConverter) convert(node n8nNode) (uint, bool) {
+	base := models.Node{Name: node.Name}
+	if len(node.Position) == 2 {
+		base.PositionX, base.PositionY = node.Position[0], node.Position[1]
+	}
+	if node.Disabled {
+		base.Disabled = true
+		base.DisabledMode = models.DisabledPassthrough
+	}
+	if len(node.Credentials) > 0 {
+		c.warn(node.Name, node.Type, "Credentials are not imported, create a FlowCraft credential and set credential_id")
+	}
+	params := node.Parameters
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+
+	var nodeType string
+	var config map[string]interface{}
+	var problem string
+	switch node.Type {
+	case "n8n-nodes-base.stickyNote":
+		content, _ := params["content"].(string)
+		noteConfig := map[string]interface{}{"content": content, "color": "yellow"}
+		if color, ok := n8nStickyColors[number(params["color"])]; ok {
+			noteConfig["color"] = color
+		}
+		for _, key := range []string{"width", "height"} {
+			if value, ok := params[key].(float64); ok {
+				noteConfig[key] = value
+			}
+		}
+		base.NodeType = models.NodeTypeAnnotation
+		base.Disabled = false
+		return c.addNode(base, noteConfig), true
+	case "n8n-nodes-base.httpRequest":
+		nodeType, config, problem = "httpRequest", c.httpRequest(node), ""
+	case "n8n-nodes-base.set":
+		nodeType = "transform"
+		config, problem = c.set(node)
+	case "n8n-nodes-base.if", "n8n-nodes-base.filter":
+		nodeType = "filter"
+		config, problem = c.condition(node)
+	case "n8n-nodes-base.noOp":
+		// Nodes doing nothing forward their input like disabled nodes
+		nodeType, config = "transform", map[string]interface{}{"mapping": map[string]interface{}{}}
+		base.Disabled = true
+		base.DisabledMode = models.DisabledPassthrough
+	case "n8n-nodes-base.github":
+		nodeType = "github"
+		config, problem = c.github(node)
+	case "n8n-nodes-base.jira":
+		nodeType = "jira"
+		config, problem = c.jira(node)
+	case "n8n-nodes-base.code", "n8n-nodes-base.function", "n8n-nodes-base.functionItem":
+		code, _ := params["jsCode"].(string)
+		if code == "" {
+			code, _ = params["functionCode"].(string)
+		}
+		problem = "Code nodes cannot be converted, rebuild the logic with transform or filter nodes or a custom executor."
+		if code != "" {
+			problem += "\n\n```js\n" + code + "\n```"
+		}
+	default:
+		problem = "There is no FlowCraft equivalent for this node type."
+	}
+
+	if config == nil {
+		c.warn(node.Name, node.Type, "%s", firstLine(problem))
+		return c.addNote(node.Name, node.Type, base.PositionX, base.PositionY, problem), false
+	}
+	if problem != "" {
+		c.warn(node.Name, node.Type, "%s", problem)
+	}
+	base.NodeType = nodeType
+	return c.addNode(base, config), true
+}
+
+// httpRequest converts an HTTP Request node (version 1 and 3+ parameters)
+func (c *n8nConverter) httpRequest(node n8nNode) map[string]interface{} {
+	params := node.Parameters
+	method, _ := params["method"].(string)
+	if method == "" {
+		method, _ = params["requestMethod"].(string)
+	}
+	if method == "" {
+		method = "GET"
+	}
+
+	requestURL := stringValue(c.value(node, params["url"], false))
+	query := pairs(params["queryParameters"], "parameters")
+	if len(query) == 0 {
+		query = pairs(params["queryParametersUi"], "parameter")
+	}
+	if len(query) > 0 {
+		values := make([]string, 0, len(query))
+		for _, pair := range query {
+			values = append(values, url.QueryEscape(pair.name)+"="+stringValue(c.value(node, pair.value, false)))
+		}
+		separator := "?"
+		if strings.Contains(requestURL, "?") {
+			separator = "&"
+		}
+		requestURL += separator + strings.Join(values, "&")
+	}
+
+	config := map[string]interface{}{"url": requestURL, "method": strings.ToUpper(method)}
+
+	headers := map[string]interface{}{}
+	for _, pair := range append(pairs(params["headerParameters"], "parameters"), pairs(params["headerParametersUi"], "parameter")...) {
+		headers[pair.name] = c.value(node, pair.value, false)
+	}
+	if len(headers) > 0 {
+		config["headers"] = headers
+	}
+
+	// JSON bodies are given as JSON strings, key-value bodies as pairs
+	for _, key := range []string{"jsonBody", "bodyParametersJson"} {
+		if body, ok := params[key].(string); ok && body != "" {
+			// Expressions are converted before parsing since they may contain quotes
+			body = stringValue(c.value(node, body, false))
+			var data interface{}
+			if err := json.Unmarshal([]byte(body), &data); err == nil {
+				config["json_data"] = data
+			} else {
+				c.warn(node.Name, node.Type, "The JSON body could not be converted, set json_data by hand")
+			}
+		}
+	}
+	if bodyPairs := append(pairs(params["bodyParameters"], "parameters"), pairs(params["bodyParametersUi"], "parameter")...); len(bodyPairs) > 0 {
+		body := map[string]interface{}{}
+		for _, pair := range bodyPairs {
+			body[pair.name] = c.value(node, pair.value, false)
+		}
+		config["json_data"] = body
+	}
+
+	if body, err := json.Marshal(config["json_data"]); err == nil && strings.Contains(string(body), "{{") {
+		c.warn(node.Name, node.Type, "Placeholders in the JSON body are not substituted by HTTP request nodes, build the body with a template node")
+	}
+	if authentication, _ := params["authentication"].(string); authentication != "" && authentication != "none" {
+		c.warn(node.Name, node.Type, "Authentication (%s) is not imported, add the credentials to the headers", authentication)
+	}
+	return config
+}
+
+// set converts a Set node into a transform mapping
+func (c *n8nConverter) set(node n8nNode) (map[string]interface{}, string) {
+	params := node.Parameters
+	mapping := map[string]interface{}{}
+
+	// Version 1 and 2: values by type
+	if values, ok := params["values"].(map[string]interface{}); ok {
+		for _, kind := range []string{"string", "number", "boolean"} {
+			for _, pair := range pairs(values, kind) {
+				nest(mapping, pair.name, c.value(node, pair.value, true))
+			}
+		}
+	}
+	// Version 3.3+: assignments
+	if assignments, ok := params["assignments"].(map[string]interface{}); ok {
+		items, _ := assignments["assignments"].([]interface{})
+		for _, item := range items {
+			assignment, _ := item.(map[string]interface{})
+			if name, _ := assignment["name"].(string); name != "" {
+				nest(mapping, name, c.value(node, assignment["value"], true))
+			}
+		}
+	}
+	// Version 3.0 to 3.2: fields with typed values
+	if fields, ok := params["fields"].(map[string]interface{}); ok {
+		items, _ := fields["values"].([]interface{})
+		for _, item := range items {
+			field, _ := item.(map[string]interface{})
+			name, _ := field["name"].(string)
+			if name == "" {
+				continue
+			}
+			for key, value := range field {
+				if strings.HasSuffix(key, "Value") {
+					nest(mapping, name, c.value(node, value, true))
+				}
+			}
+		}
+	}
+
+	problem := ""
+	if keep, _ := params["keepOnlySet"].(bool); !keep && params["includeOtherFields"] != true {
+		problem = "Transform nodes only output the mapped fields, add the other fields of the item to the mapping if they are needed"
+	}
+	return map[string]interface{}{"mapping": mapping}, problem
+}
+
+// n8nOperators maps the comparison operations of IF and Filter nodes to filter operators
+var n8nOperators = map[string]string{
+	"equal":     "equals",
+	"equals":    "equals",
+	"notEqual":  "not_equals",
+	"notEquals": "not_equals",
+	"contains":  "contains",
+	"larger":    "greater_than",
+	"gt":        "greater_than",
+	"smaller":   "less_than",
+	"lt":        "less_than",
+}
+
+// condition converts the first condition of an IF or Filter node into a filter
+func (c *n8nConverter) condition(node n8nNode) (map[string]interface{}, string) {
+	type condition struct {
+		left, right interface{}
+		operation   string
+	}
+	var conditions []condition
+
+	params := node.Parameters
+	if groups, ok := params["conditions"].(map[string]interface{}); ok {
+		// Version 2+: a list of conditions with operators
+		if list, ok := groups["conditions"].([]interface{}); ok {
+			for _, item := range list {
+				cond, _ := item.(map[string]interface{})
+				operator, _ := cond["operator"].(map[string]interface{})
+				operation, _ := operator["operation"].(string)
+				conditions = append(conditions, condition{cond["leftValue"], cond["rightValue"], operation})
+			}
+		}
+		// Version 1: conditions by type
+		for _, kind := range []string{"boolean", "number", "string", "dateTime"} {
+			list, _ := groups[kind].([]interface{})
+			for _, item := range list {
+				cond, _ := item.(map[string]interface{})
+				operation, _ := cond["operation"].(string)
+				if operation == "" {
+					operation = "equal"
+				}
+				conditions = append(conditions, condition{cond["value1"], cond["value2"], operation})
+			}
+		}
+	}
+
+	if len(conditions) == 0 {
+		return nil, "The node has no conditions that could be converted."
+	}
+	first := conditions[0]
+	operator, ok := n8nOperators[first.operation]
+	if !ok {
+		return nil, fmt.Sprintf("The comparison %q has no equivalent filter operator.", first.operation)
+	}
+
+	field, ok := itemField(first.left)
+	if !ok {
+		return nil, fmt.Sprintf("The condition compares %v, only fields of the item ($json) can be filtered on.", first.left)
+	}
+
+	problem := ""
+	if len(conditions) > 1 {
+		problem = "Only the first condition was imported, chain filter nodes for the others"
+	}
+	return map[string]interface{}{"field": field, "operator": operator, "value": c.value(node, first.right, true)}, problem
+}
+
+// github converts issue operations of a GitHub node
+func (c *n8nConverter) github(node n8nNode) (map[string]interface{}, string) {
+	params := node.Parameters
+	resource, _ := params["resource"].(string)
+	operation, _ := params["operation"].(string)
+	if resource != "" && resource != "issue" {
+		return nil, fmt.Sprintf("GitHub %s operations are not supported.", resource)
+	}
+
+	config := map[string]interface{}{
+		"owner": c.value(node, params["owner"], false),
+		"repo":  c.value(node, params["repository"], false),
+	}
+	fields := map[string]interface{}{}
+	for _, key := range []string{"editFields", "additionalFields"} {
+		if values, ok := params[key].(map[string]interface{}); ok {
+			for name, value := range values {
+				fields[name] = value
+			}
+		}
+	}
+
+	switch operation {
+	case "", "create":
+		config["operation"] = "create_issue"
+		config["title"] = c.value(node, params["title"], false)
+		config["body"] = c.value(node, params["body"], false)
+	case "edit":
+		config["operation"] = "update_issue"
+		config["number"] = c.value(node, params["issueNumber"], false)
+		for _, key := range []string{"title", "body", "state"} {
+			if value, ok := fields[key]; ok {
+				config[key] = c.value(node, value, false)
+			}
+		}
+	case "createComment":
+		config["operation"] = "create_comment"
+		config["number"] = c.value(node, params["issueNumber"], false)
+		config["body"] = c.value(node, params["body"], false)
+	default:
+		return nil, fmt.Sprintf("The GitHub issue operation %q is not supported.", operation)
+	}
+	return config, ""
+}
+
+// jira converts issue operations of a Jira node
+func (c *n8nConverter) jira(node n8nNode) (map[string]interface{}, string) {
+	params := node.Parameters
+	resource, _ := params["resource"].(string)
+	operation, _ := params["operation"].(string)
+	if resource != "" && resource != "issue" {
+		return nil, fmt.Sprintf("Jira %s operations are not supported.", resource)
+	}
+	additional, _ := params["additionalFields"].(map[string]interface{})
+	update, _ := params["updateFields"].(map[string]interface{})
+
+	switch operation {
+	case "", "create":
+		config := map[string]interface{}{
+			"operation":  "create",
+			"project":    c.value(node, params["project"], false),
+			"issue_type": c.value(node, params["issueType"], false),
+			"summary":    c.value(node, params["summary"], false),
+		}
+		if description, ok := additional["description"]; ok {
+			config["description"] = c.value(node, description, false)
+		}
+		return config, ""
+	case "update":
+		config := map[string]interface{}{
+			"operation": "update",
+			"issue_key": c.value(node, params["issueKey"], false),
+		}
+		for _, key := range []string{"summary", "description"} {
+			if value, ok := update[key]; ok {
+				config[key] = c.value(node, value, false)
+			}
+		}
+		return config, ""
+	default:
+		return nil, fmt.Sprintf("The Jira issue operation %q is not supported.", operation)
+	}
+}
+
+// value converts the n8n expressions in a parameter value into placeholders. Item fields are
+// relative to the item for transform and filter nodes, other nodes reference the output of their
+// (first) predecessor or, as start nodes, the execution input.
+func (c *n8nConverter) value(node n8nNode, value interface{}, itemRelative bool) interface{} {
+	prefix := ""
+	if !itemRelative && c.hasInput[node.Name] {
+		prefix = "input.0."
+	}
+
+	switch v := value.(type) {
+	case string:
+		if !strings.HasPrefix(v, "=") {
+			return v
+		}
+		return n8nPlaceholderPattern.ReplaceAllStringFunc(v[1:], func(match string) string {
+			expression := n8nPlaceholderPattern.FindStringSubmatch(match)[1]
+			if groups := n8nItemPattern.FindStringSubmatch(expression); groups != nil {
+				if field, ok := path(groups[1]); ok {
+					return "{{" + strings.TrimSuffix(prefix+field, ".") + "}}"
+				}
+			}
+			c.warn(node.Name, node.Type, "The expression {{ %s }} could not be converted", expression)
+			return match
+		})
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[key] = c.value(node, item, itemRelative)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = c.value(node, item, itemRelative)
+		}
+		return converted
+	default:
+		return value
+	}
+}
+
+// itemField returns the field of the item an expression like "={{ $json.status }}" references
+func itemField(value interface{}) (string, bool) {
+	s, _ := value.(string)
+	match := n8nPlaceholderPattern.FindStringSubmatch(strings.TrimPrefix(s, "="))
+	if !strings.HasPrefix(s, "=") || match == nil || match[0] != s[1:] {
+		return "", false
+	}
+	groups := n8nItemPattern.FindStringSubmatch(match[1])
+	if groups == nil {
+		return "", false
+	}
+	return path(groups[1])
+}
+
+// pairs returns the name/value pairs of a parameter like {"parameters": [{"name": ..., "value": ...}]}
+func pairs(parameter interface{}, key string) []pair {
+	collection, _ := parameter.(map[string]interface{})
+	items, _ := collection[key].([]interface{})
+	var result []pair
+	for _, item := range items {
+		fields, _ := item.(map[string]interface{})
+		if name, _ := fields["name"].(string); name != "" {
+			result = append(result, pair{name, fields["value"]})
+		}
+	}
+	return result
+}
+
+// pair is a named parameter value
+type pair struct {
+	name  string
+	value interface{}
+}
+
+// number returns a numeric parameter, or 0
+func number(value interface{}) float64 {
+	n, _ := value.(float64)
+	return n
+}
+
+// firstLine returns the first line of a text
+func firstLine(text string) string {
+	line, _, _ := strings.Cut(text, "\n")
+	return line
+}
@@ -0,0 +1,174 @@
+package importer
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// zapierReferencePattern matches references to fields of earlier steps, e.g. "{{123__user__email}}"
+var zapierReferencePattern = regexp.MustCompile(`\{\{\s*(\d+)__([^{}]+?)\s*\}\}`)
+
+// zapierStepSpacing is the distance of the converted steps on the canvas
+const zapierStepSpacing = 250
+
+type zapierExport struct {
+	Zaps []zapierZap `json:"zaps"`
+}
+
+type zapierZap struct {
+	ID    interface{}  `json:"id"`
+	Title string       `json:"title"`
+	Steps []zapierStep `json:"steps"`
+}
+
+type zapierStep struct {
+	ID     interface{}            `json:"id"`
+	TypeOf string                 `json:"type_of"` // read (trigger), write (action), filter
+	App    string                 `json:"app"`
+	Action string                 `json:"action"`
+	Title  string                 `json:"title"`
+	Params map[string]interface{} `json:"params"`
+}
+
+// convertZapier converts the first zap of a Zapier export. Zapier exports are not documented,
+// so only the steps of linear zaps calling webhooks are converted; the others become notes.
+func convertZapier(data []byte) (*models.ImportResult, error) {
+	var export zapierExport
+	if err := json.Unmarshal(data, &export); err != nil {
+		return nil, fmt.Errorf("invalid Zapier export: %v", err)
+	}
+	if len(export.Zaps) == 0 {
+		// Exports of a single zap
+		var zap zapierZap
+		if err := json.Unmarshal(data, &zap); err == nil && len(zap.Steps) > 0 {
+			export.Zaps = []zapierZap{zap}
+		}
+	}
+	if len(export.Zaps) == 0 || len(export.Zaps[0].Steps) == 0 {
+		return nil, fmt.Errorf("invalid Zapier export: no zap with steps")
+	}
+
+	zap := export.Zaps[0]
+	name := zap.Title
+	if name == "" {
+		name = "Imported zap"
+	}
+	g := newGraph(name)
+	if len(export.Zaps) > 1 {
+		g.warn(name, "zap", "The export contains %d zaps, only the first was imported", len(export.Zaps))
+	}
+
+	// The previous converted step and the Zapier step whose output it is
+	var previous uint
+	var previousStep, triggerStep string
+	for i, step := range zap.Steps {
+		stepID := fmt.Sprint(step.ID)
+		stepName := step.Title
+		if stepName == "" {
+			stepName = fmt.Sprintf("%s %s", step.App, step.Action)
+		}
+		stepType := step.App + "." + step.Action
+		x := float64(i) * zapierStepSpacing
+
+		if i == 0 && step.TypeOf == "read" {
+			triggerStep = stepID
+			g.warn(stepName, stepType, "Triggers are not imported, create a webhook or schedule trigger for the workflow")
+			continue
+		}
+
+		config, ok := zapierWebhook(step)
+		if !ok {
+			g.warn(stepName, stepType, "There is no FlowCraft equivalent for this step")
+			g.addNote(stepName, stepType, x, 0, "There is no FlowCraft equivalent for this step, following steps are not connected to it.")
+			previous, previousStep = 0, ""
+			continue
+		}
+
+		// References to the previous step become fields of the input, references to the trigger
+		// fields of the execution input of the first step
+		start := previous == 0
+		config = zapierReferences(config, func(reference, field string) (string, bool) {
+			switch {
+			case !start && reference == previousStep:
+				return "input.0." + field, true
+			case start && reference == triggerStep:
+				return field, true
+			}
+			g.warn(stepName, stepType, "The reference to step %s could not be converted, only fields of the previous step can be referenced", reference)
+			return "", false
+		}).(map[string]interface{})
+
+		id := g.addNode(models.Node{NodeType: "httpRequest", Name: stepName, PositionX: x}, config)
+		if previous != 0 {
+			g.connect(previous, id)
+		}
+		previous, previousStep = id, stepID
+	}
+	return g.result, nil
+}
+
+// zapierWebhook converts steps of the Webhooks by Zapier app into HTTP request configurations
+func zapierWebhook(step zapierStep) (map[string]interface{}, bool) {
+	if !strings.Contains(strings.ToLower(step.App), "webhook") {
+		return nil, false
+	}
+	method := strings.ToUpper(step.Action)
+	switch method {
+	case "GET", "POST", "PUT", "DELETE", "PATCH":
+	case "CUSTOM_REQUEST":
+		method, _ = step.Params["method"].(string)
+		method = strings.ToUpper(method)
+	default:
+		return nil, false
+	}
+	if method == "" {
+		method = "GET"
+	}
+
+	config := map[string]interface{}{"url": stringValue(step.Params["url"]), "method": method}
+	if headers, ok := step.Params["headers"].(map[string]interface{}); ok && len(headers) > 0 {
+		config["headers"] = headers
+	}
+	switch data := step.Params["data"].(type) {
+	case map[string]interface{}:
+		config["json_data"] = data
+	case string:
+		var body interface{}
+		if err := json.Unmarshal([]byte(data), &body); err == nil {
+			config["json_data"] = body
+		}
+	}
+	return config, true
+}
+
+// zapierReferences replaces the references to fields of steps in all strings of a value
+func zapierReferences(value interface{}, resolve func(reference, field string) (string, bool)) interface{} {
+	switch v := value.(type) {
+	case string:
+		return zapierReferencePattern.ReplaceAllStringFunc(v, func(match string) string {
+			groups := zapierReferencePattern.FindStringSubmatch(match)
+			if field, ok := resolve(groups[1], strings.ReplaceAll(groups[2], "__", ".")); ok {
+				return "{{" + field + "}}"
+			}
+			return match
+		})
+	case map[string]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[key] = zapierReferences(item, resolve)
+		}
+		return converted
+	case []interface{}:
+		converted := make([]interface{}, len(v))
+		for i, item := range v {
+			converted[i] = zapierReferences(item, resolve)
+		}
+		return converted
+	default:
+		return value
+	}
+}
@@ -0,0 +1,342 @@
+// Package inference infers JSON schemas of node outputs from recent executions, which the editor
+// uses to autocomplete expressions referencing the outputs of upstream nodes
+package inference
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// maxPaths bounds the paths listed for autocompletion, outputs may be large
+const maxPaths = 500
+
+// Config holds the settings of schema inference
+type Config struct {
+	// Interval between inference runs, 0 disables inference
+	Interval time.Duration
+	// Samples is the number of recent outputs per node (and node type) a schema is inferred from
+	Samples int
+}
+
+// ConfigFromEnv reads the schema inference settings from the environment
+func ConfigFromEnv() Config {
+	cfg := Config{Interval: time.Hour, Samples: 50}
+
+	if interval, err := time.ParseDuration(os.Getenv("SCHEMA_INFERENCE_INTERVAL")); err == nil && interval >= 0 {
+		cfg.Interval = interval
+	}
+	if samples, err := strconv.Atoi(os.Getenv("SCHEMA_INFERENCE_SAMPLES")); err == nil && samples > 0 {
+		cfg.Samples = samples
+	}
+
+	return cfg
+}
+
+// Run periodically infers the output schemas of the nodes executed since the previous run
+func Run(ctx context.Context, cfg Config) {
+	if cfg.Interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(cfg.Interval)
+	defer ticker.Stop()
+
+	var since time.Time
+	for {
+		started := time.Now()
+		if err := InferSince(since, cfg.Samples); err != nil {
+			log.Printf("Failed to infer output schemas: %v", err)
+		} else {
+			since = started
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// InferSince infers the output schemas of the nodes, and their node types, that completed
+// executions since the given time
+func InferSince(since time.Time, samples int) error {
+	var nodes []models.Node
+	err := database.DB.Where("id IN (?)", database.DB.Model(&models.NodeExecution{}).
+		Select("node_id").Where("status = ? AND completed_at >= ?", "completed", since)).
+		Find(&nodes).Error
+	if err != nil {
+		return err
+	}
+
+	nodeTypes := map[string]bool{}
+	for _, node := range nodes {
+		outputs, err := recentOutputs(database.DB.Where("node_executions.node_id = ?", node.ID), samples)
+		if err != nil {
+			return err
+		}
+		if err := save(node.NodeType, node.ID, outputs); err != nil {
+			return err
+		}
+		nodeTypes[node.NodeType] = true
+	}
+
+	for nodeType := range nodeTypes {
+		outputs, err := recentOutputs(database.DB.
+			Joins("JOIN nodes ON nodes.id = node_executions.node_id").
+			Where("nodes.node_type = ?", nodeType), samples)
+		if err != nil {
+			return err
+		}
+		if err := save(nodeType, 0, outputs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recentOutputs returns the outputs of the most recent completed node executions matching the
+// query. Executions whose payloads were dropped by the capture mode of their workflow are left
+// out, their outputs are empty placeholders.
+func recentOutputs(query *gorm.DB, limit int) ([]interface{}, error) {
+	var rows []string
+	err := query.Model(&models.NodeExecution{}).
+		Joins("JOIN workflow_executions ON workflow_executions.id = node_executions.workflow_execution_id").
+		Where("node_executions.status = ? AND workflow_executions.data_captured", "completed").
+		Order("node_executions.id DESC").Limit(limit).
+		Pluck("node_executions.output_data", &rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := make([]interface{}, 0, len(rows))
+	for _, row := range rows {
+		var output interface{}
+		if err := json.Unmarshal([]byte(row), &output); err == nil {
+			outputs = append(outputs, output)
+		}
+	}
+	return outputs, nil
+}
+
+// save stores the schema inferred from the outputs of a node or node type
+func save(nodeType string, nodeID uint, outputs []interface{}) error {
+	if len(outputs) == 0 {
+		return nil
+	}
+	schemaJSON, err := json.Marshal(Infer(outputs))
+	if err != nil {
+		return err
+	}
+
+	observed := models.ObservedOutputSchema{
+		NodeType:    nodeType,
+		NodeID:      nodeID,
+		Schema:      string(schemaJSON),
+		SampleCount: len(outputs),
+	}
+	return database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "node_type"}, {Name: "node_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"schema", "sample_count", "updated_at"}),
+	}).Create(&observed).Error
+}
+
+// shape accumulates the observed values at a position of the outputs
+type shape struct {
+	types      map[string]bool
+	objects    int // number of objects observed, to tell which properties are required
+	properties map[string]*shape
+	counts     map[string]int // number of objects each property was observed in
+	items      *shape
+}
+
+func newShape() *shape {
+	return &shape{types: map[string]bool{}, properties: map[string]*shape{}, counts: map[string]int{}}
+}
+
+func (s *shape) observe(value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		s.types["null"] = true
+	case bool:
+		s.types["boolean"] = true
+	case float64:
+		if v == math.Trunc(v) {
+			s.types["integer"] = true
+		} else {
+			s.types["number"] = true
+		}
+	case string:
+		s.types["string"] = true
+	case []interface{}:
+		s.types["array"] = true
+		if s.items == nil {
+			s.items = newShape()
+		}
+		for _, item := range v {
+			s.items.observe(item)
+		}
+	case map[string]interface{}:
+		s.types["object"] = true
+		s.objects++
+		for key, item := range v {
+			property, ok := s.properties[key]
+			if !ok {
+				property = newShape()
+				s.properties[key] = property
+			}
+			property.observe(item)
+			s.counts[key]++
+		}
+	}
+}
+
+// schema returns the JSON schema of the observed values. Properties present in every observed
+// object are required; integers observed alongside other numbers are numbers.
+func (s *shape) schema() map[string]interface{} {
+	if s.types["integer"] && s.types["number"] {
+		delete(s.types, "integer")
+	}
+	types := make([]string, 0, len(s.types))
+	for t := range s.types {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+
+	schema := map[string]interface{}{}
+	switch len(types) {
+	case 0:
+	case 1:
+		schema["type"] = types[0]
+	default:
+		schema["type"] = types
+	}
+
+	if s.types["object"] {
+		properties := map[string]interface{}{}
+		required := []string{}
+		for key, property := range s.properties {
+			properties[key] = property.schema()
+			if s.counts[key] == s.objects {
+				required = append(required, key)
+			}
+		}
+		sort.Strings(required)
+		schema["properties"] = properties
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+	}
+	if s.items != nil && len(s.items.types) > 0 {
+		schema["items"] = s.items.schema()
+	}
+	return schema
+}
+
+// Infer returns a JSON schema describing all of the given values
+func Infer(values []interface{}) map[string]interface{} {
+	s := newShape()
+	for _, value := range values {
+		s.observe(value)
+	}
+	return s.schema()
+}
+
+// Paths lists the paths of the fields described by a schema, as referenced in expressions:
+// dotted, with index 0 standing for the items of lists (e.g. "items.0.title")
+func Paths(schema map[string]interface{}) []string {
+	paths := []string{}
+	var walk func(schema map[string]interface{}, prefix string)
+	walk = func(schema map[string]interface{}, prefix string) {
+		if len(paths) >= maxPaths {
+			return
+		}
+		if properties, ok := schema["properties"].(map[string]interface{}); ok {
+			keys := make([]string, 0, len(properties))
+			for key := range properties {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				path := join(prefix, key)
+				if len(paths) < maxPaths {
+					paths = append(paths, path)
+				}
+				if property, ok := properties[key].(map[string]interface{}); ok {
+					walk(property, path)
+				}
+			}
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			walk(items, join(prefix, "0"))
+		}
+	}
+	walk(schema, "")
+	return paths
+}
+
+// WithPaths sets the paths of an observed schema
+func WithPaths(observed *models.ObservedOutputSchema) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(observed.Schema), &schema); err == nil {
+		observed.Paths = Paths(schema)
+	}
+}
+
+func join(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// ForNodes returns the observed output schemas of the nodes by node ID. Nodes that were not
+// executed yet get the schema observed for their node type, if any.
+func ForNodes(nodes []models.Node) (map[uint]models.ObservedOutputSchema, error) {
+	result := map[uint]models.ObservedOutputSchema{}
+	if len(nodes) == 0 {
+		return result, nil
+	}
+
+	ids := make([]uint, 0, len(nodes))
+	nodeTypes := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		ids = append(ids, node.ID)
+		nodeTypes = append(nodeTypes, node.NodeType)
+	}
+
+	var observed []models.ObservedOutputSchema
+	err := database.DB.Where("node_id IN ? OR (node_id = 0 AND node_type IN ?)", ids, nodeTypes).Find(&observed).Error
+	if err != nil {
+		return nil, err
+	}
+	byNode := map[uint]models.ObservedOutputSchema{}
+	byType := map[string]models.ObservedOutputSchema{}
+	for _, schema := range observed {
+		WithPaths(&schema)
+		if schema.NodeID == 0 {
+			byType[schema.NodeType] = schema
+		} else {
+			byNode[schema.NodeID] = schema
+		}
+	}
+
+	for _, node := range nodes {
+		if schema, ok := byNode[node.ID]; ok {
+			result[node.ID] = schema
+		} else if schema, ok := byType[node.NodeType]; ok {
+			result[node.ID] = schema
+		}
+	}
+	return result, nil
+}
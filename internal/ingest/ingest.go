@@ -0,0 +1,115 @@
+// Package ingest reads large uploaded datasets record by record
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// maxLineSize is the maximum size of a single NDJSON record
+const maxLineSize = 1024 * 1024
+
+// RecordReader reads one record at a time. Next returns io.EOF after the last record.
+type RecordReader interface {
+	Next() (map[string]interface{}, error)
+}
+
+// NewReader returns a reader for the given format: "ndjson" or "csv"
+func NewReader(format string, r io.Reader) (RecordReader, error) {
+	switch format {
+	case "ndjson":
+		return NewNDJSONReader(r), nil
+	case "csv":
+		return NewCSVReader(r)
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// FormatFromContentType maps a request content type to a format
+func FormatFromContentType(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "text/csv"):
+		return "csv"
+	case strings.HasPrefix(contentType, "application/x-ndjson"), strings.HasPrefix(contentType, "application/jsonl"):
+		return "ndjson"
+	default:
+		return ""
+	}
+}
+
+// NDJSONReader reads newline delimited JSON objects. Empty lines are ignored.
+type NDJSONReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// NewNDJSONReader creates a new NDJSONReader
+func NewNDJSONReader(r io.Reader) *NDJSONReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	return &NDJSONReader{scanner: scanner}
+}
+
+func (r *NDJSONReader) Next() (map[string]interface{}, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := bytes.TrimSpace(r.scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var record map[string]interface{}
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("line %d: %v", r.line, err)
+		}
+		return record, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("line %d: %v", r.line+1, err)
+	}
+	return nil, io.EOF
+}
+
+// CSVReader reads CSV rows as objects keyed by the columns of the header row
+type CSVReader struct {
+	reader *csv.Reader
+	header []string
+}
+
+// NewCSVReader creates a new CSVReader and reads the header row
+func NewCSVReader(r io.Reader) (*CSVReader, error) {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header row: %v", err)
+	}
+
+	return &CSVReader{
+		reader: reader,
+		header: append([]string(nil), header...),
+	}, nil
+}
+
+func (r *CSVReader) Next() (map[string]interface{}, error) {
+	row, err := r.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	record := make(map[string]interface{}, len(r.header))
+	for i, column := range r.header {
+		if i < len(row) {
+			record[column] = row[i]
+		}
+	}
+	return record, nil
+}
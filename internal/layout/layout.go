@@ -0,0 +1,238 @@
+// Package layout computes canvas positions for the nodes of a workflow with a layered DAG layout:
+// nodes are assigned to layers by their longest path from a start node, ordered within their
+// layer to reduce crossing connections and placed on a grid
+package layout
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// Directions of the layout
+const (
+	LeftToRight = "LR"
+	TopToBottom = "TB"
+)
+
+// orderingSweeps is the number of passes ordering the nodes of the layers, alternating downwards
+// and upwards
+const orderingSweeps = 8
+
+// Options controls the layout
+type Options struct {
+	Direction    string  `json:"direction"`     // LR (default) or TB
+	NodeSpacing  float64 `json:"node_spacing"`  // distance of nodes within a layer, default 120
+	LayerSpacing float64 `json:"layer_spacing"` // distance of the layers, default 250
+}
+
+// Position is the position of a node on the canvas
+type Position struct {
+	X float64 `json:"position_x"`
+	Y float64 `json:"position_y"`
+}
+
+// Validate checks the options, filling in the defaults
+func (o *Options) Validate() error {
+	switch o.Direction {
+	case "":
+		o.Direction = LeftToRight
+	case LeftToRight, TopToBottom:
+	default:
+		return fmt.Errorf("direction must be %s or %s", LeftToRight, TopToBottom)
+	}
+	if o.NodeSpacing < 0 || o.LayerSpacing < 0 {
+		return fmt.Errorf("spacings must not be negative")
+	}
+	if o.NodeSpacing == 0 {
+		o.NodeSpacing = 120
+	}
+	if o.LayerSpacing == 0 {
+		o.LayerSpacing = 250
+	}
+	return nil
+}
+
+// Compute returns the positions of the nodes by node ID. Connections closing a cycle are
+// ignored; nodes without connections, like compensation nodes, end up in the first layer.
+// Annotations keep their place, they document the area they were put in.
+func Compute(nodes []models.Node, connections []models.Connection, opts Options) map[uint]Position {
+	ids := make([]uint, 0, len(nodes))
+	known := map[uint]bool{}
+	for _, node := range nodes {
+		if node.IsAnnotation() {
+			continue
+		}
+		ids = append(ids, node.ID)
+		known[node.ID] = true
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	successors := map[uint][]uint{}
+	for _, conn := range connections {
+		if known[conn.SourceNodeID] && known[conn.TargetNodeID] && conn.SourceNodeID != conn.TargetNodeID {
+			successors[conn.SourceNodeID] = append(successors[conn.SourceNodeID], conn.TargetNodeID)
+		}
+	}
+	edges := acyclicEdges(ids, successors)
+
+	layerOf := assignLayers(ids, edges)
+	layers := orderLayers(ids, edges, layerOf)
+
+	positions := make(map[uint]Position, len(ids))
+	for l, layer := range layers {
+		// Layers are centered on each other
+		offset := -float64(len(layer)-1) / 2 * opts.NodeSpacing
+		for i, id := range layer {
+			along := float64(l) * opts.LayerSpacing
+			across := offset + float64(i)*opts.NodeSpacing
+			if opts.Direction == TopToBottom {
+				positions[id] = Position{X: across, Y: along}
+			} else {
+				positions[id] = Position{X: along, Y: across}
+			}
+		}
+	}
+
+	// Shift the layout to start at (0,0)
+	minX, minY := 0.0, 0.0
+	for _, p := range positions {
+		if p.X < minX {
+			minX = p.X
+		}
+		if p.Y < minY {
+			minY = p.Y
+		}
+	}
+	for id, p := range positions {
+		positions[id] = Position{X: p.X - minX, Y: p.Y - minY}
+	}
+	return positions
+}
+
+// acyclicEdges returns the connections without the ones leading back to a node on the current
+// path of a depth-first search
+func acyclicEdges(ids []uint, successors map[uint][]uint) map[uint][]uint {
+	const (
+		unvisited = iota
+		active
+		done
+	)
+	state := map[uint]int{}
+	edges := map[uint][]uint{}
+
+	var visit func(id uint)
+	visit = func(id uint) {
+		state[id] = active
+		for _, next := range successors[id] {
+			switch state[next] {
+			case active:
+				continue
+			case unvisited:
+				visit(next)
+			}
+			edges[id] = append(edges[id], next)
+		}
+		state[id] = done
+	}
+	for _, id := range ids {
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+	return edges
+}
+
+// assignLayers puts each node one layer after its furthest predecessor
+func assignLayers(ids []uint, edges map[uint][]uint) map[uint]int {
+	indegree := map[uint]int{}
+	for _, targets := range edges {
+		for _, target := range targets {
+			indegree[target]++
+		}
+	}
+
+	layerOf := map[uint]int{}
+	queue := []uint{}
+	for _, id := range ids {
+		if indegree[id] == 0 {
+			queue = append(queue, id)
+		}
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, next := range edges[id] {
+			if layerOf[id]+1 > layerOf[next] {
+				layerOf[next] = layerOf[id] + 1
+			}
+			indegree[next]--
+			if indegree[next] == 0 {
+				queue = append(queue, next)
+			}
+		}
+	}
+	return layerOf
+}
+
+// orderLayers orders the nodes of each layer by the average position of their neighbours in the
+// adjacent layer (barycenter heuristic)
+func orderLayers(ids []uint, edges map[uint][]uint, layerOf map[uint]int) [][]uint {
+	var layers [][]uint
+	for _, id := range ids {
+		l := layerOf[id]
+		for len(layers) <= l {
+			layers = append(layers, nil)
+		}
+		layers[l] = append(layers[l], id)
+	}
+
+	predecessors := map[uint][]uint{}
+	for _, source := range ids {
+		for _, target := range edges[source] {
+			predecessors[target] = append(predecessors[target], source)
+		}
+	}
+
+	index := map[uint]int{}
+	updateIndex := func(layer []uint) {
+		for i, id := range layer {
+			index[id] = i
+		}
+	}
+	for _, layer := range layers {
+		updateIndex(layer)
+	}
+
+	sortByNeighbours := func(layer []uint, neighbours map[uint][]uint) {
+		barycenter := map[uint]float64{}
+		for _, id := range layer {
+			if len(neighbours[id]) == 0 {
+				// Nodes without neighbours keep their place
+				barycenter[id] = float64(index[id])
+				continue
+			}
+			sum := 0.0
+			for _, n := range neighbours[id] {
+				sum += float64(index[n])
+			}
+			barycenter[id] = sum / float64(len(neighbours[id]))
+		}
+		sort.SliceStable(layer, func(i, j int) bool { return barycenter[layer[i]] < barycenter[layer[j]] })
+		updateIndex(layer)
+	}
+
+	for sweep := 0; sweep < orderingSweeps; sweep++ {
+		if sweep%2 == 0 {
+			for l := 1; l < len(layers); l++ {
+				sortByNeighbours(layers[l], predecessors)
+			}
+		} else {
+			for l := len(layers) - 2; l >= 0; l-- {
+				sortByNeighbours(layers[l], edges)
+			}
+		}
+	}
+	return layers
+}
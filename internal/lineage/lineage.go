@@ -0,0 +1,292 @@
+// Package lineage records which upstream node and field the output fields of node executions
+// were derived from, as far as the configuration of the nodes tells, and traces values back to
+// their origin for audits
+package lineage
+
+import (
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// placeholderPattern matches placeholders like "{{ data.user.name }}", as the expression package does
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// maxTraceSteps bounds a trace, in case of inconsistent records
+const maxTraceSteps = 1000
+
+var enabled = true
+
+// EnabledFromEnv reports whether lineage is recorded, which it is unless LINEAGE_ENABLED=false
+func EnabledFromEnv() bool {
+	return os.Getenv("LINEAGE_ENABLED") != "false"
+}
+
+// Configure enables or disables recording lineage
+func Configure(enable bool) {
+	enabled = enable
+}
+
+// Sources are the upstream nodes whose outputs a node received, by input handle in the order
+// they appear in the input. Start nodes have no sources, they receive the execution input.
+type Sources map[string][]uint
+
+// Derive determines the lineage of a node's output from its configuration. Transform mappings
+// map output fields to the fields they copy, placeholders elsewhere in the configuration make
+// the whole output derived from the referenced fields, and filters pass on their input.
+func Derive(executorClass string, config map[string]interface{}, sources Sources) []models.LineageEdge {
+	var edges []models.LineageEdge
+
+	switch executorClass {
+	case "transform":
+		// Each item of the output is the mapping applied to the output of one source
+		for i, sourceID := range transformItems(sources) {
+			sourceID := sourceID
+			walkMapping(config["mapping"], "", func(field, path string) {
+				edges = append(edges, models.LineageEdge{
+					OutputField:  join(strconv.Itoa(i), field),
+					SourceNodeID: &sourceID,
+					SourceField:  path,
+					Kind:         models.LineageMapping,
+				})
+			})
+		}
+		if len(sources) == 0 {
+			// Without sources the mapping applies to the execution input
+			walkMapping(config["mapping"], "", func(field, path string) {
+				edges = append(edges, models.LineageEdge{OutputField: join("0", field), SourceField: path, Kind: models.LineageMapping})
+			})
+		}
+		return edges
+	case "filter", "condition":
+		for _, handle := range sortedHandles(sources) {
+			for _, sourceID := range sources[handle] {
+				sourceID := sourceID
+				edges = append(edges, models.LineageEdge{SourceNodeID: &sourceID, Kind: models.LineagePassthrough})
+			}
+		}
+	}
+
+	for _, path := range placeholders(config) {
+		sourceID, field, ok := resolve(path, sources)
+		if !ok {
+			continue
+		}
+		edges = append(edges, models.LineageEdge{SourceNodeID: sourceID, SourceField: field, Kind: models.LineageTemplate})
+	}
+	return edges
+}
+
+// Record stores the lineage of a completed node execution
+func Record(executionID, nodeExecutionID, nodeID uint, executorClass string, config map[string]interface{}, sources Sources) {
+	if !enabled {
+		return
+	}
+	edges := Derive(executorClass, config, sources)
+	if len(edges) == 0 {
+		return
+	}
+	for i := range edges {
+		edges[i].WorkflowExecutionID = executionID
+		edges[i].NodeExecutionID = nodeExecutionID
+		edges[i].NodeID = nodeID
+	}
+	if err := database.DB.Create(&edges).Error; err != nil {
+		log.Printf("Failed to record lineage of node %d in execution %d: %v", nodeID, executionID, err)
+	}
+}
+
+// transformItems returns the sources of the items a transform node maps, following the
+// transform executor: those of the only input handle, or of "input"
+func transformItems(sources Sources) []uint {
+	if len(sources) == 1 {
+		for _, ids := range sources {
+			return ids
+		}
+	}
+	return sources["input"]
+}
+
+// walkMapping calls fn for every field of a transform mapping copying a field of the item
+func walkMapping(mapping interface{}, prefix string, fn func(field, path string)) {
+	switch m := mapping.(type) {
+	case map[string]interface{}:
+		for key, value := range m {
+			if s, ok := value.(string); ok {
+				if strings.HasPrefix(s, "{{") && strings.HasSuffix(s, "}}") {
+					fn(join(prefix, key), strings.TrimSpace(s[2:len(s)-2]))
+				}
+				continue
+			}
+			walkMapping(value, join(prefix, key), fn)
+		}
+	case []interface{}:
+		for i, value := range m {
+			walkMapping(value, join(prefix, strconv.Itoa(i)), fn)
+		}
+	}
+}
+
+// placeholders returns the paths of the placeholders in the configuration, without those of
+// namespaces like "$state"
+func placeholders(value interface{}) []string {
+	seen := map[string]bool{}
+	var walk func(interface{})
+	walk = func(value interface{}) {
+		switch v := value.(type) {
+		case string:
+			for _, match := range placeholderPattern.FindAllStringSubmatch(v, -1) {
+				if !strings.HasPrefix(match[1], "$") {
+					seen[match[1]] = true
+				}
+			}
+		case map[string]interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		case []interface{}:
+			for _, item := range v {
+				walk(item)
+			}
+		}
+	}
+	walk(value)
+
+	paths := make([]string, 0, len(seen))
+	for path := range seen {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// resolve maps a placeholder path of a node's input to the upstream node and field it refers to.
+// Inputs are "<handle>.<index>.<field>"; start nodes reference the execution input.
+func resolve(path string, sources Sources) (*uint, string, bool) {
+	if len(sources) == 0 {
+		return nil, path, true
+	}
+
+	handle, rest, _ := strings.Cut(path, ".")
+	ids, ok := sources[handle]
+	if !ok || len(ids) == 0 {
+		return nil, "", false
+	}
+
+	indexPart, field, _ := strings.Cut(rest, ".")
+	if index, err := strconv.Atoi(indexPart); err == nil {
+		if index < 0 || index >= len(ids) {
+			return nil, "", false
+		}
+		id := ids[index]
+		return &id, field, true
+	}
+
+	// Without an index the path is only unambiguous for a single source
+	if len(ids) == 1 {
+		id := ids[0]
+		return &id, rest, true
+	}
+	return nil, "", false
+}
+
+// Trace follows the lineage of a field of a node's output in an execution back to the execution
+// input or to the fields whose origin is unknown. An empty field traces the whole output.
+func Trace(executionID, nodeID uint, field string) ([]models.LineageStep, error) {
+	var edges []models.LineageEdge
+	if err := database.DB.Where("workflow_execution_id = ?", executionID).Order("id").Find(&edges).Error; err != nil {
+		return nil, err
+	}
+	byNode := map[uint][]models.LineageEdge{}
+	for _, edge := range edges {
+		byNode[edge.NodeID] = append(byNode[edge.NodeID], edge)
+	}
+
+	names := map[uint]string{}
+	var nodes []models.Node
+	database.DB.Select("id", "name").Where("id IN (?)", database.DB.Model(&models.NodeExecution{}).
+		Select("node_id").Where("workflow_execution_id = ?", executionID)).Find(&nodes)
+	for _, node := range nodes {
+		names[node.ID] = node.Name
+	}
+
+	type position struct {
+		nodeID uint
+		field  string
+	}
+	steps := []models.LineageStep{}
+	visited := map[position]bool{}
+	queue := []position{{nodeID, field}}
+	for len(queue) > 0 && len(steps) < maxTraceSteps {
+		current := queue[0]
+		queue = queue[1:]
+		if visited[current] {
+			continue
+		}
+		visited[current] = true
+
+		for _, edge := range byNode[current.nodeID] {
+			sourceField, ok := follow(edge, current.field)
+			if !ok {
+				continue
+			}
+			steps = append(steps, models.LineageStep{
+				NodeID:       current.nodeID,
+				NodeName:     names[current.nodeID],
+				Field:        current.field,
+				Kind:         edge.Kind,
+				SourceNodeID: edge.SourceNodeID,
+				SourceField:  sourceField,
+			})
+			if edge.SourceNodeID != nil {
+				queue = append(queue, position{*edge.SourceNodeID, sourceField})
+			}
+		}
+	}
+	return steps, nil
+}
+
+// follow returns the source field an edge derives the field from, if the edge concerns it.
+// Edges of the whole output concern every field; edges of a parent field pass on the rest of
+// the path. Tracing a parent field includes the edges of its children.
+func follow(edge models.LineageEdge, field string) (string, bool) {
+	switch {
+	case edge.OutputField == "" || edge.OutputField == field:
+		if edge.Kind == models.LineagePassthrough {
+			return join(edge.SourceField, field), true
+		}
+		return edge.SourceField, true
+	case strings.HasPrefix(field, edge.OutputField+"."):
+		return join(edge.SourceField, strings.TrimPrefix(field, edge.OutputField+".")), true
+	case field == "" || strings.HasPrefix(edge.OutputField, field+"."):
+		return edge.SourceField, true
+	}
+	return "", false
+}
+
+// join joins path segments with dots, skipping empty ones
+func join(parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, ".")
+}
+
+// sortedHandles returns the input handles in order
+func sortedHandles(sources Sources) []string {
+	handles := make([]string, 0, len(sources))
+	for handle := range sources {
+		handles = append(handles, handle)
+	}
+	sort.Strings(handles)
+	return handles
+}
@@ -0,0 +1,136 @@
+// Package maintenance provides the cluster-wide maintenance mode. While it is enabled the API
+// still accepts executions but holds them back, and the workers finish their current tasks and
+// then stop taking new ones, so that the database can be maintained safely.
+package maintenance
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/queue"
+	"github.com/go-redis/redis/v8"
+)
+
+// key is the Redis key holding the maintenance state
+const key = "flowcraft:maintenance"
+
+// cacheTTL is how long a process relies on the state it read last, so that the flag is not
+// read from Redis for every dispatched execution and dequeued task
+const cacheTTL = 2 * time.Second
+
+// State describes the maintenance mode
+type State struct {
+	Enabled bool       `json:"enabled"`
+	Reason  string     `json:"reason,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+	By      string     `json:"by,omitempty"`
+}
+
+// ErrNotConfigured is returned when changing the maintenance mode of a process without Redis
+var ErrNotConfigured = errors.New("maintenance mode is not configured")
+
+var (
+	client redis.UniversalClient
+
+	mu       sync.Mutex
+	cached   State
+	cachedAt time.Time
+)
+
+// Configure sets the queue whose Redis stores the maintenance state. Without it maintenance
+// mode is never enabled.
+func Configure(queueClient *queue.QueueClient) {
+	client = queueClient.RedisClient()
+}
+
+// Status reads the current maintenance state
+func Status() (State, error) {
+	if client == nil {
+		return State{}, nil
+	}
+
+	data, err := client.Get(context.Background(), key).Bytes()
+	if err == redis.Nil {
+		return State{}, nil
+	}
+	if err != nil {
+		return State{}, err
+	}
+
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return State{}, err
+	}
+	return state, nil
+}
+
+// Enabled reports whether maintenance mode is enabled. If the state cannot be read the last
+// known state applies.
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if time.Since(cachedAt) < cacheTTL {
+		return cached.Enabled
+	}
+
+	state, err := Status()
+	if err != nil {
+		log.Printf("Failed to read maintenance mode: %v", err)
+		return cached.Enabled
+	}
+	cached = state
+	cachedAt = time.Now()
+	return state.Enabled
+}
+
+// Enable turns maintenance mode on for all servers and workers
+func Enable(reason, by string) (State, error) {
+	now := time.Now()
+	state := State{Enabled: true, Reason: reason, Since: &now, By: by}
+	if err := store(state); err != nil {
+		return State{}, err
+	}
+	return state, nil
+}
+
+// Disable turns maintenance mode off. Executions held back in the meantime are started by the
+// workers.
+func Disable() error {
+	if client == nil {
+		return ErrNotConfigured
+	}
+	if err := client.Del(context.Background(), key).Err(); err != nil {
+		return err
+	}
+	setCached(State{})
+	return nil
+}
+
+// store saves the state and applies it to this process immediately
+func store(state State) error {
+	if client == nil {
+		return ErrNotConfigured
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if err := client.Set(context.Background(), key, data, 0).Err(); err != nil {
+		return err
+	}
+	setCached(state)
+	return nil
+}
+
+// setCached replaces the cached state
+func setCached(state State) {
+	mu.Lock()
+	cached = state
+	cachedAt = time.Now()
+	mu.Unlock()
+}
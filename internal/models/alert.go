@@ -0,0 +1,97 @@
+package models
+
+import "time"
+
+// Conditions of alert rules
+const (
+	// AlertFailureRate fires if the percentage of failed executions within the window reaches the threshold
+	AlertFailureRate = "failure_rate"
+	// AlertConsecutiveFailures fires if the last executions, as many as the threshold, all failed
+	AlertConsecutiveFailures = "consecutive_failures"
+	// AlertDuration fires if an execution within the window ran, or is running, for at least
+	// the threshold in seconds
+	AlertDuration = "duration"
+)
+
+// Scopes of alert rules
+const (
+	AlertScopeWorkflow = "workflow"
+	AlertScopeTag      = "tag"
+	AlertScopeGlobal   = "global"
+)
+
+// Channels alerts are sent to
+const (
+	AlertChannelEmail   = "email"
+	AlertChannelSlack   = "slack"
+	AlertChannelWebhook = "webhook"
+)
+
+// States of alerts
+const (
+	AlertOK     = "ok"
+	AlertFiring = "firing"
+)
+
+// AlertRule describes when operators are alerted about workflows. Rules are evaluated per
+// workflow in their scope; executions of published versions count for their workflow.
+type AlertRule struct {
+	ID             uint   `gorm:"primaryKey" json:"id"`
+	OrganizationID uint   `json:"organization_id" gorm:"index"`
+	Name           string `json:"name"`
+
+	Condition string  `json:"condition"` // failure_rate, consecutive_failures, duration
+	Threshold float64 `json:"threshold"` // percent, number of executions or seconds
+	// Window is the period of executions evaluated, e.g. "1h"
+	Window string `json:"window"`
+	// MinExecutions is the number of executions within the window a failure rate needs
+	MinExecutions int `json:"min_executions"`
+
+	Scope      string `json:"scope"` // workflow, tag, global
+	WorkflowID *uint  `json:"workflow_id,omitempty" gorm:"index"`
+	Tag        string `json:"tag,omitempty"`
+
+	Channel string `json:"channel"` // email, slack, webhook
+	// Target holds the comma separated email addresses, the Slack webhook URL (SLACK_WEBHOOK_URL
+	// if empty) or the webhook URL
+	Target string `json:"target"`
+
+	Disabled bool `json:"disabled"`
+	// SilencedUntil suppresses the notifications of the rule, its alerts are still tracked
+	SilencedUntil *time.Time `json:"silenced_until"`
+
+	LastEvaluatedAt *time.Time `json:"last_evaluated_at"`
+	LastError       string     `json:"last_error"`
+	CreatedBy       uint       `json:"created_by"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// Silenced reports whether the notifications of the rule are suppressed at the given time
+func (r AlertRule) Silenced(at time.Time) bool {
+	return r.SilencedUntil != nil && r.SilencedUntil.After(at)
+}
+
+// Alert is the state of an alert rule for one workflow
+type Alert struct {
+	ID           uint   `gorm:"primaryKey" json:"id"`
+	AlertRuleID  uint   `json:"alert_rule_id" gorm:"uniqueIndex:idx_alert_rule_workflow"`
+	WorkflowID   uint   `json:"workflow_id" gorm:"uniqueIndex:idx_alert_rule_workflow"`
+	WorkflowName string `json:"workflow_name"`
+	State        string `json:"state" gorm:"default:'ok';index"` // ok, firing
+	// Value is the failure rate, number of failures or duration measured by the last evaluation
+	Value      float64    `json:"value"`
+	FiredAt    *time.Time `json:"fired_at"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	// NotifiedAt is when the last notification was sent; alerts firing while their rule was
+	// silenced are not notified
+	NotifiedAt *time.Time `json:"notified_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// SilenceRequest represents the input data for silencing an alert rule
+type SilenceRequest struct {
+	// Duration such as "2h", or Until as RFC 3339 time
+	Duration string     `json:"duration"`
+	Until    *time.Time `json:"until"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// DurationBaseline is the learned typical duration of a workflow's executions (NodeID 0) or of
+// a node's executions, as exponentially weighted mean and variance of the log durations
+type DurationBaseline struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	WorkflowID uint      `json:"workflow_id" gorm:"uniqueIndex:idx_duration_baseline"`
+	NodeID     uint      `json:"node_id" gorm:"uniqueIndex:idx_duration_baseline"`
+	Samples    int64     `json:"samples"`
+	MeanLog    float64   `json:"mean_log"`
+	VarLog     float64   `json:"var_log"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// TypicalMs returns the typical duration in milliseconds
+func (b DurationBaseline) TypicalMs() float64 {
+	return math.Exp(b.MeanLog)
+}
+
+// AnalysisCursor is the position of a background analysis in the completed executions
+type AnalysisCursor struct {
+	Name            string     `gorm:"primaryKey" json:"name"`
+	LastCompletedAt *time.Time `json:"last_completed_at"`
+	LastExecutionID uint       `json:"last_execution_id"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+// DurationAnomaly is an execution whose duration deviates from its workflow's typical duration,
+// with the nodes deviating most
+type DurationAnomaly struct {
+	ExecutionID  uint          `json:"execution_id"`
+	WorkflowID   uint          `json:"workflow_id"`
+	Name         string        `json:"name"`
+	CompletedAt  time.Time     `json:"completed_at"`
+	DurationMs   float64       `json:"duration_ms"`
+	TypicalMs    float64       `json:"typical_ms"`
+	AnomalyScore float64       `json:"anomaly_score"`
+	Nodes        []NodeAnomaly `json:"nodes"`
+}
+
+// NodeAnomaly is a node execution whose duration deviates from the node's typical duration
+type NodeAnomaly struct {
+	NodeExecutionID uint    `json:"node_execution_id"`
+	NodeID          uint    `json:"node_id"`
+	Name            string  `json:"name"`
+	NodeType        string  `json:"node_type"`
+	DurationMs      int64   `json:"duration_ms"`
+	TypicalMs       float64 `json:"typical_ms"`
+	AnomalyScore    float64 `json:"anomaly_score"`
+}
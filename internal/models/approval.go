@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Approval is a request for human approval created by an approval node.
+// The execution branch waits until the approval is decided.
+type Approval struct {
+	ID                  uint       `gorm:"primaryKey" json:"id"`
+	WorkflowExecutionID uint       `json:"workflow_execution_id" gorm:"index"`
+	NodeID              uint       `json:"node_id"`
+	Message             string     `json:"message"`
+	Assignees           string     `json:"assignees" gorm:"type:jsonb;default:'[]'"` // email addresses, empty means any editor
+	RequiredApprovals   int        `json:"required_approvals" gorm:"default:2"`
+	Status              string     `json:"status" gorm:"default:'pending';index"` // pending, approved, rejected
+	Data                string     `json:"data" gorm:"type:jsonb;default:'{}'"`
+	CreatedAt           time.Time  `json:"created_at"`
+	DecidedAt           *time.Time `json:"decided_at"`
+
+	// Relationships
+	Decisions []ApprovalDecision `json:"decisions" gorm:"foreignKey:ApprovalID"`
+}
+
+// ApprovalDecision is the vote of a single user on an approval
+type ApprovalDecision struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	ApprovalID uint      `json:"approval_id" gorm:"uniqueIndex:idx_approval_decision_user"`
+	UserID     uint      `json:"user_id" gorm:"uniqueIndex:idx_approval_decision_user"`
+	Decision   string    `json:"decision"` // approve, reject
+	Comment    string    `json:"comment"`
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// ExecutionArtifact is an output of a node execution kept as a named file in the blob store,
+// e.g. a report or an export. Artifacts have their own retention, so they outlive the payloads
+// and node executions of their execution.
+type ExecutionArtifact struct {
+	ID                  uint   `gorm:"primaryKey" json:"id"`
+	WorkflowExecutionID uint   `json:"workflow_execution_id" gorm:"index"`
+	NodeID              uint   `json:"node_id"`
+	NodeExecutionID     uint   `json:"node_execution_id" gorm:"uniqueIndex:idx_execution_artifacts_name,priority:1"`
+	Name                string `json:"name" gorm:"uniqueIndex:idx_execution_artifacts_name,priority:2"`
+	// BlobID references the contents in the blob store, FileName names downloads
+	BlobID      string    `json:"blob_id"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" gorm:"index"`
+}
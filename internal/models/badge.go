@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Statuses of workflows shown by status badges
+const (
+	WorkflowPassing = "passing"
+	WorkflowFailing = "failing"
+	WorkflowUnknown = "unknown"
+)
+
+// StatusBadge publishes the last-run status of a workflow without authentication, to anyone
+// knowing its token, e.g. as a badge embedded in a wiki or README
+type StatusBadge struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	WorkflowID uint      `json:"workflow_id" gorm:"uniqueIndex"`
+	Token      string    `json:"token" gorm:"uniqueIndex"`
+	CreatedBy  uint      `json:"created_by"`
+	CreatedAt  time.Time `json:"created_at"`
+	// URLs of the public endpoints, not stored
+	StatusURL string `json:"status_url" gorm:"-"`
+	BadgeURL  string `json:"badge_url" gorm:"-"`
+}
+
+// WorkflowStatus is the public status of a workflow: passing or failing by its last finished
+// execution, unknown if none finished yet
+type WorkflowStatus struct {
+	Workflow        string     `json:"workflow"`
+	Status          string     `json:"status"`
+	Running         bool       `json:"running"` // an execution is in progress
+	LastExecutionID uint       `json:"last_execution_id,omitempty"`
+	LastStartedAt   *time.Time `json:"last_started_at,omitempty"`
+	LastCompletedAt *time.Time `json:"last_completed_at,omitempty"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Comment is a comment on a workflow or on one of its nodes, e.g. during the review of changes
+type Comment struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	WorkflowID uint       `json:"workflow_id" gorm:"index"`
+	NodeID     *uint      `json:"node_id" gorm:"index"` // nil for comments on the workflow
+	UserID     uint       `json:"user_id"`
+	Body       string     `json:"body"`
+	Resolved   bool       `json:"resolved"`
+	ResolvedBy *uint      `json:"resolved_by"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// CommentRequest creates or updates a comment
+type CommentRequest struct {
+	Body     string `json:"body"`
+	NodeID   *uint  `json:"node_id"`
+	Resolved *bool  `json:"resolved"`
+}
+
+// PublishRequest publishes a new version of a workflow
+type PublishRequest struct {
+	ChangeNote string `json:"change_note"`
+	// NodeTypeVersions pins node types to versions other than the current ones, by node type key
+	NodeTypeVersions map[string]string `json:"node_type_versions"`
+}
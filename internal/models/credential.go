@@ -0,0 +1,95 @@
+package models
+
+import "time"
+
+// Credential holds the secrets nodes use to authenticate with external services.
+// The secret fields are stored encrypted and never returned by the API.
+type Credential struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	Name           string    `json:"name"`
+	CredentialType string    `json:"credential_type"` // jira, github, bearer, basic, api_key, slack, mqtt, amqp, aws, oauth2_authcode
+	OrganizationID uint      `json:"organization_id" gorm:"index"`
+	Data           string    `json:"-"`               // encrypted JSON object of the secret fields
+	ExternalRef    string    `json:"external_ref"`    // secret in the external secrets manager, instead of Data
+	Fields         []string  `json:"fields" gorm:"-"` // names of the stored fields
+	CreatedBy      uint      `json:"created_by"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	// TestNodeType and TestConfig describe the node run to check the credential when it is rotated
+	TestNodeType string     `json:"test_node_type"`
+	TestConfig   string     `json:"test_config" gorm:"type:jsonb;default:'{}'"`
+	RotatedAt    *time.Time `json:"rotated_at"`
+
+	// OAuth2 authorization state of oauth2_authcode credentials, the tokens are part of Data
+	AuthorizedAt   *time.Time `json:"authorized_at,omitempty"`
+	GrantedScopes  string     `json:"granted_scopes,omitempty"` // space-separated
+	TokenExpiresAt *time.Time `json:"token_expires_at,omitempty"`
+}
+
+// CredentialRequest represents the input data for credential creation/update
+type CredentialRequest struct {
+	Name           string            `json:"name"`
+	CredentialType string            `json:"credential_type"`
+	Data           map[string]string `json:"data"`
+	ExternalRef    string            `json:"external_ref"`
+	TestNodeType   string            `json:"test_node_type"`
+	TestConfig     string            `json:"test_config"`
+}
+
+// CredentialUsage is a node referencing a credential by credential_id
+type CredentialUsage struct {
+	WorkflowID      uint   `json:"workflow_id"`
+	WorkflowName    string `json:"workflow_name"`
+	WorkflowVersion int    `json:"workflow_version,omitempty"`
+	NodeID          uint   `json:"node_id"`
+	NodeName        string `json:"node_name"`
+	NodeType        string `json:"node_type"`
+}
+
+// CredentialRotationRequest represents the input data for rotating the secrets of a credential
+type CredentialRotationRequest struct {
+	Data map[string]string `json:"data"`
+	// Validate runs the credential's test node with the new secrets before they are stored
+	Validate bool `json:"validate"`
+}
+
+// CredentialRotation is the result of rotating a credential
+type CredentialRotation struct {
+	Credential Credential  `json:"credential"`
+	Validated  bool        `json:"validated"`
+	TestOutput interface{} `json:"test_output,omitempty"`
+}
+
+// CredentialTestRequest represents the optional input data for testing a credential. Credentials
+// of the types bearer, basic and api_key don't know their service and are tested against URL.
+type CredentialTestRequest struct {
+	URL    string `json:"url"`
+	Header string `json:"header"` // header the api_key is sent in, default X-API-Key
+}
+
+// CredentialTestResult reports whether a credential works and what was found out
+type CredentialTestResult struct {
+	Success    bool        `json:"success"`
+	Method     string      `json:"method"` // jira, github, mqtt, amqp, aws, http or test_node
+	URL        string      `json:"url,omitempty"`
+	StatusCode int         `json:"status_code,omitempty"`
+	DurationMs int64       `json:"duration_ms"`
+	Message    string      `json:"message"`
+	Details    interface{} `json:"details,omitempty"`
+}
+
+// OAuth2State is a pending authorization of an oauth2_authcode credential. The nonce in the state
+// passed to the provider is consumed by the callback, so each state is accepted once.
+type OAuth2State struct {
+	ID           uint      `gorm:"primaryKey" json:"-"`
+	CredentialID uint      `json:"credential_id"`
+	Nonce        string    `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index"`
+}
+
+// OAuth2Authorization is the result of completing the authorization of an oauth2_authcode credential
+type OAuth2Authorization struct {
+	Credential    Credential `json:"credential"`
+	MissingScopes []string   `json:"missing_scopes"` // requested scopes the user did not grant
+}
@@ -0,0 +1,55 @@
+package models
+
+// WorkflowDependencies describes the resources a workflow uses and the workflows and triggers
+// connected to it
+type WorkflowDependencies struct {
+	WorkflowID uint `json:"workflow_id"`
+
+	// Workflows waiting for events this workflow emits, and workflows emitting events it waits for
+	Calls    []WorkflowReference `json:"calls"`
+	CalledBy []WorkflowReference `json:"called_by"`
+
+	EmittedEvents []string `json:"emitted_events"`
+	AwaitedEvents []string `json:"awaited_events"`
+
+	Credentials []CredentialReference `json:"credentials"`
+	Variables   []VariableReference   `json:"variables"`
+	Triggers    []TriggerReference    `json:"triggers"`
+
+	// Versions published from the workflow, or the workflow a version was published from
+	Versions []WorkflowReference `json:"versions"`
+	Parent   *WorkflowReference  `json:"parent,omitempty"`
+}
+
+// WorkflowReference points at a workflow related to another one, e.g. through an event
+type WorkflowReference struct {
+	ID      uint     `json:"id"`
+	Name    string   `json:"name"`
+	Version int      `json:"version,omitempty"`
+	Events  []string `json:"events,omitempty"`
+	NodeIDs []uint   `json:"node_ids,omitempty"` // nodes of the referenced workflow involved
+}
+
+// CredentialReference is a credential used by nodes of a workflow
+type CredentialReference struct {
+	ID             uint   `json:"id"`
+	Name           string `json:"name"`
+	CredentialType string `json:"credential_type"`
+	Missing        bool   `json:"missing,omitempty"` // the credential no longer exists
+	NodeIDs        []uint `json:"node_ids"`
+}
+
+// VariableReference is a key of the state store read or written by nodes of a workflow
+type VariableReference struct {
+	Scope   string `json:"scope"` // global, workflow, trigger
+	Key     string `json:"key"`
+	NodeIDs []uint `json:"node_ids"`
+}
+
+// TriggerReference is a trigger starting a workflow
+type TriggerReference struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	TriggerType string `json:"trigger_type"`
+	IsActive    bool   `json:"is_active"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Event is a named signal emitted by a workflow or an external system. Events are kept
+// as a persistent log.
+type Event struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	Name              string    `json:"name" gorm:"index"`
+	Payload           string    `json:"payload" gorm:"type:jsonb;default:'{}'"`
+	SchemaVersion     int       `json:"schema_version,omitempty"` // version of the registered schema the payload was validated against
+	SourceExecutionID *uint     `json:"source_execution_id"`
+	CreatedAt         time.Time `json:"created_at" gorm:"index"`
+}
+
+// EventSubscription is a waitForEvent node waiting for a matching event
+type EventSubscription struct {
+	ID                  uint       `gorm:"primaryKey" json:"id"`
+	WorkflowExecutionID uint       `json:"workflow_execution_id" gorm:"index"`
+	NodeID              uint       `json:"node_id"`
+	EventName           string     `json:"event_name" gorm:"index"`
+	Match               string     `json:"match" gorm:"type:jsonb;default:'{}'"`  // payload fields the event must have
+	Status              string     `json:"status" gorm:"default:'waiting';index"` // waiting, received, timed_out
+	ExpiresAt           *time.Time `json:"expires_at" gorm:"index"`
+	EventID             *uint      `json:"event_id"`
+	CreatedAt           time.Time  `json:"created_at"`
+}
@@ -10,36 +10,159 @@ import (
 type WorkflowExecution struct {
 	ID           uint           `gorm:"primaryKey" json:"id"`
 	WorkflowID   uint           `json:"workflow_id"`
-	Status       string         `json:"status" gorm:"default:'pending'"` // pending, running, completed, failed
+	Status       string         `json:"status" gorm:"default:'pending'"` // held, queued, pending, running, waiting, completed, failed, cancelled
 	StartedAt    time.Time      `json:"started_at"`
+	QueuedUntil  *time.Time     `json:"queued_until,omitempty" gorm:"index"` // earliest start of an execution held back by the controls of its trigger
 	CompletedAt  *time.Time     `json:"completed_at"`
 	InputData    string         `json:"input_data" gorm:"type:jsonb;default:'{}'"`
 	OutputData   string         `json:"output_data" gorm:"type:jsonb;default:'{}'"`
 	ErrorMessage string         `json:"error_message"`
+	TriageStatus string         `json:"triage_status,omitempty" gorm:"index"` // acknowledged, ignored or fixed once someone handled the failure
+	TriagedBy    *uint          `json:"triaged_by,omitempty"`
+	TriagedAt    *time.Time     `json:"triaged_at,omitempty"`
+	BatchID      *uint          `json:"batch_id" gorm:"index"`
+	TriggerID    *uint          `json:"trigger_id" gorm:"index"`
+	DataCaptured bool           `json:"data_captured" gorm:"default:true"` // false if payloads were dropped by the workflow's capture mode
+	Profiling    bool           `json:"profiling" gorm:"default:false"`    // record a NodeProfile per executed node
+	SLABreached  bool           `json:"sla_breached"`                      // the execution breached the SLA of its workflow
+	AnomalyScore *float64       `json:"anomaly_score,omitempty"`           // deviation of the duration from the typical one in standard deviations
+	Cost         float64        `json:"cost"`                              // estimated cost of the external API calls of the node executions
+	CreatedAt    time.Time      `json:"created_at"`                        // partition key if execution data is partitioned
+	ArchivedAt   *time.Time     `json:"archived_at,omitempty"`             // payloads and node executions were moved to the archive
+	ArchiveKey   string         `json:"-"`                                 // key of the archived execution in the archive bucket
 	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
 
+	// RetryOfID references the failed execution this execution retries automatically, see
+	// Workflow.AutoRetryMax; RetryAttempt numbers the retries, 0 for the first run
+	RetryOfID    *uint `json:"retry_of_id,omitempty" gorm:"index"`
+	RetryAttempt int   `json:"retry_attempt,omitempty"`
+
+	// CancelRequestedAt is set when the cancellation of the execution was requested; its worker
+	// stops it before the next node. Only the cancel endpoint writes it, the engine leaves it out
+	// when saving executions.
+	CancelRequestedAt *time.Time `json:"cancel_requested_at,omitempty"`
+
 	// Beziehungen
 	Workflow       Workflow        `json:"-" gorm:"foreignKey:WorkflowID"`
 	NodeExecutions []NodeExecution `json:"node_executions" gorm:"foreignKey:WorkflowExecutionID"`
 }
 
+// Triage statuses of failed executions
+const (
+	TriageAcknowledged = "acknowledged"
+	TriageIgnored      = "ignored"
+	TriageFixed        = "fixed"
+)
+
+// TriageStatuses are the triage statuses failed executions can be set to
+var TriageStatuses = []string{TriageAcknowledged, TriageIgnored, TriageFixed}
+
+// TriageRequest sets the triage status of a failed execution, optionally with a note
+type TriageRequest struct {
+	// Status is acknowledged, ignored or fixed, empty to mark the failure as untriaged again
+	Status string `json:"status"`
+	Note   string `json:"note"`
+}
+
+// ExecutionNote is a note on an execution, e.g. on the cause of a failure or how it was fixed
+type ExecutionNote struct {
+	ID                  uint   `gorm:"primaryKey" json:"id"`
+	WorkflowExecutionID uint   `json:"workflow_execution_id" gorm:"index"`
+	UserID              uint   `json:"user_id"`
+	Body                string `json:"body"`
+	// TriageStatus is the triage status the note was added with, if any
+	TriageStatus string    `json:"triage_status,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// ExecutionNoteRequest creates or updates a note on an execution
+type ExecutionNoteRequest struct {
+	Body string `json:"body"`
+}
+
+// ExecutionBatch groups the executions started together for many inputs
+type ExecutionBatch struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	WorkflowID uint      `json:"workflow_id" gorm:"index"`
+	Mode       string    `json:"mode"` // per_item: one execution per input, single: one execution for all inputs, stream: one execution per chunk of an upload
+	ItemCount  int       `json:"item_count"`
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Relationships
+	Executions []WorkflowExecution `json:"-" gorm:"foreignKey:BatchID"`
+}
+
 // NodeExecution repräsentiert eine einzelne Node-Ausführung innerhalb einer Workflow-Ausführung
 type NodeExecution struct {
 	ID                  uint       `gorm:"primaryKey" json:"id"`
-	WorkflowExecutionID uint       `json:"workflow_execution_id"`
-	NodeID              uint       `json:"node_id"`
-	Status              string     `json:"status" gorm:"default:'pending'"` // pending, running, completed, failed, skipped
+	WorkflowExecutionID uint       `json:"workflow_execution_id" gorm:"index:idx_node_executions_execution_node,priority:1"`
+	NodeID              uint       `json:"node_id" gorm:"index:idx_node_executions_execution_node,priority:2"`
+	Status              string     `json:"status" gorm:"default:'pending'"` // pending, running, waiting, completed, failed, skipped
 	StartedAt           *time.Time `json:"started_at"`
 	CompletedAt         *time.Time `json:"completed_at"`
 	InputData           string     `json:"input_data" gorm:"type:jsonb;default:'{}'"`
 	OutputData          string     `json:"output_data" gorm:"type:jsonb;default:'{}'"`
+	OutputHandle        string     `json:"output_handle"` // set by branching nodes, empty if all outputs are active
 	ErrorMessage        string     `json:"error_message"`
+	ErrorCode           string     `json:"error_code"`            // machine readable cause, e.g. CIRCUIT_OPEN
+	ErrorCategory       string     `json:"error_category"`        // config, auth, rate_limited, transient, timeout or data; empty if unknown
+	StackTrace          string     `json:"stack_trace,omitempty"` // of the panic of the executor, if it panicked
+	CompensatedNodeID   *uint      `json:"compensated_node_id"`   // set on executions of compensation nodes
+	Attempt             int        `json:"attempt" gorm:"default:1"`
+	IdempotencyKey      string     `json:"idempotency_key" gorm:"index"`
+	CreatedAt           time.Time  `json:"created_at"` // partition key if execution data is partitioned
+
+	// Resource usage of the node execution
+	DurationMs int64 `json:"duration_ms"`
+	BytesIn    int64 `json:"bytes_in"`
+	BytesOut   int64 `json:"bytes_out"`
+	// AnomalyScore is the deviation of the duration from the node's typical duration in standard deviations
+	AnomalyScore *float64 `json:"anomaly_score,omitempty"`
+	// Cost is the estimated cost of the external API calls of the node execution
+	Cost float64 `json:"cost"`
+	// Warning notes a deviation that did not fail the node, e.g. a node type version other than pinned
+	Warning string `json:"warning,omitempty"`
 
 	// Beziehungen
 	WorkflowExecution WorkflowExecution `json:"-" gorm:"foreignKey:WorkflowExecutionID"`
 	Node              Node              `json:"-" gorm:"foreignKey:NodeID"`
 }
 
+// NodeProfile is the time and allocation breakdown of a node execution of a profiled execution.
+// Allocations are measured process-wide while the executor runs, so they include the allocations
+// of other executions processed by the same worker at the same time.
+type NodeProfile struct {
+	ID                  uint      `gorm:"primaryKey" json:"id"`
+	WorkflowExecutionID uint      `json:"workflow_execution_id" gorm:"index"`
+	NodeExecutionID     uint      `json:"node_execution_id"`
+	NodeID              uint      `json:"node_id"`
+	NodeType            string    `json:"node_type"`
+	LoadUs              int64     `json:"load_us"`    // loading the node, its type and checkpoints
+	PrepareUs           int64     `json:"prepare_us"` // collecting and storing the input
+	ExecuteUs           int64     `json:"execute_us"` // running the executor
+	PersistUs           int64     `json:"persist_us"` // storing the result
+	TotalUs             int64     `json:"total_us"`
+	AllocBytes          uint64    `json:"alloc_bytes"`
+	Allocs              uint64    `json:"allocs"`
+	GCCycles            uint32    `json:"gc_cycles"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// ExecutionProfile sums up the node profiles of a profiled execution, slowest nodes first
+type ExecutionProfile struct {
+	ExecutionID uint          `json:"execution_id"`
+	Status      string        `json:"status"`
+	DurationMs  int64         `json:"duration_ms"`
+	LoadUs      int64         `json:"load_us"`
+	PrepareUs   int64         `json:"prepare_us"`
+	ExecuteUs   int64         `json:"execute_us"`
+	PersistUs   int64         `json:"persist_us"`
+	AllocBytes  uint64        `json:"alloc_bytes"`
+	Allocs      uint64        `json:"allocs"`
+	Nodes       []NodeProfile `json:"nodes"`
+}
+
 // NodeType repräsentiert einen verfügbaren Node-Typ mit seinen Eigenschaften
 type NodeType struct {
 	ID            uint   `gorm:"primaryKey" json:"id"`
@@ -52,6 +175,12 @@ type NodeType struct {
 	InputSchema   string `json:"input_schema" gorm:"type:jsonb"`
 	OutputSchema  string `json:"output_schema" gorm:"type:jsonb"`
 	ExecutorClass string `json:"executor_class"`
+	// Definition describes the REST API of declarative HTTP node types (executor class "httpDefinition")
+	Definition string `json:"definition" gorm:"type:jsonb;default:'{}'"`
+	// CostModel prices the external API calls of the node type's executions, see engine.CostModel
+	CostModel string `json:"cost_model" gorm:"type:jsonb;default:'{}'"`
+	// Version of the node type, e.g. of the node pack providing it; workflow versions pin it
+	Version string `json:"version"`
 }
 
 // Trigger repräsentiert einen Auslöser für einen Workflow
@@ -59,12 +188,54 @@ type Trigger struct {
 	ID             uint   `gorm:"primaryKey" json:"id"`
 	WorkflowID     uint   `json:"workflow_id"`
 	Name           string `json:"name"`
-	TriggerType    string `json:"trigger_type"` // webhook, schedule, event
+	TriggerType    string `json:"trigger_type"` // webhook, form, slack, mqtt, amqp, sqs, schedule, event
 	Config         string `json:"config" gorm:"type:jsonb"`
-	WebhookPath    string `json:"webhook_path" gorm:"uniqueIndex"`
+	WebhookPath    string `json:"webhook_path" gorm:"uniqueIndex:idx_triggers_webhook_path,where:webhook_path <> ''"`
 	CronExpression string `json:"cron_expression"`
 	IsActive       bool   `json:"is_active" gorm:"default:true"`
+	// RecordDeliveries stores the raw requests received by webhook triggers for inspection and replay
+	RecordDeliveries bool `json:"record_deliveries" gorm:"default:true"`
+	// MaxConcurrency limits the pending and running executions started by the trigger, 0 for no limit
+	MaxConcurrency int `json:"max_concurrency"`
+	// DebounceSeconds collapses requests arriving within the window into one execution with the latest input
+	DebounceSeconds int `json:"debounce_seconds"`
+	// ThrottleSeconds starts at most one execution per window, extra requests are queued or dropped (ThrottleMode)
+	ThrottleSeconds int    `json:"throttle_seconds"`
+	ThrottleMode    string `json:"throttle_mode" gorm:"default:'queue'"` // queue, drop
+	// DedupeKey is rendered against the input of each request, e.g. {{ body.order_id }}; requests
+	// with the key of a request accepted within DedupeSeconds (default 1 day) are not started again
+	DedupeKey     string `json:"dedupe_key"`
+	DedupeSeconds int    `json:"dedupe_seconds"`
+	// PayloadSchema names a schema of the schema registry the body of webhook requests must match,
+	// in version PayloadSchemaVersion or the latest if 0
+	PayloadSchema        string `json:"payload_schema"`
+	PayloadSchemaVersion int    `json:"payload_schema_version"`
+	// Timezone the cron expression of schedule triggers is evaluated in (IANA name, default UTC)
+	Timezone string `json:"timezone"`
+	// BusinessDaysOnly skips scheduled runs on weekends and holidays of the workflow's organization
+	BusinessDaysOnly bool       `json:"business_days_only"`
+	NextRunAt        *time.Time `json:"next_run_at" gorm:"index"`
 
 	// Beziehungen
 	Workflow Workflow `json:"-" gorm:"foreignKey:WorkflowID"`
 }
+
+// Statuses of execution chains
+const (
+	ChainPending = "pending"
+	ChainStarted = "started"
+	ChainSkipped = "skipped"
+	ChainFailed  = "failed"
+)
+
+// ExecutionChain starts a workflow with the output of an execution once the execution completes successfully
+type ExecutionChain struct {
+	ID                  uint      `gorm:"primaryKey" json:"id"`
+	WorkflowExecutionID uint      `json:"workflow_execution_id" gorm:"index"`
+	TargetWorkflowID    uint      `json:"target_workflow_id"`
+	Then                string    `json:"then"`                            // comma separated IDs of the workflows following the target
+	Status              string    `json:"status" gorm:"default:'pending'"` // pending, started, skipped, failed
+	TargetExecutionID   *uint     `json:"target_execution_id"`
+	ErrorMessage        string    `json:"error_message"`
+	CreatedAt           time.Time `json:"created_at"`
+}
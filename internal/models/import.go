@@ -0,0 +1,14 @@
+package models
+
+// ImportWarning flags a step of an imported workflow that could not be converted (completely)
+type ImportWarning struct {
+	Step    string `json:"step"`
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// ImportResult is a workflow converted from another automation tool, with the steps to review
+type ImportResult struct {
+	Workflow Workflow        `json:"workflow"`
+	Warnings []ImportWarning `json:"warnings"`
+}
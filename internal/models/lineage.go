@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Lineage kinds describing how an output field was derived
+const (
+	LineageMapping     = "mapping"     // a transform mapping copied the source field
+	LineageTemplate    = "template"    // the node configuration references the source field
+	LineagePassthrough = "passthrough" // the node passed on (a selection of) its input
+)
+
+// LineageEdge records that an output field of a node execution was derived from a field of the
+// output of an upstream node, or of the execution input if SourceNodeID is nil. Fields are
+// dotted paths with numeric indexes for lists ("0.contact.email"); an empty OutputField stands
+// for the whole output.
+type LineageEdge struct {
+	ID                  uint      `gorm:"primaryKey" json:"id"`
+	WorkflowExecutionID uint      `json:"workflow_execution_id" gorm:"index"`
+	NodeExecutionID     uint      `json:"node_execution_id"`
+	NodeID              uint      `json:"node_id"`
+	OutputField         string    `json:"output_field"`
+	SourceNodeID        *uint     `json:"source_node_id"`
+	SourceField         string    `json:"source_field"`
+	Kind                string    `json:"kind"`
+	CreatedAt           time.Time `json:"created_at"`
+}
+
+// LineageStep is a step of the trace of a value back to where it came from
+type LineageStep struct {
+	NodeID       uint   `json:"node_id"`
+	NodeName     string `json:"node_name"`
+	Field        string `json:"field"`
+	Kind         string `json:"kind"`
+	SourceNodeID *uint  `json:"source_node_id"` // nil for the execution input
+	SourceField  string `json:"source_field"`
+}
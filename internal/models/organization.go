@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Organization represents a tenant owning workflows. Quota limits of 0 mean unlimited.
+type Organization struct {
+	ID                      uint      `gorm:"primaryKey" json:"id"`
+	Name                    string    `json:"name"`
+	CreatedAt               time.Time `json:"created_at"`
+	UpdatedAt               time.Time `json:"updated_at"`
+	MaxExecutionsPerMonth   int64     `json:"max_executions_per_month"`
+	MaxConcurrentExecutions int64     `json:"max_concurrent_executions"`
+	MaxStorageBytes         int64     `json:"max_storage_bytes"`
+	// StorageBytes counts the bytes of execution data stored for the organization, see quota.Usage
+	StorageBytes int64 `json:"-"`
+	// QueueWeight is the share of the workers the organization's executions get when the queue is fair
+	QueueWeight int `json:"queue_weight" gorm:"default:1"`
+}
+
+// UsageCounter counts the billable usage of an organization in one billing period
+type UsageCounter struct {
+	ID             uint      `gorm:"primaryKey" json:"-"`
+	OrganizationID uint      `json:"organization_id" gorm:"uniqueIndex:idx_usage_counter_period"`
+	Period         string    `json:"period" gorm:"uniqueIndex:idx_usage_counter_period"` // YYYY-MM
+	Executions     int64     `json:"executions"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Holiday is a day on which the schedules of an organization's workflows do not count as business days
+type Holiday struct {
+	ID             uint   `gorm:"primaryKey" json:"id"`
+	OrganizationID uint   `json:"organization_id" gorm:"uniqueIndex:idx_holiday_date"`
+	Date           string `json:"date" gorm:"size:10;uniqueIndex:idx_holiday_date"` // YYYY-MM-DD
+	Name           string `json:"name"`
+}
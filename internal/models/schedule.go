@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// ScheduledRun is a single execution of a workflow planned for a future time
+type ScheduledRun struct {
+	ID                  uint       `gorm:"primaryKey" json:"id"`
+	WorkflowID          uint       `json:"workflow_id" gorm:"index"`
+	RunAt               time.Time  `json:"run_at" gorm:"index"`
+	InputData           string     `json:"input_data" gorm:"type:jsonb;default:'{}'"`
+	Status              string     `json:"status" gorm:"default:'scheduled';index"` // scheduled, started, cancelled, failed
+	WorkflowExecutionID *uint      `json:"workflow_execution_id"`
+	ErrorMessage        string     `json:"error_message"`
+	CreatedBy           uint       `json:"created_by"`
+	CreatedAt           time.Time  `json:"created_at"`
+	StartedAt           *time.Time `json:"started_at"`
+}
+
+// ScheduledRunRequest represents the input data for scheduling a run
+type ScheduledRunRequest struct {
+	RunAt time.Time              `json:"run_at"`
+	Input map[string]interface{} `json:"input"`
+}
@@ -0,0 +1,76 @@
+package models
+
+import "time"
+
+// ObservedOutputSchema is a JSON schema of the outputs of a node, inferred from its recent
+// executions. Schemas with NodeID 0 cover the outputs of all nodes of the node type.
+type ObservedOutputSchema struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	NodeType    string    `json:"node_type" gorm:"uniqueIndex:idx_observed_output_schemas_target"`
+	NodeID      uint      `json:"node_id" gorm:"uniqueIndex:idx_observed_output_schemas_target"`
+	Schema      string    `json:"schema" gorm:"type:jsonb;default:'{}'"`
+	Paths       []string  `json:"paths" gorm:"-"` // paths of the fields for autocompletion of expressions
+	SampleCount int       `json:"sample_count"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ExpressionPreviewRequest is an expression to evaluate against the sample input of a node
+type ExpressionPreviewRequest struct {
+	Expression string `json:"expression"`
+	// Input replaces the sample input, e.g. for nodes that were not executed yet
+	Input map[string]interface{} `json:"input"`
+}
+
+// ExpressionPreview is the result of evaluating an expression for the editor
+type ExpressionPreview struct {
+	Result interface{} `json:"result"`
+	Error  string      `json:"error,omitempty"`
+	// Unresolved lists the placeholders not found in the input, which are left untouched
+	Unresolved []string `json:"unresolved"`
+	// NodeExecutionID is the execution of the node whose input was used as sample data
+	NodeExecutionID uint `json:"node_execution_id,omitempty"`
+}
+
+// Compatibility modes of registered payload schemas, checked when a new version is registered
+const (
+	// CompatibilityForward: payloads of the new version are valid under the previous version, so
+	// consumers written against it keep working when producers switch to the new version
+	CompatibilityForward = "forward"
+	// CompatibilityBackward: payloads of the previous version are valid under the new version
+	CompatibilityBackward = "backward"
+	// CompatibilityFull: both forward and backward
+	CompatibilityFull = "full"
+	// CompatibilityNone: any change is accepted
+	CompatibilityNone = "none"
+)
+
+// PayloadSchema is a version of a named JSON schema in the schema registry, the contract of the
+// payloads of an event or the requests of a trigger. Versions are immutable and numbered per name.
+type PayloadSchema struct {
+	ID            uint      `gorm:"primaryKey" json:"id"`
+	Name          string    `json:"name" gorm:"uniqueIndex:idx_payload_schemas_version"`
+	Version       int       `json:"version" gorm:"uniqueIndex:idx_payload_schemas_version"`
+	Schema        string    `json:"schema" gorm:"type:jsonb;default:'{}'"`
+	Compatibility string    `json:"compatibility"` // forward, backward, full or none
+	Description   string    `json:"description"`
+	CreatedBy     *uint     `json:"created_by,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// PayloadSchemaRequest registers a new version of a payload schema
+type PayloadSchemaRequest struct {
+	Name   string                 `json:"name"`
+	Schema map[string]interface{} `json:"schema"`
+	// Compatibility defaults to the mode of the previous version, forward for new schemas
+	Compatibility string `json:"compatibility"`
+	Description   string `json:"description"`
+}
+
+// SchemaCompatibility is the result of checking a schema against the previous version
+type SchemaCompatibility struct {
+	Name            string   `json:"name"`
+	PreviousVersion int      `json:"previous_version,omitempty"`
+	Compatibility   string   `json:"compatibility"`
+	Compatible      bool     `json:"compatible"`
+	Problems        []string `json:"problems"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// ExecutionShare is a read-only link to the timeline and outputs of an execution for people
+// without an account, e.g. the support team of a vendor. The link is signed and expires; it can
+// be revoked before.
+type ExecutionShare struct {
+	ID                  uint       `gorm:"primaryKey" json:"id"`
+	WorkflowExecutionID uint       `json:"workflow_execution_id" gorm:"index"`
+	Redacted            bool       `json:"redacted"` // personal data is removed from outputs and messages
+	ExpiresAt           time.Time  `json:"expires_at"`
+	RevokedAt           *time.Time `json:"revoked_at"`
+	Views               int64      `json:"views"`
+	LastViewedAt        *time.Time `json:"last_viewed_at"`
+	CreatedBy           uint       `json:"created_by"`
+	CreatedAt           time.Time  `json:"created_at"`
+	// URL is the link, only returned when the share is created
+	URL string `json:"url,omitempty" gorm:"-"`
+}
+
+// ShareRequest configures a new share link
+type ShareRequest struct {
+	// ExpiresIn is the lifetime of the link, e.g. "72h" (default 7 days)
+	ExpiresIn string `json:"expires_in"`
+	// Redacted removes personal data from outputs and messages (default true)
+	Redacted *bool `json:"redacted"`
+}
+
+// SharedExecution is the view of an execution behind a share link
+type SharedExecution struct {
+	ExecutionID  uint                  `json:"execution_id"`
+	WorkflowName string                `json:"workflow_name"`
+	Status       string                `json:"status"`
+	StartedAt    time.Time             `json:"started_at"`
+	CompletedAt  *time.Time            `json:"completed_at"`
+	ErrorMessage string                `json:"error_message"`
+	Output       interface{}           `json:"output"`
+	Redacted     bool                  `json:"redacted"`
+	ExpiresAt    time.Time             `json:"expires_at"`
+	Nodes        []SharedNodeExecution `json:"nodes"`
+}
+
+// SharedNodeExecution is a node execution in the timeline of a shared execution
+type SharedNodeExecution struct {
+	NodeID        uint        `json:"node_id"`
+	Name          string      `json:"name"`
+	NodeType      string      `json:"node_type"`
+	Status        string      `json:"status"`
+	Attempt       int         `json:"attempt"`
+	StartedAt     *time.Time  `json:"started_at"`
+	CompletedAt   *time.Time  `json:"completed_at"`
+	DurationMs    int64       `json:"duration_ms"`
+	ErrorMessage  string      `json:"error_message"`
+	ErrorCode     string      `json:"error_code"`
+	ErrorCategory string      `json:"error_category"`
+	Output        interface{} `json:"output"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// OutputSink is a destination the output of completed executions of a workflow is delivered to
+type OutputSink struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	WorkflowID uint      `json:"workflow_id" gorm:"index"`
+	Name       string    `json:"name"`
+	SinkType   string    `json:"sink_type"` // webhook, s3, database
+	Config     string    `json:"config" gorm:"type:jsonb;default:'{}'"`
+	IsActive   bool      `json:"is_active" gorm:"default:true"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// OutputDelivery tracks the delivery of an execution's output to a sink
+type OutputDelivery struct {
+	ID                  uint       `gorm:"primaryKey" json:"id"`
+	OutputSinkID        uint       `json:"output_sink_id" gorm:"index"`
+	WorkflowExecutionID uint       `json:"workflow_execution_id" gorm:"index"`
+	Status              string     `json:"status" gorm:"default:'pending'"` // pending, delivered, failed
+	Destination         string     `json:"destination"`                     // rendered URL, object key or table
+	Attempts            int        `json:"attempts"`
+	ErrorMessage        string     `json:"error_message"`
+	DeliveredAt         *time.Time `json:"delivered_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+
+	// Relationships
+	OutputSink OutputSink `json:"-" gorm:"foreignKey:OutputSinkID"`
+}
+
+// Destinations of warehouse exports
+const (
+	WarehouseBigQuery   = "bigquery"
+	WarehouseSnowflake  = "snowflake"
+	WarehouseClickHouse = "clickhouse"
+	WarehouseS3         = "s3"
+)
+
+// WarehouseExport periodically streams the records of completed executions and their node
+// executions, flattened and with personal data redacted, to a data warehouse or object store
+type WarehouseExport struct {
+	ID          uint   `gorm:"primaryKey" json:"id"`
+	Name        string `json:"name"`
+	Destination string `json:"destination"` // bigquery, snowflake, clickhouse, s3
+	Config      string `json:"config" gorm:"type:jsonb;default:'{}'"`
+	Interval    string `json:"interval" gorm:"default:'1h'"`
+	// IncludePayloads exports the redacted input and output data of the executions
+	IncludePayloads bool `json:"include_payloads"`
+	Paused          bool `json:"paused"`
+
+	// Executions are exported in the order they completed, after the last exported one
+	LastCompletedAt *time.Time `json:"last_completed_at"`
+	LastExecutionID uint       `json:"last_execution_id"`
+	NextRunAt       *time.Time `json:"next_run_at" gorm:"index"`
+	LastRunAt       *time.Time `json:"last_run_at"`
+	LastError       string     `json:"last_error"`
+	ExportedRows    int64      `json:"exported_rows"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
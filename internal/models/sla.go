@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Kinds of SLA breaches
+const (
+	SLABreachDuration    = "duration"
+	SLABreachFailureRate = "failure_rate"
+)
+
+// SLABreach records that a workflow missed its service level. Duration breaches are recorded
+// for the execution that ran too long, failure rate breaches for the failed execution pushing
+// the rate above the maximum; they last until the rate is back within the SLA.
+type SLABreach struct {
+	ID                  uint   `gorm:"primaryKey" json:"id"`
+	WorkflowID          uint   `json:"workflow_id" gorm:"index"`
+	WorkflowExecutionID *uint  `json:"workflow_execution_id" gorm:"index"`
+	Kind                string `json:"kind"` // duration, failure_rate
+	// Threshold and Value are seconds for duration breaches, percentages for failure rates
+	Threshold  float64    `json:"threshold"`
+	Value      float64    `json:"value"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"index"`
+	ResolvedAt *time.Time `json:"resolved_at"`
+	// EscalationExecutionID references the execution of the escalation workflow
+	EscalationExecutionID *uint  `json:"escalation_execution_id"`
+	Error                 string `json:"error"` // why the alert or escalation failed
+}
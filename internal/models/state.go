@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// StateEntry is a value of the key-value state store. Scope is "global", "workflow:<id>"
+// or "trigger:<id>".
+type StateEntry struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Scope     string     `json:"scope" gorm:"uniqueIndex:idx_state_scope_key"`
+	Key       string     `json:"key" gorm:"uniqueIndex:idx_state_scope_key"`
+	Value     string     `json:"value" gorm:"type:jsonb;default:'null'"`
+	ExpiresAt *time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
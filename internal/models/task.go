@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// HumanTask is a unit of work for a person created by a human task node.
+// The execution branch waits until the task is completed.
+type HumanTask struct {
+	ID                  uint       `gorm:"primaryKey" json:"id"`
+	WorkflowID          uint       `json:"workflow_id" gorm:"index"`
+	WorkflowExecutionID uint       `json:"workflow_execution_id" gorm:"index"`
+	NodeID              uint       `json:"node_id"`
+	Title               string     `json:"title"`
+	Description         string     `json:"description"`
+	Assignees           string     `json:"assignees" gorm:"type:jsonb;default:'[]'"` // email addresses, empty means anyone with AssigneeRole
+	AssigneeRole        string     `json:"assignee_role"`                            // admin, editor, viewer; empty means any role
+	Status              string     `json:"status" gorm:"default:'open';index"`       // open, claimed, completed
+	ClaimedBy           *uint      `json:"claimed_by" gorm:"index"`
+	ClaimedAt           *time.Time `json:"claimed_at"`
+	DueAt               *time.Time `json:"due_at" gorm:"index"`
+	Data                string     `json:"data" gorm:"type:jsonb;default:'{}'"`
+	Result              string     `json:"result" gorm:"type:jsonb;default:'{}'"`
+	CompletedBy         *uint      `json:"completed_by"`
+	CompletedAt         *time.Time `json:"completed_at"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,80 @@
+package models
+
+import "time"
+
+// User roles
+const (
+	RoleAdmin  = "admin"
+	RoleEditor = "editor"
+	RoleViewer = "viewer"
+)
+
+// User represents a person that can log in to FlowCraft
+type User struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	Email          string     `json:"email" gorm:"uniqueIndex"`
+	Name           string     `json:"name"`
+	Role           string     `json:"role" gorm:"default:'viewer'"` // admin, editor, viewer
+	OrganizationID uint       `json:"organization_id" gorm:"index"`
+	AuthProvider   string     `json:"auth_provider"` // local, oidc, ldap
+	ExternalID     string     `json:"external_id" gorm:"index"`
+	PasswordHash   string     `json:"-"`
+	IsActive       bool       `json:"is_active" gorm:"default:true"`
+	LastLoginAt    *time.Time `json:"last_login_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// Session represents a login of a user. Revoking a session invalidates all of its tokens.
+type Session struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	UserAgent  string     `json:"user_agent"`
+	IPAddress  string     `json:"ip_address"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// RefreshToken is a single-use token exchanging into a new access/refresh token pair.
+// Only the SHA-256 hash of the token is stored.
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	SessionID uint       `json:"session_id" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+
+	// Relationships
+	Session Session `json:"-" gorm:"foreignKey:SessionID"`
+}
+
+// CalendarToken authenticates the calendar feed of a user in calendar apps, which cannot send
+// access tokens. Only the SHA-256 hash of the token is stored.
+type CalendarToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `json:"user_id" gorm:"uniqueIndex"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	// Relationships
+	User User `json:"-" gorm:"foreignKey:UserID"`
+}
+
+// AuthToken is a short-lived access token issued for a session. Only the SHA-256 hash of the token is stored.
+type AuthToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	SessionID  uint       `json:"session_id" gorm:"index"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+
+	// Relationships
+	User    User    `json:"-" gorm:"foreignKey:UserID"`
+	Session Session `json:"-" gorm:"foreignKey:SessionID"`
+}
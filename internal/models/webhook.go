@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// WebhookDelivery is a raw request received by a webhook trigger, kept for inspection and replay
+type WebhookDelivery struct {
+	ID                  uint      `gorm:"primaryKey" json:"id"`
+	TriggerID           uint      `json:"trigger_id" gorm:"index"`
+	Method              string    `json:"method"`
+	Query               string    `json:"query"`
+	Headers             string    `json:"headers" gorm:"type:jsonb;default:'{}'"`
+	ContentType         string    `json:"content_type"`
+	Body                []byte    `json:"body"` // raw request body, base64 encoded in JSON
+	BodySize            int64     `json:"body_size"`
+	Status              string    `json:"status"` // accepted, dropped, duplicate, rejected, failed
+	ErrorMessage        string    `json:"error_message"`
+	WorkflowExecutionID *uint     `json:"workflow_execution_id"`
+	ReplayOfID          *uint     `json:"replay_of_id"` // delivery this one replays
+	ReceivedAt          time.Time `json:"received_at" gorm:"index"`
+}
@@ -8,19 +8,62 @@ import (
 
 // Workflow represents an automation workflow
 type Workflow struct {
-	ID           uint           `gorm:"primaryKey" json:"id"`
-	Name         string         `json:"name"`
-	Description  string         `json:"description"`
-	CreatedBy    uint           `json:"created_by"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	IsActive     bool           `json:"is_active" gorm:"default:true"`
-	WorkflowData string         `json:"workflow_data" gorm:"type:jsonb;default:'{}'"`
-	DeletedAt    gorm.DeletedAt `gorm:"index" json:"-"`
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	Name           string         `json:"name"`
+	Description    string         `json:"description"`
+	CreatedBy      uint           `json:"created_by"`
+	OrganizationID uint           `json:"organization_id" gorm:"index"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	IsActive       bool           `json:"is_active" gorm:"default:true"`
+	WorkflowData   string         `json:"workflow_data" gorm:"type:jsonb;default:'{}'"`
+	CaptureMode    string         `json:"capture_mode" gorm:"default:'full'"` // full, metadata, errors, sample, tail
+	SampleRate     int            `json:"sample_rate" gorm:"default:0"`       // capture mode sample: keep payloads of 1 in N executions
+	Tags           string         `json:"tags"`                               // comma separated labels, e.g. for the scope of alert rules
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Capture mode tail keeps the payloads of slow executions: those taking longer than
+	// CaptureSlowAfter, or slower than the workflow's typical duration by CaptureSlowScore
+	// (default 2) standard deviations once it was learned from enough executions
+	CaptureSlowAfter string  `json:"capture_slow_after"`
+	CaptureSlowScore float64 `json:"capture_slow_score"`
+
+	// Published versions are immutable copies of a workflow, numbered per workflow
+	ParentID *uint `json:"parent_id,omitempty" gorm:"index"`
+	Version  int   `json:"version,omitempty"`
+	// ChangeNote describes the changes of a published version for reviewers
+	ChangeNote  string `json:"change_note,omitempty"`
+	PublishedBy *uint  `json:"published_by,omitempty"`
+	// NodeTypeVersions pins the versions of the node types used by a published version, by node
+	// type key; executions on workers with other versions are flagged with a warning
+	NodeTypeVersions string `json:"node_type_versions,omitempty" gorm:"type:jsonb;default:'{}'"`
+
+	// Rollout of published versions: executions started by triggers run the live version,
+	// CanaryPercent of them the canary version. Without a live version they run the workflow itself.
+	LiveVersionID   *uint `json:"live_version_id"`
+	CanaryVersionID *uint `json:"canary_version_id"`
+	CanaryPercent   int   `json:"canary_percent"`
+
+	// Service level: executions taking longer than SLAMaxDuration, and a failure rate above
+	// SLAMaxFailureRate percent over SLAWindow (default 24h), are recorded as SLA breaches.
+	// Breaches are sent to SLAAlertChannel (email, slack, webhook) at SLAAlertTarget and start
+	// the SLAEscalationWorkflowID with the breach as input.
+	SLAMaxDuration          string  `json:"sla_max_duration"`
+	SLAMaxFailureRate       float64 `json:"sla_max_failure_rate"`
+	SLAWindow               string  `json:"sla_window"`
+	SLAAlertChannel         string  `json:"sla_alert_channel"`
+	SLAAlertTarget          string  `json:"sla_alert_target"`
+	SLAEscalationWorkflowID *uint   `json:"sla_escalation_workflow_id"`
+
+	// Executions failing because a node gave up on a rate limited or transient error are retried
+	// as new executions up to AutoRetryMax times, each AutoRetryDelay (default 1m) after the failure
+	AutoRetryMax   int    `json:"auto_retry_max"`
+	AutoRetryDelay string `json:"auto_retry_delay"`
 
 	// Relationships
 	Nodes       []Node       `json:"nodes" gorm:"foreignKey:WorkflowID"`
 	Connections []Connection `json:"connections" gorm:"foreignKey:WorkflowID"`
+	Groups      []NodeGroup  `json:"groups" gorm:"foreignKey:WorkflowID"`
 }
 
 // Node represents a single step in the workflow
@@ -32,6 +75,55 @@ type Node struct {
 	PositionY  float64 `json:"position_y"`
 	Name       string  `json:"name"`
 	Config     string  `json:"config" gorm:"type:jsonb"`
+
+	// CompensationNodeID references the node undoing this node's effects if a later node fails
+	CompensationNodeID *uint `json:"compensation_node_id"`
+
+	// GroupID references the group the node belongs to
+	GroupID *uint `json:"group_id" gorm:"index"`
+
+	// Disabled nodes are bypassed without deleting them: in DisabledMode "passthrough" (default)
+	// they forward their input as output, in "skip" they are skipped along with the nodes only
+	// reachable through them
+	Disabled     bool   `json:"disabled"`
+	DisabledMode string `json:"disabled_mode"`
+
+	// Artifacts keep outputs of the node as named files of its executions, e.g. reports: a JSON
+	// object mapping artifact names to the dotted path of the output field, "" for the whole output
+	Artifacts string `json:"artifacts" gorm:"type:jsonb;default:'{}'"`
+}
+
+// Modes of disabled nodes
+const (
+	DisabledPassthrough = "passthrough"
+	DisabledSkip        = "skip"
+)
+
+// NodeGroup groups nodes of a workflow on the canvas. The nodes of a disabled group are skipped
+// by the engine as a unit, like nodes none of whose inputs were taken.
+type NodeGroup struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	WorkflowID uint      `json:"workflow_id" gorm:"index"`
+	Name       string    `json:"name"`
+	Color      string    `json:"color"`
+	Disabled   bool      `json:"disabled"`  // the nodes of the group are skipped
+	Collapsed  bool      `json:"collapsed"` // the editor shows the group as a single box
+	PositionX  float64   `json:"position_x"`
+	PositionY  float64   `json:"position_y"`
+	Width      float64   `json:"width"`
+	Height     float64   `json:"height"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// NodeTypeAnnotation is the node type of sticky notes documenting sections of a workflow on the
+// canvas. Annotations have no executor, cannot be connected and are skipped by the engine; their
+// config holds the note's "content" (Markdown) and "color".
+const NodeTypeAnnotation = "annotation"
+
+// IsAnnotation reports whether the node is an annotation (sticky note)
+func (n Node) IsAnnotation() bool {
+	return n.NodeType == NodeTypeAnnotation
 }
 
 // Connection represents a connection between two nodes
@@ -44,12 +136,53 @@ type Connection struct {
 	TargetHandle string `json:"target_handle" gorm:"default:'input'"`
 }
 
+// RootID returns the ID of the workflow a published version belongs to, or the workflow's own ID
+func (w Workflow) RootID() uint {
+	if w.ParentID != nil {
+		return *w.ParentID
+	}
+	return w.ID
+}
+
+// RolloutRequest represents the input data for changing the rollout of a workflow's versions
+type RolloutRequest struct {
+	LiveVersionID   *uint `json:"live_version_id"`
+	CanaryVersionID *uint `json:"canary_version_id"`
+	CanaryPercent   int   `json:"canary_percent"`
+}
+
+// VersionStats summarizes the executions of a published version
+type VersionStats struct {
+	VersionID     uint    `json:"version_id"`
+	Version       int     `json:"version"`
+	Role          string  `json:"role"` // live, canary
+	Executions    int64   `json:"executions"`
+	Completed     int64   `json:"completed"`
+	Failed        int64   `json:"failed"`
+	ErrorRate     float64 `json:"error_rate"`
+	AvgDurationMs float64 `json:"avg_duration_ms"`
+}
+
 // WorkflowRequest represents the input data for workflow creation/update
 type WorkflowRequest struct {
 	Name        string `json:"name" binding:"required"`
 	Description string `json:"description"`
+	CaptureMode string `json:"capture_mode"` // full, metadata, errors, sample, tail
+	SampleRate  int    `json:"sample_rate"`
+	// CaptureSlowAfter and CaptureSlowScore define slow executions for capture mode tail
+	CaptureSlowAfter string  `json:"capture_slow_after"`
+	CaptureSlowScore float64 `json:"capture_slow_score"`
 }
 
+// Capture modes controlling which payloads of an execution are kept once it finished
+const (
+	CaptureFull     = "full"     // keep all payloads
+	CaptureMetadata = "metadata" // keep status, timings and sizes only
+	CaptureErrors   = "errors"   // keep payloads of failed executions only
+	CaptureSample   = "sample"   // keep payloads of failed executions and 1 in SampleRate others
+	CaptureTail     = "tail"     // keep payloads of failed, slow and 1 in SampleRate other executions, summaries of the rest
+)
+
 // Point represents an x,y coordinate for a node
 type Point struct {
 	X float64 `json:"x"`
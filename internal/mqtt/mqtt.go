@@ -0,0 +1,446 @@
+// Package mqtt is a small MQTT 3.1.1 client subscribing to topics and publishing messages with
+// QoS 0, 1 and 2, over TCP (mqtt://) or TLS (mqtts://)
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultKeepAlive is the keep alive of connections without one configured
+const defaultKeepAlive = 60 * time.Second
+
+// ErrClosed is returned for requests on closed connections
+var ErrClosed = errors.New("mqtt: connection closed")
+
+// Options configure a connection to a broker
+type Options struct {
+	// URL of the broker, e.g. mqtt://broker:1883 or mqtts://broker:8883
+	URL      string
+	Username string
+	Password string
+	// ClientID identifies the session at the broker
+	ClientID string
+	// CleanSession discards the subscriptions and undelivered messages of earlier connections
+	// with the same client ID
+	CleanSession bool
+	// KeepAlive is the interval of pings keeping the connection open, 60s by default
+	KeepAlive time.Duration
+	// Handler receives the messages of the subscriptions, one at a time. QoS 1 and 2 messages
+	// are acknowledged once it returns nil; if it returns an error, the connection is closed
+	// without acknowledging the message, so the broker delivers it again after a reconnect to
+	// the same session.
+	Handler func(Message) error
+}
+
+// Message is a message published to a topic
+type Message struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+}
+
+// Subscription is a topic filter, which may contain the wildcards + and #, with the maximum QoS
+// of the messages delivered for it
+type Subscription struct {
+	Topic string
+	QoS   byte
+}
+
+// Client is a connection to a broker
+type Client struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	handler   func(Message) error
+	keepAlive time.Duration
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  uint16
+	pending map[uint16]chan packet
+	// received are the QoS 2 messages handled whose release the broker did not send yet
+	received map[uint16]bool
+
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// Dial connects to the broker of the options
+func Dial(ctx context.Context, opts Options) (*Client, error) {
+	address, secure, err := parseURL(opts.URL)
+	if err != nil {
+		return nil, err
+	}
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = defaultKeepAlive
+	}
+	if opts.ClientID == "" && !opts.CleanSession {
+		return nil, errors.New("mqtt: persistent sessions need a client ID")
+	}
+
+	dialer := &net.Dialer{}
+	var conn net.Conn
+	if secure {
+		host, _, _ := net.SplitHostPort(address)
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: host}}).DialContext(ctx, "tcp", address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		conn:      conn,
+		reader:    bufio.NewReader(conn),
+		handler:   opts.Handler,
+		keepAlive: opts.KeepAlive,
+		pending:   map[uint16]chan packet{},
+		received:  map[uint16]bool{},
+		done:      make(chan struct{}),
+	}
+	if err := c.connect(ctx, opts); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go c.readLoop()
+	go c.pingLoop()
+	return c, nil
+}
+
+// ValidateURL checks the URL of a broker
+func ValidateURL(raw string) error {
+	_, _, err := parseURL(raw)
+	return err
+}
+
+// parseURL returns the address of a broker URL and whether it uses TLS
+func parseURL(raw string) (string, bool, error) {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" {
+		return "", false, fmt.Errorf("mqtt: invalid broker URL %q", raw)
+	}
+	var secure bool
+	var port string
+	switch strings.ToLower(parsed.Scheme) {
+	case "mqtt", "tcp":
+		port = "1883"
+	case "mqtts", "ssl", "tls":
+		secure, port = true, "8883"
+	default:
+		return "", false, fmt.Errorf("mqtt: unsupported scheme %q, expected mqtt or mqtts", parsed.Scheme)
+	}
+	if parsed.Port() != "" {
+		port = parsed.Port()
+	}
+	return net.JoinHostPort(parsed.Hostname(), port), secure, nil
+}
+
+// connect sends the CONNECT packet and waits for the broker to accept it
+func (c *Client) connect(ctx context.Context, opts Options) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(30 * time.Second)
+	}
+	c.conn.SetDeadline(deadline)
+	defer c.conn.SetDeadline(time.Time{})
+
+	if _, err := c.conn.Write(connectPacket(opts).encode()); err != nil {
+		return err
+	}
+	ack, err := readPacket(c.reader)
+	if err != nil {
+		return err
+	}
+	if ack.kind != packetConnack || len(ack.body) < 2 {
+		return errors.New("mqtt: expected CONNACK")
+	}
+	if ack.body[1] != 0 {
+		return &ConnectError{Code: ack.body[1]}
+	}
+	return nil
+}
+
+// Subscribe subscribes to topic filters. It fails if the broker rejects any of them.
+func (c *Client) Subscribe(ctx context.Context, subscriptions ...Subscription) error {
+	id, acks := c.reserveID()
+	defer c.releaseID(id)
+
+	body := []byte{byte(id >> 8), byte(id)}
+	for _, subscription := range subscriptions {
+		if subscription.QoS > 2 {
+			return fmt.Errorf("mqtt: invalid QoS %d", subscription.QoS)
+		}
+		body = appendString(body, subscription.Topic)
+		body = append(body, subscription.QoS)
+	}
+	if err := c.write(packet{kind: packetSubscribe, flags: 0x02, body: body}); err != nil {
+		return err
+	}
+
+	ack, err := c.await(ctx, acks)
+	if err != nil {
+		return err
+	}
+	if ack.kind != packetSuback || len(ack.body) != 2+len(subscriptions) {
+		return errors.New("mqtt: expected SUBACK")
+	}
+	for i, code := range ack.body[2:] {
+		if code == 0x80 {
+			return fmt.Errorf("mqtt: subscription to %s rejected", subscriptions[i].Topic)
+		}
+	}
+	return nil
+}
+
+// Publish publishes a message and, for QoS 1 and 2, waits until the broker acknowledged it
+func (c *Client) Publish(ctx context.Context, message Message) error {
+	if message.QoS > 2 {
+		return fmt.Errorf("mqtt: invalid QoS %d", message.QoS)
+	}
+	if err := ValidateTopic(message.Topic); err != nil {
+		return err
+	}
+	if len(message.Topic)+len(message.Payload)+4 > maxRemainingBytes {
+		return errors.New("mqtt: message too large")
+	}
+	if message.QoS == 0 {
+		return c.write(publishPacket(message, 0))
+	}
+
+	id, acks := c.reserveID()
+	defer c.releaseID(id)
+	if err := c.write(publishPacket(message, id)); err != nil {
+		return err
+	}
+	ack, err := c.await(ctx, acks)
+	if err != nil {
+		return err
+	}
+	if message.QoS == 1 {
+		if ack.kind != packetPuback {
+			return errors.New("mqtt: expected PUBACK")
+		}
+		return nil
+	}
+
+	if ack.kind != packetPubrec {
+		return errors.New("mqtt: expected PUBREC")
+	}
+	if err := c.write(ackPacket(packetPubrel, id)); err != nil {
+		return err
+	}
+	if ack, err = c.await(ctx, acks); err != nil {
+		return err
+	}
+	if ack.kind != packetPubcomp {
+		return errors.New("mqtt: expected PUBCOMP")
+	}
+	return nil
+}
+
+// ValidateTopic checks the topic of a message, which must not contain wildcards
+func ValidateTopic(topic string) error {
+	if topic == "" || strings.ContainsAny(topic, "+#") {
+		return fmt.Errorf("mqtt: invalid topic %q, topics of messages must not be empty or contain wildcards", topic)
+	}
+	return nil
+}
+
+// Done is closed when the connection is closed
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err returns why the connection was closed, nil if it is open or was closed with Close
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Close disconnects from the broker
+func (c *Client) Close() error {
+	c.write(packet{kind: packetDisconnect})
+	c.shutdown(nil)
+	return nil
+}
+
+// shutdown closes the connection, recording why
+func (c *Client) shutdown(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		c.conn.Close()
+		close(c.done)
+	})
+}
+
+// write sends a packet
+func (c *Client) write(p packet) error {
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(c.keepAlive))
+	_, err := c.conn.Write(p.encode())
+	if err != nil {
+		c.shutdown(err)
+	}
+	return err
+}
+
+// reserveID returns an unused packet identifier with the channel receiving its acknowledgements
+func (c *Client) reserveID() (uint16, chan packet) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for {
+		c.nextID++
+		if c.nextID == 0 {
+			c.nextID = 1
+		}
+		if _, used := c.pending[c.nextID]; !used {
+			acks := make(chan packet, 2)
+			c.pending[c.nextID] = acks
+			return c.nextID, acks
+		}
+	}
+}
+
+// releaseID frees a packet identifier
+func (c *Client) releaseID(id uint16) {
+	c.mu.Lock()
+	delete(c.pending, id)
+	c.mu.Unlock()
+}
+
+// await waits for the next acknowledgement of a packet
+func (c *Client) await(ctx context.Context, acks chan packet) (packet, error) {
+	select {
+	case ack := <-acks:
+		return ack, nil
+	case <-c.done:
+		if c.err != nil {
+			return packet{}, c.err
+		}
+		return packet{}, ErrClosed
+	case <-ctx.Done():
+		return packet{}, ctx.Err()
+	}
+}
+
+// readLoop reads the packets of the broker until the connection is closed
+func (c *Client) readLoop() {
+	for {
+		// The broker answers pings within the keep alive
+		c.conn.SetReadDeadline(time.Now().Add(c.keepAlive * 3 / 2))
+		p, err := readPacket(c.reader)
+		if err != nil {
+			select {
+			case <-c.done:
+			default:
+				c.shutdown(err)
+			}
+			return
+		}
+		if err := c.handle(p); err != nil {
+			c.shutdown(err)
+			return
+		}
+	}
+}
+
+// handle processes a packet received from the broker
+func (c *Client) handle(p packet) error {
+	switch p.kind {
+	case packetPublish:
+		return c.receive(p)
+	case packetPubrel:
+		id, err := packetID(p.body)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		delete(c.received, id)
+		c.mu.Unlock()
+		return c.write(ackPacket(packetPubcomp, id))
+	case packetPuback, packetPubrec, packetPubcomp, packetSuback:
+		id, err := packetID(p.body)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		acks, ok := c.pending[id]
+		c.mu.Unlock()
+		if ok {
+			select {
+			case acks <- p:
+			default:
+			}
+		}
+	case packetPingresp:
+	default:
+		return fmt.Errorf("mqtt: unexpected packet type %d", p.kind)
+	}
+	return nil
+}
+
+// receive passes a received message to the handler and acknowledges it
+func (c *Client) receive(p packet) error {
+	message, id, err := parsePublish(p)
+	if err != nil {
+		return err
+	}
+
+	// QoS 2 messages are handed over once, even if the broker sends them again before
+	// releasing them
+	c.mu.Lock()
+	duplicate := message.QoS == 2 && c.received[id]
+	c.mu.Unlock()
+	if !duplicate && c.handler != nil {
+		if err := c.handler(message); err != nil {
+			return fmt.Errorf("mqtt: message on %s not handled: %v", message.Topic, err)
+		}
+	}
+
+	switch message.QoS {
+	case 1:
+		return c.write(ackPacket(packetPuback, id))
+	case 2:
+		c.mu.Lock()
+		c.received[id] = true
+		c.mu.Unlock()
+		return c.write(ackPacket(packetPubrec, id))
+	}
+	return nil
+}
+
+// pingLoop keeps the connection open while no other packets are sent
+func (c *Client) pingLoop() {
+	ticker := time.NewTicker(c.keepAlive * 3 / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.write(packet{kind: packetPingreq})
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeBroker accepts a single connection and runs serve with it. It returns the broker URL.
+func fakeBroker(t *testing.T, serve func(conn net.Conn, r *bufio.Reader)) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		serve(conn, bufio.NewReader(conn))
+	}()
+	return "mqtt://" + listener.Addr().String()
+}
+
+// expectPacket reads the next packet from the client, failing the test if it has another type
+func expectPacket(t *testing.T, r *bufio.Reader, kind byte) packet {
+	t.Helper()
+	p, err := readPacket(r)
+	if err != nil {
+		t.Errorf("reading packet %d: %v", kind, err)
+		return packet{}
+	}
+	if p.kind != kind {
+		t.Errorf("got packet type %d, want %d", p.kind, kind)
+	}
+	return p
+}
+
+// accept answers the CONNECT packet of the client with a CONNACK of the return code
+func accept(t *testing.T, conn net.Conn, r *bufio.Reader, code byte) {
+	t.Helper()
+	expectPacket(t, r, packetConnect)
+	conn.Write(packet{kind: packetConnack, body: []byte{0x00, code}}.encode())
+}
+
+func dialBroker(t *testing.T, url string, handler func(Message) error) (*Client, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return Dial(ctx, Options{URL: url, ClientID: "test", CleanSession: true, Handler: handler})
+}
+
+func TestDialRefused(t *testing.T) {
+	tests := []struct {
+		code byte
+		auth bool
+	}{
+		{2, false},
+		{4, true},
+		{5, true},
+	}
+	for _, tt := range tests {
+		url := fakeBroker(t, func(conn net.Conn, r *bufio.Reader) {
+			accept(t, conn, r, tt.code)
+		})
+		_, err := dialBroker(t, url, nil)
+		var refused *ConnectError
+		if !errors.As(err, &refused) || refused.Code != tt.code {
+			t.Errorf("code %d: Dial() error = %v, want a ConnectError", tt.code, err)
+		}
+		if got := IsAuthError(err); got != tt.auth {
+			t.Errorf("code %d: IsAuthError() = %v, want %v", tt.code, got, tt.auth)
+		}
+	}
+}
+
+func TestSubscribeRejected(t *testing.T) {
+	url := fakeBroker(t, func(conn net.Conn, r *bufio.Reader) {
+		accept(t, conn, r, 0)
+		subscribe := expectPacket(t, r, packetSubscribe)
+		if subscribe.flags != 0x02 || len(subscribe.body) < 2 {
+			t.Errorf("SUBSCRIBE flags = %x, body = % x", subscribe.flags, subscribe.body)
+			return
+		}
+		// The first filter is granted with QoS 1, the second one rejected
+		conn.Write(packet{kind: packetSuback, body: []byte{subscribe.body[0], subscribe.body[1], 0x01, 0x80}}.encode())
+		r.ReadByte()
+	})
+	client, err := dialBroker(t, url, nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = client.Subscribe(ctx, Subscription{Topic: "sensors/+", QoS: 1}, Subscription{Topic: "$SYS/#", QoS: 1})
+	if err == nil || !strings.Contains(err.Error(), "$SYS/#") {
+		t.Errorf("Subscribe() error = %v, want the rejected filter", err)
+	}
+}
+
+func TestPublishQoS1(t *testing.T) {
+	received := make(chan Message, 1)
+	url := fakeBroker(t, func(conn net.Conn, r *bufio.Reader) {
+		accept(t, conn, r, 0)
+		p := expectPacket(t, r, packetPublish)
+		message, id, err := parsePublish(p)
+		if err != nil {
+			t.Errorf("parsePublish() error = %v", err)
+			return
+		}
+		received <- message
+		conn.Write(ackPacket(packetPuback, id).encode())
+		r.ReadByte()
+	})
+	client, err := dialBroker(t, url, nil)
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := client.Publish(ctx, Message{Topic: "orders", Payload: []byte("42"), QoS: 1}); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	message := <-received
+	if message.Topic != "orders" || string(message.Payload) != "42" || message.QoS != 1 {
+		t.Errorf("broker received %+v", message)
+	}
+}
+
+func TestReceiveQoS1(t *testing.T) {
+	acked := make(chan uint16, 1)
+	url := fakeBroker(t, func(conn net.Conn, r *bufio.Reader) {
+		accept(t, conn, r, 0)
+		conn.Write(publishPacket(Message{Topic: "sensors/1", Payload: []byte("21.5"), QoS: 1}, 7).encode())
+		ack := expectPacket(t, r, packetPuback)
+		id, err := packetID(ack.body)
+		if err != nil {
+			t.Errorf("PUBACK: %v", err)
+		}
+		acked <- id
+		r.ReadByte()
+	})
+	handled := make(chan Message, 1)
+	client, err := dialBroker(t, url, func(message Message) error {
+		handled <- message
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer client.Close()
+
+	message := <-handled
+	if message.Topic != "sensors/1" || string(message.Payload) != "21.5" {
+		t.Errorf("handler received %+v", message)
+	}
+	if id := <-acked; id != 7 {
+		t.Errorf("PUBACK packet identifier = %d, want 7", id)
+	}
+}
+
+func TestReceiveQoS1HandlerError(t *testing.T) {
+	next := make(chan packet, 1)
+	url := fakeBroker(t, func(conn net.Conn, r *bufio.Reader) {
+		accept(t, conn, r, 0)
+		conn.Write(publishPacket(Message{Topic: "sensors/1", Payload: []byte("bad"), QoS: 1}, 9).encode())
+		// The client closes the connection instead of acknowledging the message
+		p, err := readPacket(r)
+		if err == nil {
+			next <- p
+		}
+		close(next)
+	})
+	client, err := dialBroker(t, url, func(message Message) error {
+		return errors.New("not handled")
+	})
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	defer client.Close()
+
+	select {
+	case <-client.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not closed after the handler failed")
+	}
+	if err := client.Err(); err == nil || !strings.Contains(err.Error(), "not handled") {
+		t.Errorf("Err() = %v, want the handler error", err)
+	}
+	if p, ok := <-next; ok {
+		t.Errorf("client sent packet type %d, want no acknowledgement", p.kind)
+	}
+}
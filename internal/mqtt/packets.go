@@ -0,0 +1,214 @@
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Control packet types of MQTT 3.1.1
+const (
+	packetConnect     = 1
+	packetConnack     = 2
+	packetPublish     = 3
+	packetPuback      = 4
+	packetPubrec      = 5
+	packetPubrel      = 6
+	packetPubcomp     = 7
+	packetSubscribe   = 8
+	packetSuback      = 9
+	packetPingreq     = 12
+	packetPingresp    = 13
+	packetDisconnect  = 14
+	protocolLevel311  = 4
+	maxRemainingBytes = 268435455
+)
+
+// packet is a control packet with its fixed header split into type and flags
+type packet struct {
+	kind  byte
+	flags byte
+	body  []byte
+}
+
+// encode returns the packet with its fixed header
+func (p packet) encode() []byte {
+	data := appendRemainingLength([]byte{p.kind<<4 | p.flags}, len(p.body))
+	return append(data, p.body...)
+}
+
+// appendRemainingLength appends the length of a packet body as a variable length integer of
+// 7 bits per byte, least significant first
+func appendRemainingLength(data []byte, length int) []byte {
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		data = append(data, digit)
+		if length == 0 {
+			return data
+		}
+	}
+}
+
+// readPacket reads the next control packet
+func readPacket(r *bufio.Reader) (packet, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return packet{}, err
+	}
+	length, err := readRemainingLength(r)
+	if err != nil {
+		return packet{}, err
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return packet{}, err
+	}
+	return packet{kind: header >> 4, flags: header & 0x0f, body: body}, nil
+}
+
+// readRemainingLength reads the length of a packet body, at most 4 bytes
+func readRemainingLength(r *bufio.Reader) (int, error) {
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length += int(digit&0x7f) * multiplier
+		if digit&0x80 == 0 {
+			return length, nil
+		}
+		if i == 3 {
+			return 0, errors.New("mqtt: malformed remaining length")
+		}
+		multiplier *= 128
+	}
+}
+
+// appendString appends a length prefixed UTF-8 string
+func appendString(data []byte, value string) []byte {
+	data = binary.BigEndian.AppendUint16(data, uint16(len(value)))
+	return append(data, value...)
+}
+
+// readString reads a length prefixed string, returning the rest of the data
+func readString(data []byte) (string, []byte, error) {
+	if len(data) < 2 {
+		return "", nil, errors.New("mqtt: malformed string")
+	}
+	length := int(binary.BigEndian.Uint16(data))
+	if len(data) < 2+length {
+		return "", nil, errors.New("mqtt: malformed string")
+	}
+	return string(data[2 : 2+length]), data[2+length:], nil
+}
+
+// packetID reads the packet identifier of acknowledgements
+func packetID(data []byte) (uint16, error) {
+	if len(data) < 2 {
+		return 0, errors.New("mqtt: missing packet identifier")
+	}
+	return binary.BigEndian.Uint16(data), nil
+}
+
+// ackPacket returns an acknowledgement carrying only a packet identifier
+func ackPacket(kind byte, id uint16) packet {
+	flags := byte(0)
+	if kind == packetPubrel {
+		flags = 0x02
+	}
+	return packet{kind: kind, flags: flags, body: binary.BigEndian.AppendUint16(nil, id)}
+}
+
+// connectPacket returns the CONNECT packet of the options
+func connectPacket(opts Options) packet {
+	flags := byte(0)
+	if opts.CleanSession {
+		flags |= 0x02
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		if opts.Password != "" {
+			flags |= 0x40
+		}
+	}
+	body := appendString(nil, "MQTT")
+	body = append(body, protocolLevel311, flags)
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive.Seconds()))
+	body = appendString(body, opts.ClientID)
+	if opts.Username != "" {
+		body = appendString(body, opts.Username)
+		if opts.Password != "" {
+			body = appendString(body, opts.Password)
+		}
+	}
+	return packet{kind: packetConnect, body: body}
+}
+
+// publishPacket returns the PUBLISH packet of a message
+func publishPacket(message Message, id uint16) packet {
+	flags := message.QoS << 1
+	if message.Retain {
+		flags |= 0x01
+	}
+	body := appendString(nil, message.Topic)
+	if message.QoS > 0 {
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	return packet{kind: packetPublish, flags: flags, body: append(body, message.Payload...)}
+}
+
+// parsePublish reads a received PUBLISH packet
+func parsePublish(p packet) (Message, uint16, error) {
+	message := Message{QoS: (p.flags >> 1) & 0x03, Retain: p.flags&0x01 != 0}
+	if message.QoS > 2 {
+		return message, 0, errors.New("mqtt: invalid QoS")
+	}
+	topic, rest, err := readString(p.body)
+	if err != nil {
+		return message, 0, err
+	}
+	message.Topic = topic
+	var id uint16
+	if message.QoS > 0 {
+		if id, err = packetID(rest); err != nil {
+			return message, 0, err
+		}
+		rest = rest[2:]
+	}
+	message.Payload = rest
+	return message, id, nil
+}
+
+// ConnectError is returned if the broker refuses a connection
+type ConnectError struct {
+	// Code is the return code of the CONNACK packet
+	Code byte
+}
+
+func (e *ConnectError) Error() string {
+	reasons := map[byte]string{
+		1: "unacceptable protocol version",
+		2: "client identifier rejected",
+		3: "server unavailable",
+		4: "bad user name or password",
+		5: "not authorized",
+	}
+	reason, ok := reasons[e.Code]
+	if !ok {
+		reason = fmt.Sprintf("return code %d", e.Code)
+	}
+	return "mqtt: connection refused: " + reason
+}
+
+// IsAuthError reports whether the broker refused the login of a connection
+func IsAuthError(err error) bool {
+	var refused *ConnectError
+	return errors.As(err, &refused) && (refused.Code == 4 || refused.Code == 5)
+}
@@ -0,0 +1,152 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestRemainingLength(t *testing.T) {
+	// Boundaries of the 1 to 4 byte encodings from the MQTT 3.1.1 specification
+	tests := []struct {
+		length  int
+		encoded []byte
+	}{
+		{0, []byte{0x00}},
+		{127, []byte{0x7f}},
+		{128, []byte{0x80, 0x01}},
+		{16383, []byte{0xff, 0x7f}},
+		{16384, []byte{0x80, 0x80, 0x01}},
+		{2097151, []byte{0xff, 0xff, 0x7f}},
+		{2097152, []byte{0x80, 0x80, 0x80, 0x01}},
+		{maxRemainingBytes, []byte{0xff, 0xff, 0xff, 0x7f}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.length), func(t *testing.T) {
+			if got := appendRemainingLength(nil, tt.length); !bytes.Equal(got, tt.encoded) {
+				t.Errorf("appendRemainingLength() = % x, want % x", got, tt.encoded)
+			}
+			got, err := readRemainingLength(bufio.NewReader(bytes.NewReader(tt.encoded)))
+			if err != nil {
+				t.Fatalf("readRemainingLength() error = %v", err)
+			}
+			if got != tt.length {
+				t.Errorf("readRemainingLength() = %d, want %d", got, tt.length)
+			}
+		})
+	}
+}
+
+func TestReadRemainingLengthMalformed(t *testing.T) {
+	_, err := readRemainingLength(bufio.NewReader(bytes.NewReader([]byte{0xff, 0xff, 0xff, 0xff, 0x01})))
+	if err == nil {
+		t.Error("readRemainingLength() of 5 bytes succeeded, want an error")
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	body := bytes.Repeat([]byte{0xab}, 300)
+	data := packet{kind: packetPublish, flags: 0x0b, body: body}.encode()
+	if !bytes.Equal(data[:3], []byte{0x3b, 0xac, 0x02}) {
+		t.Errorf("fixed header = % x, want 3b ac 02", data[:3])
+	}
+
+	p, err := readPacket(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatalf("readPacket() error = %v", err)
+	}
+	if p.kind != packetPublish || p.flags != 0x0b || !bytes.Equal(p.body, body) {
+		t.Errorf("readPacket() = kind %d, flags %x, %d bytes; want kind 3, flags b, 300 bytes", p.kind, p.flags, len(p.body))
+	}
+}
+
+func TestPublishRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		message Message
+		id      uint16
+	}{
+		{"qos 0", Message{Topic: "sensors/1", Payload: []byte("21.5")}, 0},
+		{"qos 1 retained", Message{Topic: "sensors/2", Payload: []byte(`{"t":1}`), QoS: 1, Retain: true}, 7},
+		{"qos 2 empty payload", Message{Topic: "sensors/3", Payload: []byte{}, QoS: 2}, 65535},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := readPacket(bufio.NewReader(bytes.NewReader(publishPacket(tt.message, tt.id).encode())))
+			if err != nil {
+				t.Fatalf("readPacket() error = %v", err)
+			}
+			message, id, err := parsePublish(p)
+			if err != nil {
+				t.Fatalf("parsePublish() error = %v", err)
+			}
+			if message.Topic != tt.message.Topic || !bytes.Equal(message.Payload, tt.message.Payload) ||
+				message.QoS != tt.message.QoS || message.Retain != tt.message.Retain {
+				t.Errorf("parsePublish() = %+v, want %+v", message, tt.message)
+			}
+			if id != tt.id {
+				t.Errorf("packet identifier = %d, want %d", id, tt.id)
+			}
+		})
+	}
+}
+
+func TestParsePublishMalformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		packet packet
+	}{
+		{"invalid qos", packet{kind: packetPublish, flags: 0x06, body: appendString(nil, "a")}},
+		{"truncated topic", packet{kind: packetPublish, body: []byte{0x00, 0x05, 'a'}}},
+		{"missing packet identifier", packet{kind: packetPublish, flags: 0x02, body: appendString(nil, "a")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := parsePublish(tt.packet); err == nil {
+				t.Error("parsePublish() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestConnectPacket(t *testing.T) {
+	p := connectPacket(Options{ClientID: "flowcraft", Username: "user", Password: "secret", CleanSession: true, KeepAlive: defaultKeepAlive})
+	want := []byte{
+		0x00, 0x04, 'M', 'Q', 'T', 'T', protocolLevel311,
+		0xc2,       // user name, password and clean session flags
+		0x00, 0x3c, // keep alive of 60s
+		0x00, 0x09, 'f', 'l', 'o', 'w', 'c', 'r', 'a', 'f', 't',
+		0x00, 0x04, 'u', 's', 'e', 'r',
+		0x00, 0x06, 's', 'e', 'c', 'r', 'e', 't',
+	}
+	if p.kind != packetConnect || !bytes.Equal(p.body, want) {
+		t.Errorf("connectPacket() = kind %d, % x; want kind 1, % x", p.kind, p.body, want)
+	}
+}
+
+func TestConnectError(t *testing.T) {
+	tests := []struct {
+		code    byte
+		message string
+		auth    bool
+	}{
+		{1, "mqtt: connection refused: unacceptable protocol version", false},
+		{2, "mqtt: connection refused: client identifier rejected", false},
+		{3, "mqtt: connection refused: server unavailable", false},
+		{4, "mqtt: connection refused: bad user name or password", true},
+		{5, "mqtt: connection refused: not authorized", true},
+		{9, "mqtt: connection refused: return code 9", false},
+	}
+	for _, tt := range tests {
+		err := fmt.Errorf("dial: %w", &ConnectError{Code: tt.code})
+		var refused *ConnectError
+		if !errors.As(err, &refused) || refused.Error() != tt.message {
+			t.Errorf("code %d: error = %v, want %q", tt.code, err, tt.message)
+		}
+		if got := IsAuthError(err); got != tt.auth {
+			t.Errorf("code %d: IsAuthError() = %v, want %v", tt.code, got, tt.auth)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+// Package notify delivers notifications to people via email and chat sinks
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// Message is a notification for one or more recipients
+type Message struct {
+	Subject string
+	Text    string
+	// Recipients are email addresses; chat sinks post to their configured channel instead
+	Recipients []string
+	// Link points to where the recipient can act on the notification
+	Link string
+}
+
+// Notifier delivers messages
+type Notifier interface {
+	Notify(ctx context.Context, msg Message) error
+}
+
+// defaultNotifier is used by Send
+var defaultNotifier Notifier = Multi{}
+
+// Configure sets the notifier used by Send
+func Configure(notifier Notifier) {
+	defaultNotifier = notifier
+}
+
+// Send delivers a message with the configured notifier
+func Send(ctx context.Context, msg Message) error {
+	return defaultNotifier.Notify(ctx, msg)
+}
+
+// FromEnv creates a notifier for all sinks configured in the environment:
+// email via SMTP_HOST and Slack via SLACK_WEBHOOK_URL
+func FromEnv() Notifier {
+	var notifiers Multi
+
+	if email := EmailFromEnv(); email != nil {
+		notifiers = append(notifiers, email)
+	}
+
+	if webhookURL := os.Getenv("SLACK_WEBHOOK_URL"); webhookURL != "" {
+		notifiers = append(notifiers, NewSlackNotifier(webhookURL))
+	}
+
+	return notifiers
+}
+
+// EmailFromEnv creates an email notifier for the SMTP server configured in the environment, nil
+// if SMTP_HOST is not set
+func EmailFromEnv() *EmailNotifier {
+	host := os.Getenv("SMTP_HOST")
+	if host == "" {
+		return nil
+	}
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	return &EmailNotifier{
+		Addr:     host + ":" + port,
+		Host:     host,
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+}
+
+// Multi delivers a message to several notifiers, collecting their errors
+type Multi []Notifier
+
+// Notify delivers the message to all notifiers
+func (m Multi) Notify(ctx context.Context, msg Message) error {
+	var errs []string
+	for _, notifier := range m {
+		if err := notifier.Notify(ctx, msg); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// EmailNotifier sends messages via SMTP
+type EmailNotifier struct {
+	Addr     string
+	Host     string
+	Username string
+	Password string
+	From     string
+}
+
+// Notify sends the message as plain text email to its recipients
+func (n *EmailNotifier) Notify(ctx context.Context, msg Message) error {
+	if len(msg.Recipients) == 0 {
+		return nil
+	}
+
+	body := msg.Text
+	if msg.Link != "" {
+		body += "\r\n\r\n" + msg.Link
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", n.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(msg.Recipients, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", sanitizeHeader(msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	buf.WriteString(body)
+
+	var auth smtp.Auth
+	if n.Username != "" {
+		auth = smtp.PlainAuth("", n.Username, n.Password, n.Host)
+	}
+
+	if err := smtp.SendMail(n.Addr, auth, n.From, msg.Recipients, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+	return nil
+}
+
+// SlackNotifier posts messages to a Slack incoming webhook
+type SlackNotifier struct {
+	WebhookURL string
+	client     *http.Client
+}
+
+// NewSlackNotifier creates a new SlackNotifier
+func NewSlackNotifier(webhookURL string) *SlackNotifier {
+	return &SlackNotifier{
+		WebhookURL: webhookURL,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Notify posts the message to the webhook's channel
+func (n *SlackNotifier) Notify(ctx context.Context, msg Message) error {
+	text := fmt.Sprintf("*%s*\n%s", msg.Subject, msg.Text)
+	if msg.Link != "" {
+		text += fmt.Sprintf("\n<%s|Open>", msg.Link)
+	}
+
+	payload, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post slack message: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("slack webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// sanitizeHeader strips line breaks from header values
+func sanitizeHeader(value string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(value)
+}
@@ -0,0 +1,431 @@
+// Package openapi generates declarative HTTP node types from OpenAPI 3 specifications
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/engine"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/ghodss/yaml"
+)
+
+// maxRefDepth bounds the resolution of chained and recursive $refs
+const maxRefDepth = 16
+
+// pathParamPattern matches path parameters like "{petId}"
+var pathParamPattern = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+// nonIdentifierPattern matches characters not used in generated keys and operation names
+var nonIdentifierPattern = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// Options controls how node types are generated from a specification
+type Options struct {
+	// Key of the generated node type, or the prefix of the keys if grouped by tag.
+	// Defaults to the specification's title.
+	Key string
+	// BaseURL overrides the first server of the specification
+	BaseURL string
+	// GroupByTag generates one node type per tag instead of one for the whole API
+	GroupByTag bool
+}
+
+// NodeTypes generates declarative HTTP node types from an OpenAPI 3 specification in JSON or YAML
+func NodeTypes(spec []byte, opts Options) ([]models.NodeType, error) {
+	data, err := yaml.YAMLToJSON(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid specification: %v", err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid specification: %v", err)
+	}
+
+	version, _ := doc["openapi"].(string)
+	if !strings.HasPrefix(version, "3.") {
+		return nil, fmt.Errorf("only OpenAPI 3 specifications are supported")
+	}
+
+	info := object(doc["info"])
+	title, _ := info["title"].(string)
+	description, _ := info["description"].(string)
+
+	key := opts.Key
+	if key == "" {
+		key = identifier(title, false)
+	}
+	if key == "" {
+		return nil, fmt.Errorf("a key is required for specifications without a title")
+	}
+
+	baseURL := opts.BaseURL
+	if baseURL == "" {
+		baseURL = serverURL(doc)
+	}
+	if baseURL == "" {
+		return nil, fmt.Errorf("the specification has no absolute server URL, a base URL is required")
+	}
+
+	d := &document{doc: doc}
+	auth := d.auth()
+
+	// Collect the operations per node type
+	groups := map[string]map[string]engine.HttpNodeOperation{}
+	paths := object(doc["paths"])
+	for _, path := range sortedKeys(paths) {
+		pathItem := d.resolve(paths[path])
+		for _, method := range []string{"get", "post", "put", "patch", "delete"} {
+			operation := d.resolve(pathItem[method])
+			if operation == nil {
+				continue
+			}
+
+			name, _ := operation["operationId"].(string)
+			name = identifier(name, true)
+			if name == "" {
+				name = identifier(method+" "+path, true)
+			}
+
+			group := ""
+			if opts.GroupByTag {
+				if tags, ok := operation["tags"].([]interface{}); ok && len(tags) > 0 {
+					group, _ = tags[0].(string)
+				}
+			}
+			if groups[group] == nil {
+				groups[group] = map[string]engine.HttpNodeOperation{}
+			}
+			groups[group][name] = d.operation(method, path, pathItem, operation)
+		}
+	}
+	if len(groups) == 0 {
+		return nil, fmt.Errorf("the specification has no operations")
+	}
+
+	var nodeTypes []models.NodeType
+	for _, group := range sortedKeys(groups) {
+		definition := engine.HttpNodeDefinition{
+			BaseURL:    baseURL,
+			Auth:       auth,
+			Operations: groups[group],
+		}
+		data, err := json.Marshal(definition)
+		if err != nil {
+			return nil, err
+		}
+
+		// Validate the definition as the node type handler would
+		parsed, err := engine.ParseHttpNodeDefinition(string(data))
+		if err != nil {
+			return nil, err
+		}
+
+		nodeType := models.NodeType{
+			Key:           key,
+			Name:          title,
+			Description:   description,
+			Icon:          "globe",
+			Category:      "Integrations",
+			ConfigSchema:  parsed.ConfigSchema(),
+			InputSchema:   `{}`,
+			OutputSchema:  `{}`,
+			ExecutorClass: engine.HttpDefinitionExecutorClass,
+			Definition:    string(data),
+		}
+		if group != "" {
+			nodeType.Key = key + "." + identifier(group, false)
+			nodeType.Name = strings.TrimSpace(title + " " + group)
+		}
+		if nodeType.Name == "" {
+			nodeType.Name = nodeType.Key
+		}
+		nodeTypes = append(nodeTypes, nodeType)
+	}
+
+	return nodeTypes, nil
+}
+
+// document resolves references within a specification
+type document struct {
+	doc map[string]interface{}
+}
+
+// resolve follows local $refs ("#/components/...") and returns the referenced object
+func (d *document) resolve(value interface{}) map[string]interface{} {
+	obj := object(value)
+	for depth := 0; obj != nil && depth < maxRefDepth; depth++ {
+		ref, ok := obj["$ref"].(string)
+		if !ok {
+			return obj
+		}
+		obj = object(d.pointer(ref))
+	}
+	if obj != nil && obj["$ref"] != nil {
+		return nil
+	}
+	return obj
+}
+
+// pointer looks up a local JSON pointer
+func (d *document) pointer(ref string) interface{} {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil
+	}
+
+	var current interface{} = d.doc
+	for _, part := range strings.Split(ref[2:], "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		current = object(current)[part]
+		if current == nil {
+			return nil
+		}
+	}
+	return current
+}
+
+// schema resolves a schema and its nested references, so config schemas are self-contained
+func (d *document) schema(value interface{}, depth int) map[string]interface{} {
+	obj := d.resolve(value)
+	if obj == nil || depth > maxRefDepth {
+		return map[string]interface{}{}
+	}
+
+	resolved := make(map[string]interface{}, len(obj))
+	for key, item := range obj {
+		switch key {
+		case "properties":
+			properties := map[string]interface{}{}
+			for name, property := range object(item) {
+				properties[name] = d.schema(property, depth+1)
+			}
+			resolved[key] = properties
+		case "items", "additionalProperties":
+			if _, isObject := item.(map[string]interface{}); isObject {
+				resolved[key] = d.schema(item, depth+1)
+			} else {
+				resolved[key] = item
+			}
+		case "allOf", "anyOf", "oneOf":
+			list, _ := item.([]interface{})
+			schemas := make([]interface{}, 0, len(list))
+			for _, entry := range list {
+				schemas = append(schemas, d.schema(entry, depth+1))
+			}
+			resolved[key] = schemas
+		default:
+			resolved[key] = item
+		}
+	}
+	return resolved
+}
+
+// operation converts an OpenAPI operation into an operation of a declarative node type
+func (d *document) operation(method, path string, pathItem, operation map[string]interface{}) engine.HttpNodeOperation {
+	result := engine.HttpNodeOperation{
+		Method: strings.ToUpper(method),
+		Path:   pathParamPattern.ReplaceAllString(path, "{{$1}}"),
+	}
+	result.Description, _ = operation["summary"].(string)
+	if result.Description == "" {
+		result.Description, _ = operation["description"].(string)
+	}
+
+	// Parameters of the path item apply to all its operations, unless the operation overrides them
+	seen := map[string]bool{}
+	var parameters []interface{}
+	if list, ok := operation["parameters"].([]interface{}); ok {
+		parameters = append(parameters, list...)
+	}
+	if list, ok := pathItem["parameters"].([]interface{}); ok {
+		parameters = append(parameters, list...)
+	}
+	for _, value := range parameters {
+		parameter := d.resolve(value)
+		name, _ := parameter["name"].(string)
+		in, _ := parameter["in"].(string)
+		if name == "" || seen[in+":"+name] {
+			continue
+		}
+		seen[in+":"+name] = true
+
+		switch in {
+		case "query":
+			if result.Query == nil {
+				result.Query = map[string]string{}
+			}
+			result.Query[name] = "{{" + name + "}}"
+		case "header":
+			if result.Headers == nil {
+				result.Headers = map[string]string{}
+			}
+			result.Headers[name] = "{{" + name + "}}"
+		case "path":
+		default:
+			// Cookie parameters are not supported
+			continue
+		}
+
+		required, _ := parameter["required"].(bool)
+		description, _ := parameter["description"].(string)
+		schema := d.schema(parameter["schema"], 0)
+		result.Parameters = append(result.Parameters, engine.HttpNodeParameter{
+			Name:        name,
+			Description: description,
+			Required:    required || in == "path",
+			Default:     schema["default"],
+			Schema:      schema,
+		})
+	}
+
+	// JSON request bodies: the properties of object bodies become parameters, other bodies are
+	// passed as a whole via the "body" parameter
+	requestBody := d.resolve(operation["requestBody"])
+	mediaType := object(object(requestBody["content"])["application/json"])
+	if mediaType == nil {
+		return result
+	}
+	bodyRequired, _ := requestBody["required"].(bool)
+	schema := d.schema(mediaType["schema"], 0)
+	properties := object(schema["properties"])
+	if len(properties) == 0 {
+		result.Body = "{{body}}"
+		result.Parameters = append(result.Parameters, engine.HttpNodeParameter{
+			Name:     "body",
+			Required: bodyRequired,
+			Schema:   schema,
+		})
+		return result
+	}
+
+	requiredProperties := map[string]bool{}
+	if list, ok := schema["required"].([]interface{}); ok {
+		for _, name := range list {
+			if str, ok := name.(string); ok {
+				requiredProperties[str] = true
+			}
+		}
+	}
+
+	body := map[string]interface{}{}
+	for _, name := range sortedKeys(properties) {
+		property := object(properties[name])
+		body[name] = "{{" + name + "}}"
+		if seen["path:"+name] || seen["query:"+name] || seen["header:"+name] {
+			continue
+		}
+		description, _ := property["description"].(string)
+		result.Parameters = append(result.Parameters, engine.HttpNodeParameter{
+			Name:        name,
+			Description: description,
+			Required:    bodyRequired && requiredProperties[name],
+			Schema:      property,
+		})
+	}
+	result.Body = body
+
+	return result
+}
+
+// auth derives the authentication of the node types from the first security requirement
+func (d *document) auth() engine.HttpNodeAuth {
+	schemes := object(object(d.doc["components"])["securitySchemes"])
+	requirements, _ := d.doc["security"].([]interface{})
+
+	var name string
+	for _, requirement := range requirements {
+		for _, key := range sortedKeys(object(requirement)) {
+			name = key
+			break
+		}
+		if name != "" {
+			break
+		}
+	}
+	// Without global requirements, fall back to the only scheme of the specification
+	if name == "" && len(schemes) == 1 {
+		for key := range schemes {
+			name = key
+		}
+	}
+
+	scheme := d.resolve(schemes[name])
+	schemeType, _ := scheme["type"].(string)
+	switch schemeType {
+	case "http":
+		httpScheme, _ := scheme["scheme"].(string)
+		switch strings.ToLower(httpScheme) {
+		case "basic":
+			return engine.HttpNodeAuth{Type: "basic"}
+		case "bearer":
+			return engine.HttpNodeAuth{Type: "bearer"}
+		}
+	case "apiKey":
+		in, _ := scheme["in"].(string)
+		keyName, _ := scheme["name"].(string)
+		if in == "header" || in == "query" {
+			return engine.HttpNodeAuth{Type: "api_key", In: in, Name: keyName}
+		}
+	case "oauth2", "openIdConnect":
+		// Access tokens are obtained outside of FlowCraft and sent as bearer tokens
+		return engine.HttpNodeAuth{Type: "bearer"}
+	}
+	return engine.HttpNodeAuth{Type: "none"}
+}
+
+// serverURL returns the URL of the first server, with its variables set to their defaults
+func serverURL(doc map[string]interface{}) string {
+	servers, _ := doc["servers"].([]interface{})
+	if len(servers) == 0 {
+		return ""
+	}
+	server := object(servers[0])
+	serverURL, _ := server["url"].(string)
+	variables := object(server["variables"])
+	serverURL = pathParamPattern.ReplaceAllStringFunc(serverURL, func(match string) string {
+		if value, ok := object(variables[match[1:len(match)-1]])["default"].(string); ok {
+			return value
+		}
+		return match
+	})
+
+	// Relative server URLs can't be resolved without the location of the specification
+	if parsed, err := neturl.Parse(serverURL); err != nil || !parsed.IsAbs() {
+		return ""
+	}
+	return serverURL
+}
+
+// identifier turns a name into a key ("Pet Store" -> "pet-store") or, with camel set, into an
+// operation name ("get /pets/{id}" -> "getPetsId")
+func identifier(name string, camel bool) string {
+	parts := strings.Fields(nonIdentifierPattern.ReplaceAllString(name, " "))
+	if !camel {
+		return strings.ToLower(strings.Join(parts, "-"))
+	}
+	for i, part := range parts {
+		if i > 0 {
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.Join(parts, "")
+}
+
+// object returns value as a JSON object, or nil if it isn't one
+func object(value interface{}) map[string]interface{} {
+	obj, _ := value.(map[string]interface{})
+	return obj
+}
+
+// sortedKeys returns the keys of a map in a stable order
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
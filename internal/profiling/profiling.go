@@ -0,0 +1,51 @@
+// Package profiling exposes the Go runtime profiles of the server and the workers for diagnosing
+// slow workflows in production
+package profiling
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Config controls whether the profiling endpoints of the server are available
+type Config struct {
+	Enabled bool
+}
+
+// ConfigFromEnv reads the profiling configuration from PPROF_ENABLED
+func ConfigFromEnv() Config {
+	enabled, _ := strconv.ParseBool(os.Getenv("PPROF_ENABLED"))
+	return Config{Enabled: enabled}
+}
+
+// Register adds the pprof endpoints to the group, e.g. /api/debug/pprof. The caller restricts
+// the group to admins.
+func Register(g *echo.Group) {
+	g.GET("", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
+	g.GET("/", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
+	g.GET("/cmdline", echo.WrapHandler(http.HandlerFunc(pprof.Cmdline)))
+	g.GET("/profile", echo.WrapHandler(http.HandlerFunc(pprof.Profile)))
+	g.GET("/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	g.POST("/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	g.GET("/trace", echo.WrapHandler(http.HandlerFunc(pprof.Trace)))
+	g.GET("/:name", func(c echo.Context) error {
+		pprof.Handler(c.Param("name")).ServeHTTP(c.Response(), c.Request())
+		return nil
+	})
+}
+
+// Handler returns a handler serving the pprof endpoints under /debug/pprof/, for processes
+// without an API such as the workers
+func Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
@@ -0,0 +1,248 @@
+package queue
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrTaskNotFound is returned if a task is no longer in the queue, e.g. because a worker took it
+var ErrTaskNotFound = errors.New("task not found in queue")
+
+// ErrNotAQueue is returned for Redis keys holding something else than a queue
+var ErrNotAQueue = errors.New("key is not a queue")
+
+// pausedKeyPrefix prefixes the keys marking paused queues
+const pausedKeyPrefix = "flowcraft:queue:paused:"
+
+// QueuedTask is a task waiting in a queue. Tasks have no identity of their own, so the ID is
+// derived from the stored message; identical messages share an ID.
+type QueuedTask struct {
+	ID       string          `json:"id"`
+	Position int64           `json:"position"`
+	TaskType string          `json:"task_type"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	Encoding string          `json:"encoding,omitempty"`
+	Size     int             `json:"size"`
+}
+
+// QueueInfo describes the state of a queue
+type QueueInfo struct {
+	Name   string `json:"name"`
+	Length int64  `json:"length"`
+	Paused bool   `json:"paused"`
+	// Groups are the groups with tasks waiting in the fair sub-queues, which Length does not count
+	Groups []FairGroup `json:"groups"`
+}
+
+// taskID derives the ID of a stored task message
+func taskID(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:8])
+}
+
+// checkQueue makes sure the key is a queue, or does not exist
+func (q *QueueClient) checkQueue(ctx context.Context, queueName string) error {
+	keyType, err := q.redisClient.Type(ctx, queueName).Result()
+	if err != nil {
+		return err
+	}
+	if keyType != "list" && keyType != "none" {
+		return ErrNotAQueue
+	}
+	return nil
+}
+
+// Info returns the length of the queue, whether it is paused and the groups of its fair sub-queues
+func (q *QueueClient) Info(queueName string) (*QueueInfo, error) {
+	ctx := context.Background()
+	if err := q.checkQueue(ctx, queueName); err != nil {
+		return nil, err
+	}
+
+	length, err := q.redisClient.LLen(ctx, queueName).Result()
+	if err != nil {
+		return nil, err
+	}
+	paused, err := q.IsPaused(queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := q.FairGroups(queueName)
+	if err != nil {
+		return nil, err
+	}
+
+	return &QueueInfo{Name: queueName, Length: length, Paused: paused, Groups: groups}, nil
+}
+
+// Peek returns up to limit tasks of the queue starting at offset, without removing them.
+// Payloads of compressed or offloaded tasks are decoded.
+func (q *QueueClient) Peek(queueName string, offset, limit int64) ([]QueuedTask, error) {
+	ctx := context.Background()
+	if err := q.checkQueue(ctx, queueName); err != nil {
+		return nil, err
+	}
+
+	values, err := q.redisClient.LRange(ctx, queueName, offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]QueuedTask, 0, len(values))
+	for i, raw := range values {
+		queued := QueuedTask{
+			ID:       taskID(raw),
+			Position: offset + int64(i),
+			Size:     len(raw),
+		}
+
+		var task TaskMessage
+		if err := json.Unmarshal([]byte(raw), &task); err != nil {
+			queued.TaskType = "invalid"
+			tasks = append(tasks, queued)
+			continue
+		}
+		queued.TaskType = task.TaskType
+		queued.Encoding = task.Encoding
+		if err := decodePayload(&task); err == nil {
+			queued.Payload = task.Payload
+		}
+		tasks = append(tasks, queued)
+	}
+
+	return tasks, nil
+}
+
+// findTask returns the stored message of the task with the given ID
+func (q *QueueClient) findTask(ctx context.Context, queueName, id string) (string, error) {
+	const pageSize = 500
+	for start := int64(0); ; start += pageSize {
+		values, err := q.redisClient.LRange(ctx, queueName, start, start+pageSize-1).Result()
+		if err != nil {
+			return "", err
+		}
+		for _, raw := range values {
+			if taskID(raw) == id {
+				return raw, nil
+			}
+		}
+		if len(values) < pageSize {
+			return "", ErrTaskNotFound
+		}
+	}
+}
+
+// DeleteTask removes the task with the given ID from the queue
+func (q *QueueClient) DeleteTask(queueName, id string) error {
+	ctx := context.Background()
+	if err := q.checkQueue(ctx, queueName); err != nil {
+		return err
+	}
+
+	raw, err := q.findTask(ctx, queueName, id)
+	if err != nil {
+		return err
+	}
+	removed, err := q.redisClient.LRem(ctx, queueName, 1, raw).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrTaskNotFound
+	}
+	return nil
+}
+
+// MoveTask removes the task with the given ID from the queue and appends it to the target
+// queue, which may be the same queue to move the task to its end
+func (q *QueueClient) MoveTask(queueName, id, targetQueue string) error {
+	ctx := context.Background()
+	if err := q.checkQueue(ctx, queueName); err != nil {
+		return err
+	}
+	if err := q.checkQueue(ctx, targetQueue); err != nil {
+		return err
+	}
+
+	raw, err := q.findTask(ctx, queueName, id)
+	if err != nil {
+		return err
+	}
+	removed, err := q.redisClient.LRem(ctx, queueName, 1, raw).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrTaskNotFound
+	}
+
+	if err := q.redisClient.RPush(ctx, targetQueue, raw).Err(); err != nil {
+		// Put the task back where it came from rather than losing it
+		q.redisClient.LPush(ctx, queueName, raw)
+		return fmt.Errorf("failed to push task to queue: %v", err)
+	}
+	return nil
+}
+
+// Drain moves up to limit tasks (all if limit is 0) from the head of the queue to the end of the
+// target queue, keeping their order, and returns the number of moved tasks. Tasks are moved one
+// by one, so that this works across the nodes of a Redis Cluster.
+func (q *QueueClient) Drain(queueName, targetQueue string, limit int64) (int64, error) {
+	ctx := context.Background()
+	if queueName == targetQueue {
+		return 0, errors.New("cannot drain a queue into itself")
+	}
+	if err := q.checkQueue(ctx, queueName); err != nil {
+		return 0, err
+	}
+	if err := q.checkQueue(ctx, targetQueue); err != nil {
+		return 0, err
+	}
+
+	var moved int64
+	for limit == 0 || moved < limit {
+		raw, err := q.redisClient.LPop(ctx, queueName).Result()
+		if err == redis.Nil {
+			break
+		}
+		if err != nil {
+			return moved, err
+		}
+
+		if err := q.redisClient.RPush(ctx, targetQueue, raw).Err(); err != nil {
+			q.redisClient.LPush(ctx, queueName, raw)
+			return moved, fmt.Errorf("failed to push task to queue: %v", err)
+		}
+		moved++
+	}
+
+	return moved, nil
+}
+
+// Pause stops the workers from taking tasks from the queue until it is resumed. Tasks can still
+// be enqueued while the queue is paused.
+func (q *QueueClient) Pause(queueName string) error {
+	return q.redisClient.Set(context.Background(), pausedKeyPrefix+queueName, time.Now().Unix(), 0).Err()
+}
+
+// Resume lets the workers take tasks from a paused queue again
+func (q *QueueClient) Resume(queueName string) error {
+	return q.redisClient.Del(context.Background(), pausedKeyPrefix+queueName).Err()
+}
+
+// IsPaused reports whether the queue is paused
+func (q *QueueClient) IsPaused(queueName string) (bool, error) {
+	count, err := q.redisClient.Exists(context.Background(), pausedKeyPrefix+queueName).Result()
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,146 @@
+package queue
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/altipard/flowcraft/internal/blob"
+)
+
+// Encodings of task payloads
+const (
+	EncodingGzip = "gzip"
+	EncodingBlob = "blob" // gzipped payload stored in the blob store
+)
+
+// ErrMessageTooLarge is returned for payloads exceeding the maximum message size if no blob
+// store is configured to offload them to
+var ErrMessageTooLarge = errors.New("task payload exceeds the maximum message size")
+
+// Config holds the limits of task messages and how tasks are grouped for fair dequeueing
+type Config struct {
+	// CompressionThreshold is the payload size from which payloads are gzipped, 0 disables compression
+	CompressionThreshold int
+	// MaxMessageSize is the largest payload kept in Redis after compression, larger ones are offloaded to the blob store
+	MaxMessageSize int
+	// Fairness groups workflow executions into fair sub-queues by organization or workflow, empty for first in, first out
+	Fairness string
+}
+
+var config = Config{CompressionThreshold: 1 << 10, MaxMessageSize: 512 << 10}
+
+// ConfigFromEnv reads the message limits from the environment
+func ConfigFromEnv() Config {
+	cfg := Config{CompressionThreshold: 1 << 10, MaxMessageSize: 512 << 10}
+
+	if threshold, err := strconv.Atoi(os.Getenv("QUEUE_COMPRESSION_THRESHOLD")); err == nil && threshold >= 0 {
+		cfg.CompressionThreshold = threshold
+	}
+	if size, err := strconv.Atoi(os.Getenv("QUEUE_MAX_MESSAGE_SIZE")); err == nil && size > 0 {
+		cfg.MaxMessageSize = size
+	}
+	switch fairness := os.Getenv("QUEUE_FAIRNESS"); fairness {
+	case FairnessOrganization, FairnessWorkflow:
+		cfg.Fairness = fairness
+	case "":
+	default:
+		log.Printf("Unknown QUEUE_FAIRNESS %q, executions are dequeued first in, first out", fairness)
+	}
+
+	return cfg
+}
+
+// Configure sets the message limits and the fairness mode
+func Configure(cfg Config) {
+	config = cfg
+}
+
+// Fairness returns what workflow executions are grouped by for fair dequeueing, empty if they are
+// dequeued first in, first out
+func Fairness() string {
+	return config.Fairness
+}
+
+// encodePayload compresses the payload of a task if it is large and offloads it to the blob
+// store if it is still too large for a message
+func encodePayload(task *TaskMessage) error {
+	if task.Encoding != "" || config.CompressionThreshold == 0 || len(task.Payload) < config.CompressionThreshold {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(task.Payload); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+
+	if buf.Len() <= config.MaxMessageSize {
+		task.Encoding = EncodingGzip
+		task.Data = buf.Bytes()
+		task.Payload = nil
+		return nil
+	}
+
+	ref, err := blob.Save(context.Background(), "task-payload.json.gz", "application/gzip", &buf)
+	if errors.Is(err, blob.ErrNotConfigured) {
+		return fmt.Errorf("%w (%d bytes compressed)", ErrMessageTooLarge, buf.Len())
+	}
+	if err != nil {
+		return fmt.Errorf("failed to offload task payload: %v", err)
+	}
+
+	task.Encoding = EncodingBlob
+	task.BlobID = ref.ID
+	task.Payload = nil
+	return nil
+}
+
+// decodePayload restores the payload of a compressed or offloaded task. Offloaded payloads are
+// removed from the blob store once read; requeueing the task offloads them again.
+func decodePayload(task *TaskMessage) error {
+	var compressed io.Reader
+	switch task.Encoding {
+	case "":
+		return nil
+	case EncodingGzip:
+		compressed = bytes.NewReader(task.Data)
+	case EncodingBlob:
+		rc, err := blob.Open(context.Background(), task.BlobID)
+		if err != nil {
+			return fmt.Errorf("failed to load offloaded task payload: %v", err)
+		}
+		defer rc.Close()
+		compressed = rc
+	default:
+		return fmt.Errorf("unknown task payload encoding: %s", task.Encoding)
+	}
+
+	zr, err := gzip.NewReader(compressed)
+	if err != nil {
+		return err
+	}
+	payload, err := io.ReadAll(zr)
+	if err != nil {
+		return err
+	}
+
+	if task.Encoding == EncodingBlob {
+		blob.Delete(context.Background(), task.BlobID)
+	}
+	task.Payload = json.RawMessage(payload)
+	task.Encoding = ""
+	task.Data = nil
+	task.BlobID = ""
+	return nil
+}
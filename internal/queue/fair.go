@@ -0,0 +1,136 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Fairness modes, i.e. what the tasks of a queue are grouped by for fair dequeueing
+const (
+	FairnessOrganization = "organization"
+	FairnessWorkflow     = "workflow"
+)
+
+// Fair dequeueing keeps a sub-queue per group next to the queue and a ring of the groups with
+// waiting tasks. Workers take up to weight tasks of the group at the end of the ring, then rotate
+// it to the front, so a group with many waiting tasks cannot hold back the others. The keys share
+// the hash tag of the queue, so the scripts work on a Redis Cluster.
+var (
+	// KEYS: ring, weights, sub-queue; ARGV: group, weight, task
+	enqueueFairScript = redis.NewScript(`
+redis.call("RPUSH", KEYS[3], ARGV[3])
+if redis.call("HSET", KEYS[2], ARGV[1], ARGV[2]) == 1 then
+	redis.call("LPUSH", KEYS[1], ARGV[1])
+end
+return 1`)
+	// KEYS: ring, weights, credits; ARGV: prefix of the sub-queues. Groups whose sub-queue is
+	// empty leave the ring.
+	dequeueFairScript = redis.NewScript(`
+for i = 1, redis.call("LLEN", KEYS[1]) do
+	local group = redis.call("LINDEX", KEYS[1], -1)
+	local task = redis.call("LPOP", ARGV[1] .. group)
+	if task then
+		local weight = tonumber(redis.call("HGET", KEYS[2], group)) or 1
+		if redis.call("HINCRBY", KEYS[3], group, 1) >= weight then
+			redis.call("HDEL", KEYS[3], group)
+			redis.call("RPOPLPUSH", KEYS[1], KEYS[1])
+		end
+		return {group, task}
+	end
+	redis.call("RPOP", KEYS[1])
+	redis.call("HDEL", KEYS[2], group)
+	redis.call("HDEL", KEYS[3], group)
+end
+return false`)
+)
+
+// FairGroup is a group of tasks waiting in the sub-queue of a queue
+type FairGroup struct {
+	Name   string `json:"name"`
+	Queue  string `json:"queue"` // name of the sub-queue, for the queue admin endpoints
+	Weight int    `json:"weight"`
+	Length int64  `json:"length"`
+}
+
+// fairKey returns the key of a structure of the fair sub-queues of a queue
+func fairKey(queueName, suffix string) string {
+	return "{" + queueName + "}:" + suffix
+}
+
+// fairQueue returns the name of the sub-queue of a group
+func fairQueue(queueName, group string) string {
+	return fairKey(queueName, "group:") + group
+}
+
+// EnqueueFairTask adds a task to the sub-queue of the group, which receives up to weight tasks
+// per turn when workers dequeue from the queue
+func (q *QueueClient) EnqueueFairTask(queueName, group string, weight int, taskType string, payload interface{}) error {
+	taskBytes, err := encodeTask(taskType, payload)
+	if err != nil {
+		return err
+	}
+	if weight < 1 {
+		weight = 1
+	}
+
+	keys := []string{fairKey(queueName, "groups"), fairKey(queueName, "weights"), fairQueue(queueName, group)}
+	err = enqueueFairScript.Run(context.Background(), q.redisClient, keys, group, weight, taskBytes).Err()
+	if err != nil {
+		return fmt.Errorf("failed to push task to queue: %v", err)
+	}
+	return nil
+}
+
+// dequeueFair takes the next task of the fair sub-queues of a queue, redis.Nil if none is waiting
+func (q *QueueClient) dequeueFair(ctx context.Context, queueName string) (string, error) {
+	keys := []string{fairKey(queueName, "groups"), fairKey(queueName, "weights"), fairKey(queueName, "credits")}
+	result, err := dequeueFairScript.Run(ctx, q.redisClient, keys, fairKey(queueName, "group:")).Slice()
+	if err != nil {
+		return "", err
+	}
+	if len(result) != 2 {
+		return "", fmt.Errorf("unexpected result from fair dequeue: %v", result)
+	}
+	task, _ := result[1].(string)
+	return task, nil
+}
+
+// FairGroups returns the groups with tasks waiting in the fair sub-queues of a queue, in the
+// order they are served
+func (q *QueueClient) FairGroups(queueName string) ([]FairGroup, error) {
+	ctx := context.Background()
+	names, err := q.redisClient.LRange(ctx, fairKey(queueName, "groups"), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	weights, err := q.redisClient.HGetAll(ctx, fairKey(queueName, "weights")).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	lengths := make([]*redis.IntCmd, len(names))
+	_, err = q.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, name := range names {
+			lengths[i] = pipe.LLen(ctx, fairQueue(queueName, name))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]FairGroup, 0, len(names))
+	for i := len(names) - 1; i >= 0; i-- {
+		weight, _ := strconv.Atoi(weights[names[i]])
+		groups = append(groups, FairGroup{
+			Name:   names[i],
+			Queue:  fairQueue(queueName, names[i]),
+			Weight: weight,
+			Length: lengths[i].Val(),
+		})
+	}
+	return groups, nil
+}
@@ -0,0 +1,149 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Keys of the leader election
+const (
+	leaderKeyPrefix = "flowcraft:leader:"
+	// leadersKey is the set of the jobs with a leader election
+	leadersKey = "flowcraft:leaders"
+)
+
+// Leadership is the process running a singleton background job
+type Leadership struct {
+	Job string `json:"job"`
+	// Holder is the host and process ID of the leader, empty if the job has no leader
+	Holder    string     `json:"holder,omitempty"`
+	Since     *time.Time `json:"since,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// RunAsLeader runs a background job that must only run in one process at a time, e.g. the
+// scheduler. The processes calling it for the same job elect a leader through a key in Redis
+// that expires after ttl unless the leader renews it, so another process takes over within ttl
+// if the leader crashes. run is only called while the process leads and its context is
+// cancelled when the leadership is lost. RunAsLeader returns when ctx is done or when run
+// returns on its own, e.g. because the job is disabled.
+func (q *QueueClient) RunAsLeader(ctx context.Context, job string, ttl time.Duration, run func(ctx context.Context)) {
+	host, _ := os.Hostname()
+	holder := fmt.Sprintf("%s:%d", host, os.Getpid())
+	key := leaderKeyPrefix + job
+	if err := q.redisClient.SAdd(ctx, leadersKey, job).Err(); err != nil {
+		log.Printf("Failed to register leader election of %s: %v", job, err)
+	}
+
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	for {
+		now := time.Now().UTC()
+		value, _ := json.Marshal(Leadership{Job: job, Holder: holder, Since: &now})
+		ok, err := q.redisClient.SetNX(ctx, key, value, ttl).Result()
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Failed to campaign for leader of %s: %v", job, err)
+		}
+		if ok {
+			log.Printf("Became leader of %s", job)
+			if finished := q.lead(ctx, key, string(value), ttl, run); finished {
+				q.redisClient.SRem(context.Background(), leadersKey, job)
+				return
+			}
+			log.Printf("Stopped leading %s", job)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// lead runs the job and renews the leadership until ctx is done, the job returns or the
+// leadership is lost. It reports whether the job returned on its own.
+func (q *QueueClient) lead(ctx context.Context, key, value string, ttl time.Duration, run func(ctx context.Context)) bool {
+	jobCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(jobCtx)
+	}()
+
+	ticker := time.NewTicker(ttl / 3)
+	defer ticker.Stop()
+	renewed := time.Now()
+	for {
+		select {
+		case <-done:
+			finished := ctx.Err() == nil
+			releaseScript.Run(context.Background(), q.redisClient, []string{key}, value)
+			return finished
+		case <-ctx.Done():
+			<-done
+			releaseScript.Run(context.Background(), q.redisClient, []string{key}, value)
+			return false
+		case <-ticker.C:
+			extended, err := extendScript.Run(context.Background(), q.redisClient, []string{key}, value, ttl.Milliseconds()).Int()
+			if err == nil && extended == 1 {
+				renewed = time.Now()
+				continue
+			}
+			// Stop before the key expires when Redis is unreachable, as another process may
+			// take over as soon as it does
+			if err == nil || time.Since(renewed) >= 2*ttl/3 {
+				log.Printf("Lost leadership of %s", key[len(leaderKeyPrefix):])
+				cancel()
+				<-done
+				return false
+			}
+		}
+	}
+}
+
+// Leaders returns the current leaders of the jobs with a leader election, jobs without a leader
+// have no holder
+func (q *QueueClient) Leaders() ([]Leadership, error) {
+	ctx := context.Background()
+	jobs, err := q.redisClient.SMembers(ctx, leadersKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(jobs)
+
+	values := make([]*redis.StringCmd, len(jobs))
+	ttls := make([]*redis.DurationCmd, len(jobs))
+	_, err = q.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, job := range jobs {
+			values[i] = pipe.Get(ctx, leaderKeyPrefix+job)
+			ttls[i] = pipe.PTTL(ctx, leaderKeyPrefix+job)
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	leaders := make([]Leadership, 0, len(jobs))
+	for i, job := range jobs {
+		leader := Leadership{Job: job}
+		if value, err := values[i].Result(); err == nil && json.Unmarshal([]byte(value), &leader) == nil {
+			leader.Job = job
+			if ttl := ttls[i].Val(); ttl > 0 {
+				expiresAt := time.Now().UTC().Add(ttl)
+				leader.ExpiresAt = &expiresAt
+			}
+		}
+		leaders = append(leaders, leader)
+	}
+	return leaders, nil
+}
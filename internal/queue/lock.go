@@ -0,0 +1,92 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ErrLockHeld is returned when the lock is held by someone else
+var ErrLockHeld = errors.New("lock is held by another worker")
+
+// Releases or extends the lock only if it is still held with the given token
+var (
+	releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+	extendScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+)
+
+// Lock is a lock in Redis held by this process until it is released or expires
+type Lock struct {
+	client redis.UniversalClient
+	key    string
+	token  string
+	ttl    time.Duration
+	stop   chan struct{}
+}
+
+// AcquireLock acquires the lock with the given key. The lock expires after ttl unless it is
+// kept alive, so a crashed holder cannot block others forever.
+func (q *QueueClient) AcquireLock(key string, ttl time.Duration) (*Lock, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	token := hex.EncodeToString(buf)
+
+	ok, err := q.redisClient.SetNX(context.Background(), key, token, ttl).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock: %v", err)
+	}
+	if !ok {
+		return nil, ErrLockHeld
+	}
+
+	return &Lock{
+		client: q.redisClient,
+		key:    key,
+		token:  token,
+		ttl:    ttl,
+		stop:   make(chan struct{}),
+	}, nil
+}
+
+// KeepAlive extends the lock periodically until it is released
+func (l *Lock) KeepAlive() {
+	ticker := time.NewTicker(l.ttl / 3)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-ticker.C:
+				// Failures are retried on the next tick, the lock only expires after the full ttl
+				extendScript.Run(context.Background(), l.client, []string{l.key}, l.token, l.ttl.Milliseconds())
+			}
+		}
+	}()
+}
+
+// Release releases the lock if it is still held by this process
+func (l *Lock) Release() error {
+	close(l.stop)
+	return releaseScript.Run(context.Background(), l.client, []string{l.key}, l.token).Err()
+}
+
+// ExecutionLockKey returns the key of the lock serializing the processing of an execution
+func ExecutionLockKey(executionID uint) string {
+	return fmt.Sprintf("flowcraft:execution_lock:%d", executionID)
+}
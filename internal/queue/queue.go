@@ -11,24 +11,26 @@ import (
 
 // QueueClient is a client for the message queue
 type QueueClient struct {
-	redisClient *redis.Client
+	redisClient redis.UniversalClient
 }
 
 // TaskMessage represents a task in the queue
 type TaskMessage struct {
 	TaskType string          `json:"task_type"`
-	Payload  json.RawMessage `json:"payload"`
+	Payload  json.RawMessage `json:"payload,omitempty"`
+	// Encoding is set for large payloads, which are stored compressed in Data or in the blob store
+	Encoding string `json:"encoding,omitempty"` // gzip, blob
+	Data     []byte `json:"data,omitempty"`
+	BlobID   string `json:"blob_id,omitempty"`
 }
 
-// NewQueueClient creates a new QueueClient
-func NewQueueClient(redisURL string) (*QueueClient, error) {
-	options, err := redis.ParseURL(redisURL)
+// NewQueueClient creates a new QueueClient for the configured Redis deployment
+func NewQueueClient(cfg RedisConfig) (*QueueClient, error) {
+	client, err := NewRedisClient(cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	client := redis.NewClient(options)
-
 	// Test the connection
 	ctx := context.Background()
 	if _, err := client.Ping(ctx).Result(); err != nil {
@@ -40,14 +42,38 @@ func NewQueueClient(redisURL string) (*QueueClient, error) {
 	}, nil
 }
 
+// RedisClient returns the Redis client of the queue, e.g. to share its connections
+func (q *QueueClient) RedisClient() redis.UniversalClient {
+	return q.redisClient
+}
+
+// fairPollInterval is how long a worker blocks on the queue before checking its fair sub-queues again
+const fairPollInterval = time.Second
+
 // EnqueueTask adds a task to the queue
 func (q *QueueClient) EnqueueTask(queueName string, taskType string, payload interface{}) error {
 	ctx := context.Background()
 
+	taskBytes, err := encodeTask(taskType, payload)
+	if err != nil {
+		return err
+	}
+
+	// Add task to queue
+	err = q.redisClient.RPush(ctx, queueName, taskBytes).Err()
+	if err != nil {
+		return fmt.Errorf("failed to push task to queue: %v", err)
+	}
+
+	return nil
+}
+
+// encodeTask serializes a task message with the given payload
+func encodeTask(taskType string, payload interface{}) ([]byte, error) {
 	// Serialize payload
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal payload: %v", err)
+		return nil, fmt.Errorf("failed to marshal payload: %v", err)
 	}
 
 	// Create task
@@ -55,14 +81,32 @@ func (q *QueueClient) EnqueueTask(queueName string, taskType string, payload int
 		TaskType: taskType,
 		Payload:  payloadBytes,
 	}
+	if err := encodePayload(&task); err != nil {
+		return nil, err
+	}
 
 	// Serialize task
 	taskBytes, err := json.Marshal(task)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal task: %v", err)
+	}
+	return taskBytes, nil
+}
+
+// RequeueTask adds a dequeued task to the end of the queue again
+func (q *QueueClient) RequeueTask(queueName string, task *TaskMessage) error {
+	ctx := context.Background()
+
+	encoded := *task
+	if err := encodePayload(&encoded); err != nil {
+		return err
+	}
+
+	taskBytes, err := json.Marshal(encoded)
 	if err != nil {
 		return fmt.Errorf("failed to marshal task: %v", err)
 	}
 
-	// Add task to queue
 	err = q.redisClient.RPush(ctx, queueName, taskBytes).Err()
 	if err != nil {
 		return fmt.Errorf("failed to push task to queue: %v", err)
@@ -71,29 +115,112 @@ func (q *QueueClient) EnqueueTask(queueName string, taskType string, payload int
 	return nil
 }
 
-// DequeueTask retrieves a task from the queue
+// DequeueTask retrieves a task from the queue. Tasks added to the queue itself, e.g. resumptions,
+// come before the tasks of its fair sub-queues. Paused queues return no task after the timeout.
 func (q *QueueClient) DequeueTask(queueName string, timeout time.Duration) (*TaskMessage, error) {
 	ctx := context.Background()
 
-	// Get task from queue with timeout
-	result, err := q.redisClient.BLPop(ctx, timeout, queueName).Result()
+	paused, err := q.IsPaused(queueName)
 	if err != nil {
+		return nil, fmt.Errorf("failed to check whether queue is paused: %v", err)
+	}
+	if paused {
+		time.Sleep(timeout)
+		return nil, nil
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		raw, err := q.redisClient.LPop(ctx, queueName).Result()
 		if err == redis.Nil {
+			raw, err = q.dequeueFair(ctx, queueName)
+		}
+		if err == nil {
+			return decodeTask(raw)
+		}
+		if err != redis.Nil {
+			return nil, fmt.Errorf("failed to pop task from queue: %v", err)
+		}
+
+		// Wait for tasks added to the queue itself, checking the sub-queues regularly
+		wait := time.Until(deadline)
+		if wait <= 0 {
 			return nil, nil // No task in queue
 		}
-		return nil, fmt.Errorf("failed to pop task from queue: %v", err)
-	}
+		if wait > fairPollInterval {
+			wait = fairPollInterval
+		}
+		result, err := q.redisClient.BLPop(ctx, wait, queueName).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to pop task from queue: %v", err)
+		}
 
-	// We receive a slice [queueName, value]
-	if len(result) != 2 {
-		return nil, fmt.Errorf("unexpected result from BLPOP: %v", result)
+		// We receive a slice [queueName, value]
+		if len(result) != 2 {
+			return nil, fmt.Errorf("unexpected result from BLPOP: %v", result)
+		}
+		return decodeTask(result[1])
 	}
+}
 
-	// Deserialize task
+// decodeTask deserializes a task message taken from a queue
+func decodeTask(raw string) (*TaskMessage, error) {
 	var task TaskMessage
-	if err := json.Unmarshal([]byte(result[1]), &task); err != nil {
+	if err := json.Unmarshal([]byte(raw), &task); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal task: %v", err)
 	}
+	if err := decodePayload(&task); err != nil {
+		return nil, err
+	}
 
 	return &task, nil
 }
+
+// Publish sends a message to all subscribers of the channel
+func (q *QueueClient) Publish(channel string, payload interface{}) error {
+	ctx := context.Background()
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload: %v", err)
+	}
+
+	if err := q.redisClient.Publish(ctx, channel, payloadBytes).Err(); err != nil {
+		return fmt.Errorf("failed to publish message: %v", err)
+	}
+
+	return nil
+}
+
+// Subscribe returns the messages published to the channel until the context is cancelled
+func (q *QueueClient) Subscribe(ctx context.Context, channel string) <-chan []byte {
+	pubsub := q.redisClient.Subscribe(ctx, channel)
+	messages := make(chan []byte)
+
+	go func() {
+		defer close(messages)
+		defer pubsub.Close()
+
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				select {
+				case messages <- []byte(msg.Payload):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return messages
+}
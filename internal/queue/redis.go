@@ -0,0 +1,118 @@
+package queue
+
+import (
+	"crypto/tls"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisConfig describes the Redis deployment: a single server (URL), a Sentinel-managed primary
+// or a cluster. Credentials and TLS apply to the servers of all topologies.
+type RedisConfig struct {
+	URL string
+
+	SentinelAddrs    []string
+	SentinelMaster   string
+	SentinelPassword string
+
+	ClusterAddrs []string
+
+	Username string
+	Password string
+	DB       int
+
+	TLS                   bool
+	TLSInsecureSkipVerify bool
+}
+
+// RedisConfigFromEnv reads the Redis deployment from the environment. REDIS_SENTINEL_ADDRS and
+// REDIS_CLUSTER_ADDRS take precedence over REDIS_URL.
+func RedisConfigFromEnv() RedisConfig {
+	cfg := RedisConfig{
+		URL:                   os.Getenv("REDIS_URL"),
+		SentinelAddrs:         splitAddrs(os.Getenv("REDIS_SENTINEL_ADDRS")),
+		SentinelMaster:        os.Getenv("REDIS_SENTINEL_MASTER"),
+		SentinelPassword:      os.Getenv("REDIS_SENTINEL_PASSWORD"),
+		ClusterAddrs:          splitAddrs(os.Getenv("REDIS_CLUSTER_ADDRS")),
+		Username:              os.Getenv("REDIS_USERNAME"),
+		Password:              os.Getenv("REDIS_PASSWORD"),
+		TLS:                   os.Getenv("REDIS_TLS") == "true",
+		TLSInsecureSkipVerify: os.Getenv("REDIS_TLS_INSECURE_SKIP_VERIFY") == "true",
+	}
+	if db, err := strconv.Atoi(os.Getenv("REDIS_DB")); err == nil {
+		cfg.DB = db
+	}
+	return cfg
+}
+
+// splitAddrs splits a comma separated list of host:port addresses
+func splitAddrs(value string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(value, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// tlsConfig returns the TLS configuration of the connections, or nil for plain connections
+func (c RedisConfig) tlsConfig() *tls.Config {
+	if !c.TLS {
+		return nil
+	}
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: c.TLSInsecureSkipVerify,
+	}
+}
+
+// NewRedisClient creates a client for the configured Redis deployment. Clients of Sentinel
+// deployments follow the primary on failover; cluster clients route commands to the node
+// owning the key.
+func NewRedisClient(cfg RedisConfig) (redis.UniversalClient, error) {
+	switch {
+	case len(cfg.SentinelAddrs) > 0:
+		if cfg.SentinelMaster == "" {
+			return nil, errors.New("REDIS_SENTINEL_MASTER is required with REDIS_SENTINEL_ADDRS")
+		}
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       cfg.SentinelMaster,
+			SentinelAddrs:    cfg.SentinelAddrs,
+			SentinelPassword: cfg.SentinelPassword,
+			Username:         cfg.Username,
+			Password:         cfg.Password,
+			DB:               cfg.DB,
+			TLSConfig:        cfg.tlsConfig(),
+		}), nil
+
+	case len(cfg.ClusterAddrs) > 0:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     cfg.ClusterAddrs,
+			Username:  cfg.Username,
+			Password:  cfg.Password,
+			TLSConfig: cfg.tlsConfig(),
+		}), nil
+
+	default:
+		options, err := redis.ParseURL(cfg.URL)
+		if err != nil {
+			return nil, err
+		}
+		// Settings from the environment override the ones of the URL
+		if cfg.Username != "" {
+			options.Username = cfg.Username
+		}
+		if cfg.Password != "" {
+			options.Password = cfg.Password
+		}
+		if cfg.TLS {
+			options.TLSConfig = cfg.tlsConfig()
+		}
+		return redis.NewClient(options), nil
+	}
+}
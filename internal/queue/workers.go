@@ -0,0 +1,282 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Keys of the worker registry
+const (
+	workersKey           = "flowcraft:workers"
+	utilizationKeyPrefix = "flowcraft:workers:utilization:"
+	// utilizationRetention is how long the hourly utilization is kept
+	utilizationRetention = 8 * 24 * time.Hour
+)
+
+// WorkerStatus is the state of a worker goroutine as last reported
+type WorkerStatus struct {
+	ID       string    `json:"id"`
+	Host     string    `json:"host"`
+	Busy     bool      `json:"busy"`
+	TaskType string    `json:"task_type,omitempty"`
+	Since    time.Time `json:"since"` // start of the current task or idle period
+	LastSeen time.Time `json:"last_seen"`
+	// Plugins are the executor plugins loaded by the worker's process
+	Plugins []PluginStatus `json:"plugins,omitempty"`
+	// Panics counts the panics of executors in the worker's process by executor class
+	Panics map[string]int64 `json:"panics,omitempty"`
+}
+
+// PluginStatus is the health of an executor plugin loaded by a worker
+type PluginStatus struct {
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	Version  string    `json:"version,omitempty"`
+	Hash     string    `json:"hash,omitempty"`
+	Status   string    `json:"status"` // loaded, failed or quarantined
+	Crashes  int       `json:"crashes"`
+	Error    string    `json:"error,omitempty"` // of the last failed load or crash
+	LoadedAt time.Time `json:"loaded_at,omitempty"`
+}
+
+// HourlyUtilization is the share of the hour the reporting workers spent processing tasks
+type HourlyUtilization struct {
+	Hour        time.Time `json:"hour"`
+	BusyMs      int64     `json:"busy_ms"`
+	CapacityMs  int64     `json:"capacity_ms"`
+	Utilization float64   `json:"utilization"`
+}
+
+// WorkerTracker records when the worker goroutines of a process are busy and reports it to
+// Redis, for the worker utilization shown in the stats
+type WorkerTracker struct {
+	q          *QueueClient
+	host       string
+	mu         sync.Mutex
+	workers    map[int]*trackedWorker
+	lastReport time.Time
+	plugins    func() []PluginStatus
+	panics     func() map[string]int64
+}
+
+type trackedWorker struct {
+	busy     bool
+	taskType string
+	since    time.Time
+	// busyTime is the busy time of finished tasks since the last report
+	busyTime time.Duration
+}
+
+// NewWorkerTracker creates a tracker for the given number of idle workers
+func (q *QueueClient) NewWorkerTracker(count int) *WorkerTracker {
+	host, _ := os.Hostname()
+	now := time.Now()
+	t := &WorkerTracker{
+		q:          q,
+		host:       fmt.Sprintf("%s-%d", host, os.Getpid()),
+		workers:    make(map[int]*trackedWorker, count),
+		lastReport: now,
+	}
+	for i := 1; i <= count; i++ {
+		t.workers[i] = &trackedWorker{since: now}
+	}
+	return t
+}
+
+// ReportPlugins reports the health of the process's executor plugins with its workers
+func (t *WorkerTracker) ReportPlugins(plugins func() []PluginStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.plugins = plugins
+}
+
+// ReportPanics reports the panics of the process's executors by executor class with its workers
+func (t *WorkerTracker) ReportPanics(panics func() map[string]int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.panics = panics
+}
+
+// Busy marks a worker as processing a task
+func (t *WorkerTracker) Busy(worker int, taskType string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if w, ok := t.workers[worker]; ok {
+		w.busy, w.taskType, w.since = true, taskType, time.Now()
+	}
+}
+
+// Idle marks a worker as done with its task
+func (t *WorkerTracker) Idle(worker int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w, ok := t.workers[worker]
+	if !ok || !w.busy {
+		return
+	}
+	now := time.Now()
+	w.busyTime += now.Sub(latest(w.since, t.lastReport))
+	w.busy, w.taskType, w.since = false, "", now
+}
+
+// Run reports the workers at the given interval until the context is done, then removes them
+func (t *WorkerTracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.report(); err != nil {
+			log.Printf("Failed to report worker status: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			t.remove()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// report stores the status of the workers and adds their busy time since the last report to the
+// utilization of the current hour
+func (t *WorkerTracker) report() error {
+	t.mu.Lock()
+	now := time.Now()
+	var plugins []PluginStatus
+	if t.plugins != nil {
+		plugins = t.plugins()
+	}
+	var panics map[string]int64
+	if t.panics != nil {
+		panics = t.panics()
+	}
+	statuses := make(map[string]interface{}, len(t.workers))
+	var busy, capacity time.Duration
+	for id, w := range t.workers {
+		busyTime := w.busyTime
+		if w.busy {
+			busyTime += now.Sub(latest(w.since, t.lastReport))
+		}
+		w.busyTime = 0
+		busy += busyTime
+		capacity += now.Sub(t.lastReport)
+
+		status, _ := json.Marshal(WorkerStatus{
+			ID:       t.workerID(id),
+			Host:     t.host,
+			Busy:     w.busy,
+			TaskType: w.taskType,
+			Since:    w.since,
+			LastSeen: now,
+			Plugins:  plugins,
+			Panics:   panics,
+		})
+		statuses[t.workerID(id)] = status
+	}
+	t.lastReport = now
+	t.mu.Unlock()
+
+	ctx := context.Background()
+	key := utilizationKeyPrefix + now.UTC().Format("2006010215")
+	_, err := t.q.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, workersKey, statuses)
+		pipe.HIncrBy(ctx, key, "busy_ms", busy.Milliseconds())
+		pipe.HIncrBy(ctx, key, "capacity_ms", capacity.Milliseconds())
+		pipe.Expire(ctx, key, utilizationRetention)
+		return nil
+	})
+	return err
+}
+
+// remove deletes the workers of the process from the registry when it shuts down
+func (t *WorkerTracker) remove() {
+	fields := make([]string, 0, len(t.workers))
+	for id := range t.workers {
+		fields = append(fields, t.workerID(id))
+	}
+	if err := t.q.redisClient.HDel(context.Background(), workersKey, fields...).Err(); err != nil {
+		log.Printf("Failed to remove workers from the registry: %v", err)
+	}
+}
+
+func (t *WorkerTracker) workerID(worker int) string {
+	return t.host + "/" + strconv.Itoa(worker)
+}
+
+func latest(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// Workers returns the workers that reported within maxAge. Workers not seen for longer, e.g.
+// of crashed processes, are removed from the registry.
+func (q *QueueClient) Workers(maxAge time.Duration) ([]WorkerStatus, error) {
+	ctx := context.Background()
+	entries, err := q.redisClient.HGetAll(ctx, workersKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	workers := []WorkerStatus{}
+	var stale []string
+	for id, entry := range entries {
+		var status WorkerStatus
+		if err := json.Unmarshal([]byte(entry), &status); err != nil || time.Since(status.LastSeen) > maxAge {
+			stale = append(stale, id)
+			continue
+		}
+		workers = append(workers, status)
+	}
+	if len(stale) > 0 {
+		q.redisClient.HDel(ctx, workersKey, stale...)
+	}
+	return workers, nil
+}
+
+// Utilization returns the hourly worker utilization of the hours from from to to, hours without
+// reports are left out
+func (q *QueueClient) Utilization(from, to time.Time) ([]HourlyUtilization, error) {
+	ctx := context.Background()
+	var hours []time.Time
+	for hour := from.UTC().Truncate(time.Hour); !hour.After(to); hour = hour.Add(time.Hour) {
+		hours = append(hours, hour)
+	}
+
+	cmds := make([]*redis.StringStringMapCmd, len(hours))
+	_, err := q.redisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, hour := range hours {
+			cmds[i] = pipe.HGetAll(ctx, utilizationKeyPrefix+hour.Format("2006010215"))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	utilization := []HourlyUtilization{}
+	for i, cmd := range cmds {
+		values := cmd.Val()
+		busy, _ := strconv.ParseInt(values["busy_ms"], 10, 64)
+		capacity, _ := strconv.ParseInt(values["capacity_ms"], 10, 64)
+		if capacity == 0 {
+			continue
+		}
+		utilization = append(utilization, HourlyUtilization{
+			Hour:        hours[i],
+			BusyMs:      busy,
+			CapacityMs:  capacity,
+			Utilization: float64(busy) / float64(capacity),
+		})
+	}
+	return utilization, nil
+}
@@ -0,0 +1,225 @@
+// Package quota enforces per-organization usage limits and maintains billing counters
+package quota
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Quota names
+const (
+	ExecutionsPerMonth   = "executions_per_month"
+	ConcurrentExecutions = "concurrent_executions"
+	Storage              = "storage"
+)
+
+// ExceededError is returned when an organization has used up one of its quotas
+type ExceededError struct {
+	Quota   string
+	Limit   int64
+	Current int64
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("quota %s exceeded (%d of %d used)", e.Quota, e.Current, e.Limit)
+}
+
+// Usage is the current usage of an organization
+type Usage struct {
+	OrganizationID          uint   `json:"organization_id"`
+	Period                  string `json:"period"`
+	Executions              int64  `json:"executions"`
+	MaxExecutionsPerMonth   int64  `json:"max_executions_per_month"`
+	ConcurrentExecutions    int64  `json:"concurrent_executions"`
+	MaxConcurrentExecutions int64  `json:"max_concurrent_executions"`
+	StorageBytes            int64  `json:"storage_bytes"`
+	MaxStorageBytes         int64  `json:"max_storage_bytes"`
+}
+
+// CurrentPeriod returns the billing period for the given time
+func CurrentPeriod(t time.Time) string {
+	return t.UTC().Format("2006-01")
+}
+
+// activeStatuses are the statuses of executions counting against the concurrent executions quota
+var activeStatuses = []string{"pending", "running", "waiting", "queued", "held"}
+
+// Reserve checks that the organization may start another execution and counts it in the current
+// period, together with the size of its input in the stored bytes, as part of tx. The row of the
+// organization stays locked until tx ends, so concurrent dispatches of an organization are
+// checked one after another and cannot exceed its quotas together.
+func Reserve(tx *gorm.DB, organizationID uint, inputBytes int64) error {
+	if organizationID == 0 {
+		return nil
+	}
+
+	var organization models.Organization
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&organization, organizationID).Error; err != nil {
+		return err
+	}
+
+	if organization.MaxConcurrentExecutions > 0 {
+		running, err := concurrentExecutions(tx, organizationID)
+		if err != nil {
+			return err
+		}
+		if running >= organization.MaxConcurrentExecutions {
+			return &ExceededError{Quota: ConcurrentExecutions, Limit: organization.MaxConcurrentExecutions, Current: running}
+		}
+	}
+
+	period := CurrentPeriod(time.Now())
+	if organization.MaxExecutionsPerMonth > 0 {
+		executions, err := periodExecutions(tx, organizationID, period)
+		if err != nil {
+			return err
+		}
+		if executions >= organization.MaxExecutionsPerMonth {
+			return &ExceededError{Quota: ExecutionsPerMonth, Limit: organization.MaxExecutionsPerMonth, Current: executions}
+		}
+	}
+
+	if organization.MaxStorageBytes > 0 && organization.StorageBytes >= organization.MaxStorageBytes {
+		return &ExceededError{Quota: Storage, Limit: organization.MaxStorageBytes, Current: organization.StorageBytes}
+	}
+
+	if err := countExecution(tx, organizationID, period, 1); err != nil {
+		return fmt.Errorf("failed to record usage: %v", err)
+	}
+	return tx.Model(&organization).UpdateColumn("storage_bytes", gorm.Expr("storage_bytes + ?", inputBytes)).Error
+}
+
+// Release takes back the reservation of an execution that was reserved at the given time and
+// then discarded before it was started
+func Release(tx *gorm.DB, organizationID uint, reservedAt time.Time, inputBytes int64) error {
+	if organizationID == 0 {
+		return nil
+	}
+
+	if err := countExecution(tx, organizationID, CurrentPeriod(reservedAt), -1); err != nil {
+		return err
+	}
+	return tx.Model(&models.Organization{}).Where("id = ?", organizationID).
+		UpdateColumn("storage_bytes", gorm.Expr("GREATEST(storage_bytes - ?, 0)", inputBytes)).Error
+}
+
+// countExecution adds delta to the execution counter of the organization for the period
+func countExecution(tx *gorm.DB, organizationID uint, period string, delta int64) error {
+	counter := models.UsageCounter{
+		OrganizationID: organizationID,
+		Period:         period,
+		Executions:     delta,
+	}
+
+	return tx.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "organization_id"}, {Name: "period"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"executions": gorm.Expr("usage_counters.executions + ?", delta),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&counter).Error
+}
+
+// MeasureStorage measures the bytes of execution data stored for each organization right away
+// and then at the given interval until ctx is done. Dispatches add the size of their input to
+// the counter in between; the measurement also covers the outputs stored since and the data
+// removed by retention and archiving.
+func MeasureStorage(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var ids []uint
+		if err := database.DB.Model(&models.Organization{}).Order("id").Pluck("id", &ids).Error; err != nil {
+			log.Printf("Failed to list organizations for measuring storage: %v", err)
+		}
+		for _, id := range ids {
+			storage, err := storageBytes(id)
+			if err != nil {
+				log.Printf("Failed to measure storage of organization %d: %v", id, err)
+				continue
+			}
+			database.DB.Model(&models.Organization{}).Where("id = ?", id).UpdateColumn("storage_bytes", storage)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// GetUsage returns the usage of an organization for the given period
+func GetUsage(organization models.Organization, period string) (Usage, error) {
+	usage := Usage{
+		OrganizationID:          organization.ID,
+		Period:                  period,
+		MaxExecutionsPerMonth:   organization.MaxExecutionsPerMonth,
+		MaxConcurrentExecutions: organization.MaxConcurrentExecutions,
+		MaxStorageBytes:         organization.MaxStorageBytes,
+	}
+
+	var err error
+	if usage.Executions, err = periodExecutions(database.DB, organization.ID, period); err != nil {
+		return usage, err
+	}
+	if usage.ConcurrentExecutions, err = concurrentExecutions(database.DB, organization.ID); err != nil {
+		return usage, err
+	}
+	usage.StorageBytes = organization.StorageBytes
+
+	return usage, nil
+}
+
+// periodExecutions returns the number of executions counted in the period
+func periodExecutions(db *gorm.DB, organizationID uint, period string) (int64, error) {
+	var counter models.UsageCounter
+	result := db.Where("organization_id = ? AND period = ?", organizationID, period).Limit(1).Find(&counter)
+	return counter.Executions, result.Error
+}
+
+// concurrentExecutions returns the number of executions of the organization that are not finished:
+// pending, running or waiting ones as well as the ones held back by their trigger, for an
+// automatic retry or during maintenance
+func concurrentExecutions(db *gorm.DB, organizationID uint) (int64, error) {
+	var count int64
+	err := db.Model(&models.WorkflowExecution{}).
+		Joins("JOIN workflows ON workflows.id = workflow_executions.workflow_id").
+		Where("workflows.organization_id = ? AND workflow_executions.status IN ?", organizationID, activeStatuses).
+		Count(&count).Error
+	return count, err
+}
+
+// storageBytes returns the bytes of execution data stored for the organization
+func storageBytes(organizationID uint) (int64, error) {
+	var executionBytes, nodeBytes int64
+
+	err := database.DB.Model(&models.WorkflowExecution{}).
+		Select("COALESCE(SUM(octet_length(workflow_executions.input_data::text) + octet_length(workflow_executions.output_data::text)), 0)").
+		Joins("JOIN workflows ON workflows.id = workflow_executions.workflow_id").
+		Where("workflows.organization_id = ?", organizationID).
+		Scan(&executionBytes).Error
+	if err != nil {
+		return 0, err
+	}
+
+	err = database.DB.Model(&models.NodeExecution{}).
+		Select("COALESCE(SUM(node_executions.bytes_in + node_executions.bytes_out), 0)").
+		Joins("JOIN workflow_executions ON workflow_executions.id = node_executions.workflow_execution_id").
+		Joins("JOIN workflows ON workflows.id = workflow_executions.workflow_id").
+		Where("workflows.organization_id = ? AND workflow_executions.deleted_at IS NULL", organizationID).
+		Scan(&nodeBytes).Error
+	if err != nil {
+		return 0, err
+	}
+
+	return executionBytes + nodeBytes, nil
+}
@@ -0,0 +1,97 @@
+// Package redact removes personal data from execution payloads and messages before they leave
+// the installation, e.g. to data warehouses or shared links
+package redact
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// Value replaces personal data
+const Value = "[REDACTED]"
+
+// DefaultFields are the payload fields always redacted: fields whose name contains one of them
+// (case-insensitive) are replaced
+var DefaultFields = []string{
+	"email", "phone", "password", "passwd", "secret", "token", "api_key", "apikey", "authorization",
+	"cookie", "ssn", "iban", "card", "address", "birth", "first_name", "last_name", "full_name",
+}
+
+// emailPattern matches email addresses in free text like error messages
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// Redaction removes personal data from payloads and messages
+type Redaction struct {
+	fields []string
+}
+
+// New returns the redaction of the default fields and the given ones
+func New(fields ...string) *Redaction {
+	r := &Redaction{fields: DefaultFields}
+	if len(fields) == 0 {
+		return r
+	}
+	r.fields = append([]string(nil), DefaultFields...)
+	for _, field := range fields {
+		r.fields = append(r.fields, strings.ToLower(field))
+	}
+	return r
+}
+
+// Text redacts the email addresses of a message
+func (r *Redaction) Text(s string) string {
+	return emailPattern.ReplaceAllString(s, Value)
+}
+
+// Payload redacts a JSON document, payloads that are no valid JSON are dropped
+func (r *Redaction) Payload(data string) interface{} {
+	if data == "" {
+		return nil
+	}
+	var value interface{}
+	if err := json.Unmarshal([]byte(data), &value); err != nil {
+		return nil
+	}
+	redacted, err := json.Marshal(r.Value(value))
+	if err != nil {
+		return nil
+	}
+	return string(redacted)
+}
+
+// Value redacts a decoded JSON value
+func (r *Redaction) Value(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if r.sensitive(key) {
+				redacted[key] = Value
+			} else {
+				redacted[key] = r.Value(item)
+			}
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = r.Value(item)
+		}
+		return redacted
+	case string:
+		return r.Text(v)
+	default:
+		return value
+	}
+}
+
+func (r *Redaction) sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, field := range r.fields {
+		if strings.Contains(key, field) {
+			return true
+		}
+	}
+	return false
+}
@@ -8,17 +8,17 @@ import (
 // WorkflowRepository contains all database operations for workflows
 type WorkflowRepository struct{}
 
-// FindAll returns all workflows
+// FindAll returns all workflows, without their published versions
 func (r *WorkflowRepository) FindAll() ([]models.Workflow, error) {
     var workflows []models.Workflow
-    result := database.DB.Find(&workflows)
+    result := database.DB.Where("parent_id IS NULL").Find(&workflows)
     return workflows, result.Error
 }
 
 // FindByID returns a workflow by its ID
 func (r *WorkflowRepository) FindByID(id uint) (models.Workflow, error) {
     var workflow models.Workflow
-    result := database.DB.Preload("Nodes").Preload("Connections").First(&workflow, id)
+    result := database.DB.Preload("Nodes").Preload("Connections").Preload("Groups").First(&workflow, id)
     return workflow, result.Error
 }
 
@@ -0,0 +1,289 @@
+// Package rollout publishes immutable versions of workflows and splits the executions started by
+// triggers between a live and a canary version
+package rollout
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"gorm.io/gorm"
+)
+
+// Rollout roles of a version
+const (
+	RoleLive   = "live"
+	RoleCanary = "canary"
+)
+
+// ErrVersion is returned when publishing a version of a published version
+var ErrVersion = errors.New("published versions cannot be published again")
+
+// ErrChangeNoteRequired is returned when publishing a version without change note while change
+// notes are required
+var ErrChangeNoteRequired = errors.New("a change note is required to publish a version")
+
+// ErrPin is returned when pinning a version of a node type the workflow does not use
+var ErrPin = errors.New("only node types used by the workflow can be pinned")
+
+var changeNoteRequired bool
+
+// ChangeNoteRequiredFromEnv reports whether publishing versions requires a change note
+// (REQUIRE_CHANGE_NOTES=true)
+func ChangeNoteRequiredFromEnv() bool {
+	return os.Getenv("REQUIRE_CHANGE_NOTES") == "true"
+}
+
+// ConfigureChangeNotes sets whether publishing versions requires a change note
+func ConfigureChangeNotes(required bool) {
+	changeNoteRequired = required
+}
+
+// Publish copies the workflow with its nodes, connections and groups into a new immutable version,
+// numbered after the versions published before. The change note and publisher are stored with
+// the version. The version pins the current versions of the node types it uses, or the versions
+// given in pins by node type key.
+func Publish(workflowID uint, changeNote string, pins map[string]string, publishedBy *uint) (*models.Workflow, error) {
+	changeNote = strings.TrimSpace(changeNote)
+	if changeNote == "" && changeNoteRequired {
+		return nil, ErrChangeNoteRequired
+	}
+
+	var version models.Workflow
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var workflow models.Workflow
+		if err := tx.Preload("Nodes").Preload("Connections").Preload("Groups").First(&workflow, workflowID).Error; err != nil {
+			return err
+		}
+		if workflow.ParentID != nil {
+			return ErrVersion
+		}
+
+		nodeTypeVersions, err := pinVersions(tx, workflow.Nodes, pins)
+		if err != nil {
+			return err
+		}
+
+		var latest int
+		if err := tx.Model(&models.Workflow{}).Unscoped().Where("parent_id = ?", workflow.ID).
+			Select("COALESCE(MAX(version), 0)").Row().Scan(&latest); err != nil {
+			return err
+		}
+
+		version = models.Workflow{
+			Name:             fmt.Sprintf("%s (v%d)", workflow.Name, latest+1),
+			Description:      workflow.Description,
+			CreatedBy:        workflow.CreatedBy,
+			OrganizationID:   workflow.OrganizationID,
+			IsActive:         true,
+			WorkflowData:     workflow.WorkflowData,
+			CaptureMode:      workflow.CaptureMode,
+			SampleRate:       workflow.SampleRate,
+			CaptureSlowAfter: workflow.CaptureSlowAfter,
+			CaptureSlowScore: workflow.CaptureSlowScore,
+			Tags:             workflow.Tags,
+			ParentID:         &workflow.ID,
+			Version:          latest + 1,
+			ChangeNote:       changeNote,
+			PublishedBy:      publishedBy,
+			NodeTypeVersions: nodeTypeVersions,
+		}
+		if version.WorkflowData == "" {
+			version.WorkflowData = "{}"
+		}
+		if err := tx.Create(&version).Error; err != nil {
+			return err
+		}
+
+		groupIDs := make(map[uint]uint, len(workflow.Groups))
+		for _, group := range workflow.Groups {
+			previousID := group.ID
+			group.ID = 0
+			group.WorkflowID = version.ID
+			if err := tx.Create(&group).Error; err != nil {
+				return err
+			}
+			groupIDs[previousID] = group.ID
+		}
+
+		// Copy the nodes first, then point the compensation nodes and connections at the copies
+		nodeIDs := make(map[uint]uint, len(workflow.Nodes))
+		copies := make([]models.Node, len(workflow.Nodes))
+		for i, node := range workflow.Nodes {
+			copies[i] = node
+			copies[i].ID = 0
+			copies[i].WorkflowID = version.ID
+			copies[i].CompensationNodeID = nil
+			if node.GroupID != nil {
+				groupID := groupIDs[*node.GroupID]
+				copies[i].GroupID = &groupID
+			}
+			if err := tx.Create(&copies[i]).Error; err != nil {
+				return err
+			}
+			nodeIDs[node.ID] = copies[i].ID
+		}
+		for i, node := range workflow.Nodes {
+			if node.CompensationNodeID == nil {
+				continue
+			}
+			compensationID := nodeIDs[*node.CompensationNodeID]
+			if err := tx.Model(&copies[i]).Update("compensation_node_id", compensationID).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, connection := range workflow.Connections {
+			connection.ID = 0
+			connection.WorkflowID = version.ID
+			connection.SourceNodeID = nodeIDs[connection.SourceNodeID]
+			connection.TargetNodeID = nodeIDs[connection.TargetNodeID]
+			if err := tx.Create(&connection).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+// Versions returns the published versions of a workflow, newest first
+func Versions(workflowID uint) ([]models.Workflow, error) {
+	var versions []models.Workflow
+	err := database.DB.Where("parent_id = ?", workflowID).Order("version DESC").Find(&versions).Error
+	return versions, err
+}
+
+// Validate checks that the versions of a rollout were published from the workflow
+func Validate(workflow models.Workflow, request models.RolloutRequest) error {
+	if request.CanaryPercent < 0 || request.CanaryPercent > 100 {
+		return errors.New("canary_percent must be between 0 and 100")
+	}
+	if request.CanaryVersionID != nil && request.LiveVersionID == nil {
+		return errors.New("a canary version requires a live version")
+	}
+	if request.CanaryVersionID != nil && *request.CanaryVersionID == *request.LiveVersionID {
+		return errors.New("the canary version must differ from the live version")
+	}
+
+	for _, id := range []*uint{request.LiveVersionID, request.CanaryVersionID} {
+		if id == nil {
+			continue
+		}
+		var count int64
+		database.DB.Model(&models.Workflow{}).Where("id = ? AND parent_id = ?", *id, workflow.ID).Count(&count)
+		if count == 0 {
+			return fmt.Errorf("workflow %d is not a version of workflow %d", *id, workflow.ID)
+		}
+	}
+	return nil
+}
+
+// Target returns the workflow an execution started by a trigger of the workflow runs: the canary
+// version for CanaryPercent of the executions, otherwise the live version. Workflows without a
+// live version run themselves.
+func Target(workflow models.Workflow) (models.Workflow, error) {
+	if workflow.LiveVersionID == nil {
+		return workflow, nil
+	}
+
+	versionID := *workflow.LiveVersionID
+	if workflow.CanaryVersionID != nil && rand.Intn(100) < workflow.CanaryPercent {
+		versionID = *workflow.CanaryVersionID
+	}
+
+	var version models.Workflow
+	if err := database.DB.First(&version, versionID).Error; err != nil {
+		return workflow, fmt.Errorf("failed to load version %d of workflow %d: %v", versionID, workflow.ID, err)
+	}
+	return version, nil
+}
+
+// Stats summarizes the executions of the live and canary version of a workflow since the given time
+func Stats(workflow models.Workflow, since time.Time) ([]models.VersionStats, error) {
+	roles := []struct {
+		role string
+		id   *uint
+	}{
+		{RoleLive, workflow.LiveVersionID},
+		{RoleCanary, workflow.CanaryVersionID},
+	}
+
+	var stats []models.VersionStats
+	for _, r := range roles {
+		if r.id == nil {
+			continue
+		}
+
+		var version models.Workflow
+		if err := database.DB.Unscoped().First(&version, *r.id).Error; err != nil {
+			return nil, err
+		}
+
+		row := database.DB.Model(&models.WorkflowExecution{}).
+			Where("workflow_id = ? AND created_at >= ?", version.ID, since).
+			Select(`COUNT(*),
+				COUNT(*) FILTER (WHERE status = 'completed'),
+				COUNT(*) FILTER (WHERE status = 'failed'),
+				COALESCE(AVG(EXTRACT(EPOCH FROM (completed_at - started_at)) * 1000) FILTER (WHERE completed_at IS NOT NULL), 0)`).
+			Row()
+
+		s := models.VersionStats{VersionID: version.ID, Version: version.Version, Role: r.role}
+		if err := row.Scan(&s.Executions, &s.Completed, &s.Failed, &s.AvgDurationMs); err != nil {
+			return nil, err
+		}
+		if finished := s.Completed + s.Failed; finished > 0 {
+			s.ErrorRate = float64(s.Failed) / float64(finished)
+		}
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
+
+// pinVersions returns the node type versions pinned by a version with the nodes as JSON: the
+// versions given in pins, else the current versions of the node types
+func pinVersions(tx *gorm.DB, nodes []models.Node, pins map[string]string) (string, error) {
+	keys := map[string]bool{}
+	for _, node := range nodes {
+		keys[node.NodeType] = true
+	}
+	for key := range pins {
+		if !keys[key] {
+			return "", fmt.Errorf("%w: %s", ErrPin, key)
+		}
+	}
+
+	versions := map[string]string{}
+	if len(keys) > 0 {
+		var nodeTypes []models.NodeType
+		list := make([]string, 0, len(keys))
+		for key := range keys {
+			list = append(list, key)
+		}
+		if err := tx.Where("key IN ?", list).Find(&nodeTypes).Error; err != nil {
+			return "", err
+		}
+		for _, nodeType := range nodeTypes {
+			if nodeType.Version != "" {
+				versions[nodeType.Key] = nodeType.Version
+			}
+		}
+	}
+	for key, version := range pins {
+		if version = strings.TrimSpace(version); version != "" {
+			versions[key] = version
+		}
+	}
+
+	data, err := json.Marshal(versions)
+	return string(data), err
+}
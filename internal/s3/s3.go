@@ -0,0 +1,139 @@
+// Package s3 reads and writes objects of S3 compatible object stores. Requests are signed with
+// AWS Signature Version 4 using the credentials in AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/cloudauth"
+)
+
+// ErrNoCredentials is returned if the AWS credentials are not set
+var ErrNoCredentials = errors.New("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required")
+
+// ErrNotFound is returned for objects that don't exist
+var ErrNotFound = errors.New("object not found")
+
+// Bucket is a bucket of an S3 compatible object store
+type Bucket struct {
+	Name string
+	// Region defaults to us-east-1
+	Region string
+	// Endpoint of S3 compatible stores, by default the AWS endpoint of the region
+	Endpoint string
+}
+
+// URL returns the s3:// URL of an object
+func (b Bucket) URL(key string) string {
+	return fmt.Sprintf("s3://%s/%s", b.Name, key)
+}
+
+// Put uploads an object
+func (b Bucket) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	resp, err := b.do(ctx, http.MethodPut, key, body, contentType)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// Get downloads an object
+func (b Bucket) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := b.do(ctx, http.MethodGet, key, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Delete removes an object
+func (b Bucket) Delete(ctx context.Context, key string) error {
+	resp, err := b.do(ctx, http.MethodDelete, key, nil, "")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// do sends a signed request for an object. Responses with a status code of 300 or above are
+// returned as errors.
+func (b Bucket) do(ctx context.Context, method, key string, body []byte, contentType string) (*http.Response, error) {
+	region := b.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := b.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil, ErrNoCredentials
+	}
+
+	// Path-style addressing works with AWS and S3 compatible stores alike
+	endpointURL, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint: %v", err)
+	}
+	canonicalURI := "/" + awsURIEncode(b.Name) + "/" + awsURIEncode(key)
+	endpointURL.RawPath = endpointURL.Path + canonicalURI
+	endpointURL.Path = endpointURL.Path + "/" + b.Name + "/" + key
+
+	req, err := http.NewRequestWithContext(ctx, method, endpointURL.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("X-Amz-Content-Sha256", cloudauth.PayloadHash(body))
+	credentials := cloudauth.AWSCredentials{AccessKeyID: accessKey, SecretAccessKey: secretKey, SessionToken: os.Getenv("AWS_SESSION_TOKEN")}
+	credentials.SignV4(req, "s3", region, body, time.Now())
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %v", err)
+	}
+	if resp.StatusCode == http.StatusNotFound && method == http.MethodGet {
+		resp.Body.Close()
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("s3 returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+	return resp, nil
+}
+
+// awsURIEncode encodes a path as required by Signature Version 4: everything except
+// unreserved characters and slashes is percent-encoded
+func awsURIEncode(path string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(path) {
+		if b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || b >= '0' && b <= '9' ||
+			b == '-' || b == '_' || b == '.' || b == '~' || b == '/' {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
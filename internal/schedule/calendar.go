@@ -0,0 +1,64 @@
+package schedule
+
+import (
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// Calendar decides on which days schedules run: the time zone they are evaluated in, the
+// holidays that are no business days and whether runs on other days are skipped
+type Calendar struct {
+	Location         *time.Location
+	Holidays         map[string]bool // dates as YYYY-MM-DD
+	BusinessDaysOnly bool
+}
+
+// IsBusinessDay reports whether the day is neither a weekend day nor a holiday
+func (c *Calendar) IsBusinessDay(date time.Time) bool {
+	if date.Weekday() == time.Saturday || date.Weekday() == time.Sunday {
+		return false
+	}
+	return !c.Holidays[date.Format("2006-01-02")]
+}
+
+// lastBusinessDay returns the day of the last business day of the month
+func (c *Calendar) lastBusinessDay(year int, month time.Month) int {
+	date := time.Date(year, month+1, 0, 0, 0, 0, 0, c.Location)
+	for date.Month() == month {
+		if c.IsBusinessDay(date) {
+			return date.Day()
+		}
+		date = date.AddDate(0, 0, -1)
+	}
+	return 0
+}
+
+// CalendarFor builds the calendar of a trigger of a workflow: the trigger's time zone (UTC if not
+// set) and the holidays of the workflow's organization
+func CalendarFor(trigger models.Trigger, workflow models.Workflow) (*Calendar, error) {
+	location := time.UTC
+	if trigger.Timezone != "" {
+		var err error
+		if location, err = time.LoadLocation(trigger.Timezone); err != nil {
+			return nil, err
+		}
+	}
+
+	var holidays []models.Holiday
+	err := database.DB.Where("organization_id = ?", workflow.OrganizationID).Find(&holidays).Error
+	if err != nil {
+		return nil, err
+	}
+
+	calendar := &Calendar{
+		Location:         location,
+		Holidays:         make(map[string]bool, len(holidays)),
+		BusinessDaysOnly: trigger.BusinessDaysOnly,
+	}
+	for _, holiday := range holidays {
+		calendar.Holidays[holiday.Date] = true
+	}
+	return calendar, nil
+}
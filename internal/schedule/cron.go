@@ -0,0 +1,222 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Expression is a parsed cron expression with the fields minute, hour, day of month, month and
+// day of week. The day of month can be L (last day of the month) or LW (last business day of
+// the month).
+type Expression struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+	lastDay, lastBusinessDay      bool
+}
+
+// field describes the range of a cron field and the names allowed in it
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	minuteField = field{name: "minute", min: 0, max: 59}
+	hourField   = field{name: "hour", min: 0, max: 23}
+	domField    = field{name: "day of month", min: 1, max: 31}
+	monthField  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+		"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+	}}
+	// Sunday is 0 or 7
+	dowField = field{name: "day of week", min: 0, max: 7, names: map[string]int{
+		"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+	}}
+)
+
+// descriptors are the shorthands for common expressions
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a cron expression with five fields or one of the descriptors @yearly, @monthly,
+// @weekly, @daily and @hourly
+func Parse(expr string) (*Expression, error) {
+	expr = strings.TrimSpace(expr)
+	if descriptor, ok := descriptors[strings.ToLower(expr)]; ok {
+		expr = descriptor
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have 5 fields, got %d", len(fields))
+	}
+
+	var e Expression
+	var err error
+	if e.minute, err = parseField(fields[0], minuteField); err != nil {
+		return nil, err
+	}
+	if e.hour, err = parseField(fields[1], hourField); err != nil {
+		return nil, err
+	}
+
+	switch strings.ToUpper(fields[2]) {
+	case "L":
+		e.lastDay = true
+	case "LW":
+		e.lastBusinessDay = true
+	default:
+		if e.dom, err = parseField(fields[2], domField); err != nil {
+			return nil, err
+		}
+		e.domAny = fields[2] == "*" || fields[2] == "?"
+	}
+
+	if e.month, err = parseField(fields[3], monthField); err != nil {
+		return nil, err
+	}
+	if e.dow, err = parseField(fields[4], dowField); err != nil {
+		return nil, err
+	}
+	if e.dow&(1<<7) != 0 {
+		e.dow |= 1
+	}
+	e.dowAny = fields[4] == "*" || fields[4] == "?"
+
+	return &e, nil
+}
+
+// parseField parses a comma separated list of values, ranges and steps into a bit set
+func parseField(value string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(value, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			rangePart = part[:i]
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step in %s field: %s", f.name, part)
+			}
+			step = n
+		}
+
+		start, end := f.min, f.max
+		switch {
+		case rangePart == "*" || rangePart == "?":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if start, err = f.value(bounds[0]); err != nil {
+				return 0, err
+			}
+			if end, err = f.value(bounds[1]); err != nil {
+				return 0, err
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range in %s field: %s", f.name, part)
+			}
+		default:
+			n, err := f.value(rangePart)
+			if err != nil {
+				return 0, err
+			}
+			start = n
+			if step == 1 {
+				end = n
+			}
+		}
+
+		for i := start; i <= end; i += step {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+// value parses a number or name of the field
+func (f field) value(s string) (int, error) {
+	if n, ok := f.names[strings.ToUpper(s)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < f.min || n > f.max {
+		return 0, fmt.Errorf("invalid value in %s field: %s", f.name, s)
+	}
+	return n, nil
+}
+
+// maxSearchDays bounds the search for the next time, expressions like "0 0 30 2 *" never match
+const maxSearchDays = 5 * 366
+
+// Next returns the first time after the given time matching the expression, evaluated in the
+// location of the calendar. Days the calendar excludes are skipped. Returns the zero time if
+// the expression matches no time within five years.
+func (e *Expression) Next(after time.Time, calendar *Calendar) time.Time {
+	after = after.In(calendar.Location)
+	day := time.Date(after.Year(), after.Month(), after.Day(), 0, 0, 0, 0, calendar.Location)
+
+	for i := 0; i < maxSearchDays; i++ {
+		date := day.AddDate(0, 0, i)
+		if !e.matchesDay(date, calendar) {
+			continue
+		}
+
+		for hour := 0; hour < 24; hour++ {
+			if e.hour&(1<<uint(hour)) == 0 {
+				continue
+			}
+			for minute := 0; minute < 60; minute++ {
+				if e.minute&(1<<uint(minute)) == 0 {
+					continue
+				}
+				t := time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, calendar.Location)
+				// Times skipped by a daylight saving transition are normalized into the next hour
+				if t.After(after) && t.Day() == date.Day() {
+					return t
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
+
+// matchesDay reports whether the expression runs on the given day. If both the day of month and
+// the day of week are restricted, either of them has to match, as in standard cron.
+func (e *Expression) matchesDay(date time.Time, calendar *Calendar) bool {
+	if e.month&(1<<uint(date.Month())) == 0 {
+		return false
+	}
+	if calendar.BusinessDaysOnly && !calendar.IsBusinessDay(date) {
+		return false
+	}
+
+	switch {
+	case e.lastDay:
+		return date.AddDate(0, 0, 1).Day() == 1
+	case e.lastBusinessDay:
+		return calendar.IsBusinessDay(date) && calendar.lastBusinessDay(date.Year(), date.Month()) == date.Day()
+	}
+
+	domMatch := e.dom&(1<<uint(date.Day())) != 0
+	dowMatch := e.dow&(1<<uint(date.Weekday())) != 0
+	switch {
+	case e.domAny && e.dowAny:
+		return true
+	case e.domAny:
+		return dowMatch
+	case e.dowAny:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
@@ -0,0 +1,234 @@
+package schedule
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+const (
+	// maxFeedRunsPerTrigger bounds the upcoming runs listed per trigger, e.g. of minutely schedules
+	maxFeedRunsPerTrigger = 200
+	// maxFeedResults bounds the recent executions listed
+	maxFeedResults = 1000
+	// minFeedEventDuration is the length of events of runs without a known typical duration
+	minFeedEventDuration = time.Minute
+	// icalTimeFormat is the format of UTC times in iCalendar
+	icalTimeFormat = "20060102T150405Z"
+)
+
+// FeedOptions selects the runs of a calendar feed
+type FeedOptions struct {
+	// OrganizationID restricts the feed to the workflows of an organization, 0 for all workflows
+	OrganizationID uint
+	// Horizon is how far ahead upcoming runs are listed
+	Horizon time.Duration
+	// History is how far back the results of scheduled executions are listed
+	History time.Duration
+}
+
+// feedEvent is an event of a calendar feed
+type feedEvent struct {
+	uid         string
+	start, end  time.Time
+	summary     string
+	description string
+	categories  string
+}
+
+// Feed renders an iCalendar feed of the upcoming runs of schedule triggers and one-off runs and
+// of the results of recent scheduled executions, for on-call engineers' calendar apps. Events
+// last for the typical duration of the workflow.
+func Feed(opts FeedOptions, now time.Time) (string, error) {
+	query := database.DB.Where("parent_id IS NULL")
+	if opts.OrganizationID != 0 {
+		query = query.Where("organization_id = ?", opts.OrganizationID)
+	}
+	var workflows []models.Workflow
+	if err := query.Find(&workflows).Error; err != nil {
+		return "", err
+	}
+	byID := make(map[uint]models.Workflow, len(workflows))
+	workflowIDs := make([]uint, len(workflows))
+	for i, workflow := range workflows {
+		byID[workflow.ID] = workflow
+		workflowIDs[i] = workflow.ID
+	}
+
+	var baselines []models.DurationBaseline
+	err := database.DB.Where("workflow_id IN ? AND node_id = 0", workflowIDs).Find(&baselines).Error
+	if err != nil {
+		return "", err
+	}
+	typical := make(map[uint]time.Duration, len(baselines))
+	for _, baseline := range baselines {
+		typical[baseline.WorkflowID] = time.Duration(baseline.TypicalMs()) * time.Millisecond
+	}
+	eventEnd := func(workflowID uint, start time.Time) time.Time {
+		if duration := typical[workflowID]; duration > minFeedEventDuration {
+			return start.Add(duration)
+		}
+		return start.Add(minFeedEventDuration)
+	}
+
+	var events []feedEvent
+	until := now.Add(opts.Horizon)
+
+	var triggers []models.Trigger
+	err = database.DB.Where("workflow_id IN ? AND trigger_type = ? AND is_active", workflowIDs, TriggerType).
+		Find(&triggers).Error
+	if err != nil {
+		return "", err
+	}
+	triggerIDs := make([]uint, len(triggers))
+	for i, trigger := range triggers {
+		triggerIDs[i] = trigger.ID
+		workflow := byID[trigger.WorkflowID]
+		if !workflow.IsActive {
+			continue
+		}
+		expr, err := Parse(trigger.CronExpression)
+		if err != nil {
+			continue
+		}
+		calendar, err := CalendarFor(trigger, workflow)
+		if err != nil {
+			continue
+		}
+
+		next := now
+		for n := 0; n < maxFeedRunsPerTrigger; n++ {
+			next = expr.Next(next, calendar)
+			if next.IsZero() || next.After(until) {
+				break
+			}
+			events = append(events, feedEvent{
+				uid:         fmt.Sprintf("trigger-%d-%d@flowcraft", trigger.ID, next.Unix()),
+				start:       next,
+				end:         eventEnd(workflow.ID, next),
+				summary:     workflow.Name,
+				description: fmt.Sprintf("Scheduled run of trigger %q (%s)", trigger.Name, trigger.CronExpression),
+				categories:  "Scheduled",
+			})
+		}
+	}
+
+	var runs []models.ScheduledRun
+	err = database.DB.Where("workflow_id IN ? AND status = ? AND run_at >= ? AND run_at <= ?", workflowIDs, RunScheduled, now, until).
+		Find(&runs).Error
+	if err != nil {
+		return "", err
+	}
+	for _, run := range runs {
+		events = append(events, feedEvent{
+			uid:         fmt.Sprintf("scheduled-run-%d@flowcraft", run.ID),
+			start:       run.RunAt,
+			end:         eventEnd(run.WorkflowID, run.RunAt),
+			summary:     byID[run.WorkflowID].Name,
+			description: "One-off scheduled run",
+			categories:  "Scheduled",
+		})
+	}
+
+	// Executions started by schedule triggers or one-off runs, also of published versions
+	var executions []struct {
+		models.WorkflowExecution
+		RootID uint
+	}
+	err = database.DB.Model(&models.WorkflowExecution{}).
+		Select("workflow_executions.*, COALESCE(workflows.parent_id, workflows.id) AS root_id").
+		Joins("JOIN workflows ON workflows.id = workflow_executions.workflow_id").
+		Where("COALESCE(workflows.parent_id, workflows.id) IN ?", workflowIDs).
+		Where("workflow_executions.started_at >= ? AND workflow_executions.status NOT IN ?", now.Add(-opts.History), []string{"held", "queued", "pending"}).
+		Where("workflow_executions.trigger_id IN ? OR workflow_executions.id IN (?)", triggerIDs,
+			database.DB.Model(&models.ScheduledRun{}).Select("workflow_execution_id").Where("workflow_execution_id IS NOT NULL")).
+		Order("workflow_executions.started_at DESC").Limit(maxFeedResults).
+		Scan(&executions).Error
+	if err != nil {
+		return "", err
+	}
+	for _, execution := range executions {
+		end := now
+		if execution.CompletedAt != nil {
+			end = *execution.CompletedAt
+		}
+		if !end.After(execution.StartedAt) {
+			end = execution.StartedAt.Add(minFeedEventDuration)
+		}
+		description := fmt.Sprintf("Execution %d %s", execution.ID, execution.Status)
+		if execution.ErrorMessage != "" {
+			description += ": " + execution.ErrorMessage
+		}
+		events = append(events, feedEvent{
+			uid:         fmt.Sprintf("execution-%d@flowcraft", execution.ID),
+			start:       execution.StartedAt,
+			end:         end,
+			summary:     fmt.Sprintf("%s: %s", byID[execution.RootID].Name, execution.Status),
+			description: description,
+			categories:  "Result",
+		})
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].start.Before(events[j].start) })
+	return renderCalendar(events, now), nil
+}
+
+// renderCalendar renders events as an iCalendar document
+func renderCalendar(events []feedEvent, now time.Time) string {
+	var b strings.Builder
+	line := func(name, value string) {
+		b.WriteString(foldLine(name + ":" + value))
+		b.WriteString("\r\n")
+	}
+
+	line("BEGIN", "VCALENDAR")
+	line("VERSION", "2.0")
+	line("PRODID", "-//FlowCraft//Scheduled Runs//EN")
+	line("CALSCALE", "GREGORIAN")
+	line("X-WR-CALNAME", "FlowCraft")
+	stamp := now.UTC().Format(icalTimeFormat)
+	for _, event := range events {
+		line("BEGIN", "VEVENT")
+		line("UID", event.uid)
+		line("DTSTAMP", stamp)
+		line("DTSTART", event.start.UTC().Format(icalTimeFormat))
+		line("DTEND", event.end.UTC().Format(icalTimeFormat))
+		line("SUMMARY", escapeText(event.summary))
+		line("DESCRIPTION", escapeText(event.description))
+		line("CATEGORIES", escapeText(event.categories))
+		line("TRANSP", "TRANSPARENT")
+		line("END", "VEVENT")
+	}
+	line("END", "VCALENDAR")
+	return b.String()
+}
+
+// escapeText escapes a text value of iCalendar
+func escapeText(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(s)
+}
+
+// foldLine splits lines longer than 75 octets into continuation lines, between characters
+func foldLine(s string) string {
+	if len(s) <= 75 {
+		return s
+	}
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		size := utf8.RuneLen(r)
+		// Continuation lines start with a space, which counts towards their length
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	return b.String()
+}
@@ -0,0 +1,192 @@
+// Package schedule starts the executions of schedule triggers at the times of their cron
+// expressions, evaluated in the trigger's time zone and calendar, and of one-off scheduled runs
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/dispatch"
+	"github.com/altipard/flowcraft/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TriggerType is the type of triggers started by the scheduler
+const TriggerType = "schedule"
+
+// Statuses of one-off scheduled runs
+const (
+	RunScheduled = "scheduled"
+	RunStarted   = "started"
+	RunCancelled = "cancelled"
+	RunFailed    = "failed"
+)
+
+// NextRun returns the first run of a schedule trigger after the given time, or nil if its
+// expression never matches
+func NextRun(trigger models.Trigger, workflow models.Workflow, after time.Time) (*time.Time, error) {
+	expr, err := Parse(trigger.CronExpression)
+	if err != nil {
+		return nil, err
+	}
+	calendar, err := CalendarFor(trigger, workflow)
+	if err != nil {
+		return nil, err
+	}
+
+	next := expr.Next(after, calendar)
+	if next.IsZero() {
+		return nil, nil
+	}
+	return &next, nil
+}
+
+// Run starts the executions of due schedule triggers and one-off runs at the given interval until ctx is done.
+// Runs missed while no worker was running are not made up; the trigger continues with its next run.
+func Run(ctx context.Context, dispatcher *dispatch.Dispatcher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var triggers []models.Trigger
+		err := database.DB.Where("trigger_type = ? AND is_active = ? AND (next_run_at IS NULL OR next_run_at <= ?)", TriggerType, true, time.Now()).
+			Find(&triggers).Error
+		if err != nil {
+			log.Printf("Failed to load due schedule triggers: %v", err)
+			continue
+		}
+
+		for _, trigger := range triggers {
+			if err := runTrigger(dispatcher, trigger.ID); err != nil {
+				log.Printf("Failed to run schedule trigger %d: %v", trigger.ID, err)
+			}
+		}
+
+		var runs []models.ScheduledRun
+		err = database.DB.Where("status = ? AND run_at <= ?", RunScheduled, time.Now()).Order("run_at").Find(&runs).Error
+		if err != nil {
+			log.Printf("Failed to load due scheduled runs: %v", err)
+			continue
+		}
+
+		for _, run := range runs {
+			if err := startRun(dispatcher, run.ID); err != nil {
+				log.Printf("Failed to start scheduled run %d: %v", run.ID, err)
+			}
+		}
+	}
+}
+
+// runTrigger starts an execution of a due trigger and advances it to its next run. Triggers
+// without a next run yet are only advanced.
+func runTrigger(dispatcher *dispatch.Dispatcher, triggerID uint) error {
+	var trigger models.Trigger
+	var workflow models.Workflow
+	var scheduledAt *time.Time
+	now := time.Now()
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Skip triggers another worker is running at the same time
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("next_run_at IS NULL OR next_run_at <= ?", now).
+			Limit(1).Find(&trigger, triggerID)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		if err := tx.First(&workflow, trigger.WorkflowID).Error; err != nil {
+			return err
+		}
+
+		next, err := NextRun(trigger, workflow, now)
+		if err != nil {
+			return err
+		}
+		scheduledAt = trigger.NextRunAt
+		return tx.Model(&trigger).Update("next_run_at", next).Error
+	})
+	if err != nil || scheduledAt == nil {
+		return err
+	}
+
+	_, err = dispatcher.DispatchTrigger(workflow, trigger, map[string]interface{}{
+		"scheduled_at": scheduledAt.In(time.UTC).Format(time.RFC3339),
+		"trigger_id":   trigger.ID,
+	})
+	return err
+}
+
+// startRun starts the execution of a due one-off run. The run is claimed before the execution is
+// dispatched, so it is started at most once even if several workers see it.
+func startRun(dispatcher *dispatch.Dispatcher, runID uint) error {
+	now := time.Now()
+	result := database.DB.Model(&models.ScheduledRun{}).
+		Where("id = ? AND status = ?", runID, RunScheduled).
+		Updates(map[string]interface{}{"status": RunStarted, "started_at": now})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	var run models.ScheduledRun
+	if err := database.DB.First(&run, runID).Error; err != nil {
+		return err
+	}
+
+	execution, err := startExecution(dispatcher, run)
+	if err != nil {
+		database.DB.Model(&run).Updates(map[string]interface{}{"status": RunFailed, "error_message": err.Error()})
+		return err
+	}
+	return database.DB.Model(&run).Update("workflow_execution_id", execution.ID).Error
+}
+
+// startExecution dispatches the execution of a scheduled run with its input
+func startExecution(dispatcher *dispatch.Dispatcher, run models.ScheduledRun) (*models.WorkflowExecution, error) {
+	var workflow models.Workflow
+	if err := database.DB.First(&workflow, run.WorkflowID).Error; err != nil {
+		return nil, err
+	}
+
+	var input map[string]interface{}
+	if err := json.Unmarshal([]byte(run.InputData), &input); err != nil {
+		return nil, err
+	}
+	return dispatcher.Dispatch(workflow, input)
+}
+
+// Reschedule recomputes the next runs of the schedule triggers of an organization's workflows,
+// e.g. after its holidays changed
+func Reschedule(organizationID uint) error {
+	var workflows []models.Workflow
+	if err := database.DB.Where("organization_id = ?", organizationID).Find(&workflows).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, workflow := range workflows {
+		var triggers []models.Trigger
+		if err := database.DB.Where("workflow_id = ? AND trigger_type = ?", workflow.ID, TriggerType).Find(&triggers).Error; err != nil {
+			return err
+		}
+		for _, trigger := range triggers {
+			next, err := NextRun(trigger, workflow, now)
+			if err != nil {
+				return err
+			}
+			if err := database.DB.Model(&trigger).Update("next_run_at", next).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
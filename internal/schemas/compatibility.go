@@ -0,0 +1,110 @@
+package schemas
+
+import (
+	"fmt"
+
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// Compatible returns the changes of a new schema version breaking the compatibility mode with the
+// previous version, none if it is compatible. The comparison is structural: it covers types,
+// enums, required and undefined fields, nested objects and array items, and bounds.
+func Compatible(previous, next map[string]interface{}, mode string) []string {
+	var problems []string
+	if mode == models.CompatibilityForward || mode == models.CompatibilityFull {
+		// Payloads of the new version must be valid under the previous one
+		subset(next, previous, "", "the new version", &problems)
+	}
+	if mode == models.CompatibilityBackward || mode == models.CompatibilityFull {
+		// Payloads of the previous version must be valid under the new one
+		subset(previous, next, "", "the previous version", &problems)
+	}
+	return problems
+}
+
+// subset adds the problems preventing every value valid under narrow from being valid under
+// wide; who names the version of narrow
+func subset(narrow, wide map[string]interface{}, path, who string, problems *[]string) {
+	report := func(format string, args ...interface{}) {
+		*problems = append(*problems, fmt.Sprintf("%s: %s", at(path), fmt.Sprintf(format, args...)))
+	}
+
+	if wideTypes := typesOf(wide); len(wideTypes) > 0 {
+		narrowTypes := typesOf(narrow)
+		if len(narrowTypes) == 0 {
+			report("payloads of %s may have any type, not only %v", who, wideTypes)
+			return
+		}
+		for _, t := range narrowTypes {
+			if !allowsType(wideTypes, t) {
+				report("type %s of payloads of %s is not allowed by %v", t, who, wideTypes)
+				return
+			}
+		}
+	}
+
+	if wideEnum, ok := wide["enum"].([]interface{}); ok {
+		narrowEnum, ok := narrow["enum"].([]interface{})
+		if !ok {
+			report("payloads of %s may have values other than %v", who, wideEnum)
+		}
+		for _, value := range narrowEnum {
+			if !contains(wideEnum, value) {
+				report("value %v of payloads of %s is not one of %v", value, who, wideEnum)
+			}
+		}
+	}
+
+	narrowRequired := map[string]bool{}
+	for _, name := range stringList(narrow["required"]) {
+		narrowRequired[name] = true
+	}
+	for _, name := range stringList(wide["required"]) {
+		if !narrowRequired[name] {
+			report("required field %s may be missing in payloads of %s", name, who)
+		}
+	}
+
+	narrowProperties, wideProperties := object(narrow["properties"]), object(wide["properties"])
+	for _, name := range sortedKeys(narrowProperties) {
+		if property, ok := wideProperties[name]; ok {
+			subset(object(narrowProperties[name]), object(property), join(path, name), who, problems)
+		} else if closed(wide) {
+			report("field %s is not allowed by additionalProperties false", name)
+		}
+	}
+	if closed(wide) && !closed(narrow) {
+		report("payloads of %s may have fields other than the defined ones", who)
+	}
+
+	if wideItems, ok := wide["items"].(map[string]interface{}); ok {
+		subset(object(narrow["items"]), wideItems, path+"[]", who, problems)
+	}
+
+	for _, bound := range []struct {
+		keyword string
+		lower   bool
+	}{{"minimum", true}, {"maximum", false}, {"minLength", true}, {"maxLength", false}} {
+		wideBound, ok := number(wide[bound.keyword])
+		if !ok {
+			continue
+		}
+		narrowBound, ok := number(narrow[bound.keyword])
+		if !ok || (bound.lower && narrowBound < wideBound) || (!bound.lower && narrowBound > wideBound) {
+			report("%s %v is not guaranteed", bound.keyword, wideBound)
+		}
+	}
+	if pattern, ok := wide["pattern"].(string); ok && narrow["pattern"] != pattern {
+		report("pattern %s is not guaranteed", pattern)
+	}
+}
+
+// allowsType reports whether the types include t; integers are numbers as well
+func allowsType(types []string, t string) bool {
+	for _, allowed := range types {
+		if allowed == t || (allowed == "number" && t == "integer") {
+			return true
+		}
+	}
+	return false
+}
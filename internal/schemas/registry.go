@@ -0,0 +1,176 @@
+// Package schemas is the registry of payload schemas: named, versioned JSON schemas serving as
+// contracts of the payloads of events and the requests of triggers. New versions are checked for
+// compatibility with the previous version, so producers cannot silently break the workflows
+// consuming their payloads.
+package schemas
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"gorm.io/gorm"
+)
+
+// namePattern restricts schema names, e.g. to the names of events like order.created
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:-]{0,127}$`)
+
+// ErrNotFound is returned for schemas or versions that are not registered
+var ErrNotFound = errors.New("schema not found")
+
+// IncompatibleError is returned when a new version breaks the compatibility mode of the schema
+type IncompatibleError struct {
+	Result models.SchemaCompatibility
+}
+
+func (e *IncompatibleError) Error() string {
+	return fmt.Sprintf("schema %s is not %s compatible with version %d: %s",
+		e.Result.Name, e.Result.Compatibility, e.Result.PreviousVersion, strings.Join(e.Result.Problems, "; "))
+}
+
+// InvalidPayloadError is returned for payloads not matching their schema
+type InvalidPayloadError struct {
+	Name     string
+	Version  int
+	Problems []string
+}
+
+func (e *InvalidPayloadError) Error() string {
+	return fmt.Sprintf("payload does not match schema %s version %d: %s", e.Name, e.Version, strings.Join(e.Problems, "; "))
+}
+
+// Latest returns the latest version of a schema, ErrNotFound if none is registered
+func Latest(name string) (*models.PayloadSchema, error) {
+	return Get(name, 0)
+}
+
+// Get returns a version of a schema, the latest for version 0
+func Get(name string, version int) (*models.PayloadSchema, error) {
+	query := database.DB.Where("name = ?", name)
+	if version > 0 {
+		query = query.Where("version = ?", version)
+	}
+	var schema models.PayloadSchema
+	if query.Order("version DESC").Limit(1).Find(&schema).RowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+	return &schema, nil
+}
+
+// CheckCompatibility checks a new version of a schema against the latest registered version
+func CheckCompatibility(request models.PayloadSchemaRequest) (models.SchemaCompatibility, error) {
+	result := models.SchemaCompatibility{Name: request.Name, Compatibility: request.Compatibility, Compatible: true, Problems: []string{}}
+	if !namePattern.MatchString(request.Name) {
+		return result, errors.New("name must be 1 to 128 letters, digits or ._:- characters")
+	}
+	if request.Schema == nil {
+		return result, errors.New("schema is required")
+	}
+	if err := Check(request.Schema); err != nil {
+		return result, fmt.Errorf("invalid schema: %v", err)
+	}
+
+	previous, err := Latest(request.Name)
+	if errors.Is(err, ErrNotFound) {
+		if result.Compatibility == "" {
+			result.Compatibility = models.CompatibilityForward
+		}
+		return result, validateMode(result.Compatibility)
+	}
+	if result.Compatibility == "" {
+		result.Compatibility = previous.Compatibility
+	}
+	if err := validateMode(result.Compatibility); err != nil {
+		return result, err
+	}
+
+	var previousSchema map[string]interface{}
+	if err := json.Unmarshal([]byte(previous.Schema), &previousSchema); err != nil {
+		return result, err
+	}
+	result.PreviousVersion = previous.Version
+	if problems := Compatible(previousSchema, request.Schema, result.Compatibility); len(problems) > 0 {
+		result.Compatible = false
+		result.Problems = problems
+	}
+	return result, nil
+}
+
+// validateMode checks a compatibility mode
+func validateMode(mode string) error {
+	switch mode {
+	case models.CompatibilityForward, models.CompatibilityBackward, models.CompatibilityFull, models.CompatibilityNone:
+		return nil
+	}
+	return fmt.Errorf("compatibility must be forward, backward, full or none")
+}
+
+// Register stores a new version of a schema if it is compatible with the previous version. It
+// returns an *IncompatibleError otherwise.
+func Register(request models.PayloadSchemaRequest, userID *uint) (*models.PayloadSchema, error) {
+	schemaJSON, err := json.Marshal(request.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	var schema *models.PayloadSchema
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		// Versions of the same schema are registered one after the other
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "schema:"+request.Name).Error; err != nil {
+			return err
+		}
+		result, err := CheckCompatibility(request)
+		if err != nil {
+			return err
+		}
+		if !result.Compatible {
+			return &IncompatibleError{Result: result}
+		}
+
+		schema = &models.PayloadSchema{
+			Name:          request.Name,
+			Version:       result.PreviousVersion + 1,
+			Schema:        string(schemaJSON),
+			Compatibility: result.Compatibility,
+			Description:   request.Description,
+			CreatedBy:     userID,
+		}
+		return tx.Create(schema).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// ValidatePayload checks a payload against a version of a schema, the latest for version 0. It
+// returns the version checked against and an *InvalidPayloadError if the payload does not match.
+func ValidatePayload(name string, version int, payload interface{}) (int, error) {
+	schema, err := Get(name, version)
+	if err != nil {
+		return 0, err
+	}
+	var definition map[string]interface{}
+	if err := json.Unmarshal([]byte(schema.Schema), &definition); err != nil {
+		return 0, err
+	}
+
+	// Payloads are compared in their JSON form, e.g. with numbers as float64
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return 0, err
+	}
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return 0, err
+	}
+
+	if problems := Validate(definition, value); len(problems) > 0 {
+		return schema.Version, &InvalidPayloadError{Name: name, Version: schema.Version, Problems: problems}
+	}
+	return schema.Version, nil
+}
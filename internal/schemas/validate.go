@@ -0,0 +1,211 @@
+package schemas
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// types are the JSON schema types
+var types = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true, "integer": true, "boolean": true, "null": true,
+}
+
+// Check reports the first problem making the schema unusable, e.g. an unknown type or an invalid
+// pattern, nil if there is none
+func Check(schema map[string]interface{}) error {
+	return check(schema, "")
+}
+
+func check(schema map[string]interface{}, path string) error {
+	for _, t := range typesOf(schema) {
+		if !types[t] {
+			return fmt.Errorf("%s: unknown type %q", at(path), t)
+		}
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("%s: invalid pattern: %v", at(path), err)
+		}
+	}
+	for name, property := range object(schema["properties"]) {
+		if err := check(object(property), join(path, name)); err != nil {
+			return err
+		}
+	}
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		if err := check(items, path+"[]"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate returns the problems of a JSON value (as decoded by encoding/json) with the schema,
+// none if it is valid
+func Validate(schema map[string]interface{}, value interface{}) []string {
+	var problems []string
+	validate(schema, value, "", &problems)
+	return problems
+}
+
+func validate(schema map[string]interface{}, value interface{}, path string, problems *[]string) {
+	if allowed := typesOf(schema); len(allowed) > 0 && !hasType(allowed, value) {
+		*problems = append(*problems, fmt.Sprintf("%s: expected %s, got %s", at(path), strings.Join(allowed, " or "), typeOf(value)))
+		return
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok && !contains(enum, value) {
+		*problems = append(*problems, fmt.Sprintf("%s: %v is not one of %v", at(path), value, enum))
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		properties := object(schema["properties"])
+		for _, name := range stringList(schema["required"]) {
+			if _, ok := v[name]; !ok {
+				*problems = append(*problems, fmt.Sprintf("%s: missing required field", at(join(path, name))))
+			}
+		}
+		for _, name := range sortedKeys(v) {
+			if property, ok := properties[name]; ok {
+				validate(object(property), v[name], join(path, name), problems)
+			} else if closed(schema) {
+				*problems = append(*problems, fmt.Sprintf("%s: unexpected field", at(join(path, name))))
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				validate(items, item, fmt.Sprintf("%s[%d]", path, i), problems)
+			}
+		}
+	case float64:
+		if minimum, ok := number(schema["minimum"]); ok && v < minimum {
+			*problems = append(*problems, fmt.Sprintf("%s: %v is less than %v", at(path), v, minimum))
+		}
+		if maximum, ok := number(schema["maximum"]); ok && v > maximum {
+			*problems = append(*problems, fmt.Sprintf("%s: %v is greater than %v", at(path), v, maximum))
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if minLength, ok := number(schema["minLength"]); ok && length < minLength {
+			*problems = append(*problems, fmt.Sprintf("%s: shorter than %v characters", at(path), minLength))
+		}
+		if maxLength, ok := number(schema["maxLength"]); ok && length > maxLength {
+			*problems = append(*problems, fmt.Sprintf("%s: longer than %v characters", at(path), maxLength))
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err == nil && !re.MatchString(v) {
+				*problems = append(*problems, fmt.Sprintf("%s: does not match %s", at(path), pattern))
+			}
+		}
+	}
+}
+
+// typesOf returns the types allowed by a schema, none if it allows any
+func typesOf(schema map[string]interface{}) []string {
+	switch t := schema["type"].(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		return stringList(t)
+	}
+	return nil
+}
+
+// typeOf returns the JSON schema type of a value, integer for whole numbers
+func typeOf(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// hasType reports whether the value has one of the types; integers are numbers as well
+func hasType(allowed []string, value interface{}) bool {
+	actual := typeOf(value)
+	for _, t := range allowed {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// closed reports whether a schema rejects fields it does not define
+func closed(schema map[string]interface{}) bool {
+	additional, ok := schema["additionalProperties"].(bool)
+	return ok && !additional
+}
+
+// contains reports whether the list contains the value, comparing like encoding/json decodes
+func contains(list []interface{}, value interface{}) bool {
+	for _, item := range list {
+		if fmt.Sprintf("%T:%v", item, item) == fmt.Sprintf("%T:%v", value, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func object(value interface{}) map[string]interface{} {
+	m, _ := value.(map[string]interface{})
+	return m
+}
+
+func number(value interface{}) (float64, bool) {
+	n, ok := value.(float64)
+	return n, ok
+}
+
+func stringList(value interface{}) []string {
+	list, _ := value.([]interface{})
+	var result []string
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// at names a path in problems, the root being the payload itself
+func at(path string) string {
+	if path == "" {
+		return "payload"
+	}
+	return path
+}
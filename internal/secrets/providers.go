@@ -0,0 +1,119 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/cloudauth"
+)
+
+// fetchVault reads a secret from the KV v2 engine, e.g. "flowcraft/stripe" in the mount "secret"
+func (c Config) fetchVault(ctx context.Context, ref string) (string, error) {
+	endpoint := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimSuffix(c.VaultAddr, "/"), c.VaultMount, strings.TrimPrefix(ref, "/"))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", c.VaultToken)
+	if c.VaultNamespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.VaultNamespace)
+	}
+
+	var response struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := getJSON(req, &response); err != nil {
+		return "", err
+	}
+	if response.Data.Data == nil {
+		return "", errors.New("secret has no data")
+	}
+	value, err := json.Marshal(response.Data.Data)
+	return string(value), err
+}
+
+// fetchAWS reads a secret from AWS Secrets Manager by name or ARN
+func (c Config) fetchAWS(ctx context.Context, ref string) (string, error) {
+	host := fmt.Sprintf("secretsmanager.%s.amazonaws.com", c.AWSRegion)
+	body, _ := json.Marshal(map[string]string{"SecretId": ref})
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	credentials := cloudauth.AWSCredentials{AccessKeyID: c.AWSAccessKeyID, SecretAccessKey: c.AWSSecretAccessKey, SessionToken: c.AWSSessionToken}
+	credentials.SignV4(req, "secretsmanager", c.AWSRegion, body, time.Now())
+
+	var response struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary string `json:"SecretBinary"`
+	}
+	if err := getJSON(req, &response); err != nil {
+		return "", err
+	}
+	if response.SecretString == "" && response.SecretBinary != "" {
+		decoded, err := base64.StdEncoding.DecodeString(response.SecretBinary)
+		return string(decoded), err
+	}
+	return response.SecretString, nil
+}
+
+// fetchGCP reads a secret version from GCP Secret Manager. References are secret names of the
+// configured project, optionally with a version ("stripe@3", default latest), or full resource
+// names ("projects/p/secrets/stripe/versions/3").
+func (c Config) fetchGCP(ctx context.Context, ref string) (string, error) {
+	name := ref
+	if !strings.HasPrefix(ref, "projects/") {
+		if c.GCPProject == "" {
+			return "", errors.New("GCP_PROJECT is required for secrets given by name")
+		}
+		secret, version, ok := strings.Cut(ref, "@")
+		if !ok {
+			version = "latest"
+		}
+		name = fmt.Sprintf("projects/%s/secrets/%s/versions/%s", c.GCPProject, url.PathEscape(secret), url.PathEscape(version))
+	} else if !strings.Contains(ref, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	token, err := c.gcpToken(ctx)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://secretmanager.googleapis.com/v1/"+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var response struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := getJSON(req, &response); err != nil {
+		return "", err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(response.Payload.Data)
+	return string(decoded), err
+}
+
+// gcpToken returns the configured access token or one from the metadata server
+func (c Config) gcpToken(ctx context.Context) (string, error) {
+	if c.GCPAccessToken != "" {
+		return c.GCPAccessToken, nil
+	}
+	return cloudauth.GCPMetadataToken(ctx)
+}
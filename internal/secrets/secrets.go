@@ -0,0 +1,257 @@
+// Package secrets resolves secrets kept in an external secrets manager (HashiCorp Vault, AWS
+// Secrets Manager or GCP Secret Manager) at execution time, so that they are never stored in
+// the FlowCraft database. Resolved secrets are cached in process for a short time.
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrNotConfigured is returned when secrets are resolved without a provider configured
+var ErrNotConfigured = errors.New("SECRETS_PROVIDER is not set")
+
+// Supported providers
+const (
+	ProviderVault = "vault"
+	ProviderAWS   = "aws"
+	ProviderGCP   = "gcp"
+)
+
+// requestTimeout limits the requests to the secrets manager
+const requestTimeout = 10 * time.Second
+
+// Config holds the settings of the secrets manager of the installation
+type Config struct {
+	// Provider is vault, aws or gcp; empty disables external secrets
+	Provider string
+	// CacheTTL is how long resolved secrets are kept in process; 0 disables caching
+	CacheTTL time.Duration
+	// TemplatePrefix restricts the secrets templates can reference with "$secret"; empty
+	// disables the namespace
+	TemplatePrefix string
+
+	// Vault settings: address, token, optional Enterprise namespace and KV v2 mount (default "secret")
+	VaultAddr      string
+	VaultToken     string
+	VaultNamespace string
+	VaultMount     string
+
+	// AWS settings: region and static credentials
+	AWSRegion          string
+	AWSAccessKeyID     string
+	AWSSecretAccessKey string
+	AWSSessionToken    string
+
+	// GCP settings: project of secrets given by name, and an access token; without a token
+	// one is requested from the metadata server
+	GCPProject     string
+	GCPAccessToken string
+}
+
+// ConfigFromEnv reads the secrets manager settings from the environment
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Provider:           os.Getenv("SECRETS_PROVIDER"),
+		CacheTTL:           5 * time.Minute,
+		TemplatePrefix:     os.Getenv("SECRETS_TEMPLATE_PREFIX"),
+		VaultAddr:          os.Getenv("VAULT_ADDR"),
+		VaultToken:         os.Getenv("VAULT_TOKEN"),
+		VaultNamespace:     os.Getenv("VAULT_NAMESPACE"),
+		VaultMount:         os.Getenv("VAULT_KV_MOUNT"),
+		AWSRegion:          os.Getenv("AWS_REGION"),
+		AWSAccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		AWSSecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		AWSSessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		GCPProject:         os.Getenv("GCP_PROJECT"),
+		GCPAccessToken:     os.Getenv("GCP_ACCESS_TOKEN"),
+	}
+	if ttl, err := time.ParseDuration(os.Getenv("SECRETS_CACHE_TTL")); err == nil && ttl >= 0 {
+		cfg.CacheTTL = ttl
+	}
+	if cfg.VaultMount == "" {
+		cfg.VaultMount = "secret"
+	}
+	return cfg
+}
+
+// fetcher loads a secret from a secrets manager
+type fetcher func(ctx context.Context, ref string) (string, error)
+
+// entry is a cached secret with its expiry
+type entry struct {
+	fields  map[string]string
+	expires time.Time
+}
+
+var (
+	mu      sync.RWMutex
+	config  Config
+	fetch   fetcher
+	entries = map[string]entry{}
+
+	httpClient = &http.Client{Timeout: requestTimeout}
+)
+
+// Configure sets the secrets manager of the installation
+func Configure(cfg Config) error {
+	var f fetcher
+	switch cfg.Provider {
+	case "":
+	case ProviderVault:
+		if cfg.VaultAddr == "" || cfg.VaultToken == "" {
+			return errors.New("the vault secrets provider requires VAULT_ADDR and VAULT_TOKEN")
+		}
+		f = cfg.fetchVault
+	case ProviderAWS:
+		if cfg.AWSRegion == "" || cfg.AWSAccessKeyID == "" || cfg.AWSSecretAccessKey == "" {
+			return errors.New("the aws secrets provider requires AWS_REGION, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		}
+		f = cfg.fetchAWS
+	case ProviderGCP:
+		f = cfg.fetchGCP
+	default:
+		return fmt.Errorf("unknown secrets provider: %s", cfg.Provider)
+	}
+
+	mu.Lock()
+	config = cfg
+	fetch = f
+	entries = map[string]entry{}
+	mu.Unlock()
+	return nil
+}
+
+// Enabled reports whether a secrets manager is configured
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	return fetch != nil
+}
+
+// Get returns the fields of the secret with the given reference. Secrets holding a JSON object
+// provide its fields, other secrets a single field "value".
+func Get(ctx context.Context, ref string) (map[string]string, error) {
+	mu.RLock()
+	f, ttl := fetch, config.CacheTTL
+	cached, ok := entries[ref]
+	mu.RUnlock()
+	if f == nil {
+		return nil, ErrNotConfigured
+	}
+	if ok && time.Now().Before(cached.expires) {
+		return copyFields(cached.fields), nil
+	}
+
+	value, err := f(ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve secret %s: %v", ref, err)
+	}
+	fields := parseFields(value)
+
+	if ttl > 0 {
+		mu.Lock()
+		entries[ref] = entry{fields: fields, expires: time.Now().Add(ttl)}
+		mu.Unlock()
+	}
+	return copyFields(fields), nil
+}
+
+// Invalidate evicts a secret from the cache, e.g. after it was rotated in the secrets manager
+func Invalidate(ref string) {
+	mu.Lock()
+	delete(entries, ref)
+	mu.Unlock()
+}
+
+// belowPrefix reports whether a reference names a secret below the prefix, which is a path with or
+// without trailing slash: "flowcraft" covers "flowcraft/stripe" but not "flowcraft-admin/stripe"
+func belowPrefix(ref, prefix string) bool {
+	dir := strings.TrimSuffix(prefix, "/") + "/"
+	return len(ref) > len(dir) && strings.HasPrefix(ref, dir)
+}
+
+// Resolver resolves "<ref>.<field>" paths of templates, e.g. "{{$secret.flowcraft/stripe.api_key}}".
+// Only secrets below the configured template prefix can be referenced; references contain no dots.
+func Resolver(path string) (interface{}, bool) {
+	mu.RLock()
+	prefix := config.TemplatePrefix
+	mu.RUnlock()
+	if prefix == "" {
+		return nil, false
+	}
+
+	ref, field, hasField := strings.Cut(path, ".")
+	if !belowPrefix(ref, prefix) {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+	fields, err := Get(ctx, ref)
+	if err != nil {
+		return nil, false
+	}
+	if !hasField {
+		field = "value"
+	}
+	value, ok := fields[field]
+	return value, ok
+}
+
+// parseFields splits a secret holding a JSON object into its fields
+func parseFields(value string) map[string]string {
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &object); err != nil {
+		return map[string]string{"value": value}
+	}
+
+	fields := make(map[string]string, len(object))
+	for key, v := range object {
+		if s, ok := v.(string); ok {
+			fields[key] = s
+		} else {
+			encoded, _ := json.Marshal(v)
+			fields[key] = string(encoded)
+		}
+	}
+	return fields
+}
+
+func copyFields(fields map[string]string) map[string]string {
+	copied := make(map[string]string, len(fields))
+	for key, value := range fields {
+		copied[key] = value
+	}
+	return copied
+}
+
+// getJSON sends the request and decodes the JSON response, failing for error statuses
+func getJSON(req *http.Request, target interface{}) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		var body struct {
+			Errors  []string `json:"errors"`  // Vault
+			Message string   `json:"message"` // AWS
+			Error   struct {
+				Message string `json:"message"`
+			} `json:"error"` // GCP
+		}
+		json.NewDecoder(resp.Body).Decode(&body)
+		message := strings.Join(append(body.Errors, body.Message, body.Error.Message), " ")
+		return fmt.Errorf("status %d %s", resp.StatusCode, strings.TrimSpace(message))
+	}
+	return json.NewDecoder(resp.Body).Decode(target)
+}
@@ -0,0 +1,24 @@
+package secrets
+
+import "testing"
+
+func TestBelowPrefix(t *testing.T) {
+	tests := []struct {
+		ref    string
+		prefix string
+		want   bool
+	}{
+		{"flowcraft/stripe", "flowcraft", true},
+		{"flowcraft/stripe", "flowcraft/", true},
+		{"flowcraft/payments/stripe", "flowcraft/payments", true},
+		{"flowcraft-admin/stripe", "flowcraft", false},
+		{"flowcraft", "flowcraft", false},
+		{"flowcraft/", "flowcraft/", false},
+		{"other/flowcraft/stripe", "flowcraft", false},
+	}
+	for _, tt := range tests {
+		if got := belowPrefix(tt.ref, tt.prefix); got != tt.want {
+			t.Errorf("belowPrefix(%q, %q) = %v, want %v", tt.ref, tt.prefix, got, tt.want)
+		}
+	}
+}
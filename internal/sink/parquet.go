@@ -0,0 +1,281 @@
+package sink
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// Parquet constants used by writeParquet, see parquet.thrift of the format specification
+const (
+	parquetInt64     = 2
+	parquetByteArray = 6
+
+	parquetOptional = 1
+
+	parquetUTF8            = 0
+	parquetTimestampMillis = 9
+
+	parquetPlain = 0
+	parquetRLE   = 3
+
+	parquetGzip     = 2
+	parquetDataPage = 0
+)
+
+// Thrift compact protocol types
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// writeParquet encodes rows as a Parquet file with a single row group. All columns are optional
+// and written as one gzip compressed, plain encoded data page.
+func writeParquet(columns []warehouseColumn, rows [][]interface{}) ([]byte, error) {
+	file := bytes.NewBufferString("PAR1")
+
+	type chunk struct {
+		offset, uncompressed, compressed int64
+	}
+	chunks := make([]chunk, len(columns))
+
+	for i, column := range columns {
+		var levels []byte
+		var values bytes.Buffer
+		for _, row := range rows {
+			value := row[i]
+			if value == nil {
+				levels = append(levels, 0)
+				continue
+			}
+			levels = append(levels, 1)
+			if err := parquetValue(&values, column, value); err != nil {
+				return nil, fmt.Errorf("column %s: %v", column.Name, err)
+			}
+		}
+
+		levelData := rleLevels(levels)
+		var page bytes.Buffer
+		binary.Write(&page, binary.LittleEndian, uint32(len(levelData)))
+		page.Write(levelData)
+		page.Write(values.Bytes())
+
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		gz.Write(page.Bytes())
+		if err := gz.Close(); err != nil {
+			return nil, err
+		}
+
+		header := newThriftWriter()
+		header.i32(1, parquetDataPage)
+		header.i32(2, int32(page.Len()))
+		header.i32(3, int32(compressed.Len()))
+		header.beginStruct(5)
+		header.i32(1, int32(len(rows)))
+		header.i32(2, parquetPlain)
+		header.i32(3, parquetRLE)
+		header.i32(4, parquetRLE)
+		header.endStruct()
+		header.stop()
+
+		chunks[i] = chunk{
+			offset:       int64(file.Len()),
+			uncompressed: int64(header.buf.Len() + page.Len()),
+			compressed:   int64(header.buf.Len() + compressed.Len()),
+		}
+		file.Write(header.buf.Bytes())
+		file.Write(compressed.Bytes())
+	}
+
+	meta := newThriftWriter()
+	meta.i32(1, 1)
+	meta.list(2, thriftStruct, len(columns)+1)
+	meta.beginElement()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(columns)))
+	meta.endStruct()
+	for _, column := range columns {
+		meta.beginElement()
+		meta.i32(1, column.parquetType())
+		meta.i32(3, parquetOptional)
+		meta.binary(4, column.Name)
+		switch column.Kind {
+		case columnString:
+			meta.i32(6, parquetUTF8)
+		case columnTime:
+			meta.i32(6, parquetTimestampMillis)
+		}
+		meta.endStruct()
+	}
+	meta.i64(3, int64(len(rows)))
+
+	var totalSize int64
+	meta.list(4, thriftStruct, 1)
+	meta.beginElement()
+	meta.list(1, thriftStruct, len(columns))
+	for i, column := range columns {
+		meta.beginElement()
+		meta.i64(2, chunks[i].offset)
+		meta.beginStruct(3)
+		meta.i32(1, column.parquetType())
+		meta.list(2, thriftI32, 2)
+		meta.listI32(parquetPlain)
+		meta.listI32(parquetRLE)
+		meta.list(3, thriftBinary, 1)
+		meta.listBinary(column.Name)
+		meta.i32(4, parquetGzip)
+		meta.i64(5, int64(len(rows)))
+		meta.i64(6, chunks[i].uncompressed)
+		meta.i64(7, chunks[i].compressed)
+		meta.i64(9, chunks[i].offset)
+		meta.endStruct()
+		meta.endStruct()
+		totalSize += chunks[i].uncompressed
+	}
+	meta.i64(2, totalSize)
+	meta.i64(3, int64(len(rows)))
+	meta.endStruct()
+	meta.binary(6, "FlowCraft")
+	meta.stop()
+
+	file.Write(meta.buf.Bytes())
+	binary.Write(file, binary.LittleEndian, uint32(meta.buf.Len()))
+	file.WriteString("PAR1")
+	return file.Bytes(), nil
+}
+
+// parquetType returns the physical Parquet type of a column
+func (c warehouseColumn) parquetType() int32 {
+	if c.Kind == columnString {
+		return parquetByteArray
+	}
+	return parquetInt64
+}
+
+// parquetValue appends the plain encoding of a value
+func parquetValue(buf *bytes.Buffer, column warehouseColumn, value interface{}) error {
+	switch column.Kind {
+	case columnString:
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("expected a string, got %T", value)
+		}
+		binary.Write(buf, binary.LittleEndian, uint32(len(s)))
+		buf.WriteString(s)
+	case columnTime:
+		t, ok := value.(time.Time)
+		if !ok {
+			return fmt.Errorf("expected a time, got %T", value)
+		}
+		binary.Write(buf, binary.LittleEndian, t.UnixMilli())
+	default:
+		n, ok := value.(int64)
+		if !ok {
+			return fmt.Errorf("expected an integer, got %T", value)
+		}
+		binary.Write(buf, binary.LittleEndian, n)
+	}
+	return nil
+}
+
+// rleLevels encodes definition levels of bit width 1 as runs of the RLE/bit-packing hybrid
+func rleLevels(levels []byte) []byte {
+	var buf []byte
+	for i := 0; i < len(levels); {
+		j := i
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		buf = binary.AppendUvarint(buf, uint64(j-i)<<1)
+		buf = append(buf, levels[i])
+		i = j
+	}
+	return buf
+}
+
+// thriftWriter encodes the structs of the Parquet metadata with the Thrift compact protocol
+type thriftWriter struct {
+	buf bytes.Buffer
+	// last holds the ID of the previous field of each open struct
+	last []int16
+}
+
+func newThriftWriter() *thriftWriter {
+	return &thriftWriter{last: []int16{0}}
+}
+
+func (w *thriftWriter) field(id int16, fieldType byte) {
+	top := len(w.last) - 1
+	if delta := id - w.last[top]; delta > 0 && delta <= 15 {
+		w.buf.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		w.buf.WriteByte(fieldType)
+		w.varint(uint64(uint32(int32(id)<<1 ^ int32(id)>>31)))
+	}
+	w.last[top] = id
+}
+
+func (w *thriftWriter) varint(v uint64) {
+	w.buf.Write(binary.AppendUvarint(nil, v))
+}
+
+func (w *thriftWriter) i32(id int16, v int32) {
+	w.field(id, thriftI32)
+	w.listI32(v)
+}
+
+func (w *thriftWriter) i64(id int16, v int64) {
+	w.field(id, thriftI64)
+	w.varint(uint64(v<<1 ^ v>>63))
+}
+
+func (w *thriftWriter) binary(id int16, s string) {
+	w.field(id, thriftBinary)
+	w.listBinary(s)
+}
+
+// list starts a list field, its elements follow
+func (w *thriftWriter) list(id int16, elementType byte, size int) {
+	w.field(id, thriftList)
+	if size < 15 {
+		w.buf.WriteByte(byte(size)<<4 | elementType)
+	} else {
+		w.buf.WriteByte(0xf0 | elementType)
+		w.varint(uint64(size))
+	}
+}
+
+func (w *thriftWriter) listI32(v int32) {
+	w.varint(uint64(uint32(v<<1 ^ v>>31)))
+}
+
+func (w *thriftWriter) listBinary(s string) {
+	w.varint(uint64(len(s)))
+	w.buf.WriteString(s)
+}
+
+// beginStruct starts a struct field, beginElement a struct element of a list
+func (w *thriftWriter) beginStruct(id int16) {
+	w.field(id, thriftStruct)
+	w.beginElement()
+}
+
+func (w *thriftWriter) beginElement() {
+	w.last = append(w.last, 0)
+}
+
+func (w *thriftWriter) endStruct() {
+	w.stop()
+	w.last = w.last[:len(w.last)-1]
+}
+
+// stop ends the fields of a struct
+func (w *thriftWriter) stop() {
+	w.buf.WriteByte(0)
+}
@@ -0,0 +1,43 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/altipard/flowcraft/internal/s3"
+)
+
+// S3Deliverer uploads the output document to an S3 compatible object store.
+// Credentials are read from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN.
+type S3Deliverer struct{}
+
+// Deliver uploads the document. Config: bucket, key (templated), region, endpoint (for S3 compatible stores).
+func (d *S3Deliverer) Deliver(ctx context.Context, config map[string]interface{}, data map[string]interface{}, document []byte) (string, error) {
+	bucket, _ := config["bucket"].(string)
+	if bucket == "" {
+		return "", fmt.Errorf("bucket is required")
+	}
+	key, err := renderString(config, "key", data, nil)
+	if err != nil {
+		return "", err
+	}
+	key = strings.TrimPrefix(key, "/")
+	return putObject(ctx, config, bucket, key, document, "application/json")
+}
+
+// putObject uploads an object with the region and endpoint of the config. It returns the
+// s3:// URL of the object.
+func putObject(ctx context.Context, config map[string]interface{}, bucket, key string, body []byte, contentType string) (string, error) {
+	target := s3.Bucket{Name: bucket}
+	target.Region, _ = config["region"].(string)
+	target.Endpoint, _ = config["endpoint"].(string)
+	destination := target.URL(key)
+
+	err := target.Put(ctx, key, body, contentType)
+	if errors.Is(err, s3.ErrNoCredentials) {
+		return destination, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are required for s3 sinks")
+	}
+	return destination, err
+}
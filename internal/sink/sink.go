@@ -0,0 +1,168 @@
+// Package sink delivers the output of completed executions to external destinations
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/expression"
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// Delivery retries
+const (
+	maxAttempts  = 3
+	retryBackoff = 2 * time.Second
+)
+
+// Deliverer writes an output document to a destination. It returns the rendered destination.
+type Deliverer interface {
+	Deliver(ctx context.Context, config map[string]interface{}, data map[string]interface{}, document []byte) (string, error)
+}
+
+// NewDeliverer returns the deliverer for a sink type
+func NewDeliverer(sinkType string) (Deliverer, error) {
+	switch sinkType {
+	case "webhook":
+		return &WebhookDeliverer{}, nil
+	case "s3":
+		return &S3Deliverer{}, nil
+	case "database":
+		return &TableDeliverer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown sink type: %s", sinkType)
+	}
+}
+
+// DeliverExecution delivers the output of a completed execution to all active sinks of its workflow.
+// Failures are tracked on the deliveries and do not affect the execution.
+func DeliverExecution(execution *models.WorkflowExecution) {
+	// Published versions deliver to the sinks of the workflow they belong to
+	workflowID := execution.WorkflowID
+	if execution.Workflow.ParentID != nil {
+		workflowID = *execution.Workflow.ParentID
+	}
+
+	var sinks []models.OutputSink
+	if err := database.DB.Where("workflow_id = ? AND is_active = ?", workflowID, true).Find(&sinks).Error; err != nil {
+		log.Printf("Failed to load output sinks of workflow %d: %v", workflowID, err)
+		return
+	}
+
+	for _, outputSink := range sinks {
+		delivery := models.OutputDelivery{
+			OutputSinkID:        outputSink.ID,
+			WorkflowExecutionID: execution.ID,
+			Status:              "pending",
+		}
+		if err := database.DB.Create(&delivery).Error; err != nil {
+			log.Printf("Failed to create delivery for sink %d: %v", outputSink.ID, err)
+			continue
+		}
+
+		Deliver(&delivery, outputSink, execution)
+	}
+}
+
+// Deliver attempts a delivery, retrying failed attempts, and stores its status
+func Deliver(delivery *models.OutputDelivery, outputSink models.OutputSink, execution *models.WorkflowExecution) {
+	err := deliver(delivery, outputSink, execution)
+	if err != nil {
+		log.Printf("Delivery of execution %d to sink %d failed: %v", execution.ID, outputSink.ID, err)
+		delivery.Status = "failed"
+		delivery.ErrorMessage = err.Error()
+	} else {
+		now := time.Now()
+		delivery.Status = "delivered"
+		delivery.ErrorMessage = ""
+		delivery.DeliveredAt = &now
+	}
+	database.DB.Save(delivery)
+}
+
+func deliver(delivery *models.OutputDelivery, outputSink models.OutputSink, execution *models.WorkflowExecution) error {
+	deliverer, err := NewDeliverer(outputSink.SinkType)
+	if err != nil {
+		return err
+	}
+
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(outputSink.Config), &config); err != nil {
+		return fmt.Errorf("failed to parse sink config: %v", err)
+	}
+
+	data, document, err := outputDocument(execution)
+	if err != nil {
+		return err
+	}
+
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		delivery.Attempts++
+
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		delivery.Destination, err = deliverer.Deliver(ctx, config, data, document)
+		cancel()
+		if err == nil {
+			return nil
+		}
+
+		if attempt < maxAttempts {
+			time.Sleep(retryBackoff * time.Duration(attempt))
+		}
+	}
+
+	return err
+}
+
+// outputDocument returns the template data of an execution and the JSON document delivered to sinks
+func outputDocument(execution *models.WorkflowExecution) (map[string]interface{}, []byte, error) {
+	var output interface{}
+	if err := json.Unmarshal([]byte(execution.OutputData), &output); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse output data: %v", err)
+	}
+
+	completedAt := time.Now()
+	if execution.CompletedAt != nil {
+		completedAt = *execution.CompletedAt
+	}
+
+	data := map[string]interface{}{
+		"execution_id": execution.ID,
+		"workflow_id":  execution.WorkflowID,
+		"status":       execution.Status,
+		"date":         completedAt.UTC().Format("2006-01-02"),
+		"timestamp":    completedAt.Unix(),
+		"output":       output,
+	}
+
+	document, err := json.Marshal(map[string]interface{}{
+		"execution_id": execution.ID,
+		"workflow_id":  execution.WorkflowID,
+		"status":       execution.Status,
+		"completed_at": completedAt,
+		"output":       output,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return data, document, nil
+}
+
+// renderString renders a templated string config option
+func renderString(config map[string]interface{}, key string, data map[string]interface{}, escape expression.Escaper) (string, error) {
+	value, _ := config[key].(string)
+	if value == "" {
+		return "", fmt.Errorf("%s is required", key)
+	}
+
+	rendered, err := expression.Render(value, data, escape, expression.Options{RejectTemplateSyntax: true})
+	if err != nil {
+		return "", fmt.Errorf("failed to render %s: %v", key, err)
+	}
+	return rendered, nil
+}
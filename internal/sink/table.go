@@ -0,0 +1,64 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// tableNamePattern matches plain or schema-qualified table names
+var tableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// TableDeliverer inserts the output as a row into a Postgres table with the columns
+// execution_id, workflow_id, status, output (jsonb) and delivered_at
+type TableDeliverer struct{}
+
+// Deliver inserts the row. Config: table (templated), dsn (defaults to the FlowCraft database),
+// create_table (create the table if it does not exist).
+func (d *TableDeliverer) Deliver(ctx context.Context, config map[string]interface{}, data map[string]interface{}, document []byte) (string, error) {
+	table, err := renderString(config, "table", data, nil)
+	if err != nil {
+		return "", err
+	}
+	if !tableNamePattern.MatchString(table) {
+		return table, fmt.Errorf("invalid table name: %s", table)
+	}
+
+	db := database.DB
+	if dsn, _ := config["dsn"].(string); dsn != "" {
+		db, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+		if err != nil {
+			return table, fmt.Errorf("failed to connect to database: %v", err)
+		}
+		if sqlDB, err := db.DB(); err == nil {
+			defer sqlDB.Close()
+		}
+	}
+	db = db.WithContext(ctx)
+
+	if create, _ := config["create_table"].(bool); create {
+		err := db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id BIGSERIAL PRIMARY KEY,
+			execution_id BIGINT NOT NULL,
+			workflow_id BIGINT NOT NULL,
+			status TEXT NOT NULL,
+			output JSONB NOT NULL,
+			delivered_at TIMESTAMPTZ NOT NULL
+		)`, table)).Error
+		if err != nil {
+			return table, fmt.Errorf("failed to create table: %v", err)
+		}
+	}
+
+	err = db.Exec(fmt.Sprintf("INSERT INTO %s (execution_id, workflow_id, status, output, delivered_at) VALUES (?, ?, ?, ?, ?)", table),
+		data["execution_id"], data["workflow_id"], data["status"], string(document), time.Now()).Error
+	if err != nil {
+		return table, fmt.Errorf("failed to insert row: %v", err)
+	}
+	return table, nil
+}
@@ -0,0 +1,760 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/cloudauth"
+	"github.com/altipard/flowcraft/internal/credentials"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/redact"
+	"gorm.io/gorm"
+)
+
+// Warehouse export batches
+const (
+	// warehouseBatchSize is the number of executions exported together with their node executions
+	warehouseBatchSize = 500
+	// warehouseMaxBatches bounds the batches of a run, the next run continues after them
+	warehouseMaxBatches = 100
+	// minWarehouseInterval is the shortest interval between the runs of an export
+	minWarehouseInterval = time.Minute
+)
+
+// Tables the records are exported to, prefixed with the table_prefix of the config
+const (
+	warehouseExecutionsTable     = "executions"
+	warehouseNodeExecutionsTable = "node_executions"
+	defaultWarehouseTablePrefix  = "flowcraft_"
+)
+
+// Kinds of exported columns
+type columnKind int
+
+const (
+	columnInt columnKind = iota
+	columnString
+	columnTime
+)
+
+// warehouseColumn is a column of an exported table
+type warehouseColumn struct {
+	Name string
+	Kind columnKind
+}
+
+var executionColumns = []warehouseColumn{
+	{"execution_id", columnInt},
+	{"workflow_id", columnInt},
+	{"root_workflow_id", columnInt},
+	{"workflow_name", columnString},
+	{"organization_id", columnInt},
+	{"status", columnString},
+	{"trigger_id", columnInt},
+	{"batch_id", columnInt},
+	{"started_at", columnTime},
+	{"completed_at", columnTime},
+	{"duration_ms", columnInt},
+	{"node_count", columnInt},
+	{"failed_node_count", columnInt},
+	{"error_message", columnString},
+}
+
+var nodeExecutionColumns = []warehouseColumn{
+	{"node_execution_id", columnInt},
+	{"execution_id", columnInt},
+	{"workflow_id", columnInt},
+	{"node_id", columnInt},
+	{"node_type", columnString},
+	{"node_name", columnString},
+	{"status", columnString},
+	{"output_handle", columnString},
+	{"attempt", columnInt},
+	{"started_at", columnTime},
+	{"completed_at", columnTime},
+	{"duration_ms", columnInt},
+	{"bytes_in", columnInt},
+	{"bytes_out", columnInt},
+	{"error_code", columnString},
+	{"error_message", columnString},
+}
+
+// payloadColumns are added to both tables by exports including payloads
+var payloadColumns = []warehouseColumn{
+	{"input_data", columnString},
+	{"output_data", columnString},
+}
+
+// warehouseWriter writes rows to a table of a destination. The batch names the rows uniquely,
+// e.g. for object keys. It returns where the rows were written.
+type warehouseWriter interface {
+	write(ctx context.Context, table string, columns []warehouseColumn, rows [][]interface{}, batch string) (string, error)
+}
+
+// newWarehouseWriter returns the writer for the destination of an export
+func newWarehouseWriter(destination string, config map[string]interface{}) (warehouseWriter, error) {
+	switch destination {
+	case models.WarehouseBigQuery:
+		return &bigQueryWriter{config}, nil
+	case models.WarehouseSnowflake:
+		return &snowflakeWriter{config}, nil
+	case models.WarehouseClickHouse:
+		return &clickHouseWriter{config}, nil
+	case models.WarehouseS3:
+		return &s3Writer{config}, nil
+	default:
+		return nil, fmt.Errorf("unknown destination %q, expected bigquery, snowflake, clickhouse or s3", destination)
+	}
+}
+
+// requiredWarehouseConfig lists the config options each destination needs
+var requiredWarehouseConfig = map[string][]string{
+	models.WarehouseBigQuery:   {"project", "dataset"},
+	models.WarehouseSnowflake:  {"account", "database", "schema", "credential_id"},
+	models.WarehouseClickHouse: {"url"},
+	models.WarehouseS3:         {"bucket"},
+}
+
+// ValidateWarehouseExport checks the destination, config and interval of an export
+func ValidateWarehouseExport(export *models.WarehouseExport) error {
+	if export.Config == "" {
+		export.Config = "{}"
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(export.Config), &config); err != nil {
+		return fmt.Errorf("invalid config: %v", err)
+	}
+	if _, err := newWarehouseWriter(export.Destination, config); err != nil {
+		return err
+	}
+	for _, key := range requiredWarehouseConfig[export.Destination] {
+		if value, ok := config[key]; !ok || value == "" {
+			return fmt.Errorf("%s is required for %s exports", key, export.Destination)
+		}
+	}
+	if table := tablePrefix(config) + warehouseNodeExecutionsTable; !tableNamePattern.MatchString(table) {
+		return fmt.Errorf("invalid table_prefix: %s", tablePrefix(config))
+	}
+	if format, _ := config["format"].(string); format != "" && format != "parquet" && format != "ndjson" {
+		return fmt.Errorf("invalid format %q, expected parquet or ndjson", format)
+	}
+	if _, err := redactor(config); err != nil {
+		return err
+	}
+
+	if export.Interval == "" {
+		export.Interval = "1h"
+	}
+	interval, err := time.ParseDuration(export.Interval)
+	if err != nil {
+		return fmt.Errorf("invalid interval: %v", err)
+	}
+	if interval < minWarehouseInterval {
+		return fmt.Errorf("interval must be at least %s", minWarehouseInterval)
+	}
+	return nil
+}
+
+// ExportWarehouses runs the due warehouse exports at the given interval until the context is done
+func ExportWarehouses(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var exports []models.WarehouseExport
+		now := time.Now()
+		err := database.DB.Where("paused = ? AND (next_run_at IS NULL OR next_run_at <= ?)", false, now).Find(&exports).Error
+		if err != nil {
+			log.Printf("Failed to load due warehouse exports: %v", err)
+			continue
+		}
+
+		for _, export := range exports {
+			// Claim the run, so each export runs on one worker at a time
+			next := now.Add(exportInterval(export))
+			result := database.DB.Model(&models.WarehouseExport{}).
+				Where("id = ? AND (next_run_at IS NULL OR next_run_at <= ?)", export.ID, now).
+				Update("next_run_at", next)
+			if result.Error != nil || result.RowsAffected == 0 {
+				continue
+			}
+			export.NextRunAt = &next
+
+			if err := RunWarehouseExport(ctx, &export); err != nil {
+				log.Printf("Warehouse export %d failed: %v", export.ID, err)
+			}
+		}
+	}
+}
+
+func exportInterval(export models.WarehouseExport) time.Duration {
+	interval, err := time.ParseDuration(export.Interval)
+	if err != nil || interval < minWarehouseInterval {
+		return time.Hour
+	}
+	return interval
+}
+
+// RunWarehouseExport exports the executions completed since the previous run, in the order they
+// completed. The position is saved after each batch, so a failed run is retried from the failed
+// batch; destinations may receive the rows of a batch twice.
+func RunWarehouseExport(ctx context.Context, export *models.WarehouseExport) error {
+	err := runWarehouseExport(ctx, export)
+
+	now := time.Now()
+	export.LastRunAt = &now
+	export.LastError = ""
+	if err != nil {
+		export.LastError = err.Error()
+	}
+	database.DB.Model(export).Updates(map[string]interface{}{"last_run_at": now, "last_error": export.LastError})
+	return err
+}
+
+func runWarehouseExport(ctx context.Context, export *models.WarehouseExport) error {
+	var config map[string]interface{}
+	if err := json.Unmarshal([]byte(export.Config), &config); err != nil {
+		return fmt.Errorf("failed to parse config: %v", err)
+	}
+	writer, err := newWarehouseWriter(export.Destination, config)
+	if err != nil {
+		return err
+	}
+	redaction, err := redactor(config)
+	if err != nil {
+		return err
+	}
+	prefix := tablePrefix(config)
+
+	for batch := 0; batch < warehouseMaxBatches; batch++ {
+		executions, nodeExecutions, err := loadWarehouseBatch(export)
+		if err != nil {
+			return err
+		}
+		if len(executions) == 0 {
+			return nil
+		}
+
+		executionRows, nodeRows := warehouseRows(executions, nodeExecutions, redaction, export.IncludePayloads)
+		name := fmt.Sprintf("%d-%d-%d", export.ID, executions[0].ID, executions[len(executions)-1].ID)
+		if _, err := writer.write(ctx, prefix+warehouseExecutionsTable, tableColumns(executionColumns, export.IncludePayloads), executionRows, name); err != nil {
+			return fmt.Errorf("failed to export executions: %v", err)
+		}
+		if len(nodeRows) > 0 {
+			if _, err := writer.write(ctx, prefix+warehouseNodeExecutionsTable, tableColumns(nodeExecutionColumns, export.IncludePayloads), nodeRows, name); err != nil {
+				return fmt.Errorf("failed to export node executions: %v", err)
+			}
+		}
+
+		last := executions[len(executions)-1]
+		export.LastCompletedAt = last.CompletedAt
+		export.LastExecutionID = last.ID
+		export.ExportedRows += int64(len(executionRows) + len(nodeRows))
+		err = database.DB.Model(export).Updates(map[string]interface{}{
+			"last_completed_at": export.LastCompletedAt,
+			"last_execution_id": export.LastExecutionID,
+			"exported_rows":     export.ExportedRows,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if len(executions) < warehouseBatchSize {
+			return nil
+		}
+	}
+	return nil
+}
+
+// loadWarehouseBatch loads the next completed or failed executions after the position of an
+// export, with their workflows and node executions
+func loadWarehouseBatch(export *models.WarehouseExport) ([]models.WorkflowExecution, []models.NodeExecution, error) {
+	unscoped := func(db *gorm.DB) *gorm.DB { return db.Unscoped() }
+
+	query := database.Replica().Preload("Workflow", unscoped).
+		Where("status IN ? AND completed_at IS NOT NULL", []string{"completed", "failed"})
+	if export.LastCompletedAt != nil {
+		query = query.Where("completed_at > ? OR (completed_at = ? AND id > ?)", *export.LastCompletedAt, *export.LastCompletedAt, export.LastExecutionID)
+	}
+	var executions []models.WorkflowExecution
+	if err := query.Order("completed_at, id").Limit(warehouseBatchSize).Find(&executions).Error; err != nil {
+		return nil, nil, err
+	}
+	if len(executions) == 0 {
+		return nil, nil, nil
+	}
+
+	ids := make([]uint, len(executions))
+	for i, execution := range executions {
+		ids[i] = execution.ID
+	}
+	var nodeExecutions []models.NodeExecution
+	err := database.Replica().Preload("Node", unscoped).
+		Where("workflow_execution_id IN ?", ids).Order("id").Find(&nodeExecutions).Error
+	if err != nil {
+		return nil, nil, err
+	}
+	return executions, nodeExecutions, nil
+}
+
+// warehouseRows flattens executions and node executions into the rows of their tables
+func warehouseRows(executions []models.WorkflowExecution, nodeExecutions []models.NodeExecution, redaction *redact.Redaction, payloads bool) ([][]interface{}, [][]interface{}) {
+	type counts struct{ nodes, failed int64 }
+	nodeCounts := make(map[uint]*counts, len(executions))
+	workflowIDs := make(map[uint]uint, len(executions))
+	for _, execution := range executions {
+		nodeCounts[execution.ID] = &counts{}
+		workflowIDs[execution.ID] = execution.WorkflowID
+	}
+
+	nodeRows := make([][]interface{}, 0, len(nodeExecutions))
+	for _, ne := range nodeExecutions {
+		c := nodeCounts[ne.WorkflowExecutionID]
+		c.nodes++
+		if ne.Status == "failed" {
+			c.failed++
+		}
+
+		row := []interface{}{
+			int64(ne.ID),
+			int64(ne.WorkflowExecutionID),
+			int64(workflowIDs[ne.WorkflowExecutionID]),
+			int64(ne.NodeID),
+			ne.Node.NodeType,
+			ne.Node.Name,
+			ne.Status,
+			ne.OutputHandle,
+			int64(ne.Attempt),
+			optionalTime(ne.StartedAt),
+			optionalTime(ne.CompletedAt),
+			ne.DurationMs,
+			ne.BytesIn,
+			ne.BytesOut,
+			ne.ErrorCode,
+			redaction.Text(ne.ErrorMessage),
+		}
+		if payloads {
+			row = append(row, redaction.Payload(ne.InputData), redaction.Payload(ne.OutputData))
+		}
+		nodeRows = append(nodeRows, row)
+	}
+
+	executionRows := make([][]interface{}, 0, len(executions))
+	for _, execution := range executions {
+		var durationMs interface{}
+		if execution.CompletedAt != nil {
+			durationMs = execution.CompletedAt.Sub(execution.StartedAt).Milliseconds()
+		}
+		row := []interface{}{
+			int64(execution.ID),
+			int64(execution.WorkflowID),
+			int64(execution.Workflow.RootID()),
+			execution.Workflow.Name,
+			int64(execution.Workflow.OrganizationID),
+			execution.Status,
+			optionalID(execution.TriggerID),
+			optionalID(execution.BatchID),
+			execution.StartedAt,
+			optionalTime(execution.CompletedAt),
+			durationMs,
+			nodeCounts[execution.ID].nodes,
+			nodeCounts[execution.ID].failed,
+			redaction.Text(execution.ErrorMessage),
+		}
+		if payloads {
+			row = append(row, redaction.Payload(execution.InputData), redaction.Payload(execution.OutputData))
+		}
+		executionRows = append(executionRows, row)
+	}
+	return executionRows, nodeRows
+}
+
+func tableColumns(columns []warehouseColumn, payloads bool) []warehouseColumn {
+	if !payloads {
+		return columns
+	}
+	return append(append([]warehouseColumn(nil), columns...), payloadColumns...)
+}
+
+func tablePrefix(config map[string]interface{}) string {
+	if prefix, ok := config["table_prefix"].(string); ok {
+		return prefix
+	}
+	return defaultWarehouseTablePrefix
+}
+
+func optionalTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return *t
+}
+
+func optionalID(id *uint) interface{} {
+	if id == nil {
+		return nil
+	}
+	return int64(*id)
+}
+
+// redactor returns the redaction of the default fields and the redact_fields of the config
+func redactor(config map[string]interface{}) (*redact.Redaction, error) {
+	extra, ok := config["redact_fields"]
+	if !ok {
+		return redact.New(), nil
+	}
+	list, ok := extra.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("redact_fields must be a list of field names")
+	}
+	fields := make([]string, 0, len(list))
+	for _, item := range list {
+		field, ok := item.(string)
+		if !ok || field == "" {
+			return nil, fmt.Errorf("redact_fields must be a list of field names")
+		}
+		fields = append(fields, field)
+	}
+	return redact.New(fields...), nil
+}
+
+// jsonRows converts rows into objects by column name, with times in RFC 3339
+func jsonRows(columns []warehouseColumn, rows [][]interface{}) []map[string]interface{} {
+	objects := make([]map[string]interface{}, len(rows))
+	for i, row := range rows {
+		object := make(map[string]interface{}, len(columns))
+		for j, column := range columns {
+			if t, ok := row[j].(time.Time); ok {
+				object[column.Name] = t.UTC().Format(time.RFC3339Nano)
+			} else {
+				object[column.Name] = row[j]
+			}
+		}
+		objects[i] = object
+	}
+	return objects
+}
+
+// ndjson encodes rows as newline delimited JSON objects
+func ndjson(columns []warehouseColumn, rows [][]interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	for _, object := range jsonRows(columns, rows) {
+		if err := encoder.Encode(object); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// warehouseCredential returns the fields of the shared credential referenced by credential_id
+func warehouseCredential(config map[string]interface{}) (map[string]string, error) {
+	id, _ := config["credential_id"].(float64)
+	if id <= 0 {
+		return nil, nil
+	}
+	return credentials.Resolve(uint(id), 0, "")
+}
+
+// sendJSON sends a request and decodes the JSON response, failing on error statuses
+func sendJSON(req *http.Request, target interface{}) error {
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(body[:min(len(body), 1024)])))
+	}
+	if target != nil && len(body) > 0 {
+		return json.Unmarshal(body, target)
+	}
+	return nil
+}
+
+// bigQueryWriter streams rows into BigQuery tables with the insertAll API.
+// Config: project, dataset, credential_id (bearer credential with an access token, defaults to
+// the service account of the metadata server), endpoint.
+type bigQueryWriter struct {
+	config map[string]interface{}
+}
+
+func (w *bigQueryWriter) write(ctx context.Context, table string, columns []warehouseColumn, rows [][]interface{}, batch string) (string, error) {
+	project, _ := w.config["project"].(string)
+	dataset, _ := w.config["dataset"].(string)
+	destination := fmt.Sprintf("%s.%s.%s", project, dataset, table)
+
+	token, err := w.token(ctx)
+	if err != nil {
+		return destination, err
+	}
+
+	// The record IDs let BigQuery drop rows sent again after a failure
+	type insertRow struct {
+		InsertID string                 `json:"insertId"`
+		JSON     map[string]interface{} `json:"json"`
+	}
+	objects := jsonRows(columns, rows)
+	request := struct {
+		Rows []insertRow `json:"rows"`
+	}{Rows: make([]insertRow, len(rows))}
+	for i, object := range objects {
+		request.Rows[i] = insertRow{InsertID: fmt.Sprintf("%s-%v", table, rows[i][0]), JSON: object}
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return destination, err
+	}
+
+	endpoint, _ := w.config["endpoint"].(string)
+	if endpoint == "" {
+		endpoint = "https://bigquery.googleapis.com"
+	}
+	insertURL := fmt.Sprintf("%s/bigquery/v2/projects/%s/datasets/%s/tables/%s/insertAll",
+		strings.TrimSuffix(endpoint, "/"), url.PathEscape(project), url.PathEscape(dataset), url.PathEscape(table))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, insertURL, bytes.NewReader(body))
+	if err != nil {
+		return destination, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var response struct {
+		InsertErrors []struct {
+			Index  int `json:"index"`
+			Errors []struct {
+				Message string `json:"message"`
+			} `json:"errors"`
+		} `json:"insertErrors"`
+	}
+	if err := sendJSON(req, &response); err != nil {
+		return destination, fmt.Errorf("bigquery: %v", err)
+	}
+	if len(response.InsertErrors) > 0 {
+		first := response.InsertErrors[0]
+		message := "unknown error"
+		if len(first.Errors) > 0 {
+			message = first.Errors[0].Message
+		}
+		return destination, fmt.Errorf("bigquery rejected %d rows, row %d: %s", len(response.InsertErrors), first.Index, message)
+	}
+	return destination, nil
+}
+
+func (w *bigQueryWriter) token(ctx context.Context) (string, error) {
+	data, err := warehouseCredential(w.config)
+	if err != nil {
+		return "", err
+	}
+	if data != nil {
+		return data["token"], nil
+	}
+	return cloudauth.GCPMetadataToken(ctx)
+}
+
+// snowflakeWriter inserts rows into Snowflake tables with the SQL API, binding the values of
+// all rows as arrays. Config: account, database, schema, warehouse, role, credential_id (bearer
+// credential with an OAuth token or key pair JWT), token_type (OAUTH or KEYPAIR_JWT).
+type snowflakeWriter struct {
+	config map[string]interface{}
+}
+
+// snowflakePollInterval is how often the status of long running statements is checked
+const snowflakePollInterval = 2 * time.Second
+
+func (w *snowflakeWriter) write(ctx context.Context, table string, columns []warehouseColumn, rows [][]interface{}, batch string) (string, error) {
+	account, _ := w.config["account"].(string)
+	destination := fmt.Sprintf("%s.%s.%s", w.config["database"], w.config["schema"], table)
+
+	data, err := warehouseCredential(w.config)
+	if err != nil {
+		return destination, err
+	}
+	tokenType, _ := w.config["token_type"].(string)
+	if tokenType == "" {
+		tokenType = "OAUTH"
+	}
+
+	names := make([]string, len(columns))
+	placeholders := make([]string, len(columns))
+	bindings := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		names[i] = column.Name
+		placeholders[i] = "?"
+		bindType := "TEXT"
+		if column.Kind == columnInt {
+			bindType = "FIXED"
+		}
+		values := make([]interface{}, len(rows))
+		for j, row := range rows {
+			switch v := row[i].(type) {
+			case nil:
+				values[j] = nil
+			case time.Time:
+				values[j] = v.UTC().Format("2006-01-02 15:04:05.000")
+			case int64:
+				values[j] = strconv.FormatInt(v, 10)
+			default:
+				values[j] = fmt.Sprint(v)
+			}
+		}
+		bindings[strconv.Itoa(i+1)] = map[string]interface{}{"type": bindType, "value": values}
+	}
+
+	statement := map[string]interface{}{
+		"statement": fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", table, strings.Join(names, ", "), strings.Join(placeholders, ", ")),
+		"bindings":  bindings,
+		"timeout":   60,
+	}
+	for _, key := range []string{"database", "schema", "warehouse", "role"} {
+		if value, ok := w.config[key].(string); ok && value != "" {
+			statement[key] = value
+		}
+	}
+	body, err := json.Marshal(statement)
+	if err != nil {
+		return destination, err
+	}
+
+	baseURL := fmt.Sprintf("https://%s.snowflakecomputing.com/api/v2/statements", account)
+	request := func(method, url string, body []byte) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json")
+		req.Header.Set("Authorization", "Bearer "+data["token"])
+		req.Header.Set("X-Snowflake-Authorization-Token-Type", tokenType)
+		return req, nil
+	}
+
+	req, err := request(http.MethodPost, baseURL, body)
+	if err != nil {
+		return destination, err
+	}
+	var response struct {
+		StatementHandle string `json:"statementHandle"`
+		Code            string `json:"code"`
+	}
+	if err := sendJSON(req, &response); err != nil {
+		return destination, fmt.Errorf("snowflake: %v", err)
+	}
+
+	// Statements running longer than the request are polled until they finish
+	for response.Code == "333334" {
+		select {
+		case <-ctx.Done():
+			return destination, ctx.Err()
+		case <-time.After(snowflakePollInterval):
+		}
+		req, err := request(http.MethodGet, baseURL+"/"+url.PathEscape(response.StatementHandle), nil)
+		if err != nil {
+			return destination, err
+		}
+		if err := sendJSON(req, &response); err != nil {
+			return destination, fmt.Errorf("snowflake: %v", err)
+		}
+	}
+	return destination, nil
+}
+
+// clickHouseWriter inserts rows into ClickHouse tables over the HTTP interface in the
+// JSONEachRow format. Config: url, database (default "default"), credential_id (basic
+// credential).
+type clickHouseWriter struct {
+	config map[string]interface{}
+}
+
+func (w *clickHouseWriter) write(ctx context.Context, table string, columns []warehouseColumn, rows [][]interface{}, batch string) (string, error) {
+	databaseName, _ := w.config["database"].(string)
+	if databaseName == "" {
+		databaseName = "default"
+	}
+	destination := databaseName + "." + table
+	if !tableNamePattern.MatchString(destination) {
+		return destination, fmt.Errorf("invalid table name: %s", destination)
+	}
+
+	body, err := ndjson(columns, rows)
+	if err != nil {
+		return destination, err
+	}
+
+	baseURL, _ := w.config["url"].(string)
+	query := url.Values{}
+	query.Set("query", fmt.Sprintf("INSERT INTO %s FORMAT JSONEachRow", destination))
+	query.Set("date_time_input_format", "best_effort")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(baseURL, "/")+"/?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return destination, err
+	}
+	data, err := warehouseCredential(w.config)
+	if err != nil {
+		return destination, err
+	}
+	if data != nil {
+		req.SetBasicAuth(data["username"], data["password"])
+	}
+
+	if err := sendJSON(req, nil); err != nil {
+		return destination, fmt.Errorf("clickhouse: %v", err)
+	}
+	return destination, nil
+}
+
+// s3Writer uploads the rows of each batch as a Parquet or newline delimited JSON object,
+// partitioned by table and export date. Config: bucket, prefix (default "flowcraft"), format
+// (parquet or ndjson), region, endpoint.
+type s3Writer struct {
+	config map[string]interface{}
+}
+
+func (w *s3Writer) write(ctx context.Context, table string, columns []warehouseColumn, rows [][]interface{}, batch string) (string, error) {
+	bucket, _ := w.config["bucket"].(string)
+	prefix, ok := w.config["prefix"].(string)
+	if !ok {
+		prefix = "flowcraft"
+	}
+	format, _ := w.config["format"].(string)
+	if format == "" {
+		format = "parquet"
+	}
+
+	var body []byte
+	var err error
+	contentType := "application/vnd.apache.parquet"
+	if format == "ndjson" {
+		body, err = ndjson(columns, rows)
+		contentType = "application/x-ndjson"
+	} else {
+		body, err = writeParquet(columns, rows)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	key := fmt.Sprintf("%s/dt=%s/%s.%s", table, time.Now().UTC().Format("2006-01-02"), batch, format)
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		key = prefix + "/" + key
+	}
+	return putObject(ctx, w.config, bucket, key, body, contentType)
+}
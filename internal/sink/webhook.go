@@ -0,0 +1,56 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/expression"
+)
+
+// WebhookDeliverer posts the output document to a URL
+type WebhookDeliverer struct{}
+
+// Deliver posts the document. Config: url (templated), method (default POST), headers.
+func (d *WebhookDeliverer) Deliver(ctx context.Context, config map[string]interface{}, data map[string]interface{}, document []byte) (string, error) {
+	rawURL, _ := config["url"].(string)
+	if rawURL == "" {
+		return "", fmt.Errorf("url is required")
+	}
+	url, err := expression.RenderURL(rawURL, data, expression.Options{RejectTemplateSyntax: true})
+	if err != nil {
+		return "", fmt.Errorf("failed to render url: %v", err)
+	}
+
+	method, _ := config["method"].(string)
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(document))
+	if err != nil {
+		return url, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if headers, ok := config["headers"].(map[string]interface{}); ok {
+		for key, value := range headers {
+			if str, ok := value.(string); ok {
+				req.Header.Set(key, expression.HeaderEscape(str))
+			}
+		}
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return url, fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return url, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	return url, nil
+}
@@ -0,0 +1,330 @@
+// Package sla checks workflows against their service level, records the breaches and alerts
+// about them or starts escalation workflows
+package sla
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/alerting"
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/dispatch"
+	"github.com/altipard/flowcraft/internal/models"
+	"github.com/altipard/flowcraft/internal/notify"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultWindow is the period the failure rate is measured over if the workflow sets none
+	defaultWindow = 24 * time.Hour
+	// minExecutions is the number of finished executions in the window a failure rate needs
+	minExecutions = 5
+	// lookback is how long after an execution breached its maximum duration it is still
+	// recorded, e.g. if no worker checked in between
+	lookback = 24 * time.Hour
+)
+
+// Validate checks the SLA settings of a workflow
+func Validate(workflow *models.Workflow) error {
+	if workflow.SLAMaxDuration != "" {
+		duration, err := time.ParseDuration(workflow.SLAMaxDuration)
+		if err != nil || duration <= 0 {
+			return fmt.Errorf("invalid sla_max_duration %q", workflow.SLAMaxDuration)
+		}
+	}
+	if workflow.SLAMaxFailureRate < 0 || workflow.SLAMaxFailureRate >= 100 {
+		return errors.New("sla_max_failure_rate must be a percentage below 100")
+	}
+	if workflow.SLAWindow != "" {
+		window, err := time.ParseDuration(workflow.SLAWindow)
+		if err != nil || window < time.Minute || window > 31*24*time.Hour {
+			return fmt.Errorf("invalid sla_window %q, expected a duration between 1m and 744h", workflow.SLAWindow)
+		}
+	}
+	if workflow.SLAAlertChannel != "" {
+		if err := alerting.ValidateChannel(workflow.SLAAlertChannel, workflow.SLAAlertTarget); err != nil {
+			return fmt.Errorf("invalid SLA alert: %v", err)
+		}
+	}
+	if workflow.SLAEscalationWorkflowID != nil && *workflow.SLAEscalationWorkflowID == workflow.ID && workflow.ID != 0 {
+		return errors.New("a workflow cannot escalate its SLA breaches to itself")
+	}
+	return nil
+}
+
+// Run checks the workflows with an SLA at the given interval until the context is done
+func Run(ctx context.Context, dispatcher *dispatch.Dispatcher, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var workflows []models.Workflow
+		err := database.DB.Where("parent_id IS NULL AND (sla_max_duration <> '' OR sla_max_failure_rate > 0)").
+			Find(&workflows).Error
+		if err != nil {
+			log.Printf("Failed to load workflows with an SLA: %v", err)
+			continue
+		}
+
+		for _, workflow := range workflows {
+			if err := Check(ctx, dispatcher, workflow); err != nil {
+				log.Printf("Failed to check the SLA of workflow %d: %v", workflow.ID, err)
+			}
+		}
+	}
+}
+
+// Check records the SLA breaches of a workflow and its published versions since the last check
+// and escalates them. Workers checking concurrently record each breach once.
+func Check(ctx context.Context, dispatcher *dispatch.Dispatcher, workflow models.Workflow) error {
+	var breaches []models.SLABreach
+
+	if workflow.SLAMaxDuration != "" {
+		recorded, err := checkDuration(workflow)
+		if err != nil {
+			return err
+		}
+		breaches = append(breaches, recorded...)
+	}
+
+	if workflow.SLAMaxFailureRate > 0 {
+		breach, err := checkFailureRate(workflow)
+		if err != nil {
+			return err
+		}
+		if breach != nil {
+			breaches = append(breaches, *breach)
+		}
+	}
+
+	for i := range breaches {
+		escalate(ctx, dispatcher, workflow, &breaches[i])
+	}
+	return nil
+}
+
+// executions returns a query of the executions of a workflow and its published versions
+func executions(db *gorm.DB, workflow models.Workflow) *gorm.DB {
+	return db.Model(&models.WorkflowExecution{}).
+		Joins("JOIN workflows ON workflows.id = workflow_executions.workflow_id").
+		Where("COALESCE(workflows.parent_id, workflows.id) = ?", workflow.ID)
+}
+
+// checkDuration records the executions that ran, or are still running, longer than the maximum
+// duration. Executions held back by the controls of their trigger have not started yet.
+func checkDuration(workflow models.Workflow) ([]models.SLABreach, error) {
+	maxDuration, err := time.ParseDuration(workflow.SLAMaxDuration)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+
+	var candidates []struct {
+		ID      uint
+		Seconds float64
+	}
+	err = executions(database.DB, workflow).
+		Select("workflow_executions.id, EXTRACT(EPOCH FROM COALESCE(workflow_executions.completed_at, ?) - workflow_executions.started_at) AS seconds", now).
+		Where("workflow_executions.sla_breached = ? AND workflow_executions.created_at >= ?", false, now.Add(-maxDuration-lookback)).
+		Where("workflow_executions.status NOT IN ?", []string{"held", "queued"}).
+		Where("EXTRACT(EPOCH FROM COALESCE(workflow_executions.completed_at, ?) - workflow_executions.started_at) > ?", now, maxDuration.Seconds()).
+		Scan(&candidates).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var breaches []models.SLABreach
+	for _, candidate := range candidates {
+		// Claim the execution, so its breach is recorded once
+		result := database.DB.Model(&models.WorkflowExecution{}).
+			Where("id = ? AND sla_breached = ?", candidate.ID, false).
+			Update("sla_breached", true)
+		if result.Error != nil {
+			return breaches, result.Error
+		}
+		if result.RowsAffected == 0 {
+			continue
+		}
+
+		executionID := candidate.ID
+		breach := models.SLABreach{
+			WorkflowID:          workflow.ID,
+			WorkflowExecutionID: &executionID,
+			Kind:                models.SLABreachDuration,
+			Threshold:           maxDuration.Seconds(),
+			Value:               candidate.Seconds,
+		}
+		if err := database.DB.Create(&breach).Error; err != nil {
+			return breaches, err
+		}
+		breaches = append(breaches, breach)
+	}
+	return breaches, nil
+}
+
+// checkFailureRate records a breach when the failure rate over the window exceeds the maximum,
+// and resolves the open breach when it is back within the SLA. It returns the new breach.
+func checkFailureRate(workflow models.Workflow) (*models.SLABreach, error) {
+	window := defaultWindow
+	if workflow.SLAWindow != "" {
+		var err error
+		if window, err = time.ParseDuration(workflow.SLAWindow); err != nil {
+			return nil, err
+		}
+	}
+	now := time.Now()
+
+	var recorded *models.SLABreach
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// Serialize the checks of the workflow, so a breach is opened once
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", fmt.Sprintf("sla:%d", workflow.ID)).Error; err != nil {
+			return err
+		}
+
+		var rate struct {
+			Total  int64
+			Failed int64
+		}
+		err := executions(tx, workflow).
+			Select("COUNT(*) AS total, COUNT(*) FILTER (WHERE workflow_executions.status = 'failed') AS failed").
+			Where("workflow_executions.status IN ? AND workflow_executions.completed_at >= ?", []string{"completed", "failed"}, now.Add(-window)).
+			Scan(&rate).Error
+		if err != nil {
+			return err
+		}
+		value := 0.0
+		if rate.Total > 0 {
+			value = 100 * float64(rate.Failed) / float64(rate.Total)
+		}
+		breached := rate.Total >= minExecutions && value > workflow.SLAMaxFailureRate
+
+		var open models.SLABreach
+		err = tx.Where("workflow_id = ? AND kind = ? AND resolved_at IS NULL", workflow.ID, models.SLABreachFailureRate).
+			First(&open).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		hasOpen := err == nil
+
+		switch {
+		case breached && !hasOpen:
+			// The breach is recorded on the last failed execution
+			var executionIDs []uint
+			err := executions(tx, workflow).
+				Where("workflow_executions.status = ? AND workflow_executions.completed_at >= ?", "failed", now.Add(-window)).
+				Order("workflow_executions.completed_at DESC").Limit(1).
+				Pluck("workflow_executions.id", &executionIDs).Error
+			if err != nil {
+				return err
+			}
+
+			breach := models.SLABreach{
+				WorkflowID: workflow.ID,
+				Kind:       models.SLABreachFailureRate,
+				Threshold:  workflow.SLAMaxFailureRate,
+				Value:      value,
+			}
+			if len(executionIDs) > 0 {
+				breach.WorkflowExecutionID = &executionIDs[0]
+				if err := tx.Model(&models.WorkflowExecution{}).Where("id = ?", executionIDs[0]).Update("sla_breached", true).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Create(&breach).Error; err != nil {
+				return err
+			}
+			recorded = &breach
+		case !breached && hasOpen:
+			return tx.Model(&open).Update("resolved_at", now).Error
+		}
+		return nil
+	})
+	return recorded, err
+}
+
+// escalate sends the alert of a breach and starts the escalation workflow, recording failures
+// on the breach
+func escalate(ctx context.Context, dispatcher *dispatch.Dispatcher, workflow models.Workflow, breach *models.SLABreach) {
+	var errs []string
+
+	if workflow.SLAAlertChannel != "" {
+		if err := alert(ctx, workflow, *breach); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+
+	if workflow.SLAEscalationWorkflowID != nil {
+		var escalation models.Workflow
+		if err := database.DB.First(&escalation, *workflow.SLAEscalationWorkflowID).Error; err != nil {
+			errs = append(errs, fmt.Sprintf("escalation workflow %d not found", *workflow.SLAEscalationWorkflowID))
+		} else if execution, err := dispatcher.Dispatch(escalation, input(workflow, *breach)); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to start escalation workflow: %v", err))
+		} else {
+			breach.EscalationExecutionID = &execution.ID
+		}
+	}
+
+	breach.Error = strings.Join(errs, "; ")
+	if breach.Error != "" {
+		log.Printf("Failed to escalate SLA breach %d of workflow %d: %s", breach.ID, workflow.ID, breach.Error)
+	}
+	database.DB.Model(breach).Updates(map[string]interface{}{
+		"escalation_execution_id": breach.EscalationExecutionID,
+		"error":                   breach.Error,
+	})
+}
+
+// input is the input of escalation workflows and the payload of webhook alerts
+func input(workflow models.Workflow, breach models.SLABreach) map[string]interface{} {
+	return map[string]interface{}{
+		"breach_id":             breach.ID,
+		"kind":                  breach.Kind,
+		"threshold":             breach.Threshold,
+		"value":                 breach.Value,
+		"workflow_id":           workflow.ID,
+		"workflow":              workflow.Name,
+		"workflow_execution_id": breach.WorkflowExecutionID,
+		"message":               describe(breach),
+		"timestamp":             breach.CreatedAt,
+	}
+}
+
+func alert(ctx context.Context, workflow models.Workflow, breach models.SLABreach) error {
+	link := ""
+	if publicURL := os.Getenv("PUBLIC_URL"); publicURL != "" {
+		link = fmt.Sprintf("%s/api/workflows/%d/sla-breaches", strings.TrimSuffix(publicURL, "/"), workflow.ID)
+	}
+	msg := notify.Message{
+		Subject: fmt.Sprintf("[SLA BREACH] %s", workflow.Name),
+		Text:    fmt.Sprintf("Workflow %q (%d): %s.", workflow.Name, workflow.ID, describe(breach)),
+		Link:    link,
+	}
+	return alerting.Deliver(ctx, workflow.SLAAlertChannel, workflow.SLAAlertTarget, msg, input(workflow, breach))
+}
+
+// describe explains a breach
+func describe(breach models.SLABreach) string {
+	if breach.Kind == models.SLABreachFailureRate {
+		return fmt.Sprintf("%.1f%% of the recent executions failed (SLA %.1f%%)", breach.Value, breach.Threshold)
+	}
+	return fmt.Sprintf("Execution %d ran for %s (SLA %s)", derefID(breach.WorkflowExecutionID),
+		(time.Duration(breach.Value) * time.Second).String(), (time.Duration(breach.Threshold) * time.Second).String())
+}
+
+func derefID(id *uint) uint {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
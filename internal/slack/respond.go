@@ -0,0 +1,200 @@
+package slack
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/queue"
+	"github.com/go-redis/redis/v8"
+)
+
+// ResponseWindow is how long a request waits for the response of a slackRespond node, leaving
+// Slack's 3 second timeout room for the network
+const ResponseWindow = 2500 * time.Millisecond
+
+// responseURLTTL is how long Slack accepts messages at the response URL of a request
+const responseURLTTL = 30 * time.Minute
+
+// registrationWait is how long a slackRespond node waits for the request that started its
+// execution to be registered, which happens right after the execution was dispatched
+const registrationWait = time.Second
+
+// pollInterval is how often the waiting request and slackRespond nodes check Redis
+const pollInterval = 50 * time.Millisecond
+
+// keyPrefix namespaces the keys of pending Slack requests in Redis
+const keyPrefix = "flowcraft:slack:"
+
+// ErrNotConfigured is returned when responding without Redis
+var ErrNotConfigured = errors.New("slack responses are not configured")
+
+// ErrNoRequest is returned by Respond if the execution was not started by a Slack request
+var ErrNoRequest = errors.New("execution was not started by a Slack request")
+
+var client redis.UniversalClient
+
+// Configure sets the queue whose Redis hands responses from the workers to the waiting requests
+func Configure(queueClient *queue.QueueClient) {
+	client = queueClient.RedisClient()
+}
+
+// waitingKey exists while the request that started the execution waits for a response
+func waitingKey(executionID uint) string {
+	return fmt.Sprintf("%swaiting:%d", keyPrefix, executionID)
+}
+
+// responsesKey receives the responses of the slackRespond nodes of the execution
+func responsesKey(executionID uint) string {
+	return fmt.Sprintf("%sresponses:%d", keyPrefix, executionID)
+}
+
+// urlKey holds the response URL of the request that started the execution
+func urlKey(executionID uint) string {
+	return fmt.Sprintf("%surl:%d", keyPrefix, executionID)
+}
+
+// Await registers the request that started an execution and waits until the deadline for the
+// response of a slackRespond node. It returns nil if none responded in time; responses of later
+// nodes are sent to the response URL.
+func Await(ctx context.Context, executionID uint, responseURL string, deadline time.Time) (*Message, error) {
+	if client == nil {
+		return nil, ErrNotConfigured
+	}
+	_, err := client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, urlKey(executionID), responseURL, responseURLTTL)
+		pipe.Set(ctx, waitingKey(executionID), "1", time.Until(deadline)+time.Minute)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for time.Now().Before(deadline) {
+		if message, err := popResponse(ctx, executionID); message != nil || err != nil {
+			return message, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	// Stop waiting, unless a node claimed the request in the meantime: nodes push their
+	// response before they claim the request, so it is there already
+	withdrawn, err := client.Del(ctx, waitingKey(executionID)).Result()
+	if err != nil || withdrawn == 1 {
+		return nil, err
+	}
+	return popResponse(ctx, executionID)
+}
+
+// popResponse takes the first response of a slackRespond node, nil if there is none
+func popResponse(ctx context.Context, executionID uint) (*Message, error) {
+	data, err := client.LPop(ctx, responsesKey(executionID)).Bytes()
+	if err == redis.Nil {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var message Message
+	if err := json.Unmarshal(data, &message); err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// Respond delivers the message of a slackRespond node for the request that started the
+// execution: as the response of the request if it still waits, otherwise to its response URL.
+// It reports whether the message was delivered within the request. Without a registered
+// request, the message is sent to fallbackURL if set, otherwise ErrNoRequest is returned.
+func Respond(ctx context.Context, executionID uint, message Message, fallbackURL string) (bool, error) {
+	if client == nil {
+		return false, ErrNotConfigured
+	}
+	data, err := json.Marshal(message)
+	if err != nil {
+		return false, err
+	}
+
+	responseURL, err := registeredURL(ctx, executionID)
+	if err != nil {
+		return false, err
+	}
+	if responseURL == nil {
+		if fallbackURL == "" {
+			return false, ErrNoRequest
+		}
+		return false, post(ctx, fallbackURL, data)
+	}
+
+	// Push the response, then claim the request. Requests that stopped waiting already are
+	// answered at their response URL instead.
+	responses := responsesKey(executionID)
+	pipe := client.TxPipeline()
+	pipe.RPush(ctx, responses, data)
+	pipe.Expire(ctx, responses, time.Minute)
+	claim := pipe.Del(ctx, waitingKey(executionID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, err
+	}
+	if claim.Val() == 1 {
+		return true, nil
+	}
+	if err := client.LRem(ctx, responses, 1, data).Err(); err != nil {
+		return false, err
+	}
+	if *responseURL == "" {
+		return false, errors.New("the Slack request has no response_url")
+	}
+	return false, post(ctx, *responseURL, data)
+}
+
+// registeredURL returns the response URL of the request that started the execution, waiting
+// briefly for the request to be registered. It returns nil if there is none.
+func registeredURL(ctx context.Context, executionID uint) (*string, error) {
+	deadline := time.Now().Add(registrationWait)
+	for {
+		responseURL, err := client.Get(ctx, urlKey(executionID)).Result()
+		if err == nil {
+			return &responseURL, nil
+		}
+		if err != redis.Nil {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// post sends a message to the response URL of a request
+func post(ctx context.Context, responseURL string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, responseURL, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("response_url returned status %d", resp.StatusCode)
+	}
+	return nil
+}
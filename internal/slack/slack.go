@@ -0,0 +1,145 @@
+// Package slack accepts Slack slash commands and interactivity requests for slack triggers and
+// hands the responses of slackRespond nodes back to Slack, within the 3 second window of the
+// request or later via its response URL
+package slack
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TriggerType is the type of triggers started by Slack slash commands and interactions
+const TriggerType = "slack"
+
+// CredentialType is the type of the credentials holding the signing secret of a Slack app
+const CredentialType = "slack"
+
+// maxRequestAge rejects replayed requests, as recommended by Slack
+const maxRequestAge = 5 * time.Minute
+
+// Response types of messages
+const (
+	ResponseEphemeral = "ephemeral"
+	ResponseInChannel = "in_channel"
+)
+
+// ErrInvalidSignature is returned for requests not signed with the signing secret of the app
+var ErrInvalidSignature = errors.New("invalid Slack signature")
+
+// TriggerConfig is the config of a slack trigger
+type TriggerConfig struct {
+	// CredentialID is the slack credential with the signing_secret of the Slack app
+	CredentialID uint `json:"credential_id"`
+	// Acknowledgement is shown to the user if no slackRespond node responded within the window,
+	// nothing if empty
+	Acknowledgement string `json:"acknowledgement,omitempty"`
+	// ResponseType of the acknowledgement, ephemeral (default) or in_channel
+	ResponseType string `json:"response_type,omitempty"`
+}
+
+// Message is a response to a Slack request
+type Message struct {
+	Text            string        `json:"text,omitempty"`
+	Blocks          []interface{} `json:"blocks,omitempty"`
+	ResponseType    string        `json:"response_type,omitempty"`
+	ReplaceOriginal bool          `json:"replace_original,omitempty"`
+}
+
+// ParseConfig reads and checks the config of a slack trigger
+func ParseConfig(config string) (TriggerConfig, error) {
+	var cfg TriggerConfig
+	if err := json.Unmarshal([]byte(config), &cfg); err != nil {
+		return cfg, fmt.Errorf("invalid slack trigger config: %v", err)
+	}
+	if cfg.CredentialID == 0 {
+		return cfg, errors.New("slack triggers need the credential_id of a slack credential in config")
+	}
+	switch cfg.ResponseType {
+	case "":
+		cfg.ResponseType = ResponseEphemeral
+	case ResponseEphemeral, ResponseInChannel:
+	default:
+		return cfg, errors.New("response_type must be ephemeral or in_channel")
+	}
+	return cfg, nil
+}
+
+// Verify checks the signature Slack computes over the timestamp and the raw body of a request
+// with the signing secret of the app, and that the request is recent
+func Verify(signingSecret, timestamp, signature string, body []byte, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > maxRequestAge || age < -maxRequestAge {
+		return errors.New("Slack request timestamp too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	fmt.Fprintf(mac, "v0:%s:", timestamp)
+	mac.Write(body)
+	expected := "v0=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Input maps the form fields of a slash command or an interactivity request to the input of
+// an execution. Slash commands carry the command, its text and the text split into args;
+// interactions (button clicks, shortcuts, modal submissions) their type, actions and the whole
+// payload. Both carry the user, channel, team and the response_url.
+func Input(values url.Values) (map[string]interface{}, error) {
+	if raw := values.Get("payload"); raw != "" {
+		var payload map[string]interface{}
+		if err := json.Unmarshal([]byte(raw), &payload); err != nil {
+			return nil, fmt.Errorf("invalid interactivity payload: %v", err)
+		}
+		user, _ := payload["user"].(map[string]interface{})
+		channel, _ := payload["channel"].(map[string]interface{})
+		team, _ := payload["team"].(map[string]interface{})
+		return map[string]interface{}{
+			"type":         payload["type"],
+			"user_id":      user["id"],
+			"user_name":    user["username"],
+			"channel_id":   channel["id"],
+			"channel_name": channel["name"],
+			"team_id":      team["id"],
+			"actions":      payload["actions"],
+			"callback_id":  payload["callback_id"],
+			"response_url": payload["response_url"],
+			"trigger_id":   payload["trigger_id"],
+			"payload":      payload,
+		}, nil
+	}
+
+	if values.Get("command") == "" {
+		return nil, errors.New("neither a slash command nor an interactivity payload")
+	}
+	text := values.Get("text")
+	args := strings.Fields(text)
+	if args == nil {
+		args = []string{}
+	}
+	return map[string]interface{}{
+		"type":         "slash_command",
+		"command":      values.Get("command"),
+		"text":         text,
+		"args":         args,
+		"user_id":      values.Get("user_id"),
+		"user_name":    values.Get("user_name"),
+		"channel_id":   values.Get("channel_id"),
+		"channel_name": values.Get("channel_name"),
+		"team_id":      values.Get("team_id"),
+		"response_url": values.Get("response_url"),
+		"trigger_id":   values.Get("trigger_id"),
+	}, nil
+}
@@ -0,0 +1,269 @@
+// Package sqs receives and deletes the messages of Amazon SQS queues over the JSON protocol.
+// Requests are signed with AWS Signature Version 4 using the keys of the client.
+package sqs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/cloudauth"
+)
+
+// MaxBatchSize is the most messages received or deleted with one request
+const MaxBatchSize = 10
+
+// MaxWaitTime is the longest a receive request polls for messages
+const MaxWaitTime = 20 * time.Second
+
+// MaxVisibilityTimeout is the longest messages can be hidden from other consumers
+const MaxVisibilityTimeout = 12 * time.Hour
+
+var httpClient = &http.Client{Timeout: MaxWaitTime + 30*time.Second}
+
+// Client sends requests to SQS with the keys of an AWS account
+type Client struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Region of requests not addressed to a queue URL naming one, us-east-1 by default
+	Region string
+	// Endpoint of requests not addressed to a queue, by default the AWS endpoint of the region
+	Endpoint string
+}
+
+// Message is a message received from a queue
+type Message struct {
+	MessageID     string `json:"MessageId"`
+	ReceiptHandle string `json:"ReceiptHandle"`
+	Body          string `json:"Body"`
+	// Attributes are the system attributes, e.g. ApproximateReceiveCount and SentTimestamp
+	Attributes        map[string]string           `json:"Attributes"`
+	MessageAttributes map[string]MessageAttribute `json:"MessageAttributes"`
+}
+
+// MessageAttribute is a custom attribute of a message
+type MessageAttribute struct {
+	DataType    string `json:"DataType"`
+	StringValue string `json:"StringValue,omitempty"`
+	BinaryValue []byte `json:"BinaryValue,omitempty"`
+}
+
+// ReceiveOptions configure the receiving of messages
+type ReceiveOptions struct {
+	// MaxMessages is the most messages received, 1 to 10
+	MaxMessages int
+	// WaitTime is how long to wait for messages if none are available, up to 20s
+	WaitTime time.Duration
+	// VisibilityTimeout hides the received messages from other consumers until they are deleted
+	// or it expires; zero uses the default of the queue
+	VisibilityTimeout time.Duration
+}
+
+// Error is an error returned by SQS
+type Error struct {
+	StatusCode int
+	// Code is the error type, e.g. QueueDoesNotExist or InvalidClientTokenId
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("sqs returned status %d: %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// IsAuthError reports whether SQS rejected the keys of a request or denied it
+func IsAuthError(err error) bool {
+	var sqsErr *Error
+	if !errors.As(err, &sqsErr) {
+		return false
+	}
+	switch sqsErr.Code {
+	case "InvalidClientTokenId", "UnrecognizedClientException", "SignatureDoesNotMatch",
+		"ExpiredToken", "MissingAuthenticationToken", "AccessDenied", "AccessDeniedException":
+		return true
+	}
+	return false
+}
+
+// ValidateQueueURL checks the URL of a queue, e.g. https://sqs.eu-west-1.amazonaws.com/123456789012/orders
+func ValidateQueueURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || strings.Trim(parsed.Path, "/") == "" {
+		return fmt.Errorf("invalid queue URL %q", raw)
+	}
+	return nil
+}
+
+// Receive receives messages of a queue, waiting up to the wait time of the options if none are
+// available
+func (c Client) Receive(ctx context.Context, queueURL string, opts ReceiveOptions) ([]Message, error) {
+	if opts.MaxMessages < 1 || opts.MaxMessages > MaxBatchSize {
+		return nil, fmt.Errorf("sqs: invalid batch size %d", opts.MaxMessages)
+	}
+	request := map[string]interface{}{
+		"QueueUrl":                    queueURL,
+		"MaxNumberOfMessages":         opts.MaxMessages,
+		"WaitTimeSeconds":             int(opts.WaitTime / time.Second),
+		"MessageSystemAttributeNames": []string{"All"},
+		"MessageAttributeNames":       []string{"All"},
+	}
+	if opts.VisibilityTimeout > 0 {
+		request["VisibilityTimeout"] = int(opts.VisibilityTimeout / time.Second)
+	}
+	var response struct {
+		Messages []Message `json:"Messages"`
+	}
+	if err := c.queueCall(ctx, queueURL, "ReceiveMessage", request, &response); err != nil {
+		return nil, err
+	}
+	return response.Messages, nil
+}
+
+// DeleteBatch deletes received messages by their receipt handles, up to 10 at a time
+func (c Client) DeleteBatch(ctx context.Context, queueURL string, receiptHandles []string) error {
+	entries := make([]map[string]interface{}, len(receiptHandles))
+	for i, handle := range receiptHandles {
+		entries[i] = map[string]interface{}{"Id": strconv.Itoa(i), "ReceiptHandle": handle}
+	}
+	return c.batch(ctx, queueURL, "DeleteMessageBatch", entries)
+}
+
+// ChangeVisibilityBatch hides received messages from other consumers for the timeout from now
+// on, up to 10 at a time. A timeout of zero makes them visible right away.
+func (c Client) ChangeVisibilityBatch(ctx context.Context, queueURL string, receiptHandles []string, timeout time.Duration) error {
+	entries := make([]map[string]interface{}, len(receiptHandles))
+	for i, handle := range receiptHandles {
+		entries[i] = map[string]interface{}{"Id": strconv.Itoa(i), "ReceiptHandle": handle, "VisibilityTimeout": int(timeout / time.Second)}
+	}
+	return c.batch(ctx, queueURL, "ChangeMessageVisibilityBatch", entries)
+}
+
+// ListQueues returns the URLs of up to max queues of the region, which checks the keys
+func (c Client) ListQueues(ctx context.Context, max int) ([]string, error) {
+	region := c.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://sqs.%s.amazonaws.com", region)
+	}
+	var response struct {
+		QueueUrls []string `json:"QueueUrls"`
+	}
+	if err := c.call(ctx, endpoint, region, "ListQueues", map[string]interface{}{"MaxResults": max}, &response); err != nil {
+		return nil, err
+	}
+	return response.QueueUrls, nil
+}
+
+// batch sends a batch request, failing if SQS did not process any of its entries
+func (c Client) batch(ctx context.Context, queueURL, action string, entries []map[string]interface{}) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	if len(entries) > MaxBatchSize {
+		return fmt.Errorf("sqs: batches have at most %d entries", MaxBatchSize)
+	}
+	var response struct {
+		Failed []struct {
+			ID      string `json:"Id"`
+			Code    string `json:"Code"`
+			Message string `json:"Message"`
+		} `json:"Failed"`
+	}
+	if err := c.queueCall(ctx, queueURL, action, map[string]interface{}{"QueueUrl": queueURL, "Entries": entries}, &response); err != nil {
+		return err
+	}
+	if len(response.Failed) > 0 {
+		failed := response.Failed[0]
+		return fmt.Errorf("sqs: %s failed for %d of %d messages: %s: %s", action, len(response.Failed), len(entries), failed.Code, failed.Message)
+	}
+	return nil
+}
+
+// queueCall sends a request to the endpoint of a queue URL, in the region named by its host
+func (c Client) queueCall(ctx context.Context, queueURL, action string, request, response interface{}) error {
+	parsed, err := url.Parse(queueURL)
+	if err != nil || parsed.Host == "" {
+		return fmt.Errorf("invalid queue URL %q", queueURL)
+	}
+	return c.call(ctx, parsed.Scheme+"://"+parsed.Host, queueRegion(parsed.Hostname(), c.Region), action, request, response)
+}
+
+// queueRegion returns the region named by the host of a queue URL, otherwise the fallback or
+// us-east-1
+func queueRegion(host, fallback string) string {
+	region := fallback
+	// Queue URLs are sqs.<region>.amazonaws.com/... or, in the legacy format,
+	// <region>.queue.amazonaws.com/...
+	labels := strings.Split(host, ".")
+	switch {
+	case len(labels) >= 4 && labels[0] == "sqs" && labels[2] == "amazonaws":
+		region = labels[1]
+	case len(labels) >= 4 && labels[1] == "queue" && labels[2] == "amazonaws":
+		region = labels[0]
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	return region
+}
+
+// call sends a signed request of the JSON protocol
+func (c Client) call(ctx context.Context, endpoint, region, action string, request, response interface{}) error {
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return errors.New("sqs: access key ID and secret access key are required")
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	parsed, err := url.Parse(strings.TrimSuffix(endpoint, "/") + "/")
+	if err != nil {
+		return fmt.Errorf("invalid endpoint: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, parsed.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.0")
+	req.Header.Set("X-Amz-Target", "AmazonSQS."+action)
+	credentials := cloudauth.AWSCredentials{AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, SessionToken: c.SessionToken}
+	credentials.SignV4(req, "sqs", region, body, time.Now())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Type         string `json:"__type"`
+			Message      string `json:"message"`
+			MessageUpper string `json:"Message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		sqsErr := &Error{StatusCode: resp.StatusCode, Code: failure.Type, Message: failure.Message}
+		// Types are namespaced, e.g. com.amazonaws.sqs#QueueDoesNotExist
+		if i := strings.LastIndex(sqsErr.Code, "#"); i >= 0 {
+			sqsErr.Code = sqsErr.Code[i+1:]
+		}
+		if sqsErr.Message == "" {
+			sqsErr.Message = failure.MessageUpper
+		}
+		return sqsErr
+	}
+	if response == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
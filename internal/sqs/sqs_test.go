@@ -0,0 +1,119 @@
+package sqs
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueueRegion(t *testing.T) {
+	tests := []struct {
+		host     string
+		fallback string
+		want     string
+	}{
+		{"sqs.eu-west-1.amazonaws.com", "", "eu-west-1"},
+		{"ap-southeast-2.queue.amazonaws.com", "us-west-2", "ap-southeast-2"},
+		{"localhost", "eu-central-1", "eu-central-1"},
+		{"localhost", "", "us-east-1"},
+	}
+	for _, tt := range tests {
+		if got := queueRegion(tt.host, tt.fallback); got != tt.want {
+			t.Errorf("queueRegion(%q, %q) = %q, want %q", tt.host, tt.fallback, got, tt.want)
+		}
+	}
+}
+
+func TestReceive(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("X-Amz-Target"); got != "AmazonSQS.ReceiveMessage" {
+			t.Errorf("X-Amz-Target = %q", got)
+		}
+		if got := r.Header.Get("Authorization"); !strings.Contains(got, "/eu-west-1/sqs/aws4_request") {
+			t.Errorf("Authorization = %q, want the scope of eu-west-1", got)
+		}
+		body, _ := io.ReadAll(r.Body)
+		var request map[string]interface{}
+		json.Unmarshal(body, &request)
+		if request["MaxNumberOfMessages"] != float64(5) || request["WaitTimeSeconds"] != float64(20) || request["VisibilityTimeout"] != float64(60) {
+			t.Errorf("request = %s", body)
+		}
+		w.Write([]byte(`{"Messages": [{"MessageId": "m1", "ReceiptHandle": "h1", "Body": "{\"id\":1}",
+			"Attributes": {"ApproximateReceiveCount": "2"},
+			"MessageAttributes": {"source": {"DataType": "String", "StringValue": "shop"}}}]}`))
+	}))
+	defer server.Close()
+
+	client := Client{AccessKeyID: "id", SecretAccessKey: "secret", Region: "eu-west-1"}
+	messages, err := client.Receive(context.Background(), server.URL+"/123456789012/orders", ReceiveOptions{
+		MaxMessages:       5,
+		WaitTime:          MaxWaitTime,
+		VisibilityTimeout: time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("Receive() returned %d messages, want 1", len(messages))
+	}
+	message := messages[0]
+	if message.MessageID != "m1" || message.ReceiptHandle != "h1" || message.Body != `{"id":1}` ||
+		message.Attributes["ApproximateReceiveCount"] != "2" || message.MessageAttributes["source"].StringValue != "shop" {
+		t.Errorf("message = %+v", message)
+	}
+}
+
+func TestCallError(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		response string
+		code     string
+		message  string
+		auth     bool
+	}{
+		{"namespaced type", http.StatusBadRequest, `{"__type": "com.amazonaws.sqs#QueueDoesNotExist", "message": "The queue does not exist."}`, "QueueDoesNotExist", "The queue does not exist.", false},
+		{"rejected keys", http.StatusBadRequest, `{"__type": "com.amazon.coral.service#UnrecognizedClientException", "Message": "The security token is invalid."}`, "UnrecognizedClientException", "The security token is invalid.", true},
+		{"denied", http.StatusForbidden, `{"__type": "AccessDenied", "message": "Access to the resource is denied."}`, "AccessDenied", "Access to the resource is denied.", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.response))
+			}))
+			defer server.Close()
+
+			client := Client{AccessKeyID: "id", SecretAccessKey: "secret"}
+			err := client.DeleteBatch(context.Background(), server.URL+"/123456789012/orders", []string{"h1"})
+			sqsErr, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("DeleteBatch() error = %v, want an *Error", err)
+			}
+			if sqsErr.StatusCode != tt.status || sqsErr.Code != tt.code || sqsErr.Message != tt.message {
+				t.Errorf("error = %+v, want status %d, code %s, message %q", sqsErr, tt.status, tt.code, tt.message)
+			}
+			if got := IsAuthError(err); got != tt.auth {
+				t.Errorf("IsAuthError() = %v, want %v", got, tt.auth)
+			}
+		})
+	}
+}
+
+func TestBatchFailedEntries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Successful": [{"Id": "0"}], "Failed": [{"Id": "1", "Code": "ReceiptHandleIsInvalid", "Message": "The receipt handle is not valid."}]}`))
+	}))
+	defer server.Close()
+
+	client := Client{AccessKeyID: "id", SecretAccessKey: "secret"}
+	err := client.DeleteBatch(context.Background(), server.URL+"/123456789012/orders", []string{"h1", "h2"})
+	if err == nil || !strings.Contains(err.Error(), "1 of 2 messages: ReceiptHandleIsInvalid") {
+		t.Errorf("DeleteBatch() error = %v, want the failed entry", err)
+	}
+}
@@ -0,0 +1,209 @@
+// Package state implements a small key-value store for workflows, e.g. the last item seen by
+// a polling trigger or dedupe keys. Values are JSON and can expire.
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+	"gorm.io/gorm/clause"
+)
+
+// Scope kinds
+const (
+	ScopeGlobal   = "global"
+	ScopeWorkflow = "workflow"
+	ScopeTrigger  = "trigger"
+)
+
+// maxKeyLength limits the length of state keys
+const maxKeyLength = 255
+
+// Scope identifies the namespace of state entries
+type Scope struct {
+	Kind string
+	ID   uint
+}
+
+// ParseScope creates a scope of the given kind. Workflow and trigger scopes require an ID.
+func ParseScope(kind string, id uint) (Scope, error) {
+	switch kind {
+	case ScopeGlobal:
+		return Scope{Kind: ScopeGlobal}, nil
+	case ScopeWorkflow, ScopeTrigger:
+		if id == 0 {
+			return Scope{}, fmt.Errorf("%s scope requires an ID", kind)
+		}
+		return Scope{Kind: kind, ID: id}, nil
+	default:
+		return Scope{}, fmt.Errorf("unknown scope: %s", kind)
+	}
+}
+
+// String returns the stored form of the scope
+func (s Scope) String() string {
+	if s.Kind == ScopeGlobal {
+		return ScopeGlobal
+	}
+	return fmt.Sprintf("%s:%d", s.Kind, s.ID)
+}
+
+// ErrNotFound is returned for missing or expired keys
+var ErrNotFound = errors.New("key not found")
+
+// Get returns the value of a key
+func Get(scope Scope, key string) (interface{}, error) {
+	var entry models.StateEntry
+	result := database.DB.Where("scope = ? AND key = ? AND (expires_at IS NULL OR expires_at > ?)", scope.String(), key, time.Now()).
+		Limit(1).Find(&entry)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(entry.Value), &value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// Set stores the value of a key. A ttl of zero keeps the value until it is overwritten or deleted.
+func Set(scope Scope, key string, value interface{}, ttl time.Duration) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal value: %v", err)
+	}
+
+	entry := models.StateEntry{
+		Scope:     scope.String(),
+		Key:       key,
+		Value:     string(valueJSON),
+		ExpiresAt: expiry(ttl),
+	}
+	return database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "scope"}, {Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value", "expires_at", "updated_at"}),
+	}).Create(&entry).Error
+}
+
+// Incr atomically adds delta to a numeric value and returns the result. Missing or expired keys
+// start at zero; the ttl only applies when the key is created.
+func Incr(scope Scope, key string, delta float64, ttl time.Duration) (float64, error) {
+	if err := validateKey(key); err != nil {
+		return 0, err
+	}
+
+	var result struct{ Value float64 }
+	err := database.DB.Raw(`
+INSERT INTO state_entries (scope, key, value, expires_at, created_at, updated_at)
+VALUES (@scope, @key, to_jsonb(@delta::numeric), @expires_at, @now, @now)
+ON CONFLICT (scope, key) DO UPDATE SET
+	value = to_jsonb(CASE WHEN state_entries.expires_at <= @now THEN 0
+		ELSE COALESCE((state_entries.value #>> '{}')::numeric, 0) END + @delta::numeric),
+	expires_at = CASE WHEN state_entries.expires_at <= @now THEN EXCLUDED.expires_at
+		ELSE state_entries.expires_at END,
+	updated_at = @now
+RETURNING (value #>> '{}')::float8 AS value`,
+		map[string]interface{}{
+			"scope":      scope.String(),
+			"key":        key,
+			"delta":      delta,
+			"expires_at": expiry(ttl),
+			"now":        time.Now(),
+		}).Scan(&result).Error
+	if err != nil {
+		return 0, fmt.Errorf("failed to increment %s: %v", key, err)
+	}
+
+	return result.Value, nil
+}
+
+// Delete removes a key
+func Delete(scope Scope, key string) error {
+	return database.DB.Where("scope = ? AND key = ?", scope.String(), key).Delete(&models.StateEntry{}).Error
+}
+
+// PurgeExpired periodically deletes expired entries until the context is cancelled
+func PurgeExpired(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := database.DB.Where("expires_at <= ?", time.Now()).Delete(&models.StateEntry{}).Error; err != nil {
+			log.Printf("Failed to purge expired state entries: %v", err)
+		}
+	}
+}
+
+// Resolver resolves "<scope>.<key>" paths of templates against the state of an execution
+type Resolver struct {
+	WorkflowID uint
+	TriggerID  uint
+}
+
+// Resolve returns the value of a path like "workflow.last_id" or "global.counter"
+func (r Resolver) Resolve(path string) (interface{}, bool) {
+	kind, key, ok := strings.Cut(path, ".")
+	if !ok {
+		return nil, false
+	}
+
+	var id uint
+	switch kind {
+	case ScopeWorkflow:
+		id = r.WorkflowID
+	case ScopeTrigger:
+		id = r.TriggerID
+	}
+
+	scope, err := ParseScope(kind, id)
+	if err != nil {
+		return nil, false
+	}
+
+	value, err := Get(scope, key)
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// validateKey rejects empty and overlong keys
+func validateKey(key string) error {
+	if key == "" {
+		return errors.New("key is required")
+	}
+	if len(key) > maxKeyLength {
+		return fmt.Errorf("key must not be longer than %d characters", maxKeyLength)
+	}
+	return nil
+}
+
+// expiry returns the expiry time for a ttl, or nil for values that don't expire
+func expiry(ttl time.Duration) *time.Time {
+	if ttl <= 0 {
+		return nil
+	}
+	expiresAt := time.Now().Add(ttl)
+	return &expiresAt
+}
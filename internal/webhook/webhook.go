@@ -0,0 +1,164 @@
+// Package webhook turns requests received by webhook triggers into execution input and keeps
+// a record of them for inspection and replay
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/altipard/flowcraft/internal/database"
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// Config holds the limits of webhook triggers
+type Config struct {
+	// MaxBodySize is the largest request body accepted by webhook triggers
+	MaxBodySize int64
+	// Retention is how long deliveries are kept
+	Retention time.Duration
+	// MaxDeliveries is the number of deliveries kept per trigger, older ones are removed
+	MaxDeliveries int
+}
+
+var config = Config{MaxBodySize: 1 << 20, Retention: 7 * 24 * time.Hour, MaxDeliveries: 1000}
+
+// ConfigFromEnv reads the webhook settings from the environment
+func ConfigFromEnv() Config {
+	cfg := Config{MaxBodySize: 1 << 20, Retention: 7 * 24 * time.Hour, MaxDeliveries: 1000}
+
+	if size, err := strconv.ParseInt(os.Getenv("WEBHOOK_MAX_BODY_SIZE"), 10, 64); err == nil && size > 0 {
+		cfg.MaxBodySize = size
+	}
+	if retention, err := time.ParseDuration(os.Getenv("WEBHOOK_RETENTION")); err == nil && retention > 0 {
+		cfg.Retention = retention
+	}
+	if count, err := strconv.Atoi(os.Getenv("WEBHOOK_MAX_DELIVERIES")); err == nil && count > 0 {
+		cfg.MaxDeliveries = count
+	}
+
+	return cfg
+}
+
+// Configure sets the webhook settings
+func Configure(cfg Config) {
+	config = cfg
+}
+
+// MaxBodySize returns the largest request body accepted by webhook triggers
+func MaxBodySize() int64 {
+	return config.MaxBodySize
+}
+
+// NewDelivery creates the record of a received request. Only the first value of each header is kept.
+func NewDelivery(trigger models.Trigger, method string, query url.Values, header http.Header, body []byte) models.WebhookDelivery {
+	headers := make(map[string]string, len(header))
+	for name := range header {
+		headers[name] = header.Get(name)
+	}
+	headersJSON, _ := json.Marshal(headers)
+
+	return models.WebhookDelivery{
+		TriggerID:   trigger.ID,
+		Method:      method,
+		Query:       query.Encode(),
+		Headers:     string(headersJSON),
+		ContentType: header.Get("Content-Type"),
+		Body:        body,
+		BodySize:    int64(len(body)),
+		ReceivedAt:  time.Now(),
+	}
+}
+
+// Input builds the execution input of a delivery: method, headers, query parameters and the body,
+// decoded from JSON or form encoding, or as text
+func Input(delivery models.WebhookDelivery) map[string]interface{} {
+	var headers map[string]interface{}
+	json.Unmarshal([]byte(delivery.Headers), &headers)
+
+	query := map[string]interface{}{}
+	if values, err := url.ParseQuery(delivery.Query); err == nil {
+		for key := range values {
+			query[key] = values.Get(key)
+		}
+	}
+
+	return map[string]interface{}{
+		"method":  delivery.Method,
+		"headers": headers,
+		"query":   query,
+		"body":    decodeBody(delivery.ContentType, delivery.Body),
+	}
+}
+
+// decodeBody decodes a request body according to its content type
+func decodeBody(contentType string, body []byte) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var value interface{}
+		if err := json.Unmarshal(body, &value); err == nil {
+			return value
+		}
+	case mediaType == "application/x-www-form-urlencoded":
+		if values, err := url.ParseQuery(string(body)); err == nil {
+			form := make(map[string]interface{}, len(values))
+			for key := range values {
+				form[key] = values.Get(key)
+			}
+			return form
+		}
+	}
+
+	if utf8.Valid(body) {
+		return string(body)
+	}
+	return nil
+}
+
+// Record stores a delivery if the trigger records deliveries, removing the trigger's oldest
+// deliveries beyond the configured limit
+func Record(trigger models.Trigger, delivery *models.WebhookDelivery) {
+	if !trigger.RecordDeliveries {
+		return
+	}
+
+	if err := database.DB.Create(delivery).Error; err != nil {
+		log.Printf("Failed to record webhook delivery of trigger %d: %v", trigger.ID, err)
+		return
+	}
+
+	database.DB.Exec(`DELETE FROM webhook_deliveries WHERE trigger_id = ? AND id NOT IN (
+		SELECT id FROM webhook_deliveries WHERE trigger_id = ? ORDER BY id DESC LIMIT ?)`,
+		trigger.ID, trigger.ID, config.MaxDeliveries)
+}
+
+// PurgeExpired removes deliveries older than the retention period at the given interval until ctx is done
+func PurgeExpired(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := database.DB.Where("received_at < ?", time.Now().Add(-config.Retention)).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			log.Printf("Failed to purge webhook deliveries: %v", err)
+		}
+	}
+}
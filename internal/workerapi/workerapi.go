@@ -0,0 +1,240 @@
+// Package workerapi is the internal API through which workers without database access load the
+// executions they run and report the results of their nodes. The server validates and stores
+// all writes. Client implements the Store of the engine on top of it.
+package workerapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/altipard/flowcraft/internal/engine"
+	"github.com/altipard/flowcraft/internal/models"
+)
+
+// Config holds the settings of workers using the worker API
+type Config struct {
+	// URL is the base URL of the server, e.g. http://flowcraft:8080; empty makes workers use
+	// the database
+	URL string
+	// Token is the internal API service token of the server
+	Token string
+	// Timeout limits each request to the server
+	Timeout time.Duration
+}
+
+// ConfigFromEnv reads the worker API settings from the environment
+func ConfigFromEnv() Config {
+	cfg := Config{
+		URL:     strings.TrimRight(os.Getenv("WORKER_API_URL"), "/"),
+		Token:   os.Getenv("INTERNAL_API_TOKEN"),
+		Timeout: 30 * time.Second,
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("WORKER_API_TIMEOUT")); err == nil && timeout > 0 {
+		cfg.Timeout = timeout
+	}
+	return cfg
+}
+
+// Enabled reports whether workers use the worker API instead of the database
+func (c Config) Enabled() bool {
+	return c.URL != ""
+}
+
+// ExecutionDefinition is an execution with everything a worker needs to run it
+type ExecutionDefinition struct {
+	Execution models.WorkflowExecution `json:"execution"`
+	// Workflow is the workflow graph, with its nodes, connections and groups
+	Workflow models.Workflow `json:"workflow"`
+	// NodeTypes are the node types of the nodes of the workflow
+	NodeTypes []models.NodeType `json:"node_types"`
+}
+
+// Client is the engine Store of workers using the worker API
+type Client struct {
+	config     Config
+	httpClient *http.Client
+
+	// nodeTypes are the node types of the executions loaded so far
+	mu        sync.RWMutex
+	nodeTypes map[string]models.NodeType
+}
+
+// NewClient creates a client of the worker API
+func NewClient(cfg Config) (*Client, error) {
+	if cfg.Token == "" {
+		return nil, errors.New("the worker API requires INTERNAL_API_TOKEN")
+	}
+	return &Client{
+		config:     cfg,
+		httpClient: &http.Client{Timeout: cfg.Timeout},
+		nodeTypes:  map[string]models.NodeType{},
+	}, nil
+}
+
+func (c *Client) Execution(id uint) (*models.WorkflowExecution, error) {
+	var definition ExecutionDefinition
+	if err := c.do(http.MethodGet, executionPath(id), nil, &definition); err != nil {
+		return nil, err
+	}
+
+	// Node types are refreshed with every execution, so changes apply to the next one
+	c.mu.Lock()
+	for _, nodeType := range definition.NodeTypes {
+		c.nodeTypes[nodeType.Key] = nodeType
+	}
+	c.mu.Unlock()
+
+	execution := definition.Execution
+	execution.Workflow = definition.Workflow
+	return &execution, nil
+}
+
+func (c *Client) NodeType(key string) (models.NodeType, error) {
+	c.mu.RLock()
+	nodeType, ok := c.nodeTypes[key]
+	c.mu.RUnlock()
+	if ok {
+		return nodeType, nil
+	}
+
+	if err := c.do(http.MethodGet, "/api/internal/node-types/"+url.PathEscape(key), nil, &nodeType); err != nil {
+		return nodeType, err
+	}
+	c.mu.Lock()
+	c.nodeTypes[key] = nodeType
+	c.mu.Unlock()
+	return nodeType, nil
+}
+
+func (c *Client) SaveExecution(execution *models.WorkflowExecution) error {
+	return c.do(http.MethodPut, executionPath(execution.ID), execution, execution)
+}
+
+func (c *Client) CompleteExecution(execution *models.WorkflowExecution) error {
+	return c.do(http.MethodPost, executionPath(execution.ID)+"/complete", execution, execution)
+}
+
+func (c *Client) CancelRequested(executionID uint) (bool, error) {
+	var result struct {
+		CancelRequested bool `json:"cancel_requested"`
+	}
+	err := c.do(http.MethodGet, executionPath(executionID)+"/cancel-requested", nil, &result)
+	return result.CancelRequested, err
+}
+
+func (c *Client) NodeExecutions(executionID uint, filter engine.NodeExecutionFilter) ([]models.NodeExecution, error) {
+	query := url.Values{}
+	if filter.NodeID != 0 {
+		query.Set("node_id", strconv.FormatUint(uint64(filter.NodeID), 10))
+	}
+	for _, status := range filter.Statuses {
+		query.Add("status", status)
+	}
+	if filter.ExcludeCompensations {
+		query.Set("exclude_compensations", "true")
+	}
+
+	var nodeExecutions []models.NodeExecution
+	err := c.do(http.MethodGet, executionPath(executionID)+"/node-executions?"+query.Encode(), nil, &nodeExecutions)
+	return nodeExecutions, err
+}
+
+func (c *Client) SaveNodeExecution(nodeExecution *models.NodeExecution) error {
+	path := executionPath(nodeExecution.WorkflowExecutionID) + "/node-executions"
+	if nodeExecution.ID == 0 {
+		return c.do(http.MethodPost, path, nodeExecution, nodeExecution)
+	}
+	return c.do(http.MethodPut, path+"/"+strconv.FormatUint(uint64(nodeExecution.ID), 10), nodeExecution, nodeExecution)
+}
+
+func (c *Client) ClaimNode(nodeExecution *models.NodeExecution, previousID uint) (bool, error) {
+	path := executionPath(nodeExecution.WorkflowExecutionID) + "/node-executions"
+	method := http.MethodPost
+	if nodeExecution.ID != 0 {
+		path += "/" + strconv.FormatUint(uint64(nodeExecution.ID), 10)
+		method = http.MethodPut
+	}
+	path += "?previous_id=" + strconv.FormatUint(uint64(previousID), 10)
+
+	err := c.do(method, path, nodeExecution, nodeExecution)
+	var failure *apiError
+	if errors.As(err, &failure) && failure.status == http.StatusPreconditionFailed {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (c *Client) SaveNodeProfile(profile *models.NodeProfile) error {
+	path := fmt.Sprintf("%s/node-executions/%d/profile", executionPath(profile.WorkflowExecutionID), profile.NodeExecutionID)
+	return c.do(http.MethodPost, path, profile, profile)
+}
+
+func (c *Client) SaveArtifact(artifact *models.ExecutionArtifact) error {
+	path := fmt.Sprintf("%s/node-executions/%d/artifacts", executionPath(artifact.WorkflowExecutionID), artifact.NodeExecutionID)
+	return c.do(http.MethodPost, path, artifact, artifact)
+}
+
+// executionPath returns the path of an execution in the worker API
+func executionPath(id uint) string {
+	return "/api/internal/executions/" + strconv.FormatUint(uint64(id), 10)
+}
+
+// apiError is an error response of the worker API
+type apiError struct {
+	method, path, message string
+	status                int
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("worker API %s %s: %s (status %d)", e.method, e.path, e.message, e.status)
+}
+
+// do sends a request to the worker API and decodes the response into result
+func (c *Client) do(method, path string, body, result interface{}) error {
+	var reader *bytes.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req, err := http.NewRequest(method, c.config.URL+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.config.Token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("worker API %s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&failure)
+		return &apiError{method: method, path: path, message: failure.Error, status: resp.StatusCode}
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,26 @@
+// Package builtin registers the executors of the platform that run without its database, queue
+// or workers as defaults of the embeddable engine. Executors keeping state or waiting for people
+// (state, cache, approval, events, tasks, credentials) need the platform.
+//
+//	import _ "github.com/altipard/flowcraft/pkg/engine/builtin"
+//
+//	registry := engine.NewDefaultRegistry()
+package builtin
+
+import (
+	internal "github.com/altipard/flowcraft/internal/engine"
+	"github.com/altipard/flowcraft/pkg/engine"
+)
+
+// Classes are the executor classes registered by the package
+var Classes = []string{"httpRequest", "filter", "condition", "transform", "template"}
+
+func init() {
+	for _, class := range Classes {
+		class := class
+		engine.RegisterDefault(class, func() engine.NodeExecutor {
+			executor, _ := internal.LoadExecutor(class)
+			return executor
+		})
+	}
+}
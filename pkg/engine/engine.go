@@ -0,0 +1,272 @@
+// Package engine embeds FlowCraft's execution engine in other Go services. Workflows are
+// loaded from and executions recorded in a Store, executors are looked up in a Registry, so
+// that the engine runs without the database, queue and workers of the platform. Services
+// register their own executors next to the built-in stateless ones of the builtin package:
+//
+//	import _ "github.com/altipard/flowcraft/pkg/engine/builtin"
+//
+//	registry := engine.NewDefaultRegistry()
+//	registry.Register("sendInvoice", func() engine.NodeExecutor { return &InvoiceExecutor{} })
+//	e := engine.New(store, registry)
+//	execution, err := e.Execute(ctx, workflowID, input)
+//
+// Start nodes get the execution input, other nodes the outputs of their predecessors by target
+// handle once all predecessors finished, and nodes none of whose incoming connections were
+// taken are skipped. Disabled nodes and groups, annotations and node timeouts are handled as on
+// the platform, cancelling the context stops the run before the next node.
+//
+// Nodes are ordered by the same Scheduler the platform's workers use, but the engine runs each
+// node once and stops at the first failure. Retries, checkpoints and resuming executions,
+// waiting nodes, compensation and sub-workflows need the platform.
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Engine executes workflows
+type Engine struct {
+	store      Store
+	registry   *Registry
+	middleware []Middleware
+}
+
+// New creates an engine. A nil registry uses NewDefaultRegistry.
+func New(store Store, registry *Registry) *Engine {
+	if registry == nil {
+		registry = NewDefaultRegistry()
+	}
+	return &Engine{store: store, registry: registry}
+}
+
+// Registry returns the executors of the engine
+func (e *Engine) Registry() *Registry {
+	return e.registry
+}
+
+// Use adds middleware around the executors of all nodes the engine runs. Middleware added
+// first runs outermost.
+func (e *Engine) Use(m ...Middleware) {
+	e.middleware = append(e.middleware, m...)
+}
+
+// Execute loads the workflow from the store and runs it with the input
+func (e *Engine) Execute(ctx context.Context, workflowID uint, input map[string]interface{}) (*Execution, error) {
+	workflow, err := e.store.LoadWorkflow(ctx, workflowID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workflow %d: %w", workflowID, err)
+	}
+	return e.Run(ctx, workflow, input)
+}
+
+// Validate checks that the executors of all nodes are registered and the connections
+// reference nodes of the workflow
+func (e *Engine) Validate(workflow *Workflow) error {
+	nodes := make(map[uint]bool, len(workflow.Nodes))
+	for _, node := range workflow.Nodes {
+		// Annotations are not run and cannot be connected
+		if node.IsAnnotation() {
+			continue
+		}
+		if !node.Disabled && !e.registry.Has(node.ExecutorClass) {
+			return fmt.Errorf("node %d (%s) uses the executor class %s, which is not registered", node.ID, node.Name, node.ExecutorClass)
+		}
+		nodes[node.ID] = true
+	}
+	for _, conn := range workflow.Connections {
+		if !nodes[conn.SourceNodeID] || !nodes[conn.TargetNodeID] {
+			return fmt.Errorf("connection %d -> %d references an unknown node", conn.SourceNodeID, conn.TargetNodeID)
+		}
+	}
+	return nil
+}
+
+// Run executes the workflow with the input and records the execution in the store. It stops at
+// the first failing node; the returned execution is failed then and the error describes why.
+// Executions whose context is cancelled are recorded as cancelled.
+func (e *Engine) Run(ctx context.Context, workflow *Workflow, input map[string]interface{}) (*Execution, error) {
+	if err := e.Validate(workflow); err != nil {
+		return nil, err
+	}
+	if input == nil {
+		input = map[string]interface{}{}
+	}
+
+	execution := &Execution{
+		WorkflowID: workflow.ID,
+		Status:     "running",
+		Input:      input,
+		Outputs:    map[uint]interface{}{},
+		StartedAt:  time.Now(),
+	}
+	if err := e.store.SaveExecution(ctx, execution); err != nil {
+		return nil, fmt.Errorf("failed to save execution: %w", err)
+	}
+
+	r := newRun(ctx, e, workflow, execution)
+	runErr := r.start()
+
+	now := time.Now()
+	execution.CompletedAt = &now
+	execution.Status = "completed"
+	if runErr != nil {
+		execution.Status = "failed"
+		if errors.Is(ctx.Err(), context.Canceled) {
+			execution.Status = StatusCancelled
+		}
+		execution.Error = runErr.Error()
+	}
+	if err := e.store.SaveExecution(ctx, execution); err != nil && runErr == nil {
+		runErr = fmt.Errorf("failed to save execution: %w", err)
+	}
+	return execution, runErr
+}
+
+// run is the state of a single execution
+type run struct {
+	ctx            context.Context
+	engine         *Engine
+	execution      *Execution
+	nodes          map[uint]Node
+	order          []uint
+	scheduler      *Scheduler
+	disabledGroups map[uint]bool
+}
+
+func newRun(ctx context.Context, e *Engine, workflow *Workflow, execution *Execution) *run {
+	r := &run{
+		ctx:            ctx,
+		engine:         e,
+		execution:      execution,
+		nodes:          make(map[uint]Node, len(workflow.Nodes)),
+		scheduler:      NewScheduler(workflow.Connections),
+		disabledGroups: map[uint]bool{},
+	}
+	for _, node := range workflow.Nodes {
+		if node.IsAnnotation() {
+			continue
+		}
+		r.nodes[node.ID] = node
+		r.order = append(r.order, node.ID)
+	}
+	for _, group := range workflow.Groups {
+		r.disabledGroups[group.ID] = group.Disabled
+	}
+	return r
+}
+
+// start executes the start nodes (nodes without incoming connections) and everything after
+// them. Before each node it checks whether the context was cancelled.
+func (r *run) start() error {
+	steps := r.scheduler.StartSteps(r.order)
+	if len(steps) == 0 {
+		return fmt.Errorf("workflow has no start nodes")
+	}
+	return r.scheduler.Run(steps, func(step Step) (bool, error) {
+		if err := r.ctx.Err(); err != nil {
+			return false, err
+		}
+		if step.Skip {
+			return true, r.skip(step.NodeID)
+		}
+		return true, r.execute(r.nodes[step.NodeID])
+	})
+}
+
+// execute runs a node and records it
+func (r *run) execute(node Node) error {
+	// The nodes of disabled groups are skipped as a unit
+	if node.GroupID != nil && r.disabledGroups[*node.GroupID] {
+		return r.skip(node.ID)
+	}
+	if node.Disabled && node.DisabledMode == DisabledSkip {
+		return r.skip(node.ID)
+	}
+
+	// Disabled nodes forward their input instead
+	executor := NewPassthroughExecutor(r.scheduler.IsStart(node.ID))
+	if !node.Disabled {
+		var err error
+		executor, err = r.engine.registry.Load(node.ExecutorClass)
+		if err != nil {
+			return fmt.Errorf("node %d (%s): %v", node.ID, node.Name, err)
+		}
+	}
+
+	// Executors may modify their configuration, each execution gets its own copy
+	config := map[string]interface{}{}
+	if node.Config != nil {
+		data, _ := json.Marshal(node.Config)
+		json.Unmarshal(data, &config)
+	}
+
+	input, _ := r.scheduler.Input(node.ID, r.execution.Input, r.execution.Outputs)
+	nodeExecution := &NodeExecution{
+		ExecutionID: r.execution.ID,
+		NodeID:      node.ID,
+		Input:       input,
+		StartedAt:   time.Now(),
+	}
+
+	// Invalid timeouts fail the node like executor errors
+	var output interface{}
+	timeout, err := NodeTimeout(config)
+	if err == nil {
+		output, err = ExecuteInvocation(r.ctx, r.engine.middleware, executor, &Invocation{
+			ExecutionInfo: ExecutionInfo{
+				WorkflowID:  r.execution.WorkflowID,
+				ExecutionID: r.execution.ID,
+				NodeID:      node.ID,
+				Attempt:     1,
+			},
+			NodeType:      node.NodeType,
+			ExecutorClass: node.ExecutorClass,
+			Config:        config,
+			Input:         input,
+			Timeout:       timeout,
+		})
+	}
+	nodeExecution.CompletedAt = time.Now()
+	if err != nil {
+		nodeExecution.Status = "failed"
+		nodeExecution.Error = err.Error()
+		r.engine.store.SaveNodeExecution(r.ctx, nodeExecution)
+		return fmt.Errorf("node %d (%s) failed: %v", node.ID, node.Name, err)
+	}
+
+	// Branching nodes only activate the connections of one output handle
+	if branch, ok := output.(*BranchResult); ok {
+		nodeExecution.OutputHandle = branch.Handle
+		output = branch.Output
+	}
+	nodeExecution.Status = "completed"
+	nodeExecution.Output = output
+	if err := r.engine.store.SaveNodeExecution(r.ctx, nodeExecution); err != nil {
+		return fmt.Errorf("failed to save execution of node %d: %w", node.ID, err)
+	}
+	r.execution.Outputs[node.ID] = output
+	r.scheduler.Finish(node.ID, Outcome{Handle: nodeExecution.OutputHandle})
+	return nil
+}
+
+// skip records a node none of whose inputs were taken, so the skip propagates to the
+// successors only reachable through it
+func (r *run) skip(nodeID uint) error {
+	now := time.Now()
+	err := r.engine.store.SaveNodeExecution(r.ctx, &NodeExecution{
+		ExecutionID: r.execution.ID,
+		NodeID:      nodeID,
+		Status:      "skipped",
+		StartedAt:   now,
+		CompletedAt: now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save execution of node %d: %w", nodeID, err)
+	}
+	r.scheduler.Finish(nodeID, Outcome{Skipped: true})
+	return nil
+}
@@ -0,0 +1,202 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// recordExecutor returns its config value "out", or its input if there is none
+type recordExecutor struct{}
+
+func (recordExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	if out, ok := config["out"]; ok {
+		return out, nil
+	}
+	return input, nil
+}
+
+// blockingExecutor waits until its context is done
+type blockingExecutor struct{}
+
+func (blockingExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	return nil, errors.New("context required")
+}
+
+func (blockingExecutor) ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func testEngine() (*Engine, *MemoryStore) {
+	registry := NewRegistry()
+	registry.Register("record", func() NodeExecutor { return recordExecutor{} })
+	registry.Register("block", func() NodeExecutor { return blockingExecutor{} })
+	store := NewMemoryStore()
+	return New(store, registry), store
+}
+
+func node(id uint, class string, config map[string]interface{}) Node {
+	return Node{ID: id, Name: class, NodeType: class, ExecutorClass: class, Config: config}
+}
+
+func connect(source, target uint) Connection {
+	return Connection{SourceNodeID: source, TargetNodeID: target}
+}
+
+func statuses(store *MemoryStore, executionID uint) map[uint]string {
+	result := map[uint]string{}
+	for _, nodeExecution := range store.NodeExecutions(executionID) {
+		result[nodeExecution.NodeID] = nodeExecution.Status
+	}
+	return result
+}
+
+func TestRunDisabledNodes(t *testing.T) {
+	e, store := testEngine()
+	passthrough := node(2, "record", map[string]interface{}{"out": "replaced"})
+	passthrough.Disabled = true
+	skipped := node(4, "record", map[string]interface{}{"out": "skipped"})
+	skipped.Disabled = true
+	skipped.DisabledMode = "skip"
+	workflow := &Workflow{
+		Nodes: []Node{
+			node(1, "record", map[string]interface{}{"out": "first"}),
+			passthrough,
+			node(3, "record", nil),
+			skipped,
+			node(5, "record", nil),
+		},
+		Connections: []Connection{connect(1, 2), connect(2, 3), connect(1, 4), connect(4, 5)},
+	}
+
+	execution, err := e.Run(context.Background(), workflow, nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got := execution.Outputs[2]; got != "first" {
+		t.Errorf("output of passthrough node = %v, want the output of its predecessor", got)
+	}
+	want := map[uint]string{1: "completed", 2: "completed", 3: "completed", 4: "skipped", 5: "skipped"}
+	got := statuses(store, execution.ID)
+	for id, status := range want {
+		if got[id] != status {
+			t.Errorf("node %d status = %q, want %q", id, got[id], status)
+		}
+	}
+}
+
+func TestRunDisabledGroupsAndAnnotations(t *testing.T) {
+	e, store := testEngine()
+	group := uint(7)
+	grouped := node(2, "record", nil)
+	grouped.GroupID = &group
+	workflow := &Workflow{
+		Nodes: []Node{
+			node(1, "record", nil),
+			grouped,
+			{ID: 3, NodeType: "annotation", Config: map[string]interface{}{"content": "note"}},
+		},
+		Connections: []Connection{connect(1, 2)},
+		Groups:      []Group{{ID: group, Disabled: true}},
+	}
+
+	execution, err := e.Run(context.Background(), workflow, nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	got := statuses(store, execution.ID)
+	if got[2] != "skipped" {
+		t.Errorf("node of disabled group status = %q, want skipped", got[2])
+	}
+	if _, ok := got[3]; ok {
+		t.Errorf("annotation was executed")
+	}
+}
+
+func TestRunNodeTimeout(t *testing.T) {
+	e, _ := testEngine()
+	workflow := &Workflow{Nodes: []Node{node(1, "block", map[string]interface{}{"timeout": "10ms"})}}
+
+	execution, err := e.Run(context.Background(), workflow, nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Run() error = %v, want a timeout", err)
+	}
+	if execution.Status != "failed" {
+		t.Errorf("status = %q, want failed", execution.Status)
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	e, store := testEngine()
+	workflow := &Workflow{
+		Nodes:       []Node{node(1, "block", nil), node(2, "record", nil)},
+		Connections: []Connection{connect(1, 2)},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	execution, err := e.Run(ctx, workflow, nil)
+	if err == nil {
+		t.Fatal("Run() error = nil, want the cancellation")
+	}
+	if execution.Status != "cancelled" {
+		t.Errorf("status = %q, want cancelled", execution.Status)
+	}
+	if _, ok := statuses(store, execution.ID)[2]; ok {
+		t.Errorf("node after the cancellation was executed")
+	}
+}
+
+func TestRunLongChain(t *testing.T) {
+	e, _ := testEngine()
+	const length = 10000
+	workflow := &Workflow{}
+	for id := uint(1); id <= length; id++ {
+		workflow.Nodes = append(workflow.Nodes, node(id, "record", nil))
+		if id > 1 {
+			workflow.Connections = append(workflow.Connections, connect(id-1, id))
+		}
+	}
+
+	execution, err := e.Run(context.Background(), workflow, map[string]interface{}{"n": 1})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(execution.Outputs) != length {
+		t.Errorf("%d nodes completed, want %d", len(execution.Outputs), length)
+	}
+}
+
+func TestRunJoinsBranchesOnce(t *testing.T) {
+	e, store := testEngine()
+	workflow := &Workflow{
+		Nodes: []Node{
+			node(1, "record", map[string]interface{}{"out": "start"}),
+			node(2, "record", map[string]interface{}{"out": "left"}),
+			node(3, "record", map[string]interface{}{"out": "right"}),
+			node(4, "record", nil),
+		},
+		Connections: []Connection{connect(1, 2), connect(1, 3), connect(2, 4), connect(3, 4)},
+	}
+
+	execution, err := e.Run(context.Background(), workflow, nil)
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	runs := 0
+	for _, nodeExecution := range store.NodeExecutions(execution.ID) {
+		if nodeExecution.NodeID == 4 {
+			runs++
+		}
+	}
+	if runs != 1 {
+		t.Errorf("join node ran %d times, want once", runs)
+	}
+	inputs, _ := execution.Outputs[4].(map[string]interface{})["input"].([]interface{})
+	if len(inputs) != 2 {
+		t.Errorf("join node input = %v, want the outputs of both branches", execution.Outputs[4])
+	}
+}
@@ -0,0 +1,98 @@
+package engine
+
+import (
+	"context"
+)
+
+// NodeTypeAnnotation is the node type of sticky notes, which have no executor and are not run
+const NodeTypeAnnotation = "annotation"
+
+// Modes of disabled nodes
+const (
+	// DisabledPassthrough nodes forward their input instead of running their executor
+	DisabledPassthrough = "passthrough"
+	// DisabledSkip nodes are skipped along with the successors only reachable through them
+	DisabledSkip = "skip"
+)
+
+// StatusCancelled is the status of executions stopped by a cancellation
+const StatusCancelled = "cancelled"
+
+// NodeExecutor executes a node with its configuration and input
+type NodeExecutor interface {
+	Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error)
+}
+
+// ContextExecutor is implemented by executors that need the context of the run, e.g. to stop
+// when it is cancelled or to know which execution they run in. The engine prefers
+// ExecuteContext over Execute.
+type ContextExecutor interface {
+	ExecuteContext(ctx context.Context, config map[string]interface{}, input map[string]interface{}) (interface{}, error)
+}
+
+// BranchResult is returned by executors that route the execution to the connections of a
+// single output handle. Nodes reachable only through other handles are skipped.
+type BranchResult struct {
+	Handle string
+	Output interface{}
+}
+
+// ExecutionInfo describes the node execution an executor is invoked for
+type ExecutionInfo struct {
+	WorkflowID      uint
+	ExecutionID     uint
+	NodeID          uint
+	NodeExecutionID uint
+	// TriggerID is the trigger that started the execution, 0 for manual executions
+	TriggerID uint
+	// Attempt counts the executions of the node after failures, starting at 1
+	Attempt int
+	// IdempotencyKey is stable across restarts of the same attempt. Executors with side
+	// effects pass it to external systems so a retried attempt is not applied twice.
+	IdempotencyKey string
+}
+
+// executionInfoKey is the context key for ExecutionInfo
+type executionInfoKey struct{}
+
+// WithExecutionInfo returns a context carrying the execution info
+func WithExecutionInfo(parent context.Context, info ExecutionInfo) context.Context {
+	return context.WithValue(parent, executionInfoKey{}, info)
+}
+
+// ExecutionInfoFromContext returns the execution info passed to a ContextExecutor
+func ExecutionInfoFromContext(ctx context.Context) (ExecutionInfo, bool) {
+	info, ok := ctx.Value(executionInfoKey{}).(ExecutionInfo)
+	return info, ok
+}
+
+// Invoke runs the executor, passing the context if the executor supports it
+func Invoke(ctx context.Context, executor NodeExecutor, config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	if contextExecutor, ok := executor.(ContextExecutor); ok {
+		return contextExecutor.ExecuteContext(ctx, config, input)
+	}
+	return executor.Execute(config, input)
+}
+
+// passthroughExecutor forwards the input of disabled nodes: the execution input for start nodes,
+// the output of a single predecessor as it is, otherwise the outputs by input handle
+type passthroughExecutor struct {
+	start bool
+}
+
+func (e *passthroughExecutor) Execute(config map[string]interface{}, input map[string]interface{}) (interface{}, error) {
+	if !e.start && len(input) == 1 {
+		for _, value := range input {
+			if outputs, ok := value.([]interface{}); ok && len(outputs) == 1 {
+				return outputs[0], nil
+			}
+		}
+	}
+	return input, nil
+}
+
+// NewPassthroughExecutor returns the executor of disabled nodes, start reporting whether the
+// node is a start node
+func NewPassthroughExecutor(start bool) NodeExecutor {
+	return &passthroughExecutor{start: start}
+}
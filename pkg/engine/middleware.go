@@ -0,0 +1,77 @@
+package engine
+
+import (
+	"context"
+	"time"
+)
+
+// Invocation describes the execution of a node passed through the executor middleware.
+// Middleware may change Config and Input before calling the next handler.
+type Invocation struct {
+	ExecutionInfo
+	NodeType      string
+	ExecutorClass string
+	Config        map[string]interface{}
+	Input         map[string]interface{}
+	// Timeout bounds each call of the executor, 0 for no limit
+	Timeout time.Duration
+}
+
+// Handler executes an invocation
+type Handler func(ctx context.Context, invocation *Invocation) (interface{}, error)
+
+// Middleware wraps the execution of nodes, e.g. to record metrics, capture data lineage or
+// enforce policies, without changing the executors
+type Middleware func(next Handler) Handler
+
+// Chain wraps the handler in the middleware, the first one outermost
+func Chain(chain []Middleware, handler Handler) Handler {
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+	}
+	return handler
+}
+
+// Hooks builds middleware from callbacks. Before may reject the execution of a node by
+// returning an error, After may replace the output and OnError the error of the executor.
+type Hooks struct {
+	Before  func(ctx context.Context, invocation *Invocation) error
+	After   func(ctx context.Context, invocation *Invocation, output interface{}) (interface{}, error)
+	OnError func(ctx context.Context, invocation *Invocation, err error) error
+}
+
+// Middleware returns the middleware calling the hooks
+func (h Hooks) Middleware() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, invocation *Invocation) (interface{}, error) {
+			if h.Before != nil {
+				if err := h.Before(ctx, invocation); err != nil {
+					return nil, err
+				}
+			}
+
+			output, err := next(ctx, invocation)
+			if err != nil {
+				if h.OnError != nil {
+					err = h.OnError(ctx, invocation, err)
+				}
+				return output, err
+			}
+
+			if h.After != nil {
+				return h.After(ctx, invocation, output)
+			}
+			return output, nil
+		}
+	}
+}
+
+// ExecuteInvocation runs the executor for the invocation through the middleware, the first one
+// outermost, within the timeout of the invocation. The context passed on carries the execution
+// info of the invocation.
+func ExecuteInvocation(ctx context.Context, chain []Middleware, executor NodeExecutor, invocation *Invocation) (interface{}, error) {
+	handler := Chain(chain, func(ctx context.Context, invocation *Invocation) (interface{}, error) {
+		return Invoke(ctx, executor, invocation.Config, invocation.Input)
+	})
+	return executeWithTimeout(WithExecutionInfo(ctx, invocation.ExecutionInfo), handler, invocation)
+}
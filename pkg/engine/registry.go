@@ -0,0 +1,85 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// ExecutorFactory creates an executor for a node execution
+type ExecutorFactory func() NodeExecutor
+
+// defaults are the executors of every registry created with NewDefaultRegistry
+var defaults = NewRegistry()
+
+// RegisterDefault adds an executor to the registries created with NewDefaultRegistry. FlowCraft's
+// built-in stateless executors are registered by importing the builtin package:
+//
+//	import _ "github.com/altipard/flowcraft/pkg/engine/builtin"
+func RegisterDefault(executorClass string, factory ExecutorFactory) {
+	defaults.Register(executorClass, factory)
+}
+
+// Registry maps executor classes to executors
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]ExecutorFactory
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{factories: map[string]ExecutorFactory{}}
+}
+
+// NewDefaultRegistry creates a registry with the executors registered with RegisterDefault
+func NewDefaultRegistry() *Registry {
+	r := NewRegistry()
+	defaults.mu.RLock()
+	defer defaults.mu.RUnlock()
+	for class, factory := range defaults.factories {
+		r.factories[class] = factory
+	}
+	return r
+}
+
+// Register adds or replaces the executor of an executor class
+func (r *Registry) Register(executorClass string, factory ExecutorFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[executorClass] = factory
+}
+
+// Has reports whether an executor is registered for the executor class
+func (r *Registry) Has(executorClass string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.factories[executorClass]
+	return ok
+}
+
+// Classes returns the registered executor classes in order
+func (r *Registry) Classes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	classes := make([]string, 0, len(r.factories))
+	for class := range r.factories {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	return classes
+}
+
+// Load creates an executor of the executor class
+func (r *Registry) Load(executorClass string) (NodeExecutor, error) {
+	r.mu.RLock()
+	factory, ok := r.factories[executorClass]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown executor class: %s", executorClass)
+	}
+	executor := factory()
+	if executor == nil {
+		return nil, fmt.Errorf("executor class %s is not available", executorClass)
+	}
+	return executor, nil
+}
@@ -0,0 +1,168 @@
+package engine
+
+// Step is a node scheduled to be executed or, if none of its inputs was taken, skipped
+type Step struct {
+	NodeID uint
+	Skip   bool
+}
+
+// Outcome is how a finished node ended
+type Outcome struct {
+	Skipped bool
+	// Handle is the output handle taken by branching nodes, empty if all outputs are active
+	Handle string
+}
+
+// Scheduler orders the nodes of a workflow run: a node is ready once all of its predecessors
+// finished, and it is executed if one of its incoming connections was taken, skipped otherwise.
+// What executing and skipping a node means is up to the caller; the engine of this package
+// records nodes in its Store, the platform's workers checkpoint them in the database.
+type Scheduler struct {
+	incoming map[uint][]Connection
+	outgoing map[uint][]Connection
+	// claimed are the nodes executed, skipped or continued from a checkpoint in this run
+	claimed map[uint]bool
+	// finished tracks the nodes that completed or were skipped with the output handle they took
+	finished map[uint]Outcome
+}
+
+// NewScheduler creates a scheduler for the connections of a workflow. The connections of a node
+// are considered in the order given.
+func NewScheduler(connections []Connection) *Scheduler {
+	s := &Scheduler{
+		incoming: map[uint][]Connection{},
+		outgoing: map[uint][]Connection{},
+		claimed:  map[uint]bool{},
+		finished: map[uint]Outcome{},
+	}
+	for _, conn := range connections {
+		s.incoming[conn.TargetNodeID] = append(s.incoming[conn.TargetNodeID], conn)
+		s.outgoing[conn.SourceNodeID] = append(s.outgoing[conn.SourceNodeID], conn)
+	}
+	return s
+}
+
+// StartSteps returns the steps executing the nodes without incoming connections, in order
+func (s *Scheduler) StartSteps(nodeIDs []uint) []Step {
+	var steps []Step
+	for _, id := range nodeIDs {
+		if len(s.incoming[id]) == 0 {
+			steps = append(steps, Step{NodeID: id})
+		}
+	}
+	return steps
+}
+
+// IsStart reports whether the node has no incoming connections
+func (s *Scheduler) IsStart(nodeID uint) bool {
+	return len(s.incoming[nodeID]) == 0
+}
+
+// Claim marks a node as handled by this run, e.g. when it is continued from a checkpoint
+func (s *Scheduler) Claim(nodeID uint) {
+	s.claimed[nodeID] = true
+}
+
+// Finish records a completed or skipped node
+func (s *Scheduler) Finish(nodeID uint, outcome Outcome) {
+	s.finished[nodeID] = outcome
+}
+
+// Run executes or skips the scheduled nodes and the nodes becoming ready through them in
+// topological order. A node is handled once, even if it is reached through several
+// connections. Ready nodes are kept in a queue instead of recursing into the successors of each
+// node, so long chains of nodes don't grow the stack.
+//
+// handle runs or skips a node and reports whether it finished, i.e. called Finish, so its
+// successors may be ready. Run stops at the first error of handle.
+func (s *Scheduler) Run(steps []Step, handle func(step Step) (bool, error)) error {
+	queue := steps
+	for len(queue) > 0 {
+		step := queue[0]
+		queue = queue[1:]
+		if s.claimed[step.NodeID] {
+			continue
+		}
+		s.claimed[step.NodeID] = true
+
+		finished, err := handle(step)
+		if err != nil {
+			return err
+		}
+		if finished {
+			queue = append(queue, s.ReadySuccessors(step.NodeID)...)
+		}
+	}
+	return nil
+}
+
+// ReadySuccessors returns the successors of a finished node whose predecessors all finished, to
+// be skipped if none of their incoming connections was taken
+func (s *Scheduler) ReadySuccessors(nodeID uint) []Step {
+	var steps []Step
+	for _, conn := range s.outgoing[nodeID] {
+		target := conn.TargetNodeID
+		if s.claimed[target] {
+			continue
+		}
+
+		ready, active := true, false
+		for _, incoming := range s.incoming[target] {
+			if _, ok := s.finished[incoming.SourceNodeID]; !ok {
+				ready = false
+				break
+			}
+			if s.Taken(incoming) {
+				active = true
+			}
+		}
+		if ready {
+			steps = append(steps, Step{NodeID: target, Skip: !active})
+		}
+	}
+	return steps
+}
+
+// Taken reports whether the source of the connection completed and took its output handle.
+// Nodes without an output handle activate all of their connections.
+func (s *Scheduler) Taken(conn Connection) bool {
+	source, ok := s.finished[conn.SourceNodeID]
+	if !ok || source.Skipped {
+		return false
+	}
+	handle := conn.SourceHandle
+	if handle == "" {
+		handle = "output"
+	}
+	return source.Handle == "" || source.Handle == handle
+}
+
+// Input collects the input of a node: the outputs of its predecessors by target handle, along
+// with the predecessors they came from, or the execution input for start nodes
+func (s *Scheduler) Input(nodeID uint, input map[string]interface{}, outputs map[uint]interface{}) (map[string]interface{}, map[string][]uint) {
+	connections := s.incoming[nodeID]
+	if len(connections) == 0 {
+		return input, nil
+	}
+
+	inputs := map[string]interface{}{}
+	sources := map[string][]uint{}
+	for _, conn := range connections {
+		// Ignore connections of output handles that were not taken
+		if !s.Taken(conn) {
+			continue
+		}
+		output, ok := outputs[conn.SourceNodeID]
+		if !ok {
+			continue
+		}
+		handle := conn.TargetHandle
+		if handle == "" {
+			handle = "input"
+		}
+		list, _ := inputs[handle].([]interface{})
+		inputs[handle] = append(list, output)
+		sources[handle] = append(sources[handle], conn.SourceNodeID)
+	}
+	return inputs, sources
+}
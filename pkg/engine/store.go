@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrNotFound is returned by stores for unknown workflows and executions
+var ErrNotFound = errors.New("not found")
+
+// Workflow is a graph of nodes connected from output to input handles
+type Workflow struct {
+	ID          uint         `json:"id"`
+	Name        string       `json:"name"`
+	Nodes       []Node       `json:"nodes"`
+	Connections []Connection `json:"connections"`
+	Groups      []Group      `json:"groups,omitempty"`
+}
+
+// Node is a node of a workflow with the executor class of its node type resolved
+type Node struct {
+	ID            uint                   `json:"id"`
+	Name          string                 `json:"name"`
+	NodeType      string                 `json:"node_type"`
+	ExecutorClass string                 `json:"executor_class"`
+	Config        map[string]interface{} `json:"config"`
+	// GroupID references the group the node belongs to
+	GroupID *uint `json:"group_id,omitempty"`
+	// Disabled nodes forward their input in DisabledMode "passthrough" (default) or are
+	// skipped in DisabledMode "skip"
+	Disabled     bool   `json:"disabled,omitempty"`
+	DisabledMode string `json:"disabled_mode,omitempty"`
+}
+
+// IsAnnotation reports whether the node is a sticky note, which has no executor and is not run
+func (n Node) IsAnnotation() bool {
+	return n.NodeType == NodeTypeAnnotation
+}
+
+// Group groups nodes of a workflow. The nodes of a disabled group are skipped as a unit.
+type Group struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	Disabled bool   `json:"disabled"`
+}
+
+// Connection connects an output handle of a node to an input handle of another node
+type Connection struct {
+	SourceNodeID uint   `json:"source_node_id"`
+	TargetNodeID uint   `json:"target_node_id"`
+	SourceHandle string `json:"source_handle"`
+	TargetHandle string `json:"target_handle"`
+}
+
+// Execution is a run of a workflow
+type Execution struct {
+	ID          uint                   `json:"id"`
+	WorkflowID  uint                   `json:"workflow_id"`
+	Status      string                 `json:"status"` // running, completed, failed or cancelled
+	Input       map[string]interface{} `json:"input"`
+	Outputs     map[uint]interface{}   `json:"outputs"`
+	Error       string                 `json:"error,omitempty"`
+	StartedAt   time.Time              `json:"started_at"`
+	CompletedAt *time.Time             `json:"completed_at,omitempty"`
+}
+
+// NodeExecution is the execution of a node within a run
+type NodeExecution struct {
+	ExecutionID  uint                   `json:"execution_id"`
+	NodeID       uint                   `json:"node_id"`
+	Status       string                 `json:"status"` // completed, failed or skipped
+	OutputHandle string                 `json:"output_handle,omitempty"`
+	Input        map[string]interface{} `json:"input,omitempty"`
+	Output       interface{}            `json:"output,omitempty"`
+	Error        string                 `json:"error,omitempty"`
+	StartedAt    time.Time              `json:"started_at"`
+	CompletedAt  time.Time              `json:"completed_at"`
+}
+
+// Store loads workflows and records executions for the engine
+type Store interface {
+	// LoadWorkflow returns the workflow with the given ID, or ErrNotFound
+	LoadWorkflow(ctx context.Context, id uint) (*Workflow, error)
+	// SaveExecution creates the execution if its ID is 0 (assigning one) or updates it
+	SaveExecution(ctx context.Context, execution *Execution) error
+	// SaveNodeExecution records a finished node execution
+	SaveNodeExecution(ctx context.Context, nodeExecution *NodeExecution) error
+}
+
+// MemoryStore keeps workflows and executions in memory
+type MemoryStore struct {
+	mu             sync.RWMutex
+	workflows      map[uint]*Workflow
+	executions     map[uint]*Execution
+	nodeExecutions map[uint][]NodeExecution
+	nextID         uint
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		workflows:      map[uint]*Workflow{},
+		executions:     map[uint]*Execution{},
+		nodeExecutions: map[uint][]NodeExecution{},
+	}
+}
+
+// AddWorkflow adds or replaces a workflow
+func (s *MemoryStore) AddWorkflow(workflow *Workflow) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.workflows[workflow.ID] = workflow
+}
+
+// LoadWorkflow returns the workflow with the given ID
+func (s *MemoryStore) LoadWorkflow(ctx context.Context, id uint) (*Workflow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	workflow, ok := s.workflows[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return workflow, nil
+}
+
+// SaveExecution creates or updates an execution
+func (s *MemoryStore) SaveExecution(ctx context.Context, execution *Execution) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if execution.ID == 0 {
+		s.nextID++
+		execution.ID = s.nextID
+	}
+	copied := *execution
+	s.executions[execution.ID] = &copied
+	return nil
+}
+
+// SaveNodeExecution records a node execution
+func (s *MemoryStore) SaveNodeExecution(ctx context.Context, nodeExecution *NodeExecution) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nodeExecutions[nodeExecution.ExecutionID] = append(s.nodeExecutions[nodeExecution.ExecutionID], *nodeExecution)
+	return nil
+}
+
+// Execution returns a recorded execution
+func (s *MemoryStore) Execution(id uint) (*Execution, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	execution, ok := s.executions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	copied := *execution
+	return &copied, nil
+}
+
+// NodeExecutions returns the node executions of an execution in the order they finished
+func (s *MemoryStore) NodeExecutions(executionID uint) []NodeExecution {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]NodeExecution(nil), s.nodeExecutions[executionID]...)
+}
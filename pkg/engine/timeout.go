@@ -0,0 +1,74 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// TimeoutError is returned for executor calls exceeding the timeout of their node
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("node timed out after %s", e.Timeout)
+}
+
+// ErrorCode returns the machine readable code of the error
+func (e *TimeoutError) ErrorCode() string {
+	return "NODE_TIMEOUT"
+}
+
+// NodeTimeout returns the timeout of the executor calls of a node from the duration in the
+// "timeout" of its config, e.g. "30s", 0 if the node has none
+func NodeTimeout(config map[string]interface{}) (time.Duration, error) {
+	value, ok := config["timeout"]
+	if !ok || value == "" || value == nil {
+		return 0, nil
+	}
+	text, ok := value.(string)
+	if !ok {
+		return 0, errors.New("timeout must be a duration like 30s")
+	}
+	timeout, err := time.ParseDuration(text)
+	if err != nil || timeout <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q, expected a positive duration like 30s", text)
+	}
+	return timeout, nil
+}
+
+// executeWithTimeout calls the handler with a deadline of the invocation's timeout, without one
+// if it is 0. Executors taking a context are cancelled at the deadline; calls of executors
+// ignoring it are abandoned and their late result is discarded.
+func executeWithTimeout(ctx context.Context, handler Handler, invocation *Invocation) (interface{}, error) {
+	if invocation.Timeout <= 0 {
+		return handler(ctx, invocation)
+	}
+	ctx, cancel := context.WithTimeout(ctx, invocation.Timeout)
+	defer cancel()
+
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := handler(ctx, invocation)
+		done <- outcome{result, err}
+	}()
+
+	select {
+	case outcome := <-done:
+		if outcome.err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, &TimeoutError{Timeout: invocation.Timeout}
+		}
+		return outcome.result, outcome.err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, &TimeoutError{Timeout: invocation.Timeout}
+		}
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,89 @@
+// Package runner executes workflows exported with the compile command inside other programs,
+// without the database, queue and workers of the platform. It runs the bundle with the
+// embeddable engine and its built-in stateless executors.
+//
+// The package is experimental and its bundle format may change between releases.
+package runner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/altipard/flowcraft/pkg/engine"
+	_ "github.com/altipard/flowcraft/pkg/engine/builtin"
+)
+
+// BundleVersion is the version of the bundle format written by the compile command
+const BundleVersion = 1
+
+// Node is a node of an exported workflow with the executor class of its node type resolved
+type Node = engine.Node
+
+// Connection connects an output handle of a node to an input handle of another node
+type Connection = engine.Connection
+
+// Bundle is an exported workflow
+type Bundle struct {
+	Version     int          `json:"version"`
+	WorkflowID  uint         `json:"workflow_id"`
+	Name        string       `json:"name"`
+	Nodes       []Node       `json:"nodes"`
+	Connections []Connection `json:"connections"`
+}
+
+// Supports reports whether exported workflows can use the executor class
+func Supports(executorClass string) bool {
+	return engine.NewDefaultRegistry().Has(executorClass)
+}
+
+// Load parses and validates a bundle
+func Load(data []byte) (*Bundle, error) {
+	var bundle Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("failed to parse bundle: %v", err)
+	}
+	if err := bundle.Validate(); err != nil {
+		return nil, err
+	}
+	return &bundle, nil
+}
+
+// workflow returns the workflow of the bundle
+func (b *Bundle) workflow() *engine.Workflow {
+	return &engine.Workflow{ID: b.WorkflowID, Name: b.Name, Nodes: b.Nodes, Connections: b.Connections}
+}
+
+// Validate checks the bundle version, the executor classes of its nodes and its connections
+func (b *Bundle) Validate() error {
+	if b.Version != BundleVersion {
+		return fmt.Errorf("unsupported bundle version %d, expected %d", b.Version, BundleVersion)
+	}
+	return engine.New(engine.NewMemoryStore(), nil).Validate(b.workflow())
+}
+
+// Result is the outcome of a run: the outputs of the executed nodes and the skipped nodes
+type Result struct {
+	Outputs map[uint]interface{} `json:"outputs"`
+	Skipped []uint               `json:"skipped"`
+}
+
+// Run executes the workflow of the bundle with the given input. It stops at the first failing
+// node.
+func Run(ctx context.Context, bundle *Bundle, input map[string]interface{}) (*Result, error) {
+	store := engine.NewMemoryStore()
+	execution, err := engine.New(store, nil).Run(ctx, bundle.workflow(), input)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Outputs: execution.Outputs, Skipped: []uint{}}
+	for _, nodeExecution := range store.NodeExecutions(execution.ID) {
+		if nodeExecution.Status == "skipped" {
+			result.Skipped = append(result.Skipped, nodeExecution.NodeID)
+		}
+	}
+	sort.Slice(result.Skipped, func(i, j int) bool { return result.Skipped[i] < result.Skipped[j] })
+	return result, nil
+}